@@ -0,0 +1,198 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// APIVersionProbe reports whether the service supports major version "version" of its API.
+type APIVersionProbe func(ctx context.Context, service *BaseService, version int) (bool, error)
+
+// APIVersions describes the major versions of a service's API that are supported by an SDK,
+// which are negotiated with the service by BaseService.GetAPIVersion().
+type APIVersions struct {
+	// The major versions supported by the SDK (e.g. []int{1, 2}).
+	Supported []int
+
+	// The path (relative to the service URL) of a resource that exists only if the service
+	// supports a particular version, with "{version}" in place of the version number
+	// (e.g. "/v{version}/health"). The default is "/v{version}".
+	// A version is supported unless a GET request for the resource fails with a
+	// 404 Not Found, 410 Gone or 501 Not Implemented response.
+	ProbePath string
+
+	// An optional function used in place of the GET request to probe for a version.
+	Probe APIVersionProbe
+}
+
+// SetAPIVersions registers the major versions of the service's API that are supported by the SDK.
+// The highest version that is also supported by the service is negotiated when GetAPIVersion()
+// is first invoked. A nil value removes the registration.
+func (service *BaseService) SetAPIVersions(versions *APIVersions) error {
+	var versionsCopy *APIVersions
+	if versions != nil {
+		if len(versions.Supported) == 0 {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "Supported")
+		}
+		versionsCopy = &APIVersions{}
+		*versionsCopy = *versions
+		versionsCopy.Supported = append([]int(nil), versions.Supported...)
+		sort.Sort(sort.Reverse(sort.IntSlice(versionsCopy.Supported)))
+		if versionsCopy.Supported[len(versionsCopy.Supported)-1] <= 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "Supported")
+		}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.apiVersions = versionsCopy
+	service.negotiatedAPIVersion = 0
+	service.negotiatedAPIVersionURL = ""
+	return nil
+}
+
+// PinAPIVersion pins the major version of the service's API, bypassing negotiation.
+// The version must be one of the versions registered with SetAPIVersions().
+// A version of 0 removes the pin.
+// The version can also be pinned with the "API_VERSION" property in external configuration.
+func (service *BaseService) PinAPIVersion(version int) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.pinnedAPIVersion = version
+}
+
+// GetAPIVersion returns the major version of the service's API to be used: the pinned version
+// if any, or else the highest version registered with SetAPIVersions() that is also supported
+// by the service. The negotiated version is cached until the service URL is changed.
+func (service *BaseService) GetAPIVersion(ctx context.Context) (int, error) {
+	if version, versions, err := service.getCachedAPIVersion(); version != 0 || err != nil {
+		return version, err
+	} else if versions == nil {
+		return 0, fmt.Errorf(ERRORMSG_PROP_MISSING, "APIVersions")
+	}
+
+	// Negotiate the version, unless another goroutine did so in the meantime.
+	service.apiVersionMutex.Lock()
+	defer service.apiVersionMutex.Unlock()
+
+	version, versions, err := service.getCachedAPIVersion()
+	if version != 0 || err != nil {
+		return version, err
+	}
+	serviceURL := service.GetServiceURL()
+
+	probe := versions.Probe
+	if probe == nil {
+		probe = newAPIVersionProbe(versions.ProbePath)
+	}
+	for _, candidate := range versions.Supported {
+		if ctx != nil && ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		var supported bool
+		err := callSafelyWithError(PanicSourceAPIVersionProbe, func() (err error) {
+			supported, err = probe(ctx, service, candidate)
+			return
+		})
+		if err != nil {
+			return 0, err
+		}
+		if supported {
+			GetLogger().Debug("Negotiated API version %d with %s", candidate, serviceURL)
+
+			service.mutex.Lock()
+			defer service.mutex.Unlock()
+
+			service.negotiatedAPIVersion = candidate
+			service.negotiatedAPIVersionURL = serviceURL
+			return candidate, nil
+		}
+	}
+	return 0, fmt.Errorf(ERRORMSG_API_VERSION_NEGOTIATION, versions.Supported, serviceURL)
+}
+
+// getCachedAPIVersion returns the pinned or previously negotiated API version (or 0),
+// along with the registered versions.
+func (service *BaseService) getCachedAPIVersion() (int, *APIVersions, error) {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	versions := service.apiVersions
+	if service.pinnedAPIVersion != 0 {
+		if versions == nil || !isSupportedAPIVersion(versions.Supported, service.pinnedAPIVersion) {
+			var supported []int
+			if versions != nil {
+				supported = versions.Supported
+			}
+			return 0, versions, fmt.Errorf(ERRORMSG_API_VERSION_UNSUPPORTED, service.pinnedAPIVersion, supported)
+		}
+		return service.pinnedAPIVersion, versions, nil
+	}
+	if service.negotiatedAPIVersion != 0 && service.negotiatedAPIVersionURL == service.Options.URL {
+		return service.negotiatedAPIVersion, versions, nil
+	}
+	return 0, versions, nil
+}
+
+func isSupportedAPIVersion(supported []int, version int) bool {
+	for _, v := range supported {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIVersionProbe returns an APIVersionProbe that sends a GET request for "probePath".
+func newAPIVersionProbe(probePath string) APIVersionProbe {
+	if probePath == "" {
+		probePath = "/v{version}"
+	}
+	return func(ctx context.Context, service *BaseService, version int) (bool, error) {
+		builder := NewRequestBuilder(GET)
+		if ctx != nil {
+			builder = builder.WithContext(ctx)
+		}
+		path := strings.Replace(probePath, "{version}", strconv.Itoa(version), -1)
+		if _, err := builder.ResolveRequestURL(service.GetServiceURL(), path, nil); err != nil {
+			return false, err
+		}
+		req, err := builder.Build()
+		if err != nil {
+			return false, err
+		}
+
+		var body io.ReadCloser
+		_, err = service.Request(req, &body)
+		if body != nil {
+			body.Close() // #nosec G104
+		}
+		switch getStatusCode(err) {
+		case http.StatusNotFound, http.StatusGone, http.StatusNotImplemented:
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
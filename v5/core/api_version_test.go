@@ -0,0 +1,154 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAPIVersion(t *testing.T) {
+	var probes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes = append(probes, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1", "/v2":
+			w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+			fmt.Fprint(w, `{"status": "ok"}`)
+		case "/v4":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// No versions are registered.
+	_, err = service.GetAPIVersion(context.Background())
+	assert.NotNil(t, err)
+
+	// The highest version supported by the service is negotiated once, then cached.
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{1, 3, 2}}))
+	version, err := service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, []string{"/v3", "/v2"}, probes)
+	version, err = service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+	assert.Len(t, probes, 2)
+
+	// A clone shares the negotiated version.
+	version, err = service.Clone().GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+	assert.Len(t, probes, 2)
+
+	// A pinned version bypasses negotiation, but must be supported.
+	service.PinAPIVersion(1)
+	version, err = service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+	service.PinAPIVersion(5)
+	_, err = service.GetAPIVersion(context.Background())
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_API_VERSION_UNSUPPORTED, 5, []int{3, 2, 1}), err.Error())
+	service.PinAPIVersion(0)
+
+	// An unexpected probe failure is returned, and the negotiation is attempted again later.
+	probes = nil
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{4, 1}}))
+	_, err = service.GetAPIVersion(context.Background())
+	assert.Equal(t, http.StatusInternalServerError, getStatusCode(err))
+	assert.Equal(t, []string{"/v4"}, probes)
+
+	// The version is negotiated again if the service URL changes.
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{1, 2}, ProbePath: "/v{version}"}))
+	_, err = service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	probes = nil
+	assert.Nil(t, service.SetServiceURL(server.URL+"/"))
+	version, err = service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+	assert.Len(t, probes, 1)
+
+	// None of the versions is supported.
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{7, 8}}))
+	_, err = service.GetAPIVersion(context.Background())
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_API_VERSION_NEGOTIATION, []int{8, 7}, server.URL+"/"), err.Error())
+
+	// Invalid versions are rejected.
+	assert.NotNil(t, service.SetAPIVersions(&APIVersions{}))
+	assert.NotNil(t, service.SetAPIVersions(&APIVersions{Supported: []int{0, 1}}))
+}
+
+func TestGetAPIVersionCustomProbe(t *testing.T) {
+	service, err := NewBaseService(&ServiceOptions{URL: "https://example.com", Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	type failKey struct{}
+	probeErr := errors.New("probe failed")
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{
+		Supported: []int{1, 2},
+		Probe: func(ctx context.Context, service *BaseService, version int) (bool, error) {
+			if ctx.Value(failKey{}) != nil {
+				return false, probeErr
+			}
+			return version == 1, nil
+		},
+	}))
+	_, err = service.GetAPIVersion(context.WithValue(context.Background(), failKey{}, true))
+	assert.Equal(t, probeErr, err)
+	version, err := service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+
+	// A cancelled context stops the negotiation.
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{1}}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = service.GetAPIVersion(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestConfigureServiceAPIVersion(t *testing.T) {
+	os.Setenv("VERSIONED_SERVICE_URL", "https://example.com")
+	os.Setenv("VERSIONED_SERVICE_API_VERSION", "v2")
+	defer os.Unsetenv("VERSIONED_SERVICE_URL")
+	defer os.Unsetenv("VERSIONED_SERVICE_API_VERSION")
+
+	service, err := NewBaseService(&ServiceOptions{Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.ConfigureService("versioned_service"))
+	assert.Nil(t, service.SetAPIVersions(&APIVersions{Supported: []int{1, 2, 3}}))
+	version, err := service.GetAPIVersion(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, version)
+
+	os.Setenv("VERSIONED_SERVICE_API_VERSION", "two")
+	assert.NotNil(t, service.ConfigureService("versioned_service"))
+}
@@ -0,0 +1,119 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The locations in which an APIKeyHeaderAuthenticator can place the apikey.
+const (
+	APIKeyLocationHeader = "header"
+	APIKeyLocationQuery  = "query"
+)
+
+// The default name of the header (or query parameter) that holds the apikey.
+const defaultAPIKeyName = "X-API-Key"
+
+// APIKeyHeaderAuthenticator adds a user-supplied apikey (e.g. the subscription key
+// required by an API gateway) to each request, either as a header of the form:
+//
+// 		<KeyName>: <apikey>
+//
+// or as a query parameter of the form:
+//
+// 		?<KeyName>=<apikey>
+//
+type APIKeyHeaderAuthenticator struct {
+	// The apikey [required].
+	ApiKey string
+
+	// The name of the header or query parameter that holds the apikey [optional].
+	// Defaults to "X-API-Key".
+	KeyName string
+
+	// The location of the apikey: APIKeyLocationHeader (the default) or APIKeyLocationQuery [optional].
+	Location string
+}
+
+// NewAPIKeyHeaderAuthenticator constructs a new APIKeyHeaderAuthenticator instance.
+// The "keyName" and "location" arguments may be empty, to use their default values.
+func NewAPIKeyHeaderAuthenticator(apikey string, keyName string, location string) (*APIKeyHeaderAuthenticator, error) {
+	obj := &APIKeyHeaderAuthenticator{
+		ApiKey:   apikey,
+		KeyName:  keyName,
+		Location: location,
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// newAPIKeyHeaderAuthenticatorFromMap constructs a new APIKeyHeaderAuthenticator instance
+// from a map.
+func newAPIKeyHeaderAuthenticatorFromMap(properties map[string]string) (*APIKeyHeaderAuthenticator, error) {
+	if properties == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROPS_MAP_NIL)
+	}
+
+	return NewAPIKeyHeaderAuthenticator(properties[PROPNAME_APIKEY], properties[PROPNAME_APIKEY_NAME],
+		properties[PROPNAME_APIKEY_LOCATION])
+}
+
+// AuthenticationType returns the authentication type for this authenticator.
+func (APIKeyHeaderAuthenticator) AuthenticationType() string {
+	return AUTHTYPE_APIKEY_HEADER
+}
+
+// Authenticate adds the apikey to the request's headers or query parameters.
+func (this *APIKeyHeaderAuthenticator) Authenticate(request *http.Request) error {
+	keyName := this.KeyName
+	if keyName == "" {
+		keyName = defaultAPIKeyName
+	}
+
+	if strings.EqualFold(this.Location, APIKeyLocationQuery) {
+		query := request.URL.Query()
+		query.Set(keyName, this.ApiKey)
+		request.URL.RawQuery = query.Encode()
+	} else {
+		request.Header.Set(keyName, this.ApiKey)
+	}
+	return nil
+}
+
+// Validate the authenticator's configuration.
+//
+// Ensures the apikey is not Nil and does not contain invalid characters,
+// and that the location (if specified) is either "header" or "query".
+func (this APIKeyHeaderAuthenticator) Validate() error {
+	if this.ApiKey == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "ApiKey")
+	}
+
+	if HasBadFirstOrLastChar(this.ApiKey) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "ApiKey")
+	}
+
+	if this.Location != "" && !strings.EqualFold(this.Location, APIKeyLocationHeader) &&
+		!strings.EqualFold(this.Location, APIKeyLocationQuery) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "Location")
+	}
+
+	return nil
+}
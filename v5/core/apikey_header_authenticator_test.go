@@ -0,0 +1,74 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyHeaderAuthValidate(t *testing.T) {
+	_, err := NewAPIKeyHeaderAuthenticator("", "", "")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_MISSING, "ApiKey").Error(), err.Error())
+
+	_, err = NewAPIKeyHeaderAuthenticator("{apikey}", "", "")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_INVALID, "ApiKey").Error(), err.Error())
+
+	_, err = NewAPIKeyHeaderAuthenticator("apikey", "", "cookie")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_INVALID, "Location").Error(), err.Error())
+
+	authenticator, err := NewAPIKeyHeaderAuthenticator("apikey", "", "")
+	assert.Nil(t, err)
+	assert.Equal(t, AUTHTYPE_APIKEY_HEADER, authenticator.AuthenticationType())
+}
+
+func TestAPIKeyHeaderAuthAuthenticate(t *testing.T) {
+	// Default header name.
+	authenticator, err := NewAPIKeyHeaderAuthenticator("my-key", "", "")
+	assert.Nil(t, err)
+	builder, err := NewRequestBuilder(GET).ConstructHTTPURL("https://localhost/placeholder/url", nil, nil)
+	assert.Nil(t, err)
+	request, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "my-key", request.Header.Get("X-API-Key"))
+	assert.Empty(t, request.URL.RawQuery)
+
+	// Custom header name.
+	authenticator, err = NewAPIKeyHeaderAuthenticator("my-key", "Ocp-Apim-Subscription-Key", APIKeyLocationHeader)
+	assert.Nil(t, err)
+	request, err = builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "my-key", request.Header.Get("Ocp-Apim-Subscription-Key"))
+
+	// Query parameter, which replaces an existing value and retains other parameters.
+	authenticator, err = NewAPIKeyHeaderAuthenticator("my key", "subscription-key", "Query")
+	assert.Nil(t, err)
+	builder.AddQuery("subscription-key", "old")
+	builder.AddQuery("limit", "10")
+	request, err = builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "limit=10&subscription-key=my+key", request.URL.RawQuery)
+	assert.Empty(t, request.Header.Get("subscription-key"))
+}
@@ -0,0 +1,151 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIKeyStatus is the outcome of validating an apikey with ValidateAPIKey.
+type APIKeyStatus string
+
+// APIKeyStatus values.
+const (
+	// The apikey can be used to obtain an IAM access token.
+	APIKeyValid APIKeyStatus = "valid"
+
+	// The apikey is not known to the IAM token server.
+	APIKeyInvalid APIKeyStatus = "invalid"
+
+	// The apikey (or its identity) has been disabled.
+	APIKeyDisabled APIKeyStatus = "disabled"
+
+	// The apikey (or its identity) has been locked.
+	APIKeyLocked APIKeyStatus = "locked"
+
+	// The URL does not appear to be that of an IAM token server.
+	APIKeyWrongEndpoint APIKeyStatus = "wrong_endpoint"
+)
+
+// APIKeyValidationResult holds the result of validating an apikey with ValidateAPIKey.
+type APIKeyValidationResult struct {
+	// The outcome of the validation.
+	Status APIKeyStatus
+
+	// The HTTP status code received from the IAM token server.
+	StatusCode int
+
+	// The error code and message received from the IAM token server (if the apikey is not valid).
+	ErrorCode string
+	Message   string
+}
+
+// IsValid returns true iff the apikey is valid.
+func (result *APIKeyValidationResult) IsValid() bool {
+	return result.Status == APIKeyValid
+}
+
+// iamErrorResponse models an error response received from the IAM token server.
+type iamErrorResponse struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// ValidateAPIKey verifies that the specified apikey can be used to obtain an access token
+// from the IAM token server at "iamURL" (the default IAM token server if empty), so that
+// setup tools can verify credentials before they are used by long-running components.
+//
+// The outcome is described by the Status field of the result: APIKeyValid, APIKeyInvalid,
+// APIKeyDisabled, APIKeyLocked or APIKeyWrongEndpoint (i.e. the URL did not respond like an
+// IAM token server). A disabled or locked apikey is detected from the IAM error message.
+// An error is returned only if the IAM token server could not be invoked at all.
+func ValidateAPIKey(ctx context.Context, apikey string, iamURL string) (*APIKeyValidationResult, error) {
+	if apikey == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "apikey")
+	}
+
+	authenticator := &IamAuthenticator{ApiKey: apikey, URL: iamURL}
+
+	builder := NewRequestBuilder(POST)
+	if ctx != nil {
+		builder.WithContext(ctx)
+	}
+	_, err := builder.ResolveRequestURL(authenticator.tokenServerURL(), iamAuthOperationPathGetToken, nil)
+	if err != nil {
+		return nil, err
+	}
+	builder.AddHeader(CONTENT_TYPE, FORM_URL_ENCODED_HEADER)
+	builder.AddHeader(Accept, APPLICATION_JSON)
+	builder.AddFormData("grant_type", "", "", iamAuthGrantTypeApiKey)
+	builder.AddFormData("apikey", "", "", apikey)
+	builder.AddFormData("response_type", "", "", "cloud_iam")
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	GetLogger().Debug("Invoking IAM 'get token' operation to validate an apikey: %s", builder.URL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &APIKeyValidationResult{
+		StatusCode: resp.StatusCode,
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		tokenResponse := &IamTokenServerResponse{}
+		if json.Unmarshal(body, tokenResponse) != nil || tokenResponse.AccessToken == "" {
+			result.Status = APIKeyWrongEndpoint
+		} else {
+			result.Status = APIKeyValid
+		}
+		return result, nil
+	}
+
+	errorResponse := &iamErrorResponse{}
+	if json.Unmarshal(body, errorResponse) != nil || (errorResponse.ErrorCode == "" && errorResponse.ErrorMessage == "") {
+		result.Status = APIKeyWrongEndpoint
+		result.Message = http.StatusText(resp.StatusCode)
+		return result, nil
+	}
+
+	result.ErrorCode = errorResponse.ErrorCode
+	result.Message = errorResponse.ErrorMessage
+	message := strings.ToLower(errorResponse.ErrorMessage)
+	switch {
+	case strings.Contains(message, "disabled"):
+		result.Status = APIKeyDisabled
+	case strings.Contains(message, "locked"):
+		result.Status = APIKeyLocked
+	default:
+		result.Status = APIKeyInvalid
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/identity/token" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<html>Not Found</html>")
+			return
+		}
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "urn:ibm:params:oauth:grant-type:apikey", r.PostForm.Get("grant_type"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("apikey") {
+		case "valid-key":
+			fmt.Fprint(w, `{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`)
+		case "disabled-key":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorCode": "BXNIM0416E", "errorMessage": "The API key is disabled."}`)
+		case "locked-key":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorCode": "BXNIM0418E", "errorMessage": "The user is locked."}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorCode": "BXNIM0415E", "errorMessage": "Provided API key could not be found."}`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	result, err := ValidateAPIKey(ctx, "valid-key", server.URL)
+	assert.Nil(t, err)
+	assert.True(t, result.IsValid())
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	result, err = ValidateAPIKey(ctx, "disabled-key", server.URL+"/identity/token")
+	assert.Nil(t, err)
+	assert.Equal(t, APIKeyDisabled, result.Status)
+	assert.Equal(t, "BXNIM0416E", result.ErrorCode)
+
+	result, err = ValidateAPIKey(ctx, "locked-key", server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, APIKeyLocked, result.Status)
+
+	result, err = ValidateAPIKey(ctx, "unknown-key", server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, APIKeyInvalid, result.Status)
+	assert.False(t, result.IsValid())
+	assert.Equal(t, "Provided API key could not be found.", result.Message)
+
+	result, err = ValidateAPIKey(ctx, "valid-key", server.URL+"/other")
+	assert.Nil(t, err)
+	assert.Equal(t, APIKeyWrongEndpoint, result.Status)
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+
+	_, err = ValidateAPIKey(ctx, "", server.URL)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "apikey"), err.Error())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = ValidateAPIKey(canceled, "valid-key", server.URL)
+	assert.NotNil(t, err)
+}
+
+func TestValidateAPIKeyWrongEndpoint(t *testing.T) {
+	// A server that returns a successful non-token response.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"name": "not iam"}`)
+	}))
+	defer server.Close()
+
+	result, err := ValidateAPIKey(context.Background(), "valid-key", server.URL)
+	assert.Nil(t, err)
+	assert.Equal(t, APIKeyWrongEndpoint, result.Status)
+}
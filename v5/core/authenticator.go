@@ -15,9 +15,18 @@ package core
 // limitations under the License.
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// DefaultBackgroundRefreshTimeout is the maximum time allowed for a refresh of an access token
+// that is started in the background (when the cached token's refresh time is reached), unless
+// the authenticator's BackgroundRefreshTimeout field is set.
+const DefaultBackgroundRefreshTimeout = time.Minute
+
 // Authenticator describes the set of methods implemented by each authenticator.
 type Authenticator interface {
 	AuthenticationType() string
@@ -25,6 +34,49 @@ type Authenticator interface {
 	Validate() error
 }
 
+// TokenPrewarmer is implemented by authenticators that cache an access token
+// obtained from a token server. It can be used to make sure that the cached token
+// will remain valid for the duration of a burst of work, so that the token
+// doesn't need to be refreshed in the middle of the burst.
+type TokenPrewarmer interface {
+	// EnsureFreshToken makes sure that the cached access token remains valid for
+	// at least "minTTL", fetching a new access token if necessary.
+	EnsureFreshToken(ctx context.Context, minTTL time.Duration) error
+}
+
+// TokenInvalidator is implemented by authenticators that cache an access token.
+// It can be used to force a new access token to be fetched (e.g. after the policies
+// associated with the token's identity were changed, or the token was revoked).
+type TokenInvalidator interface {
+	// InvalidateToken discards the cached access token (if any), so that a new
+	// access token is fetched the next time that the authenticator is used.
+	InvalidateToken()
+}
+
+// TokenRefreshObserver is implemented by authenticators that cache an access token.
+// It can be used to be notified each time that the authenticator obtains a new access
+// token (e.g. to log the refresh, to emit metrics, or to propagate the token to a sidecar).
+type TokenRefreshObserver interface {
+	// OnTokenRefresh registers a function that is invoked with the outcome of each attempt
+	// to obtain a new access token, whether synchronously or in the background.
+	OnTokenRefresh(handler func(TokenInfo))
+}
+
+// TokenInfo describes the outcome of an attempt by an authenticator to obtain a new access token.
+type TokenInfo struct {
+	// The authenticator's type (e.g. "IAM").
+	AuthType string
+
+	// The new access token, and the times at which it expires and will be refreshed,
+	// if the attempt succeeded.
+	AccessToken string
+	Expiration  time.Time
+	RefreshTime time.Time
+
+	// The error that caused the attempt to fail, if it failed.
+	Err error
+}
+
 // AuthenticationError describes the error returned when authentication fails
 type AuthenticationError struct {
 	Response *DetailedResponse
@@ -35,9 +87,289 @@ func (e *AuthenticationError) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the underlying error that caused the authentication failure.
+func (e *AuthenticationError) Unwrap() error {
+	return e.Err
+}
+
 func NewAuthenticationError(response *DetailedResponse, err error) *AuthenticationError {
 	return &AuthenticationError{
 		Response: response,
 		Err:      err,
 	}
 }
+
+// ensureFreshToken makes sure that the access token cached by an authenticator remains
+// valid for at least "minTTL".
+// "remainingTTL" returns the remaining lifetime of the cached token (false if there is
+// no cached token), "requests" coalesces the authenticator's concurrent token requests
+// and "requestToken" fetches a new token and stores it in the cache.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned
+// and the token request continues in the background.
+func ensureFreshToken(ctx context.Context, minTTL time.Duration, remainingTTL func() (time.Duration, bool),
+	requests *tokenRequestGroup, requestToken func(context.Context) error) error {
+	isFresh := func() bool {
+		ttl, ok := remainingTTL()
+		return ok && ttl > 0 && ttl >= minTTL
+	}
+
+	if isFresh() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	refresh := func(ctx context.Context) error {
+		// Another goroutine might have refreshed the token in the meantime.
+		if isFresh() {
+			return nil
+		}
+		return requestToken(ctx)
+	}
+	shared, err := requests.do(ctx, refresh)
+
+	// A token request started by another goroutine might not satisfy the requested minimum lifetime.
+	if err == nil && shared && !isFresh() {
+		_, err = requests.do(ctx, refresh)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Make sure the new token satisfies the requested minimum lifetime.
+	if !isFresh() {
+		ttl, _ := remainingTTL()
+		return fmt.Errorf(ERRORMSG_TOKEN_TTL_TOO_SHORT, ttl, minTTL)
+	}
+	return nil
+}
+
+// synchronizedTokenRequest fetches a new access token unless "isValid" reports that the cached
+// token is valid (e.g. because another goroutine fetched a new token in the meantime).
+// "requests" coalesces the authenticator's concurrent token requests, so that at most one is in
+// flight, and "requestToken" fetches a new token and stores it in the cache. If "ctx" is done before
+// the new token is obtained, then ctx.Err() is returned (and the token request is abandoned if no
+// other goroutine is waiting for it).
+func synchronizedTokenRequest(ctx context.Context, requests *tokenRequestGroup, isValid func() bool,
+	requestToken func(context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := requests.do(ctx, func(ctx context.Context) error {
+		if isValid() {
+			return nil
+		}
+		return requestToken(ctx)
+	})
+	return err
+}
+
+// tokenRequestGroup coalesces the concurrent requests for a new access token made by an authenticator's
+// goroutines (e.g. when many goroutines find that the cached token has expired at the same time),
+// so that at most one token request is in flight, and its outcome is shared by all of them.
+type tokenRequestGroup struct {
+	flight *tokenRequestFlight
+
+	// The context from which the context of each token request is derived (created when first
+	// needed), which is canceled when the group is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+}
+
+// tokenRequestFlight is a token request that is in flight.
+type tokenRequestFlight struct {
+	// Closed when the request completes, after "err" is set to its outcome.
+	done chan struct{}
+	err  error
+
+	// The number of goroutines waiting for the request, and the function that abandons it.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do invokes "requestToken" in a new goroutine to obtain a new access token, unless a token request
+// is already in flight, and waits for the outcome of the request. "shared" is true if the request
+// was started by another goroutine. If "ctx" is done first, then ctx.Err() is returned; once each
+// of the goroutines waiting for the request has stopped waiting, the request is abandoned (i.e. the
+// context passed to "requestToken" is canceled).
+func (group *tokenRequestGroup) do(ctx context.Context, requestToken func(context.Context) error) (shared bool, err error) {
+	group.mutex.Lock()
+	groupCtx := group.contextLocked()
+	if groupCtx.Err() != nil {
+		group.mutex.Unlock()
+		return false, fmt.Errorf(ERRORMSG_AUTHENTICATOR_CLOSED)
+	}
+	flight := group.flight
+	shared = flight != nil
+	if !shared {
+		requestCtx, cancel := context.WithCancel(groupCtx)
+		flight = &tokenRequestFlight{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		group.flight = flight
+
+		go func() {
+			flightErr := requestToken(requestCtx)
+
+			group.mutex.Lock()
+			if group.flight == flight {
+				group.flight = nil
+			}
+			group.mutex.Unlock()
+
+			flight.err = flightErr
+			cancel()
+			close(flight.done)
+		}()
+	}
+	flight.waiters++
+	group.mutex.Unlock()
+
+	select {
+	case <-flight.done:
+		return shared, flight.err
+	case <-ctx.Done():
+		group.mutex.Lock()
+		defer group.mutex.Unlock()
+
+		flight.waiters--
+		if flight.waiters == 0 {
+			// Nobody is waiting for the request, so abandon it (and let the next caller start another).
+			flight.cancel()
+			if group.flight == flight {
+				group.flight = nil
+			}
+		}
+		return shared, ctx.Err()
+	}
+}
+
+// refreshInBackground obtains a new access token (unless a token request is already in flight) for an
+// authenticator whose cached token has reached its refresh time, but can still be used in the meantime.
+// The request is abandoned after "timeout" (or DefaultBackgroundRefreshTimeout, if "timeout" is 0),
+// or when the group is closed.
+func (group *tokenRequestGroup) refreshInBackground(authType string, timeout time.Duration,
+	requestToken func(context.Context) error) {
+	if timeout <= 0 {
+		timeout = DefaultBackgroundRefreshTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if _, err := group.do(ctx, requestToken); err != nil {
+		GetLogger().Debug("Unable to refresh the %s access token in the background: %s", authType, err.Error())
+	}
+}
+
+// close cancels the token request in flight (if any), and causes subsequent token requests to fail.
+func (group *tokenRequestGroup) close() {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	group.contextLocked()
+	group.cancel()
+}
+
+// context returns a context that is canceled when the group is closed.
+func (group *tokenRequestGroup) context() context.Context {
+	group.mutex.Lock()
+	defer group.mutex.Unlock()
+
+	return group.contextLocked()
+}
+
+// contextLocked returns the group's context (creating it if necessary) while "group.mutex" is locked.
+func (group *tokenRequestGroup) contextLocked() context.Context {
+	if group.ctx == nil {
+		group.ctx, group.cancel = context.WithCancel(context.Background())
+	}
+	return group.ctx
+}
+
+// remainingTokenTTL returns the remaining lifetime of a token with the specified
+// expiration time (in seconds since the epoch).
+func remainingTokenTTL(expiration int64) time.Duration {
+	return time.Duration(expiration-GetCurrentTime()) * time.Second
+}
+
+// tokenRefreshHandlers holds the functions registered via an authenticator's OnTokenRefresh() method,
+// and the recorder (if any) set via its SetTokenMetricsRecorder() method.
+type tokenRefreshHandlers struct {
+	handlers []func(TokenInfo)
+	recorder TokenMetricsRecorder
+	mutex    sync.Mutex
+}
+
+// add registers "handler" (if not nil).
+func (handlers *tokenRefreshHandlers) add(handler func(TokenInfo)) {
+	if handler == nil {
+		return
+	}
+
+	handlers.mutex.Lock()
+	defer handlers.mutex.Unlock()
+
+	handlers.handlers = append(handlers.handlers, handler)
+}
+
+// setRecorder sets the recorder of the authenticator's token metrics.
+func (handlers *tokenRefreshHandlers) setRecorder(recorder TokenMetricsRecorder) {
+	handlers.mutex.Lock()
+	defer handlers.mutex.Unlock()
+
+	handlers.recorder = recorder
+}
+
+// getRecorder returns the recorder of the authenticator's token metrics, or nil.
+func (handlers *tokenRefreshHandlers) getRecorder() TokenMetricsRecorder {
+	handlers.mutex.Lock()
+	defer handlers.mutex.Unlock()
+
+	return handlers.recorder
+}
+
+// notify records the attempt described by "info", which took "duration", and invokes each
+// registered function with "info".
+func (handlers *tokenRefreshHandlers) notify(info TokenInfo, duration time.Duration) {
+	handlers.mutex.Lock()
+	registered := handlers.handlers
+	recorder := handlers.recorder
+	handlers.mutex.Unlock()
+
+	if recorder != nil {
+		callSafely(PanicSourceTokenMetricsRecorder, func() {
+			recorder.RecordTokenRefresh(info.AuthType, duration, info.Err)
+		})
+	}
+	for _, handler := range registered {
+		callSafely(PanicSourceTokenRefreshHandler, func() { handler(info) })
+	}
+}
+
+// recordCacheHit records that the cached access token was used to authenticate a request.
+func (handlers *tokenRefreshHandlers) recordCacheHit(authType string) {
+	if recorder := handlers.getRecorder(); recorder != nil {
+		callSafely(PanicSourceTokenMetricsRecorder, func() {
+			recorder.RecordTokenCacheHit(authType)
+		})
+	}
+}
+
+// newTokenInfo returns the TokenInfo describing the outcome of an attempt to obtain an access token:
+// the token with the specified expiration and refresh times (in seconds since the epoch) if "err" is nil.
+func newTokenInfo(authType string, accessToken string, expiration int64, refreshTime int64, err error) TokenInfo {
+	if err != nil {
+		return TokenInfo{AuthType: authType, Err: err}
+	}
+	return TokenInfo{
+		AuthType:    authType,
+		AccessToken: accessToken,
+		Expiration:  time.Unix(expiration, 0),
+		RefreshTime: time.Unix(refreshTime, 0),
+	}
+}
@@ -52,14 +52,20 @@ func GetAuthenticatorFromEnvironment(credentialKey string) (authenticator Authen
 		authenticator, err = newBearerTokenAuthenticatorFromMap(properties)
 	} else if strings.EqualFold(authType, AUTHTYPE_IAM) {
 		authenticator, err = newIamAuthenticatorFromMap(properties)
+	} else if strings.EqualFold(authType, AUTHTYPE_IAM_ASSUME) {
+		authenticator, err = newIamAssumeAuthenticatorFromMap(properties)
 	} else if strings.EqualFold(authType, AUTHTYPE_CONTAINER) {
 		authenticator, err = newContainerAuthenticatorFromMap(properties)
+	} else if strings.EqualFold(authType, AUTHTYPE_IAM_MTLS) {
+		authenticator, err = newIamMtlsAuthenticatorFromMap(properties)
 	} else if strings.EqualFold(authType, AUTHTYPE_VPC) {
 		authenticator, err = newVpcInstanceAuthenticatorFromMap(properties)
 	} else if strings.EqualFold(authType, AUTHTYPE_CP4D) {
 		authenticator, err = newCloudPakForDataAuthenticatorFromMap(properties)
+	} else if strings.EqualFold(authType, AUTHTYPE_APIKEY_HEADER) {
+		authenticator, err = newAPIKeyHeaderAuthenticatorFromMap(properties)
 	} else if strings.EqualFold(authType, AUTHTYPE_NOAUTH) {
-		authenticator, err = NewNoAuthAuthenticator()
+		authenticator, err = newNoAuthAuthenticatorFromMap(properties)
 	} else {
 		err = fmt.Errorf(ERRORMSG_AUTHTYPE_UNKNOWN, authType)
 	}
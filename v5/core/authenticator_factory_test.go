@@ -122,6 +122,31 @@ func TestGetAuthenticatorFromEnvironment1(t *testing.T) {
 	assert.Equal(t, "secret1", iamAuth.ClientSecret)
 	assert.Equal(t, "https://iam.refresh-token.com", iamAuth.URL)
 
+	// APIKeyHeader Authenticator using a query parameter.
+	authenticator, err = GetAuthenticatorFromEnvironment("service10")
+	assert.Nil(t, err)
+	assert.NotNil(t, authenticator)
+	assert.Equal(t, AUTHTYPE_APIKEY_HEADER, authenticator.AuthenticationType())
+	apikeyAuth, ok := authenticator.(*APIKeyHeaderAuthenticator)
+	assert.True(t, ok)
+	assert.NotNil(t, apikeyAuth)
+	assert.Equal(t, "my-subscription-key", apikeyAuth.ApiKey)
+	assert.Equal(t, "subscription-key", apikeyAuth.KeyName)
+	assert.Equal(t, APIKeyLocationQuery, apikeyAuth.Location)
+
+	// IAM mTLS Authenticator using a client certificate.
+	authenticator, err = GetAuthenticatorFromEnvironment("service11")
+	assert.Nil(t, err)
+	assert.NotNil(t, authenticator)
+	assert.Equal(t, AUTHTYPE_IAM_MTLS, authenticator.AuthenticationType())
+	mtlsAuth, ok := authenticator.(*IamMtlsAuthenticator)
+	assert.True(t, ok)
+	assert.NotNil(t, mtlsAuth)
+	assert.Equal(t, "/etc/certs/client.crt", mtlsAuth.CertFile)
+	assert.Equal(t, "/etc/certs/client.key", mtlsAuth.KeyFile)
+	assert.Equal(t, "https://mtls.iam.example.com", mtlsAuth.URL)
+	assert.Equal(t, "client-1", mtlsAuth.ClientID)
+
 	os.Unsetenv("IBM_CREDENTIALS_FILE")
 }
 
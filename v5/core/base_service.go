@@ -18,17 +18,15 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
@@ -36,8 +34,10 @@ import (
 )
 
 const (
-	headerNameUserAgent = "User-Agent"
-	sdkName             = "ibm-go-sdk-core"
+	headerNameUserAgent     = "User-Agent"
+	headerNameAuthorization = "Authorization"
+	headerNameHost          = "Host"
+	sdkName                 = "ibm-go-sdk-core"
 )
 
 // ServiceOptions is a struct of configuration values for a service.
@@ -63,6 +63,10 @@ type ServiceOptions struct {
 
 // BaseService implements the common functionality shared by generated services
 // to manage requests and responses, authenticate outbound requests, etc.
+//
+// The setter methods (SetServiceURL, SetDefaultHeaders, SetHTTPClient, etc.) may be
+// called concurrently with in-flight requests. The exported fields should not be
+// modified directly once the service instance is in use.
 type BaseService struct {
 
 	// Configuration values for a service.
@@ -78,6 +82,92 @@ type BaseService struct {
 	// outbound request. If this value is not set, then a default value will be
 	// used for the header.
 	UserAgent string
+
+	// The transforms applied to each operation response before its body is processed.
+	responseTransforms []ResponseTransform
+
+	// The function invoked when a response contains deprecation-related headers.
+	deprecationHandler DeprecationHandler
+
+	// The recorder used to record the service's traffic into a HAR archive.
+	harRecorder *HARRecorder
+
+	// The hosts to which requests may be sent via a per-request service URL override.
+	allowedHosts []string
+
+	// The routing of requests between the service URL and a canary endpoint.
+	canaryRouting *CanaryRouting
+
+	// The validator applied to operation responses, and the way in which violations are surfaced.
+	responseValidator      ResponseValidator
+	responseValidationMode ResponseValidationMode
+
+	// The API versions supported by the SDK, the pinned version (if any), and the version
+	// negotiated with the service at "negotiatedAPIVersionURL" (if any).
+	apiVersions             *APIVersions
+	pinnedAPIVersion        int
+	negotiatedAPIVersion    int
+	negotiatedAPIVersionURL string
+
+	// The feature flags sent with each request (never modified in place).
+	featureFlags FeatureFlags
+
+	// Tracks the session affinity token (if any) to be echoed with each request.
+	sessionAffinity *sessionAffinityTracker
+
+	// The Host header override (if any) applied to each request.
+	hostHeader string
+
+	// The name of the header (if any) in which the tenant associated with a request's context is sent.
+	tenantHeader string
+
+	// If true, only GET and HEAD requests are sent.
+	readOnly bool
+
+	// The operations that may not be invoked (never modified in place).
+	deniedOperations []operationPattern
+
+	// If true, a request rejected with a 401 response is re-sent with a new access token.
+	reauthenticate bool
+
+	// Tracks the service's retries against its retry budget (if any).
+	retryBudget *retryBudgetTracker
+
+	// Tracks the stats of the endpoints to which requests are sent (shared with clones).
+	endpointStats *endpointStatsTracker
+
+	// Grants the in-flight request slots to the tenants, if limited (shared with clones).
+	tenantConcurrency *tenantScheduler
+
+	// Delivers the service's warnings to the warning handler and subscribers (shared with clones).
+	warnings *warningNotifier
+
+	// The function invoked with the attestation of each operation response.
+	responseAttestor ResponseAttestor
+
+	// The limits enforced before a JSON response body is unmarshalled (never modified in place).
+	jsonLimits *JSONLimits
+
+	// The timeout hints registered for the service's operations (never modified in place).
+	operationTimeouts []operationTimeout
+
+	// The function invoked with the lifecycle events of each request.
+	requestEventHandler RequestEventHandler
+
+	// The names registered for the service's operations (never modified in place).
+	operationNames []operationName
+
+	// The profile of the service's http client, if selected with SetHTTPClientProfile().
+	httpClientProfile HTTPClientProfile
+
+	// The size of the buffer used to copy a response body to a writer (0 for the default).
+	downloadBufferSize int
+
+	// Mutex used to synchronize access to the service's configuration.
+	mutex sync.RWMutex
+
+	// Mutex used to ensure that the API version is negotiated only once at a time.
+	apiVersionMutex sync.Mutex
 }
 
 // NewBaseService constructs a new instance of BaseService. Validation on input
@@ -99,11 +189,16 @@ func NewBaseService(options *ServiceOptions) (*BaseService, error) {
 		Options: options,
 
 		Client: DefaultHTTPClient(),
+
+		warnings:      &warningNotifier{},
+		endpointStats: newEndpointStatsTracker(),
 	}
 
 	// Set a default value for the User-Agent http header.
 	service.SetUserAgent(service.buildUserAgent())
 
+	service.checkIamEndpoint()
+
 	return &service, nil
 }
 
@@ -114,15 +209,56 @@ func (service *BaseService) Clone() *BaseService {
 		return nil
 	}
 
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
 	// First, copy the service options struct.
 	serviceOptions := *service.Options
 
 	// Next, make a copy the service struct, then use the copy of the service options.
 	// Note, we'll re-use the "Client" instance from the original BaseService instance.
-	clone := *service
-	clone.Options = &serviceOptions
+	clone := &BaseService{
+		Options:        &serviceOptions,
+		DefaultHeaders: service.DefaultHeaders.Clone(),
+		Client:         service.Client,
+		UserAgent:      service.UserAgent,
+
+		responseTransforms: append([]ResponseTransform(nil), service.responseTransforms...),
+		deprecationHandler: service.deprecationHandler,
+		harRecorder:        service.harRecorder,
+		allowedHosts:       service.allowedHosts,
+		canaryRouting:      service.canaryRouting,
+
+		responseValidator:      service.responseValidator,
+		responseValidationMode: service.responseValidationMode,
+
+		apiVersions:             service.apiVersions,
+		pinnedAPIVersion:        service.pinnedAPIVersion,
+		negotiatedAPIVersion:    service.negotiatedAPIVersion,
+		negotiatedAPIVersionURL: service.negotiatedAPIVersionURL,
+
+		featureFlags:     service.featureFlags,
+		sessionAffinity:  service.sessionAffinity.clone(),
+		tenantHeader:     service.tenantHeader,
+		hostHeader:       service.hostHeader,
+		readOnly:         service.readOnly,
+		deniedOperations: service.deniedOperations,
+		reauthenticate:   service.reauthenticate,
+		retryBudget:      service.retryBudget.clone(),
+		warnings:         service.warnings,
+		endpointStats:    service.endpointStats,
+		responseAttestor: service.responseAttestor,
+		jsonLimits:       service.jsonLimits,
+
+		operationTimeouts:   service.operationTimeouts,
+		requestEventHandler: service.requestEventHandler,
+		operationNames:      service.operationNames,
+		httpClientProfile:   service.httpClientProfile,
+		downloadBufferSize:  service.downloadBufferSize,
+		tenantConcurrency:   service.tenantConcurrency,
+	}
 
-	return &clone
+	return clone
 }
 
 // ConfigureService updates the service with external configuration values.
@@ -145,6 +281,17 @@ func (service *BaseService) ConfigureService(serviceName string) error {
 			}
 		}
 
+		// HTTP_CLIENT_PROFILE (applied first, since it replaces the service's client)
+		if clientProfile, ok := serviceProps[PROPNAME_SVC_HTTP_CLIENT_PROFILE]; ok && clientProfile != "" {
+			profile, err := parseHTTPClientProfile(clientProfile)
+			if err != nil {
+				return fmt.Errorf(ERRORMSG_PROP_INVALID, PROPNAME_SVC_HTTP_CLIENT_PROFILE)
+			}
+			if err = service.SetHTTPClientProfile(profile); err != nil {
+				return err
+			}
+		}
+
 		// DISABLE_SSL
 		if disableSSL, ok := serviceProps[PROPNAME_SVC_DISABLE_SSL]; ok && disableSSL != "" {
 			// Convert the config string to bool.
@@ -196,6 +343,37 @@ func (service *BaseService) ConfigureService(serviceName string) error {
 				service.EnableRetries(maxRetries, retryInterval)
 			}
 		}
+
+		// API_VERSION
+		if apiVersion, ok := serviceProps[PROPNAME_SVC_API_VERSION]; ok && apiVersion != "" {
+			version, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(apiVersion), "v"))
+			if err != nil || version <= 0 {
+				return fmt.Errorf(ERRORMSG_PROP_INVALID, PROPNAME_SVC_API_VERSION)
+			}
+			service.PinAPIVersion(version)
+		}
+
+		// READ_ONLY
+		if readOnly, ok := serviceProps[PROPNAME_SVC_READ_ONLY]; ok && readOnly != "" {
+			boolValue, err := strconv.ParseBool(readOnly)
+			if err != nil {
+				return fmt.Errorf(ERRORMSG_PROP_INVALID, PROPNAME_SVC_READ_ONLY)
+			}
+			service.SetReadOnly(boolValue)
+		}
+
+		// DENIED_OPERATIONS
+		if deniedOperations, ok := serviceProps[PROPNAME_SVC_DENIED_OPERATIONS]; ok && deniedOperations != "" {
+			var operations []string
+			for _, operation := range strings.Split(deniedOperations, ",") {
+				if operation = strings.TrimSpace(operation); operation != "" {
+					operations = append(operations, operation)
+				}
+			}
+			if err := service.SetDeniedOperations(operations...); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -213,35 +391,147 @@ func (service *BaseService) SetServiceURL(url string) error {
 		return fmt.Errorf(ERRORMSG_PROP_INVALID, "URL")
 	}
 
+	service.mutex.Lock()
 	service.Options.URL = url
+	service.mutex.Unlock()
+
+	service.checkIamEndpoint()
 	return nil
 }
 
 // GetServiceURL returns the service URL.
 func (service *BaseService) GetServiceURL() string {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
 	return service.Options.URL
 }
 
 // SetDefaultHeaders sets HTTP headers to be sent in every request.
+// A copy of "headers" is retained by the service, so the caller is free
+// to modify or re-use "headers" after this method returns.
 func (service *BaseService) SetDefaultHeaders(headers http.Header) {
-	service.DefaultHeaders = headers
+	headersCopy := headers.Clone()
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.DefaultHeaders = headersCopy
+}
+
+// GetDefaultHeaders returns a copy of the HTTP headers to be sent in every request.
+func (service *BaseService) GetDefaultHeaders() http.Header {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.DefaultHeaders.Clone()
 }
 
 // SetHTTPClient updates the client handling the requests.
 func (service *BaseService) SetHTTPClient(client *http.Client) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
 	service.Client = client
 }
 
+// GetHTTPClient returns the client handling the requests.
+func (service *BaseService) GetHTTPClient() *http.Client {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.Client
+}
+
+// AddResponseTransform adds "transform" to the end of the list of transforms
+// that are applied to each operation response before its body is processed.
+// Transforms are applied to both successful and unsuccessful responses, in
+// the order in which they were added.
+func (service *BaseService) AddResponseTransform(transform ResponseTransform) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	transforms := make([]ResponseTransform, 0, len(service.responseTransforms)+1)
+	transforms = append(transforms, service.responseTransforms...)
+	service.responseTransforms = append(transforms, transform)
+}
+
+// SetResponseTransforms replaces the list of transforms that are applied
+// to each operation response before its body is processed.
+// Specify no transforms to clear the list.
+func (service *BaseService) SetResponseTransforms(transforms ...ResponseTransform) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.responseTransforms = append([]ResponseTransform(nil), transforms...)
+}
+
+// SetDeprecationHandler sets the function that is invoked when an operation response
+// contains "Deprecation", "Sunset" or "Warning" headers.
+// By default (or if "handler" is nil), a warning message is logged the first time
+// that such headers are received for a particular operation.
+func (service *BaseService) SetDeprecationHandler(handler DeprecationHandler) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.deprecationHandler = handler
+}
+
+// SetHARRecorder sets the recorder used to record the service's traffic
+// (including each retry attempt) into a HAR archive while a recording is in progress.
+// The recording is started and stopped at runtime via the recorder's Start and Stop methods.
+// A nil value removes any previously-set recorder.
+func (service *BaseService) SetHARRecorder(recorder *HARRecorder) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.harRecorder = recorder
+}
+
+// GetHARRecorder returns the recorder set by SetHARRecorder, or nil if none was set.
+func (service *BaseService) GetHARRecorder() *HARRecorder {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.harRecorder
+}
+
+// SetAllowedHosts sets the hosts to which a request may be sent when its service URL
+// is overridden via RequestBuilder.WithServiceURL(). Each entry is either a hostname
+// (e.g. "node-1.example.com") or a wildcard that matches any subdomain (e.g. "*.example.com").
+// By default, no hosts are allowed, so requests with a service URL override are rejected.
+func (service *BaseService) SetAllowedHosts(hosts ...string) {
+	allowedHosts := append([]string(nil), hosts...)
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.allowedHosts = allowedHosts
+}
+
+// GetAllowedHosts returns the hosts to which a request may be sent
+// when its service URL is overridden.
+func (service *BaseService) GetAllowedHosts() []string {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return append([]string(nil), service.allowedHosts...)
+}
+
 // DisableSSLVerification skips SSL verification.
 // This function sets a new http.Client instance on the service
 // and configures it to bypass verification of server certificates
 // and host names, making the client susceptible to "man-in-the-middle"
 // attacks.  This should be used only for testing.
 func (service *BaseService) DisableSSLVerification() {
-	client := DefaultHTTPClient()
+	// Use a client with the service's profile (which is known to be valid).
+	client, _ := NewHTTPClient(service.GetHTTPClientProfile())
 	tr, ok := client.Transport.(*http.Transport)
 	if tr != nil && ok {
-		tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{} // #nosec G402
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = true // #nosec G402
 	}
 
 	service.SetHTTPClient(client)
@@ -250,8 +540,19 @@ func (service *BaseService) DisableSSLVerification() {
 // IsSSLDisabled returns true if and only if the service's http.Client instance
 // is configured to skip verification of server SSL certificates.
 func (service *BaseService) IsSSLDisabled() bool {
-	if service.Client != nil {
-		if tr, ok := service.Client.Transport.(*http.Transport); tr != nil && ok {
+	return isSSLDisabled(service.GetHTTPClient())
+}
+
+// isSSLDisabled returns true if and only if "client" is configured to skip
+// verification of server SSL certificates.
+func isSSLDisabled(client *http.Client) bool {
+	// If retries are enabled, then check the client used for each attempt.
+	if retryableClient := getRetryableHTTPClient(client); retryableClient != nil {
+		client = retryableClient.HTTPClient
+	}
+
+	if client != nil {
+		if tr, ok := client.Transport.(*http.Transport); tr != nil && ok {
 			if tr.TLSClientConfig != nil {
 				return tr.TLSClientConfig.InsecureSkipVerify
 			}
@@ -262,11 +563,17 @@ func (service *BaseService) IsSSLDisabled() bool {
 
 // SetEnableGzipCompression sets the service's EnableGzipCompression field
 func (service *BaseService) SetEnableGzipCompression(enableGzip bool) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
 	service.Options.EnableGzipCompression = enableGzip
 }
 
 // GetEnableGzipCompression returns the service's EnableGzipCompression field
 func (service *BaseService) GetEnableGzipCompression() bool {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
 	return service.Options.EnableGzipCompression
 }
 
@@ -277,13 +584,15 @@ func (service *BaseService) buildUserAgent() string {
 
 // SetUserAgent sets the user agent value.
 func (service *BaseService) SetUserAgent(userAgentString string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
 	if userAgentString == "" {
 		service.UserAgent = service.buildUserAgent()
 	}
 	service.UserAgent = userAgentString
 }
 
-//
 // Request invokes the specified HTTP request and returns the response.
 //
 // Parameters:
@@ -291,6 +600,7 @@ func (service *BaseService) SetUserAgent(userAgentString string) {
 //
 // result: a pointer to the operation result.  This should be one of:
 //   - *io.ReadCloser (for a byte-stream type response)
+//   - *ResponseBodyWriter (to copy the response body to an io.Writer)
 //   - *<primitive>, *[]<primitive>, *map[string]<primitive>
 //   - *map[string]json.RawMessage, *[]json.RawMessage
 //
@@ -298,39 +608,170 @@ func (service *BaseService) SetUserAgent(userAgentString string) {
 // detailedResponse: a DetailedResponse instance containing the status code, headers, etc.
 //
 // err: a non-nil error object if an error occurred
-//
 func (service *BaseService) Request(req *http.Request, result interface{}) (detailedResponse *DetailedResponse, err error) {
-	// Add default headers.
-	if service.DefaultHeaders != nil {
-		for k, v := range service.DefaultHeaders {
-			req.Header.Add(k, strings.Join(v, ""))
+	// Obtain a consistent view of the service's configuration for use with this request.
+	// The default headers map is never modified in place, so it's safe to use it
+	// after releasing the lock.
+	service.mutex.RLock()
+	defaultHeaders := service.DefaultHeaders
+	userAgent := service.UserAgent
+	authenticator := service.Options.Authenticator
+	client := service.Client
+	responseTransforms := service.responseTransforms
+	deprecationHandler := service.deprecationHandler
+	harRecorder := service.harRecorder
+	allowedHosts := service.allowedHosts
+	serviceURL := service.Options.URL
+	canaryRouting := service.canaryRouting
+	responseValidator := service.responseValidator
+	responseValidationMode := service.responseValidationMode
+	featureFlags := service.featureFlags
+	sessionAffinity := service.sessionAffinity
+	tenantHeader := service.tenantHeader
+	hostHeader := service.hostHeader
+	readOnly := service.readOnly
+	deniedOperations := service.deniedOperations
+	reauthenticate := service.reauthenticate
+	retryBudget := service.retryBudget
+	warnings := service.warnings
+	endpointStats := service.endpointStats
+	tenantConcurrency := service.tenantConcurrency
+	responseAttestor := service.responseAttestor
+	jsonLimits := service.jsonLimits
+	operationTimeouts := service.operationTimeouts
+	requestEventHandler := service.requestEventHandler
+	operationNames := service.operationNames
+	downloadBufferSize := service.downloadBufferSize
+	service.mutex.RUnlock()
+
+	// Store the response in the location specified via WithResponseInto() (if any).
+	responseIntoCtx := req.Context()
+	defer func() {
+		storeResponseInto(responseIntoCtx, detailedResponse)
+	}()
+
+	// Report the request's lifecycle events to the handlers (if any), starting with its submission.
+	events := newRequestEvents(req, requestEventHandler, operationNames)
+	events.emit(req, RequestPhaseQueued, 0, nil)
+	defer func() {
+		statusCode := 0
+		if detailedResponse != nil {
+			statusCode = detailedResponse.StatusCode
 		}
+		events.emit(req, RequestPhaseDone, statusCode, err)
+	}()
 
-		// After adding the default headers, make one final check to see if the user
-		// specified the "Host" header within the default headers.
-		// This needs to be handled separately because it will be ignored by
-		// the Request.Write() method.
-		host := service.DefaultHeaders.Get("Host")
-		if host != "" {
-			req.Host = host
+	// Reject the request if the service is in read-only mode, or the operation is denied.
+	if err = checkOperationAllowed(req, readOnly, deniedOperations); err != nil {
+		return
+	}
+
+	// Warn (once per client) if the client doesn't verify server certificates.
+	warnings.checkClient(req, client)
+
+	// If the request's context specifies a timeout, then apply it to the request (including any retries).
+	// Otherwise, unless the context has a deadline, apply the operation's timeout hint (if any).
+	// The timeout's context is cancelled when the request completes or, for a streamed response,
+	// when the response body is closed.
+	timeout := getRequestTimeout(req.Context())
+	if _, hasDeadline := req.Context().Deadline(); timeout == 0 && !hasDeadline {
+		timeout = findOperationTimeout(operationTimeouts, req)
+	}
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		req = req.WithContext(ctx)
+		defer func() {
+			cancelWithResult(result, detailedResponse, err, cancel)
+		}()
+	}
+
+	// If the request has a CreateOnly() or UpdateOnly() precondition, then return a
+	// PreconditionError if it isn't met.
+	if _, ok := req.Context().Value(preconditionKey{}).(string); ok {
+		defer func() {
+			err = newPreconditionError(req, err)
+		}()
+	}
+
+	// If the request's service URL was overridden, then send it to the specified host
+	// (after verifying that the host is allowed).
+	if err = applyServiceURLOverride(req, allowedHosts); err != nil {
+		return
+	}
+
+	// If canary routing is configured, then route the request to the primary or canary endpoint,
+	// and report the outcome of the request to the routing handler (if any).
+	endpoint, routeErr := routeCanaryRequest(req, serviceURL, canaryRouting, endpointStats)
+	if routeErr != nil {
+		err = routeErr
+		return
+	}
+	if endpoint != "" && canaryRouting.Handler != nil {
+		defer func() {
+			callSafely(PanicSourceCanaryRouteHandler, func() {
+				canaryRouting.Handler(req, endpoint, detailedResponse, err)
+			})
+		}()
+	}
+
+	// Add default headers in a single pass, writing directly to the header map.
+	// If the user specified the "Host" header within the default headers, it needs to be
+	// copied to the request's Host field because it will be ignored by the Request.Write() method.
+	if req.Header == nil {
+		req.Header = make(http.Header, len(defaultHeaders)+2)
+	}
+	for k, v := range defaultHeaders {
+		value := ""
+		if len(v) == 1 {
+			value = v[0]
+		} else {
+			value = strings.Join(v, "")
+		}
+		key := http.CanonicalHeaderKey(k)
+		req.Header[key] = append(req.Header[key], value)
+		if key == headerNameHost && value != "" {
+			req.Host = value
 		}
 	}
 
+	// Apply the request's Host header override or, if none, the service's (if any).
+	if override := getHostHeader(req.Context()); override != "" {
+		hostHeader = override
+	}
+	if hostHeader != "" {
+		req.Host = hostHeader
+	}
+
+	// Add the service's feature flags, as modified by any flags specified for the request.
+	applyFeatureFlags(req, featureFlags)
+
+	// Echo the session affinity token (if any) so that the request reaches the same backend.
+	sessionAffinity.apply(req)
+
+	// Add the correlation id and tenant (if any) associated with the request's context.
+	applyContextHeaders(req, tenantHeader)
+
 	// Add the default User-Agent header if not already present.
-	userAgent := req.Header.Get(headerNameUserAgent)
-	if userAgent == "" {
-		req.Header.Add(headerNameUserAgent, service.UserAgent)
+	if getHeaderValue(req.Header, headerNameUserAgent) == "" {
+		req.Header[headerNameUserAgent] = append(req.Header[headerNameUserAgent], userAgent)
 	}
 
 	// Add authentication to the outbound request.
-	if IsNil(service.Options.Authenticator) {
+	if IsNil(authenticator) {
 		err = fmt.Errorf(ERRORMSG_NO_AUTHENTICATOR)
 		return
 	}
 
-	authError := service.Options.Authenticator.Authenticate(req)
+	var unauthenticatedHeader http.Header
+	if req.Method == http.MethodGet {
+		unauthenticatedHeader = req.Header.Clone()
+	}
+	authError := authenticator.Authenticate(req)
 	if authError != nil {
-		err = fmt.Errorf(ERRORMSG_AUTHENTICATE_ERROR, authError.Error())
+		err = &wrappedError{
+			message: fmt.Sprintf(ERRORMSG_AUTHENTICATE_ERROR, authError.Error()),
+			cause:   authError,
+		}
 		castErr, ok := authError.(*AuthenticationError)
 		if ok {
 			detailedResponse = castErr.Response
@@ -338,9 +779,15 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 		return
 	}
 
+	// Record the headers added by the authenticator, so that a response cache (see
+	// NewResponseCacheTransport()) never shares responses between credentials.
+	if names := changedHeaders(unauthenticatedHeader, req.Header); len(names) > 0 {
+		req = req.WithContext(withCredentialHeaders(req.Context(), names))
+	}
+
 	// If debug is enabled, then dump the request.
 	if GetLogger().IsLogLevelEnabled(LevelDebug) {
-		buf, dumpErr := httputil.DumpRequestOut(req, req.Body != nil)
+		buf, dumpErr := httputil.DumpRequestOut(req, req.Body != nil && !isChunkedUpload(req))
 		if dumpErr == nil {
 			GetLogger().Debug("Request:\n%s\n", RedactSecrets(string(buf)))
 		} else {
@@ -351,19 +798,107 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 	var httpResponse *http.Response
 
 	// Try to get the retryable Client hidden inside service.Client
-	retryableClient := getRetryableHTTPClient(service.Client)
-	if retryableClient != nil {
-		retryableRequest, retryableErr := retryablehttp.FromRequest(req)
-		if retryableErr != nil {
-			err = fmt.Errorf(ERRORMSG_CREATE_RETRYABLE_REQ, retryableErr.Error())
-			return
+	retryableClient := getRetryableHTTPClient(client)
+
+	// A retry policy associated with the request (see WithRetryPolicy()) replaces the service's retry configuration.
+	retryableClient, client = applyRetryPolicy(getRetryPolicy(req.Context()), retryableClient, client)
+
+	// A chunked upload is streamed rather than buffered, so it can't be retried.
+	// Retries can also be disabled via the request's context.
+	if retryableClient != nil && (isChunkedUpload(req) || isRetryDisabled(req.Context())) {
+		client = retryableClient.HTTPClient
+		retryableClient = nil
+	}
+
+	// If an alternate transport was specified for this request, then use it in place
+	// of the transport configured on the service's client.
+	// If a Host header override applies, then wrap the transport to preserve it across retries and redirects.
+	// Wrap the transport to record the latency and outcome of each attempt in the endpoint's stats.
+	// If the service's traffic is being recorded, then wrap the transport with the recorder.
+	// If the request's lifecycle events are being reported, then wrap the transport to report each attempt.
+	transport := getRequestTransport(req)
+	recording := harRecorder != nil && harRecorder.IsRecording()
+	if endpointStats != nil || recording || events != nil || hostHeader != "" {
+		if transport == nil {
+			if retryableClient != nil {
+				transport = retryableClient.HTTPClient.Transport
+			} else if client != nil {
+				transport = client.Transport
+			}
+		}
+		if hostHeader != "" {
+			transport = newHostHeaderTransport(transport, hostHeader, req.URL.Host)
+		}
+		if endpointStats != nil {
+			transport = endpointStats.transport(transport)
+		}
+		if recording {
+			transport = harRecorder.Transport(transport)
+		}
+		if events != nil {
+			transport = events.transport(transport)
+		}
+	}
+	if transport != nil {
+		if retryableClient != nil {
+			retryableClient = retryableClientWithTransport(retryableClient, transport)
+		} else {
+			client = clientWithTransport(client, transport)
+		}
+	}
+
+	// send invokes "req" using the retryable client (if retries are enabled) or the normal client.
+	send := func(req *http.Request) (*http.Response, error) {
+		if retryableClient != nil {
+			retryableRequest, retryableErr := retryablehttp.FromRequest(req)
+			if retryableErr != nil {
+				return nil, fmt.Errorf(ERRORMSG_CREATE_RETRYABLE_REQ, retryableErr.Error())
+			}
+
+			// Invoke the retryable request, whose retries are subject to the retry budget (if any)
+			// and reported to the request's event handlers (if any).
+			return events.applyRetries(retryBudget.apply(retryableClient, req, warnings), req).Do(retryableRequest)
 		}
 
-		// Invoke the retryable request.
-		httpResponse, err = retryableClient.Do(retryableRequest)
-	} else {
 		// Invoke the normal (non-retryable) request.
-		httpResponse, err = service.Client.Do(req)
+		return client.Do(req)
+	}
+
+	// Wait for an in-flight request slot of the request's tenant (if limited). The slot is released
+	// when the request completes or, for a streamed response, when the response body is closed.
+	release, slotErr := tenantConcurrency.acquire(req.Context(), GetTenant(req.Context()))
+	if slotErr != nil {
+		err = slotErr
+		return
+	}
+	defer func() {
+		cancelWithResult(result, detailedResponse, err, release)
+	}()
+
+	// Count the request against the retry budget (if any), which limits its retries.
+	retryBudget.recordRequest()
+
+	httpResponse, err = send(req)
+
+	// If the request was rejected because its access token was revoked, then send it
+	// again (once) with a new access token.
+	if err == nil && reauthenticate {
+		retryReq, reauthErr := newReauthenticatedRequest(req, httpResponse, authenticator)
+		if reauthErr != nil {
+			httpResponse.Body.Close() // #nosec G104
+			err = &wrappedError{
+				message: fmt.Sprintf(ERRORMSG_AUTHENTICATE_ERROR, reauthErr.Error()),
+				cause:   reauthErr,
+			}
+			if castErr, ok := reauthErr.(*AuthenticationError); ok {
+				detailedResponse = castErr.Response
+			}
+			return
+		}
+		if retryReq != nil {
+			req = retryReq
+			httpResponse, err = send(req)
+		}
 	}
 
 	// Check for errors during the invocation.
@@ -374,6 +909,28 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 		return
 	}
 
+	// Record the session affinity token (if any) designated by the response.
+	sessionAffinity.record(httpResponse)
+
+	// Report any skew between the local clock and the server's clock.
+	warnings.checkClock(req, httpResponse)
+
+	// Compute the digest of the response body (as received) for the attestor, if any.
+	attestResponse(req, httpResponse, responseAttestor)
+
+	// Apply any response transforms (e.g. decompression, decryption) before
+	// we try to process the response body.
+	if transformErr := applyResponseTransforms(responseTransforms, httpResponse); transformErr != nil {
+		httpResponse.Body.Close() // #nosec G104
+		detailedResponse = &DetailedResponse{
+			StatusCode: httpResponse.StatusCode,
+			Headers:    httpResponse.Header,
+			redirects:  getRedirectChain(httpResponse),
+		}
+		err = fmt.Errorf(ERRORMSG_RESPONSE_TRANSFORM, transformErr.Error())
+		return
+	}
+
 	// If debug is enabled, then dump the response.
 	if GetLogger().IsLogLevelEnabled(LevelDebug) {
 		buf, dumpErr := httputil.DumpResponse(httpResponse, httpResponse.Body != nil)
@@ -388,6 +945,20 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 	detailedResponse = &DetailedResponse{
 		StatusCode: httpResponse.StatusCode,
 		Headers:    httpResponse.Header,
+		redirects:  getRedirectChain(httpResponse),
+		stale:      isStaleResponse(httpResponse.Header),
+	}
+
+	// Surface any deprecation-related headers.
+	if deprecationInfo := detailedResponse.GetDeprecationInfo(); deprecationInfo != nil {
+		if deprecationHandler == nil {
+			deprecationHandler = logDeprecation
+		}
+		callSafely(PanicSourceDeprecationHandler, func() { deprecationHandler(req, deprecationInfo) })
+		if deprecationInfo.Deprecated || deprecationInfo.Sunset != nil {
+			warnings.emit(WarningDeprecatedOperation, req, "Operation '%s %s': %s",
+				req.Method, req.URL.Path, deprecationInfo.String())
+		}
 	}
 
 	contentType := httpResponse.Header.Get(CONTENT_TYPE)
@@ -398,12 +969,26 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 
 		var responseBody []byte
 
+		// Decode a compressed response body (e.g. gzip) that the transforms didn't decode,
+		// so that the error message isn't garbled.
+		if decodeErr := decodeResponseContent(httpResponse); decodeErr != nil {
+			GetLogger().Debug("Unable to decode the error response body: %s", decodeErr.Error())
+			httpResponse.Body.Close() // #nosec G104
+			err = newHTTPError(detailedResponse, http.StatusText(httpResponse.StatusCode))
+			return
+		}
+
 		// First, read the response body into a byte array.
 		if httpResponse.Body != nil {
 			var readErr error
 
 			defer httpResponse.Body.Close()
-			responseBody, readErr = ioutil.ReadAll(httpResponse.Body)
+			responseBody, readErr = jsonLimits.readResponseBody(httpResponse.Body, contentType)
+			if _, ok := readErr.(*JSONLimitError); ok {
+				// Don't unmarshal an error response body that exceeds the JSON limits.
+				err = newHTTPError(detailedResponse, http.StatusText(httpResponse.StatusCode))
+				return
+			}
 			if readErr != nil {
 				err = fmt.Errorf(ERRORMSG_READ_RESPONSE_BODY, readErr.Error())
 				return
@@ -412,18 +997,18 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 
 		// If the responseBody is empty, then just return a generic error based on the status code.
 		if len(responseBody) == 0 {
-			err = fmt.Errorf(http.StatusText(httpResponse.StatusCode))
+			err = newHTTPError(detailedResponse, http.StatusText(httpResponse.StatusCode))
 			return
 		}
 
-		// For a JSON-based error response body, decode it into a map (generic JSON object).
-		if IsJSONMimeType(contentType) {
+		// For a JSON-based error response body (within the JSON limits), decode it into a map (generic JSON object).
+		if IsJSONMimeType(contentType) && jsonLimits.check(responseBody) == nil {
 			// Return the error response body as a map, along with an
 			// error object containing our best guess at an error message.
 			responseMap, decodeErr := decodeAsMap(responseBody)
 			if decodeErr == nil {
 				detailedResponse.Result = responseMap
-				err = fmt.Errorf(getErrorMessage(responseMap, detailedResponse.StatusCode))
+				err = newHTTPError(detailedResponse, getErrorMessage(responseMap, detailedResponse.StatusCode))
 				return
 			}
 		}
@@ -432,7 +1017,7 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 		// just return the response body byte array in the RawResult field along with
 		// an error object that contains the generic error message for the status code.
 		detailedResponse.RawResult = responseBody
-		err = fmt.Errorf(http.StatusText(httpResponse.StatusCode))
+		err = newHTTPError(detailedResponse, http.StatusText(httpResponse.StatusCode))
 		return
 	}
 
@@ -440,9 +1025,14 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 	if !IsNil(result) {
 		resultType := reflect.TypeOf(result).String()
 
-		// If 'result' is a io.ReadCloser, then pass the response body back reflectively via 'result'
+		// If 'result' is a ResponseBodyWriter, then copy the response body to its writer
 		// and bypass any further unmarshalling of the response.
-		if resultType == "*io.ReadCloser" {
+		if bodyWriter, ok := result.(*ResponseBodyWriter); ok {
+			defer httpResponse.Body.Close()
+			err = copyResponseBody(httpResponse.Body, bodyWriter, detailedResponse, downloadBufferSize)
+		} else if resultType == "*io.ReadCloser" {
+			// If 'result' is a io.ReadCloser, then pass the response body back reflectively via 'result'
+			// and bypass any further unmarshalling of the response.
 			rResult := reflect.ValueOf(result).Elem()
 			rResult.Set(reflect.ValueOf(httpResponse.Body))
 			detailedResponse.Result = httpResponse.Body
@@ -450,7 +1040,11 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 
 			// First, read the response body into a byte array.
 			defer httpResponse.Body.Close()
-			responseBody, readErr := ioutil.ReadAll(httpResponse.Body)
+			responseBody, readErr := jsonLimits.readResponseBody(httpResponse.Body, contentType)
+			if _, ok := readErr.(*JSONLimitError); ok {
+				err = readErr
+				return
+			}
 			if readErr != nil {
 				err = fmt.Errorf(ERRORMSG_READ_RESPONSE_BODY, readErr.Error())
 				return
@@ -463,6 +1057,17 @@ func (service *BaseService) Request(req *http.Request, result interface{}) (deta
 
 			// If the content-type indicates JSON, then unmarshal the response body as JSON.
 			if IsJSONMimeType(contentType) {
+				// Make sure the response body is within the JSON limits before unmarshalling it.
+				if err = jsonLimits.check(responseBody); err != nil {
+					detailedResponse.RawResult = responseBody
+					return
+				}
+
+				// Validate the response body before unmarshalling it.
+				if err = validateResponse(req, detailedResponse, responseBody, responseValidator, responseValidationMode); err != nil {
+					return
+				}
+
 				// Decode the byte array as JSON.
 				decodeErr := json.NewDecoder(bytes.NewReader(responseBody)).Decode(result)
 				if decodeErr != nil {
@@ -524,12 +1129,12 @@ type Error struct {
 // 1) This function will return the map (result of decoding the byte-stream) as well as the raw
 // byte buffer.  We return the byte buffer in addition to the decoded map so that the caller can
 // re-use (if necessary) the stream of bytes after we've consumed them via the JSON decode step.
-// 2) The primary return value of this function will be:
-//    a) an instance of map[string]interface{} if the specified byte-stream was successfully
-//       decoded as JSON.
-//    b) the string form of the byte-stream if the byte-stream could not be successfully
-//       decoded as JSON.
-// 3) This function will close the io.ReadCloser before returning.
+//  2. The primary return value of this function will be:
+//     a) an instance of map[string]interface{} if the specified byte-stream was successfully
+//     decoded as JSON.
+//     b) the string form of the byte-stream if the byte-stream could not be successfully
+//     decoded as JSON.
+//  3. This function will close the io.ReadCloser before returning.
 func decodeAsMap(byteBuffer []byte) (result map[string]interface{}, err error) {
 	err = json.NewDecoder(bytes.NewReader(byteBuffer)).Decode(&result)
 	return
@@ -577,31 +1182,84 @@ func getErrorMessage(responseMap map[string]interface{}, statusCode int) string
 	return http.StatusText(statusCode)
 }
 
-// EnableRetries will construct a "retryable" HTTP Client with the specified
-// configuration, and then set it on the service instance.
+// EnableRetries will enable automatic retries by wrapping the service's current
+// HTTP Client in a "retryable" HTTP Client with the specified configuration.
+// Each attempt is sent using the current client, so any customizations
+// (e.g. a proxy, an instrumented or mTLS transport, a timeout) that were previously
+// configured via SetHTTPClient() are retained.
+// If retries were already enabled, the previous retry configuration is replaced.
 // If maxRetries and/or maxRetryInterval are specified as 0, then default values
 // are used instead.
 func (service *BaseService) EnableRetries(maxRetries int, maxRetryInterval time.Duration) {
-	client := NewRetryableHTTPClient()
-	if maxRetries > 0 {
-		client.RetryMax = maxRetries
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	client := service.Client
+	if retryableClient := getRetryableHTTPClient(client); retryableClient != nil {
+		client = retryableClient.HTTPClient
 	}
-	if maxRetryInterval > 0 {
-		client.RetryWaitMax = maxRetryInterval
+	if client == nil {
+		client = DefaultHTTPClient()
 	}
 
-	service.SetHTTPClient(client.StandardClient())
+	service.Client = &http.Client{
+		Transport: newRetryableTransport(client, maxRetries, maxRetryInterval),
+	}
 }
 
-// DisableRetries will disable automatic retries by constructing a new
-// default (non-retryable) HTTP Client instance and setting it on the service.
+// DisableRetries will disable automatic retries by restoring the HTTP Client
+// that was wrapped by EnableRetries().
+// If retries are not enabled, the service's HTTP Client is left unchanged.
 func (service *BaseService) DisableRetries() {
-	service.SetHTTPClient(DefaultHTTPClient())
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if retryableClient := getRetryableHTTPClient(service.Client); retryableClient != nil {
+		service.Client = retryableClient.HTTPClient
+	}
 }
 
-// DefaultHTTPClient returns a non-retryable http client with default configuration.
+// NewRetryableTransport returns an http.RoundTripper that sends each attempt via "transport"
+// and automatically retries failed attempts (using IBMCloudSDKRetryPolicy and
+// IBMCloudSDKBackoffPolicy). This allows retries to be composed with a custom transport, e.g.
+//
+//	client := &http.Client{
+//		Transport: core.NewRetryableTransport(myTransport, 3, 30*time.Second),
+//	}
+//	service.SetHTTPClient(client)
+//
+// If "transport" is nil, a default transport is used.
+// If maxRetries and/or maxRetryInterval are specified as 0, then default values
+// are used instead.
+func NewRetryableTransport(transport http.RoundTripper, maxRetries int, maxRetryInterval time.Duration) http.RoundTripper {
+	if IsNil(transport) {
+		transport = cleanhttp.DefaultPooledTransport()
+	}
+	return newRetryableTransport(&http.Client{Transport: transport}, maxRetries, maxRetryInterval)
+}
+
+// newRetryableTransport returns a retryablehttp.RoundTripper that sends each attempt using
+// a copy of "client".
+func newRetryableTransport(client *http.Client, maxRetries int, maxRetryInterval time.Duration) *retryablehttp.RoundTripper {
+	retryableClient := NewRetryableHTTPClient()
+	if maxRetries > 0 {
+		retryableClient.RetryMax = maxRetries
+	}
+	if maxRetryInterval > 0 {
+		retryableClient.RetryWaitMax = maxRetryInterval
+	}
+
+	attemptClient := *client
+	retryableClient.HTTPClient = &attemptClient
+	return &retryablehttp.RoundTripper{Client: retryableClient}
+}
+
+// DefaultHTTPClient returns a non-retryable http client with default configuration
+// (see SetDefaultHTTPClientProfile()).
 func DefaultHTTPClient() *http.Client {
-	return cleanhttp.DefaultPooledClient()
+	// The default profile is known to be valid.
+	client, _ := NewHTTPClient(GetDefaultHTTPClientProfile())
+	return client
 }
 
 // httpLogger is a shim layer used to allow the Go core's logger to be used with the retryablehttp interfaces.
@@ -641,6 +1299,33 @@ func getRetryableHTTPClient(client *http.Client) *retryablehttp.Client {
 	return nil
 }
 
+// clientWithTransport returns a shallow copy of "client" that uses "transport".
+func clientWithTransport(client *http.Client, transport http.RoundTripper) *http.Client {
+	if client == nil {
+		return &http.Client{Transport: transport}
+	}
+	newClient := *client
+	newClient.Transport = transport
+	return &newClient
+}
+
+// retryableClientWithTransport returns a copy of "client" (with the same retry configuration)
+// whose internal HTTP client uses "transport".
+func retryableClientWithTransport(client *retryablehttp.Client, transport http.RoundTripper) *retryablehttp.Client {
+	return &retryablehttp.Client{
+		HTTPClient:      clientWithTransport(client.HTTPClient, transport),
+		Logger:          client.Logger,
+		RetryWaitMin:    client.RetryWaitMin,
+		RetryWaitMax:    client.RetryWaitMax,
+		RetryMax:        client.RetryMax,
+		RequestLogHook:  client.RequestLogHook,
+		ResponseLogHook: client.ResponseLogHook,
+		CheckRetry:      client.CheckRetry,
+		Backoff:         client.Backoff,
+		ErrorHandler:    client.ErrorHandler,
+	}
+}
+
 var (
 	// A regular expression to match the error returned by net/http when the
 	// configured number of redirects is exhausted. This error isn't typed
@@ -666,21 +1351,8 @@ func IBMCloudSDKRetryPolicy(ctx context.Context, resp *http.Response, err error)
 
 	// Next, check for a few non-retryable errors.
 	if err != nil {
-		if v, ok := err.(*url.Error); ok {
-			// Don't retry if the error was due to too many redirects.
-			if redirectsErrorRe.MatchString(v.Error()) {
-				return false, v
-			}
-
-			// Don't retry if the error was due to an invalid protocol scheme.
-			if schemeErrorRe.MatchString(v.Error()) {
-				return false, v
-			}
-
-			// Don't retry if the error was due to TLS cert verification failure.
-			if _, ok := v.Err.(x509.UnknownAuthorityError); ok {
-				return false, v
-			}
+		if !IsRetryableTransportError(err) {
+			return false, err
 		}
 
 		// The error is likely recoverable so retry.
@@ -688,19 +1360,14 @@ func IBMCloudSDKRetryPolicy(ctx context.Context, resp *http.Response, err error)
 	}
 
 	// Now check the status code.
-
-	// A 429 should be retryable.
-	// All codes in the 500's range except for 501 (Not Implemented) should be retryable.
-	if resp.StatusCode == 429 || (resp.StatusCode >= 500 && resp.StatusCode <= 599 && resp.StatusCode != 501) {
-		return true, nil
-	}
-
-	return false, nil
+	return isRetryableStatusCode(resp.StatusCode), nil
 }
 
 // IBMCloudSDKBackoffPolicy provides a default implementation of the Backoff interface
 // associated with a retryablehttp.Client.
-// This function will return the wait time to be associated with the next retry attempt.
+// This function will return the wait time to be associated with the next retry attempt:
+// either the wait time specified by a Retry-After response header, or an exponential
+// backoff with a random jitter between 50% and 100% of the computed wait time.
 func IBMCloudSDKBackoffPolicy(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
 	// Check for a Retry-After header.
 	if resp != nil {
@@ -723,6 +1390,13 @@ func IBMCloudSDKBackoffPolicy(min, max time.Duration, attemptNum int, resp *http
 	}
 
 	// If no header-based wait time can be determined, then ask DefaultBackoff()
-	// to compute an exponential backoff.
-	return retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+	// to compute an exponential backoff, and apply a random jitter (obtained from the
+	// current RandomSource) so that the retries of many clients are spread out over time.
+	wait := retryablehttp.DefaultBackoff(min, max, attemptNum, resp)
+	if jittered := time.Duration(jitter(int64(wait))); jittered >= min {
+		wait = jittered
+	} else if wait > min {
+		wait = min
+	}
+	return wait
 }
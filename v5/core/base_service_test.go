@@ -27,9 +27,12 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/go-retryablehttp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -1868,3 +1871,338 @@ func TestErrorMessage(t *testing.T) {
 		`{"errorMessage":{"statusCode":500,"message":"Internal Server Error"}}`,
 		"Internal Server Error")
 }
+
+func TestSetDefaultHeadersCopy(t *testing.T) {
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           "https://myservice.ibm.com/api/v1",
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	headers := http.Header{}
+	headers.Set("Header1", "value1")
+	service.SetDefaultHeaders(headers)
+
+	// Modifying the caller's map should not affect the service.
+	headers.Set("Header1", "modified")
+	headers.Set("Header2", "value2")
+	assert.Equal(t, "value1", service.GetDefaultHeaders().Get("Header1"))
+	assert.Equal(t, "", service.GetDefaultHeaders().Get("Header2"))
+
+	// Modifying the returned map should not affect the service either.
+	service.GetDefaultHeaders().Set("Header1", "modified")
+	assert.Equal(t, "value1", service.GetDefaultHeaders().Get("Header1"))
+
+	service.SetDefaultHeaders(nil)
+	assert.Nil(t, service.GetDefaultHeaders())
+}
+
+func TestConcurrentConfigMutation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		// Mutate the service's configuration while requests are in flight.
+		go func(i int) {
+			defer wg.Done()
+			headers := http.Header{}
+			headers.Set("Reconcile-Loop", fmt.Sprint(i))
+			service.SetDefaultHeaders(headers)
+			headers.Set("Reconcile-Loop", "modified")
+			service.SetUserAgent(fmt.Sprintf("user-agent-%d", i))
+			service.SetEnableGzipCompression(i%2 == 0)
+			assert.Nil(t, service.SetServiceURL(server.URL))
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			builder := NewRequestBuilder("GET")
+			_, err := builder.ResolveRequestURL(service.GetServiceURL(), "", nil)
+			assert.Nil(t, err)
+			req, _ := builder.Build()
+
+			var foo *Foo
+			detailedResponse, err := service.Request(req, &foo)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, detailedResponse.StatusCode)
+			_ = service.Clone()
+		}()
+	}
+	wg.Wait()
+}
+
+// countingTransport is an http.RoundTripper that counts the requests it sends.
+type countingTransport struct {
+	calls int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.calls, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRequestWithTransport(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first request to exercise retries.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "Basic bXl1c2VyOm15cGFzc3dvcmQ=", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	}))
+	defer server.Close()
+
+	authenticator, _ := NewBasicAuthenticator("myuser", "mypassword")
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: authenticator,
+	})
+	assert.Nil(t, err)
+	serviceTransport := &countingTransport{}
+	service.SetHTTPClient(&http.Client{Transport: serviceTransport})
+
+	invoke := func(transport http.RoundTripper) (*DetailedResponse, error) {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "", nil)
+		assert.Nil(t, err)
+		if transport != nil {
+			builder.WithTransport(transport)
+		}
+		req, _ := builder.Build()
+		var foo *Foo
+		return service.Request(req, &foo)
+	}
+
+	// Without retries, the first request fails.
+	requestTransport := &countingTransport{}
+	_, err = invoke(requestTransport)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requestTransport.calls))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&serviceTransport.calls))
+
+	// The service's transport is used for requests without an alternate transport.
+	response, err := invoke(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&serviceTransport.calls))
+
+	// With retries enabled, the alternate transport is used for each attempt.
+	atomic.StoreInt32(&requests, 0)
+	service.EnableRetries(2, time.Millisecond)
+	requestTransport = &countingTransport{}
+	response, err = invoke(requestTransport)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requestTransport.calls))
+
+	// The service's client is not modified.
+	assert.NotNil(t, getRetryableHTTPClient(service.GetHTTPClient()))
+	assert.NotEqual(t, requestTransport, getRetryableHTTPClient(service.GetHTTPClient()).HTTPClient.Transport)
+}
+
+func TestEnableRetriesRetainsClient(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	transport := &countingTransport{}
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	service.SetHTTPClient(client)
+	service.DisableSSLVerification()
+	assert.True(t, service.IsSSLDisabled())
+	service.SetHTTPClient(client)
+
+	invoke := func() (*DetailedResponse, error) {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "", nil)
+		assert.Nil(t, err)
+		req, _ := builder.Build()
+		return service.Request(req, nil)
+	}
+
+	// The custom transport and timeout are retained when retries are enabled.
+	service.EnableRetries(3, time.Millisecond)
+	retryableClient := getRetryableHTTPClient(service.GetHTTPClient())
+	assert.NotNil(t, retryableClient)
+	assert.Equal(t, 3, retryableClient.RetryMax)
+	assert.Equal(t, transport, retryableClient.HTTPClient.Transport)
+	assert.Equal(t, 30*time.Second, retryableClient.HTTPClient.Timeout)
+
+	response, err := invoke()
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&transport.calls))
+
+	// Re-enabling retries replaces the retry configuration rather than nesting it.
+	service.EnableRetries(5, time.Millisecond)
+	retryableClient = getRetryableHTTPClient(service.GetHTTPClient())
+	assert.Equal(t, 5, retryableClient.RetryMax)
+	assert.Equal(t, transport, retryableClient.HTTPClient.Transport)
+
+	// Disabling retries restores the original client.
+	service.DisableRetries()
+	assert.Nil(t, getRetryableHTTPClient(service.GetHTTPClient()))
+	assert.Equal(t, transport, service.GetHTTPClient().Transport)
+	_, err = invoke()
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&transport.calls))
+	service.DisableRetries()
+	assert.Equal(t, transport, service.GetHTTPClient().Transport)
+
+	// SSL verification settings are retained as well.
+	service.DisableSSLVerification()
+	service.EnableRetries(0, 0)
+	assert.True(t, service.IsSSLDisabled())
+}
+
+func TestNewRetryableTransport(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	transport := &countingTransport{}
+	service.SetHTTPClient(&http.Client{Transport: NewRetryableTransport(transport, 2, time.Millisecond)})
+	retryableClient := getRetryableHTTPClient(service.GetHTTPClient())
+	assert.NotNil(t, retryableClient)
+	assert.Equal(t, 2, retryableClient.RetryMax)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+	response, err := service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&transport.calls))
+
+	// A default transport is used if none is specified.
+	retryableTransport, ok := NewRetryableTransport(nil, 0, 0).(*retryablehttp.RoundTripper)
+	assert.True(t, ok)
+	assert.NotNil(t, retryableTransport.Client.HTTPClient.Transport)
+	assert.Equal(t, NewRetryableHTTPClient().RetryMax, retryableTransport.Client.RetryMax)
+}
+
+func TestRequestDefaultHeadersMerge(t *testing.T) {
+	var received http.Header
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           "https://myservice.cloud.ibm.com",
+		Authenticator: &BearerTokenAuthenticator{BearerToken: "token"},
+	})
+	assert.Nil(t, err)
+	service.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			received = req.Header
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	})
+
+	// Non-canonical default header names are canonicalized, and multiple values are joined.
+	service.DefaultHeaders = http.Header{
+		"x-default":   []string{"a", "b"},
+		"X-Operation": []string{"default"},
+	}
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(service.GetServiceURL(), "/resource", nil)
+	assert.Nil(t, err)
+	builder.AddHeader("X-Operation", "op")
+	req, err := builder.Build()
+	assert.Nil(t, err)
+
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ab"}, received["X-Default"])
+	assert.Equal(t, []string{"op", "default"}, received["X-Operation"])
+	assert.Equal(t, []string{"Bearer token"}, received["Authorization"])
+	assert.Equal(t, []string{service.UserAgent}, received["User-Agent"])
+}
+
+func BenchmarkRequestHeaderAssembly(b *testing.B) {
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           "https://myservice.cloud.ibm.com",
+		Authenticator: &BearerTokenAuthenticator{BearerToken: "token"},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	service.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 204, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+		}),
+	})
+	headers := http.Header{}
+	headers.Set("X-Correlation-Id", "correlation-id")
+	headers.Set("X-Tenant", "tenant-1")
+	headers.Set("X-Client-Version", "1.0.0")
+	service.SetDefaultHeaders(headers)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "/resource", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		builder.AddHeader(Accept, APPLICATION_JSON)
+		req, err := builder.Build()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = service.Request(req, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAuthenticate(b *testing.B) {
+	authenticator := &BearerTokenAuthenticator{BearerToken: "token"}
+	req, err := http.NewRequest(GET, "https://myservice.cloud.ibm.com/resource", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := authenticator.Authenticate(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
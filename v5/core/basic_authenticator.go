@@ -29,6 +29,10 @@ type BasicAuthenticator struct {
 	Username string
 	// Password is the user-supplied basic auth password [required].
 	Password string
+
+	// CredentialsProvider supplies the username and password for each request,
+	// instead of Username and Password [optional].
+	CredentialsProvider CredentialsProvider
 }
 
 // NewBasicAuthenticator constructs a new BasicAuthenticator instance.
@@ -65,6 +69,14 @@ func (BasicAuthenticator) AuthenticationType() string {
 // 		Authorization: Basic <encoded username and password>
 //
 func (this *BasicAuthenticator) Authenticate(request *http.Request) error {
+	if this.CredentialsProvider != nil {
+		username, password, err := getUsernamePassword(this.CredentialsProvider)
+		if err != nil {
+			return err
+		}
+		request.SetBasicAuth(username, password)
+		return nil
+	}
 	request.SetBasicAuth(this.Username, this.Password)
 	return nil
 }
@@ -72,8 +84,13 @@ func (this *BasicAuthenticator) Authenticate(request *http.Request) error {
 // Validate the authenticator's configuration.
 //
 // Ensures the username and password are not Nil. Additionally, ensures
-// they do not contain invalid characters.
+// they do not contain invalid characters. The username and password are not
+// validated if a CredentialsProvider is specified.
 func (this BasicAuthenticator) Validate() error {
+	if this.CredentialsProvider != nil {
+		return nil
+	}
+
 	if this.Username == "" {
 		return fmt.Errorf(ERRORMSG_PROP_MISSING, "Username")
 	}
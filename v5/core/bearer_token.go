@@ -0,0 +1,114 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BearerToken is a bearer token supplied by an authenticator (see GetBearerToken()).
+type BearerToken struct {
+	// The access token.
+	AccessToken string
+
+	// The time (on the local clock) at which the access token expires, or the zero time if unknown.
+	Expiry time.Time
+}
+
+// GetBearerToken returns the bearer token currently supplied by "authenticator", so that an
+// authenticator can be adapted to third-party clients (e.g. the coreoauth2 module adapts it
+// to an oauth2.TokenSource).
+//
+// The authenticator remains responsible for caching and refreshing its access token. The expiration
+// time of the token is set for the IamAuthenticator, ContainerAuthenticator, VpcInstanceAuthenticator,
+// IamAssumeAuthenticator, IamMtlsAuthenticator and CloudPakForDataAuthenticator. Any other authenticator
+// that adds an "Authorization: Bearer ..." header to requests (e.g. a BearerTokenAuthenticator) is also
+// supported, while an error is returned for an authenticator that doesn't use bearer tokens (e.g. a BasicAuthenticator).
+func GetBearerToken(authenticator Authenticator) (*BearerToken, error) {
+	var accessToken string
+	var expiration int64
+	var err error
+
+	switch authenticator := authenticator.(type) {
+	case *IamAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			expiration = iamTokenExpiration(authenticator.getTokenData())
+		}
+	case *ContainerAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			expiration = iamTokenExpiration(authenticator.getTokenData())
+		}
+	case *VpcInstanceAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			expiration = iamTokenExpiration(authenticator.getTokenData())
+		}
+	case *IamAssumeAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			expiration = iamTokenExpiration(authenticator.getTokenData())
+		}
+	case *IamMtlsAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			expiration = iamTokenExpiration(authenticator.getTokenData())
+		}
+	case *CloudPakForDataAuthenticator:
+		if accessToken, err = authenticator.GetToken(); err == nil {
+			if tokenData := authenticator.getTokenData(); tokenData != nil {
+				expiration = tokenData.Expiration
+			}
+		}
+	default:
+		accessToken, err = getAuthorizationBearerToken(authenticator)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token := &BearerToken{
+		AccessToken: accessToken,
+	}
+	if expiration > 0 {
+		token.Expiry = time.Unix(expiration, 0)
+	}
+	return token, nil
+}
+
+// iamTokenExpiration returns the expiration time of the token in "tokenData" (0 if there is no token).
+func iamTokenExpiration(tokenData *iamTokenData) int64 {
+	if tokenData == nil {
+		return 0
+	}
+	return tokenData.Expiration
+}
+
+// getAuthorizationBearerToken returns the bearer token that "authenticator" adds to the Authorization header of a request.
+func getAuthorizationBearerToken(authenticator Authenticator) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://localhost", nil)
+	if err != nil {
+		return "", err
+	}
+	if err = authenticator.Authenticate(req); err != nil {
+		return "", err
+	}
+
+	const prefix = "Bearer "
+	authHeader := req.Header.Get(headerNameAuthorization)
+	if len(authHeader) <= len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
+		return "", fmt.Errorf(ERRORMSG_TOKEN_SOURCE_UNSUPPORTED, authenticator.AuthenticationType())
+	}
+	return authHeader[len(prefix):], nil
+}
@@ -15,6 +15,7 @@ package core
 // limitations under the License.
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -26,8 +27,14 @@ import (
 //
 type BearerTokenAuthenticator struct {
 
-	// The bearer token value to be used to authenticate request [required].
+	// The bearer token value to be used to authenticate request [required, unless TokenSupplier is specified].
 	BearerToken string
+
+	// A function that supplies the bearer token for each request [optional]. If specified, it is used
+	// instead of BearerToken, so that an application that manages its own tokens (e.g. tokens pushed
+	// into memory by an operator) needn't call SetBearerToken() whenever the token changes.
+	// It is invoked with the request's context, and must be safe for concurrent use.
+	TokenSupplier func(ctx context.Context) (string, error)
 }
 
 // NewBearerTokenAuthenticator constructs a new BearerTokenAuthenticator instance.
@@ -41,6 +48,18 @@ func NewBearerTokenAuthenticator(bearerToken string) (*BearerTokenAuthenticator,
 	return obj, nil
 }
 
+// NewBearerTokenAuthenticatorFromFunc constructs a new BearerTokenAuthenticator instance that
+// obtains the bearer token for each request from "supplier".
+func NewBearerTokenAuthenticatorFromFunc(supplier func(ctx context.Context) (string, error)) (*BearerTokenAuthenticator, error) {
+	obj := &BearerTokenAuthenticator{
+		TokenSupplier: supplier,
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
 // newBearerTokenAuthenticator : Constructs a new BearerTokenAuthenticator instance from a map.
 func newBearerTokenAuthenticatorFromMap(properties map[string]string) (*BearerTokenAuthenticator, error) {
 	if properties == nil {
@@ -62,15 +81,29 @@ func (BearerTokenAuthenticator) AuthenticationType() string {
 // 		Authorization: Bearer <bearer-token>
 //
 func (this *BearerTokenAuthenticator) Authenticate(request *http.Request) error {
-	request.Header.Set("Authorization", fmt.Sprintf(`Bearer %s`, this.BearerToken))
+	bearerToken := this.BearerToken
+	if this.TokenSupplier != nil {
+		var err error
+		bearerToken, err = this.TokenSupplier(request.Context())
+		if err == nil && bearerToken == "" {
+			err = fmt.Errorf(ERRORMSG_PROP_MISSING, "BearerToken")
+		}
+		if err != nil {
+			if _, ok := err.(*AuthenticationError); !ok {
+				err = NewAuthenticationError(&DetailedResponse{}, err)
+			}
+			return err
+		}
+	}
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+bearerToken)
 	return nil
 }
 
 // Validate the authenticator's configuration.
 //
-// Ensures the bearer token is not Nil.
+// Ensures the bearer token is not Nil, unless a token supplier was specified.
 func (this BearerTokenAuthenticator) Validate() error {
-	if this.BearerToken == "" {
+	if this.BearerToken == "" && this.TokenSupplier == nil {
 		return fmt.Errorf(ERRORMSG_PROP_MISSING, "BearerToken")
 	}
 	return nil
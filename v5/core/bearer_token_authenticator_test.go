@@ -17,6 +17,8 @@ package core
 // limitations under the License.
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -73,3 +75,48 @@ func TestNewBearerTokenAuthenticatorFromMap(t *testing.T) {
 	assert.NotNil(t, authenticator)
 	assert.Equal(t, "my-token", authenticator.BearerToken)
 }
+
+func TestBearerTokenAuthenticatorFromFunc(t *testing.T) {
+	_, err := NewBearerTokenAuthenticatorFromFunc(nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "BearerToken"), err.Error())
+
+	type ctxKey struct{}
+	currentToken := "token-1"
+	authenticator, err := NewBearerTokenAuthenticatorFromFunc(func(ctx context.Context) (string, error) {
+		assert.Equal(t, "value", ctx.Value(ctxKey{}))
+		return currentToken, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, AUTHTYPE_BEARER_TOKEN, authenticator.AuthenticationType())
+
+	builder, err := NewRequestBuilder("GET").ConstructHTTPURL("https://localhost/placeholder/url", nil, nil)
+	assert.Nil(t, err)
+	builder = builder.WithContext(context.WithValue(context.Background(), ctxKey{}, "value"))
+	request, err := builder.Build()
+	assert.Nil(t, err)
+
+	// The supplier is invoked for each request.
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer token-1", request.Header.Get("Authorization"))
+	currentToken = "token-2"
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer token-2", request.Header.Get("Authorization"))
+
+	// An error (or an empty token) returned by the supplier fails the request.
+	currentToken = ""
+	err = authenticator.Authenticate(request)
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "BearerToken"), authErr.Error())
+
+	authenticator.TokenSupplier = func(ctx context.Context) (string, error) {
+		return "", errors.New("token not yet pushed")
+	}
+	err = authenticator.Authenticate(request)
+	assert.NotNil(t, err)
+	_, ok = err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, "token not yet pushed", err.Error())
+}
@@ -0,0 +1,71 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBearerToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer tokenServer.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(tokenServer.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// The token (and its expiration time) are obtained from the authenticator.
+	token, err := GetBearerToken(authenticator)
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token.AccessToken)
+	assert.Equal(t, time.Unix(authenticator.getTokenData().Expiration, 0), token.Expiry)
+
+	// The authenticator caches the token.
+	_, err = GetBearerToken(authenticator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tokenRequests)
+
+	// Other bearer-token authenticators are supported, but not authenticators that don't use bearer tokens.
+	bearerAuthenticator, err := NewBearerTokenAuthenticator("my-bearer-token")
+	assert.Nil(t, err)
+	token, err = GetBearerToken(bearerAuthenticator)
+	assert.Nil(t, err)
+	assert.Equal(t, "my-bearer-token", token.AccessToken)
+	assert.True(t, token.Expiry.IsZero())
+
+	basicAuthenticator, err := NewBasicAuthenticator("user", "password")
+	assert.Nil(t, err)
+	token, err = GetBearerToken(basicAuthenticator)
+	assert.Nil(t, token)
+	assert.Equal(t, "The authenticator of type 'basic' does not supply bearer tokens", err.Error())
+}
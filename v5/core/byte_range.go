@@ -0,0 +1,322 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerNameRange        = "Range"
+	headerNameContentRange = "Content-Range"
+	headerNameAcceptRanges = "Accept-Ranges"
+	headerNameIfRange      = "If-Range"
+	headerNameETag         = "Etag"
+	headerNameLastModified = "Last-Modified"
+
+	rangeUnitBytes = "bytes"
+)
+
+// ByteRange is a range of bytes within a resource, as specified by a "Range" header
+// (e.g. "bytes=0-499"). Start and End are zero-based and inclusive.
+// An End of -1 denotes a range that extends to the end of the resource (e.g. "bytes=500-"),
+// while a Start of -1 denotes a suffix range consisting of the last End bytes (e.g. "bytes=-500").
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// String returns the value of the "Range" header that requests the range.
+func (r ByteRange) String() string {
+	switch {
+	case r.Start < 0:
+		return fmt.Sprintf("%s=-%d", rangeUnitBytes, r.End)
+	case r.End < 0:
+		return fmt.Sprintf("%s=%d-", rangeUnitBytes, r.Start)
+	default:
+		return fmt.Sprintf("%s=%d-%d", rangeUnitBytes, r.Start, r.End)
+	}
+}
+
+// ParseRange parses the value of a "Range" header containing a single byte range.
+func ParseRange(value string) (*ByteRange, error) {
+	spec := strings.TrimSpace(value)
+	if !strings.HasPrefix(spec, rangeUnitBytes+"=") || strings.Contains(spec, ",") {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameRange, value)
+	}
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, rangeUnitBytes+"="))
+
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameRange, value)
+	}
+	startStr, endStr := strings.TrimSpace(spec[:dash]), strings.TrimSpace(spec[dash+1:])
+
+	r := &ByteRange{Start: -1, End: -1}
+	var err error
+	if startStr != "" {
+		if r.Start, err = parseRangeValue(startStr); err != nil {
+			return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameRange, value)
+		}
+	}
+	if endStr != "" {
+		if r.End, err = parseRangeValue(endStr); err != nil {
+			return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameRange, value)
+		}
+	}
+	if (startStr == "" && endStr == "") || (r.Start >= 0 && r.End >= 0 && r.End < r.Start) {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameRange, value)
+	}
+	return r, nil
+}
+
+// ContentRange describes the part of a resource contained in a partial (206) response,
+// as specified by a "Content-Range" header (e.g. "bytes 0-499/1234").
+// Start and End are zero-based and inclusive; Total is -1 if the size of the resource
+// is unknown (e.g. "bytes 0-499/*"). For an unsatisfied range (e.g. "bytes */1234"),
+// Start and End are -1.
+type ContentRange struct {
+	Start int64
+	End   int64
+	Total int64
+}
+
+// Length returns the number of bytes in the range.
+func (r ContentRange) Length() int64 {
+	if r.Start < 0 {
+		return 0
+	}
+	return r.End - r.Start + 1
+}
+
+// String returns the value of the "Content-Range" header that describes the range.
+func (r ContentRange) String() string {
+	total := "*"
+	if r.Total >= 0 {
+		total = strconv.FormatInt(r.Total, 10)
+	}
+	if r.Start < 0 {
+		return fmt.Sprintf("%s */%s", rangeUnitBytes, total)
+	}
+	return fmt.Sprintf("%s %d-%d/%s", rangeUnitBytes, r.Start, r.End, total)
+}
+
+// ParseContentRange parses the value of a "Content-Range" header.
+func ParseContentRange(value string) (*ContentRange, error) {
+	spec := strings.TrimSpace(value)
+	if !strings.HasPrefix(spec, rangeUnitBytes+" ") {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	spec = strings.TrimSpace(strings.TrimPrefix(spec, rangeUnitBytes+" "))
+
+	slash := strings.Index(spec, "/")
+	if slash < 0 {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	rangeStr, totalStr := spec[:slash], spec[slash+1:]
+
+	r := &ContentRange{Start: -1, End: -1, Total: -1}
+	var err error
+	if totalStr != "*" {
+		if r.Total, err = parseRangeValue(totalStr); err != nil {
+			return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+		}
+	}
+	if rangeStr == "*" {
+		if r.Total < 0 {
+			return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+		}
+		return r, nil
+	}
+
+	dash := strings.Index(rangeStr, "-")
+	if dash < 0 {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	if r.Start, err = parseRangeValue(rangeStr[:dash]); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	if r.End, err = parseRangeValue(rangeStr[dash+1:]); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	if r.End < r.Start || (r.Total >= 0 && r.End >= r.Total) {
+		return nil, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, value)
+	}
+	return r, nil
+}
+
+// parseRangeValue parses a non-negative integer within a range header.
+func parseRangeValue(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
+
+// AddRangeHeader adds a "Range" header that requests bytes "start" through "end" (inclusive)
+// of the resource. An "end" of -1 requests the bytes from "start" to the end of the resource.
+func (requestBuilder *RequestBuilder) AddRangeHeader(start int64, end int64) *RequestBuilder {
+	return requestBuilder.AddHeader(headerNameRange, ByteRange{Start: start, End: end}.String())
+}
+
+// GetContentRange returns the range described by the response's "Content-Range" header,
+// or nil if the response has no (valid) "Content-Range" header.
+func (response *DetailedResponse) GetContentRange() *ContentRange {
+	contentRange, err := ParseContentRange(response.Headers.Get(headerNameContentRange))
+	if err != nil {
+		return nil
+	}
+	return contentRange
+}
+
+// Download sends "req" (a GET request constructed by a RequestBuilder, possibly with a "Range"
+// header added by AddRangeHeader()) and copies the response body to "w", returning the number of
+// bytes written. It is intended for the resumable download of large objects.
+//
+// If reading the response body fails (e.g. the connection is reset) and the server supports range
+// requests, the download is resumed (up to "maxResumes" times) by sending a copy of "req" that
+// requests the remaining bytes. The copy includes an "If-Range" header containing the response's
+// ETag (or Last-Modified date), so that the download fails rather than mixing the contents
+// of two different versions of the object.
+func (service *BaseService) Download(req *http.Request, w io.Writer, maxResumes int) (written int64, err error) {
+	// Keep a pristine copy of the request, from which any resumed requests are created.
+	original := req.Clone(req.Context())
+
+	// The range requested by the caller, if any.
+	var requested *ByteRange
+	if value := req.Header.Get(headerNameRange); value != "" {
+		if requested, err = ParseRange(value); err != nil {
+			return
+		}
+	}
+
+	var body io.ReadCloser
+	detailedResponse, err := service.Request(req, &body)
+	if err != nil {
+		return
+	}
+	validator := downloadValidator(detailedResponse.Headers)
+	resumable := detailedResponse.StatusCode == http.StatusPartialContent ||
+		strings.EqualFold(detailedResponse.Headers.Get(headerNameAcceptRanges), rangeUnitBytes)
+
+	// The offset (within the object) of the first byte of the response body.
+	var offset int64
+	if detailedResponse.StatusCode == http.StatusPartialContent {
+		contentRange := detailedResponse.GetContentRange()
+		if contentRange == nil {
+			body.Close() // #nosec G104
+			return 0, fmt.Errorf(ERRORMSG_RANGE_INVALID, headerNameContentRange, detailedResponse.Headers.Get(headerNameContentRange))
+		}
+		offset = contentRange.Start
+	} else if requested != nil && requested.Start > 0 {
+		// The server ignored the requested range and returned the entire object, so skip
+		// the bytes preceding the requested range.
+		if _, err = io.CopyN(ioutil.Discard, body, requested.Start); err != nil {
+			body.Close() // #nosec G104
+			return
+		}
+		offset = requested.Start
+	}
+
+	buf := getDownloadBuffer(service.GetDownloadBufferSize())
+	defer putDownloadBuffer(buf)
+
+	for resumes := 0; ; resumes++ {
+		var n int64
+		n, err = copyToEnd(w, body, *buf, requested, offset+written)
+		body.Close() // #nosec G104
+		written += n
+		if writeErr, ok := err.(*downloadWriteError); ok {
+			err = writeErr.err
+			return
+		}
+		if err == nil || !resumable || resumes >= maxResumes {
+			return
+		}
+		GetLogger().Warn("Resuming download of %s at byte %d: %s", RedactSecrets(original.URL.String()), offset+written, err.Error())
+
+		// Request the remaining bytes, provided that the object hasn't changed.
+		resumeReq := original.Clone(original.Context())
+		remaining := ByteRange{Start: offset + written, End: -1}
+		if requested != nil && requested.Start >= 0 && requested.End >= 0 {
+			remaining.End = requested.End
+		}
+		resumeReq.Header.Set(headerNameRange, remaining.String())
+		if validator != "" {
+			resumeReq.Header.Set(headerNameIfRange, validator)
+		}
+
+		body = nil
+		if detailedResponse, err = service.Request(resumeReq, &body); err != nil {
+			return
+		}
+		contentRange := detailedResponse.GetContentRange()
+		if detailedResponse.StatusCode != http.StatusPartialContent || contentRange == nil || contentRange.Start != remaining.Start {
+			body.Close() // #nosec G104
+			err = fmt.Errorf(ERRORMSG_DOWNLOAD_NOT_RESUMABLE, detailedResponse.StatusCode)
+			return
+		}
+	}
+}
+
+// downloadWriteError wraps an error that occurred while writing downloaded bytes,
+// which (unlike an error that occurred while reading them) can't be resolved by resuming the download.
+type downloadWriteError struct {
+	err error
+}
+
+func (e *downloadWriteError) Error() string {
+	return e.err.Error()
+}
+
+// copyToEnd copies "body" to "w" (using "buf") until the end of the body (or of the requested range).
+func copyToEnd(w io.Writer, body io.Reader, buf []byte, requested *ByteRange, position int64) (int64, error) {
+	if requested != nil && requested.Start >= 0 && requested.End >= 0 {
+		body = io.LimitReader(body, requested.End-position+1)
+	}
+	var written int64
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			m, writeErr := w.Write(buf[:n])
+			written += int64(m)
+			if writeErr != nil {
+				return written, &downloadWriteError{err: writeErr}
+			}
+		}
+		if readErr == io.EOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// downloadValidator returns the value for an "If-Range" header that ensures that
+// a resumed download retrieves the same version of the object, or "".
+// A weak ETag can't be used with If-Range.
+func downloadValidator(header http.Header) string {
+	if etag := header.Get(headerNameETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get(headerNameLastModified)
+}
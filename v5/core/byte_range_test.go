@@ -0,0 +1,226 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	r, err := ParseRange("bytes=0-499")
+	assert.Nil(t, err)
+	assert.Equal(t, &ByteRange{Start: 0, End: 499}, r)
+	assert.Equal(t, "bytes=0-499", r.String())
+
+	r, err = ParseRange(" bytes=500- ")
+	assert.Nil(t, err)
+	assert.Equal(t, &ByteRange{Start: 500, End: -1}, r)
+	assert.Equal(t, "bytes=500-", r.String())
+
+	r, err = ParseRange("bytes=-100")
+	assert.Nil(t, err)
+	assert.Equal(t, &ByteRange{Start: -1, End: 100}, r)
+	assert.Equal(t, "bytes=-100", r.String())
+
+	for _, value := range []string{"", "bytes=", "bytes=-", "bytes=5", "bytes=10-5", "bytes=0-1,5-6", "items=0-5", "bytes=a-5", "bytes=--5"} {
+		_, err = ParseRange(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	r, err := ParseContentRange("bytes 0-499/1234")
+	assert.Nil(t, err)
+	assert.Equal(t, &ContentRange{Start: 0, End: 499, Total: 1234}, r)
+	assert.Equal(t, int64(500), r.Length())
+	assert.Equal(t, "bytes 0-499/1234", r.String())
+
+	r, err = ParseContentRange("bytes 500-999/*")
+	assert.Nil(t, err)
+	assert.Equal(t, &ContentRange{Start: 500, End: 999, Total: -1}, r)
+	assert.Equal(t, "bytes 500-999/*", r.String())
+
+	r, err = ParseContentRange("bytes */1234")
+	assert.Nil(t, err)
+	assert.Equal(t, &ContentRange{Start: -1, End: -1, Total: 1234}, r)
+	assert.Equal(t, int64(0), r.Length())
+	assert.Equal(t, "bytes */1234", r.String())
+
+	for _, value := range []string{"", "bytes", "bytes 0-499", "bytes */*", "bytes 5-1/10", "bytes 0-10/10", "bytes 0/10", "items 0-1/2"} {
+		_, err = ParseContentRange(value)
+		assert.NotNil(t, err, value)
+	}
+
+	detailedResponse := &DetailedResponse{Headers: http.Header{}}
+	assert.Nil(t, detailedResponse.GetContentRange())
+	detailedResponse.Headers.Set("Content-Range", "bytes 10-19/20")
+	assert.Equal(t, &ContentRange{Start: 10, End: 19, Total: 20}, detailedResponse.GetContentRange())
+
+	builder := NewRequestBuilder(GET).AddRangeHeader(100, -1)
+	assert.Equal(t, "bytes=100-", builder.Header.Get("Range"))
+}
+
+// newDownloadTestServer returns a server that serves "object" and supports range requests.
+// The first "failures" responses are aborted after "failAfter" bytes.
+func newDownloadTestServer(object string, etag *string, failures int, failAfter int) (*httptest.Server, *[]string) {
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", *etag)
+		w.Header().Set(CONTENT_TYPE, "application/octet-stream")
+
+		body := object
+		status := http.StatusOK
+		if value := r.Header.Get("Range"); value != "" && (r.Header.Get("If-Range") == "" || r.Header.Get("If-Range") == *etag) {
+			requested, err := ParseRange(value)
+			if err != nil {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			end := requested.End
+			if end < 0 || end >= int64(len(object)) {
+				end = int64(len(object)) - 1
+			}
+			body = object[requested.Start : end+1]
+			status = http.StatusPartialContent
+			w.Header().Set("Content-Range", ContentRange{Start: requested.Start, End: end, Total: int64(len(object))}.String())
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+
+		if failures > 0 && len(body) > failAfter {
+			failures--
+			_, _ = w.Write([]byte(body[:failAfter]))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	return server, &ranges
+}
+
+func newDownloadRequest(t *testing.T, url string, start int64, end int64) *http.Request {
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(url, "/objects/1", nil)
+	assert.Nil(t, err)
+	if start >= 0 {
+		builder.AddRangeHeader(start, end)
+	}
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestDownloadResume(t *testing.T) {
+	object := strings.Repeat("0123456789", 10)
+	etag := `"v1"`
+	server, ranges := newDownloadTestServer(object, &etag, 2, 30)
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// The download is resumed twice.
+	var buf bytes.Buffer
+	written, err := service.Download(newDownloadRequest(t, server.URL, -1, -1), &buf, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), written)
+	assert.Equal(t, object, buf.String())
+	assert.Equal(t, []string{"", "bytes=30-", "bytes=60-"}, *ranges)
+
+	// A requested range is honored when resuming.
+	*ranges = nil
+	buf.Reset()
+	server.Close()
+	server, ranges = newDownloadTestServer(object, &etag, 1, 5)
+	defer server.Close()
+	written, err = service.Download(newDownloadRequest(t, server.URL, 20, 49), &buf, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(30), written)
+	assert.Equal(t, object[20:50], buf.String())
+	assert.Equal(t, []string{"bytes=20-49", "bytes=25-49"}, *ranges)
+}
+
+func TestDownloadResumeFailures(t *testing.T) {
+	object := strings.Repeat("0123456789", 10)
+	etag := `"v1"`
+	server, ranges := newDownloadTestServer(object, &etag, 2, 30)
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// The number of resumes is limited.
+	var buf bytes.Buffer
+	written, err := service.Download(newDownloadRequest(t, server.URL, -1, -1), &buf, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(60), written)
+	assert.Equal(t, []string{"", "bytes=30-"}, *ranges)
+
+	// The download fails if the object changes.
+	server.Close()
+	server, _ = newDownloadTestServer(object, &etag, 1, 30)
+	defer server.Close()
+	buf.Reset()
+	service.SetServiceURL(server.URL)
+	req := newDownloadRequest(t, server.URL, -1, -1)
+	etagChanger := &changingWriter{w: &buf, change: func() { etag = `"v2"` }}
+	written, err = service.Download(req, etagChanger, 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_DOWNLOAD_NOT_RESUMABLE, 200), err.Error())
+	assert.Equal(t, int64(30), written)
+
+	// A write error is not resumed.
+	server.Close()
+	etag = `"v1"`
+	server, ranges = newDownloadTestServer(object, &etag, 0, 0)
+	defer server.Close()
+	written, err = service.Download(newDownloadRequest(t, server.URL, -1, -1), &failingWriter{}, 3)
+	assert.NotNil(t, err)
+	assert.Equal(t, "disk full", err.Error())
+	assert.Equal(t, int64(0), written)
+	assert.Equal(t, []string{""}, *ranges)
+}
+
+// changingWriter is an io.Writer that invokes "change" after its first write.
+type changingWriter struct {
+	w      *bytes.Buffer
+	change func()
+}
+
+func (c *changingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.change()
+	return n, err
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -0,0 +1,160 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The endpoints between which requests are routed by a CanaryRouting configuration.
+const (
+	CanaryEndpointPrimary = "primary"
+	CanaryEndpointCanary  = "canary"
+)
+
+// The percentage of requests routed to a degraded canary endpoint (see CanaryRouting.MaxErrorRate),
+// so that its error rate reflects its recovery.
+const canaryProbePercentage = 1.0
+
+// canaryEndpointKey is the context key used to associate a canary routing override with a request.
+type canaryEndpointKey struct{}
+
+// CanaryRouteHandler is a function invoked after a request has been routed to "endpoint"
+// (CanaryEndpointPrimary or CanaryEndpointCanary), with the outcome of the request,
+// for example to record metrics labeled by the endpoint that served the request.
+type CanaryRouteHandler func(req *http.Request, endpoint string, detailedResponse *DetailedResponse, err error)
+
+// CanaryRouting describes the weighted routing of a service's requests between
+// its service URL (the primary endpoint) and a canary endpoint.
+type CanaryRouting struct {
+	// The URL of the canary endpoint, which replaces the service URL within the
+	// URL of each request routed to the canary endpoint [required].
+	URL string
+
+	// The percentage (0-100) of requests to be routed to the canary endpoint [required].
+	Percentage float64
+
+	// If positive, the maximum error rate (0-1) of the canary endpoint (see BaseService.GetEndpointStats()).
+	// While the canary endpoint's error rate exceeds this value, only 1% of the requests (if the Percentage
+	// is higher) are routed to the canary endpoint, until its error rate recovers [optional].
+	MaxErrorRate float64
+
+	// A function invoked after each routed request [optional].
+	Handler CanaryRouteHandler
+}
+
+// SetCanaryRouting configures the routing of the specified percentage of requests to a canary
+// endpoint. The endpoint for a particular request can be chosen explicitly with
+// RequestBuilder.WithCanaryEndpoint(). Requests whose service URL is overridden (see
+// RequestBuilder.WithServiceURL()) are not routed. A nil value disables canary routing.
+func (service *BaseService) SetCanaryRouting(routing *CanaryRouting) error {
+	var routingCopy *CanaryRouting
+	if routing != nil {
+		if routing.URL == "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "URL")
+		}
+		if HasBadFirstOrLastChar(routing.URL) {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "URL")
+		}
+		if _, err := url.Parse(routing.URL); err != nil {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "URL")
+		}
+		if routing.Percentage < 0 || routing.Percentage > 100 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "Percentage")
+		}
+		if routing.MaxErrorRate < 0 || routing.MaxErrorRate > 1 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxErrorRate")
+		}
+		routingCopy = &CanaryRouting{}
+		*routingCopy = *routing
+		routingCopy.URL = strings.TrimRight(routing.URL, "/")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.canaryRouting = routingCopy
+	return nil
+}
+
+// GetCanaryRouting returns a copy of the service's canary routing configuration, or nil.
+func (service *BaseService) GetCanaryRouting() *CanaryRouting {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	if service.canaryRouting == nil {
+		return nil
+	}
+	routingCopy := *service.canaryRouting
+	return &routingCopy
+}
+
+// WithCanaryEndpoint routes the http.Request instance that will be constructed by the
+// Build() method to "endpoint" (CanaryEndpointPrimary or CanaryEndpointCanary), rather
+// than to an endpoint chosen according to the service's canary routing percentage.
+// It has no effect if canary routing is not configured on the service.
+func (requestBuilder *RequestBuilder) WithCanaryEndpoint(endpoint string) *RequestBuilder {
+	requestBuilder.canaryEndpoint = endpoint
+	return requestBuilder
+}
+
+// routeCanaryRequest chooses the endpoint for "req" according to "routing" (and the stats of the
+// canary endpoint in "endpointStats") and, if the canary endpoint is chosen, replaces the service URL
+// within the request URL with the canary URL. It returns the chosen endpoint, or "" if the request
+// was not routed.
+func routeCanaryRequest(req *http.Request, serviceURL string, routing *CanaryRouting,
+	endpointStats *endpointStatsTracker) (string, error) {
+	if routing == nil || req.Context().Value(serviceURLKey{}) != nil {
+		return "", nil
+	}
+
+	endpoint, _ := req.Context().Value(canaryEndpointKey{}).(string)
+	if endpoint == "" {
+		percentage := routing.Percentage
+		if routing.MaxErrorRate > 0 && percentage > canaryProbePercentage {
+			stats, ok := endpointStats.get(endpointOfURL(routing.URL))
+			if ok && stats.ErrorRate > routing.MaxErrorRate {
+				percentage = canaryProbePercentage
+			}
+		}
+		endpoint = CanaryEndpointPrimary
+		if float64(GetRandomSource().Int63n(10000)) < percentage*100 {
+			endpoint = CanaryEndpointCanary
+		}
+	}
+	if endpoint != CanaryEndpointCanary {
+		return CanaryEndpointPrimary, nil
+	}
+
+	serviceURL = strings.TrimRight(serviceURL, "/")
+	requestURL := req.URL.String()
+	if serviceURL == "" || !strings.HasPrefix(requestURL, serviceURL) {
+		// The request was not constructed from the service URL, so leave it as is.
+		return "", nil
+	}
+
+	canaryURL, err := url.Parse(routing.URL + strings.TrimPrefix(requestURL, serviceURL))
+	if err != nil {
+		return "", err
+	}
+	if req.Host == "" || req.Host == req.URL.Host {
+		req.Host = canaryURL.Host
+	}
+	req.URL = canaryURL
+	return CanaryEndpointCanary, nil
+}
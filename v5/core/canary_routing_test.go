@@ -0,0 +1,189 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCanaryTestService(t *testing.T, received *[]string) *BaseService {
+	service := newNoAuthTestService(t, "https://prod.example.com/api/v1")
+	service.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*received = append(*received, req.URL.String())
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	})
+	return service
+}
+
+func newCanaryTestRequest(t *testing.T, service *BaseService, endpoint string) *http.Request {
+	builder := NewRequestBuilder(GET).WithCanaryEndpoint(endpoint)
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resources/{id}", map[string]string{"id": "r1"})
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestCanaryRouting(t *testing.T) {
+	defer SetRandomSource(nil)
+	SetRandomSource(NewSeededRandomSource(1))
+
+	var received []string
+	service := newCanaryTestService(t, &received)
+
+	labels := map[string]int{}
+	err := service.SetCanaryRouting(&CanaryRouting{
+		URL:        "https://canary.example.com/api/v1/",
+		Percentage: 5,
+		Handler: func(req *http.Request, endpoint string, detailedResponse *DetailedResponse, err error) {
+			assert.Nil(t, err)
+			assert.Equal(t, 200, detailedResponse.StatusCode)
+			if endpoint == CanaryEndpointCanary {
+				assert.Equal(t, "canary.example.com", req.Host)
+			}
+			labels[endpoint]++
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://canary.example.com/api/v1", service.GetCanaryRouting().URL)
+	assert.NotNil(t, service.Clone().GetCanaryRouting())
+
+	for i := 0; i < 1000; i++ {
+		_, err = service.Request(newCanaryTestRequest(t, service, ""), nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1000, labels[CanaryEndpointPrimary]+labels[CanaryEndpointCanary])
+	assert.InDelta(t, 50, labels[CanaryEndpointCanary], 25)
+
+	canary := 0
+	for _, u := range received {
+		if u == "https://canary.example.com/api/v1/resources/r1" {
+			canary++
+		} else {
+			assert.Equal(t, "https://prod.example.com/api/v1/resources/r1", u)
+		}
+	}
+	assert.Equal(t, labels[CanaryEndpointCanary], canary)
+
+	// The endpoint can be chosen for a particular request.
+	received = nil
+	assert.Nil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com/api/v1", Percentage: 0}))
+	_, err = service.Request(newCanaryTestRequest(t, service, CanaryEndpointCanary), nil)
+	assert.Nil(t, err)
+	assert.Nil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com/api/v1", Percentage: 100}))
+	_, err = service.Request(newCanaryTestRequest(t, service, CanaryEndpointPrimary), nil)
+	assert.Nil(t, err)
+	_, err = service.Request(newCanaryTestRequest(t, service, ""), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"https://canary.example.com/api/v1/resources/r1",
+		"https://prod.example.com/api/v1/resources/r1",
+		"https://canary.example.com/api/v1/resources/r1",
+	}, received)
+
+	// Canary routing can be disabled.
+	received = nil
+	assert.Nil(t, service.SetCanaryRouting(nil))
+	assert.Nil(t, service.GetCanaryRouting())
+	_, err = service.Request(newCanaryTestRequest(t, service, CanaryEndpointCanary), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://prod.example.com/api/v1/resources/r1"}, received)
+}
+
+func TestCanaryRoutingServiceURLOverride(t *testing.T) {
+	var received []string
+	service := newCanaryTestService(t, &received)
+	service.SetAllowedHosts("node-1.example.com")
+	assert.Nil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com/api/v1", Percentage: 100}))
+
+	builder := NewRequestBuilder(GET).WithServiceURL("https://node-1.example.com")
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resources", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://node-1.example.com/api/v1/resources"}, received)
+}
+
+func TestCanaryRoutingMaxErrorRate(t *testing.T) {
+	defer SetRandomSource(nil)
+	SetRandomSource(NewSeededRandomSource(1))
+
+	service := newNoAuthTestService(t, "https://prod.example.com/api/v1")
+	canaryStatus := http.StatusServiceUnavailable
+	received := map[string]int{}
+	service.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			received[req.URL.Host]++
+			status := http.StatusOK
+			if req.URL.Host == "canary.example.com" {
+				status = canaryStatus
+			}
+			return &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	})
+	assert.Nil(t, service.SetCanaryRouting(&CanaryRouting{
+		URL:          "https://canary.example.com/api/v1",
+		Percentage:   50,
+		MaxErrorRate: 0.1,
+	}))
+
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			_, _ = service.Request(newCanaryTestRequest(t, service, ""), nil)
+		}
+	}
+
+	// Once the canary endpoint's error rate exceeds the maximum, it only receives a few requests.
+	send(1000)
+	stats, ok := service.GetEndpointStatsFor("https://canary.example.com/api/v1")
+	assert.True(t, ok)
+	assert.True(t, stats.ErrorRate > 0.9)
+	assert.True(t, received["canary.example.com"] < 50, "canary requests: %d", received["canary.example.com"])
+
+	// Once the canary endpoint recovers, it receives its share of the requests again.
+	canaryStatus = http.StatusOK
+	received = map[string]int{}
+	send(3000)
+	assert.True(t, received["canary.example.com"] > 1000, "canary requests: %d", received["canary.example.com"])
+}
+
+func TestCanaryRoutingInvalid(t *testing.T) {
+	var received []string
+	service := newCanaryTestService(t, &received)
+
+	assert.NotNil(t, service.SetCanaryRouting(&CanaryRouting{Percentage: 5}))
+	assert.NotNil(t, service.SetCanaryRouting(&CanaryRouting{URL: "{https://canary.example.com}", Percentage: 5}))
+	assert.NotNil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com", Percentage: -1}))
+	assert.NotNil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com", Percentage: 100.5}))
+	assert.NotNil(t, service.SetCanaryRouting(&CanaryRouting{URL: "https://canary.example.com", Percentage: 5, MaxErrorRate: 1.5}))
+	assert.Nil(t, service.GetCanaryRouting())
+
+	builder := NewRequestBuilder(GET).WithCanaryEndpoint("staging")
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resources", nil)
+	assert.Nil(t, err)
+	_, err = builder.Build()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,113 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+)
+
+const headerNameContentDigest = "Content-Digest"
+
+// Checksum algorithms supported by EnableChunkedUpload(), as defined by RFC 9530.
+const (
+	ChecksumSHA256 = "sha-256"
+	ChecksumSHA512 = "sha-512"
+)
+
+// chunkedUploadKey is the context key used to mark a request whose body is streamed.
+type chunkedUploadKey struct{}
+
+// EnableChunkedUpload causes the request body (typically an io.Reader set by SetBodyContentStream())
+// to be sent with chunked transfer encoding, so that a body of unknown length (e.g. a pipe) can
+// be uploaded without first being buffered to determine its length.
+//
+// If "checksumAlgorithm" is not "" (e.g. ChecksumSHA256), then a "Content-Digest" trailer containing
+// the checksum of the body is sent after the body, so that the server can validate the upload.
+//
+// Because the body is streamed, the request is not retried even if retries are enabled.
+func (requestBuilder *RequestBuilder) EnableChunkedUpload(checksumAlgorithm string) *RequestBuilder {
+	requestBuilder.chunkedUpload = true
+	requestBuilder.checksumAlgorithm = checksumAlgorithm
+	return requestBuilder
+}
+
+// applyChunkedUpload configures "req" to send its body with chunked transfer encoding,
+// followed by a checksum trailer if a checksum algorithm was specified.
+func (requestBuilder *RequestBuilder) applyChunkedUpload(req *http.Request) error {
+	var checksum hash.Hash
+	switch requestBuilder.checksumAlgorithm {
+	case "":
+	case ChecksumSHA256:
+		checksum = sha256.New()
+	case ChecksumSHA512:
+		checksum = sha512.New()
+	default:
+		return fmt.Errorf(ERRORMSG_CHECKSUM_ALGORITHM, requestBuilder.checksumAlgorithm)
+	}
+
+	if req.Body == nil {
+		return nil
+	}
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	req.GetBody = nil
+
+	if checksum != nil {
+		req.Trailer = http.Header{headerNameContentDigest: nil}
+		req.Body = &checksumReader{
+			body:      req.Body,
+			checksum:  checksum,
+			algorithm: requestBuilder.checksumAlgorithm,
+			trailer:   req.Trailer,
+		}
+	}
+	return nil
+}
+
+// isChunkedUpload returns true iff the body of "req" is streamed with chunked transfer encoding.
+func isChunkedUpload(req *http.Request) bool {
+	chunked, _ := req.Context().Value(chunkedUploadKey{}).(bool)
+	return chunked
+}
+
+// checksumReader computes the checksum of a request body as it's read, and sets
+// the checksum trailer when the end of the body is reached.
+type checksumReader struct {
+	body      io.ReadCloser
+	checksum  hash.Hash
+	algorithm string
+	trailer   http.Header
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	_, _ = r.checksum.Write(p[:n])
+	if err == io.EOF {
+		r.trailer.Set(headerNameContentDigest,
+			fmt.Sprintf("%s=:%s:", r.algorithm, base64.StdEncoding.EncodeToString(r.checksum.Sum(nil))))
+	}
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,104 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedUpload(t *testing.T) {
+	var received string
+	var transferEncoding []string
+	var contentLength int64
+	var trailer http.Header
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		transferEncoding = r.TransferEncoding
+		contentLength = r.ContentLength
+		trailer = r.Trailer
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	service.EnableRetries(3, 0)
+	newRequest := func(path string, body io.Reader, checksumAlgorithm string) *http.Request {
+		builder := NewRequestBuilder(PUT)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		_, err = builder.SetBodyContentStream(body)
+		assert.Nil(t, err)
+		req, err := builder.EnableChunkedUpload(checksumAlgorithm).Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// A body of unknown length is streamed from a pipe, followed by its checksum.
+	data := strings.Repeat("0123456789", 10000)
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(data); i += 1000 {
+			_, _ = pw.Write([]byte(data[i : i+1000]))
+		}
+		pw.Close()
+	}()
+	_, err = service.Request(newRequest("/objects/1", pr, ChecksumSHA256), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, data, received)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+	assert.Equal(t, int64(-1), contentLength)
+	sum := sha256.Sum256([]byte(data))
+	assert.Equal(t, fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(sum[:])), trailer.Get("Content-Digest"))
+
+	// Even a body of known length is streamed, without a trailer if no checksum algorithm is specified.
+	_, err = service.Request(newRequest("/objects/1", strings.NewReader("abc"), ""), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", received)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+	assert.Equal(t, "", trailer.Get("Content-Digest"))
+
+	// A streamed request is not retried.
+	requests = 0
+	_, err = service.Request(newRequest("/unavailable", strings.NewReader("abc"), ChecksumSHA512), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, requests)
+
+	// An unsupported checksum algorithm is rejected.
+	builder := NewRequestBuilder(PUT)
+	_, err = builder.ResolveRequestURL(server.URL, "/objects/1", nil)
+	assert.Nil(t, err)
+	_, err = builder.EnableChunkedUpload("md5").Build()
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_CHECKSUM_ALGORITHM, "md5"), err.Error())
+}
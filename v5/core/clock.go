@@ -0,0 +1,166 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time used by the Go core library (e.g. to determine
+// whether an access token has expired). Users of the library can supply their own implementation
+// by calling SetClock(), for example to simulate token expiry or clock skew in tests
+// (see the coretest package). Implementations must be safe for concurrent use.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// systemClock is a Clock backed by time.Now().
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clock holds the Clock used by the Go core library.
+var clock Clock = systemClock{}
+
+// Guards 'clock' so that it can be replaced while it is in use.
+var clockMutex sync.RWMutex
+
+// SetClock sets the Clock to be used by the Go core library.
+// A nil value restores the default (system) Clock.
+func SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+
+	clockMutex.Lock()
+	clock = c
+	clockMutex.Unlock()
+}
+
+// GetClock returns the Clock currently used by the Go core library.
+func GetClock() Clock {
+	clockMutex.RLock()
+	defer clockMutex.RUnlock()
+
+	return clock
+}
+
+const headerNameDate = "Date"
+
+// The default minimum difference between the local clock and a server's clock
+// that is treated as clock skew.
+const defaultClockSkewThreshold = 30 * time.Second
+
+var (
+	// The minimum difference that is treated as clock skew (0 disables detection).
+	clockSkewThreshold = defaultClockSkewThreshold
+
+	// Guards 'clockSkewThreshold'.
+	clockSkewMutex sync.RWMutex
+)
+
+// SetClockSkewThreshold sets the minimum difference between the local clock and the clock
+// of a server (as reported by the "Date" header of its responses) that is treated as clock skew.
+// The default threshold is 30 seconds.
+//
+// When an authenticator obtains an access token from a token server whose clock is skewed, a warning
+// is logged and the token's expiration and refresh times are converted to the local clock, so that
+// a host with a skewed clock neither discards valid tokens nor uses expired ones (see GetClockSkew()).
+// When a service's clock is skewed, a warning is reported to the service's WarningHandler.
+// A threshold of 0 disables detection.
+func SetClockSkewThreshold(threshold time.Duration) {
+	clockSkewMutex.Lock()
+	defer clockSkewMutex.Unlock()
+
+	if threshold < 0 {
+		threshold = 0
+	}
+	clockSkewThreshold = threshold
+}
+
+// GetClockSkewThreshold returns the minimum difference between the local clock and
+// the clock of a server that is treated as clock skew.
+func GetClockSkewThreshold() time.Duration {
+	clockSkewMutex.RLock()
+	defer clockSkewMutex.RUnlock()
+
+	return clockSkewThreshold
+}
+
+// measureClockSkew compares the "Date" header of a response with the local clock, and
+// returns the skew (the server's clock minus the local clock), or 0 if the clocks agree
+// to within the threshold or the response has no "Date" header.
+func measureClockSkew(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	serverDate, err := http.ParseTime(header.Get(headerNameDate))
+	if err != nil {
+		return 0
+	}
+	skew := serverDate.Sub(GetClock().Now()).Truncate(time.Second)
+
+	threshold := GetClockSkewThreshold()
+	if threshold == 0 || (skew < threshold && skew > -threshold) {
+		return 0
+	}
+	return skew
+}
+
+// toLocalTime converts "serverTime" (in seconds since the epoch, according to the clock of
+// a token server whose clock differs from the local clock by "skew") to the local clock.
+func toLocalTime(serverTime int64, skew time.Duration) int64 {
+	return serverTime - int64(skew/time.Second)
+}
+
+// GetClockSkew returns the skew between the clock of the token server of "authenticator" and the
+// local clock (the server's clock minus the local clock), as detected when the authenticator's cached
+// access token was obtained. It returns 0 if the clocks agree to within the threshold (see
+// SetClockSkewThreshold()), if no access token is cached, or if the authenticator doesn't obtain
+// access tokens from a token server.
+func GetClockSkew(authenticator Authenticator) time.Duration {
+	switch authenticator := authenticator.(type) {
+	case *IamAuthenticator:
+		return iamTokenClockSkew(authenticator.getTokenData())
+	case *ContainerAuthenticator:
+		return iamTokenClockSkew(authenticator.getTokenData())
+	case *VpcInstanceAuthenticator:
+		return iamTokenClockSkew(authenticator.getTokenData())
+	case *IamAssumeAuthenticator:
+		return iamTokenClockSkew(authenticator.getTokenData())
+	case *IamMtlsAuthenticator:
+		return iamTokenClockSkew(authenticator.getTokenData())
+	case *CloudPakForDataAuthenticator:
+		if tokenData := authenticator.getTokenData(); tokenData != nil {
+			return tokenData.ClockSkew
+		}
+	}
+	return 0
+}
+
+// iamTokenClockSkew returns the clock skew detected when the token in "tokenData" was obtained
+// (0 if there is no token).
+func iamTokenClockSkew(tokenData *iamTokenData) time.Duration {
+	if tokenData == nil {
+		return 0
+	}
+	return tokenData.ClockSkew
+}
@@ -0,0 +1,133 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// offsetClock is a Clock that is offset from the system clock.
+type offsetClock time.Duration
+
+func (c offsetClock) Now() time.Time {
+	return time.Now().Add(time.Duration(c))
+}
+
+func TestMeasureClockSkew(t *testing.T) {
+	defer SetClockSkewThreshold(defaultClockSkewThreshold)
+	dateHeader := func(offset time.Duration) http.Header {
+		return http.Header{"Date": []string{time.Now().Add(offset).UTC().Format(http.TimeFormat)}}
+	}
+
+	// Small differences are ignored.
+	assert.Equal(t, time.Duration(0), measureClockSkew(dateHeader(5*time.Second)))
+	assert.Equal(t, time.Duration(0), measureClockSkew(http.Header{"Date": []string{"yesterday"}}))
+	assert.Equal(t, time.Duration(0), measureClockSkew(nil))
+
+	skew := measureClockSkew(dateHeader(-10 * time.Minute))
+	assert.InDelta(t, float64(-10*time.Minute), float64(skew), float64(2*time.Second))
+	assert.Equal(t, int64(1000+600), toLocalTime(1000, -10*time.Minute))
+
+	// Detection can be disabled.
+	SetClockSkewThreshold(0)
+	assert.Equal(t, time.Duration(0), measureClockSkew(dateHeader(time.Hour)))
+	assert.Equal(t, time.Duration(0), GetClockSkewThreshold())
+}
+
+func TestIamTokenClockSkew(t *testing.T) {
+	// The token server's clock is an hour behind the local clock.
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		serverTime := time.Now().Add(-time.Hour)
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 1800, "expiration": %d}`,
+			iamAuthTestAccessToken1, serverTime.Unix()+1800)
+	}))
+	defer server.Close()
+	defer SetClock(nil)
+
+	authenticator, err := NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+
+	// The new token is not considered to be expired, and is reused.
+	for i := 0; i < 3; i++ {
+		_, err = authenticator.GetToken()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, requests)
+	assert.InDelta(t, float64(-time.Hour), float64(GetClockSkew(authenticator)), float64(2*time.Second))
+	assert.InDelta(t, time.Now().Add(30*time.Minute).Unix(), authenticator.getTokenData().Expiration, 2)
+
+	// The skew of a service's clock is reported as a service warning (once), but doesn't
+	// affect the authenticator.
+	SetClock(offsetClock(time.Hour))
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	var warnings []Warning
+	service.SetWarningHandler(func(warning Warning) {
+		warnings = append(warnings, warning)
+	})
+	req, err := NewRequestBuilder(GET).ConstructHTTPURL(server.URL, nil, nil)
+	assert.Nil(t, err)
+	request, err := req.Build()
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = service.Request(request, nil)
+		assert.Nil(t, err)
+	}
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, WarningClockSkew, warnings[0].Kind)
+	assert.InDelta(t, float64(-time.Hour), float64(GetClockSkew(authenticator)), float64(2*time.Second))
+}
+
+func TestCachedResponseClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		fmt.Fprint(w, `{"name": "foo"}`)
+	}))
+	defer server.Close()
+	defer SetClock(nil)
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	service.Client.Transport = NewResponseCacheTransport(service.Client.Transport, &ResponseCacheOptions{TTL: time.Hour})
+	var warnings []Warning
+	service.SetWarningHandler(func(warning Warning) {
+		warnings = append(warnings, warning)
+	})
+	req, err := NewRequestBuilder(GET).ConstructHTTPURL(server.URL, nil, nil)
+	assert.Nil(t, err)
+	request, err := req.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(request, nil)
+	assert.Nil(t, err)
+
+	// The "Date" header of a response served from the cache isn't compared with the local clock.
+	SetClock(offsetClock(time.Hour))
+	response, err := service.Request(request, nil)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, response.Headers.Get("Age"))
+	assert.Empty(t, warnings)
+}
@@ -6,6 +6,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 // (C) Copyright IBM Corp. 2020.
@@ -30,6 +33,16 @@ type Foo struct {
 	Name *string `json:"name,omitempty"`
 }
 
+// newNoAuthTestService returns a service for "serviceURL" whose requests are not authenticated.
+func newNoAuthTestService(t *testing.T, serviceURL string) *BaseService {
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           serviceURL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+	return service
+}
+
 func toJSON(obj interface{}) string {
 	buf := new(bytes.Buffer)
 	err := json.NewEncoder(buf).Encode(obj)
@@ -0,0 +1,99 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// CompositeAuthenticator applies an ordered list of authenticators to each request,
+// for deployments that require more than one authentication artifact on the same request
+// (e.g. a bearer token along with an API gateway's subscription key).
+//
+// Each authenticator contributes its headers (or query parameters) in turn, so if two
+// authenticators set the same header, the value set by the later authenticator is used.
+// Authentication stops at the first authenticator that returns an error.
+type CompositeAuthenticator struct {
+	// The authenticators to be applied to each request, in order [required].
+	Authenticators []Authenticator
+}
+
+// NewCompositeAuthenticator constructs a new CompositeAuthenticator instance
+// that applies "authenticators" in the specified order.
+func NewCompositeAuthenticator(authenticators ...Authenticator) (*CompositeAuthenticator, error) {
+	obj := &CompositeAuthenticator{
+		Authenticators: authenticators,
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// AuthenticationType returns the authentication type for this authenticator.
+func (CompositeAuthenticator) AuthenticationType() string {
+	return AUTHTYPE_COMPOSITE
+}
+
+// Authenticate applies each of the authenticators to the request, in order.
+func (this *CompositeAuthenticator) Authenticate(request *http.Request) error {
+	for _, authenticator := range this.Authenticators {
+		if err := authenticator.Authenticate(request); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InvalidateToken discards the access tokens cached by those authenticators
+// that manage access tokens (i.e. that implement TokenInvalidator).
+func (this *CompositeAuthenticator) InvalidateToken() {
+	for _, authenticator := range this.Authenticators {
+		if invalidator, ok := authenticator.(TokenInvalidator); ok {
+			invalidator.InvalidateToken()
+		}
+	}
+}
+
+// managesTokens returns true iff any of the authenticators manages access tokens.
+func (this *CompositeAuthenticator) managesTokens() bool {
+	for _, authenticator := range this.Authenticators {
+		if managesTokens(authenticator) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate the authenticator's configuration.
+//
+// Ensures that at least one authenticator was specified, and validates each authenticator.
+func (this CompositeAuthenticator) Validate() error {
+	if len(this.Authenticators) == 0 {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "Authenticators")
+	}
+
+	for _, authenticator := range this.Authenticators {
+		if IsNil(authenticator) {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "Authenticators")
+		}
+		if err := authenticator.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
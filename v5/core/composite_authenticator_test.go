@@ -0,0 +1,90 @@
+//go:build all || fast || auth
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingAuthenticator is an Authenticator whose Authenticate method always fails.
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) AuthenticationType() string { return "failing" }
+func (failingAuthenticator) Validate() error            { return nil }
+func (failingAuthenticator) Authenticate(_ *http.Request) error {
+	return errors.New("authentication failed")
+}
+
+func TestCompositeAuthValidate(t *testing.T) {
+	_, err := NewCompositeAuthenticator()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_MISSING, "Authenticators").Error(), err.Error())
+
+	_, err = NewCompositeAuthenticator(&NoAuthAuthenticator{}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_INVALID, "Authenticators").Error(), err.Error())
+
+	var nilBasic *BasicAuthenticator
+	_, err = NewCompositeAuthenticator(nilBasic)
+	assert.NotNil(t, err)
+
+	// The authenticators are validated.
+	_, err = NewCompositeAuthenticator(&BearerTokenAuthenticator{})
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_PROP_MISSING, "BearerToken").Error(), err.Error())
+
+	authenticator, err := NewCompositeAuthenticator(&NoAuthAuthenticator{})
+	assert.Nil(t, err)
+	assert.Equal(t, AUTHTYPE_COMPOSITE, authenticator.AuthenticationType())
+}
+
+func TestCompositeAuthAuthenticate(t *testing.T) {
+	bearer, err := NewBearerTokenAuthenticator("my-token")
+	assert.Nil(t, err)
+	gatewayKey, err := NewAPIKeyHeaderAuthenticator("my-key", "Ocp-Apim-Subscription-Key", "")
+	assert.Nil(t, err)
+	authenticator, err := NewCompositeAuthenticator(bearer, gatewayKey)
+	assert.Nil(t, err)
+
+	request, err := http.NewRequest(GET, "https://localhost/placeholder/url", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer my-token", request.Header.Get("Authorization"))
+	assert.Equal(t, "my-key", request.Header.Get("Ocp-Apim-Subscription-Key"))
+
+	// A later authenticator overrides the headers set by an earlier one.
+	basic, err := NewBasicAuthenticator("user", "password")
+	assert.Nil(t, err)
+	authenticator.Authenticators = append(authenticator.Authenticators, basic)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Basic dXNlcjpwYXNzd29yZA==", request.Header.Get("Authorization"))
+
+	// Authentication stops at the first error.
+	request, err = http.NewRequest(GET, "https://localhost/placeholder/url", nil)
+	assert.Nil(t, err)
+	authenticator.Authenticators = []Authenticator{failingAuthenticator{}, bearer}
+	err = authenticator.Authenticate(request)
+	assert.NotNil(t, err)
+	assert.Equal(t, "authentication failed", err.Error())
+	assert.Empty(t, request.Header.Get("Authorization"))
+}
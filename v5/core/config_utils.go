@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 )
 
@@ -62,7 +63,10 @@ func getServiceProperties(serviceName string) (serviceProps map[string]string, e
 	}
 
 	// First try to retrieve service properties from a credential file.
-	serviceProps = getServicePropertiesFromCredentialFile(serviceName)
+	serviceProps, err = getServicePropertiesFromCredentialFile(serviceName)
+	if err != nil {
+		return
+	}
 
 	// Next, try to retrieve them from environment variables.
 	if serviceProps == nil {
@@ -83,7 +87,10 @@ func getServiceProperties(serviceName string) (serviceProps map[string]string, e
 // 1) ${IBM_CREDENTIALS_FILE}
 // 2) <user-home-dir>/ibm-credentials.env
 // 3) <current-working-directory>/ibm-credentials.env
-func getServicePropertiesFromCredentialFile(credentialKey string) map[string]string {
+// If the service's EXPAND_REFERENCES property is "true", then the references to environment variables
+// and files in the property values are expanded (see credentialFileExpander), and an error is returned
+// if a reference can't be resolved.
+func getServicePropertiesFromCredentialFile(credentialKey string) (map[string]string, error) {
 
 	// Check the search order for the credential file that we'll attempt to load:
 	var credentialFilePath string
@@ -115,7 +122,7 @@ func getServicePropertiesFromCredentialFile(credentialKey string) map[string]str
 	if credentialFilePath != "" {
 		file, err := os.Open(credentialFilePath) // #nosec G304
 		if err != nil {
-			return nil
+			return nil, nil
 		}
 		defer file.Close() // #nosec G307
 
@@ -126,11 +133,17 @@ func getServicePropertiesFromCredentialFile(credentialKey string) map[string]str
 			lines = append(lines, scanner.Text())
 		}
 
-		// Parse the file contents into name/value pairs.
-		return parsePropertyStrings(credentialKey, lines)
+		// Parse the file contents into name/value pairs, and then expand their references if requested.
+		props := parsePropertyStrings(credentialKey, lines)
+		if expand, _ := strconv.ParseBool(props[PROPNAME_EXPAND_REFERENCES]); expand {
+			if err := newCredentialFileExpander(credentialFilePath, lines).expandProperties(credentialKey, props); err != nil {
+				return nil, err
+			}
+		}
+		return props, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
 // getServicePropertiesFromEnvironment: returns a map containing properties found within the environment
@@ -191,9 +204,7 @@ func parsePropertyStrings(credentialKey string, propertyStrings []string) map[st
 	}
 
 	props := make(map[string]string)
-	credentialKey = strings.ToUpper(credentialKey)
-	credentialKey = strings.Replace(credentialKey, "-", "_", -1)
-	credentialKey += "_"
+	credentialKey = credentialKeyPrefix(credentialKey)
 	for _, propertyString := range propertyStrings {
 
 		// Trim the property string and ignore any blank or comment lines.
@@ -222,6 +233,14 @@ func parsePropertyStrings(credentialKey string, propertyStrings []string) map[st
 	return props
 }
 
+// credentialKeyPrefix returns the prefix of the names of the properties associated with "credentialKey"
+// (e.g. "MY_SERVICE_" for "my-service").
+func credentialKeyPrefix(credentialKey string) string {
+	credentialKey = strings.ToUpper(credentialKey)
+	credentialKey = strings.Replace(credentialKey, "-", "_", -1)
+	return credentialKey + "_"
+}
+
 // Service : The service
 type service struct {
 	Name        string      `json:"name,omitempty"`
@@ -16,41 +16,59 @@ package core
 
 const (
 	// Supported authentication types.
-	AUTHTYPE_BASIC        = "basic"
-	AUTHTYPE_BEARER_TOKEN = "bearerToken"
-	AUTHTYPE_NOAUTH       = "noAuth"
-	AUTHTYPE_IAM          = "iam"
-	AUTHTYPE_CP4D         = "cp4d"
-	AUTHTYPE_CONTAINER    = "container"
-	AUTHTYPE_VPC          = "vpc"
+	AUTHTYPE_BASIC         = "basic"
+	AUTHTYPE_BEARER_TOKEN  = "bearerToken"
+	AUTHTYPE_NOAUTH        = "noAuth"
+	AUTHTYPE_IAM           = "iam"
+	AUTHTYPE_CP4D          = "cp4d"
+	AUTHTYPE_CONTAINER     = "container"
+	AUTHTYPE_VPC           = "vpc"
+	AUTHTYPE_APIKEY_HEADER = "apiKeyHeader"
+	AUTHTYPE_COMPOSITE     = "composite"
+	AUTHTYPE_IAM_ASSUME    = "iamAssume"
+	AUTHTYPE_MULTI         = "multi"
+	AUTHTYPE_IAM_MTLS      = "iamMtls"
 
 	// Names of properties that can be defined as part of an external configuration (credential file, env vars, etc.).
 	// Example:  export MYSERVICE_URL=https://myurl
 
 	// Service client properties.
-	PROPNAME_SVC_URL            = "URL"
-	PROPNAME_SVC_DISABLE_SSL    = "DISABLE_SSL"
-	PROPNAME_SVC_ENABLE_GZIP    = "ENABLE_GZIP"
-	PROPNAME_SVC_ENABLE_RETRIES = "ENABLE_RETRIES"
-	PROPNAME_SVC_MAX_RETRIES    = "MAX_RETRIES"
-	PROPNAME_SVC_RETRY_INTERVAL = "RETRY_INTERVAL"
+	PROPNAME_SVC_URL                 = "URL"
+	PROPNAME_SVC_DISABLE_SSL         = "DISABLE_SSL"
+	PROPNAME_SVC_ENABLE_GZIP         = "ENABLE_GZIP"
+	PROPNAME_SVC_ENABLE_RETRIES      = "ENABLE_RETRIES"
+	PROPNAME_SVC_MAX_RETRIES         = "MAX_RETRIES"
+	PROPNAME_SVC_RETRY_INTERVAL      = "RETRY_INTERVAL"
+	PROPNAME_SVC_API_VERSION         = "API_VERSION"
+	PROPNAME_SVC_READ_ONLY           = "READ_ONLY"
+	PROPNAME_SVC_DENIED_OPERATIONS   = "DENIED_OPERATIONS"
+	PROPNAME_SVC_HTTP_CLIENT_PROFILE = "HTTP_CLIENT_PROFILE"
 
 	// Authenticator properties.
-	PROPNAME_AUTH_TYPE        = "AUTH_TYPE"
-	PROPNAME_USERNAME         = "USERNAME"
-	PROPNAME_PASSWORD         = "PASSWORD"
-	PROPNAME_BEARER_TOKEN     = "BEARER_TOKEN"
-	PROPNAME_AUTH_URL         = "AUTH_URL"
-	PROPNAME_AUTH_DISABLE_SSL = "AUTH_DISABLE_SSL"
-	PROPNAME_APIKEY           = "APIKEY"
-	PROPNAME_REFRESH_TOKEN    = "REFRESH_TOKEN" // #nosec G101
-	PROPNAME_CLIENT_ID        = "CLIENT_ID"
-	PROPNAME_CLIENT_SECRET    = "CLIENT_SECRET"
-	PROPNAME_SCOPE            = "SCOPE"
-	PROPNAME_CRTOKEN_FILENAME = "CR_TOKEN_FILENAME" // #nosec G101
-	PROPNAME_IAM_PROFILE_CRN  = "IAM_PROFILE_CRN"
-	PROPNAME_IAM_PROFILE_NAME = "IAM_PROFILE_NAME"
-	PROPNAME_IAM_PROFILE_ID   = "IAM_PROFILE_ID"
+	PROPNAME_AUTH_TYPE            = "AUTH_TYPE"
+	PROPNAME_USERNAME             = "USERNAME"
+	PROPNAME_PASSWORD             = "PASSWORD"
+	PROPNAME_BEARER_TOKEN         = "BEARER_TOKEN"
+	PROPNAME_AUTH_URL             = "AUTH_URL"
+	PROPNAME_AUTH_DISABLE_SSL     = "AUTH_DISABLE_SSL"
+	PROPNAME_APIKEY               = "APIKEY"
+	PROPNAME_APIKEY_NAME          = "APIKEY_NAME"
+	PROPNAME_APIKEY_LOCATION      = "APIKEY_LOCATION"
+	PROPNAME_NOAUTH_ALLOWED_HOSTS = "NOAUTH_ALLOWED_HOSTS"
+	PROPNAME_REFRESH_TOKEN        = "REFRESH_TOKEN" // #nosec G101
+	PROPNAME_CLIENT_ID            = "CLIENT_ID"
+	PROPNAME_CLIENT_SECRET        = "CLIENT_SECRET"
+	PROPNAME_SCOPE                = "SCOPE"
+	PROPNAME_CRTOKEN_FILENAME     = "CR_TOKEN_FILENAME" // #nosec G101
+	PROPNAME_IAM_PROFILE_CRN      = "IAM_PROFILE_CRN"
+	PROPNAME_IAM_PROFILE_NAME     = "IAM_PROFILE_NAME"
+	PROPNAME_IAM_PROFILE_ID       = "IAM_PROFILE_ID"
+	PROPNAME_TRUSTED_PROFILE_ID   = "TRUSTED_PROFILE_ID"
+	PROPNAME_TRUSTED_PROFILE_CRN  = "TRUSTED_PROFILE_CRN"
+	PROPNAME_CLIENT_CERT_FILE     = "CLIENT_CERT_FILE"
+	PROPNAME_CLIENT_KEY_FILE      = "CLIENT_KEY_FILE"
+	PROPNAME_IAM_ENDPOINT_MODE    = "IAM_ENDPOINT_MODE"
+	PROPNAME_EXPAND_REFERENCES    = "EXPAND_REFERENCES"
 
 	// SSL error
 	SSL_CERTIFICATION_ERROR = "x509: certificate"
@@ -63,24 +81,73 @@ const (
 	ERRORMSG_ATMOST_ONE_PROP_ERROR   = "At most one of %s or %s may be specified."
 	ERRORMSG_NO_AUTHENTICATOR        = "Authentication information was not properly configured."
 	ERRORMSG_AUTHTYPE_UNKNOWN        = "Unrecognized authentication type: %s"
+	ERRORMSG_AUTHTYPE_NO_TOKENS      = "The %s authenticator doesn't obtain access tokens"
+	ERRORMSG_NO_USABLE_AUTHENTICATOR = "None of the authenticators can be used: %s"
+	ERRORMSG_CP4D_CANNOT_REFRESH     = "A new Cloud Pak for Data bearer token is needed, but the Password, APIKey and PasscodePrompt properties were not specified."
 	ERRORMSG_PROPS_MAP_NIL           = "The 'properties' map cannot be nil."
 	ERRORMSG_SSL_VERIFICATION_FAILED = "The connection failed because the SSL certificate is not valid. To use a " +
 		"self-signed certificate, disable verification of the server's SSL certificate " +
 		"by invoking the DisableSSLVerification() function on your service instance " +
 		"and/or use the DisableSSLVerification option of the authenticator."
-	ERRORMSG_AUTHENTICATE_ERROR      = "An error occurred while performing the 'authenticate' step: %s"
-	ERRORMSG_READ_RESPONSE_BODY      = "An error occurred while reading the response body: %s"
-	ERRORMSG_UNEXPECTED_RESPONSE     = "The response contained unexpected content, Content-Type=%s, operation resultType=%s"
-	ERRORMSG_UNMARSHAL_RESPONSE_BODY = "An error occurred while unmarshalling the response body: %s"
-	ERRORMSG_NIL_SLICE               = "The 'slice' parameter cannot be nil"
-	ERRORMSG_PARAM_NOT_SLICE         = "The 'slice' parameter must be a slice"
-	ERRORMSG_MARSHAL_SLICE           = "An error occurred while marshalling the slice: %s"
-	ERRORMSG_CONVERT_SLICE           = "An error occurred while converting 'slice' to string slice"
-	ERRORMSG_CREATE_RETRYABLE_REQ    = "An error occurred while creating a retryable http Request: %s"
-	ERRORMSG_UNEXPECTED_STATUS_CODE  = "Unexpected HTTP status code %d (%s)"
-	ERRORMSG_UNMARSHAL_AUTH_RESPONSE = "error unmarshalling authentication response: %s"
-	ERRORMSG_UNABLE_RETRIEVE_CRTOKEN = "unable to retrieve compute resource token value: %s"          // #nosec G101
-	ERRORMSG_IAM_GETTOKEN_ERROR      = "IAM 'get token' error, status code %d received from '%s': %s" // #nosec G101
-	ERRORMSG_UNABLE_RETRIEVE_IITOKEN = "unable to retrieve instance identity token value: %s"         // #nosec G101
-	ERRORMSG_VPCMDS_OPERATION_ERROR  = "VPC metadata service error, status code %d received from '%s': %s"
+	ERRORMSG_AUTHENTICATE_ERROR       = "An error occurred while performing the 'authenticate' step: %s"
+	ERRORMSG_READ_RESPONSE_BODY       = "An error occurred while reading the response body: %s"
+	ERRORMSG_COPY_RESPONSE_BODY       = "An error occurred while copying the response body: %s"
+	ERRORMSG_CHECKSUM_ALGORITHM       = "Unsupported checksum algorithm: '%s'"
+	ERRORMSG_API_VERSION_UNSUPPORTED  = "API version %d is not supported; the supported versions are %v"
+	ERRORMSG_API_VERSION_NEGOTIATION  = "None of the supported API versions %v is available at '%s'"
+	ERRORMSG_MULTIPART_PART           = "Unable to upload part %d: %s"
+	ERRORMSG_STREAM_CONTENT_TYPE      = "No stream decoder is registered for Content-Type '%s'"
+	ERRORMSG_STREAM_RESULT_TYPE       = "A %s row cannot be decoded into a value of type %s"
+	ERRORMSG_STREAM_DECODE            = "An error occurred while decoding %s row %d: %s"
+	ERRORMSG_CREDENTIALS_READ         = "Unable to read the %s from '%s': %s"
+	ERRORMSG_OPERATION_DENIED         = "The operation '%s %s' is not permitted (%s)"
+	ERRORMSG_JSON_LIMIT_EXCEEDED      = "The JSON response body exceeds the maximum %s (%d)"
+	ERRORMSG_DURATION_INVALID         = "'%s' is not a valid ISO 8601 duration"
+	ERRORMSG_DURATION_CALENDAR        = "The ISO 8601 duration '%s' contains years or months, so it has no fixed length"
+	ERRORMSG_DURATION_OVERFLOW        = "The ISO 8601 duration '%s' is too long to be represented as a time.Duration"
+	ERRORMSG_INTERVAL_INVALID         = "'%s' is not a valid ISO 8601 time interval: %s"
+	ERRORMSG_ENUM_VALUE_UNKNOWN       = "'%s' is not a valid value for '%s' (expected one of %v)"
+	ERRORMSG_TOKEN_SOURCE_UNSUPPORTED = "The authenticator of type '%s' does not supply bearer tokens"
+	ERRORMSG_UNEXPECTED_RESPONSE      = "The response contained unexpected content, Content-Type=%s, operation resultType=%s"
+	ERRORMSG_UNMARSHAL_RESPONSE_BODY  = "An error occurred while unmarshalling the response body: %s"
+	ERRORMSG_RESPONSE_TRANSFORM       = "An error occurred while transforming the response: %s"
+	ERRORMSG_RESPONSE_VALIDATION      = "The response body does not conform to its schema: %s"
+	ERRORMSG_RANGE_INVALID            = "Invalid '%s' header value: '%s'"
+	ERRORMSG_DOWNLOAD_NOT_RESUMABLE   = "Unable to resume the download: status code %d received (the object may have changed)"
+	ERRORMSG_MULTI_STATUS_BODY        = "An error occurred while parsing the multi-status response body: %s"
+	ERRORMSG_CACHE_ENTRY_CORRUPT      = "The response cache entry '%s' is corrupt and has been removed"
+	ERRORMSG_JOB_NO_STATUS            = "No status was returned for job '%s'"
+	ERRORMSG_JOB_CANCEL_UNSUPPORTED   = "Job '%s' cannot be cancelled"
+	ERRORMSG_ENDPOINT_NOT_FOUND       = "No %s endpoint was found in region '%s' for service '%s'"
+	ERRORMSG_CP4D_APIKEY_UNSUPPORTED  = "Cloud Pak for Data version %s does not support apikey authentication; a password is required"
+	ERRORMSG_NIL_SLICE                = "The 'slice' parameter cannot be nil"
+	ERRORMSG_PARAM_NOT_SLICE          = "The 'slice' parameter must be a slice"
+	ERRORMSG_MARSHAL_SLICE            = "An error occurred while marshalling the slice: %s"
+	ERRORMSG_CONVERT_SLICE            = "An error occurred while converting 'slice' to string slice"
+	ERRORMSG_CREATE_RETRYABLE_REQ     = "An error occurred while creating a retryable http Request: %s"
+	ERRORMSG_UNEXPECTED_STATUS_CODE   = "Unexpected HTTP status code %d (%s)"
+	ERRORMSG_UNMARSHAL_AUTH_RESPONSE  = "error unmarshalling authentication response: %s"
+	ERRORMSG_UNABLE_RETRIEVE_CRTOKEN  = "unable to retrieve compute resource token value: %s"          // #nosec G101
+	ERRORMSG_IAM_GETTOKEN_ERROR       = "IAM 'get token' error, status code %d received from '%s': %s" // #nosec G101
+	ERRORMSG_UNABLE_RETRIEVE_IITOKEN  = "unable to retrieve instance identity token value: %s"         // #nosec G101
+	ERRORMSG_VPCMDS_OPERATION_ERROR   = "VPC metadata service error, status code %d received from '%s': %s"
+	ERRORMSG_TOKEN_CLAIMS_INVALID     = "Unable to validate the claims of the access token: %s"                                       // #nosec G101
+	ERRORMSG_TOKEN_ISSUER_MISMATCH    = "The access token was issued by '%s' rather than the expected issuer '%s'"                    // #nosec G101
+	ERRORMSG_TOKEN_AUDIENCE_MISMATCH  = "The audience of the access token ('%s') does not include the expected audience '%s'"         // #nosec G101
+	ERRORMSG_TOKEN_TTL_TOO_SHORT      = "The remaining lifetime of the new access token (%s) is less than the requested minimum (%s)" // #nosec G101
+	ERRORMSG_TOKEN_INVALID            = "The access token is invalid: %s"                                                             // #nosec G101
+	ERRORMSG_JWKS_ERROR               = "Unable to obtain the token signing keys from '%s': %s"                                       // #nosec G101
+	ERRORMSG_URL_OVERRIDE_INVALID     = "The service URL override '%s' is invalid: %s"
+	ERRORMSG_URL_OVERRIDE_NOT_ALLOWED = "The host '%s' of the service URL override is not in the service's allowed hosts"
+	ERRORMSG_NOAUTH_HOST_NOT_ALLOWED  = "Unauthenticated requests (NoAuthAuthenticator) to host '%s' are not allowed"
+	ERRORMSG_HTTP_CLIENT_PROFILE      = "Unrecognized HTTP client profile: '%s'"
+	ERRORMSG_IAM_SESSION_INVALID      = "The IAM session is invalid: %s"
+	ERRORMSG_IAM_ENDPOINT_MISMATCH    = "The IAM URL '%s' (%s environment) and the service URL '%s' (%s environment) are in different IAM environments"
+	ERRORMSG_PANIC_RECOVERED          = "A panic occurred in the %s: %v"
+	ERRORMSG_AUTHENTICATOR_CLOSED     = "The authenticator is closed"
+	ERRORMSG_UNABLE_LOAD_CLIENT_CERT  = "Unable to load the client certificate: %s"
+	ERRORMSG_READ_BUFFER_TRANSPORT    = "The read buffer size can't be set for the http client's transport (%T)"
+	ERRORMSG_CREDENTIAL_REFERENCE     = "The credential file property '%s' contains an invalid reference: %s"
+	ERRORMSG_IAM_ENDPOINT_MODE        = "'%s' is not a valid IAM endpoint mode (expected 'public', 'private' or 'regional:<region>')"
+	ERRORMSG_PROP_UNSUPPORTED         = "The %s authenticator does not support the %s property"
 )
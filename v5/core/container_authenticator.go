@@ -16,6 +16,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -84,11 +85,21 @@ type ContainerAuthenticator struct {
 	// If not specified by the user, a suitable default Client will be constructed.
 	Client *http.Client
 
+	// [optional] The options that control how access tokens are obtained, validated, cached and
+	// refreshed (see TokenManagementOptions).
+	TokenManagementOptions
+
 	// The cached IAM access token and its expiration time.
 	tokenData *iamTokenData
 
 	// Mutex to synchronize access to the tokenData field.
 	tokenDataMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
 }
 
 const (
@@ -96,8 +107,6 @@ const (
 	iamGrantTypeCRToken    = "urn:ibm:params:oauth:grant-type:cr-token" // #nosec G101
 )
 
-var craRequestTokenMutex sync.Mutex
-
 // ContainerAuthenticatorBuilder is used to construct an instance of the ContainerAuthenticator
 type ContainerAuthenticatorBuilder struct {
 	ContainerAuthenticator
@@ -164,6 +173,12 @@ func (builder *ContainerAuthenticatorBuilder) SetClient(client *http.Client) *Co
 	return builder
 }
 
+// SetTokenManagementOptions sets the TokenManagementOptions field in the builder.
+func (builder *ContainerAuthenticatorBuilder) SetTokenManagementOptions(options TokenManagementOptions) *ContainerAuthenticatorBuilder {
+	builder.ContainerAuthenticator.TokenManagementOptions = options
+	return builder
+}
+
 // Build() returns a validated instance of the ContainerAuthenticator with the config that was set in the builder.
 func (builder *ContainerAuthenticatorBuilder) Build() (*ContainerAuthenticator, error) {
 
@@ -214,12 +229,12 @@ func (*ContainerAuthenticator) AuthenticationType() string {
 // 		Authorization: Bearer <access-token>
 //
 func (authenticator *ContainerAuthenticator) Authenticate(request *http.Request) error {
-	token, err := authenticator.GetToken()
+	token, err := authenticator.GetTokenWithContext(request.Context())
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("Authorization", "Bearer "+token)
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
 	return nil
 }
 
@@ -239,6 +254,20 @@ func (authenticator *ContainerAuthenticator) setTokenData(tokenData *iamTokenDat
 	authenticator.tokenData = tokenData
 }
 
+// InvalidateToken discards the cached access token (if any), so that a new
+// access token is fetched the next time that the authenticator is used.
+func (authenticator *ContainerAuthenticator) InvalidateToken() {
+	authenticator.setTokenData(nil)
+	deleteCachedIamToken(authenticator.TokenCache, authenticator.tokenCacheKey())
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *ContainerAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
 // Validate the authenticator's configuration.
 //
 // Ensures that one of IAMProfileName or IAMProfileID are specified, and the ClientId and ClientSecret pair are
@@ -271,66 +300,70 @@ func (authenticator *ContainerAuthenticator) Validate() error {
 // Whenever a new token is needed (when a token doesn't yet exist or the existing token has expired),
 // a new access token is fetched from the token server.
 func (authenticator *ContainerAuthenticator) GetToken() (string, error) {
-	if authenticator.getTokenData() == nil || !authenticator.getTokenData().isTokenValid() {
-		GetLogger().Debug("Performing synchronous token fetch...")
-		// synchronously request the token
-		err := authenticator.synchronizedRequestToken()
-		if err != nil {
-			return "", err
-		}
-	} else if authenticator.getTokenData().needsRefresh() {
-		GetLogger().Debug("Performing background asynchronous token fetch...")
-		// If refresh needed, kick off a go routine in the background to get a new token
-		//nolint: errcheck
-		go authenticator.invokeRequestTokenData()
-	} else {
-		GetLogger().Debug("Using cached access token...")
-	}
-
-	// return an error if the access token is not valid or was not fetched
-	if authenticator.getTokenData() == nil || authenticator.getTokenData().AccessToken == "" {
-		return "", fmt.Errorf("Error while trying to get access token")
-	}
+	return authenticator.GetTokenWithContext(context.Background())
+}
 
-	return authenticator.getTokenData().AccessToken, nil
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *ContainerAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
 }
 
-// synchronizedRequestToken will check if the authenticator currently has
-// a valid cached access token.
-// If yes, then nothing else needs to be done.
-// If no, then a blocking request is made to obtain a new IAM access token.
-func (authenticator *ContainerAuthenticator) synchronizedRequestToken() error {
-	craRequestTokenMutex.Lock()
-	defer craRequestTokenMutex.Unlock()
-	// if cached token is still valid, then just continue to use it
-	if authenticator.getTokenData() != nil && authenticator.getTokenData().isTokenValid() {
-		return nil
-	}
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *ContainerAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
 
-	return authenticator.invokeRequestTokenData()
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *ContainerAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
 }
 
-// invokeRequestTokenData requests a new token from the IAM token server and
-// unmarshals the response to produce the authenticator's 'tokenData' field (cache).
-// Returns an error if the token was unable to be fetched, otherwise returns nil.
-func (authenticator *ContainerAuthenticator) invokeRequestTokenData() error {
-	tokenResponse, err := authenticator.RequestToken()
-	if err != nil {
-		return err
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+func (authenticator *ContainerAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_CONTAINER,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
 	}
+}
 
-	if tokenData, err := newIamTokenData(tokenResponse); err != nil {
+// fetchTokenData requests a new token from the IAM token server (unless the TokenCache holds
+// a token that can still be used) and stores it in the authenticator's 'tokenData' field (cache).
+func (authenticator *ContainerAuthenticator) fetchTokenData(ctx context.Context) error {
+	tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKey(), authenticator.requestToken)
+	if err != nil {
 		return err
-	} else {
-		authenticator.setTokenData(tokenData)
 	}
 
+	authenticator.setTokenData(tokenData)
+	store()
 	return nil
 }
 
+// tokenCacheKey returns the key under which the authenticator's tokens are cached, or ""
+// if there is no TokenCache. The key is derived from the token server URL, the CR token file,
+// the trusted profile, the client id and the scope.
+func (authenticator *ContainerAuthenticator) tokenCacheKey() string {
+	return newTokenCacheKey(authenticator.TokenCache, AUTHTYPE_CONTAINER, authenticator.URL, authenticator.CRTokenFilename,
+		authenticator.IAMProfileName, authenticator.IAMProfileID, authenticator.ClientID, authenticator.Scope)
+}
+
 // RequestToken first retrieves a CR token value from the current compute resource, then uses
 // that to obtain a new IAM access token from the IAM token server.
 func (authenticator *ContainerAuthenticator) RequestToken() (*IamTokenServerResponse, error) {
+	return authenticator.requestToken(context.Background())
+}
+
+// requestToken is like RequestToken(), but the token request is abandoned if "ctx" is done.
+func (authenticator *ContainerAuthenticator) requestToken(ctx context.Context) (*IamTokenServerResponse, error) {
 	var err error
 	var operationPath string = "/identity/token"
 
@@ -353,7 +386,7 @@ func (authenticator *ContainerAuthenticator) RequestToken() (*IamTokenServerResp
 	}
 
 	// Set up the request for the IAM "get token" invocation.
-	builder := NewRequestBuilder(POST)
+	builder := NewRequestBuilder(POST).WithContext(ctx)
 	_, err = builder.ResolveRequestURL(url, operationPath, nil)
 	if err != nil {
 		return nil, NewAuthenticationError(&DetailedResponse{}, err)
@@ -426,6 +459,7 @@ func (authenticator *ContainerAuthenticator) RequestToken() (*IamTokenServerResp
 	if err != nil {
 		return nil, NewAuthenticationError(&DetailedResponse{}, err)
 	}
+
 	GetLogger().Debug("Returned from IAM 'get token' operation, received status code %d", resp.StatusCode)
 
 	// If debug is enabled, then dump the response.
@@ -460,7 +494,7 @@ func (authenticator *ContainerAuthenticator) RequestToken() (*IamTokenServerResp
 	}
 
 	// Good response, so unmarshal the response body into an IamTokenServerResponse instance.
-	tokenResponse := &IamTokenServerResponse{}
+	tokenResponse := &IamTokenServerResponse{clockSkew: measureClockSkew(resp.Header)}
 	_ = json.NewDecoder(resp.Body).Decode(tokenResponse)
 	defer resp.Body.Close()
 
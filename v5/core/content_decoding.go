@@ -0,0 +1,105 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// contentDecoders are the functions that construct a reader that decodes a body with
+// a given Content-Encoding (in lower case), e.g. "gzip".
+var contentDecoders = map[string]func(io.Reader) (io.Reader, error){
+	"gzip":    NewGzipDecompressionReader,
+	"x-gzip":  NewGzipDecompressionReader,
+	"deflate": newDeflateReader,
+}
+var contentDecodersMutex sync.RWMutex
+
+// RegisterContentDecoder registers "newReader" as the function that constructs a reader that decodes
+// a response body with the Content-Encoding "encoding" (e.g. "zstd" or "br", for which the Go standard
+// library has no decoder), replacing the decoder (if any) registered for the encoding.
+// The gzip and deflate encodings are supported by default.
+func RegisterContentDecoder(encoding string, newReader func(io.Reader) (io.Reader, error)) error {
+	if encoding == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "encoding")
+	}
+	if newReader == nil {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "newReader")
+	}
+
+	contentDecodersMutex.Lock()
+	defer contentDecodersMutex.Unlock()
+
+	contentDecoders[strings.ToLower(encoding)] = newReader
+	return nil
+}
+
+// getContentDecoder returns the decoder registered for "encoding", or nil.
+func getContentDecoder(encoding string) func(io.Reader) (io.Reader, error) {
+	contentDecodersMutex.RLock()
+	defer contentDecodersMutex.RUnlock()
+
+	return contentDecoders[strings.ToLower(strings.TrimSpace(encoding))]
+}
+
+// NewContentDecodingTransform returns a ResponseTransform that decodes response bodies whose
+// "Content-Encoding" header specifies an encoding with a registered decoder (see RegisterContentDecoder()),
+// e.g. for a service that compresses its responses even though the Go transport didn't ask it to.
+// BaseService.Request() always decodes error response bodies in this way (after any transforms
+// added via AddResponseTransform()), so that the error message isn't garbled.
+func NewContentDecodingTransform() ResponseTransform {
+	return decodeResponseContent
+}
+
+// decodeResponseContent decodes the body of "response" with the decoder registered for its
+// Content-Encoding, if any.
+func decodeResponseContent(response *http.Response) error {
+	if response.Body == nil {
+		return nil
+	}
+	encoding := response.Header.Get(CONTENT_ENCODING)
+	if encoding == "" {
+		return nil
+	}
+	newReader := getContentDecoder(encoding)
+	if newReader == nil {
+		GetLogger().Debug("No decoder is registered for the Content-Encoding '%s'", encoding)
+		return nil
+	}
+	return NewContentEncodingTransform(encoding, newReader)(response)
+}
+
+// newDeflateReader returns a reader that decodes a "deflate" body, which should be a zlib stream
+// (RFC 1950), but is a raw deflate stream (RFC 1951) when sent by some servers.
+func newDeflateReader(compressedReader io.Reader) (io.Reader, error) {
+	bufferedReader := bufio.NewReader(compressedReader)
+	header, err := bufferedReader.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// A zlib stream starts with a CMF byte whose method is "deflate" (8), followed by
+	// a FLG byte such that the two bytes are a multiple of 31.
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(bufferedReader)
+	}
+	return flate.NewReader(bufferedReader), nil
+}
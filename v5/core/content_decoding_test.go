@@ -0,0 +1,203 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const contentDecodingTestErrorBody = `{"errors":[{"message":"The resource was not found"}],"trace":"abc"}`
+
+// encodeZstdRawFrame returns a zstd frame (RFC 8878) that contains "content" in a single raw block.
+func encodeZstdRawFrame(content []byte) []byte {
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xe0} // magic number, and Frame_Header_Descriptor (single segment, 8-byte size)
+	frame = append(frame, make([]byte, 8)...)
+	binary.LittleEndian.PutUint64(frame[5:], uint64(len(content)))
+	blockHeader := uint32(1 | len(content)<<3) // last block, raw
+	frame = append(frame, byte(blockHeader), byte(blockHeader>>8), byte(blockHeader>>16))
+	return append(frame, content...)
+}
+
+// newZstdRawFrameReader decodes zstd frames that contain only raw and RLE blocks,
+// which is all that the tests need.
+func newZstdRawFrameReader(compressedReader io.Reader) (io.Reader, error) {
+	frame, err := ioutil.ReadAll(compressedReader)
+	if err != nil {
+		return nil, err
+	}
+	if len(frame) < 5 || binary.LittleEndian.Uint32(frame) != 0xfd2fb528 {
+		return nil, errors.New("not a zstd frame")
+	}
+	descriptor := frame[4]
+	pos := 5
+	if descriptor&0x20 == 0 {
+		pos++ // Window_Descriptor
+	}
+	pos += []int{0, 1, 2, 4}[descriptor&0x03]
+	fcsSizes := []int{0, 2, 4, 8}
+	if descriptor>>6 == 0 && descriptor&0x20 != 0 {
+		pos++
+	} else {
+		pos += fcsSizes[descriptor>>6]
+	}
+
+	var content bytes.Buffer
+	for last := false; !last; {
+		if pos+3 > len(frame) {
+			return nil, errors.New("truncated zstd frame")
+		}
+		header := uint32(frame[pos]) | uint32(frame[pos+1])<<8 | uint32(frame[pos+2])<<16
+		pos += 3
+		last = header&1 != 0
+		size := int(header >> 3)
+		switch (header >> 1) & 3 {
+		case 0:
+			content.Write(frame[pos : pos+size])
+			pos += size
+		case 1:
+			content.Write(bytes.Repeat(frame[pos:pos+1], size))
+			pos++
+		default:
+			return nil, errors.New("compressed zstd blocks aren't supported")
+		}
+	}
+	return &content, nil
+}
+
+func compressTestBody(t *testing.T, encoding string, body string) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buf)
+	case "deflate":
+		writer = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		var err error
+		writer, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		assert.Nil(t, err)
+	case "zstd":
+		return encodeZstdRawFrame([]byte(body))
+	default:
+		return []byte(body)
+	}
+	_, err := writer.Write([]byte(body))
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func newContentDecodingTestService(t *testing.T, encoding string, statusCode int, body []byte) (*BaseService, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if encoding == "raw-deflate" {
+			w.Header().Set("Content-Encoding", "deflate")
+		} else {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(body)
+	}))
+	return newNoAuthTestService(t, server.URL), server
+}
+
+func newContentDecodingTestRequest(t *testing.T, serverURL string) *http.Request {
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(serverURL, "", nil)
+	assert.Nil(t, err)
+	// Ask for the encoding explicitly, so that the Go transport doesn't decode gzip bodies itself.
+	builder.AddHeader("Accept-Encoding", "gzip, deflate, zstd")
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestErrorResponseContentDecoding(t *testing.T) {
+	assert.Nil(t, RegisterContentDecoder("zstd", newZstdRawFrameReader))
+	defer func() {
+		contentDecodersMutex.Lock()
+		delete(contentDecoders, "zstd")
+		contentDecodersMutex.Unlock()
+	}()
+
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "zstd"} {
+		service, server := newContentDecodingTestService(t, encoding, http.StatusNotFound,
+			compressTestBody(t, encoding, contentDecodingTestErrorBody))
+
+		detailedResponse, err := service.Request(newContentDecodingTestRequest(t, server.URL), nil)
+		assert.NotNil(t, err, encoding)
+		assert.Equal(t, "The resource was not found", err.Error(), encoding)
+		assert.Equal(t, http.StatusNotFound, detailedResponse.StatusCode)
+		result, ok := detailedResponse.GetResultAsMap()
+		assert.True(t, ok, encoding)
+		assert.Equal(t, "abc", result["trace"], encoding)
+		assert.Empty(t, detailedResponse.Headers.Get("Content-Encoding"), encoding)
+		server.Close()
+	}
+}
+
+func TestErrorResponseContentDecodingFailures(t *testing.T) {
+	// A body with an unknown encoding is left as is.
+	service, server := newContentDecodingTestService(t, "br", http.StatusBadRequest, []byte("\x1b\x03garbage"))
+	detailedResponse, err := service.Request(newContentDecodingTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusText(http.StatusBadRequest), err.Error())
+	assert.Equal(t, []byte("\x1b\x03garbage"), detailedResponse.RawResult)
+	assert.Equal(t, "br", detailedResponse.Headers.Get("Content-Encoding"))
+	server.Close()
+
+	// A body that can't be decoded results in a generic error.
+	service, server = newContentDecodingTestService(t, "gzip", http.StatusInternalServerError, []byte("not gzip"))
+	detailedResponse, err = service.Request(newContentDecodingTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), err.Error())
+	assert.Equal(t, http.StatusInternalServerError, detailedResponse.StatusCode)
+	assert.Nil(t, detailedResponse.RawResult)
+	server.Close()
+
+	assert.NotNil(t, RegisterContentDecoder("", newZstdRawFrameReader))
+	assert.NotNil(t, RegisterContentDecoder("zstd", nil))
+}
+
+func TestSuccessResponseContentDecoding(t *testing.T) {
+	service, server := newContentDecodingTestService(t, "deflate", http.StatusOK,
+		compressTestBody(t, "deflate", `{"name": "wonder woman"}`))
+	defer server.Close()
+
+	// Success response bodies are decoded if the transform is added.
+	var foo *Foo
+	_, err := service.Request(newContentDecodingTestRequest(t, server.URL), &foo)
+	assert.NotNil(t, err)
+
+	service.AddResponseTransform(NewContentDecodingTransform())
+	_, err = service.Request(newContentDecodingTestRequest(t, server.URL), &foo)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *foo.Name)
+}
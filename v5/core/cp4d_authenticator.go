@@ -16,6 +16,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -27,8 +28,9 @@ import (
 )
 
 //
-// CloudPakForDataAuthenticator uses either a username/password pair or a
-// username/apikey pair to obtain a suitable bearer token from the CP4D authentication service,
+// CloudPakForDataAuthenticator uses either a username/password pair, a username/apikey pair
+// or a username/one-time passcode pair to obtain a suitable bearer token from the CP4D authentication
+// service (or uses a bearer token that was obtained elsewhere, until it expires),
 // and adds the bearer token to requests via an Authorization header of the form:
 //
 // 		Authorization: Bearer <bearer-token>
@@ -48,6 +50,24 @@ type CloudPakForDataAuthenticator struct {
 	// One of Password or APIKey must be specified.
 	APIKey string
 
+	// Supplies the username and password (or, if the password is empty, the apikey)
+	// for each token fetch, instead of Username, Password and APIKey [optional].
+	CredentialsProvider CredentialsProvider
+
+	// A one-time passcode used (once) with Username to obtain a bearer token, instead of
+	// Password or APIKey [optional].
+	Passcode string
+
+	// Invoked to obtain a new one-time passcode (e.g. by prompting the user) when a new bearer token
+	// is needed but can't be obtained otherwise, e.g. when the bearer token obtained with Passcode
+	// expires [optional]. It is specified instead of (or along with) Passcode.
+	PasscodePrompt func(ctx context.Context) (string, error)
+
+	// A bearer token obtained elsewhere (e.g. from the Cloud Pak for Data web client) that is used
+	// until it expires, before any other credentials are used [optional]. If no other credentials
+	// are specified, then Username isn't required.
+	BearerToken string
+
 	// A flag that indicates whether verification of the server's SSL certificate
 	// should be disabled; defaults to false [optional].
 	DisableSSLVerification bool
@@ -59,14 +79,27 @@ type CloudPakForDataAuthenticator struct {
 	// not specified, a suitable default Client will be constructed.
 	Client *http.Client
 
+	// The options that control how bearer tokens are obtained, validated and refreshed
+	// (see TokenManagementOptions); the TokenCache is not supported [optional].
+	TokenManagementOptions
+
 	// The cached token and expiration time.
 	tokenData *cp4dTokenData
 
 	// Mutex to make the tokenData field thread safe.
 	tokenDataMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
+
+	// Indicate whether Passcode and BearerToken were used (guarded by tokenDataMutex).
+	passcodeUsed    bool
+	bearerTokenUsed bool
 }
 
-var cp4dRequestTokenMutex sync.Mutex
 var cp4dNeedsRefreshMutex sync.Mutex
 
 // NewCloudPakForDataAuthenticator constructs a new CloudPakForDataAuthenticator
@@ -124,9 +157,18 @@ func newCloudPakForDataAuthenticatorFromMap(properties map[string]string) (*Clou
 		disableSSL = false
 	}
 
-	return newAuthenticator(properties[PROPNAME_AUTH_URL],
-		properties[PROPNAME_USERNAME], properties[PROPNAME_PASSWORD],
-		properties[PROPNAME_APIKEY], disableSSL, nil)
+	authenticator := &CloudPakForDataAuthenticator{
+		Username:               properties[PROPNAME_USERNAME],
+		Password:               properties[PROPNAME_PASSWORD],
+		APIKey:                 properties[PROPNAME_APIKEY],
+		BearerToken:            properties[PROPNAME_BEARER_TOKEN],
+		URL:                    properties[PROPNAME_AUTH_URL],
+		DisableSSLVerification: disableSSL,
+	}
+	if err = authenticator.Validate(); err != nil {
+		return nil, err
+	}
+	return authenticator, nil
 }
 
 // AuthenticationType returns the authentication type for this authenticator.
@@ -140,20 +182,35 @@ func (*CloudPakForDataAuthenticator) AuthenticationType() string {
 // they do not contain invalid characters.
 func (authenticator *CloudPakForDataAuthenticator) Validate() error {
 
-	if authenticator.Username == "" {
-		return fmt.Errorf(ERRORMSG_PROP_MISSING, "Username")
-	}
+	// The credentials are obtained from the CredentialsProvider (if specified) for each token fetch.
+	if authenticator.CredentialsProvider == nil {
+		hasPassword := authenticator.APIKey != "" || authenticator.Password != ""
+		hasPasscode := authenticator.Passcode != "" || authenticator.PasscodePrompt != nil
+
+		// A bearer token can be used without a username (until it expires).
+		if authenticator.Username == "" && (hasPassword || hasPasscode || authenticator.BearerToken == "") {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "Username")
+		}
 
-	// The user should specify exactly one of APIKey or Password.
-	if (authenticator.APIKey == "" && authenticator.Password == "") ||
-		(authenticator.APIKey != "" && authenticator.Password != "") {
-		return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "APIKey", "Password")
+		// The user should specify exactly one of APIKey or Password, unless a passcode
+		// or bearer token is used instead.
+		if (!hasPassword && !hasPasscode && authenticator.BearerToken == "") ||
+			(authenticator.APIKey != "" && authenticator.Password != "") {
+			return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "APIKey", "Password")
+		}
+		if hasPassword && hasPasscode {
+			return fmt.Errorf(ERRORMSG_ATMOST_ONE_PROP_ERROR, "APIKey/Password", "Passcode")
+		}
 	}
 
 	if authenticator.URL == "" {
 		return fmt.Errorf(ERRORMSG_PROP_MISSING, "URL")
 	}
 
+	if authenticator.TokenCache != nil {
+		return fmt.Errorf(ERRORMSG_PROP_UNSUPPORTED, AUTHTYPE_CP4D, "TokenCache")
+	}
+
 	return nil
 }
 
@@ -165,12 +222,12 @@ func (authenticator *CloudPakForDataAuthenticator) Validate() error {
 // 		Authorization: Bearer <bearer-token>
 //
 func (authenticator *CloudPakForDataAuthenticator) Authenticate(request *http.Request) error {
-	token, err := authenticator.GetToken()
+	token, err := authenticator.GetTokenWithContext(request.Context())
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("Authorization", fmt.Sprintf(`Bearer %s`, token))
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
 	return nil
 }
 
@@ -190,54 +247,83 @@ func (authenticator *CloudPakForDataAuthenticator) setTokenData(tokenData *cp4dT
 	authenticator.tokenData = tokenData
 }
 
+// InvalidateToken discards the cached access token (if any), so that a new
+// access token is fetched the next time that the authenticator is used.
+func (authenticator *CloudPakForDataAuthenticator) InvalidateToken() {
+	authenticator.setTokenData(nil)
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *CloudPakForDataAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
 // GetToken: returns an access token to be used in an Authorization header.
 // Whenever a new token is needed (when a token doesn't yet exist, needs to be refreshed,
 // or the existing token has expired), a new access token is fetched from the token server.
 func (authenticator *CloudPakForDataAuthenticator) GetToken() (string, error) {
-	if authenticator.getTokenData() == nil || !authenticator.getTokenData().isTokenValid() {
-		// synchronously request the token
-		err := authenticator.synchronizedRequestToken()
-		if err != nil {
-			return "", err
-		}
-	} else if authenticator.getTokenData().needsRefresh() {
-		// If refresh needed, kick off a go routine in the background to get a new token
-		//nolint: errcheck
-		go authenticator.invokeRequestTokenData()
-	}
+	return authenticator.GetTokenWithContext(context.Background())
+}
 
-	// return an error if the access token is not valid or was not fetched
-	if authenticator.getTokenData() == nil || authenticator.getTokenData().AccessToken == "" {
-		return "", fmt.Errorf("Error while trying to get access token")
-	}
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *CloudPakForDataAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
+}
 
-	return authenticator.getTokenData().AccessToken, nil
+// canRefreshSilently returns true iff the authenticator can obtain a new access token without
+// a one-time passcode, in which case the token is refreshed in the background before it expires.
+// Otherwise, the token is used until it expires, so that PasscodePrompt is invoked only when
+// a new token is actually needed (and never by a background goroutine).
+func (authenticator *CloudPakForDataAuthenticator) canRefreshSilently() bool {
+	return authenticator.CredentialsProvider != nil || authenticator.Password != "" || authenticator.APIKey != ""
 }
 
-// synchronizedRequestToken: synchronously checks if the current token in cache
-// is valid. If token is not valid or does not exist, it will fetch a new token
-// and set the tokenRefreshTime
-func (authenticator *CloudPakForDataAuthenticator) synchronizedRequestToken() error {
-	cp4dRequestTokenMutex.Lock()
-	defer cp4dRequestTokenMutex.Unlock()
-	// if cached token is still valid, then just continue to use it
-	if authenticator.getTokenData() != nil && authenticator.getTokenData().isTokenValid() {
-		return nil
-	}
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *CloudPakForDataAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
+
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *CloudPakForDataAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
+}
 
-	return authenticator.invokeRequestTokenData()
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+// The token is refreshed in the background only if that doesn't require a passcode.
+func (authenticator *CloudPakForDataAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_CP4D,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
+		canRefresh:             authenticator.canRefreshSilently,
+	}
 }
 
-// invokeRequestTokenData: requests a new token from the token server and
-// unmarshals the token information to the tokenData cache. Returns
-// an error if the token was unable to be fetched, otherwise returns nil
-func (authenticator *CloudPakForDataAuthenticator) invokeRequestTokenData() error {
-	tokenResponse, err := authenticator.requestToken()
+// fetchTokenData requests a new token from the token server and
+// unmarshals the response to produce the authenticator's 'tokenData' field (cache).
+// Returns an error if the token was unable to be fetched, otherwise returns nil.
+func (authenticator *CloudPakForDataAuthenticator) fetchTokenData(ctx context.Context) error {
+	tokenResponse, err := authenticator.requestToken(ctx)
 	if err != nil {
 		authenticator.setTokenData(nil)
 		return err
 	}
 
+	if err := authenticator.validateToken(ctx, tokenResponse.Token, tokenResponse.clockSkew); err != nil {
+		authenticator.setTokenData(nil)
+		return err
+	}
+
 	if tokenData, err := newCp4dTokenData(tokenResponse); err != nil {
 		authenticator.setTokenData(nil)
 		return err
@@ -255,10 +341,82 @@ type cp4dRequestBody struct {
 	Username string `json:"username"`
 	Password string `json:"password,omitempty"`
 	APIKey   string `json:"api_key,omitempty"`
+	Passcode string `json:"passcode,omitempty"`
+}
+
+// newCp4dRequestBody returns a request body containing the current credentials supplied by "provider".
+func newCp4dRequestBody(provider CredentialsProvider) (*cp4dRequestBody, error) {
+	username, password, err := provider.GetUsernamePassword()
+	if err != nil {
+		return nil, err
+	}
+	if username == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "Username")
+	}
+	body := &cp4dRequestBody{
+		Username: username,
+		Password: password,
+	}
+	if password == "" {
+		if body.APIKey, err = provider.GetAPIKey(); err != nil {
+			return nil, err
+		}
+		if body.APIKey == "" {
+			return nil, fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "APIKey", "Password")
+		}
+	}
+	return body, nil
+}
+
+// takeBearerToken returns the BearerToken (once), unless it has expired or isn't a valid JWT.
+func (authenticator *CloudPakForDataAuthenticator) takeBearerToken() string {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	if authenticator.BearerToken == "" || authenticator.bearerTokenUsed {
+		return ""
+	}
+	authenticator.bearerTokenUsed = true
+
+	claims, err := parseJWT(authenticator.BearerToken)
+	if err != nil || claims.ExpiresAt <= GetCurrentTime() {
+		GetLogger().Debug("Ignoring the CP4D bearer token, which is invalid or has expired")
+		return ""
+	}
+	return authenticator.BearerToken
+}
+
+// nextPasscode returns the Passcode (once) or, after it was used, a new passcode obtained from PasscodePrompt.
+func (authenticator *CloudPakForDataAuthenticator) nextPasscode(ctx context.Context) (string, error) {
+	authenticator.tokenDataMutex.Lock()
+	if authenticator.Passcode != "" && !authenticator.passcodeUsed {
+		authenticator.passcodeUsed = true
+		authenticator.tokenDataMutex.Unlock()
+		return authenticator.Passcode, nil
+	}
+	authenticator.tokenDataMutex.Unlock()
+
+	if authenticator.PasscodePrompt == nil {
+		return "", fmt.Errorf(ERRORMSG_CP4D_CANNOT_REFRESH)
+	}
+	passcode, err := authenticator.PasscodePrompt(ctx)
+	if err != nil {
+		return "", err
+	}
+	if passcode == "" {
+		return "", fmt.Errorf(ERRORMSG_PROP_MISSING, "Passcode")
+	}
+	return passcode, nil
 }
 
 // requestToken: fetches a new access token from the token server.
-func (authenticator *CloudPakForDataAuthenticator) requestToken() (tokenResponse *cp4dTokenServerResponse, err error) {
+func (authenticator *CloudPakForDataAuthenticator) requestToken(ctx context.Context) (tokenResponse *cp4dTokenServerResponse, err error) {
+
+	// Use the bearer token obtained elsewhere (if any) until it expires.
+	if bearerToken := authenticator.takeBearerToken(); bearerToken != "" {
+		tokenResponse = &cp4dTokenServerResponse{Token: bearerToken}
+		return
+	}
 
 	// Create the request body (only one of APIKey or Password should be set
 	// on the authenticator so only one of them should end up in the serialized JSON).
@@ -267,8 +425,21 @@ func (authenticator *CloudPakForDataAuthenticator) requestToken() (tokenResponse
 		Password: authenticator.Password,
 		APIKey:   authenticator.APIKey,
 	}
+	if authenticator.CredentialsProvider != nil {
+		body, err = newCp4dRequestBody(authenticator.CredentialsProvider)
+		if err != nil {
+			return
+		}
+	} else if body.Password == "" && body.APIKey == "" {
+		// Otherwise, use a one-time passcode.
+		body.Passcode, err = authenticator.nextPasscode(ctx)
+		if err != nil {
+			err = NewAuthenticationError(&DetailedResponse{}, err)
+			return
+		}
+	}
 
-	builder := NewRequestBuilder(POST)
+	builder := NewRequestBuilder(POST).WithContext(ctx)
 	_, err = builder.ResolveRequestURL(authenticator.URL, "/v1/authorize", nil)
 	if err != nil {
 		return
@@ -325,6 +496,7 @@ func (authenticator *CloudPakForDataAuthenticator) requestToken() (tokenResponse
 	if err != nil {
 		return
 	}
+
 	GetLogger().Debug("Returned from CP4D token service operation, received status code %d", resp.StatusCode)
 
 	// If debug is enabled, then dump the response.
@@ -352,7 +524,7 @@ func (authenticator *CloudPakForDataAuthenticator) requestToken() (tokenResponse
 		return
 	}
 
-	tokenResponse = &cp4dTokenServerResponse{}
+	tokenResponse = &cp4dTokenServerResponse{clockSkew: measureClockSkew(resp.Header)}
 	err = json.NewDecoder(resp.Body).Decode(tokenResponse)
 	defer resp.Body.Close()
 	if err != nil {
@@ -369,13 +541,19 @@ type cp4dTokenServerResponse struct {
 	Token       string `json:"token,omitempty"`
 	MessageCode string `json:"_messageCode_,omitempty"`
 	Message     string `json:"message,omitempty"`
+
+	// The skew between the token server's clock and the local clock (see measureClockSkew()).
+	clockSkew time.Duration
 }
 
 // cp4dTokenData is a struct that represents the cached information related to a fetched access token.
+// The refresh and expiration times are those of the local clock, and ClockSkew is the skew between
+// the token server's clock and the local clock when the token was obtained.
 type cp4dTokenData struct {
 	AccessToken string
 	RefreshTime int64
 	Expiration  int64
+	ClockSkew   time.Duration
 }
 
 // newCp4dTokenData: constructs a new Cp4dTokenData instance from the specified Cp4dTokenServerResponse instance.
@@ -391,10 +569,17 @@ func newCp4dTokenData(tokenResponse *cp4dTokenServerResponse) (*cp4dTokenData, e
 	expireTime := claims.ExpiresAt
 	refreshTime := expireTime - int64(float64(timeToLive)*0.2)
 
+	// Convert the times to the local clock, in case the token server's clock is skewed.
+	skew := tokenResponse.clockSkew
+	if skew != 0 {
+		GetLogger().Warn("Clock skew detected: the token server's clock differs from the local clock by %s", skew.String())
+	}
+
 	tokenData := &cp4dTokenData{
 		AccessToken: tokenResponse.Token,
-		Expiration:  expireTime,
-		RefreshTime: refreshTime,
+		Expiration:  toLocalTime(expireTime, skew),
+		RefreshTime: toLocalTime(refreshTime, skew),
+		ClockSkew:   skew,
 	}
 
 	return tokenData, nil
@@ -402,7 +587,7 @@ func newCp4dTokenData(tokenResponse *cp4dTokenServerResponse) (*cp4dTokenData, e
 
 // isTokenValid: returns true iff the Cp4dTokenData instance represents a valid (non-expired) access token.
 func (tokenData *cp4dTokenData) isTokenValid() bool {
-	if tokenData.AccessToken != "" && GetCurrentTime() < tokenData.Expiration {
+	if tokenData != nil && tokenData.AccessToken != "" && GetCurrentTime() < tokenData.Expiration {
 		return true
 	}
 	return false
@@ -412,6 +597,10 @@ func (tokenData *cp4dTokenData) isTokenValid() bool {
 // updates the refresh time if it determines the token needs refreshed to prevent other threads from
 // making multiple refresh calls.
 func (tokenData *cp4dTokenData) needsRefresh() bool {
+	if tokenData == nil {
+		return false
+	}
+
 	cp4dNeedsRefreshMutex.Lock()
 	defer cp4dNeedsRefreshMutex.Unlock()
 
@@ -422,3 +611,11 @@ func (tokenData *cp4dTokenData) needsRefresh() bool {
 	}
 	return false
 }
+
+// token returns the access token (if any), and its expiration and refresh times.
+func (tokenData *cp4dTokenData) token() (accessToken string, expiration int64, refreshTime int64) {
+	if tokenData == nil {
+		return "", 0, 0
+	}
+	return tokenData.AccessToken, tokenData.Expiration, tokenData.RefreshTime
+}
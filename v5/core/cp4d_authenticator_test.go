@@ -17,12 +17,15 @@ package core
 // limitations under the License.
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -826,3 +829,180 @@ func TestCp4dGetTokenServerError(t *testing.T) {
 // 	assert.True(t, strings.HasPrefix(authHeader, "Bearer "))
 // 	t.Logf("Authorization: %s\n", authHeader)
 // }
+
+func TestCp4dEnsureFreshToken(t *testing.T) {
+	GetLogger().SetLogLevel(cp4dAuthTestLogLevel)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{ "_messageCode_":"200", "message":"success", "token":"%s"}`, cp4dUsernamePwd1)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewCloudPakForDataAuthenticatorUsingPassword(server.URL, "john", "snow", false, nil)
+	assert.Nil(t, err)
+
+	// The mock token has already expired, so it can't satisfy the minimum lifetime.
+	err = authenticator.EnsureFreshToken(context.Background(), time.Minute)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, requests)
+	assert.NotNil(t, authenticator.getTokenData())
+
+	// To mock the cache, set the expiration on the existing token to be somewhere in the valid timeframe.
+	authenticator.getTokenData().Expiration = GetCurrentTime() + 3600
+	err = authenticator.EnsureFreshToken(context.Background(), 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+
+	err = authenticator.EnsureFreshToken(context.Background(), 90*time.Minute)
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+// newCp4dTestToken returns an (unsigned) bearer token that was issued at "issuedAt" and expires at "expiresAt".
+func newCp4dTestToken(issuedAt int64, expiresAt int64) string {
+	claims := fmt.Sprintf(`{"username":"mookie","sub":"mookie","iat":%d,"exp":%d}`, issuedAt, expiresAt)
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func TestCp4dPasscodeConfig(t *testing.T) {
+	// A passcode requires a username, and excludes a password or apikey.
+	authenticator := &CloudPakForDataAuthenticator{URL: "cp4d-url", Passcode: "otp"}
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "Username"), authenticator.Validate().Error())
+	authenticator = &CloudPakForDataAuthenticator{URL: "cp4d-url", Username: "mookie", Passcode: "otp", Password: "betts"}
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_ATMOST_ONE_PROP_ERROR, "APIKey/Password", "Passcode"), authenticator.Validate().Error())
+	authenticator = &CloudPakForDataAuthenticator{URL: "cp4d-url", Username: "mookie", Passcode: "otp"}
+	assert.Nil(t, authenticator.Validate())
+	authenticator = &CloudPakForDataAuthenticator{URL: "cp4d-url", Username: "mookie",
+		PasscodePrompt: func(ctx context.Context) (string, error) { return "otp", nil }}
+	assert.Nil(t, authenticator.Validate())
+
+	// A bearer token doesn't require a username.
+	authenticator = &CloudPakForDataAuthenticator{URL: "cp4d-url", BearerToken: "token"}
+	assert.Nil(t, authenticator.Validate())
+	authenticator, err := newCloudPakForDataAuthenticatorFromMap(map[string]string{
+		PROPNAME_AUTH_URL:     "cp4d-url",
+		PROPNAME_BEARER_TOKEN: "token",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "token", authenticator.BearerToken)
+
+	// The passcode is redacted from debug output.
+	assert.NotContains(t, RedactSecrets(`{"username":"mookie","passcode":"otp-secret"}`), "otp-secret")
+}
+
+func TestCp4dTokenCacheUnsupported(t *testing.T) {
+	authenticator := &CloudPakForDataAuthenticator{URL: "cp4d-url", Username: "mookie", Password: "betts"}
+	authenticator.TokenCache = NewMemoryTokenCache()
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_UNSUPPORTED, AUTHTYPE_CP4D, "TokenCache"), authenticator.Validate().Error())
+}
+
+func TestCp4dPasscode(t *testing.T) {
+	GetLogger().SetLogLevel(cp4dAuthTestLogLevel)
+
+	var requests int32
+	var lastPasscode atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body := &cp4dRequestBody{}
+		assert.Nil(t, getJSONRequestBody(r, body))
+		assert.Equal(t, "mookie", body.Username)
+		assert.Empty(t, body.Password)
+		assert.Empty(t, body.APIKey)
+		lastPasscode.Store(body.Passcode)
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{ "_messageCode_":"200", "message":"success", "token":"%s"}`,
+			newCp4dTestToken(GetCurrentTime()-3000, GetCurrentTime()+600))
+	}))
+	defer server.Close()
+
+	authenticator := &CloudPakForDataAuthenticator{URL: server.URL, Username: "mookie", Passcode: "otp-1"}
+	_, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "otp-1", lastPasscode.Load())
+
+	// The token needs to be refreshed, but it can't be refreshed without a passcode,
+	// so it is used until it expires.
+	assert.True(t, authenticator.getTokenData().RefreshTime < GetCurrentTime())
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Once the token is no longer valid, the one-time passcode can't be used again.
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, ERRORMSG_CP4D_CANNOT_REFRESH, err.Error())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Instead, a new passcode is obtained from the prompt.
+	prompts := 0
+	authenticator.PasscodePrompt = func(ctx context.Context) (string, error) {
+		prompts++
+		return fmt.Sprintf("otp-prompt-%d", prompts), nil
+	}
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, prompts)
+	assert.Equal(t, "otp-prompt-1", lastPasscode.Load())
+
+	// A failed prompt fails the token request.
+	authenticator.InvalidateToken()
+	authenticator.PasscodePrompt = func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("prompt cancelled")
+	}
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, "prompt cancelled", err.Error())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestCp4dBearerToken(t *testing.T) {
+	GetLogger().SetLogLevel(cp4dAuthTestLogLevel)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		verifyAuthRequest(t, r, "mookie", "betts", "")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{ "_messageCode_":"200", "message":"success", "token":"%s"}`, cp4dUsernamePwd1)
+	}))
+	defer server.Close()
+
+	// The bearer token is used (without a username) until it expires.
+	bearerToken := newCp4dTestToken(GetCurrentTime(), GetCurrentTime()+3600)
+	authenticator := &CloudPakForDataAuthenticator{URL: server.URL, BearerToken: bearerToken}
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, bearerToken, token)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, ERRORMSG_CP4D_CANNOT_REFRESH, err.Error())
+
+	// The bearer token is used before the password, which is then used to obtain new tokens.
+	authenticator = &CloudPakForDataAuthenticator{URL: server.URL, BearerToken: bearerToken,
+		Username: "mookie", Password: "betts"}
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, bearerToken, token)
+	authenticator.InvalidateToken()
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, cp4dUsernamePwd1, token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// An expired bearer token is ignored.
+	expiredToken := newCp4dTestToken(GetCurrentTime()-7200, GetCurrentTime()-3600)
+	authenticator = &CloudPakForDataAuthenticator{URL: server.URL, BearerToken: expiredToken,
+		Username: "mookie", Password: "betts"}
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, cp4dUsernamePwd1, token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
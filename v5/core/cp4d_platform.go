@@ -0,0 +1,238 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The default paths (relative to the cluster URL) of the CP4D version and health operations.
+	defaultCP4DVersionPath = "/icp4d-api/v1/version"
+	defaultCP4DHealthPath  = "/icp4d-api/v1/health"
+
+	// The path (relative to the cluster URL) of the CP4D token service,
+	// as expected by the CloudPakForDataAuthenticator's URL field.
+	cp4dTokenServicePath = "/icp4d-api"
+
+	// The earliest CP4D version that supports authentication with a username/apikey pair.
+	cp4dAPIKeyAuthMinVersion = "3.5"
+)
+
+// CP4DPlatformOptions holds the configuration used to query a Cloud Pak for Data
+// (or other private cloud) cluster's version and health endpoints.
+type CP4DPlatformOptions struct {
+	// The URL of the cluster (e.g. "https://cpd.mycompany.com") [required].
+	URL string
+
+	// The path (relative to URL) of the version operation [optional].
+	VersionPath string
+
+	// The path (relative to URL) of the health operation [optional].
+	HealthPath string
+
+	// The authenticator used to authenticate requests; defaults to a NoAuthAuthenticator [optional].
+	Authenticator Authenticator
+
+	// The HTTP client used to invoke the cluster [optional].
+	Client *http.Client
+
+	// A flag that indicates whether verification of the server's SSL certificate
+	// should be disabled (e.g. for a cluster with a self-signed certificate) [optional].
+	DisableSSLVerification bool
+}
+
+// CP4DPlatformInfo describes the version and capabilities of a Cloud Pak for Data cluster.
+//
+// The version operation is expected to return a JSON object of the form:
+//
+//	{"version": "4.0.2", "capabilities": ["apikey-auth", ...]}
+type CP4DPlatformInfo struct {
+	// The version of the platform (e.g. "4.0.2").
+	Version string `json:"version"`
+
+	// The capabilities advertised by the platform, if any.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// The URL of the cluster, as specified in the CP4DPlatformOptions.
+	URL string `json:"-"`
+
+	// Whether verification of the server's SSL certificate was disabled.
+	DisableSSLVerification bool `json:"-"`
+}
+
+// GetCP4DPlatformInfo queries the version operation of the cluster described by "options".
+func GetCP4DPlatformInfo(ctx context.Context, options *CP4DPlatformOptions) (*CP4DPlatformInfo, error) {
+	service, options, err := newCP4DPlatformService(options)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newCP4DPlatformRequest(ctx, options.URL, options.VersionPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *CP4DPlatformInfo
+	if _, err = service.Request(req, &info); err != nil {
+		return nil, err
+	}
+	if info == nil {
+		info = &CP4DPlatformInfo{}
+	}
+	info.URL = options.URL
+	info.DisableSSLVerification = options.DisableSSLVerification
+	return info, nil
+}
+
+// CheckCP4DHealth invokes the health operation of the cluster described by "options",
+// returning nil iff the cluster reports that it is healthy (i.e. a 2xx status code).
+func CheckCP4DHealth(ctx context.Context, options *CP4DPlatformOptions) error {
+	service, options, err := newCP4DPlatformService(options)
+	if err != nil {
+		return err
+	}
+
+	req, err := newCP4DPlatformRequest(ctx, options.URL, options.HealthPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = service.Request(req, nil)
+	return err
+}
+
+// VersionAtLeast returns true iff the platform's version is greater than or equal to "version"
+// (e.g. "3.5"). Versions are compared by their numeric dot-separated components.
+func (info *CP4DPlatformInfo) VersionAtLeast(version string) bool {
+	return compareVersions(info.Version, version) >= 0
+}
+
+// HasCapability returns true iff the platform advertises the specified capability.
+func (info *CP4DPlatformInfo) HasCapability(capability string) bool {
+	for _, c := range info.Capabilities {
+		if strings.EqualFold(c, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsAPIKeyAuthentication returns true iff the platform supports obtaining
+// a bearer token with a username/apikey pair (CP4D 3.5 and later).
+func (info *CP4DPlatformInfo) SupportsAPIKeyAuthentication() bool {
+	return info.VersionAtLeast(cp4dAPIKeyAuthMinVersion)
+}
+
+// NewCloudPakForDataAuthenticator returns a CloudPakForDataAuthenticator that is configured
+// for the platform: its URL is the platform's token service, SSL verification is disabled
+// if it was disabled when querying the platform, and the apikey is used only if the
+// platform supports apikey authentication (otherwise the password is used).
+func (info *CP4DPlatformInfo) NewCloudPakForDataAuthenticator(username string, password string,
+	apikey string) (*CloudPakForDataAuthenticator, error) {
+	if !info.SupportsAPIKeyAuthentication() {
+		if password == "" {
+			return nil, fmt.Errorf(ERRORMSG_CP4D_APIKEY_UNSUPPORTED, info.Version)
+		}
+		apikey = ""
+	} else if apikey != "" {
+		password = ""
+	}
+
+	url := strings.TrimRight(info.URL, "/") + cp4dTokenServicePath
+	return newAuthenticator(url, username, password, apikey, info.DisableSSLVerification, nil)
+}
+
+// newCP4DPlatformService returns the BaseService used to invoke the cluster described by
+// "options", along with a copy of "options" containing the default values.
+func newCP4DPlatformService(options *CP4DPlatformOptions) (*BaseService, *CP4DPlatformOptions, error) {
+	if options == nil || options.URL == "" {
+		return nil, nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "URL")
+	}
+
+	optionsCopy := *options
+	if optionsCopy.VersionPath == "" {
+		optionsCopy.VersionPath = defaultCP4DVersionPath
+	}
+	if optionsCopy.HealthPath == "" {
+		optionsCopy.HealthPath = defaultCP4DHealthPath
+	}
+	if IsNil(optionsCopy.Authenticator) {
+		optionsCopy.Authenticator = &NoAuthAuthenticator{}
+	}
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           optionsCopy.URL,
+		Authenticator: optionsCopy.Authenticator,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if optionsCopy.Client != nil {
+		service.SetHTTPClient(optionsCopy.Client)
+	} else if optionsCopy.DisableSSLVerification {
+		service.DisableSSLVerification()
+	}
+	return service, &optionsCopy, nil
+}
+
+// newCP4DPlatformRequest returns a GET request for the specified operation path.
+func newCP4DPlatformRequest(ctx context.Context, url string, path string) (*http.Request, error) {
+	builder := NewRequestBuilder(GET)
+	if ctx != nil {
+		builder.WithContext(ctx)
+	}
+	if _, err := builder.ResolveRequestURL(url, path, nil); err != nil {
+		return nil, err
+	}
+	builder.AddHeader(Accept, APPLICATION_JSON)
+	return builder.Build()
+}
+
+// compareVersions compares two dot-separated version strings (e.g. "4.0.2" and "3.5")
+// by their numeric components, returning -1, 0 or 1. Non-numeric suffixes
+// (e.g. "-beta") are ignored and missing components are treated as 0.
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(strings.TrimSpace(a), "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(strings.TrimSpace(b), "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aNum, bNum := versionComponent(aParts, i), versionComponent(bParts, i)
+		if aNum < bNum {
+			return -1
+		} else if aNum > bNum {
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionComponent returns the numeric value of the i'th version component, or 0 if
+// there is no such component.
+func versionComponent(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	part := parts[i]
+	end := 0
+	for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(part[:end])
+	return n
+}
@@ -0,0 +1,107 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCP4DPlatformTestServer(version string, healthy bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/icp4d-api/v1/version":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"version": "%s", "capabilities": ["platform-connections"]}`, version)
+		case "/icp4d-api/v1/health":
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGetCP4DPlatformInfo(t *testing.T) {
+	server := newCP4DPlatformTestServer("4.0.2", true)
+	defer server.Close()
+
+	info, err := GetCP4DPlatformInfo(context.Background(), &CP4DPlatformOptions{URL: server.URL})
+	assert.Nil(t, err)
+	assert.Equal(t, "4.0.2", info.Version)
+	assert.Equal(t, server.URL, info.URL)
+	assert.True(t, info.HasCapability("Platform-Connections"))
+	assert.False(t, info.HasCapability("other"))
+	assert.True(t, info.VersionAtLeast("3.5"))
+	assert.True(t, info.VersionAtLeast("4.0.2"))
+	assert.False(t, info.VersionAtLeast("4.0.10"))
+	assert.True(t, info.SupportsAPIKeyAuthentication())
+
+	authenticator, err := info.NewCloudPakForDataAuthenticator("user", "password", "apikey")
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/icp4d-api", authenticator.URL)
+	assert.Equal(t, "apikey", authenticator.APIKey)
+	assert.Equal(t, "", authenticator.Password)
+
+	assert.Nil(t, CheckCP4DHealth(context.Background(), &CP4DPlatformOptions{URL: server.URL}))
+
+	_, err = GetCP4DPlatformInfo(context.Background(), &CP4DPlatformOptions{})
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "URL"), err.Error())
+	_, err = GetCP4DPlatformInfo(context.Background(), &CP4DPlatformOptions{URL: server.URL, VersionPath: "/other"})
+	assert.True(t, IsNotFound(err))
+}
+
+func TestCP4DPlatformLegacyVersion(t *testing.T) {
+	server := newCP4DPlatformTestServer("3.0.1", false)
+	defer server.Close()
+
+	info, err := GetCP4DPlatformInfo(context.Background(), &CP4DPlatformOptions{
+		URL:                    server.URL,
+		DisableSSLVerification: true,
+	})
+	assert.Nil(t, err)
+	assert.False(t, info.SupportsAPIKeyAuthentication())
+
+	// The password is used because the platform does not support apikey authentication.
+	authenticator, err := info.NewCloudPakForDataAuthenticator("user", "password", "apikey")
+	assert.Nil(t, err)
+	assert.Equal(t, "password", authenticator.Password)
+	assert.Equal(t, "", authenticator.APIKey)
+	assert.True(t, authenticator.DisableSSLVerification)
+
+	_, err = info.NewCloudPakForDataAuthenticator("user", "", "apikey")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_CP4D_APIKEY_UNSUPPORTED, "3.0.1"), err.Error())
+
+	err = CheckCP4DHealth(context.Background(), &CP4DPlatformOptions{URL: server.URL})
+	assert.NotNil(t, err)
+	assert.True(t, IsRetryable(err))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("4.0", "4.0.0"))
+	assert.Equal(t, 1, compareVersions("v4.10.0", "4.9.1"))
+	assert.Equal(t, -1, compareVersions("3.5.0-beta", "3.5.1"))
+	assert.Equal(t, -1, compareVersions("", "3.5"))
+}
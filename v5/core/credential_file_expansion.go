@@ -0,0 +1,163 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The values in a credential file can refer to environment variables and to files, so that a credential
+// file can be checked in as a template whose secrets are resolved on each machine when it is loaded.
+// The references in the values of a service's properties are only expanded if the service's
+// EXPAND_REFERENCES property is "true", so that existing values containing "${" or "@" are unchanged:
+//
+//   - "${NAME}" is replaced with the value of the environment variable NAME or, if it isn't set, with the
+//     (expanded) value of the property NAME defined in the same credential file. "$${" yields a literal "${".
+//
+//   - A value of the form "@path" is replaced with the trimmed contents of the file at "path" (which may
+//     contain "${NAME}" references). A relative path is relative to the credential file's directory.
+//     A leading "@@" yields a literal leading "@".
+//
+// For example:
+//
+//	MY_SERVICE_EXPAND_REFERENCES=true
+//	MY_SERVICE_URL=https://${REGION}.my-service.cloud.ibm.com
+//	MY_SERVICE_APIKEY=@${HOME}/.secrets/my-service-apikey
+//
+// Values obtained from environment variables or VCAP_SERVICES are not expanded.
+
+// credentialFileExpander expands the references in the values of a credential file's properties.
+type credentialFileExpander struct {
+	// The directory of the credential file.
+	dir string
+
+	// The (unexpanded) values of the properties defined in the credential file, by name.
+	properties map[string]string
+
+	// The properties whose values are being expanded (to detect circular references).
+	expanding map[string]bool
+}
+
+func newCredentialFileExpander(credentialFilePath string, lines []string) *credentialFileExpander {
+	expander := &credentialFileExpander{
+		dir:        filepath.Dir(credentialFilePath),
+		properties: make(map[string]string),
+		expanding:  make(map[string]bool),
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tokens := strings.SplitN(line, "=", 2); len(tokens) == 2 {
+			expander.properties[tokens[0]] = strings.TrimSpace(tokens[1])
+		}
+	}
+	return expander
+}
+
+// expandProperties expands the values of "props", the properties of the service whose credential key
+// is "credentialKey" (as returned by parsePropertyStrings()).
+func (expander *credentialFileExpander) expandProperties(credentialKey string, props map[string]string) error {
+	prefix := credentialKeyPrefix(credentialKey)
+	for name, value := range props {
+		expanded, err := expander.expand(prefix+name, value)
+		if err != nil {
+			return err
+		}
+		props[name] = expanded
+	}
+	return nil
+}
+
+// expand returns "value" (the value of the property "name") with its references expanded.
+func (expander *credentialFileExpander) expand(name string, value string) (string, error) {
+	if strings.HasPrefix(value, "@@") {
+		return expander.expandVariables(name, value[1:])
+	}
+	if strings.HasPrefix(value, "@") {
+		path, err := expander.expandVariables(name, value[1:])
+		if err != nil {
+			return "", err
+		}
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(expander.dir, path)
+		}
+		return readCredentialsFile(fmt.Sprintf("value of the property '%s'", name), name, path)
+	}
+	return expander.expandVariables(name, value)
+}
+
+// expandVariables returns "value" (the value of the property "name") with its "${NAME}" references expanded.
+func (expander *credentialFileExpander) expandVariables(name string, value string) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var expanded strings.Builder
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			expanded.WriteString(value)
+			return expanded.String(), nil
+		}
+		if start > 0 && value[start-1] == '$' {
+			// "$${" is a literal "${".
+			expanded.WriteString(value[:start])
+			expanded.WriteString("{")
+			value = value[start+2:]
+			continue
+		}
+		expanded.WriteString(value[:start])
+
+		end := strings.Index(value[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf(ERRORMSG_CREDENTIAL_REFERENCE, name, "'${' is not terminated by '}'")
+		}
+		variable := value[start+2 : start+end]
+		resolved, err := expander.lookup(name, variable)
+		if err != nil {
+			return "", err
+		}
+		expanded.WriteString(resolved)
+		value = value[start+end+1:]
+	}
+}
+
+// lookup returns the value of the variable "variable" referenced by the property "name".
+func (expander *credentialFileExpander) lookup(name string, variable string) (string, error) {
+	if variable == "" {
+		return "", fmt.Errorf(ERRORMSG_CREDENTIAL_REFERENCE, name, "'${}' does not name a variable")
+	}
+	if resolved, ok := os.LookupEnv(variable); ok {
+		return resolved, nil
+	}
+	value, ok := expander.properties[variable]
+	if !ok {
+		return "", fmt.Errorf(ERRORMSG_CREDENTIAL_REFERENCE, name,
+			fmt.Sprintf("'%s' is neither an environment variable nor a property of the credential file", variable))
+	}
+	if expander.expanding[variable] {
+		return "", fmt.Errorf(ERRORMSG_CREDENTIAL_REFERENCE, name,
+			fmt.Sprintf("the reference to '%s' is circular", variable))
+	}
+
+	expander.expanding[variable] = true
+	defer delete(expander.expanding, variable)
+	return expander.expand(variable, value)
+}
@@ -0,0 +1,155 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2019.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCredentialFile writes a credential file with the specified lines to "dir",
+// and sets IBM_CREDENTIALS_FILE to its path.
+func writeTestCredentialFile(t *testing.T, dir string, lines ...string) {
+	credentialFilePath := filepath.Join(dir, "ibm-credentials.env")
+	assert.Nil(t, ioutil.WriteFile(credentialFilePath, []byte(strings.Join(lines, "\n")), 0600))
+	os.Setenv("IBM_CREDENTIALS_FILE", credentialFilePath)
+}
+
+func TestCredentialFileExpansion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("IBM_CREDENTIALS_FILE")
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "apikey"), []byte("my-secret-apikey\n"), 0600))
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "us-south"), 0700))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "us-south", "password"), []byte("my-password"), 0600))
+	os.Setenv("TEST_EXPANSION_REGION", "us-south")
+	defer os.Unsetenv("TEST_EXPANSION_REGION")
+
+	writeTestCredentialFile(t, dir,
+		"MY_SERVICE_EXPAND_REFERENCES=true",
+		"# Shared settings",
+		"IAM_HOST=iam.test.cloud.ibm.com",
+		"AUTH_HOST=https://${IAM_HOST}",
+		"MY_SERVICE_URL=https://${TEST_EXPANSION_REGION}.my-service.cloud.ibm.com/api",
+		"MY_SERVICE_AUTH_URL=${AUTH_HOST}/identity",
+		"MY_SERVICE_APIKEY=@"+filepath.Join(dir, "apikey"),
+		"MY_SERVICE_PASSWORD=@${TEST_EXPANSION_REGION}/password",
+		"MY_SERVICE_USERNAME=@@user",
+		"MY_SERVICE_CLIENT_SECRET=a$${literal}",
+		"MY_SERVICE_CLIENT_ID=plain$value")
+
+	props, err := GetServiceProperties("my-service")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://us-south.my-service.cloud.ibm.com/api", props[PROPNAME_SVC_URL])
+	assert.Equal(t, "https://iam.test.cloud.ibm.com/identity", props[PROPNAME_AUTH_URL])
+	assert.Equal(t, "my-secret-apikey", props[PROPNAME_APIKEY])
+	assert.Equal(t, "my-password", props[PROPNAME_PASSWORD])
+	assert.Equal(t, "@user", props[PROPNAME_USERNAME])
+	assert.Equal(t, "a${literal}", props[PROPNAME_CLIENT_SECRET])
+	assert.Equal(t, "plain$value", props[PROPNAME_CLIENT_ID])
+
+	// An environment variable takes precedence over a property of the same name.
+	os.Setenv("IAM_HOST", "iam.cloud.ibm.com")
+	defer os.Unsetenv("IAM_HOST")
+	props, err = GetServiceProperties("my-service")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://iam.cloud.ibm.com/identity", props[PROPNAME_AUTH_URL])
+
+	// The expanded values are used to construct the authenticator.
+	authenticator, err := GetAuthenticatorFromEnvironment("my-service")
+	assert.Nil(t, err)
+	iamAuthenticator, ok := authenticator.(*IamAuthenticator)
+	assert.True(t, ok)
+	assert.Equal(t, "my-secret-apikey", iamAuthenticator.ApiKey)
+}
+
+func TestCredentialFileExpansionErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("IBM_CREDENTIALS_FILE")
+
+	testCases := []struct {
+		value string
+		err   string
+	}{
+		{"${TEST_EXPANSION_UNDEFINED}", "'TEST_EXPANSION_UNDEFINED' is neither an environment variable nor a property of the credential file"},
+		{"${MY_SERVICE_APIKEY}", "the reference to 'MY_SERVICE_APIKEY' is circular"},
+		{"https://${TEST_EXPANSION_REGION", "'${' is not terminated by '}'"},
+		{"${}", "'${}' does not name a variable"},
+		{"@missing-apikey", "Unable to read the value of the property 'MY_SERVICE_APIKEY' from '" + filepath.Join(dir, "missing-apikey") + "'"},
+	}
+	for _, testCase := range testCases {
+		writeTestCredentialFile(t, dir, "MY_SERVICE_EXPAND_REFERENCES=true", "MY_SERVICE_APIKEY="+testCase.value)
+
+		props, err := GetServiceProperties("my-service")
+		assert.Nil(t, props)
+		if assert.NotNil(t, err, testCase.value) {
+			assert.Contains(t, err.Error(), testCase.err)
+		}
+
+		authenticator, err := GetAuthenticatorFromEnvironment("my-service")
+		assert.Nil(t, authenticator)
+		assert.NotNil(t, err)
+
+		service, _ := NewBaseService(&ServiceOptions{URL: "https://example.com", Authenticator: &NoAuthAuthenticator{}})
+		assert.NotNil(t, service.ConfigureService("my-service"))
+
+		report := Doctor(context.Background(), "my-service")
+		assert.False(t, report.Healthy())
+		assert.Contains(t, report.GetCheck(DoctorCheckConfiguration).Message, testCase.err)
+	}
+
+	// The properties of other services aren't expanded.
+	writeTestCredentialFile(t, dir, "MY_SERVICE_EXPAND_REFERENCES=true", "MY_SERVICE_APIKEY=${TEST_EXPANSION_UNDEFINED}",
+		"OTHER_SERVICE_APIKEY=my-apikey")
+	props, err := GetServiceProperties("other-service")
+	assert.Nil(t, err)
+	assert.Equal(t, "my-apikey", props[PROPNAME_APIKEY])
+}
+
+func TestCredentialFileExpansionDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("IBM_CREDENTIALS_FILE")
+	os.Setenv("TEST_EXPANSION_REGION", "us-south")
+	defer os.Unsetenv("TEST_EXPANSION_REGION")
+
+	// By default (or unless EXPAND_REFERENCES is "true"), values containing "${" or "@" are unchanged.
+	for _, expandReferences := range []string{"", "MY_SERVICE_EXPAND_REFERENCES=false"} {
+		writeTestCredentialFile(t, dir,
+			expandReferences,
+			"MY_SERVICE_URL=https://${TEST_EXPANSION_REGION}.my-service.cloud.ibm.com/api",
+			"MY_SERVICE_APIKEY=@my-apikey",
+			"MY_SERVICE_PASSWORD=pa$${word}@${UNDEFINED")
+
+		props, err := GetServiceProperties("my-service")
+		assert.Nil(t, err)
+		assert.Equal(t, "https://${TEST_EXPANSION_REGION}.my-service.cloud.ibm.com/api", props[PROPNAME_SVC_URL])
+		assert.Equal(t, "@my-apikey", props[PROPNAME_APIKEY])
+		assert.Equal(t, "pa$${word}@${UNDEFINED", props[PROPNAME_PASSWORD])
+	}
+}
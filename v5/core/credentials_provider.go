@@ -0,0 +1,91 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// CredentialsProvider supplies the secrets used by an authenticator. When an authenticator's
+// CredentialsProvider is set, it is consulted each time the authenticator needs the secrets
+// (i.e. for each request by the BasicAuthenticator, and for each token fetch by the
+// CloudPakForDataAuthenticator and IamAuthenticator), so that a secret that is rotated
+// (e.g. in Vault, or in a Kubernetes secret) takes effect without re-creating the authenticator.
+type CredentialsProvider interface {
+	// GetUsernamePassword returns the current username and password.
+	GetUsernamePassword() (username string, password string, err error)
+
+	// GetAPIKey returns the current apikey.
+	GetAPIKey() (apikey string, err error)
+}
+
+// FileCredentialsProvider is a CredentialsProvider that reads each secret from a file
+// (e.g. a Kubernetes secret mounted as a volume, or a file rendered by the Vault agent)
+// each time it is requested. Leading and trailing whitespace is removed from each secret.
+type FileCredentialsProvider struct {
+	// The files containing the username, password and apikey.
+	// Only the files of the secrets that are used by the authenticator need be specified.
+	UsernameFile string
+	PasswordFile string
+	APIKeyFile   string
+}
+
+// GetUsernamePassword returns the contents of UsernameFile and PasswordFile.
+// The password is empty if PasswordFile is not specified (e.g. if a CloudPakForDataAuthenticator
+// uses a username and apikey).
+func (provider *FileCredentialsProvider) GetUsernamePassword() (username string, password string, err error) {
+	if username, err = readCredentialsFile("username", "UsernameFile", provider.UsernameFile); err != nil {
+		return
+	}
+	if provider.PasswordFile != "" {
+		password, err = readCredentialsFile("password", "PasswordFile", provider.PasswordFile)
+	}
+	return
+}
+
+// GetAPIKey returns the contents of APIKeyFile.
+func (provider *FileCredentialsProvider) GetAPIKey() (string, error) {
+	return readCredentialsFile("apikey", "APIKeyFile", provider.APIKeyFile)
+}
+
+// readCredentialsFile returns the trimmed contents of the file at "path".
+func readCredentialsFile(secret string, field string, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf(ERRORMSG_PROP_MISSING, field)
+	}
+	data, err := ioutil.ReadFile(path) // #nosec G304
+	if err != nil {
+		return "", fmt.Errorf(ERRORMSG_CREDENTIALS_READ, secret, path, err.Error())
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// getUsernamePassword returns the username and password obtained from "provider",
+// or an error if either is empty.
+func getUsernamePassword(provider CredentialsProvider) (string, string, error) {
+	username, password, err := provider.GetUsernamePassword()
+	if err != nil {
+		return "", "", err
+	}
+	if username == "" {
+		return "", "", fmt.Errorf(ERRORMSG_PROP_MISSING, "Username")
+	}
+	if password == "" {
+		return "", "", fmt.Errorf(ERRORMSG_PROP_MISSING, "Password")
+	}
+	return username, password, nil
+}
@@ -0,0 +1,183 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rotatingCredentialsProvider is a CredentialsProvider whose secrets can be changed by the test.
+type rotatingCredentialsProvider struct {
+	username string
+	password string
+	apikey   string
+	err      error
+}
+
+func (p *rotatingCredentialsProvider) GetUsernamePassword() (string, string, error) {
+	return p.username, p.password, p.err
+}
+
+func (p *rotatingCredentialsProvider) GetAPIKey() (string, error) {
+	return p.apikey, p.err
+}
+
+func TestBasicAuthenticatorCredentialsProvider(t *testing.T) {
+	provider := &rotatingCredentialsProvider{username: "user", password: "pw1"}
+	authenticator := &BasicAuthenticator{CredentialsProvider: provider}
+	assert.Nil(t, authenticator.Validate())
+
+	request, _ := http.NewRequest(GET, "https://localhost", nil)
+	assert.Nil(t, authenticator.Authenticate(request))
+	username, password, _ := request.BasicAuth()
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "pw1", password)
+
+	// The rotated password is used by the next request.
+	provider.password = "pw2"
+	assert.Nil(t, authenticator.Authenticate(request))
+	_, password, _ = request.BasicAuth()
+	assert.Equal(t, "pw2", password)
+
+	provider.password = ""
+	assert.NotNil(t, authenticator.Authenticate(request))
+	provider.err = fmt.Errorf("vault is sealed")
+	assert.Equal(t, provider.err, authenticator.Authenticate(request))
+}
+
+func TestIamAuthenticatorCredentialsProvider(t *testing.T) {
+	var apikeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		apikeys = append(apikeys, r.Form.Get("apikey"))
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	provider := &rotatingCredentialsProvider{apikey: "key1"}
+	authenticator, err := NewIamAuthenticatorBuilder().SetURL(server.URL).SetCredentialsProvider(provider).Build()
+	assert.Nil(t, err)
+
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+
+	// The rotated apikey is used by the next token fetch.
+	provider.apikey = "key2"
+	authenticator.setTokenData(nil)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key1", "key2"}, apikeys)
+
+	provider.err = fmt.Errorf("vault is sealed")
+	authenticator.setTokenData(nil)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+
+	// A CredentialsProvider can't be combined with a refresh token.
+	_, err = NewIamAuthenticatorBuilder().SetCredentialsProvider(provider).SetRefreshToken("token").
+		SetClientIDSecret("id", "secret").Build()
+	assert.NotNil(t, err)
+}
+
+func TestCp4dAuthenticatorCredentialsProvider(t *testing.T) {
+	var bodies []*cp4dRequestBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body *cp4dRequestBody
+		_ = getJSONRequestBody(r, &body)
+		bodies = append(bodies, body)
+		fmt.Fprintf(w, `{"_messageCode_":"200", "message":"success", "token":"%s"}`, cp4dUsernamePwd1)
+	}))
+	defer server.Close()
+
+	provider := &rotatingCredentialsProvider{username: "mookie", password: "betts"}
+	authenticator := &CloudPakForDataAuthenticator{URL: server.URL, CredentialsProvider: provider}
+	assert.Nil(t, authenticator.Validate())
+
+	_, err := authenticator.GetToken()
+	assert.Nil(t, err)
+
+	// The apikey is used if the provider supplies no password.
+	provider.password = ""
+	provider.apikey = "my_apikey"
+	authenticator.setTokenData(nil)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, []*cp4dRequestBody{
+		{Username: "mookie", Password: "betts"},
+		{Username: "mookie", APIKey: "my_apikey"},
+	}, bodies)
+
+	provider.apikey = ""
+	authenticator.setTokenData(nil)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+}
+
+func TestFileCredentialsProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, value string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(value), 0600))
+		return path
+	}
+	provider := &FileCredentialsProvider{
+		UsernameFile: write("username", "user\n"),
+		PasswordFile: write("password", " pw1 \n"),
+		APIKeyFile:   write("apikey", "key1"),
+	}
+
+	username, password, err := provider.GetUsernamePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "pw1", password)
+	apikey, err := provider.GetAPIKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "key1", apikey)
+
+	// The files are re-read on each call.
+	write("password", "pw2")
+	write("apikey", "key2")
+	_, password, _ = provider.GetUsernamePassword()
+	assert.Equal(t, "pw2", password)
+	apikey, _ = provider.GetAPIKey()
+	assert.Equal(t, "key2", apikey)
+
+	// The password is optional, while the other files must be specified and exist.
+	provider.PasswordFile = ""
+	_, password, err = provider.GetUsernamePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "", password)
+	provider.APIKeyFile = ""
+	_, err = provider.GetAPIKey()
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "APIKeyFile"), err.Error())
+	provider.UsernameFile = filepath.Join(dir, "missing")
+	_, _, err = provider.GetUsernamePassword()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,121 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerNameDeprecation = "Deprecation"
+	headerNameSunset      = "Sunset"
+)
+
+// DeprecationInfo holds the deprecation-related information contained in the
+// "Deprecation", "Sunset" and "Warning" headers of an operation response.
+type DeprecationInfo struct {
+	// Deprecated is true iff the response contains a "Deprecation" header
+	// indicating that the operation is (or will be) deprecated.
+	Deprecated bool
+
+	// The date at which the operation was (or will be) deprecated,
+	// if specified by the "Deprecation" header.
+	DeprecationDate *time.Time
+
+	// The date at which the operation will become unavailable,
+	// if specified by the "Sunset" header.
+	Sunset *time.Time
+
+	// The values of the "Warning" headers.
+	Warnings []string
+}
+
+// DeprecationHandler is a function that is invoked when an operation response
+// contains deprecation-related headers.
+type DeprecationHandler func(req *http.Request, info *DeprecationInfo)
+
+// The operations for which a deprecation message has already been logged.
+var loggedDeprecations sync.Map
+
+// parseDeprecationInfo returns the deprecation-related information contained in "header",
+// or nil if "header" contains no "Deprecation", "Sunset" or "Warning" headers.
+// The "Deprecation" header may contain "true", an HTTP-date, or a structured date
+// (e.g. "@1688169599"); the "Sunset" header contains an HTTP-date.
+func parseDeprecationInfo(header http.Header) *DeprecationInfo {
+	deprecation := strings.TrimSpace(header.Get(headerNameDeprecation))
+	sunset := strings.TrimSpace(header.Get(headerNameSunset))
+	warnings := header.Values(headerNameWarning)
+	if deprecation == "" && sunset == "" && len(warnings) == 0 {
+		return nil
+	}
+
+	info := &DeprecationInfo{
+		Warnings: append([]string(nil), warnings...),
+	}
+
+	if deprecation != "" && !strings.EqualFold(deprecation, "false") {
+		info.Deprecated = true
+		if strings.HasPrefix(deprecation, "@") {
+			if seconds, err := strconv.ParseInt(deprecation[1:], 10, 64); err == nil {
+				t := time.Unix(seconds, 0).UTC()
+				info.DeprecationDate = &t
+			}
+		} else if t, err := http.ParseTime(deprecation); err == nil {
+			info.DeprecationDate = &t
+		}
+	}
+
+	if sunset != "" {
+		if t, err := http.ParseTime(sunset); err == nil {
+			info.Sunset = &t
+		}
+	}
+
+	return info
+}
+
+// String returns a description of the deprecation-related information.
+func (info *DeprecationInfo) String() string {
+	var parts []string
+	if info.Deprecated {
+		if info.DeprecationDate != nil {
+			parts = append(parts, "deprecated as of "+info.DeprecationDate.Format(time.RFC3339))
+		} else {
+			parts = append(parts, "deprecated")
+		}
+	}
+	if info.Sunset != nil {
+		parts = append(parts, "sunset on "+info.Sunset.Format(time.RFC3339))
+	}
+	for _, warning := range info.Warnings {
+		parts = append(parts, fmt.Sprintf("warning: %s", warning))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// logDeprecation is the default DeprecationHandler, which logs a warning message
+// the first time that deprecation-related headers are received for an operation.
+func logDeprecation(req *http.Request, info *DeprecationInfo) {
+	operation := req.Method + " " + req.URL.Host + req.URL.Path
+	if _, logged := loggedDeprecations.LoadOrStore(operation, true); logged {
+		return
+	}
+	GetLogger().Warn("Operation '%s': %s", operation, info.String())
+}
@@ -0,0 +1,118 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeprecationInfo(t *testing.T) {
+	assert.Nil(t, parseDeprecationInfo(http.Header{}))
+
+	info := parseDeprecationInfo(http.Header{"Deprecation": {"true"}})
+	assert.NotNil(t, info)
+	assert.True(t, info.Deprecated)
+	assert.Nil(t, info.DeprecationDate)
+	assert.Nil(t, info.Sunset)
+	assert.Equal(t, "deprecated", info.String())
+
+	info = parseDeprecationInfo(http.Header{
+		"Deprecation": {"@1688169599"},
+		"Sunset":      {"Wed, 11 Nov 2026 23:59:59 GMT"},
+		"Warning":     {`299 - "Deprecated API"`, `299 - "Use v2"`},
+	})
+	assert.True(t, info.Deprecated)
+	assert.Equal(t, time.Unix(1688169599, 0).UTC(), *info.DeprecationDate)
+	assert.Equal(t, time.Date(2026, time.November, 11, 23, 59, 59, 0, time.UTC), *info.Sunset)
+	assert.Equal(t, []string{`299 - "Deprecated API"`, `299 - "Use v2"`}, info.Warnings)
+	assert.Equal(t, `deprecated as of 2023-06-30T23:59:59Z; sunset on 2026-11-11T23:59:59Z; `+
+		`warning: 299 - "Deprecated API"; warning: 299 - "Use v2"`, info.String())
+
+	info = parseDeprecationInfo(http.Header{"Deprecation": {"Sun, 11 Nov 2018 23:59:59 GMT"}})
+	assert.True(t, info.Deprecated)
+	assert.Equal(t, time.Date(2018, time.November, 11, 23, 59, 59, 0, time.UTC), *info.DeprecationDate)
+
+	// A sunset date alone does not mean that the operation is deprecated.
+	info = parseDeprecationInfo(http.Header{"Sunset": {"not a date"}})
+	assert.NotNil(t, info)
+	assert.False(t, info.Deprecated)
+	assert.Nil(t, info.Sunset)
+}
+
+func TestDeprecationHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/deprecated" {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", "Wed, 11 Nov 2026 23:59:59 GMT")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	var invocations []*DeprecationInfo
+	service.SetDeprecationHandler(func(req *http.Request, info *DeprecationInfo) {
+		assert.Equal(t, "/v1/deprecated", req.URL.Path)
+		invocations = append(invocations, info)
+	})
+
+	invoke := func(path string) *DetailedResponse {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, _ := builder.Build()
+		var foo *Foo
+		detailedResponse, err := service.Request(req, &foo)
+		assert.Nil(t, err)
+		return detailedResponse
+	}
+
+	detailedResponse := invoke("/v1/current")
+	assert.Nil(t, detailedResponse.GetDeprecationInfo())
+	assert.Len(t, invocations, 0)
+
+	detailedResponse = invoke("/v1/deprecated")
+	assert.True(t, detailedResponse.GetDeprecationInfo().Deprecated)
+	assert.NotNil(t, detailedResponse.GetDeprecationInfo().Sunset)
+	assert.Len(t, invocations, 1)
+	assert.True(t, invocations[0].Deprecated)
+
+	// The handler is retained by a clone.
+	clone := service.Clone()
+	assert.NotNil(t, clone.deprecationHandler)
+
+	// With the default handler, the deprecation is logged only once per operation.
+	service.SetDeprecationHandler(nil)
+	invoke("/v1/deprecated")
+	invoke("/v1/deprecated")
+	assert.Len(t, invocations, 1)
+	_, logged := loggedDeprecations.Load("GET " + server.Listener.Addr().String() + "/v1/deprecated")
+	assert.True(t, logged)
+}
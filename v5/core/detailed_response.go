@@ -57,6 +57,19 @@ type DetailedResponse struct {
 	// either for a successful or unsuccessful operation.
 	// 2) the operation was unsuccessful, and the response body contains a non-JSON response.
 	RawResult []byte
+
+	// The violations found by the operation's response validator, if any.
+	violations []ResponseViolation
+
+	// The size and SHA-256 checksum of a response body copied to a ResponseBodyWriter.
+	bodySize     int64
+	bodyChecksum string
+
+	// The redirects that were followed to obtain the response.
+	redirects []RedirectHop
+
+	// Whether the response is a stale response returned from a cache.
+	stale bool
 }
 
 // GetHeaders returns the headers
@@ -69,6 +82,20 @@ func (response *DetailedResponse) GetStatusCode() int {
 	return response.StatusCode
 }
 
+// GetDeprecationInfo returns the information contained in the response's
+// "Deprecation", "Sunset" and "Warning" headers, or nil if the response
+// contains none of these headers.
+func (response *DetailedResponse) GetDeprecationInfo() *DeprecationInfo {
+	return parseDeprecationInfo(response.Headers)
+}
+
+// GetQuotaInfo returns the quota and entitlement information contained in the
+// response's "X-Quota-*" and "X-Plan-Id" headers, or nil if the response
+// contains none of these headers.
+func (response *DetailedResponse) GetQuotaInfo() *QuotaInfo {
+	return parseQuotaInfo(response.Headers)
+}
+
 // GetResult returns the result from the service
 func (response *DetailedResponse) GetResult() interface{} {
 	return response.Result
@@ -86,6 +113,32 @@ func (response *DetailedResponse) GetRawResult() []byte {
 	return response.RawResult
 }
 
+// GetMultiStatusResult parses the response body of a 207 (Multi-Status) or
+// partial-success response and returns the outcome of each item.
+// The response body is obtained from the RawResult field if set, otherwise
+// from the Result field.
+func (response *DetailedResponse) GetMultiStatusResult() (*MultiStatusResult, error) {
+	body := response.RawResult
+	if body == nil {
+		switch result := response.Result.(type) {
+		case []byte:
+			body = result
+		case *string:
+			body = []byte(StringNilMapper(result))
+		default:
+			if !IsNil(result) {
+				var err error
+				body, err = json.Marshal(result)
+				if err != nil {
+					return nil, fmt.Errorf(ERRORMSG_MULTI_STATUS_BODY, err.Error())
+				}
+			}
+		}
+	}
+
+	return ParseMultiStatusResult(body)
+}
+
 func (response *DetailedResponse) String() string {
 	output, err := json.MarshalIndent(response, "", "    ")
 	if err == nil {
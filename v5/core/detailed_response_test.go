@@ -19,6 +19,7 @@ package core
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -88,3 +89,45 @@ func TestDetailedResponseJsonMap(t *testing.T) {
 	assert.Equal(t, errorMap, m)
 	assert.Nil(t, response.GetRawResult())
 }
+
+func TestDetailedResponseQuotaInfo(t *testing.T) {
+	response := &DetailedResponse{
+		StatusCode: 200,
+		Headers:    http.Header{"Content-Type": {"application/json"}},
+	}
+	assert.Nil(t, response.GetQuotaInfo())
+
+	headers := http.Header{}
+	headers.Set("X-Plan-Id", "lite")
+	headers.Set("X-Quota-Limit", "1000")
+	headers.Set("X-Quota-Remaining", "250")
+	headers.Set("X-Quota-Reset", "1688169599")
+	headers.Set("X-Quota-Limit-Instances", "5")
+	headers.Set("X-Quota-Remaining-Instances", "2")
+	headers.Set("X-Quota-Remaining-Keys", "not-a-number")
+	response.Headers = headers
+
+	info := response.GetQuotaInfo()
+	assert.NotNil(t, info)
+	assert.Equal(t, "lite", info.Plan)
+	assert.Equal(t, int64(1000), *info.Limit)
+	assert.Equal(t, int64(250), *info.Remaining)
+	assert.Equal(t, time.Unix(1688169599, 0).UTC(), *info.Reset)
+	assert.Len(t, info.Resources, 1)
+	assert.Equal(t, int64(5), *info.Resources["instances"].Limit)
+	assert.Equal(t, int64(2), *info.Resources["instances"].Remaining)
+
+	headers = http.Header{}
+	headers.Set("X-Quota-Remaining-Instances", "0")
+	headers.Set("X-Quota-Reset", "Wed, 11 Nov 2026 23:59:59 GMT")
+	response.Headers = headers
+
+	info = response.GetQuotaInfo()
+	assert.NotNil(t, info)
+	assert.Equal(t, "", info.Plan)
+	assert.Nil(t, info.Limit)
+	assert.Nil(t, info.Remaining)
+	assert.Equal(t, time.Date(2026, time.November, 11, 23, 59, 59, 0, time.UTC), *info.Reset)
+	assert.Nil(t, info.Resources["instances"].Limit)
+	assert.Equal(t, int64(0), *info.Resources["instances"].Remaining)
+}
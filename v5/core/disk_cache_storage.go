@@ -0,0 +1,233 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The file name suffix of the files that hold the entries of a disk cache.
+const diskCacheFileSuffix = ".cache"
+
+// DiskCacheStorageOptions holds the configuration of a disk-backed CacheStorage.
+type DiskCacheStorageOptions struct {
+	// The directory in which cache entries are stored; created if necessary [required].
+	Directory string
+
+	// The maximum total size (in bytes) of the cache entries. When exceeded,
+	// the least recently used entries are evicted. Zero means no limit [optional].
+	MaxSize int64
+
+	// The maximum age of an entry. Older entries are evicted.
+	// Zero means that entries are not evicted based on their age [optional].
+	TTL time.Duration
+}
+
+// diskCacheStorage is a CacheStorage that holds each entry in a separate file.
+type diskCacheStorage struct {
+	options DiskCacheStorageOptions
+	mutex   sync.Mutex
+}
+
+// diskCacheRecord is the content of a cache entry's file (following the checksum line).
+type diskCacheRecord struct {
+	Key   string      `json:"key"`
+	Entry *CacheEntry `json:"entry"`
+}
+
+// NewDiskCacheStorage returns a CacheStorage that holds entries in files within
+// the specified directory, so that cached responses can be shared across invocations
+// of a program (e.g. a CLI).
+// Each file is written atomically and contains a checksum, so that a corrupt entry
+// is detected (and removed) rather than returned.
+func NewDiskCacheStorage(options *DiskCacheStorageOptions) (CacheStorage, error) {
+	if options == nil || options.Directory == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "Directory")
+	}
+
+	if err := os.MkdirAll(options.Directory, 0700); err != nil {
+		return nil, err
+	}
+
+	return &diskCacheStorage{
+		options: *options,
+	}, nil
+}
+
+func (storage *diskCacheStorage) Get(key string) (*CacheEntry, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	path := storage.entryPath(key)
+	data, err := ioutil.ReadFile(path) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	record, err := decodeDiskCacheRecord(data)
+	if err != nil || record.Key != key || record.Entry == nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf(ERRORMSG_CACHE_ENTRY_CORRUPT, path)
+	}
+
+	if storage.isExpired(record.Entry.StoredAt) {
+		_ = os.Remove(path)
+		return nil, nil
+	}
+
+	// Record the access time so that the least recently used entries are evicted first.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return record.Entry, nil
+}
+
+func (storage *diskCacheStorage) Set(key string, entry *CacheEntry) error {
+	data, err := encodeDiskCacheRecord(&diskCacheRecord{Key: key, Entry: entry})
+	if err != nil {
+		return err
+	}
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	// Write the entry to a temporary file and then rename it, so that
+	// readers (including other processes) never see a partially-written entry.
+	tempFile, err := ioutil.TempFile(storage.options.Directory, "tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), storage.entryPath(key))
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	return storage.evict()
+}
+
+func (storage *diskCacheStorage) Delete(key string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	err := os.Remove(storage.entryPath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// entryPath returns the path of the file that holds the entry with the specified key.
+func (storage *diskCacheStorage) entryPath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(storage.options.Directory, hex.EncodeToString(hash[:])+diskCacheFileSuffix)
+}
+
+// isExpired returns true iff an entry stored at the specified time has exceeded the TTL.
+func (storage *diskCacheStorage) isExpired(storedAt time.Time) bool {
+	return storage.options.TTL > 0 && time.Since(storedAt) > storage.options.TTL
+}
+
+// evict removes the entries that have exceeded the TTL and, if the total size
+// of the remaining entries exceeds the maximum size, the least recently used entries.
+// The caller must hold the storage's mutex.
+func (storage *diskCacheStorage) evict() error {
+	if storage.options.TTL <= 0 && storage.options.MaxSize <= 0 {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(storage.options.Directory)
+	if err != nil {
+		return err
+	}
+
+	// Process the files from most to least recently used.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+
+	var totalSize int64
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), diskCacheFileSuffix) {
+			continue
+		}
+
+		// A file's modification time is at least as recent as its entry's StoredAt time,
+		// so it can be used to identify expired entries without reading the file.
+		totalSize += file.Size()
+		if storage.isExpired(file.ModTime()) ||
+			(storage.options.MaxSize > 0 && totalSize > storage.options.MaxSize) {
+			totalSize -= file.Size()
+			if err := os.Remove(filepath.Join(storage.options.Directory, file.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encodeDiskCacheRecord returns the content of the file that holds "record":
+// the hex-encoded SHA-256 checksum of the JSON-encoded record, a newline, and the JSON-encoded record.
+func encodeDiskCacheRecord(record *diskCacheRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum := sha256.Sum256(payload)
+	data := make([]byte, 0, sha256.Size*2+1+len(payload))
+	data = append(data, hex.EncodeToString(checksum[:])...)
+	data = append(data, '\n')
+	return append(data, payload...), nil
+}
+
+// decodeDiskCacheRecord decodes the content of a file written by encodeDiskCacheRecord,
+// verifying its checksum.
+func decodeDiskCacheRecord(data []byte) (*diskCacheRecord, error) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, fmt.Errorf("checksum not found")
+	}
+
+	checksum := sha256.Sum256(data[i+1:])
+	if string(data[:i]) != hex.EncodeToString(checksum[:]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	record := &diskCacheRecord{}
+	if err := json.Unmarshal(data[i+1:], record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,224 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDiskCacheTestStorage(t *testing.T, maxSize int64, ttl time.Duration) (*diskCacheStorage, func()) {
+	dir, err := ioutil.TempDir("", "disk-cache-test")
+	assert.Nil(t, err)
+
+	storage, err := NewDiskCacheStorage(&DiskCacheStorageOptions{
+		Directory: filepath.Join(dir, "cache"),
+		MaxSize:   maxSize,
+		TTL:       ttl,
+	})
+	assert.Nil(t, err)
+	return storage.(*diskCacheStorage), func() { os.RemoveAll(dir) }
+}
+
+func newDiskCacheTestEntry(body string) *CacheEntry {
+	return &CacheEntry{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       []byte(body),
+		StoredAt:   time.Now(),
+	}
+}
+
+func TestDiskCacheStorage(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, 0)
+	defer cleanup()
+
+	entry, err := storage.Get("key1")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	assert.Nil(t, storage.Set("key1", newDiskCacheTestEntry(`{"name": "value1"}`)))
+	entry, err = storage.Get("key1")
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+	assert.Equal(t, http.StatusOK, entry.StatusCode)
+	assert.Equal(t, "application/json", entry.Header.Get("Content-Type"))
+	assert.Equal(t, `{"name": "value1"}`, string(entry.Body))
+
+	// Entries persist across storage instances.
+	other, err := NewDiskCacheStorage(&storage.options)
+	assert.Nil(t, err)
+	entry, err = other.Get("key1")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name": "value1"}`, string(entry.Body))
+
+	assert.Nil(t, storage.Delete("key1"))
+	assert.Nil(t, storage.Delete("key1"))
+	entry, err = other.Get("key1")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	_, err = NewDiskCacheStorage(&DiskCacheStorageOptions{})
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "Directory"), err.Error())
+}
+
+func TestDiskCacheStorageCorruption(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, 0)
+	defer cleanup()
+
+	assert.Nil(t, storage.Set("key1", newDiskCacheTestEntry("value1")))
+	path := storage.entryPath("key1")
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+
+	// Corrupt the entry's content.
+	data[len(data)-3] ^= 0xFF
+	assert.Nil(t, ioutil.WriteFile(path, data, 0600))
+
+	entry, err := storage.Get("key1")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_CACHE_ENTRY_CORRUPT, path), err.Error())
+	assert.Nil(t, entry)
+
+	// The corrupt entry is removed.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	entry, err = storage.Get("key1")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	// A truncated entry is detected as well.
+	assert.Nil(t, storage.Set("key1", newDiskCacheTestEntry("value1")))
+	assert.Nil(t, ioutil.WriteFile(path, data[:10], 0600))
+	_, err = storage.Get("key1")
+	assert.NotNil(t, err)
+}
+
+func TestDiskCacheStorageEviction(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, 0)
+	defer cleanup()
+
+	// Determine the size of a single entry's file.
+	assert.Nil(t, storage.Set("key0", newDiskCacheTestEntry("value")))
+	info, err := os.Stat(storage.entryPath("key0"))
+	assert.Nil(t, err)
+	assert.Nil(t, storage.Delete("key0"))
+
+	// Allow at most 3 entries.
+	storage.options.MaxSize = 3*info.Size() + 10
+	for i := 1; i <= 3; i++ {
+		key := fmt.Sprintf("key%d", i)
+		assert.Nil(t, storage.Set(key, newDiskCacheTestEntry("value")))
+		past := time.Now().Add(time.Duration(i-10) * time.Minute)
+		assert.Nil(t, os.Chtimes(storage.entryPath(key), past, past))
+	}
+
+	// Accessing key1 makes key2 the least recently used entry.
+	entry, err := storage.Get("key1")
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+
+	assert.Nil(t, storage.Set("key4", newDiskCacheTestEntry("value")))
+	for key, present := range map[string]bool{"key1": true, "key2": false, "key3": true, "key4": true} {
+		entry, err := storage.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, present, entry != nil, key)
+	}
+}
+
+func TestDiskCacheStorageTTL(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, time.Hour)
+	defer cleanup()
+
+	expired := newDiskCacheTestEntry("value")
+	expired.StoredAt = time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, storage.Set("key1", expired))
+	entry, err := storage.Get("key1")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+	_, err = os.Stat(storage.entryPath("key1"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Expired entries are also removed when a new entry is stored.
+	assert.Nil(t, storage.Set("key2", newDiskCacheTestEntry("value")))
+	past := time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, os.Chtimes(storage.entryPath("key2"), past, past))
+	assert.Nil(t, storage.Set("key3", newDiskCacheTestEntry("value")))
+	_, err = os.Stat(storage.entryPath("key2"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiskCacheStorageConcurrency(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, 0)
+	defer cleanup()
+
+	// Two storage instances using the same directory (e.g. two processes).
+	other, err := NewDiskCacheStorage(&storage.options)
+	assert.Nil(t, err)
+
+	var failures int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := CacheStorage(storage)
+			if i%2 == 1 {
+				s = other
+			}
+			for j := 0; j < 20; j++ {
+				key := fmt.Sprintf("key%d", j%3)
+				if err := s.Set(key, newDiskCacheTestEntry(key)); err != nil {
+					atomic.AddInt32(&failures, 1)
+				}
+				if entry, err := s.Get(key); err != nil || (entry != nil && string(entry.Body) != key) {
+					atomic.AddInt32(&failures, 1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&failures))
+}
+
+func TestDiskCacheStorageWithTransport(t *testing.T) {
+	storage, cleanup := newDiskCacheTestStorage(t, 0, 0)
+	defer cleanup()
+
+	var requests int32
+	server := newCacheTestServer(&requests, func() int { return http.StatusOK })
+	defer server.Close()
+
+	// Simulate two invocations of a CLI that share the disk cache.
+	for i := 0; i < 2; i++ {
+		service := newCacheTestService(t, server.URL, &ResponseCacheOptions{Storage: storage, TTL: time.Hour})
+		name, _, err := invokeCacheTest(t, service, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, "response-1", name)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,322 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DoctorStatus is the outcome of a check performed by Doctor().
+type DoctorStatus string
+
+const (
+	// The check passed.
+	DoctorStatusOK DoctorStatus = "ok"
+
+	// The check passed, but found a potential problem.
+	DoctorStatusWarning DoctorStatus = "warning"
+
+	// The check failed.
+	DoctorStatusFailed DoctorStatus = "failed"
+
+	// The check was not performed (e.g. because a check that it depends on failed).
+	DoctorStatusSkipped DoctorStatus = "skipped"
+)
+
+// The names of the checks performed by Doctor(), in order.
+const (
+	DoctorCheckConfiguration = "configuration"
+	DoctorCheckCredentials   = "credentials"
+	DoctorCheckProxy         = "proxy"
+	DoctorCheckEndpoint      = "endpoint"
+	DoctorCheckTLS           = "tls"
+	DoctorCheckClock         = "clock"
+)
+
+// A certificate that expires within this period is reported with a warning.
+const doctorCertificateExpiryWarning = 30 * 24 * time.Hour
+
+// DoctorCheck is the result of a check performed by Doctor().
+type DoctorCheck struct {
+	// The name of the check (e.g. "credentials").
+	Name string `json:"name"`
+
+	// The outcome of the check.
+	Status DoctorStatus `json:"status"`
+
+	// A description of the outcome (which never contains credentials).
+	Message string `json:"message"`
+}
+
+// DoctorReport is the result of Doctor().
+type DoctorReport struct {
+	// The name of the service whose configuration was checked.
+	ServiceName string `json:"service_name"`
+
+	// The checks that were performed, in order.
+	Checks []DoctorCheck `json:"checks"`
+}
+
+// Healthy returns true iff none of the checks failed.
+func (report *DoctorReport) Healthy() bool {
+	for _, check := range report.Checks {
+		if check.Status == DoctorStatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// GetCheck returns the check named "name", or nil if the report contains no such check.
+func (report *DoctorReport) GetCheck(name string) *DoctorCheck {
+	for i := range report.Checks {
+		if report.Checks[i].Name == name {
+			return &report.Checks[i]
+		}
+	}
+	return nil
+}
+
+// String returns the report in a human-readable form, with one line per check.
+func (report *DoctorReport) String() string {
+	var b strings.Builder
+	for _, check := range report.Checks {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", check.Status, check.Name, check.Message)
+	}
+	return b.String()
+}
+
+// add appends a check to the report.
+func (report *DoctorReport) add(name string, status DoctorStatus, format string, inserts ...interface{}) {
+	report.Checks = append(report.Checks, DoctorCheck{
+		Name:    name,
+		Status:  status,
+		Message: RedactSecrets(fmt.Sprintf(format, inserts...)),
+	})
+}
+
+// Doctor diagnoses the configuration of the service "serviceName" for use in a "doctor" command of a
+// tool built on the SDK. It performs the following checks, in order, and returns a report of their outcomes:
+//   - configuration: the external configuration source in which the service's properties were found
+//   - credentials: the authenticator is constructed from the properties, and used to obtain an access token
+//     (if it uses one)
+//   - proxy: the proxy (if any) configured via the environment for the service URL
+//   - endpoint: the service URL is reachable (any HTTP response is sufficient)
+//   - tls: the service's certificate is trusted, and isn't about to expire
+//   - clock: the local clock agrees with the service's clock (see SetClockSkewThreshold())
+//
+// The checks of the service URL are skipped if no URL is configured. "ctx" bounds the time spent
+// obtaining an access token and contacting the service.
+func Doctor(ctx context.Context, serviceName string) *DoctorReport {
+	report := &DoctorReport{ServiceName: serviceName}
+
+	// configuration
+	properties, source, err := doctorServiceProperties(serviceName)
+	if err != nil {
+		report.add(DoctorCheckConfiguration, DoctorStatusFailed, "unable to load the properties of service '%s': %s",
+			serviceName, err.Error())
+		for _, name := range []string{DoctorCheckCredentials, DoctorCheckProxy, DoctorCheckEndpoint, DoctorCheckTLS, DoctorCheckClock} {
+			report.add(name, DoctorStatusSkipped, "no configuration")
+		}
+		return report
+	}
+	if len(properties) == 0 {
+		report.add(DoctorCheckConfiguration, DoctorStatusFailed,
+			"no properties were found for service '%s' in a credential file, environment variables or VCAP_SERVICES",
+			serviceName)
+		for _, name := range []string{DoctorCheckCredentials, DoctorCheckProxy, DoctorCheckEndpoint, DoctorCheckTLS, DoctorCheckClock} {
+			report.add(name, DoctorStatusSkipped, "no configuration")
+		}
+		return report
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	report.add(DoctorCheckConfiguration, DoctorStatusOK, "properties %v were found in %s", names, source)
+
+	// credentials
+	doctorCheckCredentials(ctx, report, serviceName)
+
+	// proxy, endpoint, tls and clock
+	serviceURL := properties[PROPNAME_SVC_URL]
+	if serviceURL == "" {
+		for _, name := range []string{DoctorCheckProxy, DoctorCheckEndpoint, DoctorCheckTLS, DoctorCheckClock} {
+			report.add(name, DoctorStatusSkipped, "no service URL is configured")
+		}
+		return report
+	}
+	disableSSL, _ := strconv.ParseBool(properties[PROPNAME_SVC_DISABLE_SSL])
+	doctorCheckEndpoint(ctx, report, serviceURL, disableSSL)
+
+	return report
+}
+
+// doctorServiceProperties returns the properties of the service "serviceName", and a description
+// of the configuration source in which they were found (as in getServiceProperties()).
+func doctorServiceProperties(serviceName string) (map[string]string, string, error) {
+	if serviceName == "" {
+		return nil, "", nil
+	}
+	if properties, err := getServicePropertiesFromCredentialFile(serviceName); err != nil {
+		return nil, "", err
+	} else if properties != nil {
+		return properties, "a credential file", nil
+	}
+	if properties := getServicePropertiesFromEnvironment(serviceName); properties != nil {
+		return properties, "environment variables", nil
+	}
+	if properties := getServicePropertiesFromVCAP(serviceName); properties != nil {
+		return properties, "VCAP_SERVICES", nil
+	}
+	return nil, "", nil
+}
+
+// doctorCheckCredentials adds the credentials check to "report".
+func doctorCheckCredentials(ctx context.Context, report *DoctorReport, serviceName string) {
+	authenticator, err := GetAuthenticatorFromEnvironment(serviceName)
+	if err != nil {
+		report.add(DoctorCheckCredentials, DoctorStatusFailed, "unable to construct the authenticator: %s", err.Error())
+		return
+	}
+	if authenticator == nil {
+		report.add(DoctorCheckCredentials, DoctorStatusFailed, ERRORMSG_NO_AUTHENTICATOR)
+		return
+	}
+
+	// Obtain an access token, if the authenticator uses one.
+	var getToken func(ctx context.Context) error
+	if healthChecker, ok := authenticator.(HealthChecker); ok {
+		getToken = healthChecker.HealthCheck
+	} else if tokenAuthenticator, ok := authenticator.(interface {
+		GetTokenWithContext(ctx context.Context) (string, error)
+	}); ok {
+		getToken = func(ctx context.Context) error {
+			_, err := tokenAuthenticator.GetTokenWithContext(ctx)
+			return err
+		}
+	} else {
+		report.add(DoctorCheckCredentials, DoctorStatusOK, "the %s authenticator is configured", authenticator.AuthenticationType())
+		return
+	}
+	start := time.Now()
+	if err = getToken(ctx); err != nil {
+		report.add(DoctorCheckCredentials, DoctorStatusFailed, "the %s authenticator was unable to obtain an access token: %s",
+			authenticator.AuthenticationType(), err.Error())
+		return
+	}
+	report.add(DoctorCheckCredentials, DoctorStatusOK, "the %s authenticator obtained an access token in %s",
+		authenticator.AuthenticationType(), time.Since(start).Round(time.Millisecond))
+}
+
+// doctorCheckEndpoint adds the proxy, endpoint, tls and clock checks to "report", for the service URL "serviceURL".
+func doctorCheckEndpoint(ctx context.Context, report *DoctorReport, serviceURL string, disableSSL bool) {
+	req, err := http.NewRequest(http.MethodHead, serviceURL, nil)
+	if err != nil {
+		report.add(DoctorCheckProxy, DoctorStatusSkipped, "invalid service URL")
+		report.add(DoctorCheckEndpoint, DoctorStatusFailed, "the service URL '%s' is invalid: %s", serviceURL, err.Error())
+		report.add(DoctorCheckTLS, DoctorStatusSkipped, "invalid service URL")
+		report.add(DoctorCheckClock, DoctorStatusSkipped, "invalid service URL")
+		return
+	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	}
+
+	// proxy
+	client := DefaultHTTPClient()
+	transport, _ := client.Transport.(*http.Transport)
+	if transport != nil && transport.Proxy != nil {
+		if proxyURL, err := transport.Proxy(req); err != nil {
+			report.add(DoctorCheckProxy, DoctorStatusFailed, "the proxy configuration is invalid: %s", err.Error())
+		} else if proxyURL != nil {
+			// Only the proxy's host is reported, since its URL might contain credentials.
+			report.add(DoctorCheckProxy, DoctorStatusOK, "requests are sent via the proxy at %s", proxyURL.Host)
+		} else {
+			report.add(DoctorCheckProxy, DoctorStatusOK, "requests are sent directly (no proxy is configured)")
+		}
+	} else {
+		report.add(DoctorCheckProxy, DoctorStatusOK, "requests are sent directly (the client doesn't use a proxy)")
+	}
+	if disableSSL && transport != nil {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{} // #nosec G402
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true // #nosec G402
+	}
+
+	// endpoint
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		class := ClassifyTransportError(err)
+		report.add(DoctorCheckEndpoint, DoctorStatusFailed, "unable to reach %s (%s): %s", req.URL.Host, class, err.Error())
+		if class == TransportErrorCertificate {
+			report.add(DoctorCheckTLS, DoctorStatusFailed, "the certificate of %s is not trusted", req.URL.Host)
+		} else {
+			report.add(DoctorCheckTLS, DoctorStatusSkipped, "the service is unreachable")
+		}
+		report.add(DoctorCheckClock, DoctorStatusSkipped, "the service is unreachable")
+		return
+	}
+	resp.Body.Close() // #nosec G104
+	report.add(DoctorCheckEndpoint, DoctorStatusOK, "%s responded with status code %d in %s",
+		req.URL.Host, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+
+	// tls
+	switch {
+	case resp.TLS == nil:
+		report.add(DoctorCheckTLS, DoctorStatusWarning, "the service URL doesn't use TLS")
+	case disableSSL:
+		report.add(DoctorCheckTLS, DoctorStatusWarning, "verification of the certificate is disabled by the %s property",
+			PROPNAME_SVC_DISABLE_SSL)
+	case len(resp.TLS.PeerCertificates) > 0:
+		expiry := resp.TLS.PeerCertificates[0].NotAfter
+		if time.Until(expiry) < doctorCertificateExpiryWarning {
+			report.add(DoctorCheckTLS, DoctorStatusWarning, "the certificate of %s is trusted, but expires at %s",
+				req.URL.Host, expiry.UTC().Format(time.RFC3339))
+		} else {
+			report.add(DoctorCheckTLS, DoctorStatusOK, "the certificate of %s is trusted (it expires at %s)",
+				req.URL.Host, expiry.UTC().Format(time.RFC3339))
+		}
+	default:
+		report.add(DoctorCheckTLS, DoctorStatusOK, "the connection to %s is secured by TLS", req.URL.Host)
+	}
+
+	// clock
+	serverDate, err := http.ParseTime(resp.Header.Get(headerNameDate))
+	if err != nil {
+		report.add(DoctorCheckClock, DoctorStatusSkipped, "the response has no Date header")
+		return
+	}
+	skew := serverDate.Sub(GetClock().Now()).Truncate(time.Second)
+	threshold := GetClockSkewThreshold()
+	if threshold == 0 {
+		threshold = defaultClockSkewThreshold
+	}
+	if skew >= threshold || skew <= -threshold {
+		report.add(DoctorCheckClock, DoctorStatusWarning, "the local clock differs from the service's clock by %s", skew)
+	} else {
+		report.add(DoctorCheckClock, DoctorStatusOK, "the local clock agrees with the service's clock")
+	}
+}
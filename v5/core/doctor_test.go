@@ -0,0 +1,157 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setDoctorTestEnv sets the environment variables of the "doctor_service" service, and returns a function
+// that unsets them.
+func setDoctorTestEnv(properties map[string]string) func() {
+	for name, value := range properties {
+		os.Setenv("DOCTOR_SERVICE_"+name, value)
+	}
+	return func() {
+		for name := range properties {
+			os.Unsetenv("DOCTOR_SERVICE_" + name)
+		}
+	}
+}
+
+func getDoctorCheckStatuses(report *DoctorReport) map[string]DoctorStatus {
+	statuses := make(map[string]DoctorStatus)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestDoctor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/identity/token" {
+			fmt.Fprintf(w, `{"access_token": "token-1", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+				GetCurrentTime()+3600)
+			return
+		}
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	defer setDoctorTestEnv(map[string]string{
+		"URL":       server.URL + "/api",
+		"AUTH_TYPE": AUTHTYPE_IAM,
+		"APIKEY":    "secret-apikey",
+		"AUTH_URL":  server.URL,
+	})()
+
+	report := Doctor(context.Background(), "doctor_service")
+	assert.Equal(t, "doctor_service", report.ServiceName)
+	assert.True(t, report.Healthy(), report.String())
+	assert.Equal(t, map[string]DoctorStatus{
+		DoctorCheckConfiguration: DoctorStatusOK,
+		DoctorCheckCredentials:   DoctorStatusOK,
+		DoctorCheckProxy:         DoctorStatusOK,
+		DoctorCheckEndpoint:      DoctorStatusOK,
+		DoctorCheckTLS:           DoctorStatusWarning,
+		DoctorCheckClock:         DoctorStatusOK,
+	}, getDoctorCheckStatuses(report))
+	assert.Len(t, report.Checks, 6)
+	assert.Contains(t, report.GetCheck(DoctorCheckConfiguration).Message, "environment variables")
+	assert.Contains(t, report.GetCheck(DoctorCheckEndpoint).Message, "status code 404")
+	assert.Nil(t, report.GetCheck("other"))
+
+	// The report never contains the credentials.
+	assert.NotContains(t, report.String(), "secret-apikey")
+	assert.NotContains(t, report.String(), "token-1")
+}
+
+func TestDoctorFailures(t *testing.T) {
+	// No configuration.
+	report := Doctor(context.Background(), "doctor_service")
+	assert.False(t, report.Healthy())
+	assert.Equal(t, DoctorStatusFailed, report.GetCheck(DoctorCheckConfiguration).Status)
+	assert.Equal(t, DoctorStatusSkipped, report.GetCheck(DoctorCheckClock).Status)
+
+	// The token server rejects the apikey, and the service's certificate isn't trusted.
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errorCode": "BXNIM0415E", "errorMessage": "Provided API key could not be found"}`)
+	}))
+	defer tokenServer.Close()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	unsetEnv := setDoctorTestEnv(map[string]string{
+		"URL":      server.URL,
+		"APIKEY":   "secret-apikey",
+		"AUTH_URL": tokenServer.URL,
+	})
+	defer unsetEnv()
+
+	report = Doctor(context.Background(), "doctor_service")
+	assert.False(t, report.Healthy())
+	assert.Equal(t, map[string]DoctorStatus{
+		DoctorCheckConfiguration: DoctorStatusOK,
+		DoctorCheckCredentials:   DoctorStatusFailed,
+		DoctorCheckProxy:         DoctorStatusOK,
+		DoctorCheckEndpoint:      DoctorStatusFailed,
+		DoctorCheckTLS:           DoctorStatusFailed,
+		DoctorCheckClock:         DoctorStatusSkipped,
+	}, getDoctorCheckStatuses(report))
+	assert.Contains(t, report.GetCheck(DoctorCheckCredentials).Message, "Provided API key could not be found")
+	assert.Contains(t, report.GetCheck(DoctorCheckEndpoint).Message, string(TransportErrorCertificate))
+	assert.NotContains(t, report.String(), "secret-apikey")
+	assert.Equal(t, len(report.Checks), strings.Count(report.String(), "\n"))
+
+	// Verification of the certificate can be disabled.
+	defer setDoctorTestEnv(map[string]string{"DISABLE_SSL": "true"})()
+	report = Doctor(context.Background(), "doctor_service")
+	assert.Equal(t, DoctorStatusOK, report.GetCheck(DoctorCheckEndpoint).Status)
+	assert.Equal(t, DoctorStatusWarning, report.GetCheck(DoctorCheckTLS).Status)
+}
+
+func TestDoctorClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	defer setDoctorTestEnv(map[string]string{
+		"URL":       server.URL,
+		"AUTH_TYPE": AUTHTYPE_NOAUTH,
+	})()
+
+	report := Doctor(context.Background(), "doctor_service")
+	assert.True(t, report.Healthy(), report.String())
+	assert.Equal(t, DoctorStatusOK, report.GetCheck(DoctorCheckCredentials).Status)
+	assert.Equal(t, DoctorStatusWarning, report.GetCheck(DoctorCheckClock).Status)
+	assert.Contains(t, report.GetCheck(DoctorCheckClock).Message, "-1h0m0s")
+}
@@ -0,0 +1,136 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// DefaultDownloadBufferSize is the size (in bytes) of the buffer used to copy a response body
+// to a ResponseBodyWriter, or to the writer passed to Download(), unless the service's size
+// is set with SetDownloadBufferSize().
+const DefaultDownloadBufferSize = 32 * 1024
+
+// downloadBufferPools holds a pool of reusable buffers for each download buffer size.
+var downloadBufferPools sync.Map
+
+// SetDownloadBufferSize sets the size (in bytes) of the buffer used to copy a response body to
+// a ResponseBodyWriter, or to the writer passed to Download(). A larger buffer reduces the number
+// of reads and writes needed for a multi-GB transfer over a fast network. The buffers are reused
+// across requests, so they aren't reallocated for each download. A size of 0 selects the default
+// (DefaultDownloadBufferSize).
+func (service *BaseService) SetDownloadBufferSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "size")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.downloadBufferSize = size
+	return nil
+}
+
+// GetDownloadBufferSize returns the size (in bytes) of the buffer used to copy a response body
+// to a ResponseBodyWriter, or to the writer passed to Download().
+func (service *BaseService) GetDownloadBufferSize() int {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return effectiveDownloadBufferSize(service.downloadBufferSize)
+}
+
+// SetReadBufferSize sets the size (in bytes) of the buffer used to read from each connection of
+// the service's http client (see http.Transport.ReadBufferSize, which is 4KB by default). The
+// client's transport is replaced with a copy that uses the new size, so the connections of the
+// previous transport aren't reused. If retries are enabled, then the transport used for each
+// attempt is replaced. A size of 0 selects the default.
+func (service *BaseService) SetReadBufferSize(size int) error {
+	if size < 0 {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "size")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	client, err := withReadBufferSize(service.Client, size)
+	if err != nil {
+		return err
+	}
+	service.Client = client
+	return nil
+}
+
+// withReadBufferSize returns a copy of "client" whose transport uses a read buffer of "size" bytes.
+func withReadBufferSize(client *http.Client, size int) (*http.Client, error) {
+	// If retries are enabled, then replace the transport of the client used for each attempt.
+	attemptClient := client
+	retryableClient := getRetryableHTTPClient(client)
+	if retryableClient != nil {
+		attemptClient = retryableClient.HTTPClient
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if attemptClient != nil && attemptClient.Transport != nil {
+		transport = attemptClient.Transport
+	}
+	httpTransport, ok := transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf(ERRORMSG_READ_BUFFER_TRANSPORT, transport)
+	}
+	httpTransport = httpTransport.Clone()
+	httpTransport.ReadBufferSize = size
+
+	if retryableClient != nil {
+		retryableClient = retryableClientWithTransport(retryableClient, httpTransport)
+		return clientWithTransport(client, &retryablehttp.RoundTripper{Client: retryableClient}), nil
+	}
+	return clientWithTransport(client, httpTransport), nil
+}
+
+// effectiveDownloadBufferSize returns the download buffer size used for the configured "size".
+func effectiveDownloadBufferSize(size int) int {
+	if size <= 0 {
+		return DefaultDownloadBufferSize
+	}
+	return size
+}
+
+// getDownloadBuffer returns a buffer of "size" bytes (or the default size, if "size" is 0)
+// from the pool of reusable buffers. It should be returned with putDownloadBuffer().
+func getDownloadBuffer(size int) *[]byte {
+	size = effectiveDownloadBufferSize(size)
+	pool, ok := downloadBufferPools.Load(size)
+	if !ok {
+		pool, _ = downloadBufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, size)
+				return &buf
+			},
+		})
+	}
+	return pool.(*sync.Pool).Get().(*[]byte)
+}
+
+// putDownloadBuffer returns "buf" (obtained from getDownloadBuffer()) to the pool.
+func putDownloadBuffer(buf *[]byte) {
+	if pool, ok := downloadBufferPools.Load(len(*buf)); ok {
+		pool.(*sync.Pool).Put(buf)
+	}
+}
@@ -0,0 +1,213 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadBufferSize(t *testing.T) {
+	object := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(object))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultDownloadBufferSize, service.GetDownloadBufferSize())
+
+	assert.NotNil(t, service.SetDownloadBufferSize(-1))
+	assert.Nil(t, service.SetDownloadBufferSize(7))
+	assert.Equal(t, 7, service.GetDownloadBufferSize())
+	assert.Equal(t, 7, service.Clone().GetDownloadBufferSize())
+
+	// The body is copied intact with a buffer that doesn't divide its size.
+	var buf bytes.Buffer
+	detailedResponse, err := service.Request(newDownloadRequest(t, server.URL, -1, -1), NewResponseBodyWriter(&buf))
+	assert.Nil(t, err)
+	assert.Equal(t, object, buf.String())
+	assert.Equal(t, int64(len(object)), detailedResponse.GetBodySize())
+
+	buf.Reset()
+	written, err := service.Download(newDownloadRequest(t, server.URL, -1, -1), &buf, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(object)), written)
+	assert.Equal(t, object, buf.String())
+
+	// A size of 0 selects the default.
+	assert.Nil(t, service.SetDownloadBufferSize(0))
+	assert.Equal(t, DefaultDownloadBufferSize, service.GetDownloadBufferSize())
+}
+
+func TestDownloadBufferPool(t *testing.T) {
+	buf := getDownloadBuffer(0)
+	assert.Equal(t, DefaultDownloadBufferSize, len(*buf))
+	putDownloadBuffer(buf)
+
+	buf = getDownloadBuffer(1024 * 1024)
+	assert.Equal(t, 1024*1024, len(*buf))
+	putDownloadBuffer(buf)
+}
+
+func TestSetReadBufferSize(t *testing.T) {
+	service, err := NewBaseService(&ServiceOptions{URL: "https://myservice.cloud.ibm.com", Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.NotNil(t, service.SetReadBufferSize(-1))
+
+	// The client's transport is replaced with a copy.
+	previous := service.GetHTTPClient().Transport
+	assert.Nil(t, service.SetReadBufferSize(256*1024))
+	transport, ok := service.GetHTTPClient().Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 256*1024, transport.ReadBufferSize)
+	assert.False(t, previous == transport)
+
+	// If retries are enabled, then the transport used for each attempt is replaced.
+	service.EnableRetries(5, 0)
+	assert.Nil(t, service.SetReadBufferSize(1024*1024))
+	retryableClient := getRetryableHTTPClient(service.GetHTTPClient())
+	assert.NotNil(t, retryableClient)
+	assert.Equal(t, 5, retryableClient.RetryMax)
+	transport, ok = retryableClient.HTTPClient.Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 1024*1024, transport.ReadBufferSize)
+
+	// A client without a transport uses a copy of the default transport.
+	service.SetHTTPClient(&http.Client{})
+	assert.Nil(t, service.SetReadBufferSize(64*1024))
+	transport, ok = service.GetHTTPClient().Transport.(*http.Transport)
+	assert.True(t, ok)
+	assert.Equal(t, 64*1024, transport.ReadBufferSize)
+
+	// A custom transport can't be modified.
+	custom := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("not sent")
+	})}
+	service.SetHTTPClient(custom)
+	err = service.SetReadBufferSize(64 * 1024)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "read buffer size")
+	assert.Equal(t, custom, service.GetHTTPClient())
+}
+
+// syntheticBody is a response body of "remaining" bytes that costs nothing to read,
+// so that a benchmark measures the cost of copying it.
+type syntheticBody struct {
+	remaining int64
+}
+
+func (body *syntheticBody) Read(p []byte) (int, error) {
+	if body.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if int64(n) > body.remaining {
+		n = int(body.remaining)
+	}
+	body.remaining -= int64(n)
+	return n, nil
+}
+
+func (body *syntheticBody) Close() error {
+	return nil
+}
+
+var downloadBenchmarkBufferSizes = []int{32 * 1024, 256 * 1024, 1024 * 1024}
+
+func BenchmarkResponseBodyWriter(b *testing.B) {
+	const bodySize = 64 * 1024 * 1024
+	for _, bufferSize := range downloadBenchmarkBufferSizes {
+		b.Run(strconv.Itoa(bufferSize/1024)+"KB", func(b *testing.B) {
+			service, err := NewBaseService(&ServiceOptions{
+				URL:           "https://myservice.cloud.ibm.com",
+				Authenticator: &NoAuthAuthenticator{},
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			service.SetHTTPClient(&http.Client{
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: 200, Header: http.Header{}, Body: &syntheticBody{remaining: bodySize}, Request: req}, nil
+				}),
+			})
+			if err := service.SetDownloadBufferSize(bufferSize); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(bodySize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, err := http.NewRequest(GET, "https://myservice.cloud.ibm.com/export", nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := service.Request(req, NewResponseBodyWriter(ioutil.Discard)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDownload(b *testing.B) {
+	const bodySize = 64 * 1024 * 1024
+	object := bytes.Repeat([]byte("0123456789abcdef"), bodySize/16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(object)
+	}))
+	defer server.Close()
+
+	for _, bufferSize := range downloadBenchmarkBufferSizes {
+		b.Run(strconv.Itoa(bufferSize/1024)+"KB", func(b *testing.B) {
+			service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := service.SetDownloadBufferSize(bufferSize); err != nil {
+				b.Fatal(err)
+			}
+			if err := service.SetReadBufferSize(bufferSize); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(bodySize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req, err := http.NewRequest(GET, server.URL+"/objects/1", nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := service.Download(req, ioutil.Discard, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+)
+
+// isoDurationPattern matches an ISO 8601 duration (e.g. "P1Y2M3DT4H5M6.5S" or "P2W").
+// Only the seconds may have a fractional part.
+var isoDurationPattern = regexp.MustCompile(
+	`^([-+])?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)(?:[.,](\d+))?S)?)?$`)
+
+// Duration is an ISO 8601 duration (e.g. "P1DT12H"). Unlike a time.Duration, a Duration
+// may contain years and months (whose length depends on the date to which they are added),
+// and may exceed the range of a time.Duration (about 292 years).
+// A Duration is marshalled to (and unmarshalled from) a JSON string in ISO 8601 format.
+type Duration struct {
+	// True if the duration is negative (e.g. "-P1D").
+	Negative bool
+
+	// The (non-negative) components of the duration.
+	Years   int64
+	Months  int64
+	Weeks   int64
+	Days    int64
+	Hours   int64
+	Minutes int64
+	Seconds int64
+
+	// The fractional part of the seconds, in nanoseconds.
+	Nanoseconds int64
+}
+
+// NewDuration returns the Duration equivalent to "d", expressed in hours, minutes and seconds.
+func NewDuration(d time.Duration) *Duration {
+	// Obtain the magnitude of "d" in a way that also works for math.MinInt64.
+	magnitude := uint64(d)
+	if d < 0 {
+		magnitude = uint64(-(d + 1)) + 1
+	}
+
+	return &Duration{
+		Negative:    d < 0,
+		Hours:       int64(magnitude / uint64(time.Hour)),
+		Minutes:     int64(magnitude % uint64(time.Hour) / uint64(time.Minute)),
+		Seconds:     int64(magnitude % uint64(time.Minute) / uint64(time.Second)),
+		Nanoseconds: int64(magnitude % uint64(time.Second)),
+	}
+}
+
+// ParseDuration parses the specified ISO 8601 duration string (e.g. "P1Y2M3DT4H5M6.5S")
+// and returns a Duration instance.
+func ParseDuration(durationString string) (*Duration, error) {
+	matches := isoDurationPattern.FindStringSubmatch(durationString)
+	if matches == nil || strings.HasSuffix(durationString, "P") || strings.HasSuffix(durationString, "T") {
+		return nil, fmt.Errorf(ERRORMSG_DURATION_INVALID, durationString)
+	}
+
+	components := make([]int64, 8)
+	for i, match := range matches[2:9] {
+		if match == "" {
+			continue
+		}
+		value, err := strconv.ParseInt(match, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(ERRORMSG_DURATION_INVALID, durationString)
+		}
+		components[i] = value
+	}
+
+	// Convert the fractional part of the seconds (if any) to nanoseconds, ignoring any excess precision.
+	if fraction := matches[9]; fraction != "" {
+		fraction = (fraction + "000000000")[:9]
+		components[7], _ = strconv.ParseInt(fraction, 10, 64)
+	}
+
+	return &Duration{
+		Negative:    matches[1] == "-",
+		Years:       components[0],
+		Months:      components[1],
+		Weeks:       components[2],
+		Days:        components[3],
+		Hours:       components[4],
+		Minutes:     components[5],
+		Seconds:     components[6],
+		Nanoseconds: components[7],
+	}, nil
+}
+
+// ParseTimeDuration parses the specified ISO 8601 duration string (e.g. "PT1H30M") and returns
+// the equivalent time.Duration. A day is assumed to be 24 hours long. An error is returned if the
+// duration contains years or months, or if it exceeds the range of a time.Duration.
+func ParseTimeDuration(durationString string) (time.Duration, error) {
+	duration, err := ParseDuration(durationString)
+	if err != nil {
+		return 0, err
+	}
+	return duration.TimeDuration()
+}
+
+// FormatTimeDuration returns the ISO 8601 representation of "d" (e.g. "PT1H30M").
+func FormatTimeDuration(d time.Duration) string {
+	return NewDuration(d).String()
+}
+
+// TimeDuration returns the time.Duration equivalent to the duration. A day is assumed to
+// be 24 hours long. An error is returned if the duration contains years or months,
+// or if it exceeds the range of a time.Duration.
+func (duration Duration) TimeDuration() (time.Duration, error) {
+	if duration.Years != 0 || duration.Months != 0 {
+		return 0, fmt.Errorf(ERRORMSG_DURATION_CALENDAR, duration.String())
+	}
+
+	var total int64
+	components := []struct {
+		value int64
+		unit  time.Duration
+	}{
+		{duration.Weeks, 7 * 24 * time.Hour},
+		{duration.Days, 24 * time.Hour},
+		{duration.Hours, time.Hour},
+		{duration.Minutes, time.Minute},
+		{duration.Seconds, time.Second},
+		{duration.Nanoseconds, time.Nanosecond},
+	}
+	for _, component := range components {
+		if component.value < 0 || component.value > (math.MaxInt64-total)/int64(component.unit) {
+			return 0, fmt.Errorf(ERRORMSG_DURATION_OVERFLOW, duration.String())
+		}
+		total += component.value * int64(component.unit)
+	}
+
+	if duration.Negative {
+		total = -total
+	}
+	return time.Duration(total), nil
+}
+
+// AddTo returns the time "t" plus the duration. Years, months, weeks and days are added
+// to the date (as in time.Time.AddDate()), so that "P1D" always yields the same time of day,
+// even across a daylight saving time transition.
+func (duration Duration) AddTo(t time.Time) time.Time {
+	sign := int64(1)
+	if duration.Negative {
+		sign = -1
+	}
+
+	t = t.AddDate(int(sign*duration.Years), int(sign*duration.Months), int(sign*(duration.Weeks*7+duration.Days)))
+	t = t.Add(time.Duration(sign*duration.Hours) * time.Hour)
+	t = t.Add(time.Duration(sign*duration.Minutes) * time.Minute)
+	t = t.Add(time.Duration(sign*duration.Seconds) * time.Second)
+	return t.Add(time.Duration(sign * duration.Nanoseconds))
+}
+
+// IsZero returns true iff the duration has no length.
+func (duration Duration) IsZero() bool {
+	return duration.Years == 0 && duration.Months == 0 && duration.Weeks == 0 && duration.Days == 0 &&
+		duration.Hours == 0 && duration.Minutes == 0 && duration.Seconds == 0 && duration.Nanoseconds == 0
+}
+
+// String returns the ISO 8601 representation of the duration (e.g. "P1DT12H").
+// A zero duration is represented as "PT0S".
+func (duration Duration) String() string {
+	if duration.IsZero() {
+		return "PT0S"
+	}
+
+	var b strings.Builder
+	if duration.Negative {
+		b.WriteString("-")
+	}
+	b.WriteString("P")
+	writeComponent := func(value int64, designator string) {
+		if value != 0 {
+			b.WriteString(strconv.FormatInt(value, 10))
+			b.WriteString(designator)
+		}
+	}
+	writeComponent(duration.Years, "Y")
+	writeComponent(duration.Months, "M")
+	writeComponent(duration.Weeks, "W")
+	writeComponent(duration.Days, "D")
+	if duration.Hours != 0 || duration.Minutes != 0 || duration.Seconds != 0 || duration.Nanoseconds != 0 {
+		b.WriteString("T")
+		writeComponent(duration.Hours, "H")
+		writeComponent(duration.Minutes, "M")
+		if duration.Nanoseconds != 0 {
+			fraction := strings.TrimRight(fmt.Sprintf("%09d", duration.Nanoseconds), "0")
+			b.WriteString(strconv.FormatInt(duration.Seconds, 10) + "." + fraction + "S")
+		} else {
+			writeComponent(duration.Seconds, "S")
+		}
+	}
+	return b.String()
+}
+
+// MarshalJSON marshals the duration as a JSON string in ISO 8601 format.
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(duration.String())
+}
+
+// UnmarshalJSON unmarshals a JSON string in ISO 8601 format into the duration.
+func (duration *Duration) UnmarshalJSON(data []byte) error {
+	var durationString string
+	if err := json.Unmarshal(data, &durationString); err != nil {
+		return err
+	}
+	parsed, err := ParseDuration(durationString)
+	if err != nil {
+		return err
+	}
+	*duration = *parsed
+	return nil
+}
+
+// unmarshalTimeDuration unmarshals "rawMsg" into "result" if "result" is a *time.Duration
+// or a **time.Duration, and "rawMsg" contains an ISO 8601 duration string, and returns
+// true if it did so. Otherwise (e.g. if "rawMsg" contains a number of nanoseconds),
+// "rawMsg" should be unmarshalled by the json package.
+func unmarshalTimeDuration(rawMsg json.RawMessage, result interface{}) (bool, error) {
+	if !strings.HasPrefix(strings.TrimSpace(string(rawMsg)), `"`) {
+		return false, nil
+	}
+
+	var target *time.Duration
+	switch typedResult := result.(type) {
+	case *time.Duration:
+		target = typedResult
+	case **time.Duration:
+		if *typedResult == nil {
+			*typedResult = new(time.Duration)
+		}
+		target = *typedResult
+	default:
+		return false, nil
+	}
+
+	var durationString string
+	if err := json.Unmarshal(rawMsg, &durationString); err != nil {
+		return true, err
+	}
+	d, err := ParseTimeDuration(durationString)
+	if err != nil {
+		return true, err
+	}
+	*target = d
+	return true, nil
+}
+
+// Interval is an ISO 8601 time interval, which is represented as "<start>/<end>",
+// "<start>/<duration>" or "<duration>/<end>" (e.g. "2021-03-01T00:00:00Z/P1M").
+// An Interval is marshalled to (and unmarshalled from) a JSON string in the "<start>/<end>" format.
+type Interval struct {
+	Start strfmt.DateTime
+	End   strfmt.DateTime
+}
+
+// ParseInterval parses the specified ISO 8601 time interval string and returns an Interval instance.
+func ParseInterval(intervalString string) (*Interval, error) {
+	parts := strings.Split(intervalString, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf(ERRORMSG_INTERVAL_INVALID, intervalString, "expected two parts separated by '/'")
+	}
+	isDuration := func(part string) bool {
+		return strings.HasPrefix(part, "P")
+	}
+	if isDuration(parts[0]) && isDuration(parts[1]) {
+		return nil, fmt.Errorf(ERRORMSG_INTERVAL_INVALID, intervalString, "expected a start or end time")
+	}
+
+	interval := &Interval{}
+	var err error
+	if !isDuration(parts[0]) {
+		if interval.Start, err = ParseDateTime(parts[0]); err != nil {
+			return nil, fmt.Errorf(ERRORMSG_INTERVAL_INVALID, intervalString, err.Error())
+		}
+	}
+	if !isDuration(parts[1]) {
+		if interval.End, err = ParseDateTime(parts[1]); err != nil {
+			return nil, fmt.Errorf(ERRORMSG_INTERVAL_INVALID, intervalString, err.Error())
+		}
+	}
+
+	// Compute the start or end time from the interval's duration, if necessary.
+	if isDuration(parts[0]) || isDuration(parts[1]) {
+		durationString := parts[0]
+		if isDuration(parts[1]) {
+			durationString = parts[1]
+		}
+		duration, err := ParseDuration(durationString)
+		if err != nil {
+			return nil, fmt.Errorf(ERRORMSG_INTERVAL_INVALID, intervalString, err.Error())
+		}
+		if isDuration(parts[1]) {
+			interval.End = strfmt.DateTime(duration.AddTo(time.Time(interval.Start)))
+		} else {
+			duration.Negative = !duration.Negative
+			interval.Start = strfmt.DateTime(duration.AddTo(time.Time(interval.End)))
+		}
+	}
+	return interval, nil
+}
+
+// Duration returns the length of the interval.
+func (interval Interval) Duration() time.Duration {
+	return time.Time(interval.End).Sub(time.Time(interval.Start))
+}
+
+// String returns the ISO 8601 representation of the interval in the "<start>/<end>" format.
+func (interval Interval) String() string {
+	return interval.Start.String() + "/" + interval.End.String()
+}
+
+// MarshalJSON marshals the interval as a JSON string in ISO 8601 format.
+func (interval Interval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(interval.String())
+}
+
+// UnmarshalJSON unmarshals a JSON string in ISO 8601 format into the interval.
+func (interval *Interval) UnmarshalJSON(data []byte) error {
+	var intervalString string
+	if err := json.Unmarshal(data, &intervalString); err != nil {
+		return err
+	}
+	parsed, err := ParseInterval(intervalString)
+	if err != nil {
+		return err
+	}
+	*interval = *parsed
+	return nil
+}
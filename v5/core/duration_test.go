@@ -0,0 +1,137 @@
+// +build all fast
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	duration, err := ParseDuration("P1Y2M3W4DT5H6M7.25S")
+	assert.Nil(t, err)
+	assert.Equal(t, &Duration{Years: 1, Months: 2, Weeks: 3, Days: 4, Hours: 5, Minutes: 6, Seconds: 7, Nanoseconds: 250000000}, duration)
+	assert.Equal(t, "P1Y2M3W4DT5H6M7.25S", duration.String())
+
+	duration, err = ParseDuration("-PT0,5S")
+	assert.Nil(t, err)
+	assert.Equal(t, &Duration{Negative: true, Nanoseconds: 500000000}, duration)
+	assert.Equal(t, "-PT0.5S", duration.String())
+
+	assert.Equal(t, "PT0S", Duration{}.String())
+
+	for _, invalid := range []string{"", "P", "PT", "P1DT", "1D", "P1.5D", "PT1S2M", "P99999999999999999999D"} {
+		_, err = ParseDuration(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestParseTimeDuration(t *testing.T) {
+	d, err := ParseTimeDuration("P1DT1H30M")
+	assert.Nil(t, err)
+	assert.Equal(t, 25*time.Hour+30*time.Minute, d)
+
+	d, err = ParseTimeDuration("-PT1.000000001S")
+	assert.Nil(t, err)
+	assert.Equal(t, -(time.Second + time.Nanosecond), d)
+
+	_, err = ParseTimeDuration("P1M")
+	assert.Equal(t, "The ISO 8601 duration 'P1M' contains years or months, so it has no fixed length", err.Error())
+	_, err = ParseTimeDuration("P300000W")
+	assert.Equal(t, "The ISO 8601 duration 'P300000W' is too long to be represented as a time.Duration", err.Error())
+
+	assert.Equal(t, "PT1H30M", FormatTimeDuration(90*time.Minute))
+	assert.Equal(t, "-PT0.001S", FormatTimeDuration(-time.Millisecond))
+	assert.Equal(t, "PT0S", FormatTimeDuration(0))
+
+	// NewDuration() and TimeDuration() are inverses, even at the limits of time.Duration.
+	for _, d := range []time.Duration{math.MaxInt64, math.MinInt64 + 1, 36 * time.Hour} {
+		roundTripped, err := NewDuration(d).TimeDuration()
+		assert.Nil(t, err)
+		assert.Equal(t, d, roundTripped)
+	}
+}
+
+func TestDurationAddTo(t *testing.T) {
+	start := time.Date(2021, time.January, 31, 12, 0, 0, 0, time.UTC)
+	duration, err := ParseDuration("P1M1DT1H")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2021, time.March, 4, 13, 0, 0, 0, time.UTC), duration.AddTo(start))
+	duration.Negative = true
+	assert.Equal(t, time.Date(2020, time.December, 30, 11, 0, 0, 0, time.UTC), duration.AddTo(start))
+}
+
+func TestDurationJSON(t *testing.T) {
+	type schedule struct {
+		Period   *Duration `json:"period,omitempty"`
+		Interval Interval  `json:"interval"`
+	}
+
+	var s schedule
+	err := json.Unmarshal([]byte(`{"period":"P1Y","interval":"2021-03-01T00:00:00Z/P1M"}`), &s)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), s.Period.Years)
+	assert.Equal(t, 31*24*time.Hour, s.Interval.Duration())
+
+	buf, err := json.Marshal(s)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"period":"P1Y","interval":"2021-03-01T00:00:00.000Z/2021-04-01T00:00:00.000Z"}`, string(buf))
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"period":"1Y"}`), &s))
+	assert.NotNil(t, json.Unmarshal([]byte(`{"period":3}`), &s))
+}
+
+func TestParseInterval(t *testing.T) {
+	interval, err := ParseInterval("2021-03-01T00:00:00Z/2021-03-02T12:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, 36*time.Hour, interval.Duration())
+
+	interval, err = ParseInterval("PT2H/2021-03-01T00:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, "2021-02-28T22:00:00.000Z/2021-03-01T00:00:00.000Z", interval.String())
+
+	for _, invalid := range []string{"2021-03-01T00:00:00Z", "P1D/P2D", "2021-03-01T00:00:00Z/P", "yesterday/P1D", "a/b/c"} {
+		_, err = ParseInterval(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestUnmarshalPrimitiveTimeDuration(t *testing.T) {
+	var rawMap map[string]json.RawMessage
+	err := json.Unmarshal([]byte(`{"timeout":"PT30S","delay":1000,"ttl":"P1D","bad":"P1M","null":null}`), &rawMap)
+	assert.Nil(t, err)
+
+	var timeout, delay time.Duration
+	assert.Nil(t, UnmarshalPrimitive(rawMap, "timeout", &timeout))
+	assert.Equal(t, 30*time.Second, timeout)
+	assert.Nil(t, UnmarshalPrimitive(rawMap, "delay", &delay))
+	assert.Equal(t, time.Microsecond, delay)
+
+	var ttl, null *time.Duration
+	assert.Nil(t, UnmarshalPrimitive(rawMap, "ttl", &ttl))
+	assert.Equal(t, 24*time.Hour, *ttl)
+	assert.Nil(t, UnmarshalPrimitive(rawMap, "null", &null))
+	assert.Nil(t, null)
+
+	err = UnmarshalPrimitive(rawMap, "bad", &timeout)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "error unmarshalling property 'bad'")
+}
@@ -0,0 +1,212 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The default URL of the IBM Cloud Global Catalog API.
+	defaultGlobalCatalogURL = "https://globalcatalog.cloud.ibm.com/api/v1"
+
+	// The default path (relative to the catalog URL) of the operation that
+	// returns a service's endpoints.
+	defaultGlobalCatalogEndpointsPath = "/{service_name}/endpoints"
+
+	// The default length of time that a service's endpoints are cached.
+	defaultEndpointCacheTTL = time.Hour
+)
+
+// Service endpoint types.
+const (
+	EndpointTypePublic  = "public"
+	EndpointTypePrivate = "private"
+	EndpointTypeDirect  = "direct"
+)
+
+// ServiceEndpoint describes a regional endpoint of a service.
+type ServiceEndpoint struct {
+	// The region (e.g. "us-south") in which the endpoint is located.
+	Region string `json:"region"`
+
+	// The type of the endpoint (e.g. "public", "private").
+	Type string `json:"type"`
+
+	// The service URL associated with the endpoint.
+	URL string `json:"url"`
+}
+
+// serviceEndpoints is the response body of the operation that returns a service's endpoints.
+type serviceEndpoints struct {
+	Endpoints []ServiceEndpoint `json:"endpoints"`
+}
+
+// GlobalCatalogResolverOptions holds the configuration of a GlobalCatalogResolver.
+type GlobalCatalogResolverOptions struct {
+	// The name (or id) of the service within the Global Catalog [required].
+	ServiceName string
+
+	// The URL of the Global Catalog API [optional].
+	URL string
+
+	// The path (relative to URL) of the operation that returns the service's endpoints.
+	// The "{service_name}" path parameter is replaced with the ServiceName value [optional].
+	EndpointsPath string
+
+	// The authenticator used to authenticate requests to the Global Catalog;
+	// defaults to a NoAuthAuthenticator [optional].
+	Authenticator Authenticator
+
+	// The HTTP client used to invoke the Global Catalog [optional].
+	Client *http.Client
+
+	// The length of time that the service's endpoints are cached; defaults to 1 hour [optional].
+	CacheTTL time.Duration
+}
+
+// GlobalCatalogResolver discovers the regional endpoints of a service by querying the
+// IBM Cloud Global Catalog, as an alternative to a static list of endpoints.
+// This allows tools to work in new regions without requiring an SDK update.
+//
+// The endpoints operation is expected to return a JSON object of the form:
+//
+//	{"endpoints": [{"region": "us-south", "type": "public", "url": "https://..."}]}
+//
+// The endpoints are cached for the configured CacheTTL. If the endpoints cannot be
+// retrieved once the cache has expired, the previously-retrieved endpoints are used.
+// A GlobalCatalogResolver is safe for concurrent use.
+type GlobalCatalogResolver struct {
+	options GlobalCatalogResolverOptions
+	service *BaseService
+
+	// The cached endpoints, along with the time at which they expire.
+	endpoints []ServiceEndpoint
+	expiresAt time.Time
+	mutex     sync.Mutex
+}
+
+// NewGlobalCatalogResolver returns a new GlobalCatalogResolver instance.
+func NewGlobalCatalogResolver(options *GlobalCatalogResolverOptions) (*GlobalCatalogResolver, error) {
+	if options == nil || options.ServiceName == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ServiceName")
+	}
+
+	resolver := &GlobalCatalogResolver{
+		options: *options,
+	}
+	if resolver.options.URL == "" {
+		resolver.options.URL = defaultGlobalCatalogURL
+	}
+	if resolver.options.EndpointsPath == "" {
+		resolver.options.EndpointsPath = defaultGlobalCatalogEndpointsPath
+	}
+	if IsNil(resolver.options.Authenticator) {
+		resolver.options.Authenticator = &NoAuthAuthenticator{}
+	}
+	if resolver.options.CacheTTL <= 0 {
+		resolver.options.CacheTTL = defaultEndpointCacheTTL
+	}
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           resolver.options.URL,
+		Authenticator: resolver.options.Authenticator,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resolver.options.Client != nil {
+		service.SetHTTPClient(resolver.options.Client)
+	}
+	resolver.service = service
+
+	return resolver, nil
+}
+
+// GetEndpoints returns the service's endpoints, retrieving them from the Global Catalog
+// if they are not already cached.
+func (resolver *GlobalCatalogResolver) GetEndpoints(ctx context.Context) ([]ServiceEndpoint, error) {
+	resolver.mutex.Lock()
+	defer resolver.mutex.Unlock()
+
+	if resolver.endpoints != nil && time.Now().Before(resolver.expiresAt) {
+		return resolver.endpoints, nil
+	}
+
+	endpoints, err := resolver.fetchEndpoints(ctx)
+	if err != nil {
+		if resolver.endpoints != nil {
+			GetLogger().Warn("Unable to refresh the endpoints of service '%s', using cached endpoints: %s",
+				resolver.options.ServiceName, err.Error())
+			return resolver.endpoints, nil
+		}
+		return nil, err
+	}
+
+	resolver.endpoints = endpoints
+	resolver.expiresAt = time.Now().Add(resolver.options.CacheTTL)
+	return endpoints, nil
+}
+
+// ResolveServiceURL returns the service URL associated with the endpoint of the
+// specified type (e.g. EndpointTypePublic) in the specified region.
+func (resolver *GlobalCatalogResolver) ResolveServiceURL(ctx context.Context, region string, endpointType string) (string, error) {
+	endpoints, err := resolver.GetEndpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, endpoint := range endpoints {
+		if strings.EqualFold(endpoint.Region, region) && strings.EqualFold(endpoint.Type, endpointType) {
+			return endpoint.URL, nil
+		}
+	}
+	return "", fmt.Errorf(ERRORMSG_ENDPOINT_NOT_FOUND, endpointType, region, resolver.options.ServiceName)
+}
+
+// fetchEndpoints retrieves the service's endpoints from the Global Catalog.
+func (resolver *GlobalCatalogResolver) fetchEndpoints(ctx context.Context) ([]ServiceEndpoint, error) {
+	builder := NewRequestBuilder(GET)
+	builder.WithContext(ctx)
+	_, err := builder.ResolveRequestURL(resolver.options.URL, resolver.options.EndpointsPath,
+		map[string]string{"service_name": resolver.options.ServiceName})
+	if err != nil {
+		return nil, err
+	}
+	builder.AddHeader(Accept, APPLICATION_JSON)
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var result *serviceEndpoints
+	_, err = resolver.service.Request(req, &result)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return []ServiceEndpoint{}, nil
+	}
+	if result.Endpoints == nil {
+		result.Endpoints = []ServiceEndpoint{}
+	}
+	return result.Endpoints, nil
+}
@@ -0,0 +1,110 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const endpointsResponseBody = `{"endpoints": [
+	{"region": "us-south", "type": "public", "url": "https://us-south.myservice.cloud.ibm.com"},
+	{"region": "us-south", "type": "private", "url": "https://private.us-south.myservice.cloud.ibm.com"},
+	{"region": "eu-de", "type": "public", "url": "https://eu-de.myservice.cloud.ibm.com"}
+]}`
+
+func TestGlobalCatalogResolver(t *testing.T) {
+	var requests int32
+	var failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Equal(t, "/my-service/endpoints", r.URL.Path)
+		assert.Equal(t, "Bearer my-token", r.Header.Get("Authorization"))
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, endpointsResponseBody)
+	}))
+	defer server.Close()
+
+	authenticator, _ := NewBearerTokenAuthenticator("my-token")
+	resolver, err := NewGlobalCatalogResolver(&GlobalCatalogResolverOptions{
+		ServiceName:   "my-service",
+		URL:           server.URL,
+		Authenticator: authenticator,
+		CacheTTL:      20 * time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	url, err := resolver.ResolveServiceURL(context.Background(), "us-south", EndpointTypePrivate)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://private.us-south.myservice.cloud.ibm.com", url)
+
+	url, err = resolver.ResolveServiceURL(context.Background(), "EU-DE", EndpointTypePublic)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://eu-de.myservice.cloud.ibm.com", url)
+
+	_, err = resolver.ResolveServiceURL(context.Background(), "eu-de", EndpointTypeDirect)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_ENDPOINT_NOT_FOUND, "direct", "eu-de", "my-service"), err.Error())
+
+	// The endpoints were retrieved only once.
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Once the cache expires, the endpoints are retrieved again, and if that fails,
+	// the previously-retrieved endpoints are used.
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&failing, 1)
+	endpoints, err := resolver.GetEndpoints(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, endpoints, 3)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestGlobalCatalogResolverErrors(t *testing.T) {
+	_, err := NewGlobalCatalogResolver(nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ServiceName"), err.Error())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	resolver, err := NewGlobalCatalogResolver(&GlobalCatalogResolverOptions{
+		ServiceName: "my-service",
+		URL:         server.URL,
+	})
+	assert.Nil(t, err)
+	_, err = resolver.ResolveServiceURL(context.Background(), "us-south", EndpointTypePublic)
+	assert.NotNil(t, err)
+	assert.True(t, IsNotFound(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = resolver.GetEndpoints(ctx)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,215 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default weight of each new sample within the smoothed latency and error rate of an endpoint.
+const defaultEndpointStatsSmoothing = 0.2
+
+// EndpointStats describes the requests sent by a service to an endpoint (i.e. a scheme and host,
+// such as "https://us-south.myservice.cloud.ibm.com"). The latency and error rate are exponentially
+// weighted moving averages of the attempts to send a request to the endpoint (including retries),
+// so they reflect the endpoint's recent behavior.
+type EndpointStats struct {
+	// The scheme and host of the endpoint (in lower case).
+	Endpoint string
+
+	// The smoothed time taken to receive the response headers (or an error).
+	Latency time.Duration
+
+	// The smoothed fraction (0-1) of the attempts that failed due to an outage of the endpoint,
+	// i.e. a 5xx status code or a retryable transport error (see IsRetryableTransportError()).
+	ErrorRate float64
+
+	// The number of attempts (excluding canceled attempts), and the time of the most recent attempt.
+	Attempts    int64
+	LastAttempt time.Time
+}
+
+// GetEndpointStats returns the stats of each endpoint to which the service (or one of its clones)
+// has sent a request, sorted by endpoint. They can be used to choose the endpoint of a request
+// (e.g. the endpoint with the lowest latency), or to detect a degraded endpoint.
+func (service *BaseService) GetEndpointStats() []EndpointStats {
+	return service.getEndpointStatsTracker().list()
+}
+
+// GetEndpointStatsFor returns the stats of the endpoint (i.e. the scheme and host) of "endpointURL"
+// (e.g. the service URL), or false if the service hasn't sent a request to the endpoint.
+func (service *BaseService) GetEndpointStatsFor(endpointURL string) (EndpointStats, bool) {
+	return service.getEndpointStatsTracker().get(endpointOfURL(endpointURL))
+}
+
+// SetEndpointStatsSmoothing sets the weight (greater than 0, up to 1) of each new sample within the
+// smoothed latency and error rate of an endpoint (see GetEndpointStats()). A higher weight reacts
+// faster to changes in the endpoint's behavior, but is more sensitive to outliers. The default is 0.2.
+func (service *BaseService) SetEndpointStatsSmoothing(smoothing float64) error {
+	if smoothing <= 0 || smoothing > 1 {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "smoothing")
+	}
+	service.getEndpointStatsTracker().setSmoothing(smoothing)
+	return nil
+}
+
+// getEndpointStatsTracker returns the service's endpoint stats tracker (shared with its clones).
+func (service *BaseService) getEndpointStatsTracker() *endpointStatsTracker {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.endpointStats
+}
+
+// endpointStatsTracker tracks the stats of the endpoints to which a service sends requests.
+type endpointStatsTracker struct {
+	smoothing float64
+	endpoints map[string]*EndpointStats
+	mutex     sync.Mutex
+}
+
+func newEndpointStatsTracker() *endpointStatsTracker {
+	return &endpointStatsTracker{
+		smoothing: defaultEndpointStatsSmoothing,
+		endpoints: make(map[string]*EndpointStats),
+	}
+}
+
+// setSmoothing sets the weight of each new sample.
+func (tracker *endpointStatsTracker) setSmoothing(smoothing float64) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.smoothing = smoothing
+}
+
+// record adds an attempt to send a request to "endpoint", which took "latency" and failed
+// due to an outage of the endpoint iff "failed" is true.
+func (tracker *endpointStatsTracker) record(endpoint string, latency time.Duration, failed bool) {
+	if tracker == nil {
+		return
+	}
+
+	errorSample := 0.0
+	if failed {
+		errorSample = 1.0
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	stats := tracker.endpoints[endpoint]
+	if stats == nil {
+		// The first sample initializes the averages.
+		tracker.endpoints[endpoint] = &EndpointStats{
+			Endpoint:    endpoint,
+			Latency:     latency,
+			ErrorRate:   errorSample,
+			Attempts:    1,
+			LastAttempt: GetClock().Now(),
+		}
+		return
+	}
+
+	weight := tracker.smoothing
+	stats.Latency = time.Duration(weight*float64(latency) + (1-weight)*float64(stats.Latency))
+	stats.ErrorRate = weight*errorSample + (1-weight)*stats.ErrorRate
+	stats.Attempts++
+	stats.LastAttempt = GetClock().Now()
+}
+
+// get returns the stats of "endpoint", if any.
+func (tracker *endpointStatsTracker) get(endpoint string) (EndpointStats, bool) {
+	if tracker == nil {
+		return EndpointStats{}, false
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	stats := tracker.endpoints[endpoint]
+	if stats == nil {
+		return EndpointStats{}, false
+	}
+	return *stats, true
+}
+
+// list returns the stats of each endpoint, sorted by endpoint.
+func (tracker *endpointStatsTracker) list() []EndpointStats {
+	if tracker == nil {
+		return nil
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	list := make([]EndpointStats, 0, len(tracker.endpoints))
+	for _, stats := range tracker.endpoints {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Endpoint < list[j].Endpoint
+	})
+	return list
+}
+
+// transport returns a RoundTripper that records each attempt to send a request via "next".
+func (tracker *endpointStatsTracker) transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &endpointStatsTransport{tracker: tracker, next: next}
+}
+
+// endpointStatsTransport is the http.RoundTripper returned by endpointStatsTracker.transport.
+type endpointStatsTransport struct {
+	tracker *endpointStatsTracker
+	next    http.RoundTripper
+}
+
+func (transport *endpointStatsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := transport.next.RoundTrip(req)
+
+	// An attempt canceled by the client says nothing about the endpoint.
+	if err == nil || ClassifyTransportError(err) != TransportErrorCanceled {
+		transport.tracker.record(endpointOf(req.URL), time.Since(start), isOutage(resp, err))
+	}
+	return resp, err
+}
+
+// endpointOf returns the endpoint (i.e. the scheme and host, in lower case) of "u".
+func endpointOf(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// endpointOfURL returns the endpoint of "rawURL", or "" if it can't be parsed.
+func endpointOfURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return endpointOf(u)
+}
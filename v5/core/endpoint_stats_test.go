@@ -0,0 +1,119 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointStatsSmoothing(t *testing.T) {
+	tracker := newEndpointStatsTracker()
+	tracker.setSmoothing(0.5)
+
+	tracker.record("https://a.example.com", 100*time.Millisecond, false)
+	stats, ok := tracker.get("https://a.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, stats.Latency)
+	assert.Equal(t, 0.0, stats.ErrorRate)
+
+	tracker.record("https://a.example.com", 200*time.Millisecond, true)
+	tracker.record("https://a.example.com", 300*time.Millisecond, true)
+	stats, _ = tracker.get("https://a.example.com")
+	assert.Equal(t, 225*time.Millisecond, stats.Latency)
+	assert.Equal(t, 0.75, stats.ErrorRate)
+	assert.Equal(t, int64(3), stats.Attempts)
+
+	tracker.record("https://b.example.com", time.Second, false)
+	list := tracker.list()
+	assert.Len(t, list, 2)
+	assert.Equal(t, "https://a.example.com", list[0].Endpoint)
+	assert.Equal(t, "https://b.example.com", list[1].Endpoint)
+
+	_, ok = tracker.get("https://c.example.com")
+	assert.False(t, ok)
+
+	// A nil tracker records nothing.
+	var nilTracker *endpointStatsTracker
+	nilTracker.record("https://a.example.com", time.Second, false)
+	assert.Nil(t, nilTracker.list())
+}
+
+func TestEndpointStats(t *testing.T) {
+	status := int32(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL + "/api/v1",
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, service.SetEndpointStatsSmoothing(0))
+	assert.NotNil(t, service.SetEndpointStatsSmoothing(1.5))
+	assert.Nil(t, service.SetEndpointStatsSmoothing(0.5))
+	assert.Empty(t, service.GetEndpointStats())
+
+	send := func(ctx context.Context) {
+		builder := NewRequestBuilder(GET).WithContext(ctx)
+		_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resources", nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		_, _ = service.Request(req, nil)
+	}
+
+	send(context.Background())
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	send(context.Background())
+
+	stats, ok := service.GetEndpointStatsFor(service.GetServiceURL())
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), stats.Attempts)
+	assert.Equal(t, 0.5, stats.ErrorRate)
+	assert.True(t, stats.Latency >= 10*time.Millisecond)
+	assert.Equal(t, []EndpointStats{stats}, service.GetEndpointStats())
+
+	// A canceled attempt isn't recorded.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	send(ctx)
+	stats, _ = service.GetEndpointStatsFor(server.URL)
+	assert.Equal(t, int64(2), stats.Attempts)
+
+	// The stats are shared with the service's clones.
+	atomic.StoreInt32(&status, http.StatusOK)
+	send(context.Background())
+	clone := service.Clone()
+	stats, _ = clone.GetEndpointStatsFor(server.URL)
+	assert.Equal(t, int64(3), stats.Attempts)
+	assert.Equal(t, 0.25, stats.ErrorRate)
+
+	_, ok = service.GetEndpointStatsFor("https://other.example.com")
+	assert.False(t, ok)
+	_, ok = service.GetEndpointStatsFor("not a url")
+	assert.False(t, ok)
+}
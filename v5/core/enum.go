@@ -0,0 +1,129 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Enum describes the known values of an enum-like string type (e.g. the values of a model
+// property that were defined when the SDK was generated). A newer version of a service may
+// return a value that is unknown to the SDK; such a value is preserved as-is (rather than
+// causing an unmarshalling error or being replaced), and can be detected with IsKnown().
+//
+// A generated SDK would typically define an enum type as follows:
+//
+//	type InstanceStatus string
+//
+//	var instanceStatusEnum = core.NewEnum("InstanceStatus", "running", "stopped")
+//
+//	// IsKnown returns true iff the status is one of the values known to this SDK.
+//	func (status InstanceStatus) IsKnown() bool {
+//		return instanceStatusEnum.IsKnown(string(status))
+//	}
+type Enum struct {
+	name   string
+	values []string
+	known  map[string]bool
+
+	// The unknown values that have already been logged.
+	loggedValues sync.Map
+}
+
+// NewEnum returns an Enum named "name" whose known values are "values".
+func NewEnum(name string, values ...string) *Enum {
+	enum := &Enum{
+		name:   name,
+		values: append([]string(nil), values...),
+		known:  make(map[string]bool, len(values)),
+	}
+	for _, value := range values {
+		enum.known[value] = true
+	}
+	return enum
+}
+
+// Name returns the name of the enum.
+func (enum *Enum) Name() string {
+	return enum.name
+}
+
+// Values returns the known values of the enum, in the order in which they were specified.
+func (enum *Enum) Values() []string {
+	return append([]string(nil), enum.values...)
+}
+
+// IsKnown returns true iff "value" is one of the known values of the enum.
+func (enum *Enum) IsKnown(value string) bool {
+	return enum.known[value]
+}
+
+// Validate returns an error if "value" is not one of the known values of the enum.
+// This is intended for values supplied by the user (e.g. in a request), rather than
+// values returned by the service.
+func (enum *Enum) Validate(value string) error {
+	if !enum.IsKnown(value) {
+		return fmt.Errorf(ERRORMSG_ENUM_VALUE_UNKNOWN, value, enum.name, enum.values)
+	}
+	return nil
+}
+
+// observe logs a message (once per value) if "value" is not one of the known values of the enum.
+func (enum *Enum) observe(value string) {
+	if enum.IsKnown(value) {
+		return
+	}
+	if _, logged := enum.loggedValues.LoadOrStore(value, true); !logged {
+		GetLogger().Debug("Received the value '%s', which is unknown to this SDK, for enum '%s'; the service may be newer than the SDK",
+			value, enum.name)
+	}
+}
+
+// UnmarshalEnum retrieves the specified property from 'rawInput', then unmarshals the resulting
+// value into 'result' (as UnmarshalPrimitive() does). 'result' must be a pointer to a string (or a
+// string-based enum type), a pointer to such a pointer, or a pointer to a slice or map of such strings.
+// Values that are unknown to 'enum' are preserved, and a debug message is logged the first time
+// that each unknown value is received.
+func UnmarshalEnum(rawInput map[string]json.RawMessage, propertyName string, result interface{}, enum *Enum) error {
+	if err := UnmarshalPrimitive(rawInput, propertyName, result); err != nil {
+		return err
+	}
+	observeEnumValues(reflect.ValueOf(result), enum)
+	return nil
+}
+
+// observeEnumValues invokes enum.observe() on each string contained in "value".
+func observeEnumValues(value reflect.Value, enum *Enum) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			observeEnumValues(value.Elem(), enum)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			observeEnumValues(value.Index(i), enum)
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			observeEnumValues(iter.Value(), enum)
+		}
+	case reflect.String:
+		enum.observe(value.String())
+	}
+}
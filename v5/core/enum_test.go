@@ -0,0 +1,81 @@
+// +build all fast
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testInstanceStatus string
+
+var testInstanceStatusEnum = NewEnum("InstanceStatus", "running", "stopped")
+
+func (status testInstanceStatus) IsKnown() bool {
+	return testInstanceStatusEnum.IsKnown(string(status))
+}
+
+func TestEnum(t *testing.T) {
+	assert.Equal(t, "InstanceStatus", testInstanceStatusEnum.Name())
+	assert.Equal(t, []string{"running", "stopped"}, testInstanceStatusEnum.Values())
+	assert.True(t, testInstanceStatus("running").IsKnown())
+	assert.False(t, testInstanceStatus("hibernating").IsKnown())
+
+	assert.Nil(t, testInstanceStatusEnum.Validate("stopped"))
+	err := testInstanceStatusEnum.Validate("hibernating")
+	assert.Equal(t, "'hibernating' is not a valid value for 'InstanceStatus' (expected one of [running stopped])", err.Error())
+}
+
+func TestUnmarshalEnum(t *testing.T) {
+	original := GetLogger()
+	defer SetLogger(original)
+	buf, _, logger := stringLogger(LevelDebug)
+	SetLogger(logger)
+
+	type instance struct {
+		Status      *string
+		History     []testInstanceStatus
+		ByZone      map[string]string
+		Unspecified *string
+	}
+	var rawMap map[string]json.RawMessage
+	err := json.Unmarshal([]byte(`{"status":"hibernating","history":["running","hibernating"],"by_zone":{"z1":"stopped"}}`), &rawMap)
+	assert.Nil(t, err)
+
+	// Unknown values are preserved.
+	result := &instance{}
+	assert.Nil(t, UnmarshalEnum(rawMap, "status", &result.Status, testInstanceStatusEnum))
+	assert.Equal(t, "hibernating", *result.Status)
+	assert.Nil(t, UnmarshalEnum(rawMap, "history", &result.History, testInstanceStatusEnum))
+	assert.Equal(t, []testInstanceStatus{"running", "hibernating"}, result.History)
+	assert.False(t, result.History[1].IsKnown())
+	assert.Nil(t, UnmarshalEnum(rawMap, "by_zone", &result.ByZone, testInstanceStatusEnum))
+	assert.Equal(t, map[string]string{"z1": "stopped"}, result.ByZone)
+	assert.Nil(t, UnmarshalEnum(rawMap, "unspecified", &result.Unspecified, testInstanceStatusEnum))
+	assert.Nil(t, result.Unspecified)
+
+	// Each unknown value is logged only once.
+	assert.Equal(t, 1, strings.Count(buf.String(), "Received the value 'hibernating'"))
+
+	var number int64
+	err = UnmarshalEnum(rawMap, "status", &number, testInstanceStatusEnum)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,240 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Error categories assigned by DefaultErrorCategory.
+const (
+	ErrorCategoryAuthentication = "authentication"
+	ErrorCategoryCanceled       = "canceled"
+	ErrorCategoryTimeout        = "timeout"
+	ErrorCategoryTransport      = "transport"
+	ErrorCategoryOther          = "other"
+)
+
+// ErrorCategory summarizes the errors within an ErrorCollection that share a category.
+type ErrorCategory struct {
+	// The name of the category (e.g. "404 Not Found", "transport").
+	Name string
+
+	// The number of errors in the category.
+	Count int
+
+	// The first and last errors added to the category.
+	First error
+	Last  error
+}
+
+// ErrorCollection aggregates the per-item errors of a batch operation (e.g. a bulk
+// operation's multi-status failures, or the failures of many individual requests)
+// into a single error whose message summarizes the errors by category, rather than
+// concatenating every error message.
+//
+// The individual errors remain visible to errors.Is() and errors.As(), and are
+// returned by the Unwrap() []error method recognized by errors.Join() compatible code.
+// An ErrorCollection is safe for concurrent use.
+type ErrorCollection struct {
+	categorize func(err error) string
+
+	mutex      sync.Mutex
+	errs       []error
+	categories map[string]*ErrorCategory
+}
+
+// NewErrorCollection returns a new, empty ErrorCollection.
+// The "categorize" function returns the category of an error;
+// if nil, DefaultErrorCategory is used.
+func NewErrorCollection(categorize func(err error) string) *ErrorCollection {
+	if categorize == nil {
+		categorize = DefaultErrorCategory
+	}
+	return &ErrorCollection{
+		categorize: categorize,
+		categories: make(map[string]*ErrorCategory),
+	}
+}
+
+// DefaultErrorCategory returns the category of "err": the status code and text
+// (e.g. "404 Not Found") of an error associated with an HTTP response, or one of
+// the ErrorCategory* constants.
+func DefaultErrorCategory(err error) string {
+	if statusCode := getStatusCode(err); statusCode != 0 {
+		return fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+	}
+
+	var authErr *AuthenticationError
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorCategoryCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCategoryTimeout
+	case errors.As(err, &authErr):
+		return ErrorCategoryAuthentication
+	case errors.As(err, &urlErr):
+		if urlErr.Timeout() {
+			return ErrorCategoryTimeout
+		}
+		return ErrorCategoryTransport
+	}
+	return ErrorCategoryOther
+}
+
+// Add adds "err" to the collection. A nil error is ignored.
+func (c *ErrorCollection) Add(err error) {
+	if err == nil {
+		return
+	}
+	category := c.categorize(err)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.errs = append(c.errs, err)
+	summary, ok := c.categories[category]
+	if !ok {
+		summary = &ErrorCategory{Name: category, First: err}
+		c.categories[category] = summary
+	}
+	summary.Count++
+	summary.Last = err
+}
+
+// AddMultiStatusFailures adds an error (an HTTPError) for each unsuccessful item
+// within a multi-status result.
+func (c *ErrorCollection) AddMultiStatusFailures(result *MultiStatusResult) {
+	if result == nil {
+		return
+	}
+	for _, item := range result.Failures() {
+		message := item.ErrorMessage
+		if message == "" {
+			message = http.StatusText(item.Status)
+		}
+		if item.ID != "" {
+			message = fmt.Sprintf("%s: %s", item.ID, message)
+		}
+		c.Add(&HTTPError{StatusCode: item.Status, Message: message})
+	}
+}
+
+// Len returns the number of errors in the collection.
+func (c *ErrorCollection) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.errs)
+}
+
+// Errors returns the errors in the collection, in the order in which they were added.
+func (c *ErrorCollection) Errors() []error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]error(nil), c.errs...)
+}
+
+// Categories returns a summary of each category of errors in the collection,
+// ordered from the most to the least frequent category.
+func (c *ErrorCollection) Categories() []ErrorCategory {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	categories := make([]ErrorCategory, 0, len(c.categories))
+	for _, category := range c.categories {
+		categories = append(categories, *category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Count != categories[j].Count {
+			return categories[i].Count > categories[j].Count
+		}
+		return categories[i].Name < categories[j].Name
+	})
+	return categories
+}
+
+// Err returns the collection as an error, or nil if the collection is empty.
+func (c *ErrorCollection) Err() error {
+	if c.Len() == 0 {
+		return nil
+	}
+	return c
+}
+
+// Error returns a summary of the errors in the collection, for example:
+//
+//	5000 errors occurred: 4990 x 404 Not Found (first: item-1: not found, last: item-4990: not found); 10 x transport (...)
+func (c *ErrorCollection) Error() string {
+	categories := c.Categories()
+	total := 0
+	for _, category := range categories {
+		total += category.Count
+	}
+
+	switch total {
+	case 0:
+		return "no errors occurred"
+	case 1:
+		return categories[0].First.Error()
+	}
+
+	summaries := make([]string, len(categories))
+	for i, category := range categories {
+		if category.Count == 1 {
+			summaries[i] = fmt.Sprintf("1 x %s (%s)", category.Name, category.First.Error())
+		} else {
+			summaries[i] = fmt.Sprintf("%d x %s (first: %s, last: %s)",
+				category.Count, category.Name, category.First.Error(), category.Last.Error())
+		}
+	}
+	return fmt.Sprintf("%d errors occurred: %s", total, strings.Join(summaries, "; "))
+}
+
+// Unwrap returns the errors in the collection, as expected by errors.Is() and errors.As()
+// for errors (such as those returned by errors.Join()) that wrap multiple errors.
+func (c *ErrorCollection) Unwrap() []error {
+	return c.Errors()
+}
+
+// Is returns true iff any error in the collection matches "target" (see errors.Is()).
+func (c *ErrorCollection) Is(target error) bool {
+	for _, err := range c.Errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error in the collection that matches "target"
+// and, if one is found, sets "target" to that error and returns true (see errors.As()).
+func (c *ErrorCollection) As(target interface{}) bool {
+	for _, err := range c.Errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCollection(t *testing.T) {
+	c := NewErrorCollection(nil)
+	assert.Nil(t, c.Err())
+	assert.Equal(t, "no errors occurred", c.Error())
+
+	c.Add(nil)
+	notFound := &HTTPError{StatusCode: 404, Message: "item-1: not found"}
+	c.Add(notFound)
+	assert.Equal(t, "item-1: not found", c.Err().Error())
+
+	for i := 2; i <= 5; i++ {
+		c.Add(&HTTPError{StatusCode: 404, Message: fmt.Sprintf("item-%d: not found", i)})
+	}
+	c.Add(&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection refused")})
+	c.Add(fmt.Errorf("request failed: %w", context.DeadlineExceeded))
+
+	assert.Equal(t, 7, c.Len())
+	assert.Len(t, c.Errors(), 7)
+
+	categories := c.Categories()
+	assert.Len(t, categories, 3)
+	assert.Equal(t, "404 Not Found", categories[0].Name)
+	assert.Equal(t, 5, categories[0].Count)
+	assert.Equal(t, notFound, categories[0].First)
+	assert.Equal(t, "item-5: not found", categories[0].Last.Error())
+	assert.Equal(t, ErrorCategoryTimeout, categories[1].Name)
+	assert.Equal(t, ErrorCategoryTransport, categories[2].Name)
+
+	assert.Equal(t, "7 errors occurred: "+
+		"5 x 404 Not Found (first: item-1: not found, last: item-5: not found); "+
+		"1 x timeout (request failed: context deadline exceeded); "+
+		`1 x transport (Get "https://example.com": connection refused)`, c.Error())
+
+	// The individual errors are visible to errors.Is() and errors.As().
+	err := c.Err()
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.False(t, errors.Is(err, context.Canceled))
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, notFound, httpErr)
+	assert.True(t, IsNotFound(err))
+	assert.Len(t, c.Unwrap(), 7)
+}
+
+func TestErrorCollectionMultiStatus(t *testing.T) {
+	result, err := ParseMultiStatusResult([]byte(`[
+		{"status": 201, "id": "item-1"},
+		{"status": 404, "id": "item-2", "errors": [{"message": "not found"}]},
+		{"status": 409, "id": "item-3"}
+	]`))
+	assert.Nil(t, err)
+
+	c := NewErrorCollection(func(err error) string {
+		if IsClientError(err) {
+			return "client"
+		}
+		return "server"
+	})
+	c.AddMultiStatusFailures(result)
+	c.AddMultiStatusFailures(nil)
+	assert.Equal(t, "2 errors occurred: 2 x client (first: item-2: not found, last: item-3: Conflict)", c.Error())
+}
+
+func TestErrorCollectionConcurrency(t *testing.T) {
+	c := NewErrorCollection(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Add(&HTTPError{StatusCode: 500 + i%2, Message: "error"})
+			_ = c.Error()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 50, c.Len())
+	categories := c.Categories()
+	assert.Equal(t, 25, categories[0].Count)
+	assert.Equal(t, 25, categories[1].Count)
+}
@@ -0,0 +1,139 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// HTTPError is the error returned by BaseService.Request() when an operation
+// completes with a non-2xx status code.
+type HTTPError struct {
+	// The HTTP status code associated with the response.
+	StatusCode int
+
+	// The error message, which is either extracted from the response body
+	// or is the generic text associated with the status code.
+	Message string
+
+	// The DetailedResponse containing the response headers and body.
+	Response *DetailedResponse
+}
+
+// newHTTPError returns a new HTTPError instance for the specified response and message.
+func newHTTPError(response *DetailedResponse, message string) *HTTPError {
+	return &HTTPError{
+		StatusCode: response.StatusCode,
+		Message:    message,
+		Response:   response,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// wrappedError is an error with its own message that retains the error which caused it,
+// so that the cause is still visible to errors.Is() and errors.As().
+type wrappedError struct {
+	message string
+	cause   error
+}
+
+func (e *wrappedError) Error() string {
+	return e.message
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.cause
+}
+
+// getStatusCode returns the HTTP status code associated with "err", or 0 if
+// "err" is not associated with an HTTP response.
+func getStatusCode(err error) int {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) && authErr.Response != nil {
+		return authErr.Response.StatusCode
+	}
+
+	return 0
+}
+
+// isRetryableStatusCode returns true iff a request that received the specified
+// status code should be retried.
+func isRetryableStatusCode(statusCode int) bool {
+	// A 429 should be retryable.
+	// All codes in the 500's range except for 501 (Not Implemented) should be retryable.
+	return statusCode == 429 || (statusCode >= 500 && statusCode <= 599 && statusCode != 501)
+}
+
+// IsRetryable returns true iff "err" represents a failure that is likely to be
+// recoverable by retrying the request, such as a 429 or 5xx (except 501) status code,
+// or a transient error that occurred while communicating with the server (see ClassifyTransportError).
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if statusCode := getStatusCode(err); statusCode != 0 {
+		return isRetryableStatusCode(statusCode)
+	}
+
+	// Other errors are considered only if they were (or were likely) returned by an http.Client.
+	class := ClassifyTransportError(err)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || class != TransportErrorOther {
+		return class.IsRetryable()
+	}
+
+	return false
+}
+
+// IsRateLimited returns true iff "err" represents a 429 (Too Many Requests) response.
+func IsRateLimited(err error) bool {
+	return getStatusCode(err) == http.StatusTooManyRequests
+}
+
+// IsAuthenticationFailure returns true iff "err" represents a failure to authenticate
+// the request, either because the authenticator was unable to obtain an access token
+// or because the server rejected the request with a 401 or 403 status code.
+func IsAuthenticationFailure(err error) bool {
+	var authErr *AuthenticationError
+	if errors.As(err, &authErr) {
+		return true
+	}
+
+	statusCode := getStatusCode(err)
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// IsNotFound returns true iff "err" represents a 404 (Not Found) response.
+func IsNotFound(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+// IsClientError returns true iff "err" represents a response with a 4xx status code.
+func IsClientError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= 400 && httpErr.StatusCode <= 499
+}
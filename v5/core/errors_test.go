@@ -0,0 +1,153 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// invokeWithStatusCode returns the error returned by BaseService.Request() for a
+// server that responds with the specified status code.
+func invokeWithStatusCode(t *testing.T, statusCode int) error {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, `{"error": "operation failed"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	detailedResponse, err := service.Request(req, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "operation failed", err.Error())
+	assert.Equal(t, statusCode, detailedResponse.StatusCode)
+
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, statusCode, httpErr.StatusCode)
+	assert.Equal(t, detailedResponse, httpErr.Response)
+	return err
+}
+
+func TestErrorPredicatesStatusCodes(t *testing.T) {
+	err := invokeWithStatusCode(t, http.StatusNotFound)
+	assert.True(t, IsNotFound(err))
+	assert.True(t, IsClientError(err))
+	assert.False(t, IsRetryable(err))
+	assert.False(t, IsRateLimited(err))
+	assert.False(t, IsAuthenticationFailure(err))
+
+	err = invokeWithStatusCode(t, http.StatusTooManyRequests)
+	assert.True(t, IsRateLimited(err))
+	assert.True(t, IsRetryable(err))
+	assert.True(t, IsClientError(err))
+	assert.False(t, IsNotFound(err))
+
+	err = invokeWithStatusCode(t, http.StatusUnauthorized)
+	assert.True(t, IsAuthenticationFailure(err))
+	assert.True(t, IsClientError(err))
+	assert.False(t, IsRetryable(err))
+
+	err = invokeWithStatusCode(t, http.StatusForbidden)
+	assert.True(t, IsAuthenticationFailure(err))
+
+	err = invokeWithStatusCode(t, http.StatusInternalServerError)
+	assert.True(t, IsRetryable(err))
+	assert.False(t, IsClientError(err))
+
+	err = invokeWithStatusCode(t, http.StatusNotImplemented)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestErrorPredicatesAuthenticationError(t *testing.T) {
+	authErr := NewAuthenticationError(&DetailedResponse{StatusCode: http.StatusServiceUnavailable}, fmt.Errorf("IAM is down"))
+	err := &wrappedError{message: fmt.Sprintf(ERRORMSG_AUTHENTICATE_ERROR, authErr.Error()), cause: authErr}
+	assert.True(t, IsAuthenticationFailure(err))
+	assert.True(t, IsRetryable(err))
+	assert.False(t, IsNotFound(err))
+	assert.False(t, IsClientError(err))
+
+	var castErr *AuthenticationError
+	assert.True(t, errors.As(err, &castErr))
+	assert.Equal(t, "IAM is down", errors.Unwrap(castErr).Error())
+}
+
+func TestErrorPredicatesRequestAuthenticationFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `Sorry you are forbidden!`)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().SetApiKey("my-api-key").SetURL(server.URL).Build()
+	assert.Nil(t, err)
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: authenticator,
+	})
+	assert.Nil(t, err)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	_, err = service.Request(req, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_AUTHENTICATE_ERROR, "Sorry you are forbidden!"), err.Error())
+	assert.True(t, IsAuthenticationFailure(err))
+	assert.False(t, IsRetryable(err))
+}
+
+func TestErrorPredicatesOtherErrors(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRateLimited(nil))
+	assert.False(t, IsAuthenticationFailure(nil))
+	assert.False(t, IsNotFound(nil))
+	assert.False(t, IsClientError(nil))
+
+	err := fmt.Errorf("some validation error")
+	assert.False(t, IsRetryable(err))
+	assert.False(t, IsAuthenticationFailure(err))
+
+	err = &url.Error{Op: "Get", URL: "https://localhost", Err: fmt.Errorf("connection refused")}
+	assert.True(t, IsRetryable(err))
+
+	err = &url.Error{Op: "Get", URL: "badscheme://localhost", Err: fmt.Errorf("unsupported protocol scheme \"badscheme\"")}
+	assert.False(t, IsRetryable(err))
+
+	err = &url.Error{Op: "Get", URL: "https://localhost", Err: context.DeadlineExceeded}
+	assert.False(t, IsRetryable(err))
+}
@@ -0,0 +1,134 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The header used to enable experimental features.
+const headerNameFeatureFlags = "IBM-Feature-Flags"
+
+// FeatureFlags is a set of experimental feature flags, each of which is either enabled (true)
+// or explicitly disabled (false). The enabled flags are sent in the "IBM-Feature-Flags" header
+// as a comma-separated list.
+type FeatureFlags map[string]bool
+
+// ParseFeatureFlags returns the flags enabled by the value of an "IBM-Feature-Flags" header.
+func ParseFeatureFlags(value string) FeatureFlags {
+	flags := FeatureFlags{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			flags[name] = true
+		}
+	}
+	return flags
+}
+
+// Merge returns a new FeatureFlags containing the flags in "flags", overridden by those in "other".
+func (flags FeatureFlags) Merge(other FeatureFlags) FeatureFlags {
+	merged := make(FeatureFlags, len(flags)+len(other))
+	for name, enabled := range flags {
+		merged[name] = enabled
+	}
+	for name, enabled := range other {
+		merged[name] = enabled
+	}
+	return merged
+}
+
+// Toggle returns a new FeatureFlags in which the flag "name" is enabled or disabled.
+func (flags FeatureFlags) Toggle(name string, enabled bool) FeatureFlags {
+	return flags.Merge(FeatureFlags{name: enabled})
+}
+
+// Enabled returns the names of the enabled flags, in alphabetical order.
+func (flags FeatureFlags) Enabled() []string {
+	var names []string
+	for name, enabled := range flags {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the value of the "IBM-Feature-Flags" header that enables the flags.
+func (flags FeatureFlags) String() string {
+	return strings.Join(flags.Enabled(), ",")
+}
+
+// featureFlagsKey is the context key used to associate feature flags with a request.
+type featureFlagsKey struct{}
+
+// SetFeatureFlag enables or disables the feature flag "name" for all requests sent by the service.
+// Flags can also be enabled or disabled for a particular request with RequestBuilder.WithFeatureFlag().
+func (service *BaseService) SetFeatureFlag(name string, enabled bool) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.featureFlags = service.featureFlags.Toggle(name, enabled)
+}
+
+// SetFeatureFlags replaces the feature flags sent with all requests.
+func (service *BaseService) SetFeatureFlags(flags FeatureFlags) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.featureFlags = FeatureFlags(nil).Merge(flags)
+}
+
+// GetFeatureFlags returns a copy of the feature flags sent with all requests.
+func (service *BaseService) GetFeatureFlags() FeatureFlags {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return FeatureFlags(nil).Merge(service.featureFlags)
+}
+
+// WithFeatureFlag enables or disables the feature flag "name" for this request only,
+// overriding the service's feature flags.
+func (requestBuilder *RequestBuilder) WithFeatureFlag(name string, enabled bool) *RequestBuilder {
+	requestBuilder.featureFlags = requestBuilder.featureFlags.Toggle(name, enabled)
+	return requestBuilder
+}
+
+// applyFeatureFlags sets the "IBM-Feature-Flags" header of "req" to the flags already present
+// in the header (e.g. as a default header), merged with "serviceFlags" and then with the
+// flags associated with the request.
+func applyFeatureFlags(req *http.Request, serviceFlags FeatureFlags) {
+	requestFlags, _ := req.Context().Value(featureFlagsKey{}).(FeatureFlags)
+	if len(serviceFlags) == 0 && len(requestFlags) == 0 {
+		return
+	}
+
+	// The header may have been added under a non-canonical name (see RequestBuilder.CanonicalizeHeaderNames).
+	var values []string
+	for name, v := range req.Header {
+		if strings.EqualFold(name, headerNameFeatureFlags) {
+			values = append(values, v...)
+			delete(req.Header, name)
+		}
+	}
+
+	flags := ParseFeatureFlags(strings.Join(values, ",")).Merge(serviceFlags).Merge(requestFlags)
+	if value := flags.String(); value != "" {
+		req.Header.Set(headerNameFeatureFlags, value)
+	}
+}
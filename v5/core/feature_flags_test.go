@@ -0,0 +1,91 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	flags := ParseFeatureFlags(" b, a,,c ")
+	assert.Equal(t, FeatureFlags{"a": true, "b": true, "c": true}, flags)
+	assert.Equal(t, "a,b,c", flags.String())
+
+	toggled := flags.Toggle("b", false).Toggle("d", true)
+	assert.Equal(t, "a,c,d", toggled.String())
+	assert.Equal(t, "a,b,c", flags.String())
+
+	merged := FeatureFlags{"x": true, "y": true}.Merge(FeatureFlags{"y": false})
+	assert.Equal(t, []string{"x"}, merged.Enabled())
+	assert.Equal(t, "", FeatureFlags(nil).String())
+}
+
+func TestRequestFeatureFlags(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Values("IBM-Feature-Flags")
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	send := func(decorate func(*RequestBuilder)) []string {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "/resources", nil)
+		assert.Nil(t, err)
+		decorate(builder)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		_, err = service.Request(req, nil)
+		assert.Nil(t, err)
+		return received
+	}
+	none := func(*RequestBuilder) {}
+
+	// No header is sent unless flags are set.
+	assert.Nil(t, send(none))
+
+	// The service's flags are sent with every request.
+	service.SetFeatureFlag("beta-search", true)
+	service.SetFeatureFlag("fast-export", true)
+	assert.Equal(t, []string{"beta-search,fast-export"}, send(none))
+	assert.Equal(t, FeatureFlags{"beta-search": true, "fast-export": true}, service.GetFeatureFlags())
+
+	// A request can enable or disable flags.
+	assert.Equal(t, []string{"beta-search,new-paging"}, send(func(builder *RequestBuilder) {
+		builder.WithFeatureFlag("new-paging", true).WithFeatureFlag("fast-export", false)
+	}))
+
+	// Flags in an explicit (or default) header are merged.
+	service.SetDefaultHeaders(http.Header{"IBM-Feature-Flags": {"legacy"}})
+	assert.Equal(t, []string{"beta-search,fast-export,legacy,preview"}, send(func(builder *RequestBuilder) {
+		builder.AddHeader("IBM-Feature-Flags", "preview")
+	}))
+	assert.Nil(t, send(func(builder *RequestBuilder) {
+		builder.WithFeatureFlag("legacy", false).WithFeatureFlag("beta-search", false).WithFeatureFlag("fast-export", false)
+	}))
+
+	// The service's flags can be replaced, and are copied by Clone().
+	service.SetDefaultHeaders(nil)
+	service.SetFeatureFlags(FeatureFlags{"gamma": true, "delta": false})
+	assert.Equal(t, []string{"gamma"}, send(none))
+	assert.Equal(t, FeatureFlags{"gamma": true, "delta": false}, service.Clone().GetFeatureFlags())
+}
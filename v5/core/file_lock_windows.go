@@ -0,0 +1,48 @@
+// +build windows
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Files are locked across processes with LockFileEx.
+const fileLockingSupported = true
+
+// The locked range, which covers the whole file (whatever its size).
+const (
+	fileLockRangeLow  = ^uint32(0)
+	fileLockRangeHigh = ^uint32(0)
+)
+
+// lockFile blocks until it obtains an exclusive (if "exclusive" is true) or shared lock on "file".
+func lockFile(file *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, fileLockRangeLow, fileLockRangeHigh,
+		&windows.Overlapped{})
+}
+
+// unlockFile releases the lock obtained on "file" by lockFile.
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, fileLockRangeLow, fileLockRangeHigh,
+		&windows.Overlapped{})
+}
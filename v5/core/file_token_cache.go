@@ -0,0 +1,161 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileTokenCache is a TokenCache that stores tokens in a file.
+type fileTokenCache struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileTokenCache returns a TokenCache that stores tokens in the specified file
+// (created if necessary, along with its directory), so that the tokens obtained by one
+// invocation of a program (e.g. a CLI) are reused by subsequent invocations.
+// The file contains the JSON-encoded token server responses and is readable and writable
+// only by its owner (i.e. its permissions are 0600). A lock file (the same path, with the ".lock"
+// suffix) is locked while the file is read or written (with flock, or LockFileEx on Windows),
+// so that the file can be shared by concurrent processes, and the file is replaced atomically.
+// Expired tokens are removed from the file when a token is stored.
+func NewFileTokenCache(path string) (TokenCache, error) {
+	if path == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	return &fileTokenCache{
+		path: path,
+	}, nil
+}
+
+func (cache *fileTokenCache) Get(key string) (token *IamTokenServerResponse, err error) {
+	err = cache.update(false, func(tokens map[string]*IamTokenServerResponse) bool {
+		token = tokens[key]
+		return false
+	})
+	return
+}
+
+func (cache *fileTokenCache) Put(key string, token *IamTokenServerResponse) error {
+	return cache.update(true, func(tokens map[string]*IamTokenServerResponse) bool {
+		now := GetCurrentTime()
+		for k, t := range tokens {
+			if t == nil || t.Expiration <= now {
+				delete(tokens, k)
+			}
+		}
+		tokens[key] = token
+		return true
+	})
+}
+
+func (cache *fileTokenCache) Delete(key string) error {
+	return cache.update(true, func(tokens map[string]*IamTokenServerResponse) bool {
+		if _, ok := tokens[key]; !ok {
+			return false
+		}
+		delete(tokens, key)
+		return true
+	})
+}
+
+// update reads the tokens from the cache's file and invokes "fn" with them, holding a lock
+// (an exclusive lock if "write" is true, otherwise a shared lock) on the cache's lock file.
+// If "write" is true and "fn" returns true, the (modified) tokens are then written to a temporary
+// file that replaces the cache's file, so that the file is never seen partially written (e.g. after
+// a crash, or by a program that doesn't lock it). The lock file is locked rather than the cache's
+// file, because the cache's file is replaced. A file that doesn't exist or can't be decoded is
+// treated as containing no tokens.
+func (cache *fileTokenCache) update(write bool, fn func(tokens map[string]*IamTokenServerResponse) bool) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !write {
+		if _, err := os.Stat(cache.path); os.IsNotExist(err) {
+			fn(make(map[string]*IamTokenServerResponse))
+			return nil
+		}
+	}
+
+	lock, err := os.OpenFile(cache.path+".lock", os.O_RDWR|os.O_CREATE, 0600) // #nosec G304
+	if err != nil {
+		return err
+	}
+	defer lock.Close() // #nosec G307
+
+	if err = lockFile(lock, write); err != nil {
+		return err
+	}
+	//nolint: errcheck
+	defer unlockFile(lock)
+
+	data, err := ioutil.ReadFile(cache.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	tokens := make(map[string]*IamTokenServerResponse)
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &tokens); err != nil {
+			GetLogger().Debug("Ignoring the content of token cache file %s: %s", cache.path, err.Error())
+			tokens = make(map[string]*IamTokenServerResponse)
+		}
+	}
+
+	if !fn(tokens) || !write {
+		return nil
+	}
+
+	if data, err = json.Marshal(tokens); err != nil {
+		return err
+	}
+	return cache.replaceFile(data)
+}
+
+// replaceFile writes "data" to a temporary file (readable and writable only by its owner)
+// in the directory of the cache's file, and then renames it to the cache's file.
+func (cache *fileTokenCache) replaceFile(data []byte) (err error) {
+	temp, err := ioutil.TempFile(filepath.Dir(cache.path), filepath.Base(cache.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()           // #nosec G104
+			os.Remove(temp.Name()) // #nosec G104
+		}
+	}()
+
+	if _, err = temp.Write(data); err != nil {
+		return err
+	}
+	if err = temp.Sync(); err != nil {
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), cache.path)
+}
@@ -0,0 +1,189 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileTokenCacheTestPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "token-cache")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "cache", "tokens.json")
+}
+
+func TestFileTokenCacheCtorErrors(t *testing.T) {
+	cache, err := NewFileTokenCache("")
+	assert.NotNil(t, err)
+	assert.Nil(t, cache)
+}
+
+func TestFileTokenCache(t *testing.T) {
+	path := newFileTokenCacheTestPath(t)
+	cache, err := NewFileTokenCache(path)
+	assert.Nil(t, err)
+
+	// The file isn't created until a token is stored.
+	token, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	stored := &IamTokenServerResponse{AccessToken: "token", ExpiresIn: 3600, Expiration: GetCurrentTime() + 3600}
+	assert.Nil(t, cache.Put("key", stored))
+	token, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, stored, token)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// The token is visible to another cache using the same file (e.g. in another process).
+	other, err := NewFileTokenCache(path)
+	assert.Nil(t, err)
+	token, err = other.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, stored, token)
+
+	assert.Nil(t, other.Delete("key"))
+	assert.Nil(t, other.Delete("key"))
+	token, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+}
+
+func TestFileTokenCacheRemovesExpiredTokens(t *testing.T) {
+	path := newFileTokenCacheTestPath(t)
+	cache, err := NewFileTokenCache(path)
+	assert.Nil(t, err)
+
+	assert.Nil(t, cache.Put("expired", &IamTokenServerResponse{AccessToken: "token1", Expiration: GetCurrentTime() - 1}))
+	assert.Nil(t, cache.Put("valid", &IamTokenServerResponse{AccessToken: "token2", Expiration: GetCurrentTime() + 3600}))
+
+	token, err := cache.Get("expired")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+	token, err = cache.Get("valid")
+	assert.Nil(t, err)
+	assert.Equal(t, "token2", token.AccessToken)
+}
+
+func TestFileTokenCacheCorruptFile(t *testing.T) {
+	path := newFileTokenCacheTestPath(t)
+	cache, err := NewFileTokenCache(path)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(`{"key": `), 0644))
+
+	token, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	// The corrupt content is replaced, and the permissions are restricted.
+	assert.Nil(t, cache.Put("key", &IamTokenServerResponse{AccessToken: "token", Expiration: GetCurrentTime() + 3600}))
+	token, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+}
+
+func TestFileTokenCacheConcurrentWriters(t *testing.T) {
+	if !fileLockingSupported {
+		t.Skip("files are not locked on " + runtime.GOOS)
+	}
+	path := newFileTokenCacheTestPath(t)
+
+	// Separate caches using the same file must not lose each other's tokens.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		cache, err := NewFileTokenCache(path)
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(i int, cache TokenCache) {
+			defer wg.Done()
+			assert.Nil(t, cache.Put(fmt.Sprintf("key%d", i),
+				&IamTokenServerResponse{AccessToken: "token", Expiration: GetCurrentTime() + 3600}))
+		}(i, cache)
+	}
+	wg.Wait()
+
+	cache, err := NewFileTokenCache(path)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		token, err := cache.Get(fmt.Sprintf("key%d", i))
+		assert.Nil(t, err)
+		assert.NotNil(t, token)
+	}
+
+	// The file was replaced by each writer, and no temporary files were left behind.
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{"tokens.json", "tokens.json.lock"}, names)
+}
+
+func TestIamFileTokenCache(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	// Each authenticator (and cache) simulates an invocation of a CLI.
+	path := newFileTokenCacheTestPath(t)
+	for i := 0; i < 2; i++ {
+		cache, err := NewFileTokenCache(path)
+		assert.Nil(t, err)
+		authenticator, err := NewIamAuthenticatorBuilder().
+			SetApiKey(iamAuthMockApiKey).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+			Build()
+		assert.Nil(t, err)
+
+		token, err := authenticator.GetToken()
+		assert.Nil(t, err)
+		assert.Equal(t, iamAuthTestAccessToken1, token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The file doesn't contain the apikey.
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), iamAuthMockApiKey)
+}
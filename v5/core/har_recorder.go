@@ -0,0 +1,554 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	harVersion = "1.2"
+
+	// The value that replaces redacted header, query parameter and body values.
+	harRedacted = "[redacted]"
+
+	// Default values of HARRecorderOptions fields.
+	defaultHARMaxEntries  = 1000
+	defaultHARMaxBodySize = 64 * 1024
+)
+
+// The headers whose values are always redacted within a HAR archive.
+var harRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// A regular expression that matches the names of query parameters whose values are redacted.
+var reHARSecretParam = regexp.MustCompile(`(?i)(password|token|apikey|api_key|passcode|secret)`)
+
+// HAR is an HTTP Archive (HAR 1.2) containing recorded HTTP traffic.
+// See http://www.softwareishard.com/blog/har-12-spec/ for details.
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+// HARLog is the root of the recorded traffic within a HAR.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator describes the application that created a HAR.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry describes a single request/response exchange.
+type HAREntry struct {
+	StartedDateTime time.Time    `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+	Comment         string       `json:"comment,omitempty"`
+}
+
+// HARRequest describes a recorded request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes a recorded response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     *HARContent    `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a name/value pair (e.g. a header or query parameter).
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData describes a recorded request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent describes a recorded response body.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings holds the timing information (in milliseconds) of an entry.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARRecorderOptions holds the configuration of a HARRecorder.
+type HARRecorderOptions struct {
+	// The length of time after which a recording stops automatically.
+	// Zero means that a recording continues until Stop is called [optional].
+	Duration time.Duration
+
+	// The maximum number of entries that are recorded; defaults to 1000 [optional].
+	MaxEntries int
+
+	// The maximum number of bytes of each request and response body that are recorded;
+	// longer bodies are truncated. Defaults to 64KB; a negative value means that
+	// bodies are not recorded [optional].
+	MaxBodySize int64
+
+	// The names of headers whose values are redacted, in addition to the
+	// "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie" and "X-Auth*" headers [optional].
+	RedactHeaders []string
+}
+
+// HARRecorder records HTTP traffic into a HAR archive, so that performance and
+// support investigations can be reproduced. Secrets (credentials, tokens, etc.)
+// are redacted from the recorded headers, query parameters and bodies.
+//
+// A HARRecorder is attached to a BaseService with BaseService.SetHARRecorder(),
+// or wrapped around any transport with its Transport method, and is started and
+// stopped at runtime with its Start and Stop methods.
+// A HARRecorder is safe for concurrent use.
+type HARRecorder struct {
+	options       HARRecorderOptions
+	redactHeaders map[string]bool
+
+	mutex     sync.Mutex
+	recording bool
+	deadline  time.Time
+	entries   []*HAREntry
+}
+
+// NewHARRecorder returns a new HARRecorder instance, which is initially stopped.
+func NewHARRecorder(options *HARRecorderOptions) *HARRecorder {
+	recorder := &HARRecorder{
+		redactHeaders: make(map[string]bool),
+	}
+	if options != nil {
+		recorder.options = *options
+	}
+	if recorder.options.MaxEntries <= 0 {
+		recorder.options.MaxEntries = defaultHARMaxEntries
+	}
+	if recorder.options.MaxBodySize == 0 {
+		recorder.options.MaxBodySize = defaultHARMaxBodySize
+	}
+	for _, name := range append(harRedactedHeaders, recorder.options.RedactHeaders...) {
+		recorder.redactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	return recorder
+}
+
+// Start discards any previously-recorded entries and starts a new recording,
+// which stops automatically once the configured Duration has elapsed.
+func (recorder *HARRecorder) Start() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.recording = true
+	recorder.entries = nil
+	recorder.deadline = time.Time{}
+	if recorder.options.Duration > 0 {
+		recorder.deadline = time.Now().Add(recorder.options.Duration)
+	}
+}
+
+// Stop stops the current recording. The recorded entries are retained.
+func (recorder *HARRecorder) Stop() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.recording = false
+}
+
+// IsRecording returns true iff a recording is in progress.
+func (recorder *HARRecorder) IsRecording() bool {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return recorder.isRecording()
+}
+
+// isRecording returns true iff a recording is in progress.
+// The caller must hold the recorder's mutex.
+func (recorder *HARRecorder) isRecording() bool {
+	if recorder.recording && !recorder.deadline.IsZero() && time.Now().After(recorder.deadline) {
+		recorder.recording = false
+	}
+	return recorder.recording
+}
+
+// HAR returns a HAR archive containing the entries recorded so far.
+func (recorder *HARRecorder) HAR() *HAR {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	entries := make([]*HAREntry, len(recorder.entries))
+	for i, entry := range recorder.entries {
+		// Copy each entry, because the response of an in-progress entry may still be updated.
+		entryCopy := *entry
+		responseCopy := *entry.Response
+		contentCopy := *entry.Response.Content
+		timingsCopy := *entry.Timings
+		responseCopy.Content = &contentCopy
+		entryCopy.Response = &responseCopy
+		entryCopy.Timings = &timingsCopy
+		entries[i] = &entryCopy
+	}
+
+	return &HAR{
+		Log: &HARLog{
+			Version: harVersion,
+			Creator: &HARCreator{Name: sdkName, Version: __VERSION__},
+			Entries: entries,
+		},
+	}
+}
+
+// WriteTo writes the HAR archive containing the entries recorded so far to "w" as JSON.
+func (recorder *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(recorder.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// Transport returns an http.RoundTripper that records the requests sent via "next"
+// (or http.DefaultTransport if "next" is nil) while a recording is in progress.
+func (recorder *HARRecorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &harTransport{recorder: recorder, next: next}
+}
+
+// addEntry adds "entry" to the recording, returning false if the recording has
+// stopped or the maximum number of entries has been reached.
+func (recorder *HARRecorder) addEntry(entry *HAREntry) bool {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if !recorder.isRecording() || len(recorder.entries) >= recorder.options.MaxEntries {
+		return false
+	}
+	recorder.entries = append(recorder.entries, entry)
+	return true
+}
+
+// harTransport is the http.RoundTripper returned by HARRecorder.Transport.
+type harTransport struct {
+	recorder *HARRecorder
+	next     http.RoundTripper
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := t.recorder
+	if !recorder.IsRecording() {
+		return t.next.RoundTrip(req)
+	}
+
+	// Capture the request body as it is sent.
+	var requestBody *harCapture
+	if req.Body != nil && req.Body != http.NoBody {
+		requestBody = &harCapture{limit: recorder.options.MaxBodySize}
+		origReq := req
+		req = req.Clone(req.Context())
+		req.Body = &harCaptureReadCloser{ReadCloser: origReq.Body, capture: requestBody}
+	}
+
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	waited := time.Since(started)
+
+	entry := &HAREntry{
+		StartedDateTime: started,
+		Time:            durationMillis(waited),
+		Request:         recorder.harRequest(req, requestBody),
+		Timings:         &HARTimings{Wait: durationMillis(waited)},
+	}
+	if err != nil {
+		entry.Response = &HARResponse{
+			Cookies:     []HARNameValue{},
+			Headers:     []HARNameValue{},
+			Content:     &HARContent{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		entry.Comment = err.Error()
+		recorder.addEntry(entry)
+		return resp, err
+	}
+
+	entry.Response = recorder.harResponse(resp)
+	if !recorder.addEntry(entry) {
+		return resp, nil
+	}
+
+	// Capture the response body as it is read, and complete the entry once it has been consumed.
+	if resp.Body != nil && resp.Body != http.NoBody {
+		respCopy := *resp
+		respCopy.Body = &harResponseBody{
+			ReadCloser: resp.Body,
+			capture:    &harCapture{limit: recorder.options.MaxBodySize},
+			recorder:   recorder,
+			entry:      entry,
+			started:    started,
+			waited:     waited,
+		}
+		resp = &respCopy
+	}
+	return resp, nil
+}
+
+// harRequest returns a HARRequest describing "req".
+func (recorder *HARRecorder) harRequest(req *http.Request, body *harCapture) *HARRequest {
+	harReq := &HARRequest{
+		Method:      req.Method,
+		URL:         RedactSecrets(req.URL.String()),
+		HTTPVersion: req.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     recorder.harHeaders(req.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if harReq.HTTPVersion == "" {
+		harReq.HTTPVersion = "HTTP/1.1"
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			if reHARSecretParam.MatchString(name) {
+				value = harRedacted
+			}
+			harReq.QueryString = append(harReq.QueryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+
+	if body != nil {
+		data, size, truncated := body.result()
+		harReq.BodySize = size
+		if recorder.options.MaxBodySize >= 0 {
+			mimeType := req.Header.Get(CONTENT_TYPE)
+			text, encoding := harBodyText(data, mimeType)
+			harReq.PostData = &HARPostData{
+				MimeType: mimeType,
+				Text:     text,
+			}
+			var comments []string
+			if encoding != "" {
+				comments = append(comments, encoding+"-encoded")
+			}
+			if truncated {
+				comments = append(comments, "truncated")
+			}
+			harReq.PostData.Comment = strings.Join(comments, ", ")
+		}
+	}
+	return harReq
+}
+
+// harResponse returns a HARResponse describing "resp" (excluding its body).
+func (recorder *HARRecorder) harResponse(resp *http.Response) *HARResponse {
+	statusText := http.StatusText(resp.StatusCode)
+	if i := strings.Index(resp.Status, " "); i >= 0 {
+		statusText = resp.Status[i+1:]
+	}
+	return &HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  statusText,
+		HTTPVersion: resp.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     recorder.harHeaders(resp.Header),
+		Content: &HARContent{
+			MimeType: resp.Header.Get(CONTENT_TYPE),
+		},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+}
+
+// harHeaders returns the (redacted) name/value pairs of "header", sorted by name.
+func (recorder *HARRecorder) harHeaders(header http.Header) []HARNameValue {
+	pairs := []HARNameValue{}
+	for _, name := range sortedHeaderNames(header) {
+		redact := recorder.redactHeaders[name] || strings.HasPrefix(name, "X-Auth")
+		for _, value := range header[name] {
+			if redact {
+				value = harRedacted
+			}
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+// sortedHeaderNames returns the names of the headers in "header", sorted.
+func sortedHeaderNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// harBodyText returns the (redacted) text that represents "data" within a HAR,
+// along with its encoding ("base64" for binary content).
+func harBodyText(data []byte, mimeType string) (string, string) {
+	if isTextMimeType(mimeType) {
+		return RedactSecrets(string(data)), ""
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// isTextMimeType returns true iff "mimeType" identifies textual content.
+func isTextMimeType(mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	return mimeType == "" || strings.HasPrefix(mimeType, "text/") || IsJSONMimeType(mimeType) ||
+		strings.Contains(mimeType, "xml") || strings.Contains(mimeType, "x-www-form-urlencoded")
+}
+
+// durationMillis returns "d" as a number of milliseconds.
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// harCapture captures (up to a limit) the data read from a request or response body.
+type harCapture struct {
+	limit int64
+
+	mutex sync.Mutex
+	data  []byte
+	size  int64
+}
+
+func (c *harCapture) write(p []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.size += int64(len(p))
+	if remaining := c.limit - int64(len(c.data)); remaining > 0 {
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+		c.data = append(c.data, p...)
+	}
+}
+
+// result returns the captured data, the total number of bytes read, and
+// true iff the captured data was truncated.
+func (c *harCapture) result() ([]byte, int64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.data, c.size, c.size > int64(len(c.data))
+}
+
+// harCaptureReadCloser captures the data read from a request body.
+type harCaptureReadCloser struct {
+	io.ReadCloser
+	capture *harCapture
+}
+
+func (r *harCaptureReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.write(p[:n])
+	return n, err
+}
+
+// harResponseBody captures the data read from a response body, and completes
+// the associated entry once the body has been fully read or closed.
+type harResponseBody struct {
+	io.ReadCloser
+	capture  *harCapture
+	recorder *HARRecorder
+	entry    *HAREntry
+	started  time.Time
+	waited   time.Duration
+	once     sync.Once
+}
+
+func (b *harResponseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.write(p[:n])
+	if err == io.EOF {
+		b.complete()
+	}
+	return n, err
+}
+
+func (b *harResponseBody) Close() error {
+	b.complete()
+	return b.ReadCloser.Close()
+}
+
+func (b *harResponseBody) complete() {
+	b.once.Do(func() {
+		data, size, truncated := b.capture.result()
+		elapsed := time.Since(b.started)
+
+		b.recorder.mutex.Lock()
+		defer b.recorder.mutex.Unlock()
+
+		content := b.entry.Response.Content
+		content.Size = size
+		if b.recorder.options.MaxBodySize >= 0 {
+			content.Text, content.Encoding = harBodyText(data, content.MimeType)
+			if truncated {
+				content.Comment = "truncated"
+			}
+		}
+		b.entry.Response.BodySize = size
+		b.entry.Time = durationMillis(elapsed)
+		b.entry.Timings.Receive = durationMillis(elapsed - b.waited)
+	})
+}
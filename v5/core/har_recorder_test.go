@@ -0,0 +1,188 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHARTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"name": "wonder woman", "access_token": "secret-token"}`)
+	}))
+}
+
+func invokeHARTest(t *testing.T, service *BaseService, url string) {
+	builder := NewRequestBuilder(POST)
+	_, err := builder.ResolveRequestURL(url, "/v1/resources", nil)
+	assert.Nil(t, err)
+	builder.AddQuery("version", "2021-01-01")
+	builder.AddQuery("apikey", "my-apikey")
+	builder.AddHeader("X-Api-Key", "my-apikey")
+	builder.AddHeader(CONTENT_TYPE, APPLICATION_JSON)
+	_, err = builder.SetBodyContentJSON(map[string]interface{}{"name": "x", "password": "my-password"})
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	var foo *Foo
+	_, err = service.Request(req, &foo)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *foo.Name)
+}
+
+func harValue(pairs []HARNameValue, name string) string {
+	for _, pair := range pairs {
+		if pair.Name == name {
+			return pair.Value
+		}
+	}
+	return ""
+}
+
+func TestHARRecorder(t *testing.T) {
+	server := newHARTestServer()
+	defer server.Close()
+
+	authenticator, _ := NewBearerTokenAuthenticator("my-bearer-token")
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: authenticator,
+	})
+	assert.Nil(t, err)
+
+	recorder := NewHARRecorder(&HARRecorderOptions{RedactHeaders: []string{"x-api-key"}})
+	service.SetHARRecorder(recorder)
+	assert.Equal(t, recorder, service.GetHARRecorder())
+	assert.Equal(t, recorder, service.Clone().GetHARRecorder())
+
+	// Nothing is recorded until the recording is started.
+	invokeHARTest(t, service, server.URL)
+	assert.False(t, recorder.IsRecording())
+	assert.Len(t, recorder.HAR().Log.Entries, 0)
+
+	recorder.Start()
+	assert.True(t, recorder.IsRecording())
+	invokeHARTest(t, service, server.URL)
+	recorder.Stop()
+	invokeHARTest(t, service, server.URL)
+
+	har := recorder.HAR()
+	assert.Equal(t, "1.2", har.Log.Version)
+	assert.Equal(t, sdkName, har.Log.Creator.Name)
+	assert.Len(t, har.Log.Entries, 1)
+
+	entry := har.Log.Entries[0]
+	assert.Equal(t, POST, entry.Request.Method)
+	assert.NotContains(t, entry.Request.URL, "my-apikey")
+	assert.Equal(t, "2021-01-01", harValue(entry.Request.QueryString, "version"))
+	assert.Equal(t, "[redacted]", harValue(entry.Request.QueryString, "apikey"))
+	assert.Equal(t, "[redacted]", harValue(entry.Request.Headers, "Authorization"))
+	assert.Equal(t, "[redacted]", harValue(entry.Request.Headers, "X-Api-Key"))
+	assert.Equal(t, APPLICATION_JSON, entry.Request.PostData.MimeType)
+	assert.Contains(t, entry.Request.PostData.Text, `"name":"x"`)
+	assert.NotContains(t, entry.Request.PostData.Text, "my-password")
+
+	assert.Equal(t, http.StatusOK, entry.Response.Status)
+	assert.Equal(t, "OK", entry.Response.StatusText)
+	assert.Equal(t, "[redacted]", harValue(entry.Response.Headers, "Set-Cookie"))
+	assert.Equal(t, "application/json", entry.Response.Content.MimeType)
+	assert.Contains(t, entry.Response.Content.Text, "wonder woman")
+	assert.NotContains(t, entry.Response.Content.Text, "secret-token")
+	assert.True(t, entry.Response.Content.Size > 0)
+	assert.True(t, entry.Time >= entry.Timings.Wait)
+
+	// The archive is valid JSON.
+	var buf bytes.Buffer
+	_, err = recorder.WriteTo(&buf)
+	assert.Nil(t, err)
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.NotNil(t, decoded["log"])
+
+	// Starting a new recording discards the previous entries.
+	recorder.Start()
+	assert.Len(t, recorder.HAR().Log.Entries, 0)
+	service.SetHARRecorder(nil)
+	invokeHARTest(t, service, server.URL)
+	assert.Len(t, recorder.HAR().Log.Entries, 0)
+}
+
+func TestHARRecorderLimits(t *testing.T) {
+	server := newHARTestServer()
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	// The recording stops once the maximum number of entries is reached.
+	recorder := NewHARRecorder(&HARRecorderOptions{MaxEntries: 2, MaxBodySize: 10})
+	service.SetHARRecorder(recorder)
+	recorder.Start()
+	for i := 0; i < 3; i++ {
+		invokeHARTest(t, service, server.URL)
+	}
+	entries := recorder.HAR().Log.Entries
+	assert.Len(t, entries, 2)
+	assert.Len(t, entries[0].Response.Content.Text, 10)
+	assert.Equal(t, "truncated", entries[0].Response.Content.Comment)
+	assert.Equal(t, "truncated", entries[0].Request.PostData.Comment)
+
+	// The recording stops automatically once its duration has elapsed.
+	recorder = NewHARRecorder(&HARRecorderOptions{Duration: 20 * time.Millisecond, MaxBodySize: -1})
+	service.SetHARRecorder(recorder)
+	recorder.Start()
+	invokeHARTest(t, service, server.URL)
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, recorder.IsRecording())
+	invokeHARTest(t, service, server.URL)
+	entries = recorder.HAR().Log.Entries
+	assert.Len(t, entries, 1)
+	assert.Nil(t, entries[0].Request.PostData)
+	assert.Equal(t, "", entries[0].Response.Content.Text)
+}
+
+func TestHARRecorderTransportError(t *testing.T) {
+	recorder := NewHARRecorder(nil)
+	recorder.Start()
+	client := &http.Client{
+		Transport: recorder.Transport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("connection refused")
+		})),
+	}
+
+	_, err := client.Get("http://localhost/v1/resources")
+	assert.NotNil(t, err)
+	entries := recorder.HAR().Log.Entries
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 0, entries[0].Response.Status)
+	assert.True(t, strings.Contains(entries[0].Comment, "connection refused"))
+}
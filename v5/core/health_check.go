@@ -0,0 +1,127 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HealthChecker is implemented by authenticators that obtain an access token from a token server
+// (the IAM, IAM Assume, IAM mTLS, Container, VPC Instance and Cloud Pak for Data authenticators).
+// It can be used to validate the configuration of a deployment at startup, so that a misconfiguration
+// (e.g. a missing CR token file, a revoked apikey or an unreachable token server) is reported
+// with a precise error before the first request is sent, rather than by the first request.
+type HealthChecker interface {
+	// HealthCheck validates the authenticator's configuration and then obtains a new access token
+	// from the token server (performing each step of the token exchange, e.g. reading the CR token
+	// and exchanging it for an IAM access token), without authenticating a request. A token that
+	// is already cached (by the authenticator or by its TokenCache) is not used. The new access token
+	// is cached, so a successful health check also warms up the authenticator.
+	// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthCheck validates the configuration and credentials by obtaining a new access token.
+func (authenticator *IamAuthenticator) HealthCheck(ctx context.Context) error {
+	return checkTokenHealth(ctx, AUTHTYPE_IAM, authenticator.Validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// HealthCheck validates the configuration and credentials by obtaining a new access token
+// of the authenticator's own identity (using the apikey or the CR token), and then exchanging it
+// for a new access token of the trusted profile.
+func (authenticator *IamAssumeAuthenticator) HealthCheck(ctx context.Context) error {
+	validate := func() error {
+		if err := authenticator.Validate(); err != nil {
+			return err
+		}
+		return authenticator.getSourceAuthenticator().HealthCheck(ctx)
+	}
+	return checkTokenHealth(ctx, AUTHTYPE_IAM_ASSUME, validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// HealthCheck validates the configuration and credentials by obtaining a new access token.
+func (authenticator *ContainerAuthenticator) HealthCheck(ctx context.Context) error {
+	return checkTokenHealth(ctx, AUTHTYPE_CONTAINER, authenticator.Validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// HealthCheck validates the configuration and credentials by obtaining a new access token.
+func (authenticator *VpcInstanceAuthenticator) HealthCheck(ctx context.Context) error {
+	return checkTokenHealth(ctx, AUTHTYPE_VPC, authenticator.Validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// HealthCheck validates the configuration and the client certificate by obtaining a new access token.
+func (authenticator *IamMtlsAuthenticator) HealthCheck(ctx context.Context) error {
+	return checkTokenHealth(ctx, AUTHTYPE_IAM_MTLS, authenticator.Validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// HealthCheck validates the configuration and credentials by obtaining a new access token.
+// If the authenticator can't obtain a new access token by itself (i.e. it is configured with
+// a passcode or bearer token), then a new access token is obtained only if there is no valid
+// cached token, so that the passcode isn't used (or PasscodePrompt invoked) needlessly.
+func (authenticator *CloudPakForDataAuthenticator) HealthCheck(ctx context.Context) error {
+	if !authenticator.canRefreshSilently() {
+		if err := authenticator.Validate(); err != nil {
+			return err
+		}
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		_, err := authenticator.GetTokenWithContext(ctx)
+		return err
+	}
+	return checkTokenHealth(ctx, AUTHTYPE_CP4D, authenticator.Validate, &authenticator.tokenRequests,
+		authenticator.invokeRequestTokenData)
+}
+
+// healthCheckKey is the key of the context value that marks a token request made by a health check.
+type healthCheckKey struct{}
+
+// isHealthCheck returns true iff "ctx" is the context of a token request made by a health check,
+// which must not use an access token obtained from a TokenCache.
+func isHealthCheck(ctx context.Context) bool {
+	return ctx != nil && ctx.Value(healthCheckKey{}) != nil
+}
+
+// checkTokenHealth invokes "validate" to check the configuration of an authenticator of type "authType"
+// and then invokes "requestToken" to obtain a new access token (bypassing any TokenCache). "requests"
+// coalesces the authenticator's token requests, and is used only to detect a closed authenticator.
+func checkTokenHealth(ctx context.Context, authType string, validate func() error,
+	requests *tokenRequestGroup, requestToken func(context.Context) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if requests.context().Err() != nil {
+		return fmt.Errorf(ERRORMSG_AUTHENTICATOR_CLOSED)
+	}
+
+	start := time.Now()
+	err := validate()
+	if err == nil {
+		err = requestToken(context.WithValue(ctx, healthCheckKey{}, true))
+	}
+	if err != nil {
+		GetLogger().Warn("The %s authenticator failed its health check: %s", authType, err.Error())
+		return err
+	}
+	GetLogger().Debug("The %s authenticator passed its health check in %s", authType, time.Since(start).Round(time.Millisecond))
+	return nil
+}
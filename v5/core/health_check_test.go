@@ -0,0 +1,159 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckers(t *testing.T) {
+	var _ HealthChecker = &IamAuthenticator{}
+	var _ HealthChecker = &IamAssumeAuthenticator{}
+	var _ HealthChecker = &IamMtlsAuthenticator{}
+	var _ HealthChecker = &ContainerAuthenticator{}
+	var _ HealthChecker = &VpcInstanceAuthenticator{}
+	var _ HealthChecker = &CloudPakForDataAuthenticator{}
+}
+
+func TestIamHealthCheck(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	cache := NewMemoryTokenCache()
+	newAuthenticator := func() *IamAuthenticator {
+		authenticator, err := NewIamAuthenticatorBuilder().
+			SetApiKey(iamAuthMockApiKey).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+			Build()
+		assert.Nil(t, err)
+		return authenticator
+	}
+	_, err := newAuthenticator().GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The health check obtains a new token, rather than the token in the cache.
+	authenticator := newAuthenticator()
+	assert.Nil(t, authenticator.HealthCheck(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// The new token is then used to authenticate requests.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Each health check obtains a new token.
+	assert.Nil(t, authenticator.HealthCheck(nil))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestIamHealthCheckErrors(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errorCode": "BXNIM0415E", "errorMessage": "Provided API key could not be found."}`)
+	}))
+	defer server.Close()
+
+	// The configuration is validated, even if the authenticator wasn't built by a builder.
+	authenticator := &IamAuthenticator{URL: server.URL}
+	err := authenticator.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken"), err.Error())
+
+	// The token server's error is returned.
+	authenticator.ApiKey = iamAuthMockApiKey
+	err = authenticator.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, authErr.Response.GetStatusCode())
+	assert.Contains(t, err.Error(), "Provided API key could not be found.")
+
+	// A closed authenticator fails its health check.
+	assert.Nil(t, authenticator.Close())
+	err = authenticator.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, ERRORMSG_AUTHENTICATOR_CLOSED, err.Error())
+
+	// A done context is reported.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	authenticator = &IamAuthenticator{ApiKey: iamAuthMockApiKey, URL: server.URL}
+	err = authenticator.HealthCheck(ctx)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+}
+
+func TestContainerHealthCheck(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	authenticator, err := NewContainerAuthenticatorBuilder().
+		SetIAMProfileName(containerAuthMockIAMProfileName).
+		SetCRTokenFilename(containerAuthMockCRTokenFile).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.HealthCheck(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// A missing CR token file is reported before the token server is invoked.
+	authenticator.CRTokenFilename = "/bogus/cr-token-file"
+	err = authenticator.HealthCheck(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unable to retrieve compute resource token value")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestIamAssumeHealthCheck(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	authenticator, err := NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetTrustedProfileID("Profile-1").
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Both the apikey's token and the trusted profile's token are obtained again.
+	assert.Nil(t, authenticator.HealthCheck(context.Background()))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,134 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// hostHeaderKey is the context key used to associate a Host header override with a request.
+type hostHeaderKey struct{}
+
+// SetHostHeader sets "host" as the value of the Host header of the http.Request instance that will
+// be constructed by the Build() method (i.e. its Host field, since a "Host" entry in its Header
+// is ignored by the Go http client). Unlike a Host header added via AddHeader(), the override is
+// preserved when BaseService.Request() retries the request or follows a redirect to the same
+// host, and is also used as the TLS server name (SNI) of the request, e.g. to reach a virtual
+// host fronted by a private endpoint.
+func (requestBuilder *RequestBuilder) SetHostHeader(host string) *RequestBuilder {
+	requestBuilder.hostHeader = host
+	return requestBuilder
+}
+
+// SetHostHeader sets "host" as the Host header (and TLS server name) of each request sent by the
+// service, unless a request specifies its own override via RequestBuilder.SetHostHeader().
+// An empty host (the default) disables the override.
+func (service *BaseService) SetHostHeader(host string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.hostHeader = host
+}
+
+// GetHostHeader returns the Host header override set via SetHostHeader(), or "".
+func (service *BaseService) GetHostHeader() string {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.hostHeader
+}
+
+// getHostHeader returns the Host header override associated with "ctx", or "".
+func getHostHeader(ctx context.Context) string {
+	host, _ := ctx.Value(hostHeaderKey{}).(string)
+	return host
+}
+
+// hostHeaderTransport is an http.RoundTripper that sends each request to "urlHost" (i.e. each
+// attempt of the request and each redirect to the same host) with the Host header "host".
+type hostHeaderTransport struct {
+	next    http.RoundTripper
+	host    string
+	urlHost string
+}
+
+// newHostHeaderTransport returns a transport that applies the Host header "host" to the
+// requests sent via "next" (or http.DefaultTransport, if nil) to "urlHost".
+func newHostHeaderTransport(next http.RoundTripper, host string, urlHost string) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &hostHeaderTransport{
+		next:    next,
+		host:    host,
+		urlHost: urlHost,
+	}
+}
+
+func (t *hostHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A redirect to another host is sent with that host's own Host header.
+	if req.URL.Host != t.urlHost {
+		return t.next.RoundTrip(req)
+	}
+
+	if req.Host != t.host {
+		req = req.Clone(req.Context())
+		req.Host = t.host
+	}
+	next := t.next
+	if req.URL.Scheme == "https" {
+		next = serverNameTransport(next, t.host)
+	}
+	return next.RoundTrip(req)
+}
+
+// serverNameTransports caches the copies of the http.Transport instances whose TLS server name
+// was replaced by a Host header override, so that their connections are reused.
+var serverNameTransports sync.Map
+
+type serverNameTransportKey struct {
+	transport  *http.Transport
+	serverName string
+}
+
+// serverNameTransport returns a copy of "transport" whose TLS server name is "serverName" (with the
+// port, if any, removed), or "transport" itself if it isn't an *http.Transport or already uses the
+// server name.
+func serverNameTransport(transport http.RoundTripper, serverName string) http.RoundTripper {
+	httpTransport, ok := transport.(*http.Transport)
+	if !ok {
+		return transport
+	}
+	serverName = (&url.URL{Host: serverName}).Hostname()
+	if httpTransport.TLSClientConfig != nil && httpTransport.TLSClientConfig.ServerName == serverName {
+		return transport
+	}
+
+	key := serverNameTransportKey{transport: httpTransport, serverName: serverName}
+	if cached, ok := serverNameTransports.Load(key); ok {
+		return cached.(http.RoundTripper)
+	}
+	transportCopy := httpTransport.Clone()
+	if transportCopy.TLSClientConfig == nil {
+		transportCopy.TLSClientConfig = &tls.Config{} // #nosec G402
+	}
+	transportCopy.TLSClientConfig.ServerName = serverName
+	cached, _ := serverNameTransports.LoadOrStore(key, transportCopy)
+	return cached.(http.RoundTripper)
+}
@@ -0,0 +1,146 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hostRecorder records the Host header (and TLS server name) of each request received by a test server.
+type hostRecorder struct {
+	mutex       sync.Mutex
+	hosts       []string
+	serverNames []string
+}
+
+func (recorder *hostRecorder) record(r *http.Request) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.hosts = append(recorder.hosts, r.Host)
+	if r.TLS != nil {
+		recorder.serverNames = append(recorder.serverNames, r.TLS.ServerName)
+	}
+}
+
+func TestHostHeaderRetriesAndRedirects(t *testing.T) {
+	recorder := &hostRecorder{}
+	attempts := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.record(r)
+		switch r.URL.Path {
+		case "/redirect":
+			// An absolute Location (to the same host) loses a custom Host in the Go http client.
+			http.Redirect(w, r, server.URL+"/flaky", http.StatusFound)
+		case "/flaky":
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+	service.EnableRetries(1, time.Second)
+
+	builder := NewRequestBuilder(GET).SetHostHeader("vhost.example.com")
+	_, err := builder.ResolveRequestURL(server.URL, "/redirect", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "vhost.example.com", req.Host)
+
+	response, err := service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	// The retry of the request is redirected again.
+	assert.Equal(t, 2, attempts)
+	assert.Len(t, recorder.hosts, 4)
+	for _, host := range recorder.hosts {
+		assert.Equal(t, "vhost.example.com", host)
+	}
+}
+
+func TestHostHeaderPrecedence(t *testing.T) {
+	recorder := &hostRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.record(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+	assert.Equal(t, "", service.GetHostHeader())
+	service.SetHostHeader("service.example.com")
+	assert.Equal(t, "service.example.com", service.GetHostHeader())
+	assert.Equal(t, "service.example.com", service.Clone().GetHostHeader())
+
+	send := func(builder *RequestBuilder) {
+		_, err := builder.ResolveRequestURL(server.URL, "/", nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		_, err = service.Request(req, nil)
+		assert.Nil(t, err)
+	}
+
+	// The service's override applies unless the request specifies its own.
+	send(NewRequestBuilder(GET))
+	send(NewRequestBuilder(GET).SetHostHeader("request.example.com"))
+	service.SetHostHeader("")
+	send(NewRequestBuilder(GET))
+	assert.Equal(t, []string{"service.example.com", "request.example.com", server.Listener.Addr().String()}, recorder.hosts)
+}
+
+func TestHostHeaderServerName(t *testing.T) {
+	recorder := &hostRecorder{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.record(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+	service.DisableSSLVerification()
+	service.SetHostHeader("vhost.example.com:8443")
+
+	for i := 0; i < 2; i++ {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "/", nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		_, err = service.Request(req, nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{"vhost.example.com:8443", "vhost.example.com:8443"}, recorder.hosts)
+	assert.Equal(t, []string{"vhost.example.com", "vhost.example.com"}, recorder.serverNames)
+
+	// The service's transport itself is unchanged.
+	transport := service.GetHTTPClient().Transport.(*http.Transport)
+	assert.Equal(t, "", transport.TLSClientConfig.ServerName)
+}
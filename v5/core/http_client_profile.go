@@ -0,0 +1,156 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+)
+
+// HTTPClientProfile identifies a versioned set of defaults (timeouts, connection pooling, etc.)
+// for the http.Client instances constructed by the SDK. The defaults of a profile never change,
+// so that selecting a profile gives reproducible behavior; improved defaults are added as a new profile.
+type HTTPClientProfile string
+
+const (
+	// HTTPClientProfileLegacy is the original configuration: a pooled transport with dial and TLS
+	// handshake timeouts, but without a timeout for the response headers, and without a minimum TLS version.
+	HTTPClientProfileLegacy HTTPClientProfile = "legacy"
+
+	// HTTPClientProfileV1 is a hardened configuration for production use:
+	//   - dial timeout of 10s (with 30s TCP keep-alives) and TLS handshake timeout of 10s
+	//   - response header timeout of 60s (the time allowed to read a response body is not limited)
+	//   - proxy from the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY)
+	//   - HTTP/2 enabled, and TLS 1.2 or later required
+	//   - a pool of up to 100 idle connections (10 per host) closed after 90s
+	HTTPClientProfileV1 HTTPClientProfile = "v1"
+)
+
+var (
+	// The profile used by DefaultHTTPClient().
+	defaultHTTPClientProfile      = HTTPClientProfileLegacy
+	defaultHTTPClientProfileMutex sync.RWMutex
+)
+
+// SetDefaultHTTPClientProfile sets the profile of the client returned by DefaultHTTPClient(),
+// which is used by service instances that are subsequently constructed. The initial default is
+// HTTPClientProfileLegacy, for compatibility.
+func SetDefaultHTTPClientProfile(profile HTTPClientProfile) error {
+	if _, err := newHTTPClientTransport(profile); err != nil {
+		return err
+	}
+
+	defaultHTTPClientProfileMutex.Lock()
+	defer defaultHTTPClientProfileMutex.Unlock()
+
+	defaultHTTPClientProfile = profile
+	return nil
+}
+
+// GetDefaultHTTPClientProfile returns the profile of the client returned by DefaultHTTPClient().
+func GetDefaultHTTPClientProfile() HTTPClientProfile {
+	defaultHTTPClientProfileMutex.RLock()
+	defer defaultHTTPClientProfileMutex.RUnlock()
+
+	return defaultHTTPClientProfile
+}
+
+// NewHTTPClient returns a new non-retryable http client configured with the defaults of "profile".
+func NewHTTPClient(profile HTTPClientProfile) (*http.Client, error) {
+	transport, err := newHTTPClientTransport(profile)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// newHTTPClientTransport returns a new transport configured with the defaults of "profile".
+func newHTTPClientTransport(profile HTTPClientProfile) (*http.Transport, error) {
+	switch profile {
+	case HTTPClientProfileLegacy:
+		return cleanhttp.DefaultPooledTransport(), nil
+	case HTTPClientProfileV1:
+		return &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+			IdleConnTimeout:       90 * time.Second,
+		}, nil
+	default:
+		return nil, fmt.Errorf(ERRORMSG_HTTP_CLIENT_PROFILE, profile)
+	}
+}
+
+// SetHTTPClientProfile replaces the service's http client with a new client configured with the
+// defaults of "profile". If retries are enabled, then the new client is used for each attempt.
+// Any customization of the previous client is discarded, so this should be called before (rather
+// than after) SetHTTPClient() or DisableSSLVerification().
+// The profile can also be selected via the "HTTP_CLIENT_PROFILE" configuration property.
+func (service *BaseService) SetHTTPClientProfile(profile HTTPClientProfile) error {
+	client, err := NewHTTPClient(profile)
+	if err != nil {
+		return err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.httpClientProfile = profile
+	if retryableClient := getRetryableHTTPClient(service.Client); retryableClient != nil {
+		// Retain the retry configuration.
+		client = &http.Client{
+			Transport: newRetryableTransport(client, retryableClient.RetryMax, retryableClient.RetryWaitMax),
+		}
+	}
+	service.Client = client
+	return nil
+}
+
+// GetHTTPClientProfile returns the profile selected with SetHTTPClientProfile(), or else the
+// default profile (see SetDefaultHTTPClientProfile()).
+func (service *BaseService) GetHTTPClientProfile() HTTPClientProfile {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	if service.httpClientProfile == "" {
+		return GetDefaultHTTPClientProfile()
+	}
+	return service.httpClientProfile
+}
+
+// parseHTTPClientProfile returns the profile named by the configuration property value "s".
+func parseHTTPClientProfile(s string) (HTTPClientProfile, error) {
+	profile := HTTPClientProfile(strings.ToLower(strings.TrimSpace(s)))
+	if _, err := newHTTPClientTransport(profile); err != nil {
+		return "", err
+	}
+	return profile, nil
+}
@@ -0,0 +1,118 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/tls"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getHTTPClientTransport(t *testing.T, client *http.Client) *http.Transport {
+	if retryableClient := getRetryableHTTPClient(client); retryableClient != nil {
+		client = retryableClient.HTTPClient
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	assert.True(t, ok)
+	return transport
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	client, err := NewHTTPClient(HTTPClientProfileV1)
+	assert.Nil(t, err)
+	transport := getHTTPClientTransport(t, client)
+	assert.Equal(t, 10*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 60*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 10, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.Proxy)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+
+	client, err = NewHTTPClient(HTTPClientProfileLegacy)
+	assert.Nil(t, err)
+	transport = getHTTPClientTransport(t, client)
+	assert.Equal(t, time.Duration(0), transport.ResponseHeaderTimeout)
+
+	client, err = NewHTTPClient("v0")
+	assert.NotNil(t, err)
+	assert.Nil(t, client)
+}
+
+func TestDefaultHTTPClientProfile(t *testing.T) {
+	assert.Equal(t, HTTPClientProfileLegacy, GetDefaultHTTPClientProfile())
+	defer SetDefaultHTTPClientProfile(HTTPClientProfileLegacy) //nolint: errcheck
+
+	assert.NotNil(t, SetDefaultHTTPClientProfile("v0"))
+	assert.Equal(t, HTTPClientProfileLegacy, GetDefaultHTTPClientProfile())
+
+	assert.Nil(t, SetDefaultHTTPClientProfile(HTTPClientProfileV1))
+	assert.Equal(t, 60*time.Second, getHTTPClientTransport(t, DefaultHTTPClient()).ResponseHeaderTimeout)
+
+	service, err := NewBaseService(&ServiceOptions{Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Equal(t, HTTPClientProfileV1, service.GetHTTPClientProfile())
+	assert.Equal(t, 60*time.Second, getHTTPClientTransport(t, service.GetHTTPClient()).ResponseHeaderTimeout)
+}
+
+func TestSetHTTPClientProfile(t *testing.T) {
+	service, err := NewBaseService(&ServiceOptions{Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Equal(t, HTTPClientProfileLegacy, service.GetHTTPClientProfile())
+
+	assert.NotNil(t, service.SetHTTPClientProfile("v0"))
+
+	// The retry configuration is retained.
+	service.EnableRetries(5, 10*time.Second)
+	assert.Nil(t, service.SetHTTPClientProfile(HTTPClientProfileV1))
+	assert.Equal(t, HTTPClientProfileV1, service.GetHTTPClientProfile())
+	retryableClient := getRetryableHTTPClient(service.GetHTTPClient())
+	if assert.NotNil(t, retryableClient) {
+		assert.Equal(t, 5, retryableClient.RetryMax)
+		assert.Equal(t, 10*time.Second, retryableClient.RetryWaitMax)
+	}
+	assert.Equal(t, 60*time.Second, getHTTPClientTransport(t, service.GetHTTPClient()).ResponseHeaderTimeout)
+
+	// Disabling SSL verification retains the profile's settings.
+	service.DisableSSLVerification()
+	assert.True(t, service.IsSSLDisabled())
+	transport := getHTTPClientTransport(t, service.GetHTTPClient())
+	assert.Equal(t, 60*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, uint16(tls.VersionTLS12), transport.TLSClientConfig.MinVersion)
+
+	assert.Equal(t, HTTPClientProfileV1, service.Clone().GetHTTPClientProfile())
+}
+
+func TestConfigureServiceHTTPClientProfile(t *testing.T) {
+	os.Setenv("PROFILED_SERVICE_HTTP_CLIENT_PROFILE", "V1")
+	os.Setenv("PROFILED_SERVICE_ENABLE_RETRIES", "true")
+	defer os.Unsetenv("PROFILED_SERVICE_HTTP_CLIENT_PROFILE")
+	defer os.Unsetenv("PROFILED_SERVICE_ENABLE_RETRIES")
+
+	service, err := NewBaseService(&ServiceOptions{Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.ConfigureService("profiled_service"))
+	assert.Equal(t, HTTPClientProfileV1, service.GetHTTPClientProfile())
+	assert.NotNil(t, getRetryableHTTPClient(service.GetHTTPClient()))
+	assert.Equal(t, 60*time.Second, getHTTPClientTransport(t, service.GetHTTPClient()).ResponseHeaderTimeout)
+
+	os.Setenv("PROFILED_SERVICE_HTTP_CLIENT_PROFILE", "v0")
+	assert.NotNil(t, service.ConfigureService("profiled_service"))
+}
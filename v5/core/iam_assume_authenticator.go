@@ -0,0 +1,546 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IamAssumeAuthenticator implements an IAM-based authentication schema whereby it first obtains
+// an IAM access token (using an apikey, or the compute resource token of the local compute resource),
+// and then exchanges that token for an IAM access token of another trusted profile by invoking the
+// IAM "get token" operation with grant-type=assume.
+// The resulting IAM access token is then added to outbound requests in an Authorization header
+// of the form:
+// 		Authorization: Bearer <access-token>
+//
+type IamAssumeAuthenticator struct {
+
+	// [optional] The apikey used to obtain the IAM access token that is exchanged for the trusted
+	// profile's access token. If not specified, then the compute resource token (CR token) of the
+	// local compute resource is used instead, as with the ContainerAuthenticator.
+	// Default value: ""
+	ApiKey string
+
+	// [optional] The name of the file containing the injected CR token value (used only if ApiKey
+	// is not specified).
+	// Default value: "/var/run/secrets/tokens/vault-token"
+	CRTokenFilename string
+
+	// [optional] The name or id of the trusted IAM profile linked to the compute resource, which is used
+	// to obtain the IAM access token that is exchanged for the trusted profile's access token.
+	// One of IAMProfileName or IAMProfileID must be specified if ApiKey is not specified.
+	// Default value: ""
+	IAMProfileName string
+	IAMProfileID   string
+
+	// The id or CRN of the trusted IAM profile to be assumed.
+	// Exactly one of TrustedProfileID or TrustedProfileCRN must be specified.
+	TrustedProfileID  string
+	TrustedProfileCRN string
+
+	// [optional] The IAM token server's base endpoint URL.
+	// Default value: "https://iam.cloud.ibm.com"
+	URL string
+
+	// [optional] A flag that indicates whether verification of the server's SSL certificate
+	// should be disabled.
+	// Default value: false
+	DisableSSLVerification bool
+
+	// [optional] A set of key/value pairs that will be sent as HTTP headers in requests
+	// made to the IAM token server.
+	// Default value: nil
+	Headers map[string]string
+
+	// [optional] The http.Client object used in interacts with the IAM token server.
+	// If not specified by the user, a suitable default Client will be constructed.
+	Client *http.Client
+
+	// [optional] The options that control how the trusted profile's access tokens are obtained,
+	// validated, cached and refreshed (see TokenManagementOptions). The BackgroundRefreshTimeout
+	// also applies to the access token that is exchanged.
+	TokenManagementOptions
+
+	// The cached IAM access token of the trusted profile and its expiration time.
+	tokenData *iamTokenData
+
+	// Mutex to synchronize access to the tokenData field.
+	tokenDataMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
+
+	// The authenticator that obtains the IAM access token to be exchanged (created when first needed).
+	sourceAuthenticator assumeSourceAuthenticator
+
+	// Mutex to synchronize access to the sourceAuthenticator field.
+	sourceMutex sync.Mutex
+}
+
+const (
+	iamGrantTypeAssume = "urn:ibm:params:oauth:grant-type:assume" // #nosec G101
+)
+
+// assumeSourceAuthenticator is implemented by the authenticators (IamAuthenticator and
+// ContainerAuthenticator) that obtain the IAM access token exchanged by an IamAssumeAuthenticator.
+type assumeSourceAuthenticator interface {
+	GetTokenWithContext(ctx context.Context) (string, error)
+	InvalidateToken()
+	HealthCheck(ctx context.Context) error
+	Close() error
+}
+
+// IamAssumeAuthenticatorBuilder is used to construct an IamAssumeAuthenticator instance.
+type IamAssumeAuthenticatorBuilder struct {
+	IamAssumeAuthenticator
+}
+
+// NewIamAssumeAuthenticatorBuilder returns a new builder struct that
+// can be used to construct an IamAssumeAuthenticator instance.
+func NewIamAssumeAuthenticatorBuilder() *IamAssumeAuthenticatorBuilder {
+	return &IamAssumeAuthenticatorBuilder{}
+}
+
+// SetApiKey sets the ApiKey field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetApiKey(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.ApiKey = s
+	return builder
+}
+
+// SetCRTokenFilename sets the CRTokenFilename field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetCRTokenFilename(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.CRTokenFilename = s
+	return builder
+}
+
+// SetIAMProfileName sets the IAMProfileName field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetIAMProfileName(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.IAMProfileName = s
+	return builder
+}
+
+// SetIAMProfileID sets the IAMProfileID field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetIAMProfileID(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.IAMProfileID = s
+	return builder
+}
+
+// SetTrustedProfileID sets the TrustedProfileID field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetTrustedProfileID(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.TrustedProfileID = s
+	return builder
+}
+
+// SetTrustedProfileCRN sets the TrustedProfileCRN field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetTrustedProfileCRN(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.TrustedProfileCRN = s
+	return builder
+}
+
+// SetURL sets the URL field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetURL(s string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.URL = s
+	return builder
+}
+
+// SetDisableSSLVerification sets the DisableSSLVerification field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetDisableSSLVerification(b bool) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.DisableSSLVerification = b
+	return builder
+}
+
+// SetHeaders sets the Headers field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetHeaders(headers map[string]string) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.Headers = headers
+	return builder
+}
+
+// SetClient sets the Client field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetClient(client *http.Client) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.Client = client
+	return builder
+}
+
+// SetTokenManagementOptions sets the TokenManagementOptions field in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) SetTokenManagementOptions(options TokenManagementOptions) *IamAssumeAuthenticatorBuilder {
+	builder.IamAssumeAuthenticator.TokenManagementOptions = options
+	return builder
+}
+
+// Build() returns a validated instance of the IamAssumeAuthenticator with the config that was set in the builder.
+func (builder *IamAssumeAuthenticatorBuilder) Build() (*IamAssumeAuthenticator, error) {
+
+	// Make sure the config is valid.
+	err := builder.IamAssumeAuthenticator.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &builder.IamAssumeAuthenticator, nil
+}
+
+// newIamAssumeAuthenticatorFromMap constructs a new IamAssumeAuthenticator instance from a map containing
+// configuration properties.
+func newIamAssumeAuthenticatorFromMap(properties map[string]string) (authenticator *IamAssumeAuthenticator, err error) {
+	if properties == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROPS_MAP_NIL)
+	}
+
+	// Grab the AUTH_DISABLE_SSL string property and convert to a boolean value.
+	disableSSL, err := strconv.ParseBool(properties[PROPNAME_AUTH_DISABLE_SSL])
+	if err != nil {
+		disableSSL = false
+	}
+
+	authenticator, err = NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(properties[PROPNAME_APIKEY]).
+		SetCRTokenFilename(properties[PROPNAME_CRTOKEN_FILENAME]).
+		SetIAMProfileName(properties[PROPNAME_IAM_PROFILE_NAME]).
+		SetIAMProfileID(properties[PROPNAME_IAM_PROFILE_ID]).
+		SetTrustedProfileID(properties[PROPNAME_TRUSTED_PROFILE_ID]).
+		SetTrustedProfileCRN(properties[PROPNAME_TRUSTED_PROFILE_CRN]).
+		SetURL(properties[PROPNAME_AUTH_URL]).
+		SetDisableSSLVerification(disableSSL).
+		Build()
+
+	return
+}
+
+// AuthenticationType returns the authentication type for this authenticator.
+func (*IamAssumeAuthenticator) AuthenticationType() string {
+	return AUTHTYPE_IAM_ASSUME
+}
+
+// Authenticate adds IAM authentication information to the request.
+//
+// The IAM access token of the trusted profile will be added to the request's headers in the form:
+//
+// 		Authorization: Bearer <access-token>
+//
+func (authenticator *IamAssumeAuthenticator) Authenticate(request *http.Request) error {
+	token, err := authenticator.GetTokenWithContext(request.Context())
+	if err != nil {
+		return err
+	}
+
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
+	return nil
+}
+
+// getTokenData returns the tokenData field from the authenticator with synchronization.
+func (authenticator *IamAssumeAuthenticator) getTokenData() *iamTokenData {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	return authenticator.tokenData
+}
+
+// setTokenData sets the 'tokenData' field in the authenticator with synchronization.
+func (authenticator *IamAssumeAuthenticator) setTokenData(tokenData *iamTokenData) {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	authenticator.tokenData = tokenData
+}
+
+// InvalidateToken discards the cached access tokens (if any), both of the trusted profile and the
+// one that was exchanged for it, so that new access tokens are fetched the next time that the
+// authenticator is used.
+func (authenticator *IamAssumeAuthenticator) InvalidateToken() {
+	authenticator.setTokenData(nil)
+	deleteCachedIamToken(authenticator.TokenCache, authenticator.tokenCacheKey())
+
+	authenticator.sourceMutex.Lock()
+	defer authenticator.sourceMutex.Unlock()
+	if authenticator.sourceAuthenticator != nil {
+		authenticator.sourceAuthenticator.InvalidateToken()
+	}
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *IamAssumeAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
+// Validate the authenticator's configuration.
+//
+// Ensures that exactly one of TrustedProfileID or TrustedProfileCRN is specified, and that either
+// the ApiKey or one of IAMProfileName or IAMProfileID (for the CR token) is specified.
+func (authenticator *IamAssumeAuthenticator) Validate() error {
+
+	// The user should specify exactly one trusted profile to assume.
+	if authenticator.TrustedProfileID == "" && authenticator.TrustedProfileCRN == "" ||
+		authenticator.TrustedProfileID != "" && authenticator.TrustedProfileCRN != "" {
+		return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "TrustedProfileID", "TrustedProfileCRN")
+	}
+
+	if authenticator.ApiKey != "" {
+		if HasBadFirstOrLastChar(authenticator.ApiKey) {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "ApiKey")
+		}
+	} else if authenticator.IAMProfileName == "" && authenticator.IAMProfileID == "" {
+		// Without an apikey, the CR token is used with the profile linked to the compute resource.
+		return fmt.Errorf(ERRORMSG_ATLEAST_ONE_PROP_ERROR, "ApiKey", "IAMProfileName or IAMProfileID")
+	}
+
+	return nil
+}
+
+// GetToken returns an access token to be used in an Authorization header.
+// Whenever a new token is needed (when a token doesn't yet exist, needs to be refreshed,
+// or the existing token has expired), the trusted profile is assumed again to obtain a new access token.
+func (authenticator *IamAssumeAuthenticator) GetToken() (string, error) {
+	return authenticator.GetTokenWithContext(context.Background())
+}
+
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *IamAssumeAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
+}
+
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *IamAssumeAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
+
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *IamAssumeAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
+}
+
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+func (authenticator *IamAssumeAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_IAM_ASSUME,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
+	}
+}
+
+// fetchTokenData requests a new token from the IAM token server (unless the TokenCache holds
+// a token that can still be used) and stores it in the authenticator's 'tokenData' field (cache).
+func (authenticator *IamAssumeAuthenticator) fetchTokenData(ctx context.Context) error {
+	tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKey(), authenticator.requestToken)
+	if err != nil {
+		return err
+	}
+
+	authenticator.setTokenData(tokenData)
+	store()
+	return nil
+}
+
+// tokenCacheKey returns the key under which the authenticator's tokens are cached, or ""
+// if there is no TokenCache. The key is derived from the token server URL, the credentials
+// used to obtain the access token that is exchanged, and the trusted profile.
+func (authenticator *IamAssumeAuthenticator) tokenCacheKey() string {
+	return newTokenCacheKey(authenticator.TokenCache, AUTHTYPE_IAM_ASSUME, authenticator.URL, authenticator.ApiKey,
+		authenticator.CRTokenFilename, authenticator.IAMProfileName, authenticator.IAMProfileID,
+		authenticator.TrustedProfileID, authenticator.TrustedProfileCRN)
+}
+
+// getSourceAuthenticator returns the authenticator that obtains the IAM access token to be exchanged
+// for the trusted profile's access token, creating it if necessary.
+func (authenticator *IamAssumeAuthenticator) getSourceAuthenticator() assumeSourceAuthenticator {
+	authenticator.sourceMutex.Lock()
+	defer authenticator.sourceMutex.Unlock()
+
+	if authenticator.sourceAuthenticator == nil {
+		// The source authenticator shares the Client (if any) and the token server configuration.
+		if authenticator.ApiKey != "" {
+			authenticator.sourceAuthenticator = &IamAuthenticator{
+				ApiKey:                 authenticator.ApiKey,
+				URL:                    authenticator.URL,
+				DisableSSLVerification: authenticator.DisableSSLVerification,
+				Headers:                authenticator.Headers,
+				Client:                 authenticator.Client,
+
+				TokenManagementOptions: TokenManagementOptions{
+					BackgroundRefreshTimeout: authenticator.BackgroundRefreshTimeout,
+				},
+			}
+		} else {
+			authenticator.sourceAuthenticator = &ContainerAuthenticator{
+				CRTokenFilename:        authenticator.CRTokenFilename,
+				IAMProfileName:         authenticator.IAMProfileName,
+				IAMProfileID:           authenticator.IAMProfileID,
+				URL:                    authenticator.URL,
+				DisableSSLVerification: authenticator.DisableSSLVerification,
+				Headers:                authenticator.Headers,
+				Client:                 authenticator.Client,
+
+				TokenManagementOptions: TokenManagementOptions{
+					BackgroundRefreshTimeout: authenticator.BackgroundRefreshTimeout,
+				},
+			}
+		}
+	}
+	return authenticator.sourceAuthenticator
+}
+
+// RequestToken first obtains an IAM access token (using the apikey or the CR token), then exchanges
+// it for a new IAM access token of the trusted profile by invoking the IAM "get token" operation.
+func (authenticator *IamAssumeAuthenticator) RequestToken() (*IamTokenServerResponse, error) {
+	return authenticator.requestToken(context.Background())
+}
+
+// requestToken is like RequestToken(), but the token requests are abandoned if "ctx" is done.
+func (authenticator *IamAssumeAuthenticator) requestToken(ctx context.Context) (*IamTokenServerResponse, error) {
+	// First, obtain the IAM access token to be exchanged (which may already be cached).
+	accessToken, err := authenticator.getSourceAuthenticator().GetTokenWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the default IAM URL if one was not specified by the user.
+	url := authenticator.URL
+	if url == "" {
+		url = defaultIamTokenServerEndpoint
+	} else {
+		// Canonicalize the URL by removing the operation path if it was specified by the user.
+		url = strings.TrimSuffix(url, iamAuthOperationPathGetToken)
+	}
+
+	// Set up the request for the IAM "get token" invocation.
+	builder := NewRequestBuilder(POST).WithContext(ctx)
+	_, err = builder.ResolveRequestURL(url, iamAuthOperationPathGetToken, nil)
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	builder.AddHeader(CONTENT_TYPE, FORM_URL_ENCODED_HEADER)
+	builder.AddHeader(Accept, APPLICATION_JSON)
+	builder.AddFormData("grant_type", "", "", iamGrantTypeAssume) // #nosec G101
+	builder.AddFormData("access_token", "", "", accessToken)
+
+	// We previously verified that exactly one of TrustedProfileID or TrustedProfileCRN is specified.
+	if authenticator.TrustedProfileID != "" {
+		builder.AddFormData("profile_id", "", "", authenticator.TrustedProfileID)
+	} else {
+		builder.AddFormData("profile_crn", "", "", authenticator.TrustedProfileCRN)
+	}
+
+	// Add user-defined headers to request.
+	for headerName, headerValue := range authenticator.Headers {
+		builder.AddHeader(headerName, headerValue)
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	// If the authenticator does not have a Client, create one now.
+	authenticator.initClient()
+
+	// If debug is enabled, then dump the request.
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		buf, dumpErr := httputil.DumpRequestOut(req, req.Body != nil)
+		if dumpErr == nil {
+			GetLogger().Debug("Request:\n%s\n", RedactSecrets(string(buf)))
+		} else {
+			GetLogger().Debug(fmt.Sprintf("error while attempting to log outbound request: %s", dumpErr.Error()))
+		}
+	}
+
+	GetLogger().Debug("Invoking IAM 'get token' operation (assume): %s", builder.URL)
+	resp, err := authenticator.Client.Do(req)
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	GetLogger().Debug("Returned from IAM 'get token' operation, received status code %d", resp.StatusCode)
+
+	// If debug is enabled, then dump the response.
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		buf, dumpErr := httputil.DumpResponse(resp, req.Body != nil)
+		if dumpErr == nil {
+			GetLogger().Debug("Response:\n%s\n", RedactSecrets(string(buf)))
+		} else {
+			GetLogger().Debug(fmt.Sprintf("error while attempting to log inbound response: %s", dumpErr.Error()))
+		}
+	}
+
+	// Check for a bad status code and handle an operation error.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		buff := new(bytes.Buffer)
+		_, _ = buff.ReadFrom(resp.Body)
+		resp.Body.Close() // #nosec G104
+
+		// Create a DetailedResponse to be included in the error below.
+		detailedResponse := &DetailedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+			RawResult:  buff.Bytes(),
+		}
+
+		iamErrorMsg := string(detailedResponse.RawResult)
+		if iamErrorMsg == "" {
+			iamErrorMsg = "IAM error response not available"
+		}
+		err = fmt.Errorf(ERRORMSG_IAM_GETTOKEN_ERROR, detailedResponse.StatusCode, builder.URL, iamErrorMsg)
+		return nil, NewAuthenticationError(detailedResponse, err)
+	}
+
+	// Good response, so unmarshal the response body into an IamTokenServerResponse instance.
+	tokenResponse := &IamTokenServerResponse{clockSkew: measureClockSkew(resp.Header)}
+	_ = json.NewDecoder(resp.Body).Decode(tokenResponse)
+	defer resp.Body.Close()
+
+	return tokenResponse, nil
+}
+
+// initClient creates the Client used to invoke the IAM token server, if the
+// authenticator does not already have one.
+func (authenticator *IamAssumeAuthenticator) initClient() {
+	if authenticator.Client == nil {
+		authenticator.Client = &http.Client{
+			Timeout: time.Second * 30,
+		}
+
+		// If the user told us to disable SSL verification, then do it now.
+		if authenticator.DisableSSLVerification {
+			transport := &http.Transport{
+				// #nosec G402
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			authenticator.Client.Transport = transport
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// +build all auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+const (
+	iamAssumeAuthMockApiKey     string = "assume-apikey-1"
+	iamAssumeAuthMockProfileID  string = "Profile-9fd84246-7df4-4667-94e4-8ecde51d5ac5"
+	iamAssumeAuthMockProfileCRN string = "crn:v1:bluemix:public:iam-identity::a/123456::profile:Profile-9fd84246-7df4-4667-94e4-8ecde51d5ac5"
+)
+
+// iamAssumeTestServer is a mock IAM token server that supports the "apikey", "cr-token" and "assume" grant types.
+type iamAssumeTestServer struct {
+	*httptest.Server
+
+	// The number of "get token" requests received for each grant type.
+	sourceRequests int32
+	assumeRequests int32
+
+	// The status code returned by the "assume" grant.
+	assumeStatusCode int
+}
+
+func startIamAssumeTestServer(t *testing.T) *iamAssumeTestServer {
+	server := &iamAssumeTestServer{assumeStatusCode: http.StatusOK}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/identity/token", req.URL.EscapedPath())
+
+		var accessToken string
+		switch req.FormValue("grant_type") {
+		case iamAuthGrantTypeApiKey:
+			assert.Equal(t, iamAssumeAuthMockApiKey, req.FormValue("apikey"))
+			accessToken = fmt.Sprintf("source-token-%d", atomic.AddInt32(&server.sourceRequests, 1))
+		case iamGrantTypeCRToken:
+			assert.Equal(t, containerAuthTestCRToken1, req.FormValue("cr_token"))
+			assert.Equal(t, containerAuthMockIAMProfileName, req.FormValue("profile_name"))
+			accessToken = fmt.Sprintf("source-token-%d", atomic.AddInt32(&server.sourceRequests, 1))
+		case iamGrantTypeAssume:
+			assert.Equal(t, fmt.Sprintf("source-token-%d", atomic.LoadInt32(&server.sourceRequests)), req.FormValue("access_token"))
+			assert.True(t, req.FormValue("profile_id") == iamAssumeAuthMockProfileID ||
+				req.FormValue("profile_crn") == iamAssumeAuthMockProfileCRN)
+			accessToken = fmt.Sprintf("assumed-token-%d", atomic.AddInt32(&server.assumeRequests, 1))
+			if server.assumeStatusCode != http.StatusOK {
+				res.WriteHeader(server.assumeStatusCode)
+				fmt.Fprintf(res, `Sorry, you are not authorized!`)
+				return
+			}
+		default:
+			assert.Fail(t, "unexpected grant type: "+req.FormValue("grant_type"))
+		}
+
+		expiration := GetCurrentTime() + 3600
+		fmt.Fprintf(res, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			accessToken, expiration)
+	}))
+	return server
+}
+
+func TestIamAssumeAuthCtorErrors(t *testing.T) {
+	// Error: missing trusted profile.
+	auth, err := NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAssumeAuthMockApiKey).
+		Build()
+	assert.NotNil(t, err)
+	assert.Nil(t, auth)
+	t.Logf("Expected error: %s", err.Error())
+
+	// Error: both TrustedProfileID and TrustedProfileCRN.
+	auth, err = NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAssumeAuthMockApiKey).
+		SetTrustedProfileID(iamAssumeAuthMockProfileID).
+		SetTrustedProfileCRN(iamAssumeAuthMockProfileCRN).
+		Build()
+	assert.NotNil(t, err)
+	assert.Nil(t, auth)
+	t.Logf("Expected error: %s", err.Error())
+
+	// Error: neither ApiKey nor the profile linked to the compute resource.
+	auth, err = NewIamAssumeAuthenticatorBuilder().
+		SetTrustedProfileID(iamAssumeAuthMockProfileID).
+		Build()
+	assert.NotNil(t, err)
+	assert.Nil(t, auth)
+	t.Logf("Expected error: %s", err.Error())
+
+	// Error: invalid ApiKey.
+	auth, err = NewIamAssumeAuthenticatorBuilder().
+		SetApiKey("{" + iamAssumeAuthMockApiKey + "}").
+		SetTrustedProfileID(iamAssumeAuthMockProfileID).
+		Build()
+	assert.NotNil(t, err)
+	assert.Nil(t, auth)
+	t.Logf("Expected error: %s", err.Error())
+}
+
+func TestIamAssumeAuthCtorFromMap(t *testing.T) {
+	auth, err := newIamAssumeAuthenticatorFromMap(map[string]string{
+		PROPNAME_APIKEY:              iamAssumeAuthMockApiKey,
+		PROPNAME_TRUSTED_PROFILE_CRN: iamAssumeAuthMockProfileCRN,
+		PROPNAME_AUTH_URL:            "https://iam.test.cloud.ibm.com",
+		PROPNAME_AUTH_DISABLE_SSL:    "true",
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, auth)
+	assert.Equal(t, AUTHTYPE_IAM_ASSUME, auth.AuthenticationType())
+	assert.Equal(t, iamAssumeAuthMockApiKey, auth.ApiKey)
+	assert.Equal(t, "", auth.TrustedProfileID)
+	assert.Equal(t, iamAssumeAuthMockProfileCRN, auth.TrustedProfileCRN)
+	assert.Equal(t, "https://iam.test.cloud.ibm.com", auth.URL)
+	assert.True(t, auth.DisableSSLVerification)
+
+	auth, err = newIamAssumeAuthenticatorFromMap(map[string]string{
+		PROPNAME_CRTOKEN_FILENAME:   containerAuthMockCRTokenFile,
+		PROPNAME_IAM_PROFILE_NAME:   containerAuthMockIAMProfileName,
+		PROPNAME_TRUSTED_PROFILE_ID: iamAssumeAuthMockProfileID,
+	})
+	assert.Nil(t, err)
+	assert.NotNil(t, auth)
+	assert.Equal(t, containerAuthMockCRTokenFile, auth.CRTokenFilename)
+	assert.Equal(t, containerAuthMockIAMProfileName, auth.IAMProfileName)
+	assert.Equal(t, iamAssumeAuthMockProfileID, auth.TrustedProfileID)
+
+	_, err = newIamAssumeAuthenticatorFromMap(map[string]string{
+		PROPNAME_APIKEY: iamAssumeAuthMockApiKey,
+	})
+	assert.NotNil(t, err)
+
+	_, err = newIamAssumeAuthenticatorFromMap(nil)
+	assert.NotNil(t, err)
+}
+
+func TestIamAssumeAuthGetTokenWithApiKey(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := startIamAssumeTestServer(t)
+	defer server.Close()
+
+	auth, err := NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAssumeAuthMockApiKey).
+		SetTrustedProfileID(iamAssumeAuthMockProfileID).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	accessToken, err := auth.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-1", accessToken)
+
+	req, _ := http.NewRequest("GET", "https://localhost/api/v1/resources", nil)
+	assert.Nil(t, auth.Authenticate(req))
+	assert.Equal(t, "Bearer assumed-token-1", req.Header.Get("Authorization"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.sourceRequests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.assumeRequests))
+
+	// When the assumed token expires, the trusted profile is assumed again with the (still valid) source token.
+	auth.getTokenData().Expiration = GetCurrentTime() - 1
+	accessToken, err = auth.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-2", accessToken)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.sourceRequests))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.assumeRequests))
+
+	// InvalidateToken discards both tokens.
+	auth.InvalidateToken()
+	accessToken, err = auth.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-3", accessToken)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.sourceRequests))
+}
+
+func TestIamAssumeAuthTokenCache(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := startIamAssumeTestServer(t)
+	defer server.Close()
+
+	cache := NewMemoryTokenCache()
+	newAuthenticator := func() *IamAssumeAuthenticator {
+		auth, err := NewIamAssumeAuthenticatorBuilder().
+			SetApiKey(iamAssumeAuthMockApiKey).
+			SetTrustedProfileID(iamAssumeAuthMockProfileID).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+			Build()
+		assert.Nil(t, err)
+		return auth
+	}
+
+	accessToken, err := newAuthenticator().GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-1", accessToken)
+
+	// Another authenticator with the same configuration uses the cached token.
+	auth := newAuthenticator()
+	accessToken, err = auth.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-1", accessToken)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.sourceRequests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.assumeRequests))
+
+	// InvalidateToken also discards the cached token.
+	auth.InvalidateToken()
+	accessToken, err = newAuthenticator().GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-2", accessToken)
+}
+
+func TestIamAssumeAuthGetTokenWithCRToken(t *testing.T) {
+	GetLogger().SetLogLevel(containerAuthTestLogLevel)
+
+	server := startIamAssumeTestServer(t)
+	defer server.Close()
+
+	auth, err := NewIamAssumeAuthenticatorBuilder().
+		SetCRTokenFilename(containerAuthMockCRTokenFile).
+		SetIAMProfileName(containerAuthMockIAMProfileName).
+		SetTrustedProfileCRN(iamAssumeAuthMockProfileCRN).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	var infos []TokenInfo
+	auth.OnTokenRefresh(func(info TokenInfo) {
+		infos = append(infos, info)
+	})
+
+	accessToken, err := auth.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "assumed-token-1", accessToken)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.sourceRequests))
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, AUTHTYPE_IAM_ASSUME, infos[0].AuthType)
+		assert.Equal(t, "assumed-token-1", infos[0].AccessToken)
+	}
+}
+
+func TestIamAssumeAuthGetTokenFail(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := startIamAssumeTestServer(t)
+	defer server.Close()
+	server.assumeStatusCode = http.StatusUnauthorized
+
+	auth, err := NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAssumeAuthMockApiKey).
+		SetTrustedProfileID(iamAssumeAuthMockProfileID).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	_, err = auth.GetToken()
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, authErr.Response.StatusCode)
+	assert.Contains(t, authErr.Error(), "Sorry, you are not authorized!")
+}
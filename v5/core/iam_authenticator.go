@@ -16,6 +16,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -36,9 +37,13 @@ import (
 type IamAuthenticator struct {
 
 	// The apikey used to fetch the bearer token from the IAM token server.
-	// You must specify either ApiKey or RefreshToken.
+	// You must specify either ApiKey (or CredentialsProvider) or RefreshToken.
+	// Once the authenticator is in use, use SetApiKey() to replace the apikey.
 	ApiKey string
 
+	// [Optional] Supplies the apikey for each token fetch, instead of ApiKey.
+	CredentialsProvider CredentialsProvider
+
 	// The refresh token used to fetch the bearer token from the IAM token server.
 	// You must specify either ApiKey or RefreshToken.
 	// If this property is specified, then you also must supply appropriate values
@@ -50,12 +55,19 @@ type IamAuthenticator struct {
 	// a suitable default value will be used [optional].
 	URL string
 
+	// [Optional] Selects the endpoint of the IAM token server if URL is not specified
+	// (see GetIamEndpointURL()): "public" (the default), "private" or "regional:<region>"
+	// (e.g. "regional:us-south"), so that a workload without public egress (e.g. in a VPC)
+	// uses a private endpoint of IAM. At most one of URL or EndpointMode may be specified.
+	EndpointMode string
+
 	// The ClientId and ClientSecret fields are used to form a "basic auth"
 	// Authorization header for interactions with the IAM token server.
 
 	// If neither field is specified, then no Authorization header will be sent
 	// with token server requests [optional]. These fields are optional, but must
-	// be specified together.
+	// be specified together. Once the authenticator is in use, use SetClientIDSecret()
+	// to replace them.
 	ClientId     string
 	ClientSecret string
 
@@ -72,18 +84,44 @@ type IamAuthenticator struct {
 	// made to the token server.
 	Headers map[string]string
 
+	// [Optional] The client ids of the downstream services (receivers) on whose behalf a
+	// delegated refresh token should be requested along with each access token. If specified,
+	// the delegated refresh token is returned in the DelegatedRefreshToken field of the
+	// IamTokenServerResponse returned by RequestToken().
+	ReceiverClientIds []string
+
+	// [Optional] The lifetime of the delegated refresh token (rounded down to whole seconds).
+	// If not specified, then the token server's default lifetime is used.
+	DelegatedRefreshTokenExpiry time.Duration
+
 	// [Optional] The http.Client object used to invoke token server requests.
 	// If not specified by the user, a suitable default Client will be constructed.
 	Client *http.Client
 
+	// [Optional] The options that control how access tokens are obtained, validated, cached and
+	// refreshed (see TokenManagementOptions).
+	TokenManagementOptions
+
 	// The cached token and expiration time.
 	tokenData *iamTokenData
 
-	// Mutex to make the tokenData field thread safe.
+	// The access tokens of other scopes (see GetTokenForScope()), by scope.
+	scopedTokens map[string]*iamScopedToken
+
+	// Incremented each time that the credentials are replaced (see SetApiKey()).
+	credentialsGeneration uint64
+
+	// Mutex to make the tokenData and scopedTokens fields thread safe, and to synchronize access to the
+	// credentials (ApiKey, CredentialsProvider, RefreshToken, ClientId and ClientSecret).
 	tokenDataMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
 }
 
-var iamRequestTokenMutex sync.Mutex
 var iamNeedsRefreshMutex sync.Mutex
 
 const (
@@ -92,6 +130,8 @@ const (
 	iamAuthOperationPathGetToken  = "/identity/token"
 	iamAuthGrantTypeApiKey        = "urn:ibm:params:oauth:grant-type:apikey" // #nosec G101
 	iamAuthGrantTypeRefreshToken  = "refresh_token"                          // #nosec G101
+	iamAuthResponseTypeDefault    = "cloud_iam"
+	iamAuthResponseTypeDelegated  = "cloud_iam,delegated_refresh_token" // #nosec G101
 )
 
 // IamAuthenticatorBuilder is used to construct an IamAuthenticator instance.
@@ -111,6 +151,12 @@ func (builder *IamAuthenticatorBuilder) SetApiKey(s string) *IamAuthenticatorBui
 	return builder
 }
 
+// SetCredentialsProvider sets the CredentialsProvider field in the builder.
+func (builder *IamAuthenticatorBuilder) SetCredentialsProvider(provider CredentialsProvider) *IamAuthenticatorBuilder {
+	builder.IamAuthenticator.CredentialsProvider = provider
+	return builder
+}
+
 // SetRefreshToken sets the RefreshToken field in the builder.
 func (builder *IamAuthenticatorBuilder) SetRefreshToken(s string) *IamAuthenticatorBuilder {
 	builder.IamAuthenticator.RefreshToken = s
@@ -123,6 +169,12 @@ func (builder *IamAuthenticatorBuilder) SetURL(s string) *IamAuthenticatorBuilde
 	return builder
 }
 
+// SetEndpointMode sets the EndpointMode field in the builder.
+func (builder *IamAuthenticatorBuilder) SetEndpointMode(s string) *IamAuthenticatorBuilder {
+	builder.IamAuthenticator.EndpointMode = s
+	return builder
+}
+
 // SetClientIDSecret sets the ClientId and ClientSecret fields in the builder.
 func (builder *IamAuthenticatorBuilder) SetClientIDSecret(clientID, clientSecret string) *IamAuthenticatorBuilder {
 	builder.IamAuthenticator.ClientId = clientID
@@ -148,12 +200,30 @@ func (builder *IamAuthenticatorBuilder) SetHeaders(headers map[string]string) *I
 	return builder
 }
 
+// SetReceiverClientIds sets the ReceiverClientIds field in the builder.
+func (builder *IamAuthenticatorBuilder) SetReceiverClientIds(clientIds ...string) *IamAuthenticatorBuilder {
+	builder.IamAuthenticator.ReceiverClientIds = clientIds
+	return builder
+}
+
+// SetDelegatedRefreshTokenExpiry sets the DelegatedRefreshTokenExpiry field in the builder.
+func (builder *IamAuthenticatorBuilder) SetDelegatedRefreshTokenExpiry(expiry time.Duration) *IamAuthenticatorBuilder {
+	builder.IamAuthenticator.DelegatedRefreshTokenExpiry = expiry
+	return builder
+}
+
 // SetClient sets the Client field in the builder.
 func (builder *IamAuthenticatorBuilder) SetClient(client *http.Client) *IamAuthenticatorBuilder {
 	builder.IamAuthenticator.Client = client
 	return builder
 }
 
+// SetTokenManagementOptions sets the TokenManagementOptions field in the builder.
+func (builder *IamAuthenticatorBuilder) SetTokenManagementOptions(options TokenManagementOptions) *IamAuthenticatorBuilder {
+	builder.IamAuthenticator.TokenManagementOptions = options
+	return builder
+}
+
 // Build() returns a validated instance of the IamAuthenticator with the config that was set in the builder.
 func (builder *IamAuthenticatorBuilder) Build() (*IamAuthenticator, error) {
 
@@ -197,6 +267,7 @@ func newIamAuthenticatorFromMap(properties map[string]string) (authenticator *Ia
 		SetApiKey(properties[PROPNAME_APIKEY]).
 		SetRefreshToken(properties[PROPNAME_REFRESH_TOKEN]).
 		SetURL(properties[PROPNAME_AUTH_URL]).
+		SetEndpointMode(properties[PROPNAME_IAM_ENDPOINT_MODE]).
 		SetClientIDSecret(properties[PROPNAME_CLIENT_ID], properties[PROPNAME_CLIENT_SECRET]).
 		SetDisableSSLVerification(disableSSL).
 		SetScope(properties[PROPNAME_SCOPE]).
@@ -217,12 +288,19 @@ func (*IamAuthenticator) AuthenticationType() string {
 // 		Authorization: Bearer <bearer-token>
 //
 func (authenticator *IamAuthenticator) Authenticate(request *http.Request) error {
-	token, err := authenticator.GetToken()
+	var token string
+	var err error
+	// Use the access token of the scope requested for this request (see WithTokenScope()), if any.
+	if scope, ok := getTokenScope(request.Context()); ok {
+		token, err = authenticator.GetTokenForScopeWithContext(request.Context(), scope)
+	} else {
+		token, err = authenticator.GetTokenWithContext(request.Context())
+	}
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("Authorization", "Bearer "+token)
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
 	return nil
 }
 
@@ -254,15 +332,142 @@ func (authenticator *IamAuthenticator) setTokenData(tokenData *iamTokenData) {
 	}
 }
 
+// setTokenDataIfCurrent is like setTokenData(), but it returns false (without setting the
+// tokenData field) if the credentials were replaced since they had the specified generation.
+func (authenticator *IamAuthenticator) setTokenDataIfCurrent(tokenData *iamTokenData, generation uint64) bool {
+	authenticator.tokenDataMutex.Lock()
+	current := authenticator.credentialsGeneration == generation
+	authenticator.tokenDataMutex.Unlock()
+
+	if current {
+		authenticator.setTokenData(tokenData)
+	}
+	return current
+}
+
+// iamCredentials is a snapshot of the credentials used to obtain an access token.
+type iamCredentials struct {
+	apiKey              string
+	credentialsProvider CredentialsProvider
+	refreshToken        string
+	clientId            string
+	clientSecret        string
+	generation          uint64
+}
+
+// getCredentials returns a snapshot of the authenticator's credentials.
+func (authenticator *IamAuthenticator) getCredentials() iamCredentials {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	return iamCredentials{
+		apiKey:              authenticator.ApiKey,
+		credentialsProvider: authenticator.CredentialsProvider,
+		refreshToken:        authenticator.RefreshToken,
+		clientId:            authenticator.ClientId,
+		clientSecret:        authenticator.ClientSecret,
+		generation:          authenticator.credentialsGeneration,
+	}
+}
+
+// SetApiKey replaces the apikey used to obtain access tokens (e.g. after the apikey was rotated),
+// and discards the cached access token, so that the new apikey is used from the next request on.
+// Any access token being obtained with the previous apikey is discarded once it is obtained.
+// This may be called concurrently with the use of the authenticator (unlike assigning the ApiKey field),
+// and also replaces the CredentialsProvider (if any). It returns an error if the apikey is invalid,
+// or if the authenticator uses a RefreshToken rather than an apikey.
+func (authenticator *IamAuthenticator) SetApiKey(apiKey string) error {
+	if apiKey == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "ApiKey")
+	}
+	if HasBadFirstOrLastChar(apiKey) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "ApiKey")
+	}
+
+	return authenticator.replaceCredentials(func() error {
+		if authenticator.ApiKey == "" && authenticator.CredentialsProvider == nil {
+			return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken")
+		}
+		authenticator.ApiKey = apiKey
+		authenticator.CredentialsProvider = nil
+		return nil
+	})
+}
+
+// SetClientIDSecret replaces the ClientId and ClientSecret (e.g. after the client secret was rotated),
+// and discards the cached access token, as for SetApiKey(). Both must be specified, unless the
+// authenticator uses an apikey, in which case both may be empty.
+func (authenticator *IamAuthenticator) SetClientIDSecret(clientID string, clientSecret string) error {
+	return authenticator.replaceCredentials(func() error {
+		usesApiKey := authenticator.ApiKey != "" || authenticator.CredentialsProvider != nil
+		if clientID == "" && (clientSecret != "" || !usesApiKey) {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientId")
+		}
+		if clientSecret == "" && clientID != "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientSecret")
+		}
+		authenticator.ClientId = clientID
+		authenticator.ClientSecret = clientSecret
+		return nil
+	})
+}
+
+// replaceCredentials invokes "update" to replace the authenticator's credentials and, if it succeeds,
+// discards the cached access token (including the token shared via the TokenCache, if any).
+func (authenticator *IamAuthenticator) replaceCredentials(update func() error) error {
+	previousCacheKeys := append(authenticator.scopedTokenCacheKeys(), authenticator.tokenCacheKey())
+
+	authenticator.tokenDataMutex.Lock()
+	err := update()
+	if err == nil {
+		authenticator.credentialsGeneration++
+		authenticator.tokenData = nil
+		authenticator.scopedTokens = nil
+	}
+	authenticator.tokenDataMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, cacheKey := range previousCacheKeys {
+		deleteCachedIamToken(authenticator.TokenCache, cacheKey)
+	}
+	return nil
+}
+
+// InvalidateToken discards the cached access tokens (if any), including those of other scopes
+// (see GetTokenForScope()), so that a new access token is fetched the next time that the
+// authenticator is used.
+func (authenticator *IamAuthenticator) InvalidateToken() {
+	cacheKeys := append(authenticator.scopedTokenCacheKeys(), authenticator.tokenCacheKey())
+
+	authenticator.tokenDataMutex.Lock()
+	authenticator.scopedTokens = nil
+	authenticator.tokenDataMutex.Unlock()
+	authenticator.setTokenData(nil)
+
+	for _, cacheKey := range cacheKeys {
+		deleteCachedIamToken(authenticator.TokenCache, cacheKey)
+	}
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *IamAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
 // Validate the authenticator's configuration.
 //
 // Ensures that the ApiKey and RefreshToken properties are mutually exclusive,
 // and that the ClientId and ClientSecret properties are mutually inclusive.
 func (this *IamAuthenticator) Validate() error {
 
-	// The user should specify exactly one of ApiKey or RefreshToken.
-	if this.ApiKey == "" && this.RefreshToken == "" ||
-		this.ApiKey != "" && this.RefreshToken != "" {
+	// The user should specify exactly one of ApiKey (or CredentialsProvider) or RefreshToken.
+	hasApiKey := this.ApiKey != "" || this.CredentialsProvider != nil
+	if !hasApiKey && this.RefreshToken == "" ||
+		hasApiKey && this.RefreshToken != "" {
 		return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken")
 	}
 
@@ -286,6 +491,24 @@ func (this *IamAuthenticator) Validate() error {
 		}
 	}
 
+	// A delegated refresh token is requested only for the specified receivers.
+	if this.DelegatedRefreshTokenExpiry != 0 && len(this.ReceiverClientIds) == 0 {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "ReceiverClientIds")
+	}
+	if this.DelegatedRefreshTokenExpiry < 0 {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "DelegatedRefreshTokenExpiry")
+	}
+
+	// The endpoint mode selects the URL, so it can't be specified along with the URL.
+	if this.EndpointMode != "" {
+		if this.URL != "" {
+			return fmt.Errorf(ERRORMSG_ATMOST_ONE_PROP_ERROR, "URL", "EndpointMode")
+		}
+		if _, err := GetIamEndpointURL(this.EndpointMode); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -293,96 +516,162 @@ func (this *IamAuthenticator) Validate() error {
 // Whenever a new token is needed (when a token doesn't yet exist, needs to be refreshed,
 // or the existing token has expired), a new access token is fetched from the token server.
 func (authenticator *IamAuthenticator) GetToken() (string, error) {
-	if authenticator.getTokenData() == nil || !authenticator.getTokenData().isTokenValid() {
-		// synchronously request the token
-		err := authenticator.synchronizedRequestToken()
+	return authenticator.GetTokenWithContext(context.Background())
+}
+
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *IamAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
+}
+
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *IamAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
+
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *IamAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
+}
+
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+func (authenticator *IamAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_IAM,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
+	}
+}
+
+// fetchTokenData requests a new token from the IAM token server (unless the TokenCache holds
+// a token that can still be used) and stores it in the authenticator's 'tokenData' field (cache).
+func (authenticator *IamAuthenticator) fetchTokenData(ctx context.Context) error {
+	// If the credentials are replaced (see SetApiKey()) while a token is being obtained,
+	// then the token is discarded and a new one is obtained with the new credentials.
+	for {
+		credentials := authenticator.getCredentials()
+		requestToken := func(ctx context.Context) (*IamTokenServerResponse, error) {
+			return authenticator.requestTokenWithCredentials(ctx, credentials, authenticator.Scope)
+		}
+		tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKeyFor(credentials), requestToken)
 		if err != nil {
-			return "", err
+			return err
 		}
-	} else if authenticator.getTokenData().needsRefresh() {
-		// If refresh needed, kick off a go routine in the background to get a new token
-		//nolint: errcheck
-		go authenticator.invokeRequestTokenData()
-	}
 
-	// return an error if the access token is not valid or was not fetched
-	if authenticator.getTokenData() == nil || authenticator.getTokenData().AccessToken == "" {
-		return "", fmt.Errorf("Error while trying to get access token")
+		if authenticator.setTokenDataIfCurrent(tokenData, credentials.generation) {
+			store()
+			return nil
+		}
+		GetLogger().Debug("Discarding the access token obtained with replaced credentials")
 	}
-
-	return authenticator.getTokenData().AccessToken, nil
 }
 
-// synchronizedRequestToken: synchronously checks if the current token in cache
-// is valid. If token is not valid or does not exist, it will fetch a new token
-// and set the tokenRefreshTime
-func (authenticator *IamAuthenticator) synchronizedRequestToken() error {
-	iamRequestTokenMutex.Lock()
-	defer iamRequestTokenMutex.Unlock()
-	// if cached token is still valid, then just continue to use it
-	if authenticator.getTokenData() != nil && authenticator.getTokenData().isTokenValid() {
-		return nil
+// tokenCacheKey returns the key under which the authenticator's tokens are cached, or ""
+// if there is no TokenCache. The key is derived from the token server URL, the credentials,
+// the client id and the scope.
+func (authenticator *IamAuthenticator) tokenCacheKey() string {
+	if authenticator.TokenCache == nil {
+		return ""
 	}
+	return authenticator.tokenCacheKeyFor(authenticator.getCredentials())
+}
 
-	return authenticator.invokeRequestTokenData()
+// tokenCacheKeyFor is like tokenCacheKey(), but uses the specified credentials.
+func (authenticator *IamAuthenticator) tokenCacheKeyFor(credentials iamCredentials) string {
+	return authenticator.tokenCacheKeyForScope(credentials, authenticator.Scope)
 }
 
-// invokeRequestTokenData: requests a new token from the access server and
-// unmarshals the token information to the tokenData cache. Returns
-// an error if the token was unable to be fetched, otherwise returns nil
-func (authenticator *IamAuthenticator) invokeRequestTokenData() error {
-	tokenResponse, err := authenticator.RequestToken()
-	if err != nil {
-		return err
+// tokenCacheKeyForScope is like tokenCacheKeyFor(), but for an access token of "scope".
+func (authenticator *IamAuthenticator) tokenCacheKeyForScope(credentials iamCredentials, scope string) string {
+	if authenticator.TokenCache == nil {
+		return ""
 	}
-
-	if tokenData, err := newIamTokenData(tokenResponse); err != nil {
-		return err
-	} else {
-		authenticator.setTokenData(tokenData)
+	apikey := credentials.apiKey
+	if credentials.credentialsProvider != nil {
+		var err error
+		if apikey, err = credentials.credentialsProvider.GetAPIKey(); err != nil {
+			return ""
+		}
 	}
-
-	return nil
+	// The refresh token is used (and is therefore part of the key) only if there is no apikey.
+	refreshToken := ""
+	if apikey == "" {
+		refreshToken = credentials.refreshToken
+	}
+	return newTokenCacheKey(authenticator.TokenCache, AUTHTYPE_IAM, authenticator.tokenServerURL(), apikey,
+		refreshToken, credentials.clientId, scope,
+		strings.Join(authenticator.ReceiverClientIds, ","), authenticator.DelegatedRefreshTokenExpiry.String())
 }
 
 // RequestToken fetches a new access token from the token server.
 func (authenticator *IamAuthenticator) RequestToken() (*IamTokenServerResponse, error) {
+	return authenticator.requestToken(context.Background())
+}
 
-	// Use the default IAM URL if one was not specified by the user.
-	url := authenticator.URL
-	if url == "" {
-		url = defaultIamTokenServerEndpoint
-	} else {
-		// Canonicalize the URL by removing the operation path if it was specified by the user.
-		url = strings.TrimSuffix(url, iamAuthOperationPathGetToken)
-	}
+// requestToken is like RequestToken(), but the token request is abandoned if "ctx" is done.
+func (authenticator *IamAuthenticator) requestToken(ctx context.Context) (*IamTokenServerResponse, error) {
+	return authenticator.requestTokenWithCredentials(ctx, authenticator.getCredentials(), authenticator.Scope)
+}
+
+// requestTokenWithCredentials is like requestToken(), but uses the specified credentials
+// and requests an access token for "scope".
+func (authenticator *IamAuthenticator) requestTokenWithCredentials(ctx context.Context,
+	credentials iamCredentials, scope string) (*IamTokenServerResponse, error) {
 
-	builder := NewRequestBuilder(POST)
-	_, err := builder.ResolveRequestURL(url, iamAuthOperationPathGetToken, nil)
+	builder := NewRequestBuilder(POST).WithContext(ctx)
+	_, err := builder.ResolveRequestURL(authenticator.tokenServerURL(), iamAuthOperationPathGetToken, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	builder.AddHeader(CONTENT_TYPE, "application/x-www-form-urlencoded")
 	builder.AddHeader(Accept, APPLICATION_JSON)
-	builder.AddFormData("response_type", "", "", "cloud_iam")
+	// Request a delegated refresh token as well, if there are receivers.
+	if len(authenticator.ReceiverClientIds) > 0 {
+		builder.AddFormData("response_type", "", "", iamAuthResponseTypeDelegated)
+		builder.AddFormData("receiver_client_ids", "", "", strings.Join(authenticator.ReceiverClientIds, ","))
+		if expiry := int64(authenticator.DelegatedRefreshTokenExpiry / time.Second); expiry > 0 {
+			builder.AddFormData("delegated_refresh_token_expiry", "", "", strconv.FormatInt(expiry, 10))
+		}
+	} else {
+		builder.AddFormData("response_type", "", "", iamAuthResponseTypeDefault)
+	}
 
-	if authenticator.ApiKey != "" {
+	if credentials.credentialsProvider != nil {
+		// If a CredentialsProvider was configured, then use the current apikey that it supplies.
+		apikey, err := credentials.credentialsProvider.GetAPIKey()
+		if err != nil {
+			return nil, err
+		}
+		if apikey == "" {
+			return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ApiKey")
+		}
+		builder.AddFormData("grant_type", "", "", iamAuthGrantTypeApiKey)
+		builder.AddFormData("apikey", "", "", apikey)
+	} else if credentials.apiKey != "" {
 		// If ApiKey was configured, then use grant_type "apikey" to obtain an access token.
 		builder.AddFormData("grant_type", "", "", iamAuthGrantTypeApiKey)
-		builder.AddFormData("apikey", "", "", authenticator.ApiKey)
-	} else if authenticator.RefreshToken != "" {
+		builder.AddFormData("apikey", "", "", credentials.apiKey)
+	} else if credentials.refreshToken != "" {
 		// Otherwise, if RefreshToken was configured then use grant_type "refresh_token".
 		builder.AddFormData("grant_type", "", "", iamAuthGrantTypeRefreshToken)
-		builder.AddFormData("refresh_token", "", "", authenticator.RefreshToken)
+		builder.AddFormData("refresh_token", "", "", credentials.refreshToken)
 	} else {
 		// We shouldn't ever get here due to prior validations, but just in case, let's log an error.
 		return nil, fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken")
 	}
 
 	// Add any optional parameters to the request.
-	if authenticator.Scope != "" {
-		builder.AddFormData("scope", "", "", authenticator.Scope)
+	if scope != "" {
+		builder.AddFormData("scope", "", "", scope)
 	}
 
 	// Add user-defined headers to request.
@@ -399,25 +688,12 @@ func (authenticator *IamAuthenticator) RequestToken() (*IamTokenServerResponse,
 	// as a basic auth header.
 	// Our previous validation step would have made sure that both values are specified
 	// if the RefreshToken property was specified.
-	if authenticator.ClientId != "" && authenticator.ClientSecret != "" {
-		req.SetBasicAuth(authenticator.ClientId, authenticator.ClientSecret)
+	if credentials.clientId != "" && credentials.clientSecret != "" {
+		req.SetBasicAuth(credentials.clientId, credentials.clientSecret)
 	}
 
 	// If the authenticator does not have a Client, create one now.
-	if authenticator.Client == nil {
-		authenticator.Client = &http.Client{
-			Timeout: time.Second * 30,
-		}
-
-		// If the user told us to disable SSL verification, then do it now.
-		if authenticator.DisableSSLVerification {
-			transport := &http.Transport{
-				// #nosec G402
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			}
-			authenticator.Client.Transport = transport
-		}
-	}
+	authenticator.initClient()
 
 	// If debug is enabled, then dump the request.
 	if GetLogger().IsLogLevelEnabled(LevelDebug) {
@@ -434,6 +710,7 @@ func (authenticator *IamAuthenticator) RequestToken() (*IamTokenServerResponse,
 	if err != nil {
 		return nil, err
 	}
+
 	GetLogger().Debug("Returned from IAM 'get token' operation, received status code %d", resp.StatusCode)
 
 	// If debug is enabled, then dump the response.
@@ -465,12 +742,47 @@ func (authenticator *IamAuthenticator) RequestToken() (*IamTokenServerResponse,
 		return nil, NewAuthenticationError(detailedResponse, fmt.Errorf(iamErrorMsg))
 	}
 
-	tokenResponse := &IamTokenServerResponse{}
+	tokenResponse := &IamTokenServerResponse{clockSkew: measureClockSkew(resp.Header)}
 	_ = json.NewDecoder(resp.Body).Decode(tokenResponse)
 	defer resp.Body.Close()
 	return tokenResponse, nil
 }
 
+// tokenServerURL returns the base URL of the IAM token server.
+func (authenticator *IamAuthenticator) tokenServerURL() string {
+	// Use the URL selected by the endpoint mode (or the default IAM URL) if one was not specified by the user.
+	url := authenticator.URL
+	if url == "" {
+		url = defaultIamTokenServerEndpoint
+		if modeURL, err := GetIamEndpointURL(authenticator.EndpointMode); err == nil {
+			url = modeURL
+		}
+	} else {
+		// Canonicalize the URL by removing the operation path if it was specified by the user.
+		url = strings.TrimSuffix(url, iamAuthOperationPathGetToken)
+	}
+	return url
+}
+
+// initClient creates the Client used to invoke the IAM token server, if the
+// authenticator does not already have one.
+func (authenticator *IamAuthenticator) initClient() {
+	if authenticator.Client == nil {
+		authenticator.Client = &http.Client{
+			Timeout: time.Second * 30,
+		}
+
+		// If the user told us to disable SSL verification, then do it now.
+		if authenticator.DisableSSLVerification {
+			transport := &http.Transport{
+				// #nosec G402
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			authenticator.Client.Transport = transport
+		}
+	}
+}
+
 // IamTokenServerResponse : This struct models a response received from the token server.
 type IamTokenServerResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -478,14 +790,23 @@ type IamTokenServerResponse struct {
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int64  `json:"expires_in"`
 	Expiration   int64  `json:"expiration"`
+
+	// The delegated refresh token, if one was requested (see IamAuthenticator.ReceiverClientIds).
+	DelegatedRefreshToken string `json:"delegated_refresh_token,omitempty"`
+
+	// The skew between the token server's clock and the local clock (see measureClockSkew()).
+	clockSkew time.Duration
 }
 
 // iamTokenData : This struct represents the cached information related to a fetched access token.
+// The refresh and expiration times are those of the local clock, and ClockSkew is the skew between
+// the token server's clock and the local clock when the token was obtained.
 type iamTokenData struct {
 	AccessToken  string
 	RefreshToken string
 	RefreshTime  int64
 	Expiration   int64
+	ClockSkew    time.Duration
 }
 
 // newIamTokenData: constructs a new IamTokenData instance from the specified IamTokenServerResponse instance.
@@ -499,11 +820,18 @@ func newIamTokenData(tokenResponse *IamTokenServerResponse) (*iamTokenData, erro
 	expireTime := tokenResponse.Expiration
 	refreshTime := expireTime - int64(float64(timeToLive)*0.2)
 
+	// Convert the times to the local clock, in case the token server's clock is skewed.
+	skew := tokenResponse.clockSkew
+	if skew != 0 {
+		GetLogger().Warn("Clock skew detected: the token server's clock differs from the local clock by %s", skew.String())
+	}
+
 	tokenData := &iamTokenData{
 		AccessToken:  tokenResponse.AccessToken,
 		RefreshToken: tokenResponse.RefreshToken,
-		Expiration:   expireTime,
-		RefreshTime:  refreshTime,
+		Expiration:   toLocalTime(expireTime, skew),
+		RefreshTime:  toLocalTime(refreshTime, skew),
+		ClockSkew:    skew,
 	}
 
 	return tokenData, nil
@@ -511,7 +839,7 @@ func newIamTokenData(tokenResponse *IamTokenServerResponse) (*iamTokenData, erro
 
 // isTokenValid: returns true iff the IamTokenData instance represents a valid (non-expired) access token.
 func (this *iamTokenData) isTokenValid() bool {
-	if this.AccessToken != "" && GetCurrentTime() < this.Expiration {
+	if this != nil && this.AccessToken != "" && GetCurrentTime() < this.Expiration {
 		return true
 	}
 	return false
@@ -521,6 +849,10 @@ func (this *iamTokenData) isTokenValid() bool {
 // updates the refresh time if it determines the token needs refreshed to prevent other threads from
 // making multiple refresh calls.
 func (this *iamTokenData) needsRefresh() bool {
+	if this == nil {
+		return false
+	}
+
 	iamNeedsRefreshMutex.Lock()
 	defer iamNeedsRefreshMutex.Unlock()
 
@@ -532,3 +864,11 @@ func (this *iamTokenData) needsRefresh() bool {
 
 	return false
 }
+
+// token returns the access token (if any), and its expiration and refresh times.
+func (this *iamTokenData) token() (accessToken string, expiration int64, refreshTime int64) {
+	if this == nil {
+		return "", 0, 0
+	}
+	return this.AccessToken, this.Expiration, this.RefreshTime
+}
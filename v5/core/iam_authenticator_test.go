@@ -17,11 +17,15 @@ package core
 // limitations under the License.
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1161,3 +1165,537 @@ func TestIamLiveTokenServer(t *testing.T) {
 	assert.NotEmpty(t, accessToken)
 	assert.NotEqual(t, refreshToken, refreshAuth.RefreshToken)
 }
+
+func TestIamEnsureFreshToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int
+	expiresIn := 3600
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": %d,
+			"expiration": %d,
+			"refresh_token": "jy4gl91BQ"
+		}`, iamAuthTestAccessToken1, expiresIn, GetCurrentTime()+int64(expiresIn))
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	var prewarmer TokenPrewarmer = authenticator
+
+	// The first call should fetch a token.
+	err = prewarmer.EnsureFreshToken(context.Background(), 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, iamAuthTestAccessToken1, authenticator.getTokenData().AccessToken)
+
+	// The cached token has enough remaining lifetime, so no new token is fetched.
+	err = authenticator.EnsureFreshToken(context.Background(), 30*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+
+	// Force the cached token to be nearly expired so that a new token is fetched,
+	// even though the cached token is still valid.
+	authenticator.getTokenData().Expiration = GetCurrentTime() + 60
+	err = authenticator.EnsureFreshToken(context.Background(), 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, 2, requests)
+
+	// A minimum lifetime that exceeds the lifetime of a new token results in an error.
+	err = authenticator.EnsureFreshToken(context.Background(), 2*time.Hour)
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests)
+	assert.Contains(t, err.Error(), "is less than the requested minimum (2h0m0s)")
+
+	// A cancelled context results in an error if a new token is needed.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = authenticator.EnsureFreshToken(ctx, 2*time.Hour)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 3, requests)
+	err = authenticator.EnsureFreshToken(ctx, time.Minute)
+	assert.Nil(t, err)
+}
+
+func TestIamEnsureFreshTokenFailure(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("Sorry you are forbidden"))
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	err = authenticator.EnsureFreshToken(context.Background(), time.Minute)
+	assert.NotNil(t, err)
+	assert.True(t, IsAuthenticationFailure(err))
+	assert.Nil(t, authenticator.getTokenData())
+}
+
+func TestIamGetTokenWithContext(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	var slow int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&slow) == 1 {
+			// Simulate a token server that doesn't respond until the request is abandoned.
+			// (The server detects that the client has gone away only once the body has been read.)
+			_, _ = ioutil.ReadAll(r.Body)
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// The token request is abandoned when the context's deadline expires.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = authenticator.GetTokenWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Nil(t, authenticator.getTokenData())
+
+	// A context that is already done results in an error without a token request.
+	requestsBefore := atomic.LoadInt32(&requests)
+	_, err = authenticator.GetTokenWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, requestsBefore, atomic.LoadInt32(&requests))
+
+	// Once the token server responds, the token is fetched (and then cached).
+	atomic.StoreInt32(&slow, 0)
+	token, err := authenticator.GetTokenWithContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	token, err = authenticator.GetTokenWithContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+}
+
+func TestIamAuthenticateRequestContext(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	// Simulate a token server that doesn't respond until the request is abandoned.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// Cancelling the context of the request being authenticated stops the blocked token request.
+	ctx, cancel := context.WithCancel(context.Background())
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://localhost/placeholder/url", nil)
+	assert.Nil(t, err)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err = authenticator.Authenticate(request)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Empty(t, request.Header.Get("Authorization"))
+	assert.Nil(t, authenticator.getTokenData())
+}
+
+func TestIamExpectedIssuerAudience(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "jy4gl91BQ"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{
+			ExpectedIssuer:   "John",
+			ExpectedAudience: "DSX",
+		}).
+		Build()
+	assert.Nil(t, err)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// A token from an unexpected issuer is rejected and not cached.
+	authenticator, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{ExpectedIssuer: "https://iam.cloud.ibm.com/identity"}).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_ISSUER_MISMATCH, "John", "https://iam.cloud.ibm.com/identity"), err.Error())
+	assert.Nil(t, authenticator.getTokenData())
+}
+
+func TestIamIntrospectToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/identity/introspect", r.URL.Path)
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "mookie", username)
+		assert.Equal(t, "betts", password)
+		assert.Nil(t, r.ParseForm())
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("token") {
+		case "active-token":
+			fmt.Fprint(w, `{"active": true, "exp": 1610591333, "iat": 1610587733, "scope": "ibm openid",
+				"sub": "user@example.com", "iam_id": "IBMid-123", "client_id": "bx",
+				"account": {"bss": "account-1", "valid": true}, "realmid": "IBMid"}`)
+		case "expired-token":
+			fmt.Fprint(w, `{"active": false}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorCode": "BXNIM0415E", "errorMessage": "Provided token is invalid"}`)
+		}
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetClientIDSecret("mookie", "betts").
+		Build()
+	assert.Nil(t, err)
+
+	result, err := authenticator.IntrospectToken(context.Background(), "active-token")
+	assert.Nil(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, int64(1610591333), result.ExpiresAt)
+	assert.Equal(t, "ibm openid", result.Scope)
+	assert.Equal(t, "user@example.com", result.Subject)
+	assert.Equal(t, "IBMid-123", result.IamID)
+	assert.Equal(t, "account-1", result.Account.Bss)
+	assert.True(t, result.Account.Valid)
+	assert.Equal(t, "IBMid", result.Raw["realmid"])
+
+	result, err = authenticator.IntrospectToken(context.Background(), "expired-token")
+	assert.Nil(t, err)
+	assert.False(t, result.Active)
+
+	_, err = authenticator.IntrospectToken(context.Background(), "bad-token")
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, authErr.Response.StatusCode)
+
+	_, err = authenticator.IntrospectToken(context.Background(), "")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "token"), err.Error())
+
+	authenticator.ClientId = ""
+	_, err = authenticator.IntrospectToken(context.Background(), "active-token")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientId"), err.Error())
+}
+
+func TestIntrospectToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	attempts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/identity/introspect", r.URL.Path)
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "mookie", username)
+		assert.Equal(t, "betts", password)
+		assert.Equal(t, "value1", r.Header.Get("header1"))
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "active-token", r.PostForm.Get("token"))
+
+		// The first attempt fails with a retryable status code.
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"active": true, "exp": 1610591333, "scope": "ibm openid", "sub": "user@example.com",
+			"account": {"bss": "account-1", "valid": true}}`)
+	}))
+	defer server.Close()
+
+	opts := &IntrospectTokenOptions{
+		ClientId:               "mookie",
+		ClientSecret:           "betts",
+		URL:                    server.URL + "/identity/introspect",
+		Headers:                map[string]string{"header1": "value1"},
+		DisableSSLVerification: true,
+		MaxRetries:             2,
+		MaxRetryInterval:       10 * time.Millisecond,
+	}
+	result, err := IntrospectToken(context.Background(), "active-token", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.True(t, result.Active)
+	assert.Equal(t, int64(1610591333), result.ExpiresAt)
+	assert.Equal(t, "ibm openid", result.Scope)
+	assert.Equal(t, "user@example.com", result.Subject)
+	assert.Equal(t, "account-1", result.Account.Bss)
+
+	// Without retries, the failed attempt is an error.
+	attempts = 0
+	opts.MaxRetries = 0
+	_, err = IntrospectToken(context.Background(), "active-token", opts)
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusServiceUnavailable, authErr.Response.StatusCode)
+
+	// The server's certificate is verified unless verification is disabled.
+	opts.DisableSSLVerification = false
+	_, err = IntrospectToken(context.Background(), "active-token", opts)
+	assert.NotNil(t, err)
+
+	// A client can be supplied instead.
+	opts.Client = server.Client()
+	_, err = IntrospectToken(context.Background(), "active-token", opts)
+	assert.Nil(t, err)
+
+	_, err = IntrospectToken(context.Background(), "active-token", nil)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientId"), err.Error())
+	_, err = IntrospectToken(context.Background(), "active-token", &IntrospectTokenOptions{ClientId: "mookie"})
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientSecret"), err.Error())
+}
+
+func TestIamDelegatedRefreshToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		assert.Nil(t, err)
+
+		var delegatedRefreshToken string
+		if r.FormValue("response_type") == "cloud_iam,delegated_refresh_token" {
+			assert.Equal(t, "receiver-1,receiver-2", r.FormValue("receiver_client_ids"))
+			assert.Equal(t, "7200", r.FormValue("delegated_refresh_token_expiry"))
+			delegatedRefreshToken = "delegated-refresh-token"
+		} else {
+			assert.Equal(t, "cloud_iam", r.FormValue("response_type"))
+			assert.Empty(t, r.Form["receiver_client_ids"])
+			assert.Empty(t, r.Form["delegated_refresh_token_expiry"])
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "%s",
+			"delegated_refresh_token": "%s"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600, iamAuthTestRefreshToken, delegatedRefreshToken)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetReceiverClientIds("receiver-1", "receiver-2").
+		SetDelegatedRefreshTokenExpiry(2 * time.Hour).
+		Build()
+	assert.Nil(t, err)
+	tokenResponse, err := authenticator.RequestToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, tokenResponse.AccessToken)
+	assert.Equal(t, "delegated-refresh-token", tokenResponse.DelegatedRefreshToken)
+
+	// Without receivers, no delegated refresh token is requested.
+	authenticator, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	tokenResponse, err = authenticator.RequestToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "", tokenResponse.DelegatedRefreshToken)
+
+	// An expiry requires receivers, and must not be negative.
+	_, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetDelegatedRefreshTokenExpiry(time.Hour).
+		Build()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ReceiverClientIds"), err.Error())
+	_, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetReceiverClientIds("receiver-1").
+		SetDelegatedRefreshTokenExpiry(-time.Hour).
+		Build()
+	assert.NotNil(t, err)
+}
+
+func TestIamSetApiKey(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var clientCredentials string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		assert.Nil(t, err)
+
+		accessToken := iamAuthTestAccessToken1
+		if r.FormValue("apikey") == "rotated-apikey" {
+			accessToken = iamAuthTestAccessToken2
+		}
+		clientID, clientSecret, _ := r.BasicAuth()
+		clientCredentials = clientID + ":" + clientSecret
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "%s"
+		}`, accessToken, GetCurrentTime()+3600, iamAuthTestRefreshToken)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// Rotating the apikey discards the cached token.
+	err = authenticator.SetApiKey("rotated-apikey")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-apikey", authenticator.ApiKey)
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken2, token)
+
+	// Invalid apikeys are rejected.
+	err = authenticator.SetApiKey("")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ApiKey"), err.Error())
+	err = authenticator.SetApiKey("{rotated-apikey}")
+	assert.NotNil(t, err)
+	assert.Equal(t, "rotated-apikey", authenticator.ApiKey)
+
+	// The client id and secret can be set, and cleared, when an apikey is used.
+	err = authenticator.SetClientIDSecret("new-client-id", "new-client-secret")
+	assert.Nil(t, err)
+	_, err = authenticator.RequestToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "new-client-id:new-client-secret", clientCredentials)
+	err = authenticator.SetClientIDSecret("new-client-id", "")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientSecret"), err.Error())
+	err = authenticator.SetClientIDSecret("", "")
+	assert.Nil(t, err)
+	_, err = authenticator.RequestToken()
+	assert.Nil(t, err)
+	assert.Equal(t, ":", clientCredentials)
+
+	// An apikey can't replace a refresh token, which requires a client id and secret.
+	authenticator, err = NewIamAuthenticatorBuilder().
+		SetRefreshToken(iamAuthMockRefreshToken).
+		SetClientIDSecret(iamAuthMockClientID, iamAuthMockClientSecret).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	err = authenticator.SetApiKey("rotated-apikey")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken"), err.Error())
+	err = authenticator.SetClientIDSecret("", "")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientId"), err.Error())
+	err = authenticator.SetClientIDSecret("new-client-id", "new-client-secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "new-client-secret", authenticator.ClientSecret)
+}
+
+func TestIamSetApiKeyConcurrently(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		assert.Nil(t, err)
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "%s"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600, iamAuthTestRefreshToken)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// Tokens are obtained while the apikey is rotated (run with -race to detect data races).
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := authenticator.GetToken()
+			assert.Nil(t, err)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			err := authenticator.SetApiKey(fmt.Sprintf("rotated-apikey-%d", i))
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+}
@@ -0,0 +1,234 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// IAM environments. An access token obtained from the IAM token server of one
+// environment is not accepted by the services of another environment.
+// The private endpoints of the IAM token server and of the services (e.g. private.iam.cloud.ibm.com)
+// belong to the public environment, whose access tokens they accept.
+const (
+	IamEnvironmentPublic    = "public"
+	IamEnvironmentTest      = "test"
+	IamEnvironmentDedicated = "dedicated"
+	IamEnvironmentSovereign = "sovereign"
+)
+
+// IamEndpoint describes the hosts of the IAM token server, and of the services, of an IAM environment.
+// Host patterns are matched with path.Match() (e.g. "*.cloud.ibm.com"), ignoring case.
+type IamEndpoint struct {
+	// The name of the environment (e.g. IamEnvironmentSovereign).
+	Environment string
+
+	// The host patterns of the environment's IAM token server (e.g. "iam.cloud.ibm.com").
+	IamHosts []string
+
+	// The host patterns of the environment's services (e.g. "*.cloud.ibm.com").
+	ServiceHosts []string
+}
+
+// iamEndpoints is the registry of known IAM endpoints, in the order in which they are matched
+// (so more specific patterns precede more general ones).
+var iamEndpoints = []IamEndpoint{
+	{
+		Environment:  IamEnvironmentTest,
+		IamHosts:     []string{"iam.test.cloud.ibm.com", "*.iam.test.cloud.ibm.com"},
+		ServiceHosts: []string{"*.test.cloud.ibm.com"},
+	},
+	{
+		Environment:  IamEnvironmentPublic,
+		IamHosts:     []string{"iam.cloud.ibm.com", "*.iam.cloud.ibm.com"},
+		ServiceHosts: []string{"*.cloud.ibm.com"},
+	},
+}
+var iamEndpointsMutex sync.RWMutex
+
+// RegisterIamEndpoint adds "endpoint" to the registry of known IAM endpoints (e.g. for a dedicated
+// or sovereign environment). Its patterns take precedence over those of the endpoints registered before it.
+func RegisterIamEndpoint(endpoint IamEndpoint) error {
+	if endpoint.Environment == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "Environment")
+	}
+	if len(endpoint.IamHosts) == 0 && len(endpoint.ServiceHosts) == 0 {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "IamHosts")
+	}
+	for _, pattern := range append(append([]string{}, endpoint.IamHosts...), endpoint.ServiceHosts...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "host pattern '"+pattern+"'")
+		}
+	}
+
+	iamEndpointsMutex.Lock()
+	defer iamEndpointsMutex.Unlock()
+
+	iamEndpoints = append([]IamEndpoint{endpoint}, iamEndpoints...)
+	return nil
+}
+
+// GetIamEnvironment returns the environment of the IAM token server with URL "iamURL",
+// or "" if it doesn't match a known IAM endpoint.
+func GetIamEnvironment(iamURL string) string {
+	return findIamEnvironment(iamURL, func(endpoint IamEndpoint) []string {
+		return endpoint.IamHosts
+	})
+}
+
+// GetServiceEnvironment returns the IAM environment of the service with URL "serviceURL",
+// or "" if it doesn't match a known IAM endpoint.
+func GetServiceEnvironment(serviceURL string) string {
+	return findIamEnvironment(serviceURL, func(endpoint IamEndpoint) []string {
+		return endpoint.ServiceHosts
+	})
+}
+
+// ValidateIamEndpoint returns an error if the IAM token server with URL "iamURL" and the service
+// with URL "serviceURL" belong to different IAM environments (e.g. a test IAM token server is used with
+// a production service), in which case the service will reject the access tokens.
+// No error is returned if the environment of either URL is unknown.
+func ValidateIamEndpoint(iamURL string, serviceURL string) error {
+	iamEnvironment := GetIamEnvironment(iamURL)
+	serviceEnvironment := GetServiceEnvironment(serviceURL)
+	if iamEnvironment == "" || serviceEnvironment == "" || iamEnvironment == serviceEnvironment {
+		return nil
+	}
+	return fmt.Errorf(ERRORMSG_IAM_ENDPOINT_MISMATCH, iamURL, iamEnvironment, serviceURL, serviceEnvironment)
+}
+
+// findIamEnvironment returns the environment of the first endpoint with a host pattern
+// (returned by "patterns") that matches the host of "rawURL".
+func findIamEnvironment(rawURL string, patterns func(endpoint IamEndpoint) []string) string {
+	host := urlHostname(rawURL)
+	if host == "" {
+		return ""
+	}
+
+	iamEndpointsMutex.RLock()
+	defer iamEndpointsMutex.RUnlock()
+
+	for _, endpoint := range iamEndpoints {
+		for _, pattern := range patterns(endpoint) {
+			if matched, _ := path.Match(strings.ToLower(pattern), host); matched {
+				return endpoint.Environment
+			}
+		}
+	}
+	return ""
+}
+
+// urlHostname returns the (lower case) host name of "rawURL", which may omit the scheme.
+func urlHostname(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+// IAM endpoint modes, which select the endpoint of the IAM token server used by an IamAuthenticator
+// (see IamAuthenticator.EndpointMode). The regional mode is specified with a region, as "regional:<region>".
+const (
+	IamEndpointModePublic   = "public"
+	IamEndpointModePrivate  = "private"
+	IamEndpointModeRegional = "regional"
+)
+
+// iamRegionPattern matches the name of an IBM Cloud region (e.g. "us-south").
+var iamRegionPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// GetIamEndpointURL returns the URL of the IAM token server selected by the endpoint mode "mode":
+//
+// - "public" (or ""): the global public endpoint (https://iam.cloud.ibm.com).
+//
+// - "private": the global private endpoint (https://private.iam.cloud.ibm.com), which can be
+// reached over the IBM Cloud private network (e.g. from a VPC without public egress).
+//
+// - "regional:<region>": the private endpoint of the region (e.g. https://private.us-south.iam.cloud.ibm.com
+// for "regional:us-south"), which is also the endpoint of IAM's Virtual Private Endpoint (VPE) in a VPC.
+func GetIamEndpointURL(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch {
+	case mode == "" || mode == IamEndpointModePublic:
+		return defaultIamTokenServerEndpoint, nil
+	case mode == IamEndpointModePrivate:
+		return "https://private.iam.cloud.ibm.com", nil
+	case strings.HasPrefix(mode, IamEndpointModeRegional+":"):
+		region := strings.TrimSpace(mode[len(IamEndpointModeRegional)+1:])
+		if iamRegionPattern.MatchString(region) {
+			return "https://private." + region + ".iam.cloud.ibm.com", nil
+		}
+	}
+	return "", fmt.Errorf(ERRORMSG_IAM_ENDPOINT_MODE, mode)
+}
+
+// getIamURL returns the URL of the IAM token server used by "authenticator",
+// or "" if it doesn't obtain access tokens from IAM.
+func getIamURL(authenticator Authenticator) string {
+	var iamURL string
+	switch a := authenticator.(type) {
+	case *IamAuthenticator:
+		iamURL = a.tokenServerURL()
+	case *ContainerAuthenticator:
+		iamURL = a.URL
+	case *IamAssumeAuthenticator:
+		iamURL = a.URL
+	case *IamMtlsAuthenticator:
+		iamURL = a.URL
+	default:
+		return ""
+	}
+	if iamURL == "" {
+		iamURL = defaultIamTokenServerEndpoint
+	}
+	return iamURL
+}
+
+// checkIamEndpoint reports a warning if the service's URL and the IAM token server used by its
+// authenticator are in different environments. It is invoked when the service is constructed,
+// when its URL is set, and when a warning handler or subscriber is added (rather than for each request).
+func (service *BaseService) checkIamEndpoint() {
+	service.mutex.RLock()
+	serviceURL := service.Options.URL
+	authenticator := service.Options.Authenticator
+	warnings := service.warnings
+	service.mutex.RUnlock()
+
+	warnings.checkIamEndpoint(serviceURL, authenticator)
+}
+
+// checkIamEndpoint reports a warning if "serviceURL" and the IAM token server used by
+// "authenticator" are in different environments.
+func (notifier *warningNotifier) checkIamEndpoint(serviceURL string, authenticator Authenticator) {
+	if notifier == nil || serviceURL == "" || IsNil(authenticator) {
+		return
+	}
+	iamURL := getIamURL(authenticator)
+	if iamURL == "" {
+		return
+	}
+	if err := ValidateIamEndpoint(iamURL, serviceURL); err != nil {
+		notifier.emit(WarningIamEndpointMismatch, nil, "%s", err.Error())
+	}
+}
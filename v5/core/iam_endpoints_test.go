@@ -0,0 +1,222 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIamEnvironment(t *testing.T) {
+	assert.Equal(t, IamEnvironmentPublic, GetIamEnvironment("https://iam.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentPublic, GetIamEnvironment("https://IAM.cloud.ibm.com/identity/token"))
+	assert.Equal(t, IamEnvironmentPublic, GetIamEnvironment("iam.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentPublic, GetIamEnvironment("https://private.iam.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentPublic, GetIamEnvironment("https://private.us-south.iam.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentTest, GetIamEnvironment("https://iam.test.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentTest, GetIamEnvironment("https://private.iam.test.cloud.ibm.com"))
+	assert.Equal(t, "", GetIamEnvironment("https://iam.example.com"))
+	assert.Equal(t, "", GetIamEnvironment(""))
+
+	assert.Equal(t, IamEnvironmentPublic, GetServiceEnvironment("https://us-south.containers.cloud.ibm.com/v1"))
+	assert.Equal(t, IamEnvironmentPublic, GetServiceEnvironment("https://private.us-south.containers.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentPublic, GetServiceEnvironment("https://s3.direct.us-south.cloud.ibm.com"))
+	assert.Equal(t, IamEnvironmentTest, GetServiceEnvironment("https://resource-controller.test.cloud.ibm.com"))
+	assert.Equal(t, "", GetServiceEnvironment("https://localhost:8080"))
+}
+
+func TestValidateIamEndpoint(t *testing.T) {
+	assert.Nil(t, ValidateIamEndpoint("https://iam.cloud.ibm.com", "https://resource-controller.cloud.ibm.com"))
+	assert.Nil(t, ValidateIamEndpoint("https://private.iam.cloud.ibm.com", "https://private.resource-controller.cloud.ibm.com"))
+	assert.Nil(t, ValidateIamEndpoint("https://iam.test.cloud.ibm.com", "https://resource-controller.test.cloud.ibm.com"))
+
+	// The public and private endpoints are in the same environment.
+	assert.Nil(t, ValidateIamEndpoint("https://iam.cloud.ibm.com", "https://private.resource-controller.cloud.ibm.com"))
+	assert.Nil(t, ValidateIamEndpoint("https://private.us-south.iam.cloud.ibm.com", "https://s3.direct.us-south.cloud.ibm.com"))
+
+	// Unknown environments are not validated.
+	assert.Nil(t, ValidateIamEndpoint("https://iam.example.com", "https://resource-controller.test.cloud.ibm.com"))
+	assert.Nil(t, ValidateIamEndpoint("https://iam.test.cloud.ibm.com", "http://localhost:8080"))
+
+	err := ValidateIamEndpoint("https://iam.test.cloud.ibm.com", "https://resource-controller.cloud.ibm.com")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_IAM_ENDPOINT_MISMATCH, "https://iam.test.cloud.ibm.com", IamEnvironmentTest,
+		"https://resource-controller.cloud.ibm.com", IamEnvironmentPublic), err.Error())
+	err = ValidateIamEndpoint("https://private.iam.cloud.ibm.com", "https://private.resource-controller.test.cloud.ibm.com")
+	assert.NotNil(t, err)
+}
+
+func TestRegisterIamEndpoint(t *testing.T) {
+	saved := iamEndpoints
+	defer func() {
+		iamEndpoints = saved
+	}()
+
+	err := RegisterIamEndpoint(IamEndpoint{IamHosts: []string{"iam.example.com"}})
+	assert.NotNil(t, err)
+	err = RegisterIamEndpoint(IamEndpoint{Environment: IamEnvironmentSovereign})
+	assert.NotNil(t, err)
+	err = RegisterIamEndpoint(IamEndpoint{Environment: IamEnvironmentSovereign, IamHosts: []string{"[iam"}})
+	assert.NotNil(t, err)
+
+	err = RegisterIamEndpoint(IamEndpoint{
+		Environment:  IamEnvironmentSovereign,
+		IamHosts:     []string{"iam.sovereign.example.com"},
+		ServiceHosts: []string{"*.sovereign.example.com", "*.eu-sovereign.cloud.ibm.com"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, IamEnvironmentSovereign, GetIamEnvironment("https://iam.sovereign.example.com"))
+	assert.Equal(t, IamEnvironmentSovereign, GetServiceEnvironment("https://rc.eu-sovereign.cloud.ibm.com"))
+	assert.NotNil(t, ValidateIamEndpoint("https://iam.cloud.ibm.com", "https://rc.eu-sovereign.cloud.ibm.com"))
+	assert.Nil(t, ValidateIamEndpoint("https://iam.sovereign.example.com", "https://rc.sovereign.example.com"))
+}
+
+func TestCheckIamEndpoint(t *testing.T) {
+	var warnings []Warning
+	handler := func(warning Warning) {
+		warnings = append(warnings, warning)
+	}
+
+	// The warning is reported to a handler added after the service is constructed.
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           "https://resource-controller.cloud.ibm.com",
+		Authenticator: &IamAuthenticator{ApiKey: "apikey", URL: "https://iam.test.cloud.ibm.com"},
+	})
+	assert.Nil(t, err)
+	service.SetWarningHandler(handler)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, WarningIamEndpointMismatch, warnings[0].Kind)
+	assert.Contains(t, warnings[0].Message, "iam.test.cloud.ibm.com")
+
+	// The URL is checked when it is set, rather than for each request.
+	assert.Nil(t, service.SetServiceURL("https://resource-controller.test.cloud.ibm.com"))
+	assert.Len(t, warnings, 1)
+	assert.Nil(t, service.SetServiceURL("https://private.resource-controller.cloud.ibm.com"))
+	assert.Len(t, warnings, 2)
+
+	// The warning is reported to a new subscriber.
+	ch, cancel := service.Warnings(1)
+	defer cancel()
+	assert.Equal(t, WarningIamEndpointMismatch, (<-ch).Kind)
+	assert.Len(t, warnings, 3)
+
+	// The default IAM URL is public.
+	notifier := &warningNotifier{handler: handler}
+	notifier.checkIamEndpoint("https://resource-controller.cloud.ibm.com", &ContainerAuthenticator{IAMProfileName: "profile"})
+	assert.Len(t, warnings, 3)
+	notifier.checkIamEndpoint("https://resource-controller.test.cloud.ibm.com",
+		&IamAssumeAuthenticator{ApiKey: "apikey", TrustedProfileID: "profile"})
+	assert.Len(t, warnings, 4)
+
+	// Authenticators that don't use IAM aren't checked.
+	notifier.checkIamEndpoint("https://resource-controller.test.cloud.ibm.com", &NoAuthAuthenticator{})
+	assert.Len(t, warnings, 4)
+
+	// A nil notifier discards the warning.
+	var nilNotifier *warningNotifier
+	nilNotifier.checkIamEndpoint("https://resource-controller.test.cloud.ibm.com", &ContainerAuthenticator{IAMProfileName: "profile"})
+}
+
+func TestGetIamEndpointURL(t *testing.T) {
+	testCases := []struct {
+		mode string
+		url  string
+	}{
+		{"", "https://iam.cloud.ibm.com"},
+		{"public", "https://iam.cloud.ibm.com"},
+		{"private", "https://private.iam.cloud.ibm.com"},
+		{" Private ", "https://private.iam.cloud.ibm.com"},
+		{"regional:us-south", "https://private.us-south.iam.cloud.ibm.com"},
+		{"regional:eu-de", "https://private.eu-de.iam.cloud.ibm.com"},
+	}
+	for _, testCase := range testCases {
+		url, err := GetIamEndpointURL(testCase.mode)
+		assert.Nil(t, err, testCase.mode)
+		assert.Equal(t, testCase.url, url)
+		assert.NotEqual(t, "", GetIamEnvironment(url))
+	}
+
+	for _, mode := range []string{"global", "regional", "regional:", "regional:us south", "regional:evil.com/x", "regional:-us"} {
+		_, err := GetIamEndpointURL(mode)
+		assert.NotNil(t, err, mode)
+	}
+	_, err := GetIamEndpointURL("direct")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_IAM_ENDPOINT_MODE, "direct"), err.Error())
+}
+
+func TestIamAuthenticatorEndpointMode(t *testing.T) {
+	var requestURL string
+	client := &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requestURL = req.URL.String()
+			body := fmt.Sprintf(`{"access_token": "token", "expires_in": 3600, "expiration": %d}`, GetCurrentTime()+3600)
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+				Request:    req,
+			}, nil
+		}),
+	}
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey("my-apikey").
+		SetEndpointMode("regional:us-south").
+		SetClient(client).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "https://private.us-south.iam.cloud.ibm.com/identity/token", requestURL)
+	assert.Equal(t, "https://private.us-south.iam.cloud.ibm.com", getIamURL(authenticator))
+
+	// The mode selects the URL, so they can't both be specified.
+	_, err = NewIamAuthenticatorBuilder().
+		SetApiKey("my-apikey").
+		SetURL("https://iam.cloud.ibm.com").
+		SetEndpointMode("private").
+		Build()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_ATMOST_ONE_PROP_ERROR, "URL", "EndpointMode"), err.Error())
+
+	_, err = NewIamAuthenticatorBuilder().
+		SetApiKey("my-apikey").
+		SetEndpointMode("regional").
+		Build()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_IAM_ENDPOINT_MODE, "regional"), err.Error())
+
+	// The mode can be configured externally.
+	os.Setenv("ENDPOINT_MODE_SERVICE_AUTH_TYPE", "iam")
+	os.Setenv("ENDPOINT_MODE_SERVICE_APIKEY", "my-apikey")
+	os.Setenv("ENDPOINT_MODE_SERVICE_IAM_ENDPOINT_MODE", "private")
+	defer os.Unsetenv("ENDPOINT_MODE_SERVICE_AUTH_TYPE")
+	defer os.Unsetenv("ENDPOINT_MODE_SERVICE_APIKEY")
+	defer os.Unsetenv("ENDPOINT_MODE_SERVICE_IAM_ENDPOINT_MODE")
+	configured, err := GetAuthenticatorFromEnvironment("endpoint-mode-service")
+	assert.Nil(t, err)
+	iamAuthenticator, ok := configured.(*IamAuthenticator)
+	assert.True(t, ok)
+	assert.Equal(t, "private", iamAuthenticator.EndpointMode)
+	assert.Equal(t, "https://private.iam.cloud.ibm.com", getIamURL(iamAuthenticator))
+}
@@ -0,0 +1,227 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+const iamAuthOperationPathIntrospect = "/identity/introspect"
+
+// IamTokenIntrospection holds the result of introspecting an IAM access token.
+type IamTokenIntrospection struct {
+	// Active is true iff the token is valid (e.g. it is not expired or revoked).
+	Active bool `json:"active"`
+
+	// The expiration and issued-at times of the token, in seconds since the epoch.
+	ExpiresAt int64 `json:"exp,omitempty"`
+	IssuedAt  int64 `json:"iat,omitempty"`
+
+	// The scope(s) associated with the token.
+	Scope string `json:"scope,omitempty"`
+
+	// The subject (e.g. the user's email address or service id) and IAM id of the token's identity.
+	Subject string `json:"sub,omitempty"`
+	IamID   string `json:"iam_id,omitempty"`
+
+	// The id of the client that obtained the token.
+	ClientID string `json:"client_id,omitempty"`
+
+	// The account associated with the token.
+	Account *IamTokenAccount `json:"account,omitempty"`
+
+	// The complete introspection result, to provide access to any other properties.
+	Raw map[string]interface{} `json:"-"`
+}
+
+// IamTokenAccount describes the account associated with an introspected IAM access token.
+type IamTokenAccount struct {
+	// The id of the account.
+	Bss string `json:"bss,omitempty"`
+
+	// The IMS id associated with the account, if any.
+	Ims string `json:"ims,omitempty"`
+
+	// Valid is true iff the account is valid.
+	Valid bool `json:"valid"`
+}
+
+// IntrospectTokenOptions configures the invocation of the IAM token introspection operation by IntrospectToken().
+type IntrospectTokenOptions struct {
+	// The client id and secret used to authenticate with the IAM token server (required).
+	ClientId     string
+	ClientSecret string
+
+	// [Optional] The IAM token server's base endpoint URL.
+	// Default value: "https://iam.cloud.ibm.com"
+	URL string
+
+	// [Optional] A set of key/value pairs that will be sent as HTTP headers in the request.
+	Headers map[string]string
+
+	// [Optional] The http.Client object used to invoke the operation.
+	// If not specified, a client is constructed as for a service (see DefaultHTTPClient()).
+	Client *http.Client
+
+	// [Optional] A flag that indicates whether verification of the server's SSL certificate
+	// should be disabled (applies only if Client is not specified).
+	DisableSSLVerification bool
+
+	// [Optional] If MaxRetries is greater than 0, then a failed attempt is retried up to MaxRetries
+	// times, as with BaseService.EnableRetries(). If MaxRetryInterval is 0, a default value is used.
+	MaxRetries       int
+	MaxRetryInterval time.Duration
+}
+
+// IntrospectToken invokes the IAM token introspection operation to verify the specified
+// access token (e.g. a bearer token received from a client) and obtain its details, using
+// the client credentials and configuration in "opts".
+// An inactive (e.g. expired or revoked) token is not an error; instead, the Active
+// field of the result is false.
+func IntrospectToken(ctx context.Context, token string, opts *IntrospectTokenOptions) (*IamTokenIntrospection, error) {
+	if opts == nil || opts.ClientId == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientId")
+	}
+	if opts.ClientSecret == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientSecret")
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = DefaultHTTPClient()
+		if opts.DisableSSLVerification {
+			if tr, ok := client.Transport.(*http.Transport); tr != nil && ok {
+				if tr.TLSClientConfig == nil {
+					tr.TLSClientConfig = &tls.Config{} // #nosec G402
+				}
+				tr.TLSClientConfig.InsecureSkipVerify = true // #nosec G402
+			}
+		}
+	}
+	if opts.MaxRetries > 0 {
+		client = &http.Client{
+			Transport: newRetryableTransport(client, opts.MaxRetries, opts.MaxRetryInterval),
+		}
+	}
+
+	url := opts.URL
+	if url == "" {
+		url = defaultIamTokenServerEndpoint
+	} else {
+		url = strings.TrimSuffix(url, iamAuthOperationPathIntrospect)
+	}
+	return introspectIamToken(ctx, client, url, opts.ClientId, opts.ClientSecret, opts.Headers, token)
+}
+
+// IntrospectToken invokes the IAM token introspection operation to verify the specified
+// access token (e.g. a token received from a client) and obtain its details.
+// The token introspection operation requires the ClientId and ClientSecret properties.
+// An inactive (e.g. expired or revoked) token is not an error; instead, the Active
+// field of the result is false.
+func (authenticator *IamAuthenticator) IntrospectToken(ctx context.Context, token string) (*IamTokenIntrospection, error) {
+	credentials := authenticator.getCredentials()
+	if credentials.clientId == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientId")
+	}
+	if credentials.clientSecret == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientSecret")
+	}
+
+	authenticator.initClient()
+
+	return introspectIamToken(ctx, authenticator.Client, authenticator.tokenServerURL(),
+		credentials.clientId, credentials.clientSecret, authenticator.Headers, token)
+}
+
+// introspectIamToken invokes the IAM token introspection operation of the token server at "url"
+// with "client", to introspect "token".
+func introspectIamToken(ctx context.Context, client *http.Client, url string, clientId string, clientSecret string,
+	headers map[string]string, token string) (*IamTokenIntrospection, error) {
+	if token == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "token")
+	}
+
+	builder := NewRequestBuilder(POST)
+	if ctx != nil {
+		builder.WithContext(ctx)
+	}
+	_, err := builder.ResolveRequestURL(url, iamAuthOperationPathIntrospect, nil)
+	if err != nil {
+		return nil, err
+	}
+	builder.AddHeader(CONTENT_TYPE, FORM_URL_ENCODED_HEADER)
+	builder.AddHeader(Accept, APPLICATION_JSON)
+	builder.AddFormData("token", "", "", token)
+	for headerName, headerValue := range headers {
+		builder.AddHeader(headerName, headerValue)
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(clientId, clientSecret)
+
+	GetLogger().Debug("Invoking IAM 'introspect token' operation: %s", builder.URL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	GetLogger().Debug("Returned from IAM 'introspect token' operation, received status code %d", resp.StatusCode)
+
+	// If debug is enabled, then dump the response.
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		buf, dumpErr := httputil.DumpResponse(resp, true)
+		if dumpErr == nil {
+			GetLogger().Debug("Response:\n%s\n", RedactSecrets(string(buf)))
+		}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detailedResponse := &DetailedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+			RawResult:  body,
+		}
+		iamErrorMsg := string(body)
+		if iamErrorMsg == "" {
+			iamErrorMsg = fmt.Sprintf("unexpected status code %d received from IAM token server %s", resp.StatusCode, builder.URL)
+		}
+		return nil, NewAuthenticationError(detailedResponse, fmt.Errorf(iamErrorMsg))
+	}
+
+	result := &IamTokenIntrospection{}
+	if err = json.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_UNMARSHAL_AUTH_RESPONSE, err.Error())
+	}
+	if err = json.Unmarshal(body, &result.Raw); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_UNMARSHAL_AUTH_RESPONSE, err.Error())
+	}
+	return result, nil
+}
@@ -0,0 +1,476 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IamMtlsAuthenticator implements an IAM-based authentication schema whereby it presents
+// a client certificate (and its private key) to a dedicated IAM token server endpoint that
+// requires mutual TLS, and obtains an IAM access token by invoking the IAM "get token" operation
+// with grant-type=client_credentials (i.e. the identity is established by the certificate).
+// The resulting IAM access token is then added to outbound requests in an Authorization header
+// of the form:
+//
+//	Authorization: Bearer <access-token>
+type IamMtlsAuthenticator struct {
+
+	// [Required] The names of the PEM-encoded files containing the client certificate (optionally
+	// followed by its intermediate certificates) and its private key. The files are read each time
+	// that a connection is established with the token server, so a renewed certificate is used
+	// without reconfiguring the authenticator.
+	CertFile string
+	KeyFile  string
+
+	// [Required] The base endpoint URL of the IAM token server's mutual TLS endpoint.
+	URL string
+
+	// [optional] The client id sent to the IAM token server, if the certificate is
+	// registered for a specific client.
+	// Default value: ""
+	ClientID string
+
+	// [optional] A flag that indicates whether verification of the server's SSL certificate
+	// should be disabled.
+	// Default value: false
+	DisableSSLVerification bool
+
+	// [optional] The "scope" to use when fetching the access token from the IAM token server.
+	// This can be used to obtain an access token with a specific scope.
+	// Default value: ""
+	Scope string
+
+	// [optional] A set of key/value pairs that will be sent as HTTP headers in requests
+	// made to the IAM token server.
+	// Default value: nil
+	Headers map[string]string
+
+	// [optional] The http.Client object used in interacts with the IAM token server.
+	// If specified, then it must be configured to present the client certificate (CertFile and
+	// KeyFile are only used by the Client constructed by default).
+	Client *http.Client
+
+	// [optional] The options that control how access tokens are obtained, validated, cached and
+	// refreshed (see TokenManagementOptions).
+	TokenManagementOptions
+
+	// The cached IAM access token and its expiration time.
+	tokenData *iamTokenData
+
+	// Mutex to synchronize access to the tokenData field.
+	tokenDataMutex sync.Mutex
+
+	// Mutex to synchronize the construction of the default Client.
+	clientMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
+}
+
+const (
+	iamGrantTypeClientCredentials = "client_credentials" // #nosec G101
+)
+
+// IamMtlsAuthenticatorBuilder is used to construct an instance of the IamMtlsAuthenticator
+type IamMtlsAuthenticatorBuilder struct {
+	IamMtlsAuthenticator
+}
+
+// NewIamMtlsAuthenticatorBuilder returns a new builder struct that
+// can be used to construct an IamMtlsAuthenticator instance.
+func NewIamMtlsAuthenticatorBuilder() *IamMtlsAuthenticatorBuilder {
+	return &IamMtlsAuthenticatorBuilder{}
+}
+
+// SetCertFile sets the CertFile field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetCertFile(s string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.CertFile = s
+	return builder
+}
+
+// SetKeyFile sets the KeyFile field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetKeyFile(s string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.KeyFile = s
+	return builder
+}
+
+// SetURL sets the URL field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetURL(s string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.URL = s
+	return builder
+}
+
+// SetClientID sets the ClientID field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetClientID(s string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.ClientID = s
+	return builder
+}
+
+// SetDisableSSLVerification sets the DisableSSLVerification field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetDisableSSLVerification(b bool) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.DisableSSLVerification = b
+	return builder
+}
+
+// SetScope sets the Scope field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetScope(s string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.Scope = s
+	return builder
+}
+
+// SetHeaders sets the Headers field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetHeaders(headers map[string]string) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.Headers = headers
+	return builder
+}
+
+// SetClient sets the Client field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetClient(client *http.Client) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.Client = client
+	return builder
+}
+
+// SetTokenManagementOptions sets the TokenManagementOptions field in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) SetTokenManagementOptions(options TokenManagementOptions) *IamMtlsAuthenticatorBuilder {
+	builder.IamMtlsAuthenticator.TokenManagementOptions = options
+	return builder
+}
+
+// Build() returns a validated instance of the IamMtlsAuthenticator with the config that was set in the builder.
+func (builder *IamMtlsAuthenticatorBuilder) Build() (*IamMtlsAuthenticator, error) {
+
+	// Make sure the config is valid.
+	err := builder.IamMtlsAuthenticator.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &builder.IamMtlsAuthenticator, nil
+}
+
+// newIamMtlsAuthenticatorFromMap constructs a new IamMtlsAuthenticator instance from a map containing
+// configuration properties.
+func newIamMtlsAuthenticatorFromMap(properties map[string]string) (authenticator *IamMtlsAuthenticator, err error) {
+	if properties == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROPS_MAP_NIL)
+	}
+
+	// Grab the AUTH_DISABLE_SSL string property and convert to a boolean value.
+	disableSSL, err := strconv.ParseBool(properties[PROPNAME_AUTH_DISABLE_SSL])
+	if err != nil {
+		disableSSL = false
+	}
+
+	authenticator, err = NewIamMtlsAuthenticatorBuilder().
+		SetCertFile(properties[PROPNAME_CLIENT_CERT_FILE]).
+		SetKeyFile(properties[PROPNAME_CLIENT_KEY_FILE]).
+		SetURL(properties[PROPNAME_AUTH_URL]).
+		SetClientID(properties[PROPNAME_CLIENT_ID]).
+		SetDisableSSLVerification(disableSSL).
+		SetScope(properties[PROPNAME_SCOPE]).
+		Build()
+
+	return
+}
+
+// AuthenticationType returns the authentication type for this authenticator.
+func (*IamMtlsAuthenticator) AuthenticationType() string {
+	return AUTHTYPE_IAM_MTLS
+}
+
+// Authenticate adds IAM authentication information to the request.
+//
+// The IAM access token will be added to the request's headers in the form:
+//
+//	Authorization: Bearer <access-token>
+func (authenticator *IamMtlsAuthenticator) Authenticate(request *http.Request) error {
+	token, err := authenticator.GetTokenWithContext(request.Context())
+	if err != nil {
+		return err
+	}
+
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
+	return nil
+}
+
+// getTokenData returns the tokenData field from the authenticator with synchronization.
+func (authenticator *IamMtlsAuthenticator) getTokenData() *iamTokenData {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	return authenticator.tokenData
+}
+
+// setTokenData sets the 'tokenData' field in the authenticator with synchronization.
+func (authenticator *IamMtlsAuthenticator) setTokenData(tokenData *iamTokenData) {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	authenticator.tokenData = tokenData
+}
+
+// InvalidateToken discards the cached access token (if any), so that a new
+// access token is fetched the next time that the authenticator is used.
+func (authenticator *IamMtlsAuthenticator) InvalidateToken() {
+	authenticator.setTokenData(nil)
+	deleteCachedIamToken(authenticator.TokenCache, authenticator.tokenCacheKey())
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *IamMtlsAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
+// Validate the authenticator's configuration.
+//
+// Ensures that the URL is specified, and that the CertFile and KeyFile are specified
+// (unless a Client was specified).
+func (authenticator *IamMtlsAuthenticator) Validate() error {
+	if authenticator.URL == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "URL")
+	}
+	if HasBadFirstOrLastChar(authenticator.URL) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "URL")
+	}
+
+	// The certificate and key are presented by the default Client.
+	if authenticator.Client == nil {
+		if authenticator.CertFile == "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "CertFile")
+		}
+		if authenticator.KeyFile == "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "KeyFile")
+		}
+	}
+
+	return nil
+}
+
+// GetToken returns an access token to be used in an Authorization header.
+// Whenever a new token is needed (when a token doesn't yet exist or the existing token has expired),
+// a new access token is fetched from the token server.
+func (authenticator *IamMtlsAuthenticator) GetToken() (string, error) {
+	return authenticator.GetTokenWithContext(context.Background())
+}
+
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *IamMtlsAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
+}
+
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *IamMtlsAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
+
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *IamMtlsAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
+}
+
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+func (authenticator *IamMtlsAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_IAM_MTLS,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
+	}
+}
+
+// fetchTokenData requests a new token from the IAM token server (unless the TokenCache holds
+// a token that can still be used) and stores it in the authenticator's 'tokenData' field (cache).
+func (authenticator *IamMtlsAuthenticator) fetchTokenData(ctx context.Context) error {
+	tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKey(), authenticator.requestToken)
+	if err != nil {
+		return err
+	}
+
+	authenticator.setTokenData(tokenData)
+	store()
+	return nil
+}
+
+// tokenCacheKey returns the key under which the authenticator's tokens are cached, or ""
+// if there is no TokenCache. The key is derived from the token server URL, the certificate file,
+// the client id and the scope.
+func (authenticator *IamMtlsAuthenticator) tokenCacheKey() string {
+	return newTokenCacheKey(authenticator.TokenCache, AUTHTYPE_IAM_MTLS, authenticator.URL, authenticator.CertFile,
+		authenticator.ClientID, authenticator.Scope)
+}
+
+// RequestToken presents the client certificate to the IAM token server's mutual TLS endpoint
+// to obtain a new IAM access token.
+func (authenticator *IamMtlsAuthenticator) RequestToken() (*IamTokenServerResponse, error) {
+	return authenticator.requestToken(context.Background())
+}
+
+// requestToken is like RequestToken(), but the token request is abandoned if "ctx" is done.
+func (authenticator *IamMtlsAuthenticator) requestToken(ctx context.Context) (*IamTokenServerResponse, error) {
+	var err error
+	var operationPath string = "/identity/token"
+
+	// Canonicalize the URL by removing the operation path if it was specified by the user.
+	url := strings.TrimSuffix(authenticator.URL, operationPath)
+
+	// Set up the request for the IAM "get token" invocation.
+	builder := NewRequestBuilder(POST).WithContext(ctx)
+	_, err = builder.ResolveRequestURL(url, operationPath, nil)
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	builder.AddHeader(CONTENT_TYPE, FORM_URL_ENCODED_HEADER)
+	builder.AddHeader(Accept, APPLICATION_JSON)
+	builder.AddFormData("grant_type", "", "", iamGrantTypeClientCredentials) // #nosec G101
+
+	// If the client id was specified, add that form param to the request.
+	if authenticator.ClientID != "" {
+		builder.AddFormData("client_id", "", "", authenticator.ClientID)
+	}
+
+	// If the scope was specified, add that form param to the request.
+	if authenticator.Scope != "" {
+		builder.AddFormData("scope", "", "", authenticator.Scope)
+	}
+
+	// Add user-defined headers to request.
+	for headerName, headerValue := range authenticator.Headers {
+		builder.AddHeader(headerName, headerValue)
+	}
+
+	req, err := builder.Build()
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	// If the authenticator does not have a Client, create one now.
+	client := authenticator.initClient()
+
+	// If debug is enabled, then dump the request.
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		buf, dumpErr := httputil.DumpRequestOut(req, req.Body != nil)
+		if dumpErr == nil {
+			GetLogger().Debug("Request:\n%s\n", RedactSecrets(string(buf)))
+		} else {
+			GetLogger().Debug(fmt.Sprintf("error while attempting to log outbound request: %s", dumpErr.Error()))
+		}
+	}
+
+	GetLogger().Debug("Invoking IAM 'get token' operation: %s", builder.URL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, NewAuthenticationError(&DetailedResponse{}, err)
+	}
+
+	GetLogger().Debug("Returned from IAM 'get token' operation, received status code %d", resp.StatusCode)
+
+	// If debug is enabled, then dump the response.
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		buf, dumpErr := httputil.DumpResponse(resp, req.Body != nil)
+		if dumpErr == nil {
+			GetLogger().Debug("Response:\n%s\n", RedactSecrets(string(buf)))
+		} else {
+			GetLogger().Debug(fmt.Sprintf("error while attempting to log inbound response: %s", dumpErr.Error()))
+		}
+	}
+
+	// Check for a bad status code and handle an operation error.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		buff := new(bytes.Buffer)
+		_, _ = buff.ReadFrom(resp.Body)
+		resp.Body.Close() // #nosec G104
+
+		// Create a DetailedResponse to be included in the error below.
+		detailedResponse := &DetailedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    resp.Header,
+			RawResult:  buff.Bytes(),
+		}
+
+		iamErrorMsg := string(detailedResponse.RawResult)
+		if iamErrorMsg == "" {
+			iamErrorMsg = "IAM error response not available"
+		}
+		err = fmt.Errorf(ERRORMSG_IAM_GETTOKEN_ERROR, detailedResponse.StatusCode, builder.URL, iamErrorMsg)
+		return nil, NewAuthenticationError(detailedResponse, err)
+	}
+
+	// Good response, so unmarshal the response body into an IamTokenServerResponse instance.
+	tokenResponse := &IamTokenServerResponse{clockSkew: measureClockSkew(resp.Header)}
+	_ = json.NewDecoder(resp.Body).Decode(tokenResponse)
+	defer resp.Body.Close()
+
+	return tokenResponse, nil
+}
+
+// initClient returns the Client used to invoke the IAM token server, creating a Client
+// that presents the client certificate if one wasn't specified by the user.
+func (authenticator *IamMtlsAuthenticator) initClient() *http.Client {
+	authenticator.clientMutex.Lock()
+	defer authenticator.clientMutex.Unlock()
+
+	if authenticator.Client == nil {
+		tlsConfig := &tls.Config{
+			MinVersion:           tls.VersionTLS12,
+			GetClientCertificate: authenticator.loadClientCertificate,
+		}
+		// If the user told us to disable SSL verification, then do it now.
+		if authenticator.DisableSSLVerification {
+			tlsConfig.InsecureSkipVerify = true // #nosec G402
+		}
+		authenticator.Client = &http.Client{
+			Timeout:   time.Second * 30,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}
+	}
+	return authenticator.Client
+}
+
+// loadClientCertificate reads the client certificate and private key from the CertFile and KeyFile.
+func (authenticator *IamMtlsAuthenticator) loadClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	GetLogger().Debug("Attempting to read the client certificate from file: %s\n", authenticator.CertFile)
+
+	certificate, err := tls.LoadX509KeyPair(authenticator.CertFile, authenticator.KeyFile)
+	if err != nil {
+		err = fmt.Errorf(ERRORMSG_UNABLE_LOAD_CLIENT_CERT, err.Error())
+		GetLogger().Debug(err.Error())
+		return nil, err
+	}
+	return &certificate, nil
+}
@@ -0,0 +1,211 @@
+// +build all auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+// newMtlsTestCertificate returns a new self-signed client certificate with the common name "cn",
+// and writes it (and its private key) to the PEM-encoded files "certFile" and "keyFile".
+func newMtlsTestCertificate(t *testing.T, cn string, certFile string, keyFile string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certificate
+}
+
+// newMtlsTestServer returns a token server that requires a client certificate issued by one of
+// "clientCAs", and responds with an access token. "subjects" receives the common name of the client
+// certificate presented with each token request, and "forms" receives its form parameters.
+func newMtlsTestServer(clientCAs *x509.CertPool) (server *httptest.Server, subjects chan string, forms chan map[string]string) {
+	subjects = make(chan string, 10)
+	forms = make(chan map[string]string, 10)
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subjects <- r.TLS.PeerCertificates[0].Subject.CommonName
+		_ = r.ParseForm()
+		forms <- map[string]string{
+			"grant_type": r.PostForm.Get("grant_type"),
+			"client_id":  r.PostForm.Get("client_id"),
+			"scope":      r.PostForm.Get("scope"),
+		}
+		w.WriteHeader(http.StatusOK)
+		expiration := GetCurrentTime() + 3600
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, expiration)
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	return
+}
+
+func TestIamMtlsAuthenticatorValidate(t *testing.T) {
+	authenticator, err := NewIamMtlsAuthenticatorBuilder().
+		SetCertFile("client.crt").
+		SetKeyFile("client.key").
+		Build()
+	assert.NotNil(t, err)
+	assert.Nil(t, authenticator)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "URL"), err.Error())
+
+	_, err = NewIamMtlsAuthenticatorBuilder().
+		SetURL("https://mtls.iam.example.com").
+		SetKeyFile("client.key").
+		Build()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "CertFile"), err.Error())
+
+	_, err = NewIamMtlsAuthenticatorBuilder().
+		SetURL("https://mtls.iam.example.com").
+		SetCertFile("client.crt").
+		Build()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "KeyFile"), err.Error())
+
+	// The files aren't needed if the Client presents the certificate.
+	authenticator, err = NewIamMtlsAuthenticatorBuilder().
+		SetURL("https://mtls.iam.example.com").
+		SetClient(&http.Client{}).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, AUTHTYPE_IAM_MTLS, authenticator.AuthenticationType())
+	assert.Equal(t, "https://mtls.iam.example.com", getIamURL(authenticator))
+}
+
+func TestIamMtlsAuthenticatorGetToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	dir, err := ioutil.TempDir("", "mtls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(newMtlsTestCertificate(t, "service-id-1", certFile, keyFile))
+	server, subjects, forms := newMtlsTestServer(clientCAs)
+	defer server.Close()
+
+	authenticator, err := NewIamMtlsAuthenticatorBuilder().
+		SetCertFile(certFile).
+		SetKeyFile(keyFile).
+		SetURL(server.URL).
+		SetClientID("client-1").
+		SetScope("scope1").
+		SetDisableSSLVerification(true).
+		Build()
+	assert.Nil(t, err)
+
+	// The token is obtained with the client certificate, and then cached.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, "service-id-1", <-subjects)
+	assert.Equal(t, map[string]string{"grant_type": "client_credentials", "client_id": "client-1", "scope": "scope1"}, <-forms)
+
+	request, err := http.NewRequest(GET, "https://myservice.cloud.ibm.com", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer "+iamAuthTestAccessToken1, request.Header.Get("Authorization"))
+	assert.Len(t, subjects, 0)
+
+	// A renewed certificate is used for a new connection.
+	clientCAs.AddCert(newMtlsTestCertificate(t, "service-id-2", certFile, keyFile))
+	authenticator.Client.CloseIdleConnections()
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "service-id-2", <-subjects)
+	<-forms
+}
+
+func TestIamMtlsAuthenticatorCertificateErrors(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	dir, err := ioutil.TempDir("", "mtls")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	// A certificate that wasn't issued by one of the server's CAs is rejected.
+	newMtlsTestCertificate(t, "service-id-1", certFile, keyFile)
+	server, _, _ := newMtlsTestServer(x509.NewCertPool())
+	defer server.Close()
+
+	authenticator, err := NewIamMtlsAuthenticatorBuilder().
+		SetCertFile(certFile).
+		SetKeyFile(keyFile).
+		SetURL(server.URL).
+		SetDisableSSLVerification(true).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	_, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+
+	// A missing key file is reported.
+	authenticator, err = NewIamMtlsAuthenticatorBuilder().
+		SetCertFile(certFile).
+		SetKeyFile(filepath.Join(dir, "missing.key")).
+		SetURL(server.URL).
+		SetDisableSSLVerification(true).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unable to load the client certificate")
+}
@@ -0,0 +1,262 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The version of the format of an exported IAM session.
+const iamSessionVersion = 1
+
+// iamSession is the (encrypted) content of an exported IAM session.
+type iamSession struct {
+	Version      int    `json:"version"`
+	URL          string `json:"url,omitempty"`
+	EndpointMode string `json:"endpoint_mode,omitempty"`
+	ClientId     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Scope        string `json:"scope,omitempty"`
+	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	Expiration   int64  `json:"expiration,omitempty"`
+	RefreshTime  int64  `json:"refresh_time,omitempty"`
+}
+
+// ExportSession returns the authenticator's session (its refresh token, along with the current access token,
+// client id and secret, IAM URL or endpoint mode, and scope), encrypted with AES-GCM using "key" (16, 24
+// or 32 bytes), so that a program such as a CLI can store the session and later resume it with
+// NewIamAuthenticatorFromSession(), without storing an apikey. An access token is fetched first, if necessary.
+// The ClientId and ClientSecret properties are required, because the refresh token can only be used by the
+// client that obtained it.
+// Note that the refresh token changes each time that a new access token is obtained (see PersistSession()).
+func (authenticator *IamAuthenticator) ExportSession(key []byte) ([]byte, error) {
+	if _, err := authenticator.GetToken(); err != nil {
+		return nil, err
+	}
+	return authenticator.exportSession(key)
+}
+
+// exportSession is like ExportSession(), but uses the current token data (without fetching an access token).
+func (authenticator *IamAuthenticator) exportSession(key []byte) ([]byte, error) {
+	credentials := authenticator.getCredentials()
+	if credentials.clientId == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientId")
+	}
+	if credentials.clientSecret == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "ClientSecret")
+	}
+
+	session := &iamSession{
+		Version:      iamSessionVersion,
+		URL:          authenticator.URL,
+		EndpointMode: authenticator.EndpointMode,
+		ClientId:     credentials.clientId,
+		ClientSecret: credentials.clientSecret,
+		Scope:        authenticator.Scope,
+		RefreshToken: credentials.refreshToken,
+	}
+	if tokenData := authenticator.getTokenData(); tokenData != nil {
+		session.RefreshToken = tokenData.RefreshToken
+		session.AccessToken = tokenData.AccessToken
+		session.Expiration = tokenData.Expiration
+		session.RefreshTime = tokenData.RefreshTime
+	}
+	if session.RefreshToken == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "RefreshToken")
+	}
+
+	plaintext, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newIamSessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// NewIamAuthenticatorFromSession returns an IamAuthenticator that resumes the session exported by
+// ExportSession() with the same "key". The authenticator uses the session's access token (while it
+// remains valid), and then its refresh token, to authenticate requests. Other properties (e.g. Client or
+// TokenCache) may be set before the authenticator is used.
+func NewIamAuthenticatorFromSession(session []byte, key []byte) (*IamAuthenticator, error) {
+	aead, err := newIamSessionCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(session) < aead.NonceSize() {
+		return nil, fmt.Errorf(ERRORMSG_IAM_SESSION_INVALID, "the session is truncated")
+	}
+	nonce, ciphertext := session[:aead.NonceSize()], session[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_IAM_SESSION_INVALID, "the session can't be decrypted with the key")
+	}
+
+	decoded := &iamSession{}
+	if err = json.Unmarshal(plaintext, decoded); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_IAM_SESSION_INVALID, err.Error())
+	}
+	if decoded.Version != iamSessionVersion {
+		return nil, fmt.Errorf(ERRORMSG_IAM_SESSION_INVALID, fmt.Sprintf("unsupported version %d", decoded.Version))
+	}
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetRefreshToken(decoded.RefreshToken).
+		SetClientIDSecret(decoded.ClientId, decoded.ClientSecret).
+		SetURL(decoded.URL).
+		SetEndpointMode(decoded.EndpointMode).
+		SetScope(decoded.Scope).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if decoded.AccessToken != "" {
+		authenticator.setTokenData(&iamTokenData{
+			AccessToken:  decoded.AccessToken,
+			RefreshToken: decoded.RefreshToken,
+			Expiration:   decoded.Expiration,
+			RefreshTime:  decoded.RefreshTime,
+		})
+	}
+	return authenticator, nil
+}
+
+// newIamSessionCipher returns the AES-GCM cipher used to encrypt IAM sessions with "key".
+func newIamSessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_INVALID, "key")
+	}
+	return cipher.NewGCM(block)
+}
+
+// IamSessionStore stores an exported IAM session (see ExportSession()), e.g. in a file or in the
+// operating system's keychain. The methods must be safe for concurrent use.
+type IamSessionStore interface {
+	// Load returns the stored session, or nil if there is none.
+	Load() ([]byte, error)
+
+	// Save stores "session", replacing any stored session.
+	Save(session []byte) error
+
+	// Delete removes the stored session (if any), e.g. when the user logs out.
+	Delete() error
+}
+
+// PersistSession saves the authenticator's session in "store" (encrypted with "key") each time that
+// a new access token is obtained, so that the stored session always contains the current refresh token.
+// An error that occurs while saving the session is logged.
+func (authenticator *IamAuthenticator) PersistSession(store IamSessionStore, key []byte) {
+	authenticator.OnTokenRefresh(func(info TokenInfo) {
+		if info.Err != nil {
+			return
+		}
+		session, err := authenticator.exportSession(key)
+		if err == nil {
+			err = store.Save(session)
+		}
+		if err != nil {
+			GetLogger().Warn("Unable to save the IAM session: %s", err.Error())
+		}
+	})
+}
+
+// ResumeIamSession returns an IamAuthenticator that resumes the session stored in "store" (see
+// NewIamAuthenticatorFromSession()), and that saves its session in "store" as it changes (see PersistSession()).
+// It returns nil (and no error) if no session is stored.
+func ResumeIamSession(store IamSessionStore, key []byte) (*IamAuthenticator, error) {
+	session, err := store.Load()
+	if err != nil || session == nil {
+		return nil, err
+	}
+	authenticator, err := NewIamAuthenticatorFromSession(session, key)
+	if err != nil {
+		return nil, err
+	}
+	authenticator.PersistSession(store, key)
+	return authenticator, nil
+}
+
+// fileSessionStore is an IamSessionStore that stores the session in a file.
+type fileSessionStore struct {
+	path string
+}
+
+// NewFileSessionStore returns an IamSessionStore that stores the session in the specified file
+// (created if necessary, along with its directory), which is readable and writable only by its owner.
+// The file is replaced atomically, so a concurrent process never reads a partially-written session.
+func NewFileSessionStore(path string) (IamSessionStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	return &fileSessionStore{
+		path: path,
+	}, nil
+}
+
+func (store *fileSessionStore) Load() ([]byte, error) {
+	session, err := ioutil.ReadFile(store.path) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return session, err
+}
+
+func (store *fileSessionStore) Save(session []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // #nosec G104
+
+	if _, err = file.Write(session); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), store.path)
+}
+
+func (store *fileSessionStore) Delete() error {
+	err := os.Remove(store.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+// +build all auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	assert "github.com/stretchr/testify/assert"
+)
+
+var iamSessionTestKey = []byte("0123456789abcdef0123456789abcdef")
+
+// startIamSessionTestServer returns a token server that issues a new refresh token with each access token.
+func startIamSessionTestServer(t *testing.T) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		err := r.ParseForm()
+		assert.Nil(t, err)
+		clientID, clientSecret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "cli-client", clientID)
+		assert.Equal(t, "cli-secret", clientSecret)
+		if r.FormValue("grant_type") == iamAuthGrantTypeRefreshToken {
+			assert.Equal(t, fmt.Sprintf("refresh-token-%d", n-1), r.FormValue("refresh_token"))
+		} else {
+			assert.Equal(t, iamAuthGrantTypeApiKey, r.FormValue("grant_type"))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "refresh-token-%d"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600, n)
+	}))
+	return server, &requests
+}
+
+func TestIamExportSession(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+	server, requests := startIamSessionTestServer(t)
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetClientIDSecret("cli-client", "cli-secret").
+		SetURL(server.URL).
+		SetScope("scope1").
+		Build()
+	assert.Nil(t, err)
+	session, err := authenticator.ExportSession(iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	assert.NotContains(t, string(session), "refresh-token-1")
+
+	// The restored authenticator uses the session's access token, and then its refresh token.
+	restored, err := NewIamAuthenticatorFromSession(session, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "", restored.ApiKey)
+	assert.Equal(t, "refresh-token-1", restored.RefreshToken)
+	assert.Equal(t, server.URL, restored.URL)
+	assert.Equal(t, "scope1", restored.Scope)
+	token, err := restored.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	restored.InvalidateToken()
+	_, err = restored.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+	assert.Equal(t, "refresh-token-2", restored.RefreshToken)
+
+	// The session can't be restored with another key, or if it was altered.
+	_, err = NewIamAuthenticatorFromSession(session, []byte("fedcba9876543210fedcba9876543210"))
+	assert.NotNil(t, err)
+	altered := append([]byte{}, session...)
+	altered[len(altered)-1] ^= 1
+	_, err = NewIamAuthenticatorFromSession(altered, iamSessionTestKey)
+	assert.NotNil(t, err)
+	_, err = NewIamAuthenticatorFromSession(session[:4], iamSessionTestKey)
+	assert.NotNil(t, err)
+	_, err = NewIamAuthenticatorFromSession(session, []byte("short"))
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_INVALID, "key"), err.Error())
+
+	// A session can't be exported without a client id and secret.
+	authenticator, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	_, err = authenticator.exportSession(iamSessionTestKey)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "ClientId"), err.Error())
+}
+
+func TestIamExportSessionEndpointMode(t *testing.T) {
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetRefreshToken("refresh-token-1").
+		SetClientIDSecret("cli-client", "cli-secret").
+		SetEndpointMode("regional:us-south").
+		Build()
+	assert.Nil(t, err)
+	session, err := authenticator.exportSession(iamSessionTestKey)
+	assert.Nil(t, err)
+
+	// The restored authenticator uses the endpoint selected by the same mode.
+	restored, err := NewIamAuthenticatorFromSession(session, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "", restored.URL)
+	assert.Equal(t, "regional:us-south", restored.EndpointMode)
+	assert.Equal(t, "https://private.us-south.iam.cloud.ibm.com", restored.tokenServerURL())
+}
+
+func TestIamResumeSession(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+	server, requests := startIamSessionTestServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "iam-session")
+	assert.Nil(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "sessions", "session")
+	store, err := NewFileSessionStore(path)
+	assert.Nil(t, err)
+
+	// No session is stored yet.
+	authenticator, err := ResumeIamSession(store, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator)
+
+	// Log in, and save the session after each refresh.
+	authenticator, err = NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetClientIDSecret("cli-client", "cli-secret").
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	authenticator.PersistSession(store, iamSessionTestKey)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	if info != nil && os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// A later invocation resumes the session, and saves the rotated refresh token.
+	resumed, err := ResumeIamSession(store, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.NotNil(t, resumed)
+	resumed.InvalidateToken()
+	_, err = resumed.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	resumed, err = ResumeIamSession(store, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "refresh-token-2", resumed.RefreshToken)
+
+	// Log out.
+	assert.Nil(t, store.Delete())
+	assert.Nil(t, store.Delete())
+	resumed, err = ResumeIamSession(store, iamSessionTestKey)
+	assert.Nil(t, err)
+	assert.Nil(t, resumed)
+
+	_, err = NewFileSessionStore("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,194 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// IamTokenMetadata describes the IAM access token currently used by an authenticator,
+// without exposing the token itself.
+type IamTokenMetadata struct {
+	// The times at which the token was issued and expires.
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// The time after which the authenticator will fetch a new token.
+	RefreshAt time.Time
+
+	// The scope(s) associated with the token.
+	Scope string
+
+	// The IAM id and subject (e.g. the user's email address or service id) of the token's identity.
+	IamID   string
+	Subject string
+
+	// The id of the client that obtained the token.
+	ClientID string
+
+	// The account associated with the token, if any.
+	Account *IamTokenAccount
+}
+
+// iamTokenClaims are the claims of an IAM access token that are described by IamTokenMetadata.
+type iamTokenClaims struct {
+	ExpiresAt int64            `json:"exp,omitempty"`
+	IssuedAt  int64            `json:"iat,omitempty"`
+	Scope     string           `json:"scope,omitempty"`
+	IamID     string           `json:"iam_id,omitempty"`
+	Subject   string           `json:"sub,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	Account   *IamTokenAccount `json:"account,omitempty"`
+}
+
+// IamTokenClaims are the claims of an IAM access token, decoded (but not verified) from the token.
+type IamTokenClaims struct {
+	// The id of the account associated with the token, if any.
+	AccountID string
+
+	// The IAM id and subject (e.g. the user's email address or service id) of the token's identity.
+	IamID   string
+	Subject string
+
+	// The id of the client that obtained the token.
+	ClientID string
+
+	// The scopes associated with the token.
+	Scopes []string
+
+	// The times at which the token was issued and expires (according to the token server's clock).
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// GetTokenMetadata returns the metadata of the current access token (fetching a new
+// token from the token server, if necessary).
+func (authenticator *IamAuthenticator) GetTokenMetadata() (*IamTokenMetadata, error) {
+	if _, err := authenticator.GetToken(); err != nil {
+		return nil, err
+	}
+	return newIamTokenMetadata(authenticator.getTokenData())
+}
+
+// GetTokenMetadata returns the metadata of the current access token (fetching a new
+// token from the token server, if necessary).
+func (authenticator *ContainerAuthenticator) GetTokenMetadata() (*IamTokenMetadata, error) {
+	if _, err := authenticator.GetToken(); err != nil {
+		return nil, err
+	}
+	return newIamTokenMetadata(authenticator.getTokenData())
+}
+
+// GetTokenMetadata returns the metadata of the current access token (fetching a new
+// token from the token server, if necessary).
+func (authenticator *VpcInstanceAuthenticator) GetTokenMetadata() (*IamTokenMetadata, error) {
+	if _, err := authenticator.GetToken(); err != nil {
+		return nil, err
+	}
+	return newIamTokenMetadata(authenticator.getTokenData())
+}
+
+// GetTokenMetadata returns the metadata of the current access token (fetching a new
+// token from the token server, if necessary).
+func (authenticator *IamMtlsAuthenticator) GetTokenMetadata() (*IamTokenMetadata, error) {
+	if _, err := authenticator.GetToken(); err != nil {
+		return nil, err
+	}
+	return newIamTokenMetadata(authenticator.getTokenData())
+}
+
+// GetTokenClaims returns the claims of the cached access token, without contacting the token server.
+// An error is returned if no access token is cached (e.g. before the first request is authenticated).
+func (authenticator *IamAuthenticator) GetTokenClaims() (*IamTokenClaims, error) {
+	return newIamTokenClaims(authenticator.getTokenData())
+}
+
+// GetTokenClaims returns the claims of the cached access token, without contacting the token server.
+// An error is returned if no access token is cached (e.g. before the first request is authenticated).
+func (authenticator *ContainerAuthenticator) GetTokenClaims() (*IamTokenClaims, error) {
+	return newIamTokenClaims(authenticator.getTokenData())
+}
+
+// GetTokenClaims returns the claims of the cached access token, without contacting the token server.
+// An error is returned if no access token is cached (e.g. before the first request is authenticated).
+func (authenticator *VpcInstanceAuthenticator) GetTokenClaims() (*IamTokenClaims, error) {
+	return newIamTokenClaims(authenticator.getTokenData())
+}
+
+// GetTokenClaims returns the claims of the cached access token, without contacting the token server.
+// An error is returned if no access token is cached (e.g. before the first request is authenticated).
+func (authenticator *IamMtlsAuthenticator) GetTokenClaims() (*IamTokenClaims, error) {
+	return newIamTokenClaims(authenticator.getTokenData())
+}
+
+// newIamTokenMetadata returns the metadata of the access token in "tokenData".
+// The expiration and refresh times are those used by the authenticator (converted
+// to the local clock, if clock skew was detected when the token was obtained),
+// while the other fields are obtained from the token's claims.
+func newIamTokenMetadata(tokenData *iamTokenData) (*IamTokenMetadata, error) {
+	if tokenData == nil {
+		return nil, fmt.Errorf(ERRORMSG_TOKEN_CLAIMS_INVALID, "no access token")
+	}
+
+	claims := &iamTokenClaims{}
+	if err := decodeJWTClaims(tokenData.AccessToken, claims); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_TOKEN_CLAIMS_INVALID, err.Error())
+	}
+
+	metadata := &IamTokenMetadata{
+		ExpiresAt: time.Unix(tokenData.Expiration, 0),
+		RefreshAt: time.Unix(tokenData.RefreshTime, 0),
+		Scope:     claims.Scope,
+		IamID:     claims.IamID,
+		Subject:   claims.Subject,
+		ClientID:  claims.ClientID,
+		Account:   claims.Account,
+	}
+	if claims.IssuedAt > 0 {
+		metadata.IssuedAt = time.Unix(toLocalTime(claims.IssuedAt, tokenData.ClockSkew), 0)
+	}
+	return metadata, nil
+}
+
+// newIamTokenClaims returns the claims of the access token in "tokenData".
+func newIamTokenClaims(tokenData *iamTokenData) (*IamTokenClaims, error) {
+	if tokenData == nil {
+		return nil, fmt.Errorf(ERRORMSG_TOKEN_CLAIMS_INVALID, "no access token")
+	}
+
+	claims := &iamTokenClaims{}
+	if err := decodeJWTClaims(tokenData.AccessToken, claims); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_TOKEN_CLAIMS_INVALID, err.Error())
+	}
+
+	tokenClaims := &IamTokenClaims{
+		IamID:    claims.IamID,
+		Subject:  claims.Subject,
+		ClientID: claims.ClientID,
+		Scopes:   strings.Fields(claims.Scope),
+	}
+	if claims.Account != nil {
+		tokenClaims.AccountID = claims.Account.Bss
+	}
+	if claims.IssuedAt > 0 {
+		tokenClaims.IssuedAt = time.Unix(claims.IssuedAt, 0)
+	}
+	if claims.ExpiresAt > 0 {
+		tokenClaims.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
+	return tokenClaims, nil
+}
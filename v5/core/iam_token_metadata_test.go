@@ -0,0 +1,123 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIamGetTokenMetadata(t *testing.T) {
+	issuedAt := GetCurrentTime()
+	claims := fmt.Sprintf(`{"iam_id": "iam-ServiceId-123", "sub": "ServiceId-123", "client_id": "default",
+		"scope": "ibm openid", "iat": %d, "exp": %d, "account": {"bss": "acct-1", "valid": true}}`, issuedAt, issuedAt+3600)
+	accessToken := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			accessToken, issuedAt+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+
+	// The metadata of the current token is returned, fetching the token if necessary.
+	metadata, err := authenticator.GetTokenMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, &IamTokenMetadata{
+		IssuedAt:  time.Unix(issuedAt, 0),
+		ExpiresAt: time.Unix(issuedAt+3600, 0),
+		RefreshAt: time.Unix(issuedAt+3600-720, 0),
+		Scope:     "ibm openid",
+		IamID:     "iam-ServiceId-123",
+		Subject:   "ServiceId-123",
+		ClientID:  "default",
+		Account:   &IamTokenAccount{Bss: "acct-1", Valid: true},
+	}, metadata)
+	_, err = authenticator.GetTokenMetadata()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+
+	// A token that isn't a JWT has no metadata.
+	accessToken = "opaque"
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetTokenMetadata()
+	assert.NotNil(t, err)
+
+	// A failure to fetch the token is returned.
+	server.Close()
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetTokenMetadata()
+	assert.NotNil(t, err)
+}
+
+func TestIamGetTokenClaims(t *testing.T) {
+	issuedAt := GetCurrentTime()
+	claims := fmt.Sprintf(`{"iam_id": "iam-ServiceId-123", "sub": "ServiceId-123", "client_id": "default",
+		"scope": "ibm openid", "iat": %d, "exp": %d, "account": {"bss": "acct-1", "valid": true}}`, issuedAt, issuedAt+3600)
+	accessToken := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			accessToken, issuedAt+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+
+	// The claims of the cached token are returned, without fetching a token.
+	_, err = authenticator.GetTokenClaims()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, requests)
+
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	tokenClaims, err := authenticator.GetTokenClaims()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, &IamTokenClaims{
+		AccountID: "acct-1",
+		IamID:     "iam-ServiceId-123",
+		Subject:   "ServiceId-123",
+		ClientID:  "default",
+		Scopes:    []string{"ibm", "openid"},
+		IssuedAt:  time.Unix(issuedAt, 0),
+		ExpiresAt: time.Unix(issuedAt+3600, 0),
+	}, tokenClaims)
+
+	// A token that isn't a JWT has no claims.
+	accessToken = "opaque"
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	_, err = authenticator.GetTokenClaims()
+	assert.NotNil(t, err)
+}
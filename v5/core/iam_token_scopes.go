@@ -0,0 +1,178 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+)
+
+// Context key for the token scope requested via WithTokenScope().
+type tokenScopeKey struct{}
+
+// WithTokenScope returns a RequestOption that causes an IamAuthenticator to authenticate the request
+// with an access token of "scope" (see IamAuthenticator.GetTokenForScope()) rather than its Scope.
+// Other authenticators ignore the option.
+func WithTokenScope(scope string) RequestOption {
+	return func(builder *RequestBuilder) error {
+		builder.WithContext(context.WithValue(builder.getContext(), tokenScopeKey{}, scope))
+		return nil
+	}
+}
+
+// getTokenScope returns the token scope associated with "ctx" (see WithTokenScope()), if any.
+func getTokenScope(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	scope, ok := ctx.Value(tokenScopeKey{}).(string)
+	return scope, ok
+}
+
+// iamScopedToken is the access token of a scope other than the authenticator's Scope.
+type iamScopedToken struct {
+	// The cached token (guarded by the authenticator's tokenDataMutex).
+	tokenData *iamTokenData
+
+	// Coalesces the concurrent requests for a new access token of the scope.
+	requests tokenRequestGroup
+}
+
+// GetTokenForScope is like GetToken(), but returns an access token of "scope" rather than of the
+// authenticator's Scope, so that a single authenticator can supply differently-scoped tokens.
+// The access token of each scope is cached (and refreshed) independently.
+func (authenticator *IamAuthenticator) GetTokenForScope(scope string) (string, error) {
+	return authenticator.GetTokenForScopeWithContext(context.Background(), scope)
+}
+
+// GetTokenForScopeWithContext is like GetTokenForScope(), but if "ctx" is done before a new access token
+// is obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *IamAuthenticator) GetTokenForScopeWithContext(ctx context.Context, scope string) (string, error) {
+	if scope == authenticator.Scope {
+		return authenticator.GetTokenWithContext(ctx)
+	}
+
+	scoped := authenticator.getScopedToken(scope)
+	requestToken := func(ctx context.Context) error {
+		return authenticator.invokeRequestScopedTokenData(ctx, scope, scoped)
+	}
+
+	tokenData := authenticator.getScopedTokenData(scoped)
+	if tokenData == nil || !tokenData.isTokenValid() {
+		isValid := func() bool {
+			tokenData := authenticator.getScopedTokenData(scoped)
+			return tokenData != nil && tokenData.isTokenValid()
+		}
+		if err := synchronizedTokenRequest(ctx, &scoped.requests, isValid, requestToken); err != nil {
+			return "", err
+		}
+	} else if tokenData.needsRefresh() {
+		//nolint: errcheck
+		go scoped.requests.do(context.Background(), requestToken)
+	}
+
+	tokenData = authenticator.getScopedTokenData(scoped)
+	if tokenData == nil || tokenData.AccessToken == "" {
+		return "", fmt.Errorf("Error while trying to get access token")
+	}
+	return tokenData.AccessToken, nil
+}
+
+// getScopedToken returns the (possibly new) entry for the access token of "scope".
+func (authenticator *IamAuthenticator) getScopedToken(scope string) *iamScopedToken {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	scoped := authenticator.scopedTokens[scope]
+	if scoped == nil {
+		if authenticator.scopedTokens == nil {
+			authenticator.scopedTokens = make(map[string]*iamScopedToken)
+		}
+		scoped = &iamScopedToken{}
+		authenticator.scopedTokens[scope] = scoped
+	}
+	return scoped
+}
+
+// getScopedTokenData returns the cached token of "scoped".
+func (authenticator *IamAuthenticator) getScopedTokenData(scoped *iamScopedToken) *iamTokenData {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	return scoped.tokenData
+}
+
+// setScopedTokenDataIfCurrent sets the cached token of "scoped", unless the credentials were replaced
+// since they had the specified generation (in which case it returns false).
+func (authenticator *IamAuthenticator) setScopedTokenDataIfCurrent(scoped *iamScopedToken,
+	tokenData *iamTokenData, generation uint64) bool {
+	authenticator.tokenDataMutex.Lock()
+	defer authenticator.tokenDataMutex.Unlock()
+
+	if authenticator.credentialsGeneration != generation {
+		return false
+	}
+	scoped.tokenData = tokenData
+	// As for setTokenData(), use the new refresh token from now on.
+	if tokenData.RefreshToken != "" {
+		authenticator.RefreshToken = tokenData.RefreshToken
+	}
+	return true
+}
+
+// scopedTokenCacheKeys returns the keys under which the access tokens of the other scopes are
+// cached in the TokenCache (if any).
+func (authenticator *IamAuthenticator) scopedTokenCacheKeys() []string {
+	if authenticator.TokenCache == nil {
+		return nil
+	}
+
+	authenticator.tokenDataMutex.Lock()
+	scopes := make([]string, 0, len(authenticator.scopedTokens))
+	for scope := range authenticator.scopedTokens {
+		scopes = append(scopes, scope)
+	}
+	authenticator.tokenDataMutex.Unlock()
+
+	credentials := authenticator.getCredentials()
+	cacheKeys := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		cacheKeys = append(cacheKeys, authenticator.tokenCacheKeyForScope(credentials, scope))
+	}
+	return cacheKeys
+}
+
+// invokeRequestScopedTokenData is like invokeRequestTokenData(), but obtains an access token of
+// "scope" and stores it in "scoped". The functions registered via OnTokenRefresh() are not invoked.
+func (authenticator *IamAuthenticator) invokeRequestScopedTokenData(ctx context.Context, scope string,
+	scoped *iamScopedToken) error {
+	for {
+		credentials := authenticator.getCredentials()
+		requestToken := func(ctx context.Context) (*IamTokenServerResponse, error) {
+			return authenticator.requestTokenWithCredentials(ctx, credentials, scope)
+		}
+		tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKeyForScope(credentials, scope),
+			requestToken)
+		if err != nil {
+			return err
+		}
+
+		if authenticator.setScopedTokenDataIfCurrent(scoped, tokenData, credentials.generation) {
+			store()
+			return nil
+		}
+		GetLogger().Debug("Discarding the access token obtained with replaced credentials")
+	}
+}
@@ -0,0 +1,182 @@
+// +build all slow auth
+
+package core
+
+// (C) Copyright IBM Corp. 2019, 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// iamScopeTestToken returns an (unsigned) access token that identifies "scope".
+func iamScopeTestToken(scope string) string {
+	claims := fmt.Sprintf(`{"scope":"%s","iat":1560277051,"exp":1560281819}`, scope)
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+// startIamScopeTestServer returns a token server that issues an access token identifying the requested scope.
+func startIamScopeTestServer(t *testing.T) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, iamAuthMockApiKey, r.FormValue("apikey"))
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d,
+			"refresh_token": "%s"}`, iamScopeTestToken(r.FormValue("scope")), GetCurrentTime()+3600, iamAuthTestRefreshToken)
+	}))
+	return server, &requests
+}
+
+func TestIamGetTokenForScope(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+	server, requests := startIamScopeTestServer(t)
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetScope("default").
+		Build()
+	assert.Nil(t, err)
+
+	// The authenticator's Scope is used by default.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("default"), token)
+	token, err = authenticator.GetTokenForScope("default")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("default"), token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// The token of each other scope is obtained (and cached) independently.
+	token, err = authenticator.GetTokenForScope("other")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("other"), token)
+	token, err = authenticator.GetTokenForScope("")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken(""), token)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := authenticator.GetTokenForScope("other")
+			assert.Nil(t, err)
+			assert.Equal(t, iamScopeTestToken("other"), token)
+		}()
+	}
+	wg.Wait()
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("default"), token)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	// Invalidating the token discards the tokens of all scopes.
+	authenticator.InvalidateToken()
+	token, err = authenticator.GetTokenForScope("other")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("other"), token)
+	assert.Equal(t, int32(4), atomic.LoadInt32(requests))
+
+	// So does replacing the credentials.
+	assert.Nil(t, authenticator.SetApiKey(iamAuthMockApiKey))
+	_, err = authenticator.GetTokenForScope("other")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(5), atomic.LoadInt32(requests))
+
+	// A canceled context abandons the token request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = authenticator.GetTokenForScopeWithContext(ctx, "canceled")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestIamGetTokenForScopeWithTokenCache(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+	server, requests := startIamScopeTestServer(t)
+	defer server.Close()
+
+	tokenCache := NewMemoryTokenCache()
+	newAuthenticator := func() *IamAuthenticator {
+		authenticator, err := NewIamAuthenticatorBuilder().
+			SetApiKey(iamAuthMockApiKey).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: tokenCache}).
+			Build()
+		assert.Nil(t, err)
+		return authenticator
+	}
+
+	token, err := newAuthenticator().GetTokenForScope("other")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("other"), token)
+
+	// Another authenticator with the same configuration shares the token of the scope,
+	// but not the token of its own scope.
+	authenticator := newAuthenticator()
+	token, err = authenticator.GetTokenForScope("other")
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken("other"), token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamScopeTestToken(""), token)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestIamWithTokenScope(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+	server, _ := startIamScopeTestServer(t)
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL("https://localhost/placeholder/url", "", nil)
+	assert.Nil(t, err)
+	_, err = builder.ApplyOptions(WithTokenScope("other"))
+	assert.Nil(t, err)
+	request, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer "+iamScopeTestToken("other"), request.Header.Get("Authorization"))
+
+	// Without the option, the authenticator's Scope is used.
+	builder = NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL("https://localhost/placeholder/url", "", nil)
+	assert.Nil(t, err)
+	request, err = builder.Build()
+	assert.Nil(t, err)
+	assert.Nil(t, authenticator.Authenticate(request))
+	assert.Equal(t, "Bearer "+iamScopeTestToken(""), request.Header.Get("Authorization"))
+}
@@ -0,0 +1,235 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// The default interval between successive polls of a job's status.
+const defaultJobPollInterval = 5 * time.Second
+
+// JobStatus describes the state of an asynchronous job (operation).
+type JobStatus struct {
+	// The state of the job as reported by the service (e.g. "running", "completed").
+	State string
+
+	// Done is true iff the job has reached a terminal state.
+	Done bool
+
+	// The error associated with a job that completed unsuccessfully.
+	Err error
+
+	// The response from which the status was obtained, if available.
+	Response *DetailedResponse
+}
+
+// JobSubmitFunc submits an asynchronous operation and returns the id of the resulting job.
+type JobSubmitFunc func(ctx context.Context) (jobID string, err error)
+
+// JobPollFunc retrieves the current status of the specified job.
+type JobPollFunc func(ctx context.Context, jobID string) (*JobStatus, error)
+
+// JobCancelFunc requests the cancellation of the specified job.
+type JobCancelFunc func(ctx context.Context, jobID string) error
+
+// JobOptions holds the functions used by a Job to interact with the service
+// along with its configuration.
+type JobOptions struct {
+	// The function used to retrieve the job's status [required].
+	Poll JobPollFunc
+
+	// The function used to cancel the job [optional].
+	Cancel JobCancelFunc
+
+	// The interval between successive polls of the job's status;
+	// defaults to 5 seconds [optional].
+	PollInterval time.Duration
+}
+
+// Job is a handle to an asynchronous operation submitted to a service.
+// The job's completion is detected by polling its status, or by a notification
+// delivered via the Notify() method (e.g. from a webhook handler), whichever comes first.
+// A Job is safe for concurrent use.
+type Job struct {
+	// The id of the job, as returned by the submit function.
+	ID string
+
+	options JobOptions
+
+	// The most recently obtained status of the job.
+	status *JobStatus
+
+	// Callbacks to be invoked when the job completes.
+	callbacks []func(*JobStatus)
+
+	// Closed when the job has reached a terminal state.
+	done chan struct{}
+
+	mutex sync.Mutex
+}
+
+// NewJob returns a Job handle for an existing job with the specified id.
+func NewJob(jobID string, options *JobOptions) (*Job, error) {
+	if options == nil || options.Poll == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "Poll")
+	}
+
+	job := &Job{
+		ID:      jobID,
+		options: *options,
+		done:    make(chan struct{}),
+	}
+	if job.options.PollInterval <= 0 {
+		job.options.PollInterval = defaultJobPollInterval
+	}
+	return job, nil
+}
+
+// SubmitJob invokes "submit" to start an asynchronous operation and returns
+// a Job handle that can be used to wait for its completion.
+func SubmitJob(ctx context.Context, submit JobSubmitFunc, options *JobOptions) (*Job, error) {
+	if submit == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "submit")
+	}
+	if options == nil || options.Poll == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "Poll")
+	}
+
+	jobID, err := submit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJob(jobID, options)
+}
+
+// Status returns the most recently obtained status of the job, or nil if
+// the status has not yet been obtained.
+func (job *Job) Status() *JobStatus {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+
+	return job.status
+}
+
+// Refresh polls the service for the job's current status.
+func (job *Job) Refresh(ctx context.Context) (*JobStatus, error) {
+	status, err := job.options.Poll(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, fmt.Errorf(ERRORMSG_JOB_NO_STATUS, job.ID)
+	}
+
+	job.Notify(status)
+	return status, nil
+}
+
+// Notify records "status" as the job's current status. This allows a job's
+// completion to be delivered by a webhook handler, rather than detected by polling.
+func (job *Job) Notify(status *JobStatus) {
+	if status == nil {
+		return
+	}
+
+	var callbacks []func(*JobStatus)
+
+	job.mutex.Lock()
+	if job.isDone() {
+		// The job's final status has already been recorded.
+		job.mutex.Unlock()
+		return
+	}
+	job.status = status
+	if status.Done {
+		close(job.done)
+		callbacks = job.callbacks
+		job.callbacks = nil
+	}
+	job.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(status)
+	}
+}
+
+// OnComplete registers a function to be invoked when the job completes.
+// If the job has already completed, "callback" is invoked immediately.
+func (job *Job) OnComplete(callback func(*JobStatus)) {
+	job.mutex.Lock()
+	if !job.isDone() {
+		job.callbacks = append(job.callbacks, callback)
+		job.mutex.Unlock()
+		return
+	}
+	status := job.status
+	job.mutex.Unlock()
+
+	callback(status)
+}
+
+// Wait blocks until the job completes or "ctx" is done, polling the job's status
+// at the configured interval. Transient (retryable) polling errors are ignored.
+// Wait returns the job's final status, along with the job's error if it
+// completed unsuccessfully.
+func (job *Job) Wait(ctx context.Context) (*JobStatus, error) {
+	for {
+		select {
+		case <-job.done:
+			status := job.Status()
+			return status, status.Err
+		default:
+		}
+
+		status, err := job.Refresh(ctx)
+		if err != nil && !IsRetryable(err) {
+			return nil, err
+		}
+		if status != nil && status.Done {
+			// Return the recorded status, in case a notification was received first.
+			status = job.Status()
+			return status, status.Err
+		}
+
+		timer := time.NewTimer(job.options.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return job.Status(), ctx.Err()
+		case <-job.done:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Cancel requests the cancellation of the job.
+func (job *Job) Cancel(ctx context.Context) error {
+	if job.options.Cancel == nil {
+		return fmt.Errorf(ERRORMSG_JOB_CANCEL_UNSUPPORTED, job.ID)
+	}
+	return job.options.Cancel(ctx, job.ID)
+}
+
+// isDone returns true iff the job has reached a terminal state.
+// The caller must hold the job's mutex.
+func (job *Job) isDone() bool {
+	return job.status != nil && job.status.Done
+}
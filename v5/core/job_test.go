@@ -0,0 +1,197 @@
+// +build all fast
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestJobOptions returns JobOptions whose poll function reports the job
+// as complete after the specified number of polls.
+func newTestJobOptions(pollsUntilDone int32, jobErr error) (*JobOptions, *int32) {
+	var polls int32
+	options := &JobOptions{
+		Poll: func(ctx context.Context, jobID string) (*JobStatus, error) {
+			n := atomic.AddInt32(&polls, 1)
+			if n < pollsUntilDone {
+				return &JobStatus{State: "running"}, nil
+			}
+			return &JobStatus{State: "completed", Done: true, Err: jobErr}, nil
+		},
+		PollInterval: time.Millisecond,
+	}
+	return options, &polls
+}
+
+func TestJobSubmitAndWait(t *testing.T) {
+	options, polls := newTestJobOptions(3, nil)
+
+	job, err := SubmitJob(context.Background(), func(ctx context.Context) (string, error) {
+		return "job-1", nil
+	}, options)
+	assert.Nil(t, err)
+	assert.Equal(t, "job-1", job.ID)
+	assert.Nil(t, job.Status())
+
+	var completed *JobStatus
+	job.OnComplete(func(status *JobStatus) {
+		completed = status
+	})
+
+	status, err := job.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, status.Done)
+	assert.Equal(t, "completed", status.State)
+	assert.Equal(t, int32(3), atomic.LoadInt32(polls))
+	assert.Equal(t, status, completed)
+	assert.Equal(t, status, job.Status())
+
+	// Once complete, Wait() should return immediately.
+	status, err = job.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, status.Done)
+	assert.Equal(t, int32(3), atomic.LoadInt32(polls))
+
+	// Callbacks registered after completion are invoked immediately.
+	var lateCallback *JobStatus
+	job.OnComplete(func(status *JobStatus) {
+		lateCallback = status
+	})
+	assert.Equal(t, status, lateCallback)
+}
+
+func TestJobFailed(t *testing.T) {
+	options, _ := newTestJobOptions(1, fmt.Errorf("job failed"))
+	job, err := NewJob("job-1", options)
+	assert.Nil(t, err)
+
+	status, err := job.Wait(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, "job failed", err.Error())
+	assert.True(t, status.Done)
+}
+
+func TestJobSubmitErrors(t *testing.T) {
+	options, _ := newTestJobOptions(1, nil)
+
+	_, err := SubmitJob(context.Background(), func(ctx context.Context) (string, error) {
+		return "", fmt.Errorf("submit failed")
+	}, options)
+	assert.NotNil(t, err)
+	assert.Equal(t, "submit failed", err.Error())
+
+	_, err = SubmitJob(context.Background(), nil, options)
+	assert.NotNil(t, err)
+
+	_, err = NewJob("job-1", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "Poll"), err.Error())
+
+	_, err = NewJob("job-1", &JobOptions{})
+	assert.NotNil(t, err)
+}
+
+func TestJobWaitNotify(t *testing.T) {
+	// The job never completes via polling, so completion must arrive via Notify().
+	job, err := NewJob("job-1", &JobOptions{
+		Poll: func(ctx context.Context, jobID string) (*JobStatus, error) {
+			return &JobStatus{State: "running"}, nil
+		},
+		PollInterval: time.Hour,
+	})
+	assert.Nil(t, err)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		job.Notify(&JobStatus{State: "completed", Done: true})
+	}()
+
+	status, err := job.Wait(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "completed", status.State)
+
+	// Subsequent notifications are ignored once the job is complete.
+	job.Notify(&JobStatus{State: "running"})
+	assert.Equal(t, "completed", job.Status().State)
+}
+
+func TestJobWaitContext(t *testing.T) {
+	options, _ := newTestJobOptions(1000000, nil)
+	job, err := NewJob("job-1", options)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	status, err := job.Wait(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, "running", status.State)
+	assert.False(t, status.Done)
+}
+
+func TestJobWaitPollErrors(t *testing.T) {
+	var polls int32
+	job, err := NewJob("job-1", &JobOptions{
+		Poll: func(ctx context.Context, jobID string) (*JobStatus, error) {
+			switch atomic.AddInt32(&polls, 1) {
+			case 1:
+				// Transient errors are ignored.
+				return nil, newHTTPError(&DetailedResponse{StatusCode: http.StatusServiceUnavailable}, "unavailable")
+			case 2:
+				return nil, nil
+			default:
+				return nil, newHTTPError(&DetailedResponse{StatusCode: http.StatusNotFound}, "job not found")
+			}
+		},
+		PollInterval: time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	_, err = job.Wait(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_JOB_NO_STATUS, "job-1"), err.Error())
+
+	_, err = job.Wait(context.Background())
+	assert.NotNil(t, err)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestJobCancel(t *testing.T) {
+	options, _ := newTestJobOptions(1, nil)
+	job, err := NewJob("job-1", options)
+	assert.Nil(t, err)
+
+	err = job.Cancel(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_JOB_CANCEL_UNSUPPORTED, "job-1"), err.Error())
+
+	var cancelledJobID string
+	options.Cancel = func(ctx context.Context, jobID string) error {
+		cancelledJobID = jobID
+		return nil
+	}
+	job, err = NewJob("job-2", options)
+	assert.Nil(t, err)
+	assert.Nil(t, job.Cancel(context.Background()))
+	assert.Equal(t, "job-2", cancelledJobID)
+}
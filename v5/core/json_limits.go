@@ -0,0 +1,146 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// JSONLimits limits the JSON response bodies that are unmarshalled by BaseService.Request(),
+// to protect the application from pathological responses (e.g. from a compromised or faulty
+// endpoint) that would otherwise consume unbounded CPU or memory. A zero value means no limit.
+type JSONLimits struct {
+	// The maximum nesting depth of objects and arrays.
+	MaxDepth int
+
+	// The maximum number of tokens (i.e. objects, arrays, object keys, strings,
+	// numbers and literals).
+	MaxTokens int
+
+	// The maximum size of the response body, in bytes.
+	MaxSize int64
+}
+
+// JSONLimitError is the error returned by BaseService.Request() for a JSON response body
+// that exceeds one of the service's JSONLimits.
+type JSONLimitError struct {
+	// The limit that was exceeded ("depth", "tokens" or "size"), and its value.
+	Limit string
+	Value int64
+}
+
+func (e *JSONLimitError) Error() string {
+	return fmt.Sprintf(ERRORMSG_JSON_LIMIT_EXCEEDED, e.Limit, e.Value)
+}
+
+// SetJSONLimits sets the limits that are enforced before a JSON response body (including
+// an error response body) is unmarshalled. A successful response that exceeds a limit results
+// in a JSONLimitError, while an error response that exceeds a limit is not unmarshalled (so the
+// HTTP error contains a generic message). The limits don't apply to streamed responses
+// (i.e. when the result is an io.ReadCloser or a ResponseBodyWriter).
+// A nil value removes any previously-set limits.
+func (service *BaseService) SetJSONLimits(limits *JSONLimits) error {
+	if limits != nil {
+		if limits.MaxDepth < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxDepth")
+		}
+		if limits.MaxTokens < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxTokens")
+		}
+		if limits.MaxSize < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxSize")
+		}
+		limitsCopy := *limits
+		limits = &limitsCopy
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.jsonLimits = limits
+	return nil
+}
+
+// readResponseBody reads the entire response body "r". For a JSON response body, a
+// JSONLimitError is returned as soon as more than MaxSize bytes have been read.
+func (limits *JSONLimits) readResponseBody(r io.Reader, contentType string) ([]byte, error) {
+	if limits == nil || limits.MaxSize <= 0 || !IsJSONMimeType(contentType) {
+		return ioutil.ReadAll(r)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r, limits.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limits.MaxSize {
+		return nil, &JSONLimitError{Limit: "size", Value: limits.MaxSize}
+	}
+	return body, nil
+}
+
+// check scans "body" (without decoding it) and returns a JSONLimitError
+// if it exceeds MaxDepth or MaxTokens.
+func (limits *JSONLimits) check(body []byte) error {
+	if limits == nil || (limits.MaxDepth <= 0 && limits.MaxTokens <= 0) {
+		return nil
+	}
+
+	depth, tokens := 0, 0
+	inString, escaped, inLiteral := false, false, false
+	for _, c := range body {
+		if inString {
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '{', '[':
+			depth++
+			tokens++
+			inLiteral = false
+			if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+				return &JSONLimitError{Limit: "depth", Value: int64(limits.MaxDepth)}
+			}
+		case '}', ']':
+			depth--
+			inLiteral = false
+		case '"':
+			inString = true
+			tokens++
+			inLiteral = false
+		case ',', ':', ' ', '\t', '\n', '\r':
+			inLiteral = false
+		default:
+			// A number, "true", "false" or "null" counts as a single token.
+			if !inLiteral {
+				inLiteral = true
+				tokens++
+			}
+		}
+
+		if limits.MaxTokens > 0 && tokens > limits.MaxTokens {
+			return &JSONLimitError{Limit: "tokens", Value: int64(limits.MaxTokens)}
+		}
+	}
+	return nil
+}
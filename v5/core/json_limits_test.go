@@ -0,0 +1,101 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLimitsCheck(t *testing.T) {
+	limits := &JSONLimits{MaxDepth: 2, MaxTokens: 6}
+	assert.Nil(t, limits.check([]byte(`{"a": [1, true]}`)))
+	assert.Nil(t, limits.check([]byte(`{"a": "[[[{\"]]"}`)))
+	assert.Equal(t, &JSONLimitError{Limit: "depth", Value: 2}, limits.check([]byte(`{"a": [{"b": 1}]}`)))
+	assert.Equal(t, &JSONLimitError{Limit: "tokens", Value: 6}, limits.check([]byte(`["a", "b", "c", 1, 2, null]`)))
+
+	var noLimits *JSONLimits
+	assert.Nil(t, noLimits.check([]byte(`[[[[[[[[[[]]]]]]]]]]`)))
+}
+
+func TestJSONLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE, "application/json")
+		switch r.URL.Path {
+		case "/v1/nested":
+			_, _ = w.Write([]byte(strings.Repeat("[", 50) + strings.Repeat("]", 50)))
+		case "/v1/large":
+			_, _ = w.Write([]byte(`{"data":"` + strings.Repeat("x", 1000) + `"}`))
+		case "/v1/error":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":` + strings.Repeat("[", 50) + strings.Repeat("]", 50) + `}`))
+		default:
+			_, _ = w.Write([]byte(`{"name":"instance-1"}`))
+		}
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newRequest := func(path string) *http.Request {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+	invoke := func(path string) (*DetailedResponse, error) {
+		var result interface{}
+		return service.Request(newRequest(path), &result)
+	}
+
+	assert.NotNil(t, service.SetJSONLimits(&JSONLimits{MaxDepth: -1}))
+	assert.Nil(t, service.SetJSONLimits(&JSONLimits{MaxDepth: 10, MaxSize: 100}))
+
+	_, err = invoke("/v1/instances/1")
+	assert.Nil(t, err)
+
+	response, err := invoke("/v1/nested")
+	var limitErr *JSONLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "The JSON response body exceeds the maximum depth (10)", err.Error())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotNil(t, response.RawResult)
+
+	_, err = invoke("/v1/large")
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, &JSONLimitError{Limit: "size", Value: 100}, limitErr)
+
+	// An error response that exceeds the limits isn't unmarshalled.
+	response, err = invoke("/v1/error")
+	assert.Equal(t, "Bad Request", err.Error())
+	assert.Nil(t, response.Result)
+
+	// The limits are copied by clones, and can be removed.
+	var result interface{}
+	_, err = service.Clone().Request(newRequest("/v1/nested"), &result)
+	assert.NotNil(t, err)
+	assert.Nil(t, service.SetJSONLimits(nil))
+	_, err = invoke("/v1/nested")
+	assert.Nil(t, err)
+}
@@ -23,12 +23,53 @@ import (
 
 // coreJWTClaims are the fields within a JWT's "claims" segment that we're interested in.
 type coreJWTClaims struct {
-	ExpiresAt int64 `json:"exp,omitempty"`
-	IssuedAt  int64 `json:"iat,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	Issuer    string      `json:"iss,omitempty"`
+	Audience  jwtAudience `json:"aud,omitempty"`
+}
+
+// jwtAudience is the value of a JWT's "aud" claim, which may be either a string or an array of strings.
+type jwtAudience []string
+
+// UnmarshalJSON unmarshals an "aud" claim.
+func (audience *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*audience = jwtAudience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*audience = multiple
+	return nil
+}
+
+// contains returns true iff "value" is one of the audience values.
+func (audience jwtAudience) contains(value string) bool {
+	for _, a := range audience {
+		if a == value {
+			return true
+		}
+	}
+	return false
 }
 
 // parseJWT parses the specified JWT token string and returns an instance of the coreJWTClaims struct.
 func parseJWT(tokenString string) (claims *coreJWTClaims, err error) {
+	claims = &coreJWTClaims{}
+	err = decodeJWTClaims(tokenString, claims)
+	if err != nil {
+		claims = nil
+	}
+	return
+}
+
+// decodeJWTClaims deserializes the "claims" segment of the specified JWT token string into "claims".
+func decodeJWTClaims(tokenString string, claims interface{}) (err error) {
 	// A JWT consists of three .-separated segments
 	segments := strings.Split(tokenString, ".")
 	if len(segments) != 3 {
@@ -44,8 +85,7 @@ func parseJWT(tokenString string) (claims *coreJWTClaims, err error) {
 		return
 	}
 
-	// Now deserialize the claims segment into our coreClaims struct.
-	claims = &coreJWTClaims{}
+	// Now deserialize the claims segment into the caller's struct.
 	err = json.Unmarshal(claimBytes, claims)
 	if err != nil {
 		err = fmt.Errorf("error unmarshalling token: %s", err.Error())
@@ -55,6 +95,26 @@ func parseJWT(tokenString string) (claims *coreJWTClaims, err error) {
 	return
 }
 
+// validateTokenClaims verifies that the "iss" and "aud" claims of the specified access token
+// match the expected values. An empty expected value is not checked.
+func validateTokenClaims(accessToken string, expectedIssuer string, expectedAudience string) error {
+	if expectedIssuer == "" && expectedAudience == "" {
+		return nil
+	}
+
+	claims, err := parseJWT(accessToken)
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_TOKEN_CLAIMS_INVALID, err.Error())
+	}
+	if expectedIssuer != "" && claims.Issuer != expectedIssuer {
+		return fmt.Errorf(ERRORMSG_TOKEN_ISSUER_MISMATCH, claims.Issuer, expectedIssuer)
+	}
+	if expectedAudience != "" && !claims.Audience.contains(expectedAudience) {
+		return fmt.Errorf(ERRORMSG_TOKEN_AUDIENCE_MISMATCH, strings.Join(claims.Audience, ", "), expectedAudience)
+	}
+	return nil
+}
+
 // Decode JWT specific base64url encoding with padding stripped
 // Copied from https://github.com/golang-jwt/jwt/blob/main/token.go
 func decodeSegment(seg string) ([]byte, error) {
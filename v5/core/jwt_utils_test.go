@@ -17,6 +17,8 @@ package core
 // limitations under the License.
 
 import (
+	"encoding/base64"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -54,6 +56,33 @@ func TestParseJWT(t *testing.T) {
 	assert.Equal(t, int64(1610548248), claims.IssuedAt)
 }
 
+func TestValidateTokenClaims(t *testing.T) {
+	claims, err := parseJWT(jwtUserPwd)
+	assert.Nil(t, err)
+	assert.Equal(t, "KNOXSSO", claims.Issuer)
+	assert.Equal(t, jwtAudience{"DSX"}, claims.Audience)
+
+	assert.Nil(t, validateTokenClaims(jwtUserPwd, "", ""))
+	assert.Nil(t, validateTokenClaims(jwtUserPwd, "KNOXSSO", "DSX"))
+	assert.Nil(t, validateTokenClaims("not-a-jwt", "", ""))
+
+	err = validateTokenClaims(jwtUserPwd, "https://iam.cloud.ibm.com/identity", "")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_ISSUER_MISMATCH, "KNOXSSO", "https://iam.cloud.ibm.com/identity"), err.Error())
+
+	err = validateTokenClaims(jwtUserPwd, "KNOXSSO", "other")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_AUDIENCE_MISMATCH, "DSX", "other"), err.Error())
+
+	err = validateTokenClaims("not-a-jwt", "KNOXSSO", "")
+	assert.NotNil(t, err)
+
+	// The "aud" claim may contain an array of values.
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss": "issuer", "aud": ["aud1", "aud2"]}`))
+	token := "eyJhbGciOiJub25lIn0." + payload + ".signature"
+	assert.Nil(t, validateTokenClaims(token, "issuer", "aud2"))
+	err = validateTokenClaims(token, "issuer", "aud3")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_AUDIENCE_MISMATCH, "aud1, aud2", "aud3"), err.Error())
+}
+
 func TestDecodeSegment(t *testing.T) {
 	testStringDecoded := "testString\n"
 	testStringEncoded := "dGVzdFN0cmluZwo="
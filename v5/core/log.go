@@ -17,6 +17,7 @@ package core
 import (
 	"log"
 	"os"
+	"os/signal"
 	"sync"
 )
 
@@ -61,6 +62,9 @@ type SDKLoggerImpl struct {
 	// Only messages with a log level that is <= 'logLevel' will be displayed.
 	logLevel LogLevel
 
+	// Guards 'logLevel' so that it can be changed while messages are being logged.
+	levelMutex sync.RWMutex
+
 	// The underlying log.Logger instances used to log info/warn/debug messages.
 	infoLogger *log.Logger
 
@@ -74,18 +78,24 @@ type SDKLoggerImpl struct {
 
 // SetLogLevel sets level to be the current logging level
 func (l *SDKLoggerImpl) SetLogLevel(level LogLevel) {
+	l.levelMutex.Lock()
+	defer l.levelMutex.Unlock()
+
 	l.logLevel = level
 }
 
 // GetLogLevel sets level to be the current logging level
 func (l *SDKLoggerImpl) GetLogLevel() LogLevel {
+	l.levelMutex.RLock()
+	defer l.levelMutex.RUnlock()
+
 	return l.logLevel
 }
 
 // IsLogLevelEnabled returns true iff the logger's current logging level
 // indicates that 'level' is enabled.
 func (l *SDKLoggerImpl) IsLogLevelEnabled(level LogLevel) bool {
-	return l.logLevel >= level
+	return l.GetLogLevel() >= level
 }
 
 // infoLog returns the underlying log.Logger instance used for info/warn/debug logging.
@@ -163,13 +173,22 @@ func NewLogger(level LogLevel, infoLogger *log.Logger, errorLogger *log.Logger)
 // sdkLogger holds the Logger implementation used by the Go core library.
 var sdkLogger Logger = NewLogger(LevelError, nil, nil)
 
+// Guards 'sdkLogger' so that it can be replaced while it is in use.
+var sdkLoggerMutex sync.RWMutex
+
 // SetLogger sets the specified Logger instance as the logger to be used by the Go core library.
 func SetLogger(logger Logger) {
+	sdkLoggerMutex.Lock()
+	defer sdkLoggerMutex.Unlock()
+
 	sdkLogger = logger
 }
 
 // GetLogger returns the Logger instance currently used by the Go core.
 func GetLogger() Logger {
+	sdkLoggerMutex.RLock()
+	defer sdkLoggerMutex.RUnlock()
+
 	return sdkLogger
 }
 
@@ -177,3 +196,85 @@ func GetLogger() Logger {
 func SetLoggingLevel(level LogLevel) {
 	GetLogger().SetLogLevel(level)
 }
+
+// SetLogLevelAtRuntime changes the logging level of the Go core library's current logger
+// while the application is running (e.g. to enable request logging in a misbehaving
+// production process without restarting it), and returns the previous logging level.
+// It is safe to call SetLogLevelAtRuntime concurrently with requests being processed,
+// provided that the current logger's SetLogLevel method is safe for concurrent use
+// (as is the case for the SDKLoggerImpl returned by NewLogger).
+func SetLogLevelAtRuntime(level LogLevel) LogLevel {
+	runtimeLevelMutex.Lock()
+	defer runtimeLevelMutex.Unlock()
+
+	logger := GetLogger()
+	previous := logger.GetLogLevel()
+	logger.SetLogLevel(level)
+	return previous
+}
+
+// Serializes runtime changes to the logging level.
+var runtimeLevelMutex sync.Mutex
+
+// ToggleLogLevelOnSignal starts a goroutine that toggles the logging level of the Go core
+// library each time the process receives the SIGUSR1 signal: the first signal enables
+// "level" (e.g. LevelDebug), the next signal restores the previous logging level, and so on.
+// For example, request logging can then be enabled in a running process with:
+//
+//	kill -USR1 <pid>
+//
+// The returned function stops the toggling and restores the previous logging level
+// if "level" is currently enabled by the toggle.
+// On platforms that do not support SIGUSR1 (e.g. Windows), the logging level is never toggled.
+func ToggleLogLevelOnSignal(level LogLevel) (stop func()) {
+	if logLevelToggleSignal == nil {
+		GetLogger().Warn("Toggling the logging level via a signal is not supported on this platform")
+		return func() {}
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, logLevelToggleSignal)
+
+	var mutex sync.Mutex
+	var toggled bool
+	var previous LogLevel
+	toggle := func(enable bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if enable && !toggled {
+			previous = SetLogLevelAtRuntime(level)
+			toggled = true
+		} else if !enable && toggled {
+			SetLogLevelAtRuntime(previous)
+			toggled = false
+		} else {
+			return
+		}
+		GetLogger().Info("Logging level set to %d", GetLogger().GetLogLevel())
+	}
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				mutex.Lock()
+				enable := !toggled
+				mutex.Unlock()
+				toggle(enable)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			toggle(false)
+		})
+	}
+}
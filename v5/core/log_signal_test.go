@@ -0,0 +1,61 @@
+// +build all fast log
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForLogLevel waits (for up to a second) until the current logging level is "level".
+func waitForLogLevel(level LogLevel) bool {
+	for i := 0; i < 100; i++ {
+		if GetLogger().GetLogLevel() == level {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestToggleLogLevelOnSignal(t *testing.T) {
+	original := GetLogger()
+	defer SetLogger(original)
+
+	_, _, logger := stringLogger(LevelError)
+	SetLogger(logger)
+
+	stop := ToggleLogLevelOnSignal(LevelDebug)
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.True(t, waitForLogLevel(LevelDebug))
+
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.True(t, waitForLogLevel(LevelError))
+
+	// Stopping the toggle restores the previous logging level.
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.True(t, waitForLogLevel(LevelDebug))
+	stop()
+	assert.Equal(t, LevelError, GetLogger().GetLogLevel())
+	stop()
+}
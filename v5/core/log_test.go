@@ -19,6 +19,7 @@ package core
 import (
 	"bytes"
 	"log"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -212,3 +213,33 @@ func TestLogDebug(t *testing.T) {
 	assert.Equal(t, "[Debug] debug msg\n", stdout.String())
 	assert.Empty(t, stderr.String())
 }
+
+func TestSetLogLevelAtRuntime(t *testing.T) {
+	original := GetLogger()
+	defer SetLogger(original)
+
+	stdout, _, logger := stringLogger(LevelError)
+	SetLogger(logger)
+
+	previous := SetLogLevelAtRuntime(LevelDebug)
+	assert.Equal(t, LevelError, previous)
+	assert.Equal(t, LevelDebug, GetLogger().GetLogLevel())
+	GetLogger().Debug("debug message")
+	assert.Equal(t, "[Debug] debug message\n", stdout.String())
+
+	// The logging level can be changed while messages are being logged.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			SetLogLevelAtRuntime(LogLevel(i % 5))
+		}(i)
+		go func() {
+			defer wg.Done()
+			GetLogger().IsLogLevelEnabled(LevelDebug)
+			GetLogger().Debug("concurrent message")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,184 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MultiAuthenticator authenticates requests with the first of an ordered list of authenticators
+// that can be used in the current environment, similar to a default credential chain, so that
+// the same program can run unchanged on a laptop (e.g. with an apikey obtained from the environment),
+// on a VPC instance and in a Kubernetes cluster, e.g.
+//
+//	authenticator, err := core.NewMultiAuthenticator(
+//		&core.ContainerAuthenticator{IAMProfileName: "my-profile"},
+//		&core.VpcInstanceAuthenticator{IAMProfileCRN: "crn:..."},
+//		&core.IamAuthenticator{ApiKey: os.Getenv("IBMCLOUD_API_KEY")},
+//	)
+//
+// An authenticator can be used if its configuration is valid and, for an authenticator that
+// obtains access tokens (e.g. from IAM), if it obtains an access token. The first authenticator
+// that can be used is selected when the MultiAuthenticator is first used, and is then used for
+// all requests. If none can be used, the selection is attempted again the next time.
+type MultiAuthenticator struct {
+	// The authenticators to be tried, in order [required].
+	Authenticators []Authenticator
+
+	// The selected authenticator, if any.
+	selected Authenticator
+
+	// Mutex to make the selected field thread safe, and to ensure that only one goroutine
+	// at a time tries the authenticators.
+	selectedMutex sync.Mutex
+}
+
+// NewMultiAuthenticator constructs a new MultiAuthenticator instance
+// that tries "authenticators" in the specified order.
+func NewMultiAuthenticator(authenticators ...Authenticator) (*MultiAuthenticator, error) {
+	obj := &MultiAuthenticator{
+		Authenticators: authenticators,
+	}
+	if err := obj.Validate(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// AuthenticationType returns the authentication type for this authenticator.
+func (*MultiAuthenticator) AuthenticationType() string {
+	return AUTHTYPE_MULTI
+}
+
+// Authenticate authenticates the request with the selected authenticator,
+// selecting it first if necessary.
+func (this *MultiAuthenticator) Authenticate(request *http.Request) error {
+	authenticator, err := this.selectAuthenticator(request.Context())
+	if err != nil {
+		return err
+	}
+	return authenticator.Authenticate(request)
+}
+
+// GetTokenWithContext returns an access token obtained by the selected authenticator (selecting it first,
+// if necessary), if it obtains access tokens. If "ctx" is done before the token is obtained, then
+// ctx.Err() is returned.
+func (this *MultiAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	authenticator, err := this.selectAuthenticator(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tokenAuthenticator, ok := authenticator.(contextTokenGetter); ok {
+		return tokenAuthenticator.GetTokenWithContext(ctx)
+	}
+	return "", fmt.Errorf(ERRORMSG_AUTHTYPE_NO_TOKENS, authenticator.AuthenticationType())
+}
+
+// Selected returns the selected authenticator, or nil if none was selected yet.
+func (this *MultiAuthenticator) Selected() Authenticator {
+	this.selectedMutex.Lock()
+	defer this.selectedMutex.Unlock()
+
+	return this.selected
+}
+
+// InvalidateToken discards the access token cached by the selected authenticator (if it manages access tokens).
+func (this *MultiAuthenticator) InvalidateToken() {
+	if invalidator, ok := this.Selected().(TokenInvalidator); ok {
+		invalidator.InvalidateToken()
+	}
+}
+
+// managesTokens returns true iff the selected authenticator (or, if none was selected yet,
+// any of the authenticators) manages access tokens.
+func (this *MultiAuthenticator) managesTokens() bool {
+	if selected := this.Selected(); selected != nil {
+		return managesTokens(selected)
+	}
+	for _, authenticator := range this.Authenticators {
+		if managesTokens(authenticator) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextTokenGetter is implemented by the authenticators that obtain access tokens.
+type contextTokenGetter interface {
+	GetTokenWithContext(ctx context.Context) (string, error)
+}
+
+// selectAuthenticator returns the selected authenticator, first selecting the first authenticator
+// that can be used if none was selected yet.
+func (this *MultiAuthenticator) selectAuthenticator(ctx context.Context) (Authenticator, error) {
+	this.selectedMutex.Lock()
+	defer this.selectedMutex.Unlock()
+
+	if this.selected != nil {
+		return this.selected, nil
+	}
+
+	reasons := make([]string, 0, len(this.Authenticators))
+	for _, authenticator := range this.Authenticators {
+		if IsNil(authenticator) {
+			continue
+		}
+		err := authenticator.Validate()
+		if err == nil {
+			if tokenAuthenticator, ok := authenticator.(contextTokenGetter); ok {
+				_, err = tokenAuthenticator.GetTokenWithContext(ctx)
+			}
+		}
+		if err != nil {
+			// If the caller gave up, then don't try the remaining authenticators.
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			GetLogger().Debug("Unable to use the %s authenticator: %s", authenticator.AuthenticationType(), err.Error())
+			reasons = append(reasons, authenticator.AuthenticationType()+": "+err.Error())
+			continue
+		}
+
+		GetLogger().Debug("Using the %s authenticator", authenticator.AuthenticationType())
+		this.selected = authenticator
+		return authenticator, nil
+	}
+
+	err := fmt.Errorf(ERRORMSG_NO_USABLE_AUTHENTICATOR, strings.Join(reasons, "; "))
+	return nil, NewAuthenticationError(&DetailedResponse{}, err)
+}
+
+// Validate the authenticator's configuration.
+//
+// Ensures that at least one authenticator was specified. The authenticators themselves are validated
+// when they are tried, since an authenticator whose configuration is invalid (e.g. one configured with
+// an apikey obtained from an environment variable that isn't set) is simply skipped.
+func (this *MultiAuthenticator) Validate() error {
+	if len(this.Authenticators) == 0 {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "Authenticators")
+	}
+
+	for _, authenticator := range this.Authenticators {
+		if IsNil(authenticator) {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "Authenticators")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiAuthenticatorValidate(t *testing.T) {
+	_, err := NewMultiAuthenticator()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PROP_MISSING, "Authenticators"), err.Error())
+
+	_, err = NewMultiAuthenticator(&NoAuthAuthenticator{}, nil)
+	assert.NotNil(t, err)
+
+	// The authenticators themselves are validated only when they are tried.
+	authenticator, err := NewMultiAuthenticator(&IamAuthenticator{}, &NoAuthAuthenticator{})
+	assert.Nil(t, err)
+	assert.Equal(t, AUTHTYPE_MULTI, authenticator.AuthenticationType())
+	assert.Nil(t, authenticator.Selected())
+}
+
+func TestMultiAuthenticatorFallback(t *testing.T) {
+	var failing int32 = 1
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errorMessage": "invalid apikey"}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "refresh-token"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	iamAuthenticator := &IamAuthenticator{ApiKey: "apikey", URL: server.URL}
+	basicAuthenticator := &BasicAuthenticator{Username: "user", Password: "password"}
+
+	// The invalid authenticator and the authenticator that can't obtain a token are skipped.
+	authenticator, err := NewMultiAuthenticator(&IamAuthenticator{}, iamAuthenticator, basicAuthenticator)
+	assert.Nil(t, err)
+	request, _ := http.NewRequest("GET", "https://localhost", nil)
+	err = authenticator.Authenticate(request)
+	assert.Nil(t, err)
+	assert.Equal(t, basicAuthenticator, authenticator.Selected())
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "password", password)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The selected authenticator is used from then on.
+	atomic.StoreInt32(&failing, 0)
+	err = authenticator.Authenticate(request)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	_, err = authenticator.GetTokenWithContext(context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_AUTHTYPE_NO_TOKENS, AUTHTYPE_BASIC), err.Error())
+	assert.False(t, managesTokens(authenticator))
+
+	// An authenticator that obtains a token is selected.
+	authenticator, err = NewMultiAuthenticator(iamAuthenticator, basicAuthenticator)
+	assert.Nil(t, err)
+	assert.True(t, managesTokens(authenticator))
+	token, err := authenticator.GetTokenWithContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, iamAuthenticator, authenticator.Selected())
+	request, _ = http.NewRequest("GET", "https://localhost", nil)
+	err = authenticator.Authenticate(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer "+iamAuthTestAccessToken1, request.Header.Get("Authorization"))
+	authenticator.InvalidateToken()
+	assert.Nil(t, iamAuthenticator.getTokenData())
+}
+
+func TestMultiAuthenticatorNoneUsable(t *testing.T) {
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{
+			"access_token": "%s",
+			"token_type": "Bearer",
+			"expires_in": 3600,
+			"expiration": %d,
+			"refresh_token": "refresh-token"
+		}`, iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewMultiAuthenticator(&IamAuthenticator{}, &IamAuthenticator{ApiKey: "apikey", URL: server.URL})
+	assert.Nil(t, err)
+	request, _ := http.NewRequest("GET", "https://localhost", nil)
+	err = authenticator.Authenticate(request)
+	assert.NotNil(t, err)
+	authErr, ok := err.(*AuthenticationError)
+	assert.True(t, ok)
+	if ok {
+		assert.Contains(t, authErr.Error(), "None of the authenticators can be used")
+		assert.Contains(t, authErr.Error(), fmt.Sprintf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "ApiKey", "RefreshToken"))
+	}
+	assert.Nil(t, authenticator.Selected())
+
+	// The selection is attempted again.
+	atomic.StoreInt32(&failing, 0)
+	err = authenticator.Authenticate(request)
+	assert.Nil(t, err)
+	assert.NotNil(t, authenticator.Selected())
+
+	// A cancelled context stops the selection.
+	authenticator, err = NewMultiAuthenticator(&IamAuthenticator{ApiKey: "apikey", URL: server.URL})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = authenticator.GetTokenWithContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,155 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// multiStatusResultsProperty is the name of the property that contains the
+// per-item outcomes within a multi-status response body.
+const multiStatusResultsProperty = "results"
+
+// MultiStatusResult represents the body of a 207 (Multi-Status) or partial-success
+// response returned by a bulk operation, which contains the outcome of each item.
+//
+// The response body is expected to be either a JSON array of items or a JSON object
+// containing the array of items in its "results" property, where each item is a JSON
+// object of the form:
+//
+//	{"status": 201, "id": "item-1", "resource": {...}}
+//	{"status": 404, "id": "item-2", "errors": [{"message": "not found"}]}
+type MultiStatusResult struct {
+	// The outcome of each item, in the order in which they appeared in the response body.
+	Items []MultiStatusItem
+}
+
+// MultiStatusItem represents the outcome of a single item within a bulk operation.
+type MultiStatusItem struct {
+	// The HTTP status code associated with the item.
+	Status int
+
+	// The identifier of the item, if present in the response.
+	ID string
+
+	// The resource associated with the item (typically present for successful items).
+	// Use UnmarshalModel() or json.Unmarshal() to convert this to a specific type.
+	Resource json.RawMessage
+
+	// The error message associated with the item (present for unsuccessful items).
+	ErrorMessage string
+
+	// The item as a generic JSON object, to provide access to any other properties.
+	Raw map[string]json.RawMessage
+}
+
+// IsSuccess returns true iff the item's status code is in the 2xx range.
+func (item *MultiStatusItem) IsSuccess() bool {
+	return item.Status >= 200 && item.Status <= 299
+}
+
+// UnmarshalJSON unmarshals a single multi-status item.
+func (item *MultiStatusItem) UnmarshalJSON(data []byte) (err error) {
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return
+	}
+
+	*item = MultiStatusItem{Raw: raw}
+	if err = UnmarshalPrimitive(raw, "status", &item.Status); err != nil {
+		return
+	}
+	if err = UnmarshalPrimitive(raw, "id", &item.ID); err != nil {
+		return
+	}
+	if resource, ok := raw["resource"]; ok && !isJsonNull(resource) {
+		item.Resource = resource
+	}
+
+	// For unsuccessful items, extract the error message using the same rules
+	// that are used for an unsuccessful operation response.
+	if !item.IsSuccess() {
+		var errorMap map[string]interface{}
+		if err = json.Unmarshal(data, &errorMap); err != nil {
+			return
+		}
+		item.ErrorMessage = getErrorMessage(errorMap, item.Status)
+	}
+	return
+}
+
+// ParseMultiStatusResult parses the specified response body and returns the
+// resulting MultiStatusResult instance.
+func ParseMultiStatusResult(body []byte) (result *MultiStatusResult, err error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		err = fmt.Errorf(ERRORMSG_MULTI_STATUS_BODY, "response body is empty")
+		return
+	}
+
+	var items []MultiStatusItem
+	if body[0] == '[' {
+		err = json.Unmarshal(body, &items)
+	} else {
+		var rawMap map[string]json.RawMessage
+		if err = json.Unmarshal(body, &rawMap); err == nil {
+			rawItems, ok := rawMap[multiStatusResultsProperty]
+			if !ok {
+				err = fmt.Errorf("property '%s' not found", multiStatusResultsProperty)
+			} else {
+				err = json.Unmarshal(rawItems, &items)
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf(ERRORMSG_MULTI_STATUS_BODY, err.Error())
+		return
+	}
+
+	result = &MultiStatusResult{Items: items}
+	return
+}
+
+// Successes returns the items whose status code is in the 2xx range.
+func (result *MultiStatusResult) Successes() []MultiStatusItem {
+	return result.filter(true)
+}
+
+// Failures returns the items whose status code is not in the 2xx range.
+func (result *MultiStatusResult) Failures() []MultiStatusItem {
+	return result.filter(false)
+}
+
+// HasFailures returns true iff at least one item was unsuccessful.
+func (result *MultiStatusResult) HasFailures() bool {
+	for i := range result.Items {
+		if !result.Items[i].IsSuccess() {
+			return true
+		}
+	}
+	return false
+}
+
+func (result *MultiStatusResult) filter(success bool) []MultiStatusItem {
+	items := make([]MultiStatusItem, 0, len(result.Items))
+	for _, item := range result.Items {
+		if item.IsSuccess() == success {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,125 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const multiStatusBody = `{"results": [
+	{"status": 201, "id": "item-1", "resource": {"name": "wonder woman"}},
+	{"status": 404, "id": "item-2", "errors": [{"message": "item not found"}]},
+	{"status": 200, "id": "item-3", "resource": {"name": "superman"}},
+	{"status": 409, "id": "item-4", "error": "item already exists"},
+	{"status": 500, "id": "item-5"}
+]}`
+
+func verifyMultiStatusResult(t *testing.T, result *MultiStatusResult) {
+	assert.NotNil(t, result)
+	assert.Len(t, result.Items, 5)
+	assert.True(t, result.HasFailures())
+
+	successes := result.Successes()
+	assert.Len(t, successes, 2)
+	assert.Equal(t, "item-1", successes[0].ID)
+	assert.Equal(t, 201, successes[0].Status)
+	assert.Equal(t, "", successes[0].ErrorMessage)
+	assert.Equal(t, "item-3", successes[1].ID)
+
+	var foo *Foo
+	err := json.Unmarshal(successes[0].Resource, &foo)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *foo.Name)
+
+	failures := result.Failures()
+	assert.Len(t, failures, 3)
+	assert.Equal(t, "item-2", failures[0].ID)
+	assert.Equal(t, "item not found", failures[0].ErrorMessage)
+	assert.Nil(t, failures[0].Resource)
+	assert.Equal(t, "item already exists", failures[1].ErrorMessage)
+	assert.Equal(t, http.StatusText(http.StatusInternalServerError), failures[2].ErrorMessage)
+	assert.NotNil(t, failures[2].Raw["id"])
+}
+
+func TestParseMultiStatusResult(t *testing.T) {
+	result, err := ParseMultiStatusResult([]byte(multiStatusBody))
+	assert.Nil(t, err)
+	verifyMultiStatusResult(t, result)
+
+	// The items may also be supplied as a top-level JSON array.
+	result, err = ParseMultiStatusResult([]byte(`[{"status": 200}, {"status": 204}]`))
+	assert.Nil(t, err)
+	assert.Len(t, result.Items, 2)
+	assert.False(t, result.HasFailures())
+	assert.Len(t, result.Failures(), 0)
+
+	_, err = ParseMultiStatusResult([]byte(""))
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_MULTI_STATUS_BODY, "response body is empty"), err.Error())
+
+	_, err = ParseMultiStatusResult([]byte(`{"items": []}`))
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_MULTI_STATUS_BODY, "property 'results' not found"), err.Error())
+
+	_, err = ParseMultiStatusResult([]byte(`[{"status": "bad"}]`))
+	assert.NotNil(t, err)
+}
+
+func TestRequestMultiStatusResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, multiStatusBody)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	builder := NewRequestBuilder(POST)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	var rawResult map[string]json.RawMessage
+	detailedResponse, err := service.Request(req, &rawResult)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMultiStatus, detailedResponse.StatusCode)
+
+	result, err := detailedResponse.GetMultiStatusResult()
+	assert.Nil(t, err)
+	verifyMultiStatusResult(t, result)
+
+	// The result can also be obtained from the RawResult field.
+	detailedResponse = &DetailedResponse{StatusCode: http.StatusMultiStatus, RawResult: []byte(multiStatusBody)}
+	result, err = detailedResponse.GetMultiStatusResult()
+	assert.Nil(t, err)
+	verifyMultiStatusResult(t, result)
+
+	detailedResponse = &DetailedResponse{StatusCode: http.StatusMultiStatus}
+	_, err = detailedResponse.GetMultiStatusResult()
+	assert.NotNil(t, err)
+}
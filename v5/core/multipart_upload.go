@@ -0,0 +1,252 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults for the MultipartUploadOptions.
+const (
+	defaultMultipartPartSize      = 8 * 1024 * 1024
+	defaultMultipartConcurrency   = 4
+	defaultMultipartMaxRetries    = 3
+	defaultMultipartRetryInterval = time.Second
+)
+
+// UploadPart describes a part of a multipart upload.
+type UploadPart struct {
+	// The number of the part, starting at 1.
+	PartNumber int
+
+	// The size of the part in bytes.
+	Size int64
+
+	// The base64-encoded SHA-256 checksum of the part.
+	Checksum string
+
+	// The entity tag returned by the service for the uploaded part, if any.
+	ETag string
+}
+
+// MultipartPartRequestFunc returns the request that uploads "part", whose contents are "body".
+// It is invoked again for each retry of the part. The request typically includes the part's
+// checksum (e.g. in a header), so that the service can validate the part.
+type MultipartPartRequestFunc func(ctx context.Context, part *UploadPart, body []byte) (*http.Request, error)
+
+// MultipartCompleteRequestFunc returns the request that completes the upload from "parts",
+// which are in order of part number.
+type MultipartCompleteRequestFunc func(ctx context.Context, parts []*UploadPart) (*http.Request, error)
+
+// MultipartAbortRequestFunc returns the request that aborts the upload.
+type MultipartAbortRequestFunc func(ctx context.Context) (*http.Request, error)
+
+// MultipartUploadOptions holds the functions used by UploadMultipart() to construct the requests
+// that make up a multipart upload (which must already have been initiated), along with its configuration.
+type MultipartUploadOptions struct {
+	// The function used to construct the request that uploads a part [required].
+	NewPartRequest MultipartPartRequestFunc
+
+	// The function used to construct the request that completes the upload [required].
+	NewCompleteRequest MultipartCompleteRequestFunc
+
+	// The function used to construct the request that aborts the upload if it fails [optional].
+	NewAbortRequest MultipartAbortRequestFunc
+
+	// The size of each part (except the last); defaults to 8 MiB [optional].
+	PartSize int64
+
+	// The maximum number of parts uploaded concurrently; defaults to 4 [optional].
+	Concurrency int
+
+	// The maximum number of times that a part is retried after a retryable error
+	// (see IsRetryable()); defaults to 3 [optional].
+	MaxPartRetries int
+
+	// The interval before the first retry of a part, which is doubled for each subsequent retry;
+	// defaults to 1 second [optional].
+	RetryInterval time.Duration
+}
+
+// UploadMultipart splits the contents of "r" into parts, uploads them concurrently (retrying
+// each part as needed) and then completes the upload, unmarshalling the response of the
+// complete request into "result" (as with Request()). At most Concurrency parts are held
+// in memory at a time. If the upload fails, it is aborted (if NewAbortRequest is specified).
+func (service *BaseService) UploadMultipart(ctx context.Context, r io.Reader, options *MultipartUploadOptions,
+	result interface{}) (*DetailedResponse, error) {
+	if options.NewPartRequest == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "NewPartRequest")
+	}
+	if options.NewCompleteRequest == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "NewCompleteRequest")
+	}
+	opts := *options
+	if opts.PartSize <= 0 {
+		opts.PartSize = defaultMultipartPartSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultMultipartConcurrency
+	}
+	if opts.MaxPartRetries <= 0 {
+		opts.MaxPartRetries = defaultMultipartMaxRetries
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultMultipartRetryInterval
+	}
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var uploadErr error
+	var parts []*UploadPart
+	fail := func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if uploadErr == nil {
+			uploadErr = err
+			cancel()
+		}
+	}
+
+	// Read the parts sequentially, and upload them concurrently.
+	slots := make(chan struct{}, opts.Concurrency)
+	for partNumber := 1; ; partNumber++ {
+		select {
+		case slots <- struct{}{}:
+		case <-uploadCtx.Done():
+		}
+		if uploadCtx.Err() != nil {
+			break
+		}
+
+		body := make([]byte, opts.PartSize)
+		n, readErr := io.ReadFull(r, body)
+		if readErr == io.EOF && partNumber > 1 {
+			<-slots
+			break
+		}
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			<-slots
+			fail(readErr)
+			break
+		}
+		body = body[:n]
+		checksum := sha256.Sum256(body)
+		part := &UploadPart{
+			PartNumber: partNumber,
+			Size:       int64(n),
+			Checksum:   base64.StdEncoding.EncodeToString(checksum[:]),
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := service.uploadPart(uploadCtx, part, body, &opts); err != nil {
+				fail(err)
+				return
+			}
+			mutex.Lock()
+			parts = append(parts, part)
+			mutex.Unlock()
+		}()
+
+		// The last part was read.
+		if readErr != nil {
+			break
+		}
+	}
+	wg.Wait()
+
+	if uploadErr == nil && ctx.Err() != nil {
+		uploadErr = ctx.Err()
+	}
+	if uploadErr != nil {
+		service.abortMultipartUpload(&opts)
+		return nil, uploadErr
+	}
+
+	// Complete the upload.
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	req, err := opts.NewCompleteRequest(ctx, parts)
+	if err != nil {
+		service.abortMultipartUpload(&opts)
+		return nil, err
+	}
+	detailedResponse, err := service.Request(req, result)
+	if err != nil {
+		service.abortMultipartUpload(&opts)
+	}
+	return detailedResponse, err
+}
+
+// uploadPart uploads a part, retrying it after a retryable error.
+func (service *BaseService) uploadPart(ctx context.Context, part *UploadPart, body []byte,
+	options *MultipartUploadOptions) error {
+	interval := options.RetryInterval
+	for attempt := 0; ; attempt++ {
+		req, err := options.NewPartRequest(ctx, part, body)
+		if err != nil {
+			return err
+		}
+		detailedResponse, err := service.Request(req, nil)
+		if err == nil {
+			part.ETag = detailedResponse.Headers.Get(headerNameETag)
+			return nil
+		}
+		if !IsRetryable(err) || attempt >= options.MaxPartRetries {
+			return &wrappedError{
+				message: fmt.Sprintf(ERRORMSG_MULTIPART_PART, part.PartNumber, err.Error()),
+				cause:   err,
+			}
+		}
+		GetLogger().Debug("Retrying part %d of multipart upload after error: %s", part.PartNumber, err.Error())
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		interval *= 2
+	}
+}
+
+// abortMultipartUpload aborts the upload, if an abort request was specified.
+// The upload's context may already be done, so the abort request uses a background context.
+func (service *BaseService) abortMultipartUpload(options *MultipartUploadOptions) {
+	if options.NewAbortRequest == nil {
+		return
+	}
+	req, err := options.NewAbortRequest(context.Background())
+	if err == nil {
+		_, err = service.Request(req, nil)
+	}
+	if err != nil {
+		GetLogger().Warn("Unable to abort multipart upload: %s", err.Error())
+	}
+}
@@ -0,0 +1,188 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartTestServer simulates a service that supports multipart uploads.
+type multipartTestServer struct {
+	mutex     sync.Mutex
+	parts     map[int][]byte
+	attempts  map[int]int
+	failPart  int
+	failCode  int
+	completed string
+	aborted   bool
+}
+
+func (s *multipartTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == PUT && strings.HasPrefix(r.URL.Path, "/upload/parts/"):
+		partNumber, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/upload/parts/"))
+		s.attempts[partNumber]++
+		body, _ := ioutil.ReadAll(r.Body)
+		checksum := sha256.Sum256(body)
+		if r.Header.Get("X-Checksum-Sha256") != base64.StdEncoding.EncodeToString(checksum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if partNumber == s.failPart && (s.failCode != http.StatusServiceUnavailable || s.attempts[partNumber] == 1) {
+			w.WriteHeader(s.failCode)
+			return
+		}
+		s.parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+	case r.Method == POST && r.URL.Path == "/upload/complete":
+		var parts []map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&parts)
+		var object bytes.Buffer
+		for _, part := range parts {
+			partNumber := int(part["part"].(float64))
+			if part["etag"] != fmt.Sprintf(`"etag-%d"`, partNumber) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			object.Write(s.parts[partNumber])
+		}
+		s.completed = object.String()
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+		fmt.Fprintf(w, `{"size": %d}`, object.Len())
+	case r.Method == DELETE && r.URL.Path == "/upload":
+		s.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newMultipartUploadOptions(t *testing.T, url string) *MultipartUploadOptions {
+	newRequest := func(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+		builder := NewRequestBuilder(method).WithContext(ctx)
+		_, err := builder.ResolveRequestURL(url, path, nil)
+		assert.Nil(t, err)
+		if data, ok := body.([]byte); ok {
+			_, err = builder.SetBodyContentStream(bytes.NewReader(data))
+		} else if body != nil {
+			_, err = builder.SetBodyContentJSON(body)
+		}
+		assert.Nil(t, err)
+		return builder.Build()
+	}
+	return &MultipartUploadOptions{
+		NewPartRequest: func(ctx context.Context, part *UploadPart, body []byte) (*http.Request, error) {
+			req, err := newRequest(ctx, PUT, fmt.Sprintf("/upload/parts/%d", part.PartNumber), body)
+			if err == nil {
+				req.Header.Set("X-Checksum-Sha256", part.Checksum)
+			}
+			return req, err
+		},
+		NewCompleteRequest: func(ctx context.Context, parts []*UploadPart) (*http.Request, error) {
+			var body []map[string]interface{}
+			for _, part := range parts {
+				body = append(body, map[string]interface{}{"part": part.PartNumber, "etag": part.ETag})
+			}
+			return newRequest(ctx, POST, "/upload/complete", body)
+		},
+		NewAbortRequest: func(ctx context.Context) (*http.Request, error) {
+			return newRequest(ctx, DELETE, "/upload", nil)
+		},
+		PartSize:      10,
+		Concurrency:   3,
+		RetryInterval: time.Millisecond,
+	}
+}
+
+func TestUploadMultipart(t *testing.T) {
+	s := &multipartTestServer{parts: map[int][]byte{}, attempts: map[int]int{}, failPart: 2, failCode: http.StatusServiceUnavailable}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// The object is uploaded in 5 parts, one of which is retried.
+	object := strings.Repeat("abcdefghijklmnopqrstuvwxyz", 2)
+	var result map[string]interface{}
+	detailedResponse, err := service.UploadMultipart(context.Background(), strings.NewReader(object),
+		newMultipartUploadOptions(t, server.URL), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, detailedResponse.StatusCode)
+	assert.Equal(t, float64(len(object)), result["size"])
+	assert.Equal(t, object, s.completed)
+	assert.Len(t, s.parts, 6)
+	assert.Equal(t, 2, s.attempts[2])
+	assert.False(t, s.aborted)
+
+	// An empty object is uploaded as a single empty part.
+	s.parts = map[int][]byte{}
+	_, err = service.UploadMultipart(context.Background(), strings.NewReader(""), newMultipartUploadOptions(t, server.URL), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", s.completed)
+	assert.Len(t, s.parts, 1)
+}
+
+func TestUploadMultipartFailure(t *testing.T) {
+	s := &multipartTestServer{parts: map[int][]byte{}, attempts: map[int]int{}, failPart: 3, failCode: http.StatusBadRequest}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// A non-retryable part failure aborts the upload.
+	object := strings.Repeat("x", 100)
+	_, err = service.UploadMultipart(context.Background(), strings.NewReader(object), newMultipartUploadOptions(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "Unable to upload part 3: Bad Request", err.Error())
+	assert.Equal(t, http.StatusBadRequest, getStatusCode(err))
+	assert.Equal(t, 1, s.attempts[3])
+	assert.True(t, s.aborted)
+	assert.Equal(t, "", s.completed)
+
+	// A retryable failure is retried a limited number of times.
+	s.failCode = http.StatusInternalServerError
+	s.attempts = map[int]int{}
+	options := newMultipartUploadOptions(t, server.URL)
+	options.MaxPartRetries = 2
+	_, err = service.UploadMultipart(context.Background(), strings.NewReader(object), options, nil)
+	assert.Equal(t, http.StatusInternalServerError, getStatusCode(err))
+	assert.Equal(t, 3, s.attempts[3])
+
+	// The required functions must be specified.
+	_, err = service.UploadMultipart(context.Background(), strings.NewReader(object), &MultipartUploadOptions{}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,100 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// NDJSONIterator returns the next value to be sent in an NDJSON request body,
+// or io.EOF when there are no more values.
+type NDJSONIterator func() (interface{}, error)
+
+// NDJSONFromChannel returns an NDJSONIterator that returns the values received from "ch"
+// until it's closed.
+func NDJSONFromChannel(ch <-chan interface{}) NDJSONIterator {
+	return func() (interface{}, error) {
+		value, ok := <-ch
+		if !ok {
+			return nil, io.EOF
+		}
+		return value, nil
+	}
+}
+
+// SetBodyContentNDJSON sets the body content to a stream of newline-delimited JSON values, which
+// are obtained from "next" and encoded on the fly as the body is sent (e.g. to a log or metric
+// ingestion endpoint). A value is obtained only when the previous value has been consumed by the
+// connection, so a slow server applies backpressure to the producer of the values.
+// If "next" returns an error other than io.EOF, the request fails.
+//
+// The body is sent with chunked transfer encoding (see EnableChunkedUpload()), and a "Content-Type"
+// header of "application/x-ndjson" is added unless a content type was already specified.
+func (requestBuilder *RequestBuilder) SetBodyContentNDJSON(next NDJSONIterator) (*RequestBuilder, error) {
+	requestBuilder.Body = &ndjsonReader{next: next}
+	if requestBuilder.Header.Get(CONTENT_TYPE) == "" {
+		requestBuilder.AddHeader(CONTENT_TYPE, APPLICATION_NDJSON)
+	}
+	requestBuilder.chunkedUpload = true
+	return requestBuilder, nil
+}
+
+// ndjsonReader is an io.ReadCloser that encodes the values returned by an NDJSONIterator.
+// The values are encoded by a goroutine that is started by the first Read, and that stops
+// (after the current value is returned by the iterator) when the reader is closed.
+type ndjsonReader struct {
+	next  NDJSONIterator
+	once  sync.Once
+	pipeR *io.PipeReader
+}
+
+func (r *ndjsonReader) start() {
+	pipeR, pipeW := io.Pipe()
+	r.pipeR = pipeR
+	go func() {
+		encoder := json.NewEncoder(pipeW)
+		for {
+			value, err := r.next()
+			if err == io.EOF {
+				pipeW.Close() // #nosec G104
+				return
+			}
+			if err == nil {
+				err = encoder.Encode(value)
+			}
+			if err != nil {
+				pipeW.CloseWithError(err) // #nosec G104
+				return
+			}
+		}
+	}()
+}
+
+func (r *ndjsonReader) Read(p []byte) (int, error) {
+	r.once.Do(r.start)
+	return r.pipeR.Read(p)
+}
+
+func (r *ndjsonReader) Close() error {
+	// Ensure that the goroutine isn't started after the reader is closed.
+	r.once.Do(func() {})
+	if r.pipeR != nil {
+		return r.pipeR.Close()
+	}
+	return nil
+}
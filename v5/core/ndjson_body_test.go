@@ -0,0 +1,139 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type telemetryEvent struct {
+	Seq  int    `json:"seq"`
+	Kind string `json:"kind"`
+}
+
+func TestNDJSONRequestBody(t *testing.T) {
+	var received []telemetryEvent
+	var contentType string
+	var transferEncoding []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get(CONTENT_TYPE)
+		transferEncoding = r.TransferEncoding
+		received = nil
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var event telemetryEvent
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received = append(received, event)
+		}
+		if scanner.Err() != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newRequest := func(next NDJSONIterator) *http.Request {
+		builder := NewRequestBuilder(POST)
+		_, err := builder.ResolveRequestURL(server.URL, "/ingest", nil)
+		assert.Nil(t, err)
+		_, err = builder.SetBodyContentNDJSON(next)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// The events produced on a channel are streamed in a single request.
+	ch := make(chan interface{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			ch <- &telemetryEvent{Seq: i, Kind: "metric"}
+		}
+		close(ch)
+	}()
+	detailedResponse, err := service.Request(newRequest(NDJSONFromChannel(ch)), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusAccepted, detailedResponse.StatusCode)
+	assert.Len(t, received, 1000)
+	assert.Equal(t, telemetryEvent{Seq: 999, Kind: "metric"}, received[999])
+	assert.Equal(t, APPLICATION_NDJSON, contentType)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+
+	// An iterator error fails the request.
+	n := 0
+	_, err = service.Request(newRequest(func() (interface{}, error) {
+		if n++; n > 3 {
+			return nil, errors.New("producer failed")
+		}
+		return &telemetryEvent{Seq: n}, nil
+	}), nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "producer failed")
+
+	// A value that can't be encoded fails the request.
+	_, err = service.Request(newRequest(func() (interface{}, error) {
+		return func() {}, nil
+	}), nil)
+	assert.NotNil(t, err)
+}
+
+func TestNDJSONReaderClose(t *testing.T) {
+	// A reader that is closed before it's read never invokes the iterator.
+	invoked := false
+	r := &ndjsonReader{next: func() (interface{}, error) {
+		invoked = true
+		return nil, io.EOF
+	}}
+	assert.Nil(t, r.Close())
+	assert.False(t, invoked)
+
+	// A reader can be read to the end, then closed.
+	values := []interface{}{"a", map[string]int{"b": 1}}
+	r = &ndjsonReader{next: func() (interface{}, error) {
+		if len(values) == 0 {
+			return nil, io.EOF
+		}
+		value := values[0]
+		values = values[1:]
+		return value, nil
+	}}
+	var buf strings.Builder
+	_, err := io.Copy(&buf, r)
+	assert.Nil(t, err)
+	assert.Equal(t, "\"a\"\n{\"b\":1}\n", buf.String())
+	assert.Nil(t, r.Close())
+
+	// The content type can be specified explicitly.
+	builder, err := NewRequestBuilder(POST).AddHeader(CONTENT_TYPE, "application/jsonl").SetBodyContentNDJSON(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "application/jsonl", builder.Header.Get(CONTENT_TYPE))
+}
@@ -1,6 +1,6 @@
 package core
 
-// (C) Copyright IBM Corp. 2019.
+// (C) Copyright IBM Corp. 2019, 2021.
 //
 // Licensed under the Apache License, Version 2.0 (the "License");
 // you may not use this file except in compliance with the License.
@@ -15,18 +15,60 @@ package core
 // limitations under the License.
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 )
 
 // NoAuthAuthenticator is simply a placeholder implementation of the Authenticator interface
 // that performs no authentication. This might be useful in testing/debugging situations.
+//
+// To prevent unauthenticated requests from being sent to a production endpoint by accident
+// (e.g. due to a misconfiguration), a NoAuthAuthenticator can optionally report or reject
+// requests sent to a "remote" host, which is a host other than a local host (e.g. "localhost"
+// or a loopback address) that is not one of the AllowedHosts.
 type NoAuthAuthenticator struct {
+	// If true, a warning is logged (once per host) when a request is sent to a remote host [optional].
+	WarnOnRemoteHost bool
+
+	// A function invoked for each request sent to a remote host, for example
+	// to emit a metric [optional].
+	RemoteHostHandler func(request *http.Request)
+
+	// The hosts for which unauthenticated requests are acceptable, in addition to local hosts.
+	// Each entry is either a hostname or a wildcard that matches any subdomain (e.g. "*.example.com").
+	// If specified, requests sent to any other remote host are rejected with an error [optional].
+	AllowedHosts []string
 }
 
+// The remote hosts for which a warning has been logged.
+var loggedNoAuthHosts sync.Map
+
 func NewNoAuthAuthenticator() (*NoAuthAuthenticator, error) {
 	return &NoAuthAuthenticator{}, nil
 }
 
+// newNoAuthAuthenticatorFromMap constructs a new NoAuthAuthenticator instance from a map.
+// The NOAUTH_ALLOWED_HOSTS property holds a comma-separated list of allowed hosts.
+func newNoAuthAuthenticatorFromMap(properties map[string]string) (*NoAuthAuthenticator, error) {
+	if properties == nil {
+		return nil, fmt.Errorf(ERRORMSG_PROPS_MAP_NIL)
+	}
+
+	authenticator, err := NewNoAuthAuthenticator()
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range strings.Split(properties[PROPNAME_NOAUTH_ALLOWED_HOSTS], ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			authenticator.AllowedHosts = append(authenticator.AllowedHosts, host)
+		}
+	}
+	return authenticator, nil
+}
+
 func (NoAuthAuthenticator) AuthenticationType() string {
 	return AUTHTYPE_NOAUTH
 }
@@ -36,6 +78,38 @@ func (NoAuthAuthenticator) Validate() error {
 }
 
 func (this *NoAuthAuthenticator) Authenticate(request *http.Request) error {
-	// Nothing to do since we're not providing any authentication.
+	// Nothing to add since we're not providing any authentication, but check whether
+	// the request is being sent to a remote host.
+	if !this.WarnOnRemoteHost && this.RemoteHostHandler == nil && len(this.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host := request.URL.Hostname()
+	if isLocalHost(host) || isHostAllowed(host, this.AllowedHosts) {
+		return nil
+	}
+
+	if this.WarnOnRemoteHost {
+		if _, logged := loggedNoAuthHosts.LoadOrStore(strings.ToLower(host), true); !logged {
+			GetLogger().Warn("An unauthenticated request (NoAuthAuthenticator) is being sent to remote host '%s'", host)
+		}
+	}
+	if this.RemoteHostHandler != nil {
+		callSafely(PanicSourceNoAuthRemoteHostHook, func() { this.RemoteHostHandler(request) })
+	}
+	if len(this.AllowedHosts) > 0 {
+		return fmt.Errorf(ERRORMSG_NOAUTH_HOST_NOT_ALLOWED, host)
+	}
 	return nil
 }
+
+// isLocalHost returns true iff "host" is "localhost" (or a subdomain of "localhost")
+// or a loopback IP address.
+func isLocalHost(host string) bool {
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -17,6 +17,10 @@ package core
 // limitations under the License.
 
 import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +45,62 @@ func TestNoAuthAuthenticate(t *testing.T) {
 	_ = authenticator.Authenticate(request)
 	assert.Equal(t, request.Header.Get("Authorization"), "")
 }
+
+func TestNoAuthRemoteHost(t *testing.T) {
+	original := GetLogger()
+	defer SetLogger(original)
+	var buf bytes.Buffer
+	SetLogger(NewLogger(LevelWarn, log.New(&buf, "", 0), log.New(&buf, "", 0)))
+
+	newRequest := func(url string) *http.Request {
+		request, err := http.NewRequest(GET, url, nil)
+		assert.Nil(t, err)
+		return request
+	}
+
+	var reported []string
+	authenticator := &NoAuthAuthenticator{
+		WarnOnRemoteHost: true,
+		RemoteHostHandler: func(request *http.Request) {
+			reported = append(reported, request.URL.Host)
+		},
+	}
+
+	// Local hosts are not reported.
+	assert.Nil(t, authenticator.Authenticate(newRequest("http://localhost:8080/api")))
+	assert.Nil(t, authenticator.Authenticate(newRequest("http://127.0.0.1/api")))
+	assert.Nil(t, authenticator.Authenticate(newRequest("http://[::1]:9443/api")))
+	assert.Empty(t, reported)
+	assert.Empty(t, buf.String())
+
+	// Remote hosts are reported each time, but the warning is logged once per host.
+	assert.Nil(t, authenticator.Authenticate(newRequest("https://noauth-prod.example.com/api")))
+	assert.Nil(t, authenticator.Authenticate(newRequest("https://NOAUTH-PROD.example.com/api/v2")))
+	assert.Equal(t, []string{"noauth-prod.example.com", "NOAUTH-PROD.example.com"}, reported)
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("noauth-prod.example.com")))
+
+	// With an allowlist, other remote hosts are rejected.
+	reported = nil
+	authenticator.AllowedHosts = []string{"*.staging.example.com"}
+	assert.Nil(t, authenticator.Authenticate(newRequest("https://svc.staging.example.com/api")))
+	assert.Nil(t, authenticator.Authenticate(newRequest("http://localhost/api")))
+	err := authenticator.Authenticate(newRequest("https://noauth-prod.example.com/api"))
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Errorf(ERRORMSG_NOAUTH_HOST_NOT_ALLOWED, "noauth-prod.example.com").Error(), err.Error())
+	assert.Equal(t, []string{"noauth-prod.example.com"}, reported)
+}
+
+func TestNoAuthFromMap(t *testing.T) {
+	_, err := newNoAuthAuthenticatorFromMap(nil)
+	assert.NotNil(t, err)
+
+	authenticator, err := newNoAuthAuthenticatorFromMap(map[string]string{
+		PROPNAME_NOAUTH_ALLOWED_HOSTS: "dev.example.com, *.test.example.com,",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dev.example.com", "*.test.example.com"}, authenticator.AllowedHosts)
+
+	authenticator, err = newNoAuthAuthenticatorFromMap(map[string]string{})
+	assert.Nil(t, err)
+	assert.Empty(t, authenticator.AllowedHosts)
+}
@@ -0,0 +1,139 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// The reason reported by an OperationDeniedError for a request rejected in read-only mode.
+const operationDeniedReadOnly = "read-only mode"
+
+// OperationDeniedError is the error returned by BaseService.Request() for a request that
+// was not sent because the service is in read-only mode (see SetReadOnly()), or because the
+// operation is denied (see SetDeniedOperations()).
+type OperationDeniedError struct {
+	// The method and URL path of the request.
+	Method string
+	Path   string
+
+	// Either "read-only mode" or the denied operation that matched the request.
+	Reason string
+}
+
+func (e *OperationDeniedError) Error() string {
+	return fmt.Sprintf(ERRORMSG_OPERATION_DENIED, e.Method, e.Path, e.Reason)
+}
+
+// operationPattern matches an operation (or set of operations) by the method and URL path of its requests.
+type operationPattern struct {
+	// The method ("*" matches any method), and the pattern (see path.Match())
+	// that matches the URL path ("" matches any path).
+	method  string
+	pattern string
+
+	// The operation as specified by the user.
+	spec string
+}
+
+// parseOperationPattern parses an operation consisting of a method (or "*" for any method),
+// optionally followed by a pattern (in the syntax of path.Match()) that is matched against
+// the URL path of a request (e.g. "POST /v1/instances/*/reboot").
+func parseOperationPattern(operation string) (operationPattern, error) {
+	fields := strings.Fields(operation)
+	if len(fields) == 0 || len(fields) > 2 {
+		return operationPattern{}, fmt.Errorf(ERRORMSG_PROP_INVALID, "operation '"+operation+"'")
+	}
+	op := operationPattern{method: strings.ToUpper(fields[0]), spec: strings.Join(fields, " ")}
+	if len(fields) == 2 {
+		op.pattern = fields[1]
+		if _, err := path.Match(op.pattern, ""); err != nil {
+			return operationPattern{}, fmt.Errorf(ERRORMSG_PROP_INVALID, "operation '"+operation+"'")
+		}
+	}
+	return op, nil
+}
+
+// matches returns true iff "req" is a request for the operation.
+func (op operationPattern) matches(req *http.Request) bool {
+	if op.method != "*" && op.method != req.Method {
+		return false
+	}
+	if op.pattern != "" {
+		if matched, _ := path.Match(op.pattern, req.URL.Path); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// SetReadOnly enables or disables read-only mode, in which only GET and HEAD requests are sent.
+// Any other request is rejected (without being sent) with an OperationDeniedError, which
+// guarantees that the service can't be used to modify anything (e.g. by a tool run in audit mode).
+// Read-only mode can also be enabled via the "READ_ONLY" configuration property.
+func (service *BaseService) SetReadOnly(readOnly bool) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.readOnly = readOnly
+}
+
+// IsReadOnly returns true iff the service is in read-only mode.
+func (service *BaseService) IsReadOnly() bool {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return service.readOnly
+}
+
+// SetDeniedOperations sets the operations that may not be invoked: a request for any of
+// them is rejected (without being sent) with an OperationDeniedError.
+// Each operation consists of a method (or "*" for any method), optionally followed by
+// a pattern (in the syntax of path.Match()) that is matched against the request's URL path,
+// e.g. "DELETE", "POST /v1/instances/*/reboot" or "* /v1/admin/*".
+// Specify no operations to remove the denylist. The denylist can also be configured via
+// the "DENIED_OPERATIONS" configuration property (a comma-separated list of operations).
+func (service *BaseService) SetDeniedOperations(operations ...string) error {
+	var denied []operationPattern
+	for _, operation := range operations {
+		op, err := parseOperationPattern(operation)
+		if err != nil {
+			return err
+		}
+		denied = append(denied, op)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.deniedOperations = denied
+	return nil
+}
+
+// checkOperationAllowed returns an OperationDeniedError if "req" may not be sent.
+func checkOperationAllowed(req *http.Request, readOnly bool, denied []operationPattern) error {
+	if readOnly && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return &OperationDeniedError{Method: req.Method, Path: req.URL.Path, Reason: operationDeniedReadOnly}
+	}
+	for _, op := range denied {
+		if op.matches(req) {
+			return &OperationDeniedError{Method: req.Method, Path: req.URL.Path, Reason: op.spec}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyAndDeniedOperations(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	send := func(method string, path string) error {
+		builder := NewRequestBuilder(method)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		_, err = service.Request(req, nil)
+		return err
+	}
+
+	// In read-only mode, only GET and HEAD requests are sent.
+	assert.False(t, service.IsReadOnly())
+	service.SetReadOnly(true)
+	assert.True(t, service.IsReadOnly())
+	assert.Nil(t, send(GET, "/v1/instances"))
+	assert.Nil(t, send(HEAD, "/v1/instances"))
+	err = send(DELETE, "/v1/instances/1")
+	var deniedErr *OperationDeniedError
+	assert.True(t, errors.As(err, &deniedErr))
+	assert.Equal(t, &OperationDeniedError{Method: DELETE, Path: "/v1/instances/1", Reason: "read-only mode"}, deniedErr)
+	assert.Equal(t, "The operation 'DELETE /v1/instances/1' is not permitted (read-only mode)", err.Error())
+	assert.True(t, service.Clone().IsReadOnly())
+	assert.Equal(t, 2, requests)
+
+	// Denied operations are matched by method and path.
+	service.SetReadOnly(false)
+	assert.Nil(t, service.SetDeniedOperations("delete", "POST /v1/instances/*/reboot", "* /v1/admin/*"))
+	assert.NotNil(t, send(DELETE, "/v1/instances/1"))
+	assert.NotNil(t, send(POST, "/v1/instances/1/reboot"))
+	assert.Nil(t, send(POST, "/v1/instances/1/start"))
+	err = send(GET, "/v1/admin/users")
+	assert.True(t, errors.As(err, &deniedErr))
+	assert.Equal(t, "* /v1/admin/*", deniedErr.Reason)
+	assert.Equal(t, 3, requests)
+
+	assert.NotNil(t, service.SetDeniedOperations("POST /v1/[instances"))
+	assert.NotNil(t, service.SetDeniedOperations("POST /v1/instances extra"))
+	assert.Nil(t, service.SetDeniedOperations())
+	assert.Nil(t, send(DELETE, "/v1/instances/1"))
+}
+
+func TestConfigureServiceReadOnly(t *testing.T) {
+	os.Setenv("GUARDED_SERVICE_READ_ONLY", "true")
+	os.Setenv("GUARDED_SERVICE_DENIED_OPERATIONS", "GET /v1/secrets/*, * /v1/admin/*")
+	defer os.Unsetenv("GUARDED_SERVICE_READ_ONLY")
+	defer os.Unsetenv("GUARDED_SERVICE_DENIED_OPERATIONS")
+
+	service, err := NewBaseService(&ServiceOptions{URL: "https://example.com", Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.ConfigureService("guarded_service"))
+	assert.True(t, service.IsReadOnly())
+	assert.Len(t, service.deniedOperations, 2)
+
+	os.Setenv("GUARDED_SERVICE_READ_ONLY", "maybe")
+	assert.NotNil(t, service.ConfigureService("guarded_service"))
+}
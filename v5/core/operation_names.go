@@ -0,0 +1,138 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The placeholder that replaces an identifier within a sanitized URL path.
+const sanitizedPathSegment = "{id}"
+
+var (
+	// A regular expression to match a URL path segment that consists of digits, or is a UUID.
+	numericOrUUIDSegmentRe = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+	// A regular expression to match a URL path segment that is likely to be a generated identifier:
+	// a long hexadecimal string, or a long token that contains both letters and digits.
+	generatedIDSegmentRe = regexp.MustCompile(`^([0-9a-fA-F]{16,}|[A-Za-z0-9_.:-]{16,})$`)
+
+	// A regular expression to match a URL path segment that is a (possibly escaped) CRN.
+	crnSegmentRe = regexp.MustCompile(`^(?i)crn(:|%3a)`)
+)
+
+// The context key for the name set by RequestBuilder.WithOperationName().
+type operationNameKey struct{}
+
+// operationName is the name registered for an operation.
+type operationName struct {
+	operation operationPattern
+	name      string
+}
+
+// WithOperationName sets "name" as the name (e.g. "create_instance") of the operation invoked by the
+// http.Request instance that will be constructed by the Build() method, in place of any name
+// registered with BaseService.SetOperationName().
+func (requestBuilder *RequestBuilder) WithOperationName(name string) *RequestBuilder {
+	requestBuilder.operationName = name
+	return requestBuilder
+}
+
+// SetOperationName registers a human-friendly name (e.g. "create_instance") for an operation, so that
+// the metrics and traces recorded for the operation's requests (e.g. by a RequestEventHandler) can be
+// labeled by the name rather than by the request's URL path, which contains identifiers.
+//
+// The operation is specified as for SetOperationTimeout(), e.g. "POST /v2/instances" or
+// "GET /v2/instances/*". If several names match a request, the one that was registered first is used.
+// Registering an operation again replaces its name, and an empty name removes it.
+func (service *BaseService) SetOperationName(operation string, name string) error {
+	op, err := parseOperationPattern(operation)
+	if err != nil {
+		return err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	// Copy the names, which are never modified in place.
+	names := make([]operationName, 0, len(service.operationNames)+1)
+	replaced := false
+	for _, registered := range service.operationNames {
+		if registered.operation.method == op.method && registered.operation.pattern == op.pattern {
+			replaced = true
+			if name == "" {
+				continue
+			}
+			registered.name = name
+		}
+		names = append(names, registered)
+	}
+	if !replaced && name != "" {
+		names = append(names, operationName{operation: op, name: name})
+	}
+	service.operationNames = names
+	return nil
+}
+
+// GetOperationName returns the name of the operation invoked by "req": the name set with
+// RequestBuilder.WithOperationName(), or else the name registered with SetOperationName(), or else
+// the request's method and sanitized URL path (e.g. "GET /v2/instances/{id}"; see SanitizeOperationPath()).
+func (service *BaseService) GetOperationName(req *http.Request) string {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return findOperationName(service.operationNames, req)
+}
+
+// findOperationName returns the name of the operation invoked by "req" (see GetOperationName()).
+func findOperationName(names []operationName, req *http.Request) string {
+	if name, _ := req.Context().Value(operationNameKey{}).(string); name != "" {
+		return name
+	}
+	for _, registered := range names {
+		if registered.operation.matches(req) {
+			return registered.name
+		}
+	}
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	return req.Method + " " + SanitizeOperationPath(path)
+}
+
+// SanitizeOperationPath returns "path" with each segment that is likely to be an identifier
+// (e.g. a number, a UUID, a CRN or a long generated id) replaced by "{id}", so that it can be used
+// to label metrics without producing a distinct label for each resource.
+func SanitizeOperationPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isIdentifierSegment(segment) {
+			segments[i] = sanitizedPathSegment
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdentifierSegment returns true iff the URL path segment "segment" is likely to be an identifier.
+func isIdentifierSegment(segment string) bool {
+	if numericOrUUIDSegmentRe.MatchString(segment) || crnSegmentRe.MatchString(segment) {
+		return true
+	}
+	// A long token is an identifier only if it contains a digit (e.g. not "service_instances").
+	return generatedIDSegmentRe.MatchString(segment) && strings.ContainsAny(segment, "0123456789")
+}
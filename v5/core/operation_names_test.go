@@ -0,0 +1,119 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOperationNameTestRequest(t *testing.T, method string, path string) *http.Request {
+	req, err := http.NewRequest(method, "https://cloud.example.com"+path, nil)
+	assert.Nil(t, err)
+	return req
+}
+
+func TestSanitizeOperationPath(t *testing.T) {
+	assert.Equal(t, "/v2/instances", SanitizeOperationPath("/v2/instances"))
+	assert.Equal(t, "/v2/instances/{id}", SanitizeOperationPath("/v2/instances/12345"))
+	assert.Equal(t, "/v2/instances/{id}/keys/{id}",
+		SanitizeOperationPath("/v2/instances/0d3f8a6e-5b1c-4e2a-9f7d-3c2b1a0e9d8c/keys/9f86d081884c7d65"))
+	assert.Equal(t, "/v1/resources/{id}",
+		SanitizeOperationPath("/v1/resources/crn%3Av1%3Abluemix%3Apublic%3Acloud-object-storage%3Aglobal%3A%3A%3A"))
+	assert.Equal(t, "/v1/resources/{id}", SanitizeOperationPath("/v1/resources/r006-a1b2c3d4e5f6g7h8"))
+	assert.Equal(t, "/v1/service_instances/keys", SanitizeOperationPath("/v1/service_instances/keys"))
+	assert.Equal(t, "/", SanitizeOperationPath("/"))
+	assert.Equal(t, "", SanitizeOperationPath(""))
+
+	req := newOperationNameTestRequest(t, GET, "")
+	assert.Equal(t, "GET /", findOperationName(nil, req))
+}
+
+func TestSetOperationName(t *testing.T) {
+	service := newNoAuthTestService(t, "https://cloud.example.com")
+
+	assert.Nil(t, service.SetOperationName("POST /v2/instances", "create_instance"))
+	assert.Nil(t, service.SetOperationName("GET /v2/instances/*", "get_instance"))
+	assert.Nil(t, service.SetOperationName("* /v2/instances/*", "other"))
+	assert.NotNil(t, service.SetOperationName("", "invalid"))
+
+	assert.Equal(t, "create_instance", service.GetOperationName(newOperationNameTestRequest(t, POST, "/v2/instances")))
+	assert.Equal(t, "get_instance", service.GetOperationName(newOperationNameTestRequest(t, GET, "/v2/instances/12345")))
+	assert.Equal(t, "other", service.GetOperationName(newOperationNameTestRequest(t, DELETE, "/v2/instances/12345")))
+	assert.Equal(t, "GET /v1/instances/{id}", service.GetOperationName(newOperationNameTestRequest(t, GET, "/v1/instances/12345")))
+
+	// Registering an operation again replaces its name, and an empty name removes it.
+	assert.Nil(t, service.SetOperationName("POST /v2/instances", "create_service_instance"))
+	assert.Equal(t, "create_service_instance", service.GetOperationName(newOperationNameTestRequest(t, POST, "/v2/instances")))
+	assert.Nil(t, service.SetOperationName("GET /v2/instances/*", ""))
+	assert.Equal(t, "other", service.GetOperationName(newOperationNameTestRequest(t, GET, "/v2/instances/12345")))
+
+	// A clone shares the names, but not later registrations.
+	clone := service.Clone()
+	assert.Nil(t, service.SetOperationName("* /v2/instances/*", ""))
+	assert.Equal(t, "other", clone.GetOperationName(newOperationNameTestRequest(t, GET, "/v2/instances/12345")))
+	assert.Equal(t, "GET /v2/instances/{id}", service.GetOperationName(newOperationNameTestRequest(t, GET, "/v2/instances/12345")))
+}
+
+func TestWithOperationName(t *testing.T) {
+	service := newNoAuthTestService(t, "https://cloud.example.com")
+	assert.Nil(t, service.SetOperationName("GET /v2/instances/*", "get_instance"))
+
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/v2/instances/{id}", map[string]string{"id": "12345"})
+	assert.Nil(t, err)
+	req, err := builder.WithOperationName("get_service_instance").Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "get_service_instance", service.GetOperationName(req))
+}
+
+func TestOperationNameInRequestEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := &requestEventRecorder{}
+	service := newNoAuthTestService(t, server.URL)
+	service.SetRequestEventHandler(recorder.handle)
+
+	invoke := func() {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/v2/instances/{id}", map[string]string{"id": "12345"})
+		assert.Nil(t, err)
+		req, _ := builder.Build()
+		_, err = service.Request(req, nil)
+		assert.Nil(t, err)
+	}
+
+	invoke()
+	assert.NotEmpty(t, recorder.events)
+	for _, event := range recorder.events {
+		assert.Equal(t, "GET /v2/instances/{id}", event.Operation)
+	}
+
+	recorder.events = nil
+	assert.Nil(t, service.SetOperationName("GET /v2/instances/*", "get_instance"))
+	invoke()
+	assert.NotEmpty(t, recorder.events)
+	for _, event := range recorder.events {
+		assert.Equal(t, "get_instance", event.Operation)
+	}
+}
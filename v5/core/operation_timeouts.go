@@ -0,0 +1,89 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// operationTimeout is the timeout hint registered for an operation.
+type operationTimeout struct {
+	operation operationPattern
+	timeout   time.Duration
+}
+
+// SetOperationTimeout registers a timeout hint for an operation (e.g. a generated SDK might
+// specify that the operation that generates a report may take up to two minutes), which is used
+// as the request timeout (see WithRequestTimeout()) for each request for the operation whose
+// context specifies neither a request timeout nor a deadline.
+//
+// The operation consists of a method (or "*" for any method), optionally followed by a pattern
+// (in the syntax of path.Match()) that is matched against the request's URL path, e.g.
+// "POST /v1/reports" or "GET /v1/reports/*/content". The hint for "*" is therefore the default
+// timeout for all of the service's operations. If several hints match a request, the one that
+// was registered first is used, so hints for specific operations should be registered before
+// more general ones. Registering an operation again replaces its hint, and a timeout of 0
+// removes it. Note that the timeout configured on the service's HTTP client (if any) still applies.
+func (service *BaseService) SetOperationTimeout(operation string, timeout time.Duration) error {
+	op, err := parseOperationPattern(operation)
+	if err != nil {
+		return err
+	}
+	if timeout < 0 {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "timeout")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	// Copy the hints, which are never modified in place.
+	timeouts := make([]operationTimeout, 0, len(service.operationTimeouts)+1)
+	replaced := false
+	for _, hint := range service.operationTimeouts {
+		if hint.operation.method == op.method && hint.operation.pattern == op.pattern {
+			replaced = true
+			if timeout == 0 {
+				continue
+			}
+			hint.timeout = timeout
+		}
+		timeouts = append(timeouts, hint)
+	}
+	if !replaced && timeout > 0 {
+		timeouts = append(timeouts, operationTimeout{operation: op, timeout: timeout})
+	}
+	service.operationTimeouts = timeouts
+	return nil
+}
+
+// GetOperationTimeout returns the timeout hint that applies to "req", or 0 if there is none.
+func (service *BaseService) GetOperationTimeout(req *http.Request) time.Duration {
+	service.mutex.RLock()
+	defer service.mutex.RUnlock()
+
+	return findOperationTimeout(service.operationTimeouts, req)
+}
+
+// findOperationTimeout returns the first of "timeouts" that applies to "req", or 0 if there is none.
+func findOperationTimeout(timeouts []operationTimeout, req *http.Request) time.Duration {
+	for _, hint := range timeouts {
+		if hint.operation.matches(req) {
+			return hint.timeout
+		}
+	}
+	return 0
+}
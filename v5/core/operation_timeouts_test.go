@@ -0,0 +1,80 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperationTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/reports" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newRequest := func(ctx context.Context, method string, path string) *http.Request {
+		builder := NewRequestBuilder(method).WithContext(ctx)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	assert.NotNil(t, service.SetOperationTimeout("POST /v1/[reports", time.Second))
+	assert.NotNil(t, service.SetOperationTimeout("POST /v1/reports", -time.Second))
+	assert.Nil(t, service.SetOperationTimeout("post /v1/reports", 50*time.Millisecond))
+	assert.Nil(t, service.SetOperationTimeout("*", time.Minute))
+	assert.Equal(t, 50*time.Millisecond, service.GetOperationTimeout(newRequest(context.Background(), POST, "/v1/reports")))
+	assert.Equal(t, time.Minute, service.GetOperationTimeout(newRequest(context.Background(), GET, "/v1/reports")))
+
+	// The hint is used when the caller doesn't specify a timeout.
+	_, err = service.Request(newRequest(context.Background(), POST, "/v1/reports"), nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	_, err = service.Clone().Request(newRequest(context.Background(), POST, "/v1/reports"), nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	_, err = service.Request(newRequest(context.Background(), GET, "/v1/reports"), nil)
+	assert.Nil(t, err)
+
+	// The caller's request timeout or deadline takes precedence over the hint.
+	_, err = service.Request(newRequest(WithRequestTimeout(context.Background(), 5*time.Second), POST, "/v1/reports"), nil)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = service.Request(newRequest(ctx, POST, "/v1/reports"), nil)
+	assert.Nil(t, err)
+
+	// A hint can be replaced or removed.
+	assert.Nil(t, service.SetOperationTimeout("POST /v1/reports", 5*time.Second))
+	assert.Equal(t, 5*time.Second, service.GetOperationTimeout(newRequest(context.Background(), POST, "/v1/reports")))
+	assert.Nil(t, service.SetOperationTimeout("POST /v1/reports", 0))
+	assert.Equal(t, time.Minute, service.GetOperationTimeout(newRequest(context.Background(), POST, "/v1/reports")))
+	_, err = service.Request(newRequest(context.Background(), POST, "/v1/reports"), nil)
+	assert.Nil(t, err)
+}
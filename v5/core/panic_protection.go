@@ -0,0 +1,93 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// The sources of the panics recovered by the Go core library.
+const (
+	PanicSourceModelUnmarshaller    = "model unmarshaller"
+	PanicSourceResponseTransform    = "response transform"
+	PanicSourceResponseValidator    = "response validator"
+	PanicSourcePayloadSplitter      = "payload splitter"
+	PanicSourceRequestOption        = "request option"
+	PanicSourceAPIVersionProbe      = "API version probe"
+	PanicSourceRequestEventHandler  = "request event handler"
+	PanicSourceWarningHandler       = "warning handler"
+	PanicSourceDeprecationHandler   = "deprecation handler"
+	PanicSourceCanaryRouteHandler   = "canary route handler"
+	PanicSourceResponseAttestor     = "response attestor"
+	PanicSourceTokenRefreshHandler  = "token refresh handler"
+	PanicSourceTokenMetricsRecorder = "token metrics recorder"
+	PanicSourceNoAuthRemoteHostHook = "NoAuthAuthenticator remote host handler"
+)
+
+// PanicError is the error returned in place of a panic that occurred in a user-provided function
+// (e.g. a ResponseTransform) or a generated model unmarshaller, so that a single malformed response
+// or buggy hook can't crash a long-running process. A panic in a function that can't return an error
+// (e.g. a WarningHandler) is logged instead.
+type PanicError struct {
+	// The kind of function that panicked (e.g. PanicSourceResponseTransform).
+	Source string
+
+	// The value passed to panic().
+	Value interface{}
+
+	// The stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf(ERRORMSG_PANIC_RECOVERED, e.Source, e.Value)
+}
+
+// recoverPanic converts a panic (if any) into a PanicError, which is stored in "err" (if not nil)
+// and logged, along with its stack trace at debug level. It must be deferred directly, e.g.
+//
+//	defer recoverPanic(PanicSourceResponseTransform, &err)
+func recoverPanic(source string, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	panicErr := &PanicError{
+		Source: source,
+		Value:  value,
+		Stack:  debug.Stack(),
+	}
+	GetLogger().Error("%s", panicErr.Error())
+	if GetLogger().IsLogLevelEnabled(LevelDebug) {
+		GetLogger().Debug("Stack trace of the recovered panic:\n%s", string(panicErr.Stack))
+	}
+	if err != nil {
+		*err = panicErr
+	}
+}
+
+// callSafely invokes "hook", logging (rather than propagating) a panic that occurs in it.
+func callSafely(source string, hook func()) {
+	defer recoverPanic(source, nil)
+	hook()
+}
+
+// callSafelyWithError invokes "hook" and returns its error, or a PanicError if it panics.
+func callSafelyWithError(source string, hook func() error) (err error) {
+	defer recoverPanic(source, &err)
+	return hook()
+}
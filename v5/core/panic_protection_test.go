@@ -0,0 +1,108 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalModelPanic(t *testing.T) {
+	rawInput := map[string]json.RawMessage{
+		"name": json.RawMessage(`"wonder woman"`),
+	}
+	var result *Foo
+	err := UnmarshalModel(rawInput, "", &result, func(m map[string]json.RawMessage, result interface{}) error {
+		var names []string
+		_ = names[len(m)]
+		return nil
+	})
+	assert.NotNil(t, err)
+	panicErr, ok := err.(*PanicError)
+	assert.True(t, ok)
+	assert.Equal(t, PanicSourceModelUnmarshaller, panicErr.Source)
+	assert.Contains(t, panicErr.Error(), "A panic occurred in the model unmarshaller: runtime error: index out of range")
+	assert.Contains(t, string(panicErr.Stack), "TestUnmarshalModelPanic")
+	assert.Nil(t, result)
+}
+
+func TestHookPanics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Deprecation", "true")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	newRequest := func() *http.Request {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "", nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// A panic in a hook that can't return an error is logged, and doesn't affect the request.
+	hookInvocations := 0
+	service.SetRequestEventHandler(func(event *RequestEvent) {
+		hookInvocations++
+		panic("buggy event handler")
+	})
+	service.SetWarningHandler(func(warning Warning) {
+		hookInvocations++
+		panic("buggy warning handler")
+	})
+	service.SetDeprecationHandler(func(req *http.Request, info *DeprecationInfo) {
+		hookInvocations++
+		panic("buggy deprecation handler")
+	})
+	var foo *Foo
+	_, err = service.Request(newRequest(), &foo)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *foo.Name)
+	assert.True(t, hookInvocations > 2)
+
+	// A panic in a hook that can return an error fails the request.
+	service.AddResponseTransform(func(response *http.Response) error {
+		var transform ResponseTransform
+		return transform(response)
+	})
+	_, err = service.Request(newRequest(), &foo)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "A panic occurred in the response transform: runtime error: invalid memory address or nil pointer dereference")
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ApplyOptions(func(builder *RequestBuilder) error {
+		panic(fmt.Errorf("buggy option"))
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PANIC_RECOVERED, PanicSourceRequestOption, "buggy option"), err.Error())
+}
@@ -0,0 +1,93 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+)
+
+// The maximum number of times that a request (and its sub-requests) will be split.
+const maxPayloadSplitDepth = 16
+
+// PayloadSplitter is a function invoked when a request is rejected because it is too large
+// (i.e. a 413 Payload Too Large or 431 Request Header Fields Too Large response).
+// It returns the sub-requests that replace "req" (e.g. two requests that each contain
+// half of a batch of items), or nil if the payload can't be split further.
+// "detailedResponse" contains the response that rejected "req". The payload of a request
+// constructed by a RequestBuilder can be re-read via req.GetBody().
+type PayloadSplitter func(req *http.Request, detailedResponse *DetailedResponse) ([]*http.Request, error)
+
+// RequestWithSplitting invokes "req" like Request(), but if the request is rejected because
+// it is too large, "split" is invoked to split it into sub-requests, which are then invoked
+// in turn (and split again if they too are rejected), to a maximum depth of 16 splits.
+//
+// The "newResult" function returns the result argument (e.g. a **MyResult) to be passed
+// to Request() for each request; it may be nil if no result is expected.
+//
+// The DetailedResponse of each successful request is returned, in the order in which the
+// requests were split. If any requests fail, the remaining requests are still invoked and
+// their errors are returned as an ErrorCollection.
+func (service *BaseService) RequestWithSplitting(req *http.Request, newResult func() interface{},
+	split PayloadSplitter) ([]*DetailedResponse, error) {
+	errs := NewErrorCollection(nil)
+	responses := service.requestWithSplitting(req, newResult, split, 0, errs)
+	if errs.Len() == 1 {
+		return responses, errs.Errors()[0]
+	}
+	return responses, errs.Err()
+}
+
+// requestWithSplitting invokes "req", splitting it (at most "maxPayloadSplitDepth" - "depth"
+// more times) if it is rejected because it is too large. Errors are added to "errs".
+func (service *BaseService) requestWithSplitting(req *http.Request, newResult func() interface{},
+	split PayloadSplitter, depth int, errs *ErrorCollection) []*DetailedResponse {
+	var result interface{}
+	if newResult != nil {
+		result = newResult()
+	}
+
+	detailedResponse, err := service.Request(req, result)
+	if err == nil {
+		return []*DetailedResponse{detailedResponse}
+	}
+
+	statusCode := getStatusCode(err)
+	if split == nil || depth >= maxPayloadSplitDepth ||
+		(statusCode != http.StatusRequestEntityTooLarge && statusCode != http.StatusRequestHeaderFieldsTooLarge) {
+		errs.Add(err)
+		return nil
+	}
+
+	var subRequests []*http.Request
+	splitErr := callSafelyWithError(PanicSourcePayloadSplitter, func() (err error) {
+		subRequests, err = split(req, detailedResponse)
+		return
+	})
+	if splitErr != nil {
+		errs.Add(splitErr)
+		return nil
+	}
+	if len(subRequests) == 0 {
+		errs.Add(err)
+		return nil
+	}
+	GetLogger().Debug("Request rejected with status code %d; retrying as %d sub-requests", statusCode, len(subRequests))
+
+	var responses []*DetailedResponse
+	for _, subRequest := range subRequests {
+		responses = append(responses, service.requestWithSplitting(subRequest, newResult, split, depth+1, errs)...)
+	}
+	return responses
+}
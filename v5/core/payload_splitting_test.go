@@ -0,0 +1,161 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ingestResult struct {
+	Count int `json:"count"`
+}
+
+// newIngestRequest returns a request whose body is a JSON array of "items".
+func newIngestRequest(t *testing.T, url string, items []string) *http.Request {
+	builder := NewRequestBuilder(POST)
+	_, err := builder.ResolveRequestURL(url, "/ingest", nil)
+	assert.Nil(t, err)
+	_, err = builder.SetBodyContentJSON(items)
+	assert.Nil(t, err)
+	builder.AddHeader(CONTENT_TYPE, APPLICATION_JSON)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+// halvingSplitter returns a PayloadSplitter that splits a request's JSON array in half.
+func halvingSplitter(t *testing.T, url string) PayloadSplitter {
+	return func(req *http.Request, detailedResponse *DetailedResponse) ([]*http.Request, error) {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		var items []string
+		if err = json.NewDecoder(body).Decode(&items); err != nil {
+			return nil, err
+		}
+		if len(items) < 2 {
+			return nil, nil
+		}
+		half := len(items) / 2
+		return []*http.Request{
+			newIngestRequest(t, url, items[:half]),
+			newIngestRequest(t, url, items[half:]),
+		}, nil
+	}
+}
+
+func TestRequestWithSplitting(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var items []string
+		_ = json.NewDecoder(r.Body).Decode(&items)
+		if len(items) > 3 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		for _, item := range items {
+			if item == "bad" {
+				w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error": "bad item"}`)
+				return
+			}
+		}
+		batches = append(batches, len(items))
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+		fmt.Fprintf(w, `{"count": %d}`, len(items))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newResult := func() interface{} {
+		var result *ingestResult
+		return &result
+	}
+
+	// A batch of 10 items is split into batches of 2 or 3 items.
+	items := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	responses, err := service.RequestWithSplitting(newIngestRequest(t, server.URL, items), newResult, halvingSplitter(t, server.URL))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 3, 2, 3}, batches)
+	total := 0
+	for _, response := range responses {
+		total += response.Result.(*ingestResult).Count
+	}
+	assert.Equal(t, 10, total)
+
+	// The errors of failed sub-requests are aggregated, while the other sub-requests succeed.
+	batches = nil
+	items = []string{"a", "bad", "c", "d", "e", "f", "g", "bad"}
+	responses, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, items), newResult, halvingSplitter(t, server.URL))
+	assert.NotNil(t, err)
+	assert.Len(t, responses, 2)
+	assert.Equal(t, []int{2, 2}, batches)
+	var collection *ErrorCollection
+	assert.True(t, errors.As(err, &collection))
+	assert.Equal(t, 2, collection.Len())
+
+	// Without a splitter (or if the payload can't be split), the original error is returned.
+	_, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, items), nil, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, getStatusCode(err))
+	noSplit := func(req *http.Request, detailedResponse *DetailedResponse) ([]*http.Request, error) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, detailedResponse.StatusCode)
+		return nil, nil
+	}
+	_, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, items), nil, noSplit)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, getStatusCode(err))
+
+	// A splitter error is returned.
+	failingSplit := func(req *http.Request, detailedResponse *DetailedResponse) ([]*http.Request, error) {
+		return nil, errors.New("unable to split")
+	}
+	_, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, items), nil, failingSplit)
+	assert.Equal(t, "unable to split", err.Error())
+
+	// Other errors are not split.
+	_, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, []string{"bad"}), nil, failingSplit)
+	assert.Equal(t, http.StatusBadRequest, getStatusCode(err))
+}
+
+func TestRequestWithSplittingMaxDepth(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// A splitter that never reduces the request is invoked at most maxPayloadSplitDepth times.
+	split := func(req *http.Request, detailedResponse *DetailedResponse) ([]*http.Request, error) {
+		return []*http.Request{newIngestRequest(t, server.URL, nil)}, nil
+	}
+	_, err = service.RequestWithSplitting(newIngestRequest(t, server.URL, nil), nil, split)
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, getStatusCode(err))
+	assert.Equal(t, maxPayloadSplitDepth+1, requests)
+}
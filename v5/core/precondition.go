@@ -0,0 +1,127 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	headerNameIfMatch     = "If-Match"
+	headerNameIfNoneMatch = "If-None-Match"
+)
+
+// The preconditions that can be applied to a request by CreateOnly() and UpdateOnly().
+const (
+	preconditionCreateOnly = "create-only"
+	preconditionUpdateOnly = "update-only"
+)
+
+// preconditionKey is the context key used to associate a precondition with a request.
+type preconditionKey struct{}
+
+var (
+	// ErrAlreadyExists is matched (via errors.Is()) by the error returned for a CreateOnly()
+	// request that failed because the resource already exists.
+	ErrAlreadyExists = errors.New("the resource already exists")
+
+	// ErrModified is matched (via errors.Is()) by the error returned for an UpdateOnly()
+	// request that failed because the resource was modified (or deleted) since it was retrieved.
+	ErrModified = errors.New("the resource was modified")
+)
+
+// PreconditionError is the error returned for a CreateOnly() or UpdateOnly() request
+// that failed because its precondition was not met (i.e. a 412 Precondition Failed
+// response, or a 409 Conflict response to a CreateOnly() request, which some services
+// return when the resource already exists).
+// It matches ErrAlreadyExists or ErrModified (via errors.Is()), and wraps the HTTPError.
+type PreconditionError struct {
+	// ErrAlreadyExists or ErrModified.
+	Reason error
+
+	// The current entity tag of the resource, if the response contains one.
+	ETag string
+
+	// The error returned for the response.
+	Err *HTTPError
+}
+
+func (e *PreconditionError) Error() string {
+	return e.Reason.Error() + ": " + e.Err.Error()
+}
+
+// Is returns true iff "target" is the reason for the error.
+func (e *PreconditionError) Is(target error) bool {
+	return target == e.Reason
+}
+
+// Unwrap returns the HTTPError returned for the response.
+func (e *PreconditionError) Unwrap() error {
+	return e.Err
+}
+
+// CreateOnly adds an "If-None-Match: *" header, so that the request (e.g. a PUT) creates
+// the resource only if it doesn't already exist. If the resource already exists, the
+// error returned by BaseService.Request() is a PreconditionError that matches ErrAlreadyExists.
+func (requestBuilder *RequestBuilder) CreateOnly() *RequestBuilder {
+	requestBuilder.precondition = preconditionCreateOnly
+	return requestBuilder.AddHeader(headerNameIfNoneMatch, "*")
+}
+
+// UpdateOnly adds an "If-Match: <etag>" header, so that the request (e.g. a PUT or PATCH)
+// updates the resource only if its current entity tag is "etag" (i.e. it hasn't been modified
+// since it was retrieved). Otherwise, the error returned by BaseService.Request() is a
+// PreconditionError that matches ErrModified. An error is returned if "etag" is empty.
+func (requestBuilder *RequestBuilder) UpdateOnly(etag string) (*RequestBuilder, error) {
+	if etag == "" {
+		return requestBuilder, fmt.Errorf(ERRORMSG_PROP_MISSING, "etag")
+	}
+	requestBuilder.precondition = preconditionUpdateOnly
+	return requestBuilder.AddHeader(headerNameIfMatch, etag), nil
+}
+
+// newPreconditionError returns a PreconditionError if "err" indicates that the precondition
+// associated with "req" was not met, or "err" otherwise.
+func newPreconditionError(req *http.Request, err error) error {
+	precondition, _ := req.Context().Value(preconditionKey{}).(string)
+	if precondition == "" || err == nil {
+		return err
+	}
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return err
+	}
+	// A 409 Conflict response to other requests (e.g. an UpdateOnly() request rejected
+	// because of a conflict with another resource) doesn't concern the precondition.
+	createOnly := precondition == preconditionCreateOnly && req.Header.Get(headerNameIfNoneMatch) == "*"
+	if httpErr.StatusCode != http.StatusPreconditionFailed && !(httpErr.StatusCode == http.StatusConflict && createOnly) {
+		return err
+	}
+
+	preconditionErr := &PreconditionError{
+		Reason: ErrModified,
+		Err:    httpErr,
+	}
+	if precondition == preconditionCreateOnly {
+		preconditionErr.Reason = ErrAlreadyExists
+	}
+	if httpErr.Response != nil && httpErr.Response.Headers != nil {
+		preconditionErr.ETag = httpErr.Response.Headers.Get(headerNameETag)
+	}
+	return preconditionErr
+}
@@ -0,0 +1,136 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOnlyUpdateOnly(t *testing.T) {
+	etag := `"v1"`
+	exists := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if value := r.Header.Get("If-Match"); value != "" && (!exists || value != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		exists = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newRequest := func(decorate func(*RequestBuilder) *RequestBuilder) *http.Request {
+		builder := NewRequestBuilder(PUT)
+		_, err := builder.ResolveRequestURL(server.URL, "/resources/1", nil)
+		assert.Nil(t, err)
+		req, err := decorate(builder).Build()
+		assert.Nil(t, err)
+		return req
+	}
+	createOnly := func(builder *RequestBuilder) *RequestBuilder { return builder.CreateOnly() }
+	updateOnly := func(etag string) func(*RequestBuilder) *RequestBuilder {
+		return func(builder *RequestBuilder) *RequestBuilder {
+			_, err := builder.UpdateOnly(etag)
+			assert.Nil(t, err)
+			return builder
+		}
+	}
+
+	// The first create succeeds, the second fails because the resource exists.
+	_, err = service.Request(newRequest(createOnly), nil)
+	assert.Nil(t, err)
+	_, err = service.Request(newRequest(createOnly), nil)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	assert.False(t, errors.Is(err, ErrModified))
+	var preconditionErr *PreconditionError
+	assert.True(t, errors.As(err, &preconditionErr))
+	assert.Equal(t, `"v1"`, preconditionErr.ETag)
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusPreconditionFailed, httpErr.StatusCode)
+
+	// An update with the current ETag succeeds, one with a stale ETag fails.
+	_, err = service.Request(newRequest(updateOnly(`"v1"`)), nil)
+	assert.Nil(t, err)
+	etag = `"v2"`
+	_, err = service.Request(newRequest(updateOnly(`"v1"`)), nil)
+	assert.True(t, errors.Is(err, ErrModified))
+	assert.False(t, errors.Is(err, ErrAlreadyExists))
+	assert.True(t, errors.As(err, &preconditionErr))
+	assert.Equal(t, `"v2"`, preconditionErr.ETag)
+
+	// Without a precondition, the HTTPError is returned as is.
+	_, err = service.Request(newRequest(func(builder *RequestBuilder) *RequestBuilder {
+		return builder.AddHeader("If-Match", `"v1"`)
+	}), nil)
+	assert.False(t, errors.As(err, &preconditionErr))
+	assert.True(t, errors.As(err, &httpErr))
+
+	// An empty ETag is rejected, rather than sent as an empty If-Match header.
+	builder := NewRequestBuilder(PUT)
+	_, err = builder.UpdateOnly("")
+	assert.NotNil(t, err)
+	assert.Equal(t, "", builder.precondition)
+	assert.Empty(t, builder.Header.Values("If-Match"))
+}
+
+func TestPreconditionErrorOtherStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	builder := NewRequestBuilder(PUT).CreateOnly()
+	_, err = builder.ResolveRequestURL(server.URL, "/resources/1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "*", builder.Header.Get("If-None-Match"))
+	req, err := builder.Build()
+	assert.Nil(t, err)
+
+	// A 409 Conflict response to a create-only request also indicates that the precondition wasn't met.
+	_, err = service.Request(req, nil)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	assert.Contains(t, err.Error(), ErrAlreadyExists.Error())
+
+	// But not for an update-only request.
+	builder, err = NewRequestBuilder(PUT).UpdateOnly(`"v1"`)
+	assert.Nil(t, err)
+	_, err = builder.ResolveRequestURL(server.URL, "/resources/1", nil)
+	assert.Nil(t, err)
+	req, err = builder.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(req, nil)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrModified))
+	var preconditionErr *PreconditionError
+	assert.False(t, errors.As(err, &preconditionErr))
+	assert.Equal(t, http.StatusConflict, getStatusCode(err))
+}
@@ -0,0 +1,154 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The response headers that contain quota and entitlement information.
+// The limit and remaining headers may also be qualified with a resource name
+// (e.g. "X-Quota-Remaining-Instances: 3").
+const (
+	headerNameQuotaLimit     = "X-Quota-Limit"
+	headerNameQuotaRemaining = "X-Quota-Remaining"
+	headerNameQuotaReset     = "X-Quota-Reset"
+	headerNamePlanID         = "X-Plan-Id"
+)
+
+// ResourceQuota holds the limit and remaining amount of a quota.
+type ResourceQuota struct {
+	// The maximum amount allowed by the plan, if specified.
+	Limit *int64
+
+	// The amount remaining, if specified.
+	Remaining *int64
+}
+
+// QuotaInfo holds the quota and entitlement information contained in the
+// "X-Quota-*" and "X-Plan-Id" headers of an operation response.
+type QuotaInfo struct {
+	// The plan (entitlement) associated with the account, if specified by the "X-Plan-Id" header.
+	Plan string
+
+	// The overall quota, as specified by the "X-Quota-Limit" and "X-Quota-Remaining" headers.
+	ResourceQuota
+
+	// The time at which the quota is reset, if specified by the "X-Quota-Reset" header.
+	// The header may contain an HTTP-date or the number of seconds since the epoch.
+	Reset *time.Time
+
+	// The quotas of individual resources, keyed by the lowercase resource name.
+	// For example, the "X-Quota-Remaining-Instances" header yields the
+	// Remaining value of the "instances" entry.
+	Resources map[string]*ResourceQuota
+}
+
+// parseQuotaInfo returns the quota and entitlement information contained in "header",
+// or nil if "header" contains no such information.
+// Header values that cannot be parsed are ignored.
+func parseQuotaInfo(header http.Header) *QuotaInfo {
+	info := &QuotaInfo{}
+	found := false
+
+	for name, values := range header {
+		if len(values) == 0 {
+			continue
+		}
+		name = http.CanonicalHeaderKey(name)
+		value := strings.TrimSpace(values[0])
+
+		switch {
+		case name == headerNamePlanID:
+			info.Plan = value
+			found = true
+		case name == headerNameQuotaReset:
+			if reset := parseQuotaReset(value); reset != nil {
+				info.Reset = reset
+				found = true
+			}
+		default:
+			quota, target := info.resourceQuotaForHeader(name)
+			if quota == nil {
+				continue
+			}
+			if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+				*target(quota) = &n
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	for resource, quota := range info.Resources {
+		if quota.Limit == nil && quota.Remaining == nil {
+			delete(info.Resources, resource)
+		}
+	}
+	return info
+}
+
+// resourceQuotaForHeader returns the ResourceQuota to which the header named "name" applies,
+// along with a function that selects the field to be set, or nil if "name" is not a quota header.
+func (info *QuotaInfo) resourceQuotaForHeader(name string) (*ResourceQuota, func(*ResourceQuota) **int64) {
+	var target func(*ResourceQuota) **int64
+	var prefix string
+	if strings.HasPrefix(name, headerNameQuotaLimit) {
+		prefix = headerNameQuotaLimit
+		target = func(quota *ResourceQuota) **int64 { return &quota.Limit }
+	} else if strings.HasPrefix(name, headerNameQuotaRemaining) {
+		prefix = headerNameQuotaRemaining
+		target = func(quota *ResourceQuota) **int64 { return &quota.Remaining }
+	} else {
+		return nil, nil
+	}
+
+	resource := name[len(prefix):]
+	if resource == "" {
+		return &info.ResourceQuota, target
+	}
+	if !strings.HasPrefix(resource, "-") || len(resource) == 1 {
+		return nil, nil
+	}
+
+	resource = strings.ToLower(resource[1:])
+	if info.Resources == nil {
+		info.Resources = make(map[string]*ResourceQuota)
+	}
+	quota, ok := info.Resources[resource]
+	if !ok {
+		quota = &ResourceQuota{}
+		info.Resources[resource] = quota
+	}
+	return quota, target
+}
+
+// parseQuotaReset parses the value of the "X-Quota-Reset" header, which may contain
+// an HTTP-date or the number of seconds since the epoch.
+func parseQuotaReset(value string) *time.Time {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(seconds, 0).UTC()
+		return &t
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return &t
+	}
+	return nil
+}
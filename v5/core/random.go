@@ -0,0 +1,147 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+)
+
+// RandomSource is the source of randomness used by the Go core library
+// (e.g. for backoff jitter and random ids such as correlation ids and idempotency keys).
+// Users of the library can supply their own implementation by calling SetRandomSource(),
+// for example to make tests deterministic.
+// Implementations must be safe for concurrent use.
+type RandomSource interface {
+	// Int63n returns a non-negative random number in the half-open interval [0,n).
+	// It panics if n <= 0.
+	Int63n(n int64) int64
+
+	// Read fills "p" with random bytes.
+	Read(p []byte) (n int, err error)
+}
+
+// cryptoRandomSource is a RandomSource backed by crypto/rand.
+type cryptoRandomSource struct{}
+
+// NewCryptoRandomSource returns a RandomSource backed by the cryptographically secure
+// random number generator (crypto/rand). This is the default RandomSource.
+func NewCryptoRandomSource() RandomSource {
+	return cryptoRandomSource{}
+}
+
+func (cryptoRandomSource) Int63n(n int64) int64 {
+	if n <= 0 {
+		panic("invalid argument to Int63n")
+	}
+
+	// Discard values from the incomplete final range, to avoid modulo bias.
+	max := int64((1<<63 - 1) - (1<<63)%uint64(n))
+	var buf [8]byte
+	for {
+		if _, err := cryptorand.Read(buf[:]); err != nil {
+			panic(fmt.Sprintf("crypto/rand failure: %s", err.Error()))
+		}
+		v := int64(binary.BigEndian.Uint64(buf[:]) & (1<<63 - 1))
+		if v <= max {
+			return v % n
+		}
+	}
+}
+
+func (cryptoRandomSource) Read(p []byte) (int, error) {
+	return cryptorand.Read(p)
+}
+
+// seededRandomSource is a deterministic RandomSource backed by math/rand.
+type seededRandomSource struct {
+	mutex sync.Mutex
+	rand  *mathrand.Rand
+}
+
+// NewSeededRandomSource returns a deterministic RandomSource that produces the same
+// sequence of values for a given seed. It is intended for use in tests and
+// must not be used to generate security-sensitive values.
+func NewSeededRandomSource(seed int64) RandomSource {
+	return &seededRandomSource{
+		rand: mathrand.New(mathrand.NewSource(seed)), // #nosec G404
+	}
+}
+
+func (s *seededRandomSource) Int63n(n int64) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rand.Int63n(n)
+}
+
+func (s *seededRandomSource) Read(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.rand.Read(p)
+}
+
+// randomSource holds the RandomSource used by the Go core library.
+var randomSource RandomSource = NewCryptoRandomSource()
+
+// Guards 'randomSource' so that it can be replaced while it is in use.
+var randomSourceMutex sync.RWMutex
+
+// SetRandomSource sets the RandomSource to be used by the Go core library.
+// A nil value restores the default (crypto/rand-based) RandomSource.
+func SetRandomSource(source RandomSource) {
+	if source == nil {
+		source = NewCryptoRandomSource()
+	}
+
+	randomSourceMutex.Lock()
+	defer randomSourceMutex.Unlock()
+
+	randomSource = source
+}
+
+// GetRandomSource returns the RandomSource currently used by the Go core library.
+func GetRandomSource() RandomSource {
+	randomSourceMutex.RLock()
+	defer randomSourceMutex.RUnlock()
+
+	return randomSource
+}
+
+// NewRandomID returns a random (version 4) UUID obtained from the current RandomSource,
+// suitable for use as a correlation id or idempotency key.
+func NewRandomID() string {
+	var b [16]byte
+	if _, err := GetRandomSource().Read(b[:]); err != nil {
+		panic(fmt.Sprintf("random source failure: %s", err.Error()))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// jitter returns a random duration in the interval [d/2, d], obtained from the current
+// RandomSource, so that the retries of many clients are spread out over time.
+func jitter(d int64) int64 {
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + GetRandomSource().Int63n(d-half+1)
+}
@@ -0,0 +1,87 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeededRandomSource(t *testing.T) {
+	defer SetRandomSource(nil)
+
+	SetRandomSource(NewSeededRandomSource(42))
+	id1 := NewRandomID()
+	n1 := GetRandomSource().Int63n(1000)
+
+	SetRandomSource(NewSeededRandomSource(42))
+	assert.Equal(t, id1, NewRandomID())
+	assert.Equal(t, n1, GetRandomSource().Int63n(1000))
+
+	SetRandomSource(nil)
+	_, ok := GetRandomSource().(cryptoRandomSource)
+	assert.True(t, ok)
+}
+
+func TestCryptoRandomSource(t *testing.T) {
+	source := NewCryptoRandomSource()
+	for i := 0; i < 100; i++ {
+		n := source.Int63n(10)
+		assert.True(t, n >= 0 && n < 10)
+	}
+	assert.Equal(t, int64(0), source.Int63n(1))
+	assert.Panics(t, func() { source.Int63n(0) })
+
+	buf := make([]byte, 16)
+	n, err := source.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, n)
+}
+
+func TestNewRandomID(t *testing.T) {
+	uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id := NewRandomID()
+	assert.True(t, uuidRe.MatchString(id), id)
+	assert.NotEqual(t, id, NewRandomID())
+}
+
+func TestBackoffJitter(t *testing.T) {
+	defer SetRandomSource(nil)
+
+	min := 100 * time.Millisecond
+	max := 10 * time.Second
+	for attempt := 0; attempt < 5; attempt++ {
+		// The exponential backoff without jitter.
+		full := min * time.Duration(1<<uint(attempt))
+		for i := 0; i < 20; i++ {
+			wait := IBMCloudSDKBackoffPolicy(min, max, attempt, nil)
+			assert.True(t, wait >= min && wait >= full/2 && wait <= full, wait)
+		}
+	}
+
+	// The jitter is deterministic with a seeded random source.
+	SetRandomSource(NewSeededRandomSource(7))
+	wait1 := IBMCloudSDKBackoffPolicy(min, max, 3, nil)
+	SetRandomSource(NewSeededRandomSource(7))
+	assert.Equal(t, wait1, IBMCloudSDKBackoffPolicy(min, max, 3, nil))
+
+	assert.Equal(t, int64(0), jitter(0))
+	assert.Equal(t, int64(1), jitter(1))
+}
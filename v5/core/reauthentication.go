@@ -0,0 +1,88 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// SetReauthenticateOnAuthFailure specifies whether a request that is rejected with a
+// 401 Unauthorized response is sent again (exactly once) with a new access token, since
+// a token may be revoked by the server before it expires. The cached token is discarded
+// before the request is re-authenticated. A 403 Forbidden response (i.e. the token is valid,
+// but doesn't grant access to the resource) is returned as is.
+//
+// The request is re-sent only if the service's authenticator manages access tokens
+// (e.g. an IamAuthenticator), its body (if any) can be re-read via req.GetBody() (which is
+// the case for a request constructed by a RequestBuilder, unless it is a chunked upload),
+// and retries haven't been disabled via the request's context (see WithRetryDisabled()).
+// Since the rejected request was not processed by the service, re-sending it is safe
+// even for an operation that isn't idempotent.
+func (service *BaseService) SetReauthenticateOnAuthFailure(enabled bool) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.reauthenticate = enabled
+}
+
+// managesTokens returns true iff "authenticator" caches access tokens that can be invalidated.
+func managesTokens(authenticator Authenticator) bool {
+	if composite, ok := authenticator.(*CompositeAuthenticator); ok {
+		return composite.managesTokens()
+	}
+	if multi, ok := authenticator.(*MultiAuthenticator); ok {
+		return multi.managesTokens()
+	}
+	_, ok := authenticator.(TokenInvalidator)
+	return ok
+}
+
+// newReauthenticatedRequest returns a copy of "req" that is authenticated with a new access token,
+// to be sent in place of "req" after it was rejected with "resp", or nil if it shouldn't be re-sent.
+// If a copy is returned, the body of "resp" is closed.
+func newReauthenticatedRequest(req *http.Request, resp *http.Response, authenticator Authenticator) (*http.Request, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, nil
+	}
+	if isRetryDisabled(req.Context()) || isChunkedUpload(req) {
+		return nil, nil
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return nil, nil
+	}
+	if !managesTokens(authenticator) {
+		return nil, nil
+	}
+	authenticator.(TokenInvalidator).InvalidateToken()
+
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retryReq.Body = body
+	}
+	if err := authenticator.Authenticate(retryReq); err != nil {
+		return nil, err
+	}
+
+	GetLogger().Debug("Request rejected with status code %d; retrying with a new access token", resp.StatusCode)
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close() // #nosec G104
+	return retryReq, nil
+}
@@ -0,0 +1,205 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newReauthTestServers returns a token server that issues "token-1", "token-2", etc., and
+// a service that rejects requests with a 401 response unless they carry "validToken".
+func newReauthTestServers(validToken *string) (*httptest.Server, *httptest.Server, *[]string) {
+	issued := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			issued, GetCurrentTime()+3600)
+	}))
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, r.Header.Get("Authorization")+" "+strings.TrimSpace(string(body)))
+		if r.Header.Get("Authorization") != "Bearer "+*validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return tokenServer, server, &bodies
+}
+
+func TestReauthenticateOnAuthFailure(t *testing.T) {
+	validToken := "token-2"
+	tokenServer, server, bodies := newReauthTestServers(&validToken)
+	defer tokenServer.Close()
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticator("apikey", tokenServer.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: authenticator})
+	assert.Nil(t, err)
+	newRequest := func(ctx context.Context) *http.Request {
+		builder := NewRequestBuilder(POST).WithContext(ctx)
+		_, err := builder.ConstructHTTPURL(server.URL, nil, nil)
+		assert.Nil(t, err)
+		_, err = builder.SetBodyContentJSON(map[string]string{"name": "x"})
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// By default, the rejected request is not re-sent.
+	_, err = service.Request(newRequest(context.Background()), nil)
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode(err))
+	assert.Len(t, *bodies, 1)
+
+	// Once enabled, the request (including its body) is re-sent with a new token.
+	service.SetReauthenticateOnAuthFailure(true)
+	*bodies = nil
+	detailedResponse, err := service.Request(newRequest(context.Background()), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, detailedResponse.StatusCode)
+	assert.Equal(t, []string{`Bearer token-1 {"name":"x"}`, `Bearer token-2 {"name":"x"}`}, *bodies)
+
+	// The request is re-sent only once.
+	validToken = "token-9"
+	*bodies = nil
+	_, err = service.Clone().Request(newRequest(context.Background()), nil)
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode(err))
+	assert.Len(t, *bodies, 2)
+
+	// The request is not re-sent if retries are disabled by its context.
+	*bodies = nil
+	_, err = service.Request(newRequest(WithRetryDisabled(context.Background())), nil)
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode(err))
+	assert.Len(t, *bodies, 1)
+
+	// Or if the authenticator doesn't manage access tokens.
+	*bodies = nil
+	service, err = NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	service.SetReauthenticateOnAuthFailure(true)
+	_, err = service.Request(newRequest(context.Background()), nil)
+	assert.Equal(t, http.StatusUnauthorized, getStatusCode(err))
+	assert.Len(t, *bodies, 1)
+}
+
+func TestReauthenticateNotOnForbidden(t *testing.T) {
+	validToken := "token-1"
+	tokenServer, _, _ := newReauthTestServers(&validToken)
+	defer tokenServer.Close()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticator("apikey", tokenServer.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: authenticator})
+	assert.Nil(t, err)
+	service.SetReauthenticateOnAuthFailure(true)
+
+	// A request rejected with a 403 response is not re-sent, and the cached token is kept.
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ConstructHTTPURL(server.URL, nil, nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(req, nil)
+	assert.Equal(t, http.StatusForbidden, getStatusCode(err))
+	assert.Equal(t, 1, requests)
+	assert.NotNil(t, authenticator.getTokenData())
+}
+
+func TestReauthenticateCompositeAuthenticator(t *testing.T) {
+	validToken := "token-2"
+	tokenServer, server, bodies := newReauthTestServers(&validToken)
+	defer tokenServer.Close()
+	defer server.Close()
+
+	iamAuthenticator, err := NewIamAuthenticator("apikey", tokenServer.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	apikeyAuthenticator, err := NewAPIKeyHeaderAuthenticator("key", "X-Api-Key", "")
+	assert.Nil(t, err)
+	composite, err := NewCompositeAuthenticator(apikeyAuthenticator, iamAuthenticator)
+	assert.Nil(t, err)
+	assert.False(t, managesTokens(&CompositeAuthenticator{Authenticators: []Authenticator{apikeyAuthenticator}}))
+	assert.True(t, managesTokens(composite))
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: composite})
+	assert.Nil(t, err)
+	service.SetReauthenticateOnAuthFailure(true)
+	builder, err := NewRequestBuilder(GET).ConstructHTTPURL(server.URL, nil, nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Len(t, *bodies, 2)
+}
+
+func TestInvalidateToken(t *testing.T) {
+	validToken := "token-1"
+	tokenServer, _, _ := newReauthTestServers(&validToken)
+	defer tokenServer.Close()
+
+	var _ TokenInvalidator = &IamAuthenticator{}
+	var _ TokenInvalidator = &CloudPakForDataAuthenticator{}
+	var _ TokenInvalidator = &ContainerAuthenticator{}
+	var _ TokenInvalidator = &VpcInstanceAuthenticator{}
+	var _ TokenInvalidator = &IamAssumeAuthenticator{}
+	var _ TokenInvalidator = &MultiAuthenticator{}
+
+	authenticator, err := NewIamAuthenticator("apikey", tokenServer.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	composite, err := NewCompositeAuthenticator(authenticator, &NoAuthAuthenticator{})
+	assert.Nil(t, err)
+
+	// The cached token is used until it is invalidated.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+	token, _ = authenticator.GetToken()
+	assert.Equal(t, "token-1", token)
+	authenticator.InvalidateToken()
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+
+	// A CompositeAuthenticator invalidates the tokens of its authenticators.
+	composite.InvalidateToken()
+	token, _ = authenticator.GetToken()
+	assert.Equal(t, "token-3", token)
+
+	// Invalidating an authenticator without a cached token has no effect.
+	authenticator.InvalidateToken()
+	authenticator.InvalidateToken()
+	token, _ = authenticator.GetToken()
+	assert.Equal(t, "token-4", token)
+}
@@ -0,0 +1,73 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RedirectHop describes a redirect response that was followed while invoking an operation.
+type RedirectHop struct {
+	// The method and URL of the request that was redirected.
+	Method string
+	URL    string
+
+	// The status code of the redirect response (e.g. 301 or 307), and the URL
+	// (resolved from its "Location" header) to which the request was redirected.
+	StatusCode int
+	Location   string
+}
+
+func (hop RedirectHop) String() string {
+	return fmt.Sprintf("%s %s -> %d %s", hop.Method, hop.URL, hop.StatusCode, hop.Location)
+}
+
+// GetRedirects returns the redirects that were followed (in order) to obtain the response,
+// or nil if the request wasn't redirected. This can help to diagnose a misconfigured
+// service URL, or an unexpected redirect to another region.
+func (response *DetailedResponse) GetRedirects() []RedirectHop {
+	return response.redirects
+}
+
+// getRedirectChain returns the redirects that were followed to obtain "resp".
+func getRedirectChain(resp *http.Response) []RedirectHop {
+	var chain []RedirectHop
+
+	// The http.Client sets the Response field of each request that follows a redirect
+	// to the redirect response, whose Request field is the request that was redirected.
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		redirect := req.Response
+		hop := RedirectHop{
+			StatusCode: redirect.StatusCode,
+			Location:   req.URL.String(),
+		}
+		if redirect.Request != nil {
+			hop.Method = redirect.Request.Method
+			hop.URL = redirect.Request.URL.String()
+		}
+		chain = append([]RedirectHop{hop}, chain...)
+	}
+
+	if len(chain) > 0 && GetLogger().IsLogLevelEnabled(LevelDebug) {
+		hops := make([]string, len(chain))
+		for i, hop := range chain {
+			hops[i] = hop.String()
+		}
+		GetLogger().Debug("Redirects followed: %s", RedactSecrets(strings.Join(hops, ", ")))
+	}
+	return chain
+}
@@ -0,0 +1,108 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedirectTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/v1/moved?region=us-east", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/v1/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/v2/resource", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/v2/resource", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	})
+	mux.HandleFunc("/v1/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/v2/missing", http.StatusFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func invokeRedirectTestOperation(t *testing.T, serverURL string, path string) (*DetailedResponse, error) {
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           serverURL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(serverURL, path, nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	var result map[string]interface{}
+	return service.Request(req, &result)
+}
+
+func TestRedirectChain(t *testing.T) {
+	server := newRedirectTestServer()
+	defer server.Close()
+
+	response, err := invokeRedirectTestOperation(t, server.URL, "/v1/old")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, []RedirectHop{
+		{
+			Method:     http.MethodGet,
+			URL:        server.URL + "/v1/old",
+			StatusCode: http.StatusMovedPermanently,
+			Location:   server.URL + "/v1/moved?region=us-east",
+		},
+		{
+			Method:     http.MethodGet,
+			URL:        server.URL + "/v1/moved?region=us-east",
+			StatusCode: http.StatusTemporaryRedirect,
+			Location:   server.URL + "/v2/resource",
+		},
+	}, response.GetRedirects())
+	assert.Equal(t, "GET "+server.URL+"/v1/old -> 301 "+server.URL+"/v1/moved?region=us-east",
+		response.GetRedirects()[0].String())
+
+	// A request that isn't redirected has no redirects.
+	response, err = invokeRedirectTestOperation(t, server.URL, "/v2/resource")
+	assert.Nil(t, err)
+	assert.Nil(t, response.GetRedirects())
+}
+
+func TestRedirectChainErrorResponse(t *testing.T) {
+	server := newRedirectTestServer()
+	defer server.Close()
+
+	// The redirects are available along with an error response.
+	_, err := invokeRedirectTestOperation(t, server.URL, "/v1/gone")
+	assert.NotNil(t, err)
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+	assert.Len(t, httpErr.Response.GetRedirects(), 1)
+	assert.Equal(t, http.StatusFound, httpErr.Response.GetRedirects()[0].StatusCode)
+	assert.Equal(t, server.URL+"/v2/missing", httpErr.Response.GetRedirects()[0].Location)
+}
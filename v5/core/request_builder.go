@@ -27,6 +27,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -61,6 +62,24 @@ type FormData struct {
 	contents    interface{}
 }
 
+// DuplicateHeaderPolicy determines how RequestBuilder.AddHeader() handles
+// a header that has already been added to the request.
+type DuplicateHeaderPolicy int
+
+const (
+	// DuplicateHeaderReplace replaces any existing values of the header (the default).
+	DuplicateHeaderReplace DuplicateHeaderPolicy = iota
+
+	// DuplicateHeaderAppend appends the new value to any existing values of the header.
+	DuplicateHeaderAppend
+)
+
+// headerOrderKey is the context key used to associate a request's header order with the request.
+type headerOrderKey struct{}
+
+// transportKey is the context key used to associate an alternate transport with a request.
+type transportKey struct{}
+
 // RequestBuilder is used to build an HTTP Request instance.
 type RequestBuilder struct {
 	Method string
@@ -78,6 +97,54 @@ type RequestBuilder struct {
 	// value "gzip".
 	EnableGzipCompression bool
 
+	// DuplicateHeaderPolicy determines whether AddHeader() replaces (the default)
+	// or appends to the existing values of a header.
+	DuplicateHeaderPolicy DuplicateHeaderPolicy
+
+	// CanonicalizeHeaderNames indicates whether header names passed to AddHeader()
+	// should be converted to their canonical form (e.g. "x-request-id" becomes "X-Request-Id").
+	// By default, header names are used as specified.
+	CanonicalizeHeaderNames bool
+
+	// PreserveHeaderOrder indicates whether the order in which headers are added via
+	// AddHeader() should be recorded and associated with the http.Request constructed
+	// by the Build() method. The standard http.Transport always writes headers in
+	// sorted order, so the recorded order (available via GetRequestHeaderOrder())
+	// is intended for use by a custom http.RoundTripper.
+	PreserveHeaderOrder bool
+
+	// The names of the headers in the order in which they were added.
+	headerOrder []string
+
+	// An optional alternate transport to be used for this request only.
+	transport http.RoundTripper
+
+	// An optional service URL override to be used for this request only.
+	serviceURL string
+
+	// An optional Host header override to be used for this request only.
+	hostHeader string
+
+	// An optional canary routing endpoint to be used for this request only.
+	canaryEndpoint string
+
+	// An optional response validator to be used for this request only.
+	responseValidator ResponseValidator
+
+	// The precondition (if any) applied by CreateOnly() or UpdateOnly().
+	precondition string
+
+	// Whether the body should be sent with chunked transfer encoding, and the algorithm
+	// (if any) used to compute its checksum trailer.
+	chunkedUpload     bool
+	checksumAlgorithm string
+
+	// Optional feature flags to be enabled or disabled for this request only.
+	featureFlags FeatureFlags
+
+	// An optional name of the operation invoked by the request.
+	operationName string
+
 	// RequestContext is an optional Context instance to be associated with the
 	// http.Request that is constructed by the Build() method.
 	ctx context.Context
@@ -100,6 +167,28 @@ func (requestBuilder *RequestBuilder) WithContext(ctx context.Context) *RequestB
 	return requestBuilder
 }
 
+// WithTransport sets "transport" as the http.RoundTripper to be used to send the
+// http.Request instance that will be constructed by the Build() method, in place of
+// the transport configured on the service's HTTP client (e.g. to route one specific
+// call through a tunneled transport). All other processing performed by
+// BaseService.Request() (default headers, authentication, retries, response
+// transforms) is applied as usual.
+func (requestBuilder *RequestBuilder) WithTransport(transport http.RoundTripper) *RequestBuilder {
+	requestBuilder.transport = transport
+	return requestBuilder
+}
+
+// WithServiceURL sets "serviceURL" (e.g. a direct-to-node URL returned by a control plane)
+// as the service URL to be used to send the http.Request instance that will be constructed
+// by the Build() method. The scheme and host of the request URL are replaced with those of
+// "serviceURL", which must not contain a path, while the path and query constructed by the
+// RequestBuilder are retained. BaseService.Request() sends the request only if the host of
+// "serviceURL" is one of the service's allowed hosts (see BaseService.SetAllowedHosts()).
+func (requestBuilder *RequestBuilder) WithServiceURL(serviceURL string) *RequestBuilder {
+	requestBuilder.serviceURL = serviceURL
+	return requestBuilder
+}
+
 // ConstructHTTPURL creates a properly-encoded URL with path parameters.
 // This function returns an error if the serviceURL is "" or is an
 // invalid URL string (e.g. ":<badscheme>").
@@ -114,18 +203,24 @@ func (requestBuilder *RequestBuilder) ConstructHTTPURL(serviceURL string, pathSe
 		return requestBuilder, fmt.Errorf(ERRORMSG_SERVICE_URL_INVALID, err.Error())
 	}
 
+	// Accumulate the path in a single buffer rather than concatenating each element.
+	var sb strings.Builder
+	sb.WriteString(URL.Path)
 	for i, pathSegment := range pathSegments {
 		if pathSegment != "" {
-			URL.Path += "/" + pathSegment
+			sb.WriteByte('/')
+			sb.WriteString(pathSegment)
 		}
 
 		if pathParameters != nil && i < len(pathParameters) {
 			if pathParameters[i] == "" {
 				return requestBuilder, fmt.Errorf(ERRORMSG_PATH_PARAM_EMPTY, fmt.Sprintf("[%d]", i))
 			}
-			URL.Path += "/" + pathParameters[i]
+			sb.WriteByte('/')
+			sb.WriteString(pathParameters[i])
 		}
 	}
+	URL.Path = sb.String()
 	requestBuilder.URL = URL
 	return requestBuilder, nil
 }
@@ -146,44 +241,42 @@ func (requestBuilder *RequestBuilder) ResolveRequestURL(serviceURL string, path
 		return requestBuilder, fmt.Errorf(ERRORMSG_SERVICE_URL_MISSING)
 	}
 
-	urlString := serviceURL
+	// Build the URL string in a single buffer to avoid intermediate strings.
+	var sb strings.Builder
+	sb.Grow(len(serviceURL) + len(path) + 1)
+	sb.WriteString(serviceURL)
 
 	// If we have a non-empty "path" input parameter, then process it for possible path param references.
 	if path != "" {
 
-		// If path parameter values were passed in, then for each one, replace any references to it
-		// within "path" with the path parameter's encoded value.
-		if len(pathParams) > 0 {
-			for k, v := range pathParams {
-				if v == "" {
-					return requestBuilder, fmt.Errorf(ERRORMSG_PATH_PARAM_EMPTY, k)
-				}
-				encodedValue := url.PathEscape(v)
-				ref := fmt.Sprintf("{%s}", k)
-				path = strings.ReplaceAll(path, ref, encodedValue)
+		// Make sure that each path param has a non-empty value.
+		for k, v := range pathParams {
+			if v == "" {
+				return requestBuilder, fmt.Errorf(ERRORMSG_PATH_PARAM_EMPTY, k)
 			}
 		}
 
-		// Next, we need to append "path" to "urlString".
-		// We need to pay particular attention to any trailing slash on "urlString" and
+		// We need to append "path" to the service URL.
+		// We need to pay particular attention to any trailing slash on the service URL and
 		// a leading slash on "path".  Ultimately, we do not want a double slash.
-		if strings.HasSuffix(urlString, "/") {
-			// If urlString has a trailing slash, then make sure path does not have a leading slash.
+		if strings.HasSuffix(serviceURL, "/") {
+			// If the service URL has a trailing slash, then make sure path does not have a leading slash.
 			path = strings.TrimPrefix(path, "/")
 		} else {
-			// If urlString does not have a trailing slash and path does not have a
-			// leading slash, then append a slash to urlString.
+			// If the service URL does not have a trailing slash and path does not have a
+			// leading slash, then append a slash to the service URL.
 			if !strings.HasPrefix(path, "/") {
-				urlString += "/"
+				sb.WriteByte('/')
 			}
 		}
 
-		urlString += path
+		// Replace any references to a path param within "path" with the path param's encoded value.
+		writeResolvedPath(&sb, path, pathParams)
 	}
 
 	var URL *url.URL
 
-	URL, err := url.Parse(urlString)
+	URL, err := url.Parse(sb.String())
 	if err != nil {
 		return requestBuilder, fmt.Errorf(ERRORMSG_SERVICE_URL_INVALID, err.Error())
 	}
@@ -192,6 +285,40 @@ func (requestBuilder *RequestBuilder) ResolveRequestURL(serviceURL string, path
 	return requestBuilder, nil
 }
 
+// writeResolvedPath writes "path" to "sb" in a single pass, replacing each path param
+// reference (e.g. "{resource_id}") that has an entry in "pathParams" with the path
+// param's encoded value. References to unknown path params are written as-is.
+func writeResolvedPath(sb *strings.Builder, path string, pathParams map[string]string) {
+	if len(pathParams) == 0 {
+		sb.WriteString(path)
+		return
+	}
+
+	for {
+		start := strings.IndexByte(path, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(path[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		// Use the innermost '{' in case of a stray '{' preceding the reference.
+		start += strings.LastIndexByte(path[start:end], '{')
+
+		v, ok := pathParams[path[start+1:end]]
+		if ok {
+			sb.WriteString(path[:start])
+			sb.WriteString(url.PathEscape(v))
+		} else {
+			sb.WriteString(path[:end+1])
+		}
+		path = path[end+1:]
+	}
+	sb.WriteString(path)
+}
+
 // AddQuery adds a query parameter name and value to the request.
 func (requestBuilder *RequestBuilder) AddQuery(name string, value string) *RequestBuilder {
 	requestBuilder.Query[name] = append(requestBuilder.Query[name], value)
@@ -200,10 +327,54 @@ func (requestBuilder *RequestBuilder) AddQuery(name string, value string) *Reque
 
 // AddHeader adds a header name and value to the request.
 func (requestBuilder *RequestBuilder) AddHeader(name string, value string) *RequestBuilder {
-	requestBuilder.Header[name] = []string{value}
+	if requestBuilder.CanonicalizeHeaderNames {
+		name = http.CanonicalHeaderKey(name)
+	}
+
+	if requestBuilder.DuplicateHeaderPolicy == DuplicateHeaderAppend {
+		requestBuilder.Header[name] = append(requestBuilder.Header[name], value)
+	} else {
+		requestBuilder.Header[name] = []string{value}
+	}
+
+	if requestBuilder.PreserveHeaderOrder && !SliceContains(requestBuilder.headerOrder, name) {
+		requestBuilder.headerOrder = append(requestBuilder.headerOrder, name)
+	}
 	return requestBuilder
 }
 
+// HeaderOrder returns the names of the headers added via AddHeader(), in the order
+// in which they were added. The order is recorded only if PreserveHeaderOrder is true.
+func (requestBuilder *RequestBuilder) HeaderOrder() []string {
+	return append([]string(nil), requestBuilder.headerOrder...)
+}
+
+// GetRequestHeaderOrder returns the names of the headers contained in "req", in the order
+// in which they should be written. The headers recorded by a RequestBuilder with
+// PreserveHeaderOrder enabled are returned first, in the order in which they were added,
+// followed by any remaining headers (e.g. those added by BaseService.Request()) in sorted order.
+// If no header order was recorded for "req", all of its headers are returned in sorted order.
+func GetRequestHeaderOrder(req *http.Request) []string {
+	recorded, _ := req.Context().Value(headerOrderKey{}).([]string)
+
+	order := make([]string, 0, len(req.Header))
+	for _, name := range recorded {
+		if _, ok := req.Header[name]; ok {
+			order = append(order, name)
+		}
+	}
+
+	remaining := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if !SliceContains(recorded, name) {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+
+	return append(order, remaining...)
+}
+
 // AddFormData adds a new mime part (constructed from the input parameters)
 // to the request's multi-part form.
 func (requestBuilder *RequestBuilder) AddFormData(fieldName string, fileName string, contentType string,
@@ -319,7 +490,9 @@ func (requestBuilder *RequestBuilder) Build() (req *http.Request, err error) {
 				}
 			}
 
-			requestBuilder.AddHeader("Content-Type", formWriter.FormDataContentType())
+			// The form's content type always replaces any existing value, regardless of the
+			// builder's DuplicateHeaderPolicy.
+			requestBuilder.Header[CONTENT_TYPE] = []string{formWriter.FormDataContentType()}
 			err = formWriter.Close()
 			if err != nil {
 				return
@@ -348,13 +521,24 @@ func (requestBuilder *RequestBuilder) Build() (req *http.Request, err error) {
 	// Headers
 	req.Header = requestBuilder.Header
 
+	// If the body should be streamed, then send it with chunked transfer encoding.
+	if requestBuilder.chunkedUpload {
+		if err = requestBuilder.applyChunkedUpload(req); err != nil {
+			return nil, err
+		}
+	}
+
 	// If "Host" was specified as a header, we need to explicitly copy it
 	// to the request's Host field since the "Host" header will be ignored by Request.Write().
-	host := req.Header.Get("Host")
-	if host != "" {
+	if host := getHeaderValue(req.Header, headerNameHost); host != "" {
 		req.Host = host
 	}
 
+	// A Host header override takes precedence over a "Host" header.
+	if requestBuilder.hostHeader != "" {
+		req.Host = requestBuilder.hostHeader
+	}
+
 	// Query
 	query := req.URL.Query()
 	for k, l := range requestBuilder.Query {
@@ -371,9 +555,82 @@ func (requestBuilder *RequestBuilder) Build() (req *http.Request, err error) {
 		req = req.WithContext(requestBuilder.ctx)
 	}
 
+	// If the header order should be preserved, then associate it with the new Request instance.
+	if requestBuilder.PreserveHeaderOrder {
+		ctx := context.WithValue(req.Context(), headerOrderKey{}, requestBuilder.HeaderOrder())
+		req = req.WithContext(ctx)
+	}
+
+	// If an alternate transport was specified, then associate it with the new Request instance.
+	if !IsNil(requestBuilder.transport) {
+		ctx := context.WithValue(req.Context(), transportKey{}, requestBuilder.transport)
+		req = req.WithContext(ctx)
+	}
+
+	// If a service URL override was specified, then associate it with the new Request instance.
+	if requestBuilder.serviceURL != "" {
+		override, overrideErr := parseServiceURLOverride(requestBuilder.serviceURL)
+		if overrideErr != nil {
+			return nil, overrideErr
+		}
+		ctx := context.WithValue(req.Context(), serviceURLKey{}, override)
+		req = req.WithContext(ctx)
+	}
+
+	// If a Host header override was specified, then associate it with the new Request instance.
+	if requestBuilder.hostHeader != "" {
+		ctx := context.WithValue(req.Context(), hostHeaderKey{}, requestBuilder.hostHeader)
+		req = req.WithContext(ctx)
+	}
+
+	// If a canary routing endpoint was specified, then associate it with the new Request instance.
+	if requestBuilder.canaryEndpoint != "" {
+		if requestBuilder.canaryEndpoint != CanaryEndpointPrimary && requestBuilder.canaryEndpoint != CanaryEndpointCanary {
+			return nil, fmt.Errorf(ERRORMSG_PROP_INVALID, "canary endpoint")
+		}
+		ctx := context.WithValue(req.Context(), canaryEndpointKey{}, requestBuilder.canaryEndpoint)
+		req = req.WithContext(ctx)
+	}
+
+	// If a response validator was specified, then associate it with the new Request instance.
+	if !IsNil(requestBuilder.responseValidator) {
+		ctx := context.WithValue(req.Context(), responseValidatorKey{}, requestBuilder.responseValidator)
+		req = req.WithContext(ctx)
+	}
+
+	// If the body is streamed, then mark the new Request instance so that it's not retried.
+	if requestBuilder.chunkedUpload && req.Body != nil {
+		ctx := context.WithValue(req.Context(), chunkedUploadKey{}, true)
+		req = req.WithContext(ctx)
+	}
+
+	// If feature flags were specified, then associate them with the new Request instance.
+	if len(requestBuilder.featureFlags) > 0 {
+		ctx := context.WithValue(req.Context(), featureFlagsKey{}, requestBuilder.featureFlags)
+		req = req.WithContext(ctx)
+	}
+
+	// If a precondition was applied, then associate it with the new Request instance.
+	if requestBuilder.precondition != "" {
+		ctx := context.WithValue(req.Context(), preconditionKey{}, requestBuilder.precondition)
+		req = req.WithContext(ctx)
+	}
+
+	// If an operation name was specified, then associate it with the new Request instance.
+	if requestBuilder.operationName != "" {
+		ctx := context.WithValue(req.Context(), operationNameKey{}, requestBuilder.operationName)
+		req = req.WithContext(ctx)
+	}
+
 	return
 }
 
+// getRequestTransport returns the alternate transport associated with "req", or nil.
+func getRequestTransport(req *http.Request) http.RoundTripper {
+	transport, _ := req.Context().Value(transportKey{}).(http.RoundTripper)
+	return transport
+}
+
 // SetBodyContent sets the body content from one of three different sources.
 func (requestBuilder *RequestBuilder) SetBodyContent(contentType string, jsonContent interface{}, jsonPatchContent interface{},
 	nonJSONContent interface{}) (builder *RequestBuilder, err error) {
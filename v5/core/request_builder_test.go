@@ -709,3 +709,220 @@ func TestHostHeader2(t *testing.T) {
 	assert.Equal(t, "overridehost:81", req.Host)
 	t.Logf("Host: %s\n", req.Host)
 }
+
+func TestRequestTemplate(t *testing.T) {
+	builder := NewRequestBuilder("GET")
+	builder.AddHeader("Accept", "application/json")
+	builder.AddQuery("version", "2021-06-01")
+	builder.EnableGzipCompression = true
+
+	template, err := builder.NewTemplate("https://myservice.cloud.ibm.com/api/v1/", "/resources/{resource_id}/items/{item_id}")
+	assert.Nil(t, err)
+	assert.NotNil(t, template)
+
+	// Changes to the original builder must not affect the template.
+	builder.AddHeader("Accept", "text/plain")
+	builder.AddQuery("version", "2099-01-01")
+
+	for _, id := range []string{"r1", "r2", "r/3"} {
+		rb, err := template.NewRequestBuilder(map[string]string{
+			"resource_id": id,
+			"item_id":     "item-1",
+		})
+		assert.Nil(t, err)
+		rb.AddQuery("limit", "10")
+		assert.True(t, rb.EnableGzipCompression)
+
+		// The equivalent request built without a template.
+		expectedBuilder := NewRequestBuilder("GET")
+		_, err = expectedBuilder.ResolveRequestURL("https://myservice.cloud.ibm.com/api/v1/", "/resources/{resource_id}/items/{item_id}",
+			map[string]string{"resource_id": id, "item_id": "item-1"})
+		assert.Nil(t, err)
+		assert.Equal(t, expectedBuilder.URL.String(), rb.URL.String())
+
+		req, err := rb.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, "GET", req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Accept"))
+		assert.Equal(t, "2021-06-01", req.URL.Query().Get("version"))
+		assert.Equal(t, "10", req.URL.Query().Get("limit"))
+	}
+	assert.Equal(t, "https://myservice.cloud.ibm.com/api/v1/resources/r%2F3/items/item-1", func() string {
+		rb, _ := template.NewRequestBuilder(map[string]string{"resource_id": "r/3", "item_id": "item-1"})
+		return rb.URL.String()
+	}())
+
+	// Changes to an instantiated builder must not affect the template.
+	rb, err := template.NewRequestBuilder(map[string]string{"resource_id": "r1", "item_id": "i1"})
+	assert.Nil(t, err)
+	rb.AddQuery("version", "other")
+	rb.AddHeader("Accept", "text/plain")
+	rb, err = template.NewRequestBuilder(map[string]string{"resource_id": "r1", "item_id": "i1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2021-06-01"}, rb.Query["version"])
+	assert.Equal(t, "application/json", rb.Header.Get("Accept"))
+}
+
+func TestRequestTemplateErrors(t *testing.T) {
+	builder := NewRequestBuilder("GET")
+
+	_, err := builder.NewTemplate("", "/resources")
+	assert.NotNil(t, err)
+	assert.Equal(t, ERRORMSG_SERVICE_URL_MISSING, err.Error())
+
+	_, err = builder.NewTemplate(":badscheme", "/resources")
+	assert.NotNil(t, err)
+
+	template, err := builder.NewTemplate("https://myservice.cloud.ibm.com", "resources/{resource_id}")
+	assert.Nil(t, err)
+
+	_, err = template.NewRequestBuilder(nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PATH_PARAM_EMPTY, "resource_id"), err.Error())
+
+	_, err = template.NewRequestBuilder(map[string]string{"resource_id": ""})
+	assert.NotNil(t, err)
+
+	// A template without path parameters.
+	template, err = builder.NewTemplate("https://myservice.cloud.ibm.com", "")
+	assert.Nil(t, err)
+	rb, err := template.NewRequestBuilder(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://myservice.cloud.ibm.com", rb.URL.String())
+	req, err := rb.Build()
+	assert.Nil(t, err)
+	assert.NotNil(t, req)
+}
+
+func BenchmarkResolveRequestURL(b *testing.B) {
+	pathParams := map[string]string{
+		"resource_id": "res-123-456-789-abc",
+		"type_id":     "type 1",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder := NewRequestBuilder("GET")
+		_, err := builder.ResolveRequestURL("https://myservice.cloud.ibm.com/api/v1", "/resource/{resource_id}/type/{type_id}", pathParams)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConstructHTTPURL(b *testing.B) {
+	pathSegments := []string{"resource", "type"}
+	pathParameters := []string{"res-123-456-789-abc", "type-1"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		builder := NewRequestBuilder("GET")
+		_, err := builder.ConstructHTTPURL("https://myservice.cloud.ibm.com/api/v1", pathSegments, pathParameters)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestTemplate(b *testing.B) {
+	template, err := NewRequestBuilder("GET").NewTemplate("https://myservice.cloud.ibm.com/api/v1", "/resource/{resource_id}/type/{type_id}")
+	if err != nil {
+		b.Fatal(err)
+	}
+	pathParams := map[string]string{
+		"resource_id": "res-123-456-789-abc",
+		"type_id":     "type 1",
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := template.NewRequestBuilder(pathParams)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestResolveRequestURLReferences(t *testing.T) {
+	pathParams := map[string]string{
+		"id":   "a b",
+		"type": "t1",
+	}
+
+	// Unknown references are left as-is, and a stray '{' does not hide a reference.
+	builder := NewRequestBuilder("GET")
+	_, err := builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "/x/{id}/{other}/{type}/{{id}/{id", pathParams)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://myservice.cloud.ibm.com/x/a%20b/%7Bother%7D/t1/%7Ba%20b/%7Bid", builder.URL.String())
+
+	// Path params are validated only if a path is specified.
+	_, err = builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "", map[string]string{"id": ""})
+	assert.Nil(t, err)
+	_, err = builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "/x", map[string]string{"id": ""})
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_PATH_PARAM_EMPTY, "id"), err.Error())
+}
+
+func TestAddHeaderDuplicatePolicy(t *testing.T) {
+	builder := NewRequestBuilder("GET")
+	builder.AddHeader("X-Custom", "a")
+	builder.AddHeader("X-Custom", "b")
+	assert.Equal(t, []string{"b"}, builder.Header["X-Custom"])
+
+	builder = NewRequestBuilder("GET")
+	builder.DuplicateHeaderPolicy = DuplicateHeaderAppend
+	builder.AddHeader("X-Custom", "a")
+	builder.AddHeader("X-Custom", "b")
+	assert.Equal(t, []string{"a", "b"}, builder.Header["X-Custom"])
+
+	// The multipart content type must replace an existing value regardless of the policy.
+	builder.AddHeader(CONTENT_TYPE, "multipart/form-data")
+	builder.AddFormData("name", "", "", "value")
+	_, err := builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Len(t, req.Header[CONTENT_TYPE], 1)
+	assert.Contains(t, req.Header.Get(CONTENT_TYPE), "multipart/form-data; boundary=")
+}
+
+func TestAddHeaderCanonicalize(t *testing.T) {
+	builder := NewRequestBuilder("GET")
+	builder.AddHeader("x-request-id", "1")
+	assert.Equal(t, []string{"1"}, builder.Header["x-request-id"])
+	assert.Equal(t, "", builder.Header.Get("X-Request-Id"))
+
+	builder = NewRequestBuilder("GET")
+	builder.CanonicalizeHeaderNames = true
+	builder.AddHeader("x-request-id", "1")
+	assert.Nil(t, builder.Header["x-request-id"])
+	assert.Equal(t, "1", builder.Header.Get("X-Request-Id"))
+}
+
+func TestPreserveHeaderOrder(t *testing.T) {
+	builder := NewRequestBuilder("GET")
+	builder.AddHeader("Zulu", "1")
+	builder.AddHeader("Alpha", "1")
+	assert.Nil(t, builder.HeaderOrder())
+	_, err := builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Alpha", "Zulu"}, GetRequestHeaderOrder(req))
+
+	builder = NewRequestBuilder("GET")
+	builder.PreserveHeaderOrder = true
+	builder.AddHeader("Zulu", "1")
+	builder.AddHeader("Alpha", "1")
+	builder.AddHeader("Mike", "1")
+	builder.AddHeader("Zulu", "2")
+	assert.Equal(t, []string{"Zulu", "Alpha", "Mike"}, builder.HeaderOrder())
+
+	_, err = builder.ResolveRequestURL("https://myservice.cloud.ibm.com", "", nil)
+	assert.Nil(t, err)
+	req, err = builder.WithContext(context.Background()).Build()
+	assert.Nil(t, err)
+
+	// Headers that were not recorded (or were removed) are handled appropriately.
+	req.Header.Del("Mike")
+	req.Header.Add("User-Agent", "test")
+	req.Header.Add("Accept", "application/json")
+	assert.Equal(t, []string{"Zulu", "Alpha", "Accept", "User-Agent"}, GetRequestHeaderOrder(req))
+}
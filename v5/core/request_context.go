@@ -0,0 +1,135 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The header in which the correlation id associated with a request's context is sent.
+const headerNameCorrelationID = "X-Correlation-Id"
+
+// Context keys for the per-request behavior controlled by the With*() functions below.
+type (
+	requestTimeoutKey struct{}
+	correlationIDKey  struct{}
+	retryDisabledKey  struct{}
+	tenantKey         struct{}
+)
+
+// WithRequestTimeout returns a copy of "ctx" that causes BaseService.Request() to fail any request
+// associated with it (via RequestBuilder.WithContext()) that doesn't complete within "timeout",
+// including any retries. Unlike context.WithTimeout(), the timeout starts when each request is sent.
+func WithRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// getRequestTimeout returns the request timeout associated with "ctx", or 0.
+func getRequestTimeout(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
+// WithCorrelationID returns a copy of "ctx" that causes BaseService.Request() to send "id" in the
+// "X-Correlation-Id" header of any request associated with it (unless the request already has one),
+// so that the requests can be correlated with the application's own logs.
+// If "id" is "", a random id is generated.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = NewRandomID()
+	}
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// GetCorrelationID returns the correlation id associated with "ctx", or "".
+func GetCorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// WithRetryDisabled returns a copy of "ctx" that causes BaseService.Request() not to retry
+// any request associated with it, even if retries are enabled.
+func WithRetryDisabled(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryDisabledKey{}, true)
+}
+
+// isRetryDisabled returns true iff retries are disabled by "ctx".
+func isRetryDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(retryDisabledKey{}).(bool)
+	return disabled
+}
+
+// WithTenant returns a copy of "ctx" that associates "tenant" with any request associated with it.
+// BaseService.Request() sends the tenant in the header configured with BaseService.SetTenantHeader().
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// GetTenant returns the tenant associated with "ctx", or "".
+func GetTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// SetTenantHeader sets the name of the header in which the tenant associated with each request's
+// context (see WithTenant()) is sent. An empty name (the default) disables the header.
+func (service *BaseService) SetTenantHeader(name string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.tenantHeader = name
+}
+
+// applyContextHeaders adds the correlation id and tenant associated with the context of "req"
+// to its headers, unless they are already present.
+func applyContextHeaders(req *http.Request, tenantHeader string) {
+	if id := GetCorrelationID(req.Context()); id != "" && req.Header.Get(headerNameCorrelationID) == "" {
+		req.Header.Set(headerNameCorrelationID, id)
+	}
+	if tenantHeader == "" {
+		return
+	}
+	if tenant := GetTenant(req.Context()); tenant != "" && req.Header.Get(tenantHeader) == "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+}
+
+// cancelWithResult invokes "cancel" now, or when the response body is closed if it's being
+// streamed to the caller via "result" (a *io.ReadCloser).
+func cancelWithResult(result interface{}, detailedResponse *DetailedResponse, err error, cancel context.CancelFunc) {
+	if body, ok := result.(*io.ReadCloser); ok && err == nil && *body != nil {
+		*body = &cancelOnClose{ReadCloser: *body, cancel: cancel}
+		if detailedResponse != nil {
+			detailedResponse.Result = *body
+		}
+		return
+	}
+	cancel()
+}
+
+// cancelOnClose is an io.ReadCloser that invokes "cancel" when it's closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,129 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newContextTestRequest(t *testing.T, ctx context.Context, url string, path string) *http.Request {
+	builder := NewRequestBuilder(GET).WithContext(ctx)
+	_, err := builder.ResolveRequestURL(url, path, nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestContextHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// The correlation id is always sent, while the tenant is sent only if a header is configured.
+	ctx := WithTenant(WithCorrelationID(context.Background(), "corr-1"), "tenant-a")
+	assert.Equal(t, "corr-1", GetCorrelationID(ctx))
+	assert.Equal(t, "tenant-a", GetTenant(ctx))
+	_, err = service.Request(newContextTestRequest(t, ctx, server.URL, "/"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "corr-1", header.Get("X-Correlation-Id"))
+	assert.Equal(t, "", header.Get("X-Tenant-Id"))
+
+	service.SetTenantHeader("X-Tenant-Id")
+	_, err = service.Request(newContextTestRequest(t, ctx, server.URL, "/"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "tenant-a", header.Get("X-Tenant-Id"))
+
+	// Explicit headers take precedence.
+	req := newContextTestRequest(t, ctx, server.URL, "/")
+	req.Header.Set("X-Correlation-Id", "explicit")
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "explicit", header.Get("X-Correlation-Id"))
+
+	// A random correlation id is generated if none is specified.
+	ctx = WithCorrelationID(context.Background(), "")
+	assert.Len(t, GetCorrelationID(ctx), 36)
+	assert.Equal(t, "", GetCorrelationID(context.Background()))
+	assert.Equal(t, "", GetTenant(context.Background()))
+}
+
+func TestContextRetryDisabled(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	service.EnableRetries(2, time.Millisecond)
+
+	_, err = service.Request(newContextTestRequest(t, WithRetryDisabled(context.Background()), server.URL, "/"), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestContextRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, "application/octet-stream")
+		_, _ = w.Write([]byte("streamed"))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	ctx := WithRequestTimeout(context.Background(), 50*time.Millisecond)
+
+	// A slow request times out.
+	start := time.Now()
+	_, err = service.Request(newContextTestRequest(t, ctx, server.URL, "/slow"), nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// A streamed response body remains readable after Request() returns.
+	var body io.ReadCloser
+	detailedResponse, err := service.Request(newContextTestRequest(t, ctx, server.URL, "/fast"), &body)
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "streamed", string(data))
+	assert.Equal(t, body, detailedResponse.Result)
+	assert.Nil(t, body.Close())
+}
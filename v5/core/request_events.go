@@ -0,0 +1,236 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// RequestPhase identifies a stage in the lifecycle of a request sent by BaseService.Request().
+type RequestPhase string
+
+const (
+	// The request has been submitted, and is being prepared (e.g. an access token is being obtained).
+	RequestPhaseQueued RequestPhase = "queued"
+
+	// An attempt to send the request has started (e.g. a connection is being established).
+	RequestPhaseSending RequestPhase = "sending"
+
+	// The request has been sent, and the response is awaited.
+	RequestPhaseWaiting RequestPhase = "waiting"
+
+	// The response headers have been received, and the response body is being received.
+	RequestPhaseReceiving RequestPhase = "receiving"
+
+	// The attempt failed, and the request will be sent again (after a backoff).
+	RequestPhaseRetrying RequestPhase = "retrying"
+
+	// The request has completed, successfully or not. For a streamed response (i.e. when
+	// the result is an io.ReadCloser), the response body might not have been read yet.
+	RequestPhaseDone RequestPhase = "done"
+)
+
+// RequestEvent reports that a request has entered a new phase of its lifecycle.
+type RequestEvent struct {
+	// The phase that the request has entered.
+	Phase RequestPhase
+
+	// The method and URL of the request.
+	Method string
+	URL    string
+
+	// The name of the operation invoked by the request (see BaseService.GetOperationName()),
+	// which is suitable for labeling metrics and traces.
+	Operation string
+
+	// The number of attempts made to send the request (0 until the request is first sent).
+	Attempt int
+
+	// The status code of the response (if any) for the "receiving", "retrying" and "done" phases.
+	StatusCode int
+
+	// The error (if any) that caused the "retrying" phase, or with which the request completed.
+	Err error
+
+	// The time at which the request entered the phase.
+	Time time.Time
+}
+
+// RequestEventHandler is a function that is invoked with each lifecycle event of a request.
+// The events of a request are delivered in order, from the goroutine that is processing the
+// request (so the handler must not block).
+type RequestEventHandler func(event *RequestEvent)
+
+// The context key for the handler set by WithRequestEventHandler().
+type requestEventHandlerKey struct{}
+
+// SetRequestEventHandler sets the function that is invoked with the lifecycle events of each request
+// sent by the service, so that interactive applications (e.g. CLIs) can report the progress of
+// long-running operations. A nil value removes any previously-set handler.
+func (service *BaseService) SetRequestEventHandler(handler RequestEventHandler) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.requestEventHandler = handler
+}
+
+// WithRequestEventHandler returns a copy of "ctx" that causes BaseService.Request() to invoke "handler"
+// with the lifecycle events of any request associated with it (in addition to the service's handler).
+func WithRequestEventHandler(ctx context.Context, handler RequestEventHandler) context.Context {
+	return context.WithValue(ctx, requestEventHandlerKey{}, handler)
+}
+
+// NewRequestEventChannelHandler returns a RequestEventHandler that sends each event to "events".
+// An event is discarded if "events" is not ready to receive it, so that a slow receiver doesn't
+// delay the request; a buffered channel should be used to avoid discarding events.
+func NewRequestEventChannelHandler(events chan<- *RequestEvent) RequestEventHandler {
+	return func(event *RequestEvent) {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// requestEvents delivers the lifecycle events of a request to its handlers.
+type requestEvents struct {
+	handlers  []RequestEventHandler
+	operation string
+	phase     RequestPhase
+	attempt   int
+	mutex     sync.Mutex
+}
+
+// newRequestEvents returns the requestEvents for the request "req" (for an operation whose name
+// is determined by "operationNames"), or nil if neither the service nor the context of "req"
+// specifies a handler.
+func newRequestEvents(req *http.Request, serviceHandler RequestEventHandler, operationNames []operationName) *requestEvents {
+	var handlers []RequestEventHandler
+	if serviceHandler != nil {
+		handlers = append(handlers, serviceHandler)
+	}
+	if contextHandler, _ := req.Context().Value(requestEventHandlerKey{}).(RequestEventHandler); contextHandler != nil {
+		handlers = append(handlers, contextHandler)
+	}
+	if len(handlers) == 0 {
+		return nil
+	}
+	return &requestEvents{
+		handlers:  handlers,
+		operation: findOperationName(operationNames, req),
+	}
+}
+
+// emit delivers an event for "req" entering "phase" to the handlers.
+func (events *requestEvents) emit(req *http.Request, phase RequestPhase, statusCode int, err error) {
+	if events == nil {
+		return
+	}
+
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	if phase == RequestPhaseSending {
+		events.attempt++
+	} else if phase == RequestPhaseWaiting && events.phase != RequestPhaseSending {
+		// The response arrived before the request was entirely written.
+		return
+	}
+	events.phase = phase
+
+	event := &RequestEvent{
+		Phase:      phase,
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Operation:  events.operation,
+		Attempt:    events.attempt,
+		StatusCode: statusCode,
+		Err:        err,
+		Time:       GetClock().Now(),
+	}
+	for _, handler := range events.handlers {
+		callSafely(PanicSourceRequestEventHandler, func() { handler(event) })
+	}
+}
+
+// transport returns a RoundTripper that delivers the "sending", "waiting" and "receiving" events
+// of each attempt to send a request via "next".
+func (events *requestEvents) transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &requestEventsTransport{events: events, next: next}
+}
+
+// requestEventsTransport is the http.RoundTripper returned by requestEvents.transport.
+type requestEventsTransport struct {
+	events *requestEvents
+	next   http.RoundTripper
+}
+
+func (transport *requestEventsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	events := transport.events
+	events.emit(req, RequestPhaseSending, 0, nil)
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				events.emit(req, RequestPhaseWaiting, 0, nil)
+			}
+		},
+	}
+
+	resp, err := transport.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil {
+		events.emit(req, RequestPhaseReceiving, resp.StatusCode, nil)
+	}
+	return resp, err
+}
+
+// applyRetries returns a copy of "client" that delivers a "retrying" event (for the request "req")
+// before each retry.
+func (events *requestEvents) applyRetries(client *retryablehttp.Client, req *http.Request) *retryablehttp.Client {
+	if events == nil {
+		return client
+	}
+
+	reporting := retryableClientWithTransport(client, client.HTTPClient.Transport)
+	checkRetry := client.CheckRetry
+	if checkRetry == nil {
+		checkRetry = retryablehttp.DefaultRetryPolicy
+	}
+	attempts := 0
+
+	// CheckRetry is invoked after each attempt (including the last one, for which the
+	// retry limit has been reached), so only report a retry that will be sent.
+	reporting.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		shouldRetry, checkErr := checkRetry(ctx, resp, err)
+		attempts++
+		if shouldRetry && attempts <= client.RetryMax {
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			events.emit(req, RequestPhaseRetrying, statusCode, err)
+		}
+		return shouldRetry, checkErr
+	}
+	return reporting
+}
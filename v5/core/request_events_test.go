@@ -0,0 +1,191 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requestEventRecorder records the lifecycle events delivered to its handler.
+type requestEventRecorder struct {
+	events []*RequestEvent
+	mutex  sync.Mutex
+}
+
+func (recorder *requestEventRecorder) handle(event *RequestEvent) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.events = append(recorder.events, event)
+}
+
+func (recorder *requestEventRecorder) phases() (phases []RequestPhase) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for _, event := range recorder.events {
+		phases = append(phases, event.Phase)
+	}
+	return
+}
+
+func invokeWithRequestEvents(t *testing.T, service *BaseService, ctx context.Context) (*DetailedResponse, error) {
+	return invokeMethodWithRequestEvents(t, service, ctx, GET)
+}
+
+func invokeMethodWithRequestEvents(t *testing.T, service *BaseService, ctx context.Context, method string) (*DetailedResponse, error) {
+	builder := NewRequestBuilder(method)
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "", nil)
+	assert.Nil(t, err)
+	builder.WithContext(ctx)
+	req, _ := builder.Build()
+	return service.Request(req, nil)
+}
+
+func TestRequestEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := &requestEventRecorder{}
+	service := newNoAuthTestService(t, server.URL)
+	service.SetRequestEventHandler(recorder.handle)
+
+	_, err := invokeWithRequestEvents(t, service, context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []RequestPhase{RequestPhaseQueued, RequestPhaseSending, RequestPhaseWaiting,
+		RequestPhaseReceiving, RequestPhaseDone}, recorder.phases())
+
+	assert.Equal(t, 0, recorder.events[0].Attempt)
+	for _, event := range recorder.events {
+		assert.Equal(t, http.MethodGet, event.Method)
+		assert.Equal(t, server.URL, event.URL)
+		assert.Nil(t, event.Err)
+		assert.False(t, event.Time.IsZero())
+	}
+	assert.Equal(t, 1, recorder.events[4].Attempt)
+	assert.Equal(t, http.StatusOK, recorder.events[3].StatusCode)
+	assert.Equal(t, http.StatusOK, recorder.events[4].StatusCode)
+
+	// The handler is copied to a clone, and can be removed.
+	clone := service.Clone()
+	recorder.events = nil
+	_, err = invokeWithRequestEvents(t, clone, context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, recorder.events, 5)
+
+	service.SetRequestEventHandler(nil)
+	recorder.events = nil
+	_, err = invokeWithRequestEvents(t, service, context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, recorder.events)
+}
+
+func TestRequestEventsRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := &requestEventRecorder{}
+	service := newNoAuthTestService(t, server.URL)
+	service.EnableRetries(2, 10*time.Millisecond)
+	service.SetRequestEventHandler(recorder.handle)
+
+	_, err := invokeWithRequestEvents(t, service, context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []RequestPhase{RequestPhaseQueued,
+		RequestPhaseSending, RequestPhaseWaiting, RequestPhaseReceiving, RequestPhaseRetrying,
+		RequestPhaseSending, RequestPhaseWaiting, RequestPhaseReceiving, RequestPhaseDone}, recorder.phases())
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.events[4].StatusCode)
+	assert.Equal(t, 1, recorder.events[4].Attempt)
+	assert.Equal(t, 2, recorder.events[8].Attempt)
+	assert.Equal(t, http.StatusOK, recorder.events[8].StatusCode)
+}
+
+func TestRequestEventsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	recorder := &requestEventRecorder{}
+	service := newNoAuthTestService(t, server.URL)
+	service.SetRequestEventHandler(recorder.handle)
+
+	// A request that is rejected before it is sent completes with the error.
+	service.SetReadOnly(true)
+	_, err := invokeMethodWithRequestEvents(t, service, context.Background(), POST)
+	assert.NotNil(t, err)
+	assert.Equal(t, []RequestPhase{RequestPhaseQueued, RequestPhaseDone}, recorder.phases())
+	assert.Equal(t, err, recorder.events[1].Err)
+	assert.Equal(t, 0, recorder.events[1].Attempt)
+
+	// A request whose attempt fails completes with the error.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener.Close()
+	assert.Nil(t, service.SetServiceURL("http://"+listener.Addr().String()))
+	recorder.events = nil
+	_, err = invokeWithRequestEvents(t, service, context.Background())
+	assert.NotNil(t, err)
+	assert.Equal(t, []RequestPhase{RequestPhaseQueued, RequestPhaseSending, RequestPhaseDone}, recorder.phases())
+	assert.Equal(t, err, recorder.events[2].Err)
+	assert.Equal(t, 1, recorder.events[2].Attempt)
+}
+
+func TestRequestEventsContextHandler(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serviceRecorder := &requestEventRecorder{}
+	service := newNoAuthTestService(t, server.URL)
+	service.SetRequestEventHandler(serviceRecorder.handle)
+
+	// Both the service's handler and the context's handler receive the events.
+	events := make(chan *RequestEvent, 10)
+	ctx := WithRequestEventHandler(context.Background(), NewRequestEventChannelHandler(events))
+	_, err := invokeWithRequestEvents(t, service, ctx)
+	assert.Nil(t, err)
+	assert.Len(t, serviceRecorder.events, 5)
+	assert.Len(t, events, 5)
+	assert.Equal(t, RequestPhaseQueued, (<-events).Phase)
+
+	// Events that can't be received are discarded, rather than delaying the request.
+	unbuffered := make(chan *RequestEvent)
+	ctx = WithRequestEventHandler(context.Background(), NewRequestEventChannelHandler(unbuffered))
+	_, err = invokeWithRequestEvents(t, service, ctx)
+	assert.Nil(t, err)
+}
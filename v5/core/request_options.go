@@ -0,0 +1,196 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// Context keys for the per-request behavior controlled by the RequestOption functions below.
+type (
+	retryPolicyKey  struct{}
+	responseIntoKey struct{}
+)
+
+// RequestOption customizes a single invocation of an operation. A generated operation can accept
+// options variadically, e.g.
+//
+//	func (service *MyServiceV1) GetResource(options *GetResourceOptions, opts ...core.RequestOption) (...)
+//
+// and apply them to its RequestBuilder (after adding its own headers and query parameters) via
+// RequestBuilder.ApplyOptions(), which gives users per-call control over the request.
+type RequestOption func(builder *RequestBuilder) error
+
+// ApplyOptions applies "options" (in order) to the RequestBuilder.
+// It returns an error if an option can't be applied.
+func (requestBuilder *RequestBuilder) ApplyOptions(options ...RequestOption) (*RequestBuilder, error) {
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option := option
+		if err := callSafelyWithError(PanicSourceRequestOption, func() error { return option(requestBuilder) }); err != nil {
+			return requestBuilder, err
+		}
+	}
+	return requestBuilder, nil
+}
+
+// getContext returns the Context associated with the RequestBuilder (see WithContext()), or context.Background().
+func (requestBuilder *RequestBuilder) getContext() context.Context {
+	if IsNil(requestBuilder.ctx) {
+		return context.Background()
+	}
+	return requestBuilder.ctx
+}
+
+// WithHeader returns a RequestOption that adds the header "name" with "value" to the request
+// (see RequestBuilder.AddHeader()), replacing the operation's own value of the header, if any.
+func WithHeader(name string, value string) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if name == "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "name")
+		}
+		builder.AddHeader(name, value)
+		return nil
+	}
+}
+
+// WithQueryParam returns a RequestOption that adds the query parameter "name" with "value" to the request
+// (see RequestBuilder.AddQuery()).
+func WithQueryParam(name string, value string) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if name == "" {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "name")
+		}
+		builder.AddQuery(name, value)
+		return nil
+	}
+}
+
+// WithContext returns a RequestOption that associates "ctx" with the request (see RequestBuilder.WithContext()),
+// e.g. so that the request is abandoned when the context's deadline passes.
+func WithContext(ctx context.Context) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if IsNil(ctx) {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "ctx")
+		}
+		builder.WithContext(ctx)
+		return nil
+	}
+}
+
+// WithTimeout returns a RequestOption that fails the request if it doesn't complete within "timeout",
+// including any retries (see WithRequestTimeout()).
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if timeout <= 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "timeout")
+		}
+		builder.WithContext(WithRequestTimeout(builder.getContext(), timeout))
+		return nil
+	}
+}
+
+// RetryPolicy overrides the retry configuration of the service for a single request (see WithRetryPolicy()).
+type RetryPolicy struct {
+	// The maximum number of retries of the request. If 0, the request isn't retried.
+	MaxRetries int
+
+	// The maximum interval between retries. If 0, the service's interval (or the default interval) is used.
+	MaxRetryInterval time.Duration
+
+	// The function that decides whether a failed attempt is retried. If nil, the service's
+	// function (or IBMCloudSDKRetryPolicy) is used.
+	CheckRetry func(ctx context.Context, resp *http.Response, err error) (bool, error)
+}
+
+// WithRetryPolicy returns a RequestOption that causes BaseService.Request() to retry the request
+// according to "policy", whether or not retries are enabled for the service.
+func WithRetryPolicy(policy RetryPolicy) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if policy.MaxRetries < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxRetries")
+		}
+		builder.WithContext(context.WithValue(builder.getContext(), retryPolicyKey{}, &policy))
+		return nil
+	}
+}
+
+// getRetryPolicy returns the retry policy associated with "ctx", or nil.
+func getRetryPolicy(ctx context.Context) *RetryPolicy {
+	policy, _ := ctx.Value(retryPolicyKey{}).(*RetryPolicy)
+	return policy
+}
+
+// applyRetryPolicy returns the retryable client (nil, if the request isn't to be retried) and the
+// non-retryable client with which a request is sent according to "policy".
+// "retryableClient" is the service's retryable client (nil, if retries aren't enabled) and "client"
+// is the service's client.
+func applyRetryPolicy(policy *RetryPolicy, retryableClient *retryablehttp.Client,
+	client *http.Client) (*retryablehttp.Client, *http.Client) {
+	if policy == nil {
+		return retryableClient, client
+	}
+
+	if retryableClient != nil {
+		client = retryableClient.HTTPClient
+	}
+	if policy.MaxRetries == 0 {
+		return nil, client
+	}
+
+	if retryableClient != nil {
+		retryableClient = retryableClientWithTransport(retryableClient, client.Transport)
+	} else {
+		if client == nil {
+			client = DefaultHTTPClient()
+		}
+		retryableClient = newRetryableTransport(client, 0, 0).Client
+	}
+	retryableClient.RetryMax = policy.MaxRetries
+	if policy.MaxRetryInterval > 0 {
+		retryableClient.RetryWaitMax = policy.MaxRetryInterval
+	}
+	if policy.CheckRetry != nil {
+		retryableClient.CheckRetry = policy.CheckRetry
+	}
+	return retryableClient, client
+}
+
+// WithResponseInto returns a RequestOption that causes BaseService.Request() to store the request's
+// DetailedResponse (if any) in "response", even if the operation doesn't return it (e.g. so that
+// a caller can examine the headers of a response that was unmarshalled by a higher-level helper).
+func WithResponseInto(response **DetailedResponse) RequestOption {
+	return func(builder *RequestBuilder) error {
+		if response == nil {
+			return fmt.Errorf(ERRORMSG_PROP_MISSING, "response")
+		}
+		builder.WithContext(context.WithValue(builder.getContext(), responseIntoKey{}, response))
+		return nil
+	}
+}
+
+// storeResponseInto stores "detailedResponse" in the location specified via WithResponseInto() (if any).
+func storeResponseInto(ctx context.Context, detailedResponse *DetailedResponse) {
+	if response, ok := ctx.Value(responseIntoKey{}).(**DetailedResponse); ok {
+		*response = detailedResponse
+	}
+}
@@ -0,0 +1,175 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "trace-1", r.Header.Get("X-Trace"))
+		assert.Equal(t, "override", r.Header.Get("Accept"))
+		assert.Equal(t, []string{"1", "2"}, r.URL.Query()["page"])
+		w.Header().Set("X-Request-Id", "request-1")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{"name": "resource-1"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	var response *DetailedResponse
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "/v1/resources", nil)
+	assert.Nil(t, err)
+	builder.AddHeader("Accept", "application/json")
+	builder.AddQuery("page", "1")
+	_, err = builder.ApplyOptions(
+		WithHeader("X-Trace", "trace-1"),
+		WithHeader("Accept", "override"),
+		WithQueryParam("page", "2"),
+		nil,
+		WithResponseInto(&response),
+	)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+
+	var result map[string]interface{}
+	_, err = service.Request(req, &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "resource-1", result["name"])
+	assert.NotNil(t, response)
+	assert.Equal(t, "request-1", response.GetHeaders().Get("X-Request-Id"))
+
+	// Invalid options are reported.
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithHeader("", "value"))
+	assert.NotNil(t, err)
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithQueryParam("", "value"))
+	assert.NotNil(t, err)
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithContext(nil)) //nolint: staticcheck
+	assert.NotNil(t, err)
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithTimeout(0))
+	assert.NotNil(t, err)
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithRetryPolicy(RetryPolicy{MaxRetries: -1}))
+	assert.NotNil(t, err)
+	_, err = NewRequestBuilder(GET).ApplyOptions(WithResponseInto(nil))
+	assert.NotNil(t, err)
+}
+
+func TestRequestOptionsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// The timeout applies to the context specified by a preceding option.
+	type testKey struct{}
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	_, err = builder.ApplyOptions(
+		WithContext(context.WithValue(context.Background(), testKey{}, "value")),
+		WithTimeout(50*time.Millisecond),
+	)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "value", req.Context().Value(testKey{}))
+
+	_, err = service.Request(req, nil)
+	assert.NotNil(t, err)
+}
+
+func TestRequestOptionsRetryPolicy(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	send := func(options ...RequestOption) (*DetailedResponse, error) {
+		atomic.StoreInt32(&attempts, 0)
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, "", nil)
+		assert.Nil(t, err)
+		_, err = builder.ApplyOptions(options...)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return service.Request(req, nil)
+	}
+
+	// The policy enables retries for a service without retries.
+	response, err := send(WithRetryPolicy(RetryPolicy{MaxRetries: 2, MaxRetryInterval: 10 * time.Millisecond}))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+
+	// The policy disables retries for a service with retries.
+	service.EnableRetries(3, 10*time.Millisecond)
+	response, err = send(WithRetryPolicy(RetryPolicy{}))
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+
+	// The policy limits the number of retries.
+	_, err = send(WithRetryPolicy(RetryPolicy{MaxRetries: 1, MaxRetryInterval: 10 * time.Millisecond}))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+
+	// The policy's function decides whether to retry.
+	var checked int32
+	_, err = send(WithRetryPolicy(RetryPolicy{
+		MaxRetries: 3,
+		CheckRetry: func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+			atomic.AddInt32(&checked, 1)
+			return false, nil
+		},
+	}))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&checked))
+
+	// Without a policy, the service's retry configuration is used.
+	_, err = send()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	assert.Equal(t, 3, getRetryableHTTPClient(service.Client).RetryMax)
+}
@@ -0,0 +1,189 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequestTemplate is an immutable snapshot of a partially-built RequestBuilder
+// from which many RequestBuilder instances can be created efficiently.
+// The service URL is validated and the path is parsed once when the template
+// is created, so that each instantiation only needs to insert the path
+// parameter values.
+// A RequestTemplate is safe for concurrent use.
+type RequestTemplate struct {
+	method                string
+	header                http.Header
+	query                 map[string][]string
+	enableGzipCompression bool
+
+	duplicateHeaderPolicy   DuplicateHeaderPolicy
+	canonicalizeHeaderNames bool
+	preserveHeaderOrder     bool
+	headerOrder             []string
+
+	// The service URL followed by the pre-parsed path.
+	// Literal segments are stored as-is, while path parameter references
+	// (e.g. "{resource_id}") are stored as the path parameter name.
+	urlSegments []templateSegment
+
+	// The total length of the literal segments.
+	literalLength int
+}
+
+// templateSegment is either a literal portion of a request URL, or a reference to a path parameter.
+type templateSegment struct {
+	value       string
+	isPathParam bool
+}
+
+// NewTemplate returns a RequestTemplate that captures the builder's method, headers,
+// query parameters, gzip compression setting and header handling settings, along with the specified service URL
+// and unresolved path (e.g. "/resource/{resource_id}").
+// The builder's body and form data are not captured by the template.
+// This function returns an error if the serviceURL is "" or is an invalid URL string.
+func (requestBuilder *RequestBuilder) NewTemplate(serviceURL string, path string) (*RequestTemplate, error) {
+	if serviceURL == "" {
+		return nil, fmt.Errorf(ERRORMSG_SERVICE_URL_MISSING)
+	}
+	if _, err := url.Parse(serviceURL); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_SERVICE_URL_INVALID, err.Error())
+	}
+
+	// Join the service URL and path while avoiding a double slash
+	// (this mirrors the logic in ResolveRequestURL).
+	urlString := serviceURL
+	if path != "" {
+		if strings.HasSuffix(urlString, "/") {
+			path = strings.TrimPrefix(path, "/")
+		} else if !strings.HasPrefix(path, "/") {
+			urlString += "/"
+		}
+	}
+
+	template := &RequestTemplate{
+		method:                requestBuilder.Method,
+		header:                requestBuilder.Header.Clone(),
+		query:                 copyQueryMap(requestBuilder.Query),
+		enableGzipCompression: requestBuilder.EnableGzipCompression,
+		urlSegments:           parseTemplatePath(urlString, path),
+
+		duplicateHeaderPolicy:   requestBuilder.DuplicateHeaderPolicy,
+		canonicalizeHeaderNames: requestBuilder.CanonicalizeHeaderNames,
+		preserveHeaderOrder:     requestBuilder.PreserveHeaderOrder,
+		headerOrder:             requestBuilder.HeaderOrder(),
+	}
+	for _, segment := range template.urlSegments {
+		if !segment.isPathParam {
+			template.literalLength += len(segment.value)
+		}
+	}
+	return template, nil
+}
+
+// NewRequestBuilder returns a new RequestBuilder initialized from the template, with
+// its URL resolved using the specified path parameter values (keyed by the path
+// parameter name). Each value is path-escaped before it is inserted into the URL.
+// This function returns an error if a path parameter referenced by the template
+// is missing or empty.
+func (template *RequestTemplate) NewRequestBuilder(pathParams map[string]string) (*RequestBuilder, error) {
+	var sb strings.Builder
+	// Reserve room for the literal segments plus a typical path parameter value for each segment.
+	sb.Grow(template.literalLength + 32*len(template.urlSegments))
+	for _, segment := range template.urlSegments {
+		if !segment.isPathParam {
+			sb.WriteString(segment.value)
+			continue
+		}
+
+		v := pathParams[segment.value]
+		if v == "" {
+			return nil, fmt.Errorf(ERRORMSG_PATH_PARAM_EMPTY, segment.value)
+		}
+		sb.WriteString(url.PathEscape(v))
+	}
+
+	URL, err := url.Parse(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_SERVICE_URL_INVALID, err.Error())
+	}
+
+	builder := &RequestBuilder{
+		Method:                template.method,
+		URL:                   URL,
+		Header:                template.header.Clone(),
+		Query:                 copyQueryMap(template.query),
+		Form:                  make(map[string][]FormData),
+		EnableGzipCompression: template.enableGzipCompression,
+
+		DuplicateHeaderPolicy:   template.duplicateHeaderPolicy,
+		CanonicalizeHeaderNames: template.canonicalizeHeaderNames,
+		PreserveHeaderOrder:     template.preserveHeaderOrder,
+		headerOrder:             append([]string(nil), template.headerOrder...),
+	}
+	if builder.Header == nil {
+		builder.Header = make(http.Header)
+	}
+	return builder, nil
+}
+
+// parseTemplatePath returns the segments of the URL formed by appending "path" to "urlPrefix".
+// Path parameter references (e.g. "{resource_id}") are identified only within "path".
+func parseTemplatePath(urlPrefix string, path string) []templateSegment {
+	segments := []templateSegment{}
+	literal := urlPrefix
+
+	for {
+		start := strings.Index(path, "{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(path[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		// Use the innermost '{' in case of a stray '{' preceding the reference.
+		start += strings.LastIndexByte(path[start:end], '{')
+
+		literal += path[:start]
+		if literal != "" {
+			segments = append(segments, templateSegment{value: literal})
+		}
+		segments = append(segments, templateSegment{value: path[start+1 : end], isPathParam: true})
+
+		literal = ""
+		path = path[end+1:]
+	}
+
+	literal += path
+	if literal != "" {
+		segments = append(segments, templateSegment{value: literal})
+	}
+	return segments
+}
+
+// copyQueryMap returns a deep copy of the specified query parameter map.
+func copyQueryMap(query map[string][]string) map[string][]string {
+	result := make(map[string][]string, len(query))
+	for k, v := range query {
+		result[k] = append([]string(nil), v...)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ResponseAttestation records the SHA-256 digest of an operation response body, so that
+// a compliance workflow can prove which data was retrieved from a service.
+type ResponseAttestation struct {
+	// The method and URL of the request.
+	Method string
+	URL    string
+
+	// The status code of the response.
+	StatusCode int
+
+	// The time at which the response was received.
+	Time time.Time
+
+	// The hex-encoded SHA-256 digest and the size of the bytes read from the response body.
+	SHA256 string
+	Size   int64
+
+	// True if the entire response body was read. If the body was closed before it was
+	// entirely read (or could not be read), SHA256 and Size describe only the bytes read.
+	Complete bool
+}
+
+// ResponseAttestor is a function that is invoked with the attestation of each operation response.
+type ResponseAttestor func(attestation *ResponseAttestation)
+
+// SetResponseAttestor sets the function that is invoked with the attestation of each operation
+// response (including error responses) received by the service. The SHA-256 digest is computed
+// over the response body as it was received (i.e. before any ResponseTransform is applied) while
+// the body is read, and the attestor is invoked once the body has been entirely read, or is closed.
+// For a streamed response (i.e. when the result is an io.ReadCloser), that happens only when the
+// caller reads or closes the body, so the attestor may be invoked after Request() has returned.
+// A nil value removes any previously-set attestor.
+func (service *BaseService) SetResponseAttestor(attestor ResponseAttestor) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.responseAttestor = attestor
+}
+
+// attestResponse replaces the body of "resp" (the response to "req") with a reader that
+// computes the body's digest and invokes "attestor" once the body has been read or closed.
+func attestResponse(req *http.Request, resp *http.Response, attestor ResponseAttestor) {
+	if attestor == nil {
+		return
+	}
+
+	body := &attestingBody{
+		attestation: ResponseAttestation{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Time:       GetClock().Now(),
+		},
+		hash:     sha256.New(),
+		attestor: attestor,
+	}
+	if resp.Body == nil {
+		body.attest(true)
+		return
+	}
+	body.body = resp.Body
+	resp.Body = body
+}
+
+// attestingBody is a response body that computes the digest of the bytes read from it.
+type attestingBody struct {
+	body        io.ReadCloser
+	attestation ResponseAttestation
+	hash        hash.Hash
+	attestor    ResponseAttestor
+	once        sync.Once
+}
+
+func (body *attestingBody) Read(p []byte) (int, error) {
+	n, err := body.body.Read(p)
+	if n > 0 {
+		_, _ = body.hash.Write(p[:n])
+		body.attestation.Size += int64(n)
+	}
+	if err == io.EOF {
+		body.attest(true)
+	}
+	return n, err
+}
+
+func (body *attestingBody) Close() error {
+	body.attest(false)
+	return body.body.Close()
+}
+
+// attest invokes the attestor (only once) with the digest of the bytes read so far.
+func (body *attestingBody) attest(complete bool) {
+	body.once.Do(func() {
+		attestation := body.attestation
+		attestation.SHA256 = hex.EncodeToString(body.hash.Sum(nil))
+		attestation.Complete = complete
+		callSafely(PanicSourceResponseAttestor, func() { body.attestor(&attestation) })
+	})
+}
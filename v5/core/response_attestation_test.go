@@ -0,0 +1,118 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseAttestor(t *testing.T) {
+	// Debug logging reads (and dumps) each response body before Request() returns.
+	original := GetLogger()
+	defer SetLogger(original)
+	_, _, logger := stringLogger(LevelError)
+	SetLogger(logger)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE, "application/json")
+		if r.URL.Path == "/v1/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"instance-1"}`))
+	}))
+	defer server.Close()
+
+	digest := func(body string) string {
+		sum := sha256.Sum256([]byte(body))
+		return hex.EncodeToString(sum[:])
+	}
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	var attestations []*ResponseAttestation
+	service.SetResponseAttestor(func(attestation *ResponseAttestation) {
+		attestations = append(attestations, attestation)
+	})
+	newRequest := func(path string) *http.Request {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// The attestor is invoked for successful and error responses.
+	var result map[string]interface{}
+	_, err = service.Request(newRequest("/v1/instances/1"), &result)
+	assert.Nil(t, err)
+	_, err = service.Request(newRequest("/v1/missing"), &result)
+	assert.NotNil(t, err)
+	assert.Len(t, attestations, 2)
+	assert.Equal(t, GET, attestations[0].Method)
+	assert.Equal(t, server.URL+"/v1/instances/1", attestations[0].URL)
+	assert.Equal(t, http.StatusOK, attestations[0].StatusCode)
+	assert.Equal(t, digest(`{"name":"instance-1"}`), attestations[0].SHA256)
+	assert.Equal(t, int64(len(`{"name":"instance-1"}`)), attestations[0].Size)
+	assert.True(t, attestations[0].Complete)
+	assert.False(t, attestations[0].Time.IsZero())
+	assert.Equal(t, http.StatusNotFound, attestations[1].StatusCode)
+	assert.Equal(t, digest(`{"error":"not found"}`), attestations[1].SHA256)
+
+	// For a streamed response, the attestor is invoked once the caller has read the body.
+	var stream io.ReadCloser
+	_, err = service.Request(newRequest("/v1/instances/1"), &stream)
+	assert.Nil(t, err)
+	assert.Len(t, attestations, 2)
+	_, err = ioutil.ReadAll(stream)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Close())
+	assert.Len(t, attestations, 3)
+	assert.True(t, attestations[2].Complete)
+	assert.Equal(t, digest(`{"name":"instance-1"}`), attestations[2].SHA256)
+
+	// A body closed before it was entirely read is attested as incomplete.
+	_, err = service.Request(newRequest("/v1/instances/1"), &stream)
+	assert.Nil(t, err)
+	_, err = stream.Read(make([]byte, 5))
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Close())
+	assert.Len(t, attestations, 4)
+	assert.False(t, attestations[3].Complete)
+	assert.Equal(t, int64(5), attestations[3].Size)
+	assert.Equal(t, digest(`{"nam`), attestations[3].SHA256)
+
+	// The attestor is shared by clones, and can be removed.
+	_, err = service.Clone().Request(newRequest("/v1/instances/1"), &result)
+	assert.Nil(t, err)
+	assert.Len(t, attestations, 5)
+	service.SetResponseAttestor(nil)
+	_, err = service.Request(newRequest("/v1/instances/1"), &result)
+	assert.Nil(t, err)
+	assert.Len(t, attestations, 5)
+}
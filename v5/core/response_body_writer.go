@@ -0,0 +1,66 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// ResponseBodyWriter is a result argument for BaseService.Request() that causes the response
+// body of a successful operation to be copied directly to a caller-supplied io.Writer (e.g. a
+// file, pipe or hash), rather than being buffered or unmarshalled. It is intended for large
+// exports. The size and SHA-256 checksum of the body are available via the DetailedResponse's
+// GetBodySize() and GetBodyChecksum() methods.
+type ResponseBodyWriter struct {
+	Writer io.Writer
+}
+
+// NewResponseBodyWriter returns a ResponseBodyWriter that copies the response body to "w".
+func NewResponseBodyWriter(w io.Writer) *ResponseBodyWriter {
+	return &ResponseBodyWriter{Writer: w}
+}
+
+// GetBodySize returns the number of bytes of the response body that were copied
+// to a ResponseBodyWriter.
+func (response *DetailedResponse) GetBodySize() int64 {
+	return response.bodySize
+}
+
+// GetBodyChecksum returns the hex-encoded SHA-256 checksum of the response body that
+// was copied to a ResponseBodyWriter, or "" if the body wasn't copied.
+func (response *DetailedResponse) GetBodyChecksum() string {
+	return response.bodyChecksum
+}
+
+// copyResponseBody copies "body" to "bodyWriter" (using a pooled buffer of "bufferSize" bytes),
+// recording its size and checksum in "detailedResponse".
+func copyResponseBody(body io.Reader, bodyWriter *ResponseBodyWriter, detailedResponse *DetailedResponse, bufferSize int) error {
+	buf := getDownloadBuffer(bufferSize)
+	defer putDownloadBuffer(buf)
+
+	hash := sha256.New()
+	n, err := io.CopyBuffer(io.MultiWriter(bodyWriter.Writer, hash), body, *buf)
+	detailedResponse.bodySize = n
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_COPY_RESPONSE_BODY, err.Error())
+	}
+	detailedResponse.bodyChecksum = hex.EncodeToString(hash.Sum(nil))
+	detailedResponse.Result = bodyWriter.Writer
+	return nil
+}
@@ -0,0 +1,79 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseBodyWriter(t *testing.T) {
+	export := strings.Repeat(`{"id": 1, "name": "row"}`+"\n", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "export not found"}`))
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+		_, _ = w.Write([]byte(export))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	newRequest := func(path string) *http.Request {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// The body is copied as is (even though it's JSON), along with its size and checksum.
+	var buf bytes.Buffer
+	detailedResponse, err := service.Request(newRequest("/export"), NewResponseBodyWriter(&buf))
+	assert.Nil(t, err)
+	assert.Equal(t, export, buf.String())
+	assert.Equal(t, int64(len(export)), detailedResponse.GetBodySize())
+	sum := sha256.Sum256([]byte(export))
+	assert.Equal(t, hex.EncodeToString(sum[:]), detailedResponse.GetBodyChecksum())
+	assert.Equal(t, &buf, detailedResponse.GetResult())
+
+	// A write error is returned.
+	detailedResponse, err = service.Request(newRequest("/export"), NewResponseBodyWriter(&failingWriter{}))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+	assert.Equal(t, "", detailedResponse.GetBodyChecksum())
+
+	// An error response is not copied.
+	buf.Reset()
+	detailedResponse, err = service.Request(newRequest("/missing"), NewResponseBodyWriter(&buf))
+	assert.NotNil(t, err)
+	assert.Equal(t, "export not found", err.Error())
+	assert.Equal(t, 0, buf.Len())
+	assert.Equal(t, int64(0), detailedResponse.GetBodySize())
+}
@@ -0,0 +1,528 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The default length of time that a cached response is considered fresh.
+	defaultResponseCacheTTL = time.Minute
+
+	// The default maximum number of entries of an in-memory response cache.
+	defaultMemoryCacheMaxEntries = 1000
+
+	headerNameAge          = "Age"
+	headerNameCacheControl = "Cache-Control"
+	headerNameVary         = "Vary"
+	headerNameWarning      = "Warning"
+
+	// Warning header values (RFC 7234) added to stale responses served from the cache.
+	warningResponseIsStale    = `110 - "Response is Stale"`
+	warningRevalidationFailed = `111 - "Revalidation Failed"`
+)
+
+// The Warning header codes (RFC 7234) that indicate a stale response.
+var staleWarningCodes = []string{"110", "111", "112"}
+
+// The request headers that carry credentials, whose values are part of each cache key
+// (in addition to any headers added by the service's authenticator).
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// credentialHeadersKey is the context key of the names of the headers added to a request by
+// the service's authenticator (see withCredentialHeaders()).
+type credentialHeadersKey struct{}
+
+// withCredentialHeaders returns a copy of "ctx" that records the names of the headers added to
+// a request by the service's authenticator (e.g. an APIKeyHeaderAuthenticator's apikey header),
+// so that responses are never shared between credentials.
+func withCredentialHeaders(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, credentialHeadersKey{}, names)
+}
+
+// changedHeaders returns the (sorted) names of the headers in "after" whose values differ from
+// those in "before" (or nil if "before" is nil).
+func changedHeaders(before http.Header, after http.Header) (names []string) {
+	if before == nil {
+		return nil
+	}
+	for name, values := range after {
+		if strings.Join(values, ",") != strings.Join(before[name], ",") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CacheEntry is a response stored in a response cache.
+type CacheEntry struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+
+	// The time at which the response was received.
+	StoredAt time.Time `json:"stored_at"`
+
+	// The values of the request headers named by the response's Vary header. The entry is returned
+	// only for requests with the same values.
+	RequestHeader http.Header `json:"request_header,omitempty"`
+}
+
+// CacheStorage is the interface implemented by the storage used by a response cache.
+// Implementations must be safe for concurrent use.
+type CacheStorage interface {
+	// Get returns the entry stored with the specified key, or nil if there is no such entry.
+	Get(key string) (*CacheEntry, error)
+
+	// Set stores "entry" with the specified key, replacing any existing entry.
+	Set(key string, entry *CacheEntry) error
+
+	// Delete removes the entry stored with the specified key, if any.
+	Delete(key string) error
+}
+
+// ResponseCacheOptions holds the configuration of a response cache.
+type ResponseCacheOptions struct {
+	// The storage used to hold cached responses; defaults to an in-memory storage that holds up to
+	// 1000 entries, and evicts entries that are too old to be returned [optional].
+	Storage CacheStorage
+
+	// The length of time that a cached response is considered fresh;
+	// defaults to 1 minute [optional].
+	TTL time.Duration
+
+	// The length of time (after the response is no longer fresh) during which a stale
+	// response is returned while the cached response is revalidated in the background [optional].
+	StaleWhileRevalidate time.Duration
+
+	// The length of time (after the response is no longer fresh) during which a stale
+	// response is returned if the request fails due to a transport error or a
+	// 5xx status code [optional].
+	StaleIfError time.Duration
+
+	// If true, the cached response (however stale) is returned if the request fails due to an
+	// outage of the service, i.e. a 5xx status code or a retryable transport error (see
+	// IsRetryableTransportError()), for applications (e.g. dashboards) that prefer stale data
+	// over errors. The cached response is flagged as stale (see DetailedResponse.IsStale()).
+	// Errors that aren't caused by an outage (e.g. a canceled request) are returned [optional].
+	ServeStaleOnOutage bool
+}
+
+// responseCacheTransport is an http.RoundTripper that caches successful responses to GET requests.
+type responseCacheTransport struct {
+	next    http.RoundTripper
+	options ResponseCacheOptions
+
+	// The keys of the entries that are currently being revalidated in the background.
+	revalidating      map[string]bool
+	revalidatingMutex sync.Mutex
+}
+
+// NewResponseCacheTransport returns an http.RoundTripper that sends requests via "transport"
+// (or http.DefaultTransport if nil) and caches successful (200) responses to GET requests.
+// Responses are cached separately for each URL and the values of the headers that carry the request's
+// credentials (the Authorization, Proxy-Authorization and Cookie headers, and any header added by the
+// service's authenticator), and a cached response is returned only for requests whose headers named
+// by the response's Vary header have the same values. Responses containing a "Vary: *" header are
+// not cached.
+// Requests containing a "Cache-Control: no-cache" or "no-store" header bypass the cache,
+// and responses containing a "Cache-Control: no-store" header are not cached.
+// Stale responses returned from the cache contain a "Warning" header.
+func NewResponseCacheTransport(transport http.RoundTripper, options *ResponseCacheOptions) http.RoundTripper {
+	if IsNil(transport) {
+		transport = http.DefaultTransport
+	}
+
+	cache := &responseCacheTransport{
+		next:         transport,
+		revalidating: make(map[string]bool),
+	}
+	if options != nil {
+		cache.options = *options
+	}
+	if cache.options.TTL <= 0 {
+		cache.options.TTL = defaultResponseCacheTTL
+	}
+	if IsNil(cache.options.Storage) {
+		storageOptions := &MemoryCacheStorageOptions{}
+		if !cache.options.ServeStaleOnOutage {
+			storageOptions.TTL = cache.options.TTL + cache.options.StaleWhileRevalidate
+			if staleIfError := cache.options.TTL + cache.options.StaleIfError; staleIfError > storageOptions.TTL {
+				storageOptions.TTL = staleIfError
+			}
+		}
+		cache.options.Storage = NewMemoryCacheStorageWithOptions(storageOptions)
+	}
+	return cache
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (cache *responseCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasCacheControlDirective(req.Header, "no-store") {
+		return cache.next.RoundTrip(req)
+	}
+
+	key := responseCacheKey(req)
+	if hasCacheControlDirective(req.Header, "no-cache") {
+		return cache.fetch(req, key)
+	}
+
+	entry, err := cache.options.Storage.Get(key)
+	if err != nil {
+		GetLogger().Warn("Unable to read response cache entry: %s", err.Error())
+		entry = nil
+	}
+	if entry == nil || !entry.matches(req) {
+		return cache.fetch(req, key)
+	}
+
+	staleness := time.Since(entry.StoredAt) - cache.options.TTL
+	if staleness <= 0 {
+		return entry.toResponse(req, ""), nil
+	}
+
+	if staleness <= cache.options.StaleWhileRevalidate {
+		cache.revalidate(req, key)
+		return entry.toResponse(req, warningResponseIsStale), nil
+	}
+
+	resp, err := cache.fetch(req, key)
+	if (staleness <= cache.options.StaleIfError && (err != nil || resp.StatusCode >= 500)) ||
+		(cache.options.ServeStaleOnOutage && isOutage(resp, err)) {
+		if resp != nil {
+			resp.Body.Close() // #nosec G104
+		}
+		GetLogger().Debug("Returning a stale cached response (stored at %s) for %s %s",
+			entry.StoredAt.Format(time.RFC3339), req.Method, RedactSecrets(req.URL.String()))
+		return entry.toResponse(req, warningRevalidationFailed), nil
+	}
+	return resp, err
+}
+
+// isOutage returns true iff the response "resp" or error "err" indicates that the service is
+// unavailable (i.e. a 5xx status code or a retryable transport error).
+func isOutage(resp *http.Response, err error) bool {
+	if err != nil {
+		return IsRetryableTransportError(err)
+	}
+	return resp.StatusCode >= 500
+}
+
+// fetch sends "req" and stores a cacheable response in the cache.
+func (cache *responseCacheTransport) fetch(req *http.Request, key string) (*http.Response, error) {
+	resp, err := cache.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || hasCacheControlDirective(resp.Header, "no-store") {
+		return resp, err
+	}
+	varyHeaders, cacheable := parseVary(resp.Header)
+	if !cacheable {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close() // #nosec G104
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := &CacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   time.Now(),
+	}
+	if len(varyHeaders) > 0 {
+		entry.RequestHeader = make(http.Header)
+		for _, name := range varyHeaders {
+			if values := req.Header.Values(name); len(values) > 0 {
+				entry.RequestHeader[name] = values
+			}
+		}
+	}
+	if err := cache.options.Storage.Set(key, entry); err != nil {
+		GetLogger().Warn("Unable to store response cache entry: %s", err.Error())
+	}
+	return resp, nil
+}
+
+// revalidate refreshes the cache entry for "req" in the background, unless
+// the entry is already being revalidated.
+func (cache *responseCacheTransport) revalidate(req *http.Request, key string) {
+	cache.revalidatingMutex.Lock()
+	defer cache.revalidatingMutex.Unlock()
+	if cache.revalidating[key] {
+		return
+	}
+	cache.revalidating[key] = true
+
+	// The original request's context may be cancelled once its response is returned.
+	backgroundReq := req.Clone(context.Background())
+	go func() {
+		defer func() {
+			cache.revalidatingMutex.Lock()
+			delete(cache.revalidating, key)
+			cache.revalidatingMutex.Unlock()
+		}()
+
+		resp, err := cache.fetch(backgroundReq, key)
+		if err != nil {
+			GetLogger().Debug("Unable to revalidate response cache entry: %s", err.Error())
+			return
+		}
+		resp.Body.Close() // #nosec G104
+	}()
+}
+
+// toResponse returns a new http.Response containing the cached response, with an Age header
+// (RFC 7234) that identifies it as a cached response.
+// If "warning" is non-empty, it is added to the response as a Warning header.
+func (entry *CacheEntry) toResponse(req *http.Request, warning string) *http.Response {
+	header := entry.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(headerNameAge, strconv.FormatInt(int64(time.Since(entry.StoredAt)/time.Second), 10))
+	if warning != "" {
+		header.Add(headerNameWarning, warning)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// matches returns true iff the entry can be returned for "req", i.e. the values of the request
+// headers named by the cached response's Vary header are those of the original request.
+func (entry *CacheEntry) matches(req *http.Request) bool {
+	varyHeaders, _ := parseVary(entry.Header)
+	for _, name := range varyHeaders {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(entry.RequestHeader.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseVary returns the (canonical) names of the request headers named by the Vary header
+// in "header", and false if the response can't be cached (i.e. it contains "Vary: *").
+func parseVary(header http.Header) (names []string, cacheable bool) {
+	for _, value := range header.Values(headerNameVary) {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, true
+}
+
+// responseCacheKey returns the cache key for "req". The key includes a hash of the
+// values of the request's credential headers (see credentialHeaders), and of the headers
+// added by the service's authenticator, so that responses are never shared between credentials.
+func responseCacheKey(req *http.Request) string {
+	names := credentialHeaders
+	if added, ok := req.Context().Value(credentialHeadersKey{}).([]string); ok {
+		names = append(append([]string{}, names...), added...)
+	}
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s: %s\n", http.CanonicalHeaderKey(name), strings.Join(req.Header.Values(name), ","))
+	}
+	return req.Method + " " + req.URL.String() + " " + hex.EncodeToString(hash.Sum(nil))
+}
+
+// hasCacheControlDirective returns true iff "header" contains a Cache-Control header
+// with the specified directive.
+func hasCacheControlDirective(header http.Header, directive string) bool {
+	for _, value := range header.Values(headerNameCacheControl) {
+		for _, d := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), directive) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MemoryCacheStorageOptions holds the configuration of an in-memory CacheStorage.
+type MemoryCacheStorageOptions struct {
+	// The maximum number of entries. When exceeded, the least recently used entries are evicted.
+	// Defaults to 1000; a negative value means no limit [optional].
+	MaxEntries int
+
+	// The maximum age of an entry. Older entries are evicted.
+	// Zero means that entries are not evicted based on their age [optional].
+	TTL time.Duration
+}
+
+// memoryCacheStorage is a CacheStorage that holds entries in memory.
+type memoryCacheStorage struct {
+	options MemoryCacheStorageOptions
+
+	// The elements of "lru" (whose values are *memoryCacheItem), by key.
+	entries map[string]*list.Element
+
+	// The entries, from the most to the least recently used.
+	lru *list.List
+
+	mutex sync.Mutex
+}
+
+// memoryCacheItem is an entry of a memoryCacheStorage.
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStorage returns a CacheStorage that holds up to 1000 entries in memory
+// (evicting the least recently used entries).
+func NewMemoryCacheStorage() CacheStorage {
+	return NewMemoryCacheStorageWithOptions(nil)
+}
+
+// NewMemoryCacheStorageWithOptions returns a CacheStorage that holds entries in memory,
+// with the specified configuration (which may be nil).
+func NewMemoryCacheStorageWithOptions(options *MemoryCacheStorageOptions) CacheStorage {
+	storage := &memoryCacheStorage{
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if options != nil {
+		storage.options = *options
+	}
+	if storage.options.MaxEntries == 0 {
+		storage.options.MaxEntries = defaultMemoryCacheMaxEntries
+	}
+	return storage
+}
+
+func (storage *memoryCacheStorage) Get(key string) (*CacheEntry, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	element, ok := storage.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := element.Value.(*memoryCacheItem)
+	if storage.isExpired(item.entry) {
+		storage.remove(element)
+		return nil, nil
+	}
+	storage.lru.MoveToFront(element)
+	return item.entry, nil
+}
+
+func (storage *memoryCacheStorage) Set(key string, entry *CacheEntry) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if element, ok := storage.entries[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		storage.lru.MoveToFront(element)
+	} else {
+		storage.entries[key] = storage.lru.PushFront(&memoryCacheItem{key: key, entry: entry})
+	}
+	storage.evict()
+	return nil
+}
+
+func (storage *memoryCacheStorage) Delete(key string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if element, ok := storage.entries[key]; ok {
+		storage.remove(element)
+	}
+	return nil
+}
+
+// evict removes the entries that have exceeded the TTL and, if the number of remaining entries
+// exceeds the maximum, the least recently used entries. The caller must hold the storage's mutex.
+func (storage *memoryCacheStorage) evict() {
+	if storage.options.TTL > 0 {
+		for element := storage.lru.Front(); element != nil; {
+			next := element.Next()
+			if storage.isExpired(element.Value.(*memoryCacheItem).entry) {
+				storage.remove(element)
+			}
+			element = next
+		}
+	}
+	for storage.options.MaxEntries > 0 && storage.lru.Len() > storage.options.MaxEntries {
+		storage.remove(storage.lru.Back())
+	}
+}
+
+// isExpired returns true iff "entry" has exceeded the storage's TTL.
+func (storage *memoryCacheStorage) isExpired(entry *CacheEntry) bool {
+	return storage.options.TTL > 0 && time.Since(entry.StoredAt) > storage.options.TTL
+}
+
+// remove removes "element" from the storage. The caller must hold the storage's mutex.
+func (storage *memoryCacheStorage) remove(element *list.Element) {
+	storage.lru.Remove(element)
+	delete(storage.entries, element.Value.(*memoryCacheItem).key)
+}
+
+// IsStale returns true iff the response is a stale response returned from a cache (see
+// NewResponseCacheTransport()), e.g. because the service is unavailable. A stale response
+// contains a "Warning" header with the code 110, 111 or 112 (RFC 7234), which may also be
+// added by an intermediate HTTP cache.
+func (response *DetailedResponse) IsStale() bool {
+	return response.stale
+}
+
+// isStaleResponse returns true iff "header" contains a Warning header indicating a stale response.
+func isStaleResponse(header http.Header) bool {
+	for _, warning := range header.Values(headerNameWarning) {
+		code := strings.TrimSpace(warning)
+		if i := strings.IndexByte(code, ' '); i >= 0 {
+			code = code[:i]
+		}
+		if SliceContains(staleWarningCodes, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCacheTestServer returns a server whose responses contain the number of requests
+// received so far, along with the status code returned by "status".
+func newCacheTestServer(requests *int32, status func() int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status())
+		fmt.Fprintf(w, `{"name": "response-%d"}`, n)
+	}))
+}
+
+func newCacheTestService(t *testing.T, serverURL string, options *ResponseCacheOptions) *BaseService {
+	service := newNoAuthTestService(t, serverURL)
+	service.SetHTTPClient(&http.Client{Transport: NewResponseCacheTransport(nil, options)})
+	return service
+}
+
+// invokeCacheTest invokes a GET request and returns the "name" property of the result
+// along with the response's Warning header.
+func invokeCacheTest(t *testing.T, service *BaseService, headers map[string]string) (string, string, error) {
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resource", nil)
+	assert.Nil(t, err)
+	for k, v := range headers {
+		builder.AddHeader(k, v)
+	}
+	req, _ := builder.Build()
+
+	var foo *Foo
+	response, err := service.Request(req, &foo)
+	if err != nil {
+		return "", "", err
+	}
+	return *foo.Name, response.Headers.Get(headerNameWarning), nil
+}
+
+func TestResponseCache(t *testing.T) {
+	var requests int32
+	server := newCacheTestServer(&requests, func() int { return http.StatusOK })
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, &ResponseCacheOptions{TTL: 50 * time.Millisecond})
+
+	name, warning, err := invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+	assert.Equal(t, "", warning)
+
+	// Fresh responses are served from the cache.
+	name, _, err = invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// Responses are cached separately for each credential.
+	name, _, err = invokeCacheTest(t, service, map[string]string{"Authorization": "Bearer token"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-2", name)
+
+	// The cache can be bypassed by the request.
+	name, _, err = invokeCacheTest(t, service, map[string]string{headerNameCacheControl: "no-cache"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-3", name)
+	name, _, err = invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-3", name)
+
+	// Once the TTL has elapsed, a new response is obtained.
+	time.Sleep(60 * time.Millisecond)
+	name, _, err = invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-4", name)
+}
+
+func TestResponseCacheNotCacheable(t *testing.T) {
+	var requests int32
+	status := int32(http.StatusNotFound)
+	server := newCacheTestServer(&requests, func() int { return int(atomic.LoadInt32(&status)) })
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, nil)
+
+	// Unsuccessful responses are not cached.
+	_, _, err := invokeCacheTest(t, service, nil)
+	assert.NotNil(t, err)
+	_, _, err = invokeCacheTest(t, service, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Non-GET requests are not cached.
+	atomic.StoreInt32(&status, http.StatusOK)
+	for i := 0; i < 2; i++ {
+		builder := NewRequestBuilder(POST)
+		_, err = builder.ResolveRequestURL(server.URL, "/resource", nil)
+		assert.Nil(t, err)
+		req, _ := builder.Build()
+		_, err = service.Request(req, nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&requests))
+}
+
+func TestResponseCacheCredentialHeaders(t *testing.T) {
+	var requests int32
+	server := newCacheTestServer(&requests, func() int { return http.StatusOK })
+	defer server.Close()
+
+	// Services that authenticate with different apikeys (in a custom header) share a cache.
+	transport := NewResponseCacheTransport(nil, nil)
+	newService := func(apikey string) *BaseService {
+		authenticator, err := NewAPIKeyHeaderAuthenticator(apikey, "X-Subscription-Key", "")
+		assert.Nil(t, err)
+		service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: authenticator})
+		assert.Nil(t, err)
+		service.SetHTTPClient(&http.Client{Transport: transport})
+		return service
+	}
+	service1 := newService("apikey-1")
+	service2 := newService("apikey-2")
+
+	// Responses are cached separately for each apikey.
+	name, _, err := invokeCacheTest(t, service1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+	name, _, err = invokeCacheTest(t, service2, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-2", name)
+	name, _, err = invokeCacheTest(t, service1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+
+	// Cookies are credentials, too.
+	name, _, err = invokeCacheTest(t, service1, map[string]string{"Cookie": "session=abc"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-3", name)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Cache-Everything") == "false" {
+			w.Header().Set(headerNameVary, "*")
+		} else {
+			w.Header().Set(headerNameVary, "Accept-Language")
+		}
+		fmt.Fprintf(w, `{"name": "response-%d-%s"}`, n, r.Header.Get("Accept-Language"))
+	}))
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, nil)
+
+	// A cached response is returned only for requests whose headers named by its Vary header match.
+	name, _, err := invokeCacheTest(t, service, map[string]string{"Accept-Language": "en"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1-en", name)
+	name, _, err = invokeCacheTest(t, service, map[string]string{"Accept-Language": "en"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1-en", name)
+	name, _, err = invokeCacheTest(t, service, map[string]string{"Accept-Language": "fr"})
+	assert.Nil(t, err)
+	assert.Equal(t, "response-2-fr", name)
+	name, _, err = invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-3-", name)
+
+	// Responses containing "Vary: *" are not cached.
+	service = newCacheTestService(t, server.URL, nil)
+	for i := 0; i < 2; i++ {
+		_, _, err = invokeCacheTest(t, service, map[string]string{"Cache-Everything": "false"})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests))
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var requests int32
+	server := newCacheTestServer(&requests, func() int { return http.StatusOK })
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, &ResponseCacheOptions{
+		TTL:                  20 * time.Millisecond,
+		StaleWhileRevalidate: time.Minute,
+	})
+
+	name, _, err := invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+
+	// The stale response is returned immediately while it is revalidated in the background.
+	time.Sleep(30 * time.Millisecond)
+	name, warning, err := invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+	assert.Equal(t, warningResponseIsStale, warning)
+
+	assert.Eventually(t, func() bool {
+		name, warning, err := invokeCacheTest(t, service, nil)
+		return err == nil && name == "response-2" && warning == ""
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestResponseCacheStaleIfError(t *testing.T) {
+	var requests int32
+	status := int32(http.StatusOK)
+	server := newCacheTestServer(&requests, func() int { return int(atomic.LoadInt32(&status)) })
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, &ResponseCacheOptions{
+		TTL:          20 * time.Millisecond,
+		StaleIfError: 50 * time.Millisecond,
+	})
+
+	name, _, err := invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+
+	// During an outage, the stale response is returned.
+	atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+	time.Sleep(30 * time.Millisecond)
+	name, warning, err := invokeCacheTest(t, service, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "response-1", name)
+	assert.Equal(t, warningRevalidationFailed, warning)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Once the stale-if-error window has elapsed, the error is returned.
+	time.Sleep(50 * time.Millisecond)
+	_, _, err = invokeCacheTest(t, service, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, getStatusCode(err))
+}
+
+// roundTripperFunc is an http.RoundTripper implemented by a function.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestResponseCacheStaleIfTransportError(t *testing.T) {
+	storage := NewMemoryCacheStorage()
+	transport := NewResponseCacheTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("connection refused")
+	}), &ResponseCacheOptions{
+		Storage:      storage,
+		TTL:          time.Minute,
+		StaleIfError: time.Minute,
+	})
+
+	req, _ := http.NewRequest(GET, "https://myservice.cloud.ibm.com/resource", nil)
+	key := responseCacheKey(req)
+	err := storage.Set(key, &CacheEntry{
+		StatusCode: http.StatusOK,
+		Body:       []byte("cached"),
+		StoredAt:   time.Now().Add(-90 * time.Second),
+	})
+	assert.Nil(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, warningRevalidationFailed, resp.Header.Get(headerNameWarning))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "cached", string(body))
+
+	// Outside of the stale-if-error window, the error is returned.
+	err = storage.Set(key, &CacheEntry{StatusCode: http.StatusOK, StoredAt: time.Now().Add(-3 * time.Minute)})
+	assert.Nil(t, err)
+	_, err = transport.RoundTrip(req)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, storage.Delete(key))
+	entry, err := storage.Get(key)
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestResponseCacheServeStaleOnOutage(t *testing.T) {
+	var requests int32
+	status := int32(http.StatusOK)
+	server := newCacheTestServer(&requests, func() int { return int(atomic.LoadInt32(&status)) })
+	defer server.Close()
+
+	service := newCacheTestService(t, server.URL, &ResponseCacheOptions{
+		TTL:                10 * time.Millisecond,
+		ServeStaleOnOutage: true,
+	})
+
+	invoke := func() (*DetailedResponse, error) {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resource", nil)
+		assert.Nil(t, err)
+		req, _ := builder.Build()
+		var foo *Foo
+		return service.Request(req, &foo)
+	}
+
+	response, err := invoke()
+	assert.Nil(t, err)
+	assert.False(t, response.IsStale())
+
+	// During an outage, the most recent response is returned (however stale) and flagged as stale.
+	atomic.StoreInt32(&status, http.StatusBadGateway)
+	time.Sleep(50 * time.Millisecond)
+	response, err = invoke()
+	assert.Nil(t, err)
+	assert.True(t, response.IsStale())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "response-1", *response.Result.(*Foo).Name)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// Once the service recovers, the new response is returned.
+	atomic.StoreInt32(&status, http.StatusOK)
+	response, err = invoke()
+	assert.Nil(t, err)
+	assert.False(t, response.IsStale())
+	assert.Equal(t, "response-3", *response.Result.(*Foo).Name)
+
+	// A client error isn't an outage.
+	atomic.StoreInt32(&status, http.StatusNotFound)
+	time.Sleep(20 * time.Millisecond)
+	_, err = invoke()
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusNotFound, getStatusCode(err))
+}
+
+func TestResponseCacheServeStaleOnTransportOutage(t *testing.T) {
+	var transportErr error
+	storage := NewMemoryCacheStorage()
+	transport := NewResponseCacheTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, transportErr
+	}), &ResponseCacheOptions{
+		Storage:            storage,
+		TTL:                time.Minute,
+		ServeStaleOnOutage: true,
+	})
+
+	req, _ := http.NewRequest(GET, "https://myservice.cloud.ibm.com/resource", nil)
+	err := storage.Set(responseCacheKey(req), &CacheEntry{
+		StatusCode: http.StatusOK,
+		Body:       []byte("cached"),
+		StoredAt:   time.Now().Add(-24 * time.Hour),
+	})
+	assert.Nil(t, err)
+
+	// A retryable transport error is an outage.
+	transportErr = syscall.ECONNREFUSED
+	resp, err := transport.RoundTrip(req)
+	assert.Nil(t, err)
+	assert.True(t, isStaleResponse(resp.Header))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "cached", string(body))
+
+	// A canceled request isn't.
+	transportErr = context.Canceled
+	_, err = transport.RoundTrip(req)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMemoryCacheStorage(t *testing.T) {
+	storage := NewMemoryCacheStorageWithOptions(&MemoryCacheStorageOptions{MaxEntries: 2, TTL: time.Minute})
+
+	// The least recently used entry is evicted when the maximum number of entries is exceeded.
+	assert.Nil(t, storage.Set("a", &CacheEntry{StatusCode: 200, StoredAt: time.Now()}))
+	assert.Nil(t, storage.Set("b", &CacheEntry{StatusCode: 200, StoredAt: time.Now()}))
+	entry, err := storage.Get("a")
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+	assert.Nil(t, storage.Set("c", &CacheEntry{StatusCode: 200, StoredAt: time.Now()}))
+	entry, err = storage.Get("b")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+	entry, err = storage.Get("a")
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+
+	// Expired entries are evicted when accessed, and when another entry is stored.
+	assert.Nil(t, storage.Set("a", &CacheEntry{StatusCode: 200, StoredAt: time.Now().Add(-2 * time.Minute)}))
+	entry, err = storage.Get("a")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+	assert.Nil(t, storage.Set("b", &CacheEntry{StatusCode: 200, StoredAt: time.Now().Add(-2 * time.Minute)}))
+	assert.Nil(t, storage.Set("d", &CacheEntry{StatusCode: 200, StoredAt: time.Now()}))
+	assert.Equal(t, 2, storage.(*memoryCacheStorage).lru.Len())
+
+	assert.Nil(t, storage.Delete("c"))
+	assert.Nil(t, storage.Delete("c"))
+	entry, err = storage.Get("c")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	// By default, the number of entries is limited, but their age isn't.
+	storage = NewMemoryCacheStorage()
+	assert.Equal(t, MemoryCacheStorageOptions{MaxEntries: defaultMemoryCacheMaxEntries}, storage.(*memoryCacheStorage).options)
+	for i := 0; i <= defaultMemoryCacheMaxEntries; i++ {
+		assert.Nil(t, storage.Set(fmt.Sprintf("key%d", i), &CacheEntry{StatusCode: 200, StoredAt: time.Now().Add(-time.Hour)}))
+	}
+	assert.Equal(t, defaultMemoryCacheMaxEntries, storage.(*memoryCacheStorage).lru.Len())
+
+	// The default storage of a response cache evicts the entries that can no longer be returned.
+	transport := NewResponseCacheTransport(nil, &ResponseCacheOptions{TTL: time.Minute, StaleIfError: time.Hour})
+	storageOptions := transport.(*responseCacheTransport).options.Storage.(*memoryCacheStorage).options
+	assert.Equal(t, time.Minute+time.Hour, storageOptions.TTL)
+	transport = NewResponseCacheTransport(nil, &ResponseCacheOptions{TTL: time.Minute, ServeStaleOnOutage: true})
+	storageOptions = transport.(*responseCacheTransport).options.Storage.(*memoryCacheStorage).options
+	assert.Equal(t, time.Duration(0), storageOptions.TTL)
+}
+
+func TestIsStaleResponse(t *testing.T) {
+	assert.False(t, isStaleResponse(http.Header{}))
+	assert.False(t, isStaleResponse(http.Header{headerNameWarning: {`299 - "Deprecated API"`}}))
+	assert.True(t, isStaleResponse(http.Header{headerNameWarning: {warningResponseIsStale}}))
+	assert.True(t, isStaleResponse(http.Header{headerNameWarning: {`299 - "Deprecated API"`, `112 proxy "Disconnected"`}}))
+}
@@ -0,0 +1,103 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ResponseTransform is a function that is invoked by BaseService.Request() to transform
+// an operation response before its body is processed (e.g. unmarshalled).
+// A transform would typically replace response.Body with a reader that delivers
+// the decompressed or decrypted body, and then update response.Header to reflect
+// the new content.
+// If a transform replaces response.Body, it is responsible for ensuring that the
+// original body is closed when the new body is closed.
+type ResponseTransform func(response *http.Response) error
+
+// NewContentEncodingTransform returns a ResponseTransform that decodes response bodies
+// whose "Content-Encoding" header matches "encoding" (e.g. "br" or "x-custom").
+// The "newReader" function is used to construct a reader that delivers the decoded
+// version of the body. After decoding, the "Content-Encoding" and "Content-Length"
+// headers are removed from the response.
+func NewContentEncodingTransform(encoding string, newReader func(io.Reader) (io.Reader, error)) ResponseTransform {
+	return func(response *http.Response) error {
+		if response.Body == nil || !strings.EqualFold(response.Header.Get(CONTENT_ENCODING), encoding) {
+			return nil
+		}
+
+		decodedReader, err := newReader(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = &readCloser{Reader: decodedReader, Closer: response.Body}
+		response.Header.Del(CONTENT_ENCODING)
+		response.Header.Del("Content-Length")
+		response.ContentLength = -1
+		response.Uncompressed = true
+		return nil
+	}
+}
+
+// NewResponseBodyTransform returns a ResponseTransform that reads the entire response body
+// and replaces it with the result of invoking "transform" on it.
+// This is useful for transforms that must process the body as a whole, such as the
+// decryption of an envelope-encrypted payload using a key obtained from a key management service.
+func NewResponseBodyTransform(transform func(body []byte, header http.Header) ([]byte, error)) ResponseTransform {
+	return func(response *http.Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		newBody, err := transform(body, response.Header)
+		if err != nil {
+			return err
+		}
+
+		response.Body = ioutil.NopCloser(bytes.NewReader(newBody))
+		response.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+		response.ContentLength = int64(len(newBody))
+		return nil
+	}
+}
+
+// readCloser combines a Reader with the Closer of the stream that it wraps.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// applyResponseTransforms invokes each transform on "response", in order.
+func applyResponseTransforms(transforms []ResponseTransform, response *http.Response) error {
+	for _, transform := range transforms {
+		transform := transform
+		if err := callSafelyWithError(PanicSourceResponseTransform, func() error { return transform(response) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
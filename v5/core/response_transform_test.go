@@ -0,0 +1,155 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A simple (and very insecure) "encryption" scheme used to test decryption transforms.
+func reverseBytes(b []byte) []byte {
+	result := make([]byte, len(b))
+	for i := range b {
+		result[len(b)-1-i] = b[i]
+	}
+	return result
+}
+
+var base64Transform = NewContentEncodingTransform("x-base64", func(r io.Reader) (io.Reader, error) {
+	return base64.NewDecoder(base64.StdEncoding, r), nil
+})
+
+var decryptTransform = NewResponseBodyTransform(func(body []byte, header http.Header) ([]byte, error) {
+	if header.Get("X-Encrypted") != "true" {
+		return body, nil
+	}
+	if header.Get("X-Key-Id") != "key-1" {
+		return nil, fmt.Errorf("unknown key id: %s", header.Get("X-Key-Id"))
+	}
+	header.Del("X-Encrypted")
+	return reverseBytes(body), nil
+})
+
+func newTransformTestRequest(t *testing.T, serverURL string) *http.Request {
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(serverURL, "", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestResponseTransformPipeline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := base64.StdEncoding.EncodeToString(reverseBytes([]byte(`{"name": "wonder woman"}`)))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "x-base64")
+		w.Header().Set("X-Encrypted", "true")
+		w.Header().Set("X-Key-Id", r.URL.Query().Get("key"))
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+
+	// Without the transforms, the body can't be unmarshalled.
+	var foo *Foo
+	_, err := service.Request(newTransformTestRequest(t, server.URL+"?key=key-1"), &foo)
+	assert.NotNil(t, err)
+
+	// The transforms are applied in order: decode first, then decrypt.
+	service.AddResponseTransform(base64Transform)
+	service.AddResponseTransform(decryptTransform)
+
+	foo = nil
+	detailedResponse, err := service.Request(newTransformTestRequest(t, server.URL+"?key=key-1"), &foo)
+	assert.Nil(t, err)
+	assert.NotNil(t, foo)
+	assert.Equal(t, "wonder woman", *foo.Name)
+	assert.Equal(t, "", detailedResponse.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "", detailedResponse.Headers.Get("X-Encrypted"))
+
+	// A clone should inherit the transforms.
+	clone := service.Clone()
+	foo = nil
+	_, err = clone.Request(newTransformTestRequest(t, server.URL+"?key=key-1"), &foo)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *foo.Name)
+
+	// A failed transform should result in an error.
+	foo = nil
+	detailedResponse, err = service.Request(newTransformTestRequest(t, server.URL+"?key=key-2"), &foo)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_RESPONSE_TRANSFORM, "unknown key id: key-2"), err.Error())
+	assert.NotNil(t, detailedResponse)
+	assert.Equal(t, http.StatusOK, detailedResponse.StatusCode)
+	assert.Nil(t, foo)
+
+	// Clear the transforms.
+	service.SetResponseTransforms()
+	_, err = service.Request(newTransformTestRequest(t, server.URL+"?key=key-1"), &foo)
+	assert.NotNil(t, err)
+}
+
+func TestResponseTransformErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "x-base64")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, base64.StdEncoding.EncodeToString([]byte(`{"error": "bad request"}`)))
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+	service.SetResponseTransforms(base64Transform)
+
+	detailedResponse, err := service.Request(newTransformTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "bad request", err.Error())
+	assert.Equal(t, http.StatusBadRequest, detailedResponse.StatusCode)
+}
+
+func TestResponseTransformStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Encoding", "X-Base64")
+		fmt.Fprint(w, base64.StdEncoding.EncodeToString([]byte("streamed content")))
+	}))
+	defer server.Close()
+
+	service := newNoAuthTestService(t, server.URL)
+	service.SetResponseTransforms(base64Transform)
+
+	var result io.ReadCloser
+	_, err := service.Request(newTransformTestRequest(t, server.URL), &result)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	defer result.Close()
+
+	content, err := ioutil.ReadAll(result)
+	assert.Nil(t, err)
+	assert.Equal(t, "streamed content", string(content))
+}
@@ -0,0 +1,153 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseViolation describes a way in which a response body does not conform
+// to the schema of the operation's response.
+type ResponseViolation struct {
+	// The location of the violation within the response body (e.g. "/resources/0/name").
+	Path string
+
+	// A description of the violation (e.g. "required property is missing").
+	Message string
+}
+
+// String returns a description of the violation.
+func (v ResponseViolation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return fmt.Sprintf("%s: %s", v.Path, v.Message)
+}
+
+// ResponseValidator validates the raw JSON body of a successful operation response
+// (e.g. against the response schema from the service's OpenAPI definition) before it
+// is unmarshalled. A response validator is typically provided for each operation
+// by the generated SDK, or by a user (e.g. within a contract-testing pipeline).
+type ResponseValidator interface {
+	// ValidateResponse returns the violations found within "body", the response to "req"
+	// received with the specified status code, or nil if the body is valid.
+	ValidateResponse(req *http.Request, statusCode int, body []byte) []ResponseViolation
+}
+
+// ResponseValidatorFunc is an adapter that allows a function to be used as a ResponseValidator.
+type ResponseValidatorFunc func(req *http.Request, statusCode int, body []byte) []ResponseViolation
+
+// ValidateResponse calls f(req, statusCode, body).
+func (f ResponseValidatorFunc) ValidateResponse(req *http.Request, statusCode int, body []byte) []ResponseViolation {
+	return f(req, statusCode, body)
+}
+
+// ResponseValidationMode determines how the violations found by a ResponseValidator are surfaced.
+type ResponseValidationMode int
+
+const (
+	// ResponseValidationModeWarn logs the violations as a warning and makes them available via
+	// DetailedResponse.GetResponseViolations(); the response is processed as usual (the default).
+	ResponseValidationModeWarn ResponseValidationMode = iota
+
+	// ResponseValidationModeError causes the operation to fail with a ResponseValidationError.
+	ResponseValidationModeError
+)
+
+// ResponseValidationError is the error returned by BaseService.Request() when a response
+// does not conform to its schema and the service's response validation mode is ResponseValidationModeError.
+// The DetailedResponse returned along with the error contains the raw response body in its RawResult field.
+type ResponseValidationError struct {
+	// The violations found within the response body.
+	Violations []ResponseViolation
+}
+
+func (e *ResponseValidationError) Error() string {
+	descriptions := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		descriptions[i] = v.String()
+	}
+	return fmt.Sprintf(ERRORMSG_RESPONSE_VALIDATION, strings.Join(descriptions, "; "))
+}
+
+// responseValidatorKey is the context key used to associate a response validator with a request.
+type responseValidatorKey struct{}
+
+// WithResponseValidator sets "validator" as the ResponseValidator to be used to validate
+// the response to the http.Request instance that will be constructed by the Build() method,
+// in place of the service's response validator (if any).
+func (requestBuilder *RequestBuilder) WithResponseValidator(validator ResponseValidator) *RequestBuilder {
+	requestBuilder.responseValidator = validator
+	return requestBuilder
+}
+
+// SetResponseValidator sets the ResponseValidator to be used to validate the responses of
+// operations that do not have their own response validator (see RequestBuilder.WithResponseValidator()).
+// A nil value disables the validation of such responses.
+func (service *BaseService) SetResponseValidator(validator ResponseValidator) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.responseValidator = validator
+}
+
+// SetResponseValidationMode sets the way in which response violations are surfaced.
+func (service *BaseService) SetResponseValidationMode(mode ResponseValidationMode) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.responseValidationMode = mode
+}
+
+// GetResponseViolations returns the violations found by the response validator, if any.
+func (response *DetailedResponse) GetResponseViolations() []ResponseViolation {
+	return response.violations
+}
+
+// validateResponse validates "body" using the request's response validator, or the service's
+// response validator "validator" if the request has none. Any violations are recorded
+// in "detailedResponse" and then logged or returned as an error, according to "mode".
+func validateResponse(req *http.Request, detailedResponse *DetailedResponse, body []byte,
+	validator ResponseValidator, mode ResponseValidationMode) error {
+	if requestValidator, ok := req.Context().Value(responseValidatorKey{}).(ResponseValidator); ok {
+		validator = requestValidator
+	}
+	if IsNil(validator) {
+		return nil
+	}
+
+	var violations []ResponseViolation
+	err := callSafelyWithError(PanicSourceResponseValidator, func() error {
+		violations = validator.ValidateResponse(req, detailedResponse.StatusCode, body)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	detailedResponse.violations = violations
+
+	err = &ResponseValidationError{Violations: violations}
+	if mode == ResponseValidationModeError {
+		detailedResponse.RawResult = body
+		return err
+	}
+	GetLogger().Warn("Response to %s %s: %s", req.Method, RedactSecrets(req.URL.String()), err.Error())
+	return nil
+}
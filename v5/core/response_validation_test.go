@@ -0,0 +1,112 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requiredPropertiesValidator reports each of its properties that is missing from a JSON object.
+type requiredPropertiesValidator []string
+
+func (properties requiredPropertiesValidator) ValidateResponse(req *http.Request, statusCode int, body []byte) (violations []ResponseViolation) {
+	var object map[string]interface{}
+	if err := json.Unmarshal(body, &object); err != nil {
+		return []ResponseViolation{{Message: err.Error()}}
+	}
+	for _, property := range properties {
+		if _, ok := object[property]; !ok {
+			violations = append(violations, ResponseViolation{Path: "/" + property, Message: "required property is missing"})
+		}
+	}
+	return
+}
+
+func TestResponseValidation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+		fmt.Fprint(w, `{"name": "wonder woman"}`)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+
+	newRequest := func(validator ResponseValidator) *http.Request {
+		builder := NewRequestBuilder(GET).WithResponseValidator(validator)
+		_, err := builder.ResolveRequestURL(server.URL, "/heroes/1", nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// No validator.
+	var result *Foo
+	detailedResponse, err := service.Request(newRequest(nil), &result)
+	assert.Nil(t, err)
+	assert.Empty(t, detailedResponse.GetResponseViolations())
+
+	// By default, violations are surfaced as warnings and the response is processed as usual.
+	service.SetResponseValidator(requiredPropertiesValidator{"name", "power"})
+	result = nil
+	detailedResponse, err = service.Request(newRequest(nil), &result)
+	assert.Nil(t, err)
+	assert.Equal(t, "wonder woman", *result.Name)
+	assert.Equal(t, []ResponseViolation{{Path: "/power", Message: "required property is missing"}}, detailedResponse.GetResponseViolations())
+
+	// An operation's validator is used in place of the service's validator.
+	var validated bool
+	operationValidator := ResponseValidatorFunc(func(req *http.Request, statusCode int, body []byte) []ResponseViolation {
+		validated = true
+		assert.Equal(t, "/heroes/1", req.URL.Path)
+		assert.Equal(t, 200, statusCode)
+		return nil
+	})
+	detailedResponse, err = service.Request(newRequest(operationValidator), &result)
+	assert.Nil(t, err)
+	assert.True(t, validated)
+	assert.Empty(t, detailedResponse.GetResponseViolations())
+
+	// In error mode, violations cause the operation to fail.
+	service.SetResponseValidationMode(ResponseValidationModeError)
+	result = nil
+	detailedResponse, err = service.Request(newRequest(requiredPropertiesValidator{"power", "origin"}), &result)
+	assert.NotNil(t, err)
+	assert.Nil(t, result)
+	var validationErr *ResponseValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	assert.Len(t, validationErr.Violations, 2)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_RESPONSE_VALIDATION, "/power: required property is missing; /origin: required property is missing"), err.Error())
+	assert.Equal(t, validationErr.Violations, detailedResponse.GetResponseViolations())
+	assert.Equal(t, `{"name": "wonder woman"}`, string(detailedResponse.RawResult))
+
+	// The validation configuration is retained by a clone.
+	clone := service.Clone()
+	_, err = clone.Request(newRequest(nil), &result)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,302 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+const (
+	// The default period over which requests and retries are counted.
+	defaultRetryBudgetWindow = 10 * time.Second
+
+	// The default number of retries that are permitted within each window regardless of the ratio.
+	defaultRetryBudgetMinRetries = 10
+
+	// The number of buckets into which the window is divided.
+	retryBudgetBuckets = 10
+
+	// The fraction of the budget that, once used, causes a WarningRetryBudgetLow warning.
+	retryBudgetLowFraction = 0.8
+)
+
+// RetryBudget limits the automatic retries (see EnableRetries()) sent by a service to a
+// fraction of its requests, so that the retries of a fleet of clients don't amplify the load
+// on a degraded service. Requests and retries are counted over a sliding window.
+type RetryBudget struct {
+	// The maximum number of retries per request within the window (e.g. 0.2 permits
+	// one retry for every five requests) [required].
+	Ratio float64
+
+	// The period over which requests and retries are counted; defaults to 10 seconds [optional].
+	Window time.Duration
+
+	// The number of retries that are permitted within the window regardless of Ratio, so that
+	// a service that sends few requests can still retry; defaults to 10 [optional].
+	MinRetries int
+
+	// If true, retries that exceed the budget are shed (i.e. not sent, so that the response
+	// to the last attempt is returned). Otherwise, they are sent but counted as over budget [optional].
+	Shed bool
+}
+
+// RetryStats contains the retry metrics of a service that has a RetryBudget.
+type RetryStats struct {
+	// The number of requests sent (excluding retries).
+	Requests int64
+
+	// The number of retries sent.
+	Retries int64
+
+	// The number of retries that were sent even though they exceeded the budget.
+	RetriesOverBudget int64
+
+	// The number of retries that were shed because they exceeded the budget.
+	ShedRetries int64
+
+	// The total time spent waiting (backing off) before retries.
+	Backoff time.Duration
+
+	// The number of requests and retries within the current window.
+	WindowRequests int64
+	WindowRetries  int64
+}
+
+// SetRetryBudget sets the budget that limits the automatic retries sent by the service,
+// and resets the service's retry metrics (see GetRetryStats()). The budget is applied
+// only while retries are enabled. A nil value removes any previously-set budget.
+func (service *BaseService) SetRetryBudget(budget *RetryBudget) error {
+	var tracker *retryBudgetTracker
+	if budget != nil {
+		if budget.Ratio < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "Ratio")
+		}
+		if budget.MinRetries < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MinRetries")
+		}
+		tracker = newRetryBudgetTracker(*budget)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.retryBudget = tracker
+	return nil
+}
+
+// GetRetryStats returns the retry metrics of the service, which are tracked
+// while it has a RetryBudget.
+func (service *BaseService) GetRetryStats() RetryStats {
+	service.mutex.RLock()
+	tracker := service.retryBudget
+	service.mutex.RUnlock()
+
+	return tracker.getStats()
+}
+
+// retryBudgetBucket counts the requests and retries within a part of the window.
+type retryBudgetBucket struct {
+	index    int64
+	requests int64
+	retries  int64
+}
+
+// retryBudgetTracker tracks the requests and retries of a service against its RetryBudget.
+// A nil tracker permits all retries.
+type retryBudgetTracker struct {
+	budget  RetryBudget
+	buckets [retryBudgetBuckets]retryBudgetBucket
+	stats   RetryStats
+
+	// The index of the last bucket in which a WarningRetryBudgetLow warning was emitted.
+	warnedIndex int64
+
+	mutex sync.Mutex
+}
+
+func newRetryBudgetTracker(budget RetryBudget) *retryBudgetTracker {
+	if budget.Window <= 0 {
+		budget.Window = defaultRetryBudgetWindow
+	}
+	if budget.MinRetries == 0 {
+		budget.MinRetries = defaultRetryBudgetMinRetries
+	}
+	return &retryBudgetTracker{budget: budget, warnedIndex: -1}
+}
+
+// clone returns a new tracker with the same budget (but no requests or retries).
+func (tracker *retryBudgetTracker) clone() *retryBudgetTracker {
+	if tracker == nil {
+		return nil
+	}
+	return newRetryBudgetTracker(tracker.budget)
+}
+
+// bucket returns the current bucket (resetting it if it belongs to an earlier window),
+// and its index. The caller must hold the mutex.
+func (tracker *retryBudgetTracker) bucket() (*retryBudgetBucket, int64) {
+	bucketSize := int64(tracker.budget.Window / retryBudgetBuckets)
+	if bucketSize <= 0 {
+		bucketSize = 1
+	}
+	index := GetClock().Now().UnixNano() / bucketSize
+	bucket := &tracker.buckets[index%retryBudgetBuckets]
+	if bucket.index != index {
+		*bucket = retryBudgetBucket{index: index}
+	}
+	return bucket, index
+}
+
+// windowCounts returns the number of requests and retries within the window ending
+// with the bucket at "index". The caller must hold the mutex.
+func (tracker *retryBudgetTracker) windowCounts(index int64) (requests int64, retries int64) {
+	for _, bucket := range tracker.buckets {
+		if bucket.index > index-retryBudgetBuckets && bucket.index <= index {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	return
+}
+
+// allowance returns the number of retries permitted for "requests" requests.
+func (tracker *retryBudgetTracker) allowance(requests int64) int64 {
+	allowed := int64(tracker.budget.Ratio * float64(requests))
+	if allowed < int64(tracker.budget.MinRetries) {
+		allowed = int64(tracker.budget.MinRetries)
+	}
+	return allowed
+}
+
+// recordRequest counts a request.
+func (tracker *retryBudgetTracker) recordRequest() {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	bucket, _ := tracker.bucket()
+	bucket.requests++
+	tracker.stats.Requests++
+}
+
+// allowRetry returns true if a retry may be sent, and counts it if so.
+// A warning is emitted (at most once per window) when the budget is nearly exhausted.
+func (tracker *retryBudgetTracker) allowRetry(req *http.Request, warnings *warningNotifier) bool {
+	if tracker == nil {
+		return true
+	}
+
+	tracker.mutex.Lock()
+	bucket, index := tracker.bucket()
+	requests, retries := tracker.windowCounts(index)
+	allowed := tracker.allowance(requests)
+
+	if retries >= allowed {
+		if tracker.budget.Shed {
+			tracker.stats.ShedRetries++
+			tracker.mutex.Unlock()
+			GetLogger().Debug("Retry budget exhausted (%d retries for %d requests); the retry was shed", retries, requests)
+			return false
+		}
+		tracker.stats.RetriesOverBudget++
+	}
+	bucket.retries++
+	tracker.stats.Retries++
+	retries++
+
+	warn := float64(retries) >= retryBudgetLowFraction*float64(allowed) && index-tracker.warnedIndex >= retryBudgetBuckets
+	if warn {
+		tracker.warnedIndex = index
+	}
+	tracker.mutex.Unlock()
+
+	if warn {
+		warnings.emit(WarningRetryBudgetLow, req, "The retry budget is nearly exhausted: %d of %d retries permitted for %d requests have been used",
+			retries, allowed, requests)
+	}
+	return true
+}
+
+// recordBackoff adds "wait" to the total time spent waiting before retries.
+func (tracker *retryBudgetTracker) recordBackoff(wait time.Duration) {
+	if tracker == nil {
+		return
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.stats.Backoff += wait
+}
+
+// getStats returns the tracker's metrics.
+func (tracker *retryBudgetTracker) getStats() RetryStats {
+	if tracker == nil {
+		return RetryStats{}
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	stats := tracker.stats
+	_, index := tracker.bucket()
+	stats.WindowRequests, stats.WindowRetries = tracker.windowCounts(index)
+	return stats
+}
+
+// apply returns a copy of "client" whose retries (for the request "req") are subject to the budget.
+func (tracker *retryBudgetTracker) apply(client *retryablehttp.Client, req *http.Request,
+	warnings *warningNotifier) *retryablehttp.Client {
+	if tracker == nil {
+		return client
+	}
+
+	budgeted := retryableClientWithTransport(client, client.HTTPClient.Transport)
+	checkRetry := client.CheckRetry
+	if checkRetry == nil {
+		checkRetry = retryablehttp.DefaultRetryPolicy
+	}
+	backoff := client.Backoff
+	if backoff == nil {
+		backoff = retryablehttp.DefaultBackoff
+	}
+	attempts := 0
+
+	// CheckRetry is invoked after each attempt (including the last one, for which the
+	// retry limit has been reached), so only consult the budget if a retry would be sent.
+	budgeted.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		shouldRetry, checkErr := checkRetry(ctx, resp, err)
+		attempts++
+		if shouldRetry && attempts <= client.RetryMax && !tracker.allowRetry(req, warnings) {
+			return false, checkErr
+		}
+		return shouldRetry, checkErr
+	}
+	budgeted.Backoff = func(min, max time.Duration, attemptNum int, resp *http.Response) time.Duration {
+		wait := backoff(min, max, attemptNum, resp)
+		tracker.recordBackoff(wait)
+		return wait
+	}
+	return budgeted
+}
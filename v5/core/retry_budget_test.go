@@ -0,0 +1,132 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRetryBudgetTestService returns a service (with retries enabled) whose requests fail
+// with a retryable status code until "*failing" is false.
+func newRetryBudgetTestService(t *testing.T) (*BaseService, *httptest.Server, *int, *bool) {
+	attempts := 0
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if failing {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	service := newNoAuthTestService(t, server.URL)
+	service.EnableRetries(3, time.Second)
+	return service, server, &attempts, &failing
+}
+
+func sendRetryBudgetTestRequest(t *testing.T, service *BaseService, url string) int {
+	req, err := NewRequestBuilder(GET).ConstructHTTPURL(url, nil, nil)
+	assert.Nil(t, err)
+	request, err := req.Build()
+	assert.Nil(t, err)
+	detailedResponse, _ := service.Request(request, nil)
+	return detailedResponse.StatusCode
+}
+
+func TestRetryBudgetShed(t *testing.T) {
+	service, server, attempts, failing := newRetryBudgetTestService(t)
+	defer server.Close()
+
+	assert.NotNil(t, service.SetRetryBudget(&RetryBudget{Ratio: -1}))
+	assert.Nil(t, service.SetRetryBudget(&RetryBudget{Ratio: 0.5, MinRetries: 4, Shed: true}))
+	var warnings []Warning
+	service.SetWarningHandler(func(warning Warning) {
+		warnings = append(warnings, warning)
+	})
+
+	// The first request is retried three times, and the second request only once,
+	// after which the budget (4 retries) is exhausted.
+	assert.Equal(t, http.StatusServiceUnavailable, sendRetryBudgetTestRequest(t, service, server.URL))
+	assert.Equal(t, 4, *attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, sendRetryBudgetTestRequest(t, service, server.URL))
+	assert.Equal(t, 6, *attempts)
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, WarningRetryBudgetLow, warnings[0].Kind)
+
+	stats := service.GetRetryStats()
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(4), stats.Retries)
+	assert.Equal(t, int64(1), stats.ShedRetries)
+	assert.Equal(t, int64(0), stats.RetriesOverBudget)
+	assert.Equal(t, int64(2), stats.WindowRequests)
+	assert.Equal(t, int64(4), stats.WindowRetries)
+
+	// Successful requests increase the budget.
+	*failing = false
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, http.StatusOK, sendRetryBudgetTestRequest(t, service, server.URL))
+	}
+	*failing = true
+	assert.Equal(t, http.StatusServiceUnavailable, sendRetryBudgetTestRequest(t, service, server.URL))
+	assert.Equal(t, int64(5), service.GetRetryStats().Retries)
+
+	// A clone has the same budget, but its own metrics; without a budget, no metrics are tracked.
+	assert.Equal(t, RetryStats{}, service.Clone().GetRetryStats())
+	assert.Nil(t, service.SetRetryBudget(nil))
+	assert.Equal(t, RetryStats{}, service.GetRetryStats())
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	service, server, attempts, _ := newRetryBudgetTestService(t)
+	defer server.Close()
+	clock := &testClock{now: time.Now()}
+	SetClock(clock)
+	defer SetClock(nil)
+
+	// Retries that exceed the budget are sent, but counted, unless shedding is enabled.
+	assert.Nil(t, service.SetRetryBudget(&RetryBudget{Ratio: 0.1, MinRetries: 1, Window: time.Minute}))
+	sendRetryBudgetTestRequest(t, service, server.URL)
+	assert.Equal(t, 4, *attempts)
+	stats := service.GetRetryStats()
+	assert.Equal(t, int64(3), stats.Retries)
+	assert.Equal(t, int64(2), stats.RetriesOverBudget)
+
+	// Requests and retries outside the window are no longer counted.
+	clock.now = clock.now.Add(30 * time.Second)
+	assert.Equal(t, int64(3), service.GetRetryStats().WindowRetries)
+	clock.now = clock.now.Add(time.Minute)
+	stats = service.GetRetryStats()
+	assert.Equal(t, int64(0), stats.WindowRequests)
+	assert.Equal(t, int64(0), stats.WindowRetries)
+	assert.Equal(t, int64(3), stats.Retries)
+}
+
+// testClock is a Clock whose time is set by the test.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
@@ -0,0 +1,145 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SessionAffinity identifies the cookie or header in which a clustered service returns
+// an affinity token, which must be echoed in subsequent requests so that they reach
+// the same backend. Exactly one of CookieName and HeaderName must be specified.
+type SessionAffinity struct {
+	// The name of the cookie containing the token (e.g. "JSESSIONID").
+	CookieName string
+
+	// The name of the response and request header containing the token (e.g. "X-Backend-Affinity").
+	HeaderName string
+}
+
+// SetSessionAffinity enables the tracking of session affinity: the token designated by
+// "affinity" is recorded from each response and attached to subsequent requests.
+// A nil value disables session affinity.
+func (service *BaseService) SetSessionAffinity(affinity *SessionAffinity) error {
+	var tracker *sessionAffinityTracker
+	if affinity != nil {
+		if (affinity.CookieName == "") == (affinity.HeaderName == "") {
+			return fmt.Errorf(ERRORMSG_EXCLUSIVE_PROPS_ERROR, "CookieName", "HeaderName")
+		}
+		tracker = &sessionAffinityTracker{affinity: *affinity}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.sessionAffinity = tracker
+	return nil
+}
+
+// GetSessionAffinityToken returns the current session affinity token, or "".
+func (service *BaseService) GetSessionAffinityToken() string {
+	service.mutex.RLock()
+	tracker := service.sessionAffinity
+	service.mutex.RUnlock()
+
+	return tracker.getToken()
+}
+
+// ResetSessionAffinity discards the current session affinity token, so that the next
+// request may reach any backend (e.g. after the backend became unavailable).
+func (service *BaseService) ResetSessionAffinity() {
+	service.mutex.RLock()
+	tracker := service.sessionAffinity
+	service.mutex.RUnlock()
+
+	tracker.setToken("")
+}
+
+// sessionAffinityTracker records the session affinity token returned by the service.
+// A nil tracker does nothing.
+type sessionAffinityTracker struct {
+	affinity SessionAffinity
+	token    string
+	mutex    sync.RWMutex
+}
+
+// clone returns a tracker with the same configuration and token.
+func (tracker *sessionAffinityTracker) clone() *sessionAffinityTracker {
+	if tracker == nil {
+		return nil
+	}
+	return &sessionAffinityTracker{affinity: tracker.affinity, token: tracker.getToken()}
+}
+
+func (tracker *sessionAffinityTracker) getToken() string {
+	if tracker == nil {
+		return ""
+	}
+	tracker.mutex.RLock()
+	defer tracker.mutex.RUnlock()
+
+	return tracker.token
+}
+
+func (tracker *sessionAffinityTracker) setToken(token string) {
+	if tracker == nil {
+		return
+	}
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	tracker.token = token
+}
+
+// apply attaches the current token to "req", unless the request already specifies one.
+func (tracker *sessionAffinityTracker) apply(req *http.Request) {
+	token := tracker.getToken()
+	if token == "" {
+		return
+	}
+	if tracker.affinity.CookieName != "" {
+		if _, err := req.Cookie(tracker.affinity.CookieName); err == http.ErrNoCookie {
+			req.AddCookie(&http.Cookie{Name: tracker.affinity.CookieName, Value: token})
+		}
+	} else if req.Header.Get(tracker.affinity.HeaderName) == "" {
+		req.Header.Set(tracker.affinity.HeaderName, token)
+	}
+}
+
+// record updates the token from "resp". A cookie that is deleted (or expired)
+// by the response clears the token.
+func (tracker *sessionAffinityTracker) record(resp *http.Response) {
+	if tracker == nil {
+		return
+	}
+	if tracker.affinity.CookieName != "" {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == tracker.affinity.CookieName {
+				expired := !cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())
+				if cookie.MaxAge < 0 || expired || cookie.Value == "" {
+					tracker.setToken("")
+				} else {
+					tracker.setToken(cookie.Value)
+				}
+			}
+		}
+	} else if token := resp.Header.Get(tracker.affinity.HeaderName); token != "" {
+		tracker.setToken(token)
+	}
+}
@@ -0,0 +1,128 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAffinityTestRequest(t *testing.T, url string) *http.Request {
+	builder := NewRequestBuilder(GET)
+	_, err := builder.ResolveRequestURL(url, "/resources", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	return req
+}
+
+func TestSessionAffinityCookie(t *testing.T) {
+	var received []string
+	backend := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("JSESSIONID")
+		if err != nil {
+			received = append(received, "")
+			backend++
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: fmt.Sprintf("backend-%d", backend)})
+		} else {
+			received = append(received, cookie.Value)
+		}
+		if r.URL.Query().Get("logout") != "" {
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", MaxAge: -1})
+		}
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+
+	// Without session affinity, the cookie isn't echoed.
+	_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", service.GetSessionAffinityToken())
+
+	// With session affinity, the cookie is recorded and echoed.
+	assert.Nil(t, service.SetSessionAffinity(&SessionAffinity{CookieName: "JSESSIONID"}))
+	received = nil
+	for i := 0; i < 3; i++ {
+		_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{"", "backend-2", "backend-2"}, received)
+	assert.Equal(t, "backend-2", service.GetSessionAffinityToken())
+
+	// A clone has its own copy of the token.
+	clone := service.Clone()
+	assert.Equal(t, "backend-2", clone.GetSessionAffinityToken())
+	clone.ResetSessionAffinity()
+	assert.Equal(t, "", clone.GetSessionAffinityToken())
+	assert.Equal(t, "backend-2", service.GetSessionAffinityToken())
+
+	// A deleted cookie clears the token.
+	req := newAffinityTestRequest(t, server.URL)
+	req.URL.RawQuery = "logout=true"
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", service.GetSessionAffinityToken())
+
+	// A cookie specified by the request takes precedence.
+	service.ResetSessionAffinity()
+	received = nil
+	_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+	assert.Nil(t, err)
+	req = newAffinityTestRequest(t, server.URL)
+	req.AddCookie(&http.Cookie{Name: "JSESSIONID", Value: "explicit"})
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"", "explicit"}, received)
+}
+
+func TestSessionAffinityHeader(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Backend-Affinity"))
+		w.Header().Set("X-Backend-Affinity", "node-7")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.SetSessionAffinity(&SessionAffinity{HeaderName: "X-Backend-Affinity"}))
+
+	// The token is recorded from error responses too.
+	_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"", "node-7"}, received)
+
+	// Session affinity can be disabled.
+	assert.Nil(t, service.SetSessionAffinity(nil))
+	_, err = service.Request(newAffinityTestRequest(t, server.URL), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, "", received[2])
+
+	// Exactly one of the cookie or header name must be specified.
+	assert.NotNil(t, service.SetSessionAffinity(&SessionAffinity{}))
+	assert.NotNil(t, service.SetSessionAffinity(&SessionAffinity{CookieName: "a", HeaderName: "b"}))
+}
@@ -0,0 +1,202 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Content types supported by the default stream decoders.
+const (
+	TEXT_CSV           = "text/csv"
+	APPLICATION_NDJSON = "application/x-ndjson"
+	APPLICATION_JSONL  = "application/jsonl"
+)
+
+// StreamDecoder decodes the rows (or objects) of a streamed response body one at a time,
+// so that large exports can be processed in constant memory.
+// Decode decodes the next row into the value pointed to by "v", and returns io.EOF
+// when there are no more rows.
+type StreamDecoder interface {
+	Decode(v interface{}) error
+}
+
+// StreamDecoderFactory returns a StreamDecoder that reads from "body".
+type StreamDecoderFactory func(body io.Reader) StreamDecoder
+
+// streamDecoders holds the StreamDecoderFactory registered for each content type.
+var streamDecoders = map[string]StreamDecoderFactory{
+	TEXT_CSV:             func(body io.Reader) StreamDecoder { return NewCSVDecoder(body, nil) },
+	APPLICATION_NDJSON:   func(body io.Reader) StreamDecoder { return NewNDJSONDecoder(body) },
+	"application/ndjson": func(body io.Reader) StreamDecoder { return NewNDJSONDecoder(body) },
+	APPLICATION_JSONL:    func(body io.Reader) StreamDecoder { return NewNDJSONDecoder(body) },
+}
+
+// Guards 'streamDecoders' so that it can be modified while it is in use.
+var streamDecodersMutex sync.RWMutex
+
+// RegisterStreamDecoder registers "factory" as the StreamDecoderFactory for "mimeType"
+// (e.g. "text/tab-separated-values"), replacing any existing registration.
+// A nil factory removes the registration.
+func RegisterStreamDecoder(mimeType string, factory StreamDecoderFactory) {
+	streamDecodersMutex.Lock()
+	defer streamDecodersMutex.Unlock()
+
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if factory == nil {
+		delete(streamDecoders, mimeType)
+	} else {
+		streamDecoders[mimeType] = factory
+	}
+}
+
+// NewStreamDecoder returns a StreamDecoder that reads "body", based on its content type
+// (the value of a "Content-Type" header, e.g. "text/csv; charset=utf-8").
+func NewStreamDecoder(contentType string, body io.Reader) (StreamDecoder, error) {
+	mimeType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_STREAM_CONTENT_TYPE, contentType)
+	}
+
+	streamDecodersMutex.RLock()
+	factory := streamDecoders[mimeType]
+	streamDecodersMutex.RUnlock()
+
+	if factory == nil {
+		return nil, fmt.Errorf(ERRORMSG_STREAM_CONTENT_TYPE, contentType)
+	}
+	return factory(body), nil
+}
+
+// GetStreamDecoder returns a StreamDecoder for the body of a response whose result was
+// obtained as an io.ReadCloser, based on the response's content type.
+// The caller is responsible for closing the body.
+func (response *DetailedResponse) GetStreamDecoder() (StreamDecoder, error) {
+	body, ok := response.Result.(io.Reader)
+	if !ok {
+		return nil, fmt.Errorf(ERRORMSG_STREAM_RESULT_TYPE, "response", reflect.TypeOf(response.Result))
+	}
+	return NewStreamDecoder(response.Headers.Get(CONTENT_TYPE), body)
+}
+
+// NDJSONDecoder is a StreamDecoder for newline-delimited JSON (NDJSON or JSON Lines),
+// in which each non-blank line contains a JSON value.
+type NDJSONDecoder struct {
+	reader *bufio.Reader
+	row    int
+}
+
+// NewNDJSONDecoder returns an NDJSONDecoder that reads from "r".
+func NewNDJSONDecoder(r io.Reader) *NDJSONDecoder {
+	return &NDJSONDecoder{reader: bufio.NewReader(r)}
+}
+
+// Decode unmarshals the next JSON value into "v", returning io.EOF when there are no more values.
+func (d *NDJSONDecoder) Decode(v interface{}) error {
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		d.row++
+		if decodeErr := json.Unmarshal(line, v); decodeErr != nil {
+			return fmt.Errorf(ERRORMSG_STREAM_DECODE, "NDJSON", d.row, decodeErr.Error())
+		}
+		return nil
+	}
+}
+
+// CSVDecoder is a StreamDecoder for comma-separated values. Each row is decoded into either
+// a *[]string, or a *map[string]string that maps the column names in the header to the values.
+type CSVDecoder struct {
+	reader *csv.Reader
+	header []string
+	row    int
+}
+
+// NewCSVDecoder returns a CSVDecoder that reads from "r". If "header" is nil, the first
+// row is read as the header.
+func NewCSVDecoder(r io.Reader, header []string) *CSVDecoder {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return NewCSVDecoderFromReader(reader, header)
+}
+
+// NewCSVDecoderFromReader returns a CSVDecoder that reads from a csv.Reader, which can be
+// configured to use a different delimiter (e.g. for tab-separated values) or quoting rules.
+// If "header" is nil, the first row is read as the header.
+func NewCSVDecoderFromReader(reader *csv.Reader, header []string) *CSVDecoder {
+	return &CSVDecoder{reader: reader, header: header}
+}
+
+// Header returns the column names, reading the header row if necessary.
+func (d *CSVDecoder) Header() ([]string, error) {
+	if d.header == nil {
+		record, err := d.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		d.header = record
+	}
+	return d.header, nil
+}
+
+// Decode decodes the next row into "v" (a *[]string or *map[string]string),
+// returning io.EOF when there are no more rows.
+func (d *CSVDecoder) Decode(v interface{}) error {
+	header, err := d.Header()
+	if err != nil {
+		return err
+	}
+	record, err := d.reader.Read()
+	if err == io.EOF {
+		return err
+	}
+	d.row++
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_STREAM_DECODE, "CSV", d.row, err.Error())
+	}
+
+	switch result := v.(type) {
+	case *[]string:
+		*result = record
+	case *map[string]string:
+		if len(record) != len(header) {
+			return fmt.Errorf(ERRORMSG_STREAM_DECODE, "CSV", d.row, fmt.Sprintf("expected %d fields, found %d", len(header), len(record)))
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		*result = row
+	default:
+		return fmt.Errorf(ERRORMSG_STREAM_RESULT_TYPE, "CSV", reflect.TypeOf(v))
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONDecoder(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	decoder := NewNDJSONDecoder(strings.NewReader("{\"id\": 1, \"name\": \"a\"}\n\n  {\"id\": 2, \"name\": \"b\"}\r\n{\"id\": 3}"))
+	var items []item
+	for {
+		var i item
+		err := decoder.Decode(&i)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		items = append(items, i)
+	}
+	assert.Equal(t, []item{{1, "a"}, {2, "b"}, {3, ""}}, items)
+
+	// A malformed row is reported along with its row number.
+	decoder = NewNDJSONDecoder(strings.NewReader("{\"id\": 1}\n{\"id\": \n"))
+	var i item
+	assert.Nil(t, decoder.Decode(&i))
+	err := decoder.Decode(&i)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "NDJSON row 2")
+}
+
+func TestCSVDecoder(t *testing.T) {
+	decoder := NewCSVDecoder(strings.NewReader("id,name\n1,a\n2,\"b, c\"\n"), nil)
+	var row map[string]string
+	assert.Nil(t, decoder.Decode(&row))
+	assert.Equal(t, map[string]string{"id": "1", "name": "a"}, row)
+	var record []string
+	assert.Nil(t, decoder.Decode(&record))
+	assert.Equal(t, []string{"2", "b, c"}, record)
+	assert.Equal(t, io.EOF, decoder.Decode(&row))
+	header, err := decoder.Header()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "name"}, header)
+
+	// A header can be supplied for a CSV without a header row.
+	decoder = NewCSVDecoder(strings.NewReader("1,a\n2\n"), []string{"id", "name"})
+	assert.Nil(t, decoder.Decode(&row))
+	assert.Equal(t, map[string]string{"id": "1", "name": "a"}, row)
+	err = decoder.Decode(&row)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "CSV row 2")
+
+	// Only rows and records are supported.
+	var s string
+	decoder = NewCSVDecoder(strings.NewReader("1,a\n"), []string{"id", "name"})
+	assert.NotNil(t, decoder.Decode(&s))
+
+	// An empty body has no header.
+	_, err = NewCSVDecoder(strings.NewReader(""), nil).Header()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestStreamDecoderRegistry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/export.csv":
+			w.Header().Set(CONTENT_TYPE, "text/csv; charset=utf-8")
+			fmt.Fprint(w, "id,name\n1,a\n2,b\n")
+		case "/export.ndjson":
+			w.Header().Set(CONTENT_TYPE, APPLICATION_NDJSON)
+			fmt.Fprint(w, "{\"id\":\"1\"}\n{\"id\":\"2\"}\n")
+		default:
+			w.Header().Set(CONTENT_TYPE, "text/tab-separated-values")
+			fmt.Fprint(w, "id\tname\n1\ta\n")
+		}
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	getRows := func(path string) ([]map[string]string, error) {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		var body io.ReadCloser
+		detailedResponse, err := service.Request(req, &body)
+		assert.Nil(t, err)
+		defer body.Close()
+
+		decoder, err := detailedResponse.GetStreamDecoder()
+		if err != nil {
+			return nil, err
+		}
+		var rows []map[string]string
+		for {
+			var row map[string]string
+			if err = decoder.Decode(&row); err == io.EOF {
+				return rows, nil
+			} else if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	rows, err := getRows("/export.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "a"}, {"id": "2", "name": "b"}}, rows)
+	rows, err = getRows("/export.ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"id": "1"}, {"id": "2"}}, rows)
+
+	// An unregistered content type is rejected until a decoder is registered for it.
+	_, err = getRows("/export.tsv")
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_STREAM_CONTENT_TYPE, "text/tab-separated-values"), err.Error())
+	RegisterStreamDecoder("text/tab-separated-values", func(body io.Reader) StreamDecoder {
+		reader := csv.NewReader(body)
+		reader.Comma = '\t'
+		return NewCSVDecoderFromReader(reader, nil)
+	})
+	defer RegisterStreamDecoder("text/tab-separated-values", nil)
+	rows, err = getRows("/export.tsv")
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]string{{"id": "1", "name": "a"}}, rows)
+
+	// A response whose result isn't a stream can't be decoded.
+	_, err = (&DetailedResponse{Result: "x"}).GetStreamDecoder()
+	assert.NotNil(t, err)
+}
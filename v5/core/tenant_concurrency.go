@@ -0,0 +1,267 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TenantConcurrencyLimits limits the number of a service's requests that are in flight at once, and
+// partitions the in-flight request slots among the tenants associated with the requests' contexts
+// (see WithTenant()), so that the traffic of one tenant can't starve the other tenants of a service
+// instance that is shared by many tenants. Requests without a tenant share the slots of the "" tenant.
+//
+// When no slot is available, a request waits (until its context is done) for a slot to be released.
+// Released slots are granted to the waiting tenants in turn, regardless of how many requests each
+// tenant is waiting to send.
+type TenantConcurrencyLimits struct {
+	// The maximum number of requests that are in flight at once, for all tenants.
+	MaxInFlight int
+
+	// [Optional] The maximum number of requests that are in flight at once for any one tenant.
+	// Default value: MaxInFlight
+	MaxInFlightPerTenant int
+}
+
+// TenantConcurrencyStats describes the requests of a tenant that are in flight or waiting for a slot.
+type TenantConcurrencyStats struct {
+	// The tenant associated with the requests' contexts (see WithTenant()).
+	Tenant string
+
+	// The number of the tenant's requests that are in flight.
+	InFlight int
+
+	// The number of the tenant's requests that are waiting for a slot.
+	Waiting int
+}
+
+// SetTenantConcurrencyLimits sets the limits on the number of the service's requests that are in flight
+// at once (in total and per tenant). The limits are shared with the service's clones. A slot is held
+// until the request completes (including any retries) or, for a streamed response body (a *io.ReadCloser
+// result), until the body is closed. A nil value removes any previously-set limits.
+func (service *BaseService) SetTenantConcurrencyLimits(limits *TenantConcurrencyLimits) error {
+	var scheduler *tenantScheduler
+	if limits != nil {
+		if limits.MaxInFlight <= 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxInFlight")
+		}
+		if limits.MaxInFlightPerTenant < 0 {
+			return fmt.Errorf(ERRORMSG_PROP_INVALID, "MaxInFlightPerTenant")
+		}
+		scheduler = newTenantScheduler(*limits)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.tenantConcurrency = scheduler
+	return nil
+}
+
+// GetTenantConcurrencyStats returns the stats of the tenants whose requests are in flight or waiting
+// for a slot (sorted by tenant), or nil if the service has no TenantConcurrencyLimits.
+func (service *BaseService) GetTenantConcurrencyStats() []TenantConcurrencyStats {
+	service.mutex.RLock()
+	scheduler := service.tenantConcurrency
+	service.mutex.RUnlock()
+
+	return scheduler.getStats()
+}
+
+// tenantScheduler grants the in-flight request slots of a service to its tenants.
+type tenantScheduler struct {
+	maxInFlight          int
+	maxInFlightPerTenant int
+
+	// The number of requests in flight, the tenants with requests in flight or waiting, and
+	// the tenants with waiting requests (in the order in which they are granted a slot).
+	inFlight int
+	tenants  map[string]*tenantSlots
+	turns    []string
+
+	mutex sync.Mutex
+}
+
+// tenantSlots holds the in-flight and waiting requests of a tenant.
+type tenantSlots struct {
+	inFlight int
+	waiters  []*tenantWaiter
+}
+
+// tenantWaiter is a request waiting for a slot. "ready" is closed when it's granted a slot.
+type tenantWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newTenantScheduler(limits TenantConcurrencyLimits) *tenantScheduler {
+	perTenant := limits.MaxInFlightPerTenant
+	if perTenant == 0 || perTenant > limits.MaxInFlight {
+		perTenant = limits.MaxInFlight
+	}
+	return &tenantScheduler{
+		maxInFlight:          limits.MaxInFlight,
+		maxInFlightPerTenant: perTenant,
+		tenants:              make(map[string]*tenantSlots),
+	}
+}
+
+// acquire waits for a slot for a request of "tenant", returning the function that releases the slot,
+// or ctx.Err() if "ctx" is done first. A nil scheduler grants slots immediately.
+func (scheduler *tenantScheduler) acquire(ctx context.Context, tenant string) (release func(), err error) {
+	if scheduler == nil {
+		return func() {}, nil
+	}
+
+	scheduler.mutex.Lock()
+	slots := scheduler.tenants[tenant]
+	if slots == nil {
+		slots = &tenantSlots{}
+		scheduler.tenants[tenant] = slots
+	}
+
+	// Take a slot if one is available (unless other requests of the tenant are already waiting).
+	if len(slots.waiters) == 0 && scheduler.inFlight < scheduler.maxInFlight && slots.inFlight < scheduler.maxInFlightPerTenant {
+		scheduler.inFlight++
+		slots.inFlight++
+		scheduler.mutex.Unlock()
+		return scheduler.releaser(tenant), nil
+	}
+
+	waiter := &tenantWaiter{ready: make(chan struct{})}
+	if len(slots.waiters) == 0 {
+		scheduler.turns = append(scheduler.turns, tenant)
+	}
+	slots.waiters = append(slots.waiters, waiter)
+	scheduler.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return scheduler.releaser(tenant), nil
+	case <-ctx.Done():
+		scheduler.mutex.Lock()
+		defer scheduler.mutex.Unlock()
+
+		if waiter.granted {
+			// The slot was granted in the meantime, so pass it on.
+			scheduler.releaseLocked(tenant)
+		} else {
+			scheduler.removeWaiterLocked(tenant, waiter)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns the function that releases a slot of "tenant" (once).
+func (scheduler *tenantScheduler) releaser(tenant string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			scheduler.mutex.Lock()
+			defer scheduler.mutex.Unlock()
+
+			scheduler.releaseLocked(tenant)
+		})
+	}
+}
+
+// releaseLocked releases a slot of "tenant" and grants the available slots to the waiting tenants.
+func (scheduler *tenantScheduler) releaseLocked(tenant string) {
+	scheduler.inFlight--
+	slots := scheduler.tenants[tenant]
+	slots.inFlight--
+	if slots.inFlight == 0 && len(slots.waiters) == 0 {
+		delete(scheduler.tenants, tenant)
+	}
+
+	// Grant each available slot to the next tenant (in turn) that is below its limit.
+	for scheduler.inFlight < scheduler.maxInFlight {
+		turn := -1
+		for i, waiting := range scheduler.turns {
+			if scheduler.tenants[waiting].inFlight < scheduler.maxInFlightPerTenant {
+				turn = i
+				break
+			}
+		}
+		if turn < 0 {
+			return
+		}
+
+		waiting := scheduler.turns[turn]
+		slots := scheduler.tenants[waiting]
+		waiter := slots.waiters[0]
+		slots.waiters = slots.waiters[1:]
+		scheduler.turns = append(scheduler.turns[:turn:turn], scheduler.turns[turn+1:]...)
+		if len(slots.waiters) > 0 {
+			// The tenant's next request waits for the other tenants' turns.
+			scheduler.turns = append(scheduler.turns, waiting)
+		}
+
+		scheduler.inFlight++
+		slots.inFlight++
+		waiter.granted = true
+		close(waiter.ready)
+	}
+}
+
+// removeWaiterLocked removes "waiter" from the requests of "tenant" that are waiting for a slot.
+func (scheduler *tenantScheduler) removeWaiterLocked(tenant string, waiter *tenantWaiter) {
+	slots := scheduler.tenants[tenant]
+	for i, w := range slots.waiters {
+		if w == waiter {
+			slots.waiters = append(slots.waiters[:i:i], slots.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(slots.waiters) > 0 {
+		return
+	}
+
+	for i, waiting := range scheduler.turns {
+		if waiting == tenant {
+			scheduler.turns = append(scheduler.turns[:i:i], scheduler.turns[i+1:]...)
+			break
+		}
+	}
+	if slots.inFlight == 0 {
+		delete(scheduler.tenants, tenant)
+	}
+}
+
+// getStats returns the stats of the scheduler's tenants, sorted by tenant.
+func (scheduler *tenantScheduler) getStats() []TenantConcurrencyStats {
+	if scheduler == nil {
+		return nil
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	stats := make([]TenantConcurrencyStats, 0, len(scheduler.tenants))
+	for tenant, slots := range scheduler.tenants {
+		stats = append(stats, TenantConcurrencyStats{
+			Tenant:   tenant,
+			InFlight: slots.inFlight,
+			Waiting:  len(slots.waiters),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Tenant < stats[j].Tenant
+	})
+	return stats
+}
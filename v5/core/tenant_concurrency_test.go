@@ -0,0 +1,189 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForTenantStats waits until the stats of "scheduler" are "expected".
+func waitForTenantStats(t *testing.T, scheduler *tenantScheduler, expected []TenantConcurrencyStats) {
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(expected, scheduler.getStats())
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestSetTenantConcurrencyLimits(t *testing.T) {
+	service, err := NewBaseService(&ServiceOptions{URL: "https://myservice.cloud.ibm.com", Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.GetTenantConcurrencyStats())
+
+	assert.NotNil(t, service.SetTenantConcurrencyLimits(&TenantConcurrencyLimits{}))
+	assert.NotNil(t, service.SetTenantConcurrencyLimits(&TenantConcurrencyLimits{MaxInFlight: 2, MaxInFlightPerTenant: -1}))
+
+	assert.Nil(t, service.SetTenantConcurrencyLimits(&TenantConcurrencyLimits{MaxInFlight: 4}))
+	assert.Equal(t, 4, service.tenantConcurrency.maxInFlightPerTenant)
+	assert.Equal(t, []TenantConcurrencyStats{}, service.GetTenantConcurrencyStats())
+
+	// The limits are shared with clones.
+	assert.True(t, service.tenantConcurrency == service.Clone().tenantConcurrency)
+
+	assert.Nil(t, service.SetTenantConcurrencyLimits(nil))
+	assert.Nil(t, service.GetTenantConcurrencyStats())
+}
+
+func TestTenantSchedulerFairness(t *testing.T) {
+	scheduler := newTenantScheduler(TenantConcurrencyLimits{MaxInFlight: 2})
+	ctx := context.Background()
+
+	// The noisy tenant takes both slots, and queues 3 more requests before the quiet tenant's request.
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, err := scheduler.acquire(ctx, "noisy")
+		assert.Nil(t, err)
+		releases = append(releases, release)
+	}
+	granted := make(chan string, 4)
+	grantedReleases := make(chan func(), 4)
+	queue := func(tenant string) {
+		go func() {
+			release, err := scheduler.acquire(ctx, tenant)
+			assert.Nil(t, err)
+			granted <- tenant
+			grantedReleases <- release
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		queue("noisy")
+	}
+	waitForTenantStats(t, scheduler, []TenantConcurrencyStats{{Tenant: "noisy", InFlight: 2, Waiting: 3}})
+	queue("quiet")
+	waitForTenantStats(t, scheduler, []TenantConcurrencyStats{
+		{Tenant: "noisy", InFlight: 2, Waiting: 3},
+		{Tenant: "quiet", InFlight: 0, Waiting: 1},
+	})
+
+	// The released slots are granted to the tenants in turn.
+	releases[0]()
+	assert.Equal(t, "noisy", <-granted)
+	releases[1]()
+	assert.Equal(t, "quiet", <-granted)
+	waitForTenantStats(t, scheduler, []TenantConcurrencyStats{
+		{Tenant: "noisy", InFlight: 1, Waiting: 2},
+		{Tenant: "quiet", InFlight: 1, Waiting: 0},
+	})
+
+	// Releasing a slot again has no effect.
+	releases[1]()
+	waitForTenantStats(t, scheduler, []TenantConcurrencyStats{
+		{Tenant: "noisy", InFlight: 1, Waiting: 2},
+		{Tenant: "quiet", InFlight: 1, Waiting: 0},
+	})
+
+	// Once every request is released, no tenant remains.
+	for i := 0; i < 4; i++ {
+		(<-grantedReleases)()
+	}
+	waitForTenantStats(t, scheduler, []TenantConcurrencyStats{})
+}
+
+func TestTenantSchedulerPerTenantLimit(t *testing.T) {
+	scheduler := newTenantScheduler(TenantConcurrencyLimits{MaxInFlight: 3, MaxInFlightPerTenant: 1})
+
+	release, err := scheduler.acquire(context.Background(), "tenant-1")
+	assert.Nil(t, err)
+
+	// The tenant's next request waits until its context is done, while other tenants get a slot.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = scheduler.acquire(ctx, "tenant-1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	release2, err := scheduler.acquire(context.Background(), "tenant-2")
+	assert.Nil(t, err)
+	release3, err := scheduler.acquire(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, []TenantConcurrencyStats{
+		{Tenant: "", InFlight: 1, Waiting: 0},
+		{Tenant: "tenant-1", InFlight: 1, Waiting: 0},
+		{Tenant: "tenant-2", InFlight: 1, Waiting: 0},
+	}, scheduler.getStats())
+
+	release()
+	release2()
+	release3()
+	assert.Equal(t, []TenantConcurrencyStats{}, scheduler.getStats())
+}
+
+func TestTenantConcurrencyLimitsRequest(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	assert.Nil(t, service.SetTenantConcurrencyLimits(&TenantConcurrencyLimits{MaxInFlight: 2, MaxInFlightPerTenant: 1}))
+	newRequest := func(ctx context.Context, path string) *http.Request {
+		builder := NewRequestBuilder(GET).WithContext(ctx)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// While a request of tenant-1 is in flight, its other requests wait, but those of tenant-2 don't.
+	done := make(chan error)
+	go func() {
+		_, err := service.Request(newRequest(WithTenant(context.Background(), "tenant-1"), "/slow"), nil)
+		done <- err
+	}()
+	waitForTenantStats(t, service.tenantConcurrency, []TenantConcurrencyStats{{Tenant: "tenant-1", InFlight: 1}})
+
+	ctx, cancel := context.WithTimeout(WithTenant(context.Background(), "tenant-1"), 50*time.Millisecond)
+	defer cancel()
+	_, err = service.Request(newRequest(ctx, "/fast"), nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	_, err = service.Request(newRequest(WithTenant(context.Background(), "tenant-2"), "/fast"), nil)
+	assert.Nil(t, err)
+
+	close(unblock)
+	assert.Nil(t, <-done)
+	assert.Equal(t, []TenantConcurrencyStats{}, service.GetTenantConcurrencyStats())
+
+	// The slot of a streamed response is held until the body is closed.
+	var body io.ReadCloser
+	_, err = service.Request(newRequest(WithTenant(context.Background(), "tenant-1"), "/fast"), &body)
+	assert.Nil(t, err)
+	assert.Equal(t, []TenantConcurrencyStats{{Tenant: "tenant-1", InFlight: 1}}, service.GetTenantConcurrencyStats())
+	assert.Nil(t, body.Close())
+	assert.Equal(t, []TenantConcurrencyStats{}, service.GetTenantConcurrencyStats())
+}
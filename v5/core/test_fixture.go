@@ -0,0 +1,226 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"go/format"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// TestFixtureOptions holds the configuration used by WriteTestFixture.
+type TestFixtureOptions struct {
+	// The name of the Go package of the generated file; defaults to "main" [optional].
+	Package string
+
+	// The name used to derive the names of the generated fixture variable
+	// and handler function (e.g. "getResource" results in "getResourceFixture"
+	// and "getResourceHandler"); defaults to "recorded" [optional].
+	Name string
+}
+
+// The response headers that are not included in a test fixture, since they are
+// set by the mock server itself (or are meaningless within a test).
+var testFixtureSkippedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Date":              true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Content-Encoding":  true,
+}
+
+// WriteTestFixture writes to "w" the source of a Go file containing a test fixture for
+// a response recorded by a HARRecorder (see HARRecorder.HAR()), so that regression tests
+// can be written against a live response. The generated file contains:
+//
+// 1. A "<name>Fixture" variable describing the request (method, path and query) and
+// the response (status code, headers and body).
+//
+// 2. A "<name>Handler" function: a mock-server handler that responds to a matching request
+// with the recorded response (and to any other request with a 404 response), for use
+// with httptest.NewServer(http.HandlerFunc(<name>Handler)).
+//
+// Secrets are redacted from the fixture (in addition to the redaction performed by the
+// HARRecorder), but the generated file should still be reviewed before it is committed.
+func WriteTestFixture(w io.Writer, entry *HAREntry, options *TestFixtureOptions) error {
+	if entry == nil || entry.Request == nil || entry.Response == nil {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "entry")
+	}
+	if options == nil {
+		options = &TestFixtureOptions{}
+	}
+
+	data := testFixtureData{
+		Package: options.Package,
+		Name:    options.Name,
+		Method:  strconv.Quote(entry.Request.Method),
+		Status:  entry.Response.Status,
+	}
+	if data.Package == "" {
+		data.Package = "main"
+	}
+	if data.Name == "" {
+		data.Name = "recorded"
+	}
+	if !isGoIdentifier(data.Package) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "Package")
+	}
+	if !isGoIdentifier(data.Name) {
+		return fmt.Errorf(ERRORMSG_PROP_INVALID, "Name")
+	}
+
+	requestURL, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return err
+	}
+	data.Path = strconv.Quote(requestURL.Path)
+	data.Query = strconv.Quote(requestURL.RawQuery)
+
+	// Group the values of each header (in their recorded order).
+	headerIndex := make(map[string]int)
+	for _, header := range entry.Response.Headers {
+		name := http.CanonicalHeaderKey(header.Name)
+		if testFixtureSkippedHeaders[name] {
+			continue
+		}
+		i, ok := headerIndex[name]
+		if !ok {
+			i = len(data.Headers)
+			headerIndex[name] = i
+			data.Headers = append(data.Headers, testFixtureHeader{Name: strconv.Quote(name)})
+		}
+		data.Headers[i].Values = append(data.Headers[i].Values, strconv.Quote(header.Value))
+	}
+
+	if content := entry.Response.Content; content != nil {
+		body := []byte(content.Text)
+		if content.Encoding == "base64" {
+			if body, err = base64.StdEncoding.DecodeString(content.Text); err != nil {
+				return err
+			}
+		} else {
+			body = []byte(RedactSecrets(content.Text))
+		}
+		data.Body = goStringLiteral(string(body))
+	} else {
+		data.Body = `""`
+	}
+
+	var buf bytes.Buffer
+	if err = testFixtureTemplate.Execute(&buf, data); err != nil {
+		return err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(source)
+	return err
+}
+
+// testFixtureData holds the (quoted) values used to generate a test fixture.
+type testFixtureData struct {
+	Package string
+	Name    string
+	Method  string
+	Path    string
+	Query   string
+	Status  int
+	Headers []testFixtureHeader
+	Body    string
+}
+
+// testFixtureHeader holds the (quoted) name and values of a header within a test fixture.
+type testFixtureHeader struct {
+	Name   string
+	Values []string
+}
+
+var testFixtureTemplate = template.Must(template.New("fixture").Parse(`// Code generated by core.WriteTestFixture from a recorded response. Review before committing.
+
+package {{.Package}}
+
+import (
+	"net/http"
+)
+
+// {{.Name}}Fixture holds the recorded request and response.
+var {{.Name}}Fixture = struct {
+	Method     string
+	Path       string
+	Query      string
+	StatusCode int
+	Header     http.Header
+	Body       string
+}{
+	Method:     {{.Method}},
+	Path:       {{.Path}},
+	Query:      {{.Query}},
+	StatusCode: {{.Status}},
+	Header: http.Header{
+{{- range .Headers}}
+		{{.Name}}: []string{ {{- range $i, $v := .Values}}{{if $i}}, {{end}}{{$v}}{{end -}} },
+{{- end}}
+	},
+	Body: {{.Body}},
+}
+
+// {{.Name}}Handler is a mock-server handler that responds to a request matching
+// {{.Name}}Fixture's method and path with the recorded response.
+func {{.Name}}Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != {{.Name}}Fixture.Method || r.URL.Path != {{.Name}}Fixture.Path {
+		http.NotFound(w, r)
+		return
+	}
+	for name, values := range {{.Name}}Fixture.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader({{.Name}}Fixture.StatusCode)
+	_, _ = w.Write([]byte({{.Name}}Fixture.Body))
+}
+`))
+
+// goStringLiteral returns a Go string literal for "s": a raw string literal
+// (which keeps JSON bodies readable) if possible, otherwise a quoted string.
+func goStringLiteral(s string) string {
+	if strings.ContainsAny(s, "`\r") || !strconv.CanBackquote(strings.Replace(s, "\n", "", -1)) {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// isGoIdentifier returns true iff "s" is a valid Go identifier.
+func isGoIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
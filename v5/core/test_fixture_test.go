@@ -0,0 +1,96 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTestFixture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(CONTENT_TYPE, APPLICATION_JSON)
+		w.Header().Add("X-Trace", "a")
+		w.Header().Add("X-Trace", "b")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"name": "wonder woman", "apikey": "top-secret"}`)
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder(nil)
+	recorder.Start()
+	client := &http.Client{Transport: recorder.Transport(http.DefaultTransport)}
+	resp, err := client.Get(server.URL + "/v1/heroes?limit=1")
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	entries := recorder.HAR().Log.Entries
+	assert.Len(t, entries, 1)
+
+	var buf bytes.Buffer
+	err = WriteTestFixture(&buf, entries[0], &TestFixtureOptions{Package: "heroesv1", Name: "getHero"})
+	assert.Nil(t, err)
+	source := buf.String()
+
+	// The generated source is valid Go.
+	_, err = parser.ParseFile(token.NewFileSet(), "fixture.go", source, 0)
+	assert.Nil(t, err)
+
+	assert.Contains(t, source, "package heroesv1\n")
+	assert.Contains(t, source, "var getHeroFixture = struct {")
+	assert.Contains(t, source, "func getHeroHandler(w http.ResponseWriter, r *http.Request) {")
+	assert.Contains(t, source, `Method:     "GET",`)
+	assert.Contains(t, source, `Path:       "/v1/heroes",`)
+	assert.Contains(t, source, `Query:      "limit=1",`)
+	assert.Contains(t, source, `StatusCode: 201,`)
+	assert.Contains(t, source, `"X-Trace":      []string{"a", "b"},`)
+	assert.Contains(t, source, `"Set-Cookie":   []string{"[redacted]"},`)
+	assert.NotContains(t, source, "Content-Length")
+	assert.Contains(t, source, "Body: `{\"name\": \"wonder woman\", \"apikey\":\"[redacted]\"}`,")
+	assert.NotContains(t, source, "top-secret")
+}
+
+func TestWriteTestFixtureErrors(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NotNil(t, WriteTestFixture(&buf, nil, nil))
+
+	entry := &HAREntry{
+		Request:  &HARRequest{Method: "GET", URL: "http://localhost/v1"},
+		Response: &HARResponse{Status: 204},
+	}
+	assert.NotNil(t, WriteTestFixture(&buf, entry, &TestFixtureOptions{Name: "get-hero"}))
+	assert.NotNil(t, WriteTestFixture(&buf, entry, &TestFixtureOptions{Package: "1pkg"}))
+	assert.Equal(t, 0, buf.Len())
+
+	// The default package and name are used, and a body that can't be
+	// represented as a raw string literal is quoted.
+	entry.Response.Content = &HARContent{Text: "line 1\r\nline `2`"}
+	assert.Nil(t, WriteTestFixture(&buf, entry, nil))
+	assert.Contains(t, buf.String(), "package main\n")
+	assert.Contains(t, buf.String(), "var recordedFixture = struct {")
+	assert.Contains(t, buf.String(), `"line 1\r\nline `+"`2`"+`",`)
+}
@@ -0,0 +1,82 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"time"
+)
+
+// TokenAcquisitionPolicy limits how long an authenticator (e.g. the IamAuthenticator) waits for
+// a new access token when its cached token can no longer be used as is, for latency-sensitive
+// applications. If the new token isn't obtained within MaxWait, then the request proceeds with
+// the cached token (if it hasn't expired, or expired no more than ExpiredTokenGracePeriod ago),
+// and the new token continues to be obtained in the background.
+type TokenAcquisitionPolicy struct {
+	// The maximum time to wait for a new access token when a cached token is available.
+	// Zero (the default) means that the wait is not limited.
+	MaxWait time.Duration
+
+	// The time after its expiration during which a cached token may still be used (if the
+	// service tolerates recently-expired tokens). Zero (the default) means that an expired
+	// token is never used.
+	ExpiredTokenGracePeriod time.Duration
+}
+
+// allowsCachedToken returns true iff the policy allows a cached token that expires at
+// "expiration" (in seconds since the epoch; 0 if there's no cached token) to be used if a new
+// token isn't obtained in time.
+func (policy *TokenAcquisitionPolicy) allowsCachedToken(expiration int64) bool {
+	if policy == nil || policy.MaxWait <= 0 || expiration <= 0 {
+		return false
+	}
+	gracePeriod := int64(0)
+	if policy.ExpiredTokenGracePeriod > 0 {
+		gracePeriod = int64(policy.ExpiredTokenGracePeriod / time.Second)
+	}
+	return GetCurrentTime() < expiration+gracePeriod
+}
+
+// requestTokenWithinPolicy invokes "requestToken" to obtain a new access token synchronously.
+// If "policy" allows the cached token (which expires at "expiration") to be used, then it waits
+// at most policy.MaxWait for the new token and then returns nil (so that the cached token is used),
+// leaving the new token to be obtained in the background (regardless of "ctx").
+func requestTokenWithinPolicy(ctx context.Context, policy *TokenAcquisitionPolicy, expiration int64,
+	requestToken func(context.Context) error) error {
+	if !policy.allowsCachedToken(expiration) {
+		return requestToken(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- requestToken(context.Background())
+	}()
+
+	timer := time.NewTimer(policy.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-timer.C:
+		GetLogger().Debug("A new access token was not obtained within %s, so the cached access token is used", policy.MaxWait)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,162 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSlowIamTestServer returns a token server that returns "iamAuthTestAccessToken1" in response to
+// the first request, and "iamAuthTestAccessToken2" after waiting for "delay" in response to the others.
+func newSlowIamTestServer(requests *int32, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken := iamAuthTestAccessToken1
+		if atomic.AddInt32(requests, 1) > 1 {
+			time.Sleep(delay)
+			accessToken = iamAuthTestAccessToken2
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			accessToken, GetCurrentTime()+3600)
+	}))
+}
+
+func TestIamTokenAcquisitionPolicy(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newSlowIamTestServer(&requests, 500*time.Millisecond)
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{
+			TokenAcquisitionPolicy: &TokenAcquisitionPolicy{
+				MaxWait:                 50 * time.Millisecond,
+				ExpiredTokenGracePeriod: time.Minute,
+			},
+		}).
+		Build()
+	assert.Nil(t, err)
+
+	// There's no cached token, so the first token is awaited.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// The recently-expired token is used, since the new token isn't obtained in time.
+	authenticator.getTokenData().Expiration = GetCurrentTime() - 1
+	start := time.Now()
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Less(t, int64(time.Since(start)), int64(400*time.Millisecond))
+
+	// The new token is obtained in the background.
+	assert.Eventually(t, func() bool {
+		return authenticator.getTokenData().AccessToken == iamAuthTestAccessToken2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestIamTokenAcquisitionPolicyExpiredToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newSlowIamTestServer(&requests, 200*time.Millisecond)
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{
+			TokenAcquisitionPolicy: &TokenAcquisitionPolicy{
+				MaxWait:                 50 * time.Millisecond,
+				ExpiredTokenGracePeriod: time.Minute,
+			},
+		}).
+		Build()
+	assert.Nil(t, err)
+
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// A token that expired before the grace period isn't used, so the new token is awaited.
+	authenticator.getTokenData().Expiration = GetCurrentTime() - 120
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken2, token)
+}
+
+func TestTokenAcquisitionPolicyAllowsCachedToken(t *testing.T) {
+	now := GetCurrentTime()
+
+	var policy *TokenAcquisitionPolicy
+	assert.False(t, policy.allowsCachedToken(now+60))
+
+	policy = &TokenAcquisitionPolicy{}
+	assert.False(t, policy.allowsCachedToken(now+60))
+
+	policy = &TokenAcquisitionPolicy{MaxWait: time.Second}
+	assert.True(t, policy.allowsCachedToken(now+60))
+	assert.False(t, policy.allowsCachedToken(now-1))
+	assert.False(t, policy.allowsCachedToken(0))
+
+	policy.ExpiredTokenGracePeriod = time.Minute
+	assert.True(t, policy.allowsCachedToken(now-30))
+	assert.False(t, policy.allowsCachedToken(now-90))
+}
+
+func TestRequestTokenWithinPolicy(t *testing.T) {
+	policy := &TokenAcquisitionPolicy{MaxWait: 10 * time.Millisecond}
+	expiration := GetCurrentTime() + 60
+
+	// An error obtained within the wait is returned.
+	err := requestTokenWithinPolicy(context.Background(), policy, expiration, func(context.Context) error {
+		return fmt.Errorf("token server unavailable")
+	})
+	assert.NotNil(t, err)
+
+	// The new token continues to be obtained after the caller's context is done.
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	err = requestTokenWithinPolicy(ctx, policy, expiration, func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		done <- ctx.Err()
+		return nil
+	})
+	assert.Nil(t, err)
+	cancel()
+	assert.Nil(t, <-done)
+
+	// A done context is reported.
+	err = requestTokenWithinPolicy(ctx, policy, expiration, func(context.Context) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,210 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// The delay before the first retry of a failed automatic refresh, which doubles with each
+	// consecutive failure up to the maximum delay.
+	autoRefreshMinRetryDelay = time.Second
+	autoRefreshMaxRetryDelay = time.Minute
+)
+
+// TokenAutoRefresher is implemented by authenticators that cache an access token.
+// It can be used to keep the cached access token fresh, so that no request (e.g. the first request
+// after a long idle period) has to wait for a new access token to be obtained from the token server.
+// These authenticators also implement io.Closer: their Close() method cancels any token request
+// in flight (e.g. a refresh started in the background) and stops the automatic refresh, so that
+// no goroutine outlives the authenticator (e.g. in a test or a short-lived program).
+type TokenAutoRefresher interface {
+	// StartAutoRefresh starts a goroutine that obtains an access token and then refreshes it when
+	// its refresh time is reached (rather than when the authenticator is next used), until "ctx" is done.
+	// A failed refresh is retried with an exponential backoff (up to 1 minute).
+	// The goroutine should be started once per authenticator.
+	StartAutoRefresh(ctx context.Context)
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+func (authenticator *IamAuthenticator) StartAutoRefresh(ctx context.Context) {
+	go autoRefreshToken(ctx, AUTHTYPE_IAM, func() (time.Duration, bool) {
+		return untilIamTokenRefresh(authenticator.getTokenData())
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *IamAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+	return nil
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+func (authenticator *IamAssumeAuthenticator) StartAutoRefresh(ctx context.Context) {
+	go autoRefreshToken(ctx, AUTHTYPE_IAM_ASSUME, func() (time.Duration, bool) {
+		return untilIamTokenRefresh(authenticator.getTokenData())
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token,
+// and closes the authenticator that obtains the access token that is exchanged.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *IamAssumeAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+
+	authenticator.sourceMutex.Lock()
+	defer authenticator.sourceMutex.Unlock()
+	if authenticator.sourceAuthenticator != nil {
+		return authenticator.sourceAuthenticator.Close()
+	}
+	return nil
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+func (authenticator *ContainerAuthenticator) StartAutoRefresh(ctx context.Context) {
+	go autoRefreshToken(ctx, AUTHTYPE_CONTAINER, func() (time.Duration, bool) {
+		return untilIamTokenRefresh(authenticator.getTokenData())
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *ContainerAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+	return nil
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+func (authenticator *VpcInstanceAuthenticator) StartAutoRefresh(ctx context.Context) {
+	go autoRefreshToken(ctx, AUTHTYPE_VPC, func() (time.Duration, bool) {
+		return untilIamTokenRefresh(authenticator.getTokenData())
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *VpcInstanceAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+	return nil
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+func (authenticator *IamMtlsAuthenticator) StartAutoRefresh(ctx context.Context) {
+	go autoRefreshToken(ctx, AUTHTYPE_IAM_MTLS, func() (time.Duration, bool) {
+		return untilIamTokenRefresh(authenticator.getTokenData())
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *IamMtlsAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+	return nil
+}
+
+// StartAutoRefresh starts a goroutine that keeps the cached access token fresh until "ctx" is done.
+// It has no effect if the authenticator can't obtain a new access token by itself
+// (i.e. it is configured with a passcode or bearer token).
+func (authenticator *CloudPakForDataAuthenticator) StartAutoRefresh(ctx context.Context) {
+	if !authenticator.canRefreshSilently() {
+		GetLogger().Debug("The %s authenticator's access token can't be refreshed automatically", AUTHTYPE_CP4D)
+		return
+	}
+	go autoRefreshToken(ctx, AUTHTYPE_CP4D, func() (time.Duration, bool) {
+		tokenData := authenticator.getTokenData()
+		if tokenData == nil || tokenData.AccessToken == "" {
+			return 0, false
+		}
+		return time.Duration(tokenData.RefreshTime-GetCurrentTime()) * time.Second, true
+	}, &authenticator.tokenRequests, authenticator.invokeRequestTokenData)
+}
+
+// Close cancels any token request in flight and stops the automatic refresh of the access token.
+// A new access token can't be obtained once the authenticator is closed.
+func (authenticator *CloudPakForDataAuthenticator) Close() error {
+	authenticator.tokenRequests.close()
+	return nil
+}
+
+// untilIamTokenRefresh returns the time remaining until the refresh time of "tokenData",
+// or false if there is no cached token.
+func untilIamTokenRefresh(tokenData *iamTokenData) (time.Duration, bool) {
+	if tokenData == nil || tokenData.AccessToken == "" {
+		return 0, false
+	}
+	return time.Duration(tokenData.RefreshTime-GetCurrentTime()) * time.Second, true
+}
+
+// autoRefreshToken obtains a new access token whenever "untilRefresh" reports that there is no cached
+// token or its refresh time was reached, until "ctx" is done or the authenticator is closed. "requests"
+// coalesces the authenticator's concurrent token requests and "requestToken" fetches a new token and
+// stores it in the cache.
+func autoRefreshToken(ctx context.Context, authType string, untilRefresh func() (time.Duration, bool),
+	requests *tokenRequestGroup, requestToken func(context.Context) error) {
+	GetLogger().Debug("Starting the automatic refresh of the %s access token", authType)
+	defer GetLogger().Debug("Stopped the automatic refresh of the %s access token", authType)
+
+	isDue := func() bool {
+		wait, ok := untilRefresh()
+		return !ok || wait <= 0
+	}
+
+	closed := requests.context()
+	retryDelay := autoRefreshMinRetryDelay
+	for {
+		wait, ok := untilRefresh()
+		if !ok || wait <= 0 {
+			_, err := requests.do(ctx, func(ctx context.Context) error {
+				// Another goroutine might have refreshed the token in the meantime.
+				if !isDue() {
+					return nil
+				}
+				return requestToken(ctx)
+			})
+			if ctx.Err() != nil || closed.Err() != nil {
+				return
+			}
+
+			wait, ok = untilRefresh()
+			if err != nil || !ok || wait <= 0 {
+				// Retry with an exponential backoff (e.g. while the token server is unavailable).
+				if err != nil {
+					GetLogger().Warn("Unable to refresh the %s access token automatically: %s", authType, err.Error())
+				}
+				wait = retryDelay
+				retryDelay *= 2
+				if retryDelay > autoRefreshMaxRetryDelay {
+					retryDelay = autoRefreshMaxRetryDelay
+				}
+			} else {
+				retryDelay = autoRefreshMinRetryDelay
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-closed.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
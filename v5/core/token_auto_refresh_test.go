@@ -0,0 +1,281 @@
+// +build all slow auth
+
+package core
+
+// (C) Copyright IBM Corp. 2019, 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The authenticators that refresh their access tokens automatically.
+var (
+	_ TokenAutoRefresher = &IamAuthenticator{}
+	_ TokenAutoRefresher = &IamAssumeAuthenticator{}
+	_ TokenAutoRefresher = &ContainerAuthenticator{}
+	_ TokenAutoRefresher = &VpcInstanceAuthenticator{}
+	_ TokenAutoRefresher = &CloudPakForDataAuthenticator{}
+
+	_ io.Closer = &IamAuthenticator{}
+	_ io.Closer = &IamAssumeAuthenticator{}
+	_ io.Closer = &ContainerAuthenticator{}
+	_ io.Closer = &VpcInstanceAuthenticator{}
+	_ io.Closer = &CloudPakForDataAuthenticator{}
+)
+
+func TestIamStartAutoRefresh(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	// The first request fails, and each token must be refreshed after (at most) 2 seconds.
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 2, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+2)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	authenticator.StartAutoRefresh(ctx)
+
+	// The failed request is retried, and the token is then refreshed without being used.
+	assert.Eventually(t, func() bool {
+		return authenticator.getTokenData() != nil
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&requests) == 3
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// The cached token is used by a request.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// Once the context is done, the token is no longer refreshed.
+	cancel()
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestCp4dStartAutoRefreshWithoutCredentials(t *testing.T) {
+	authenticator := &CloudPakForDataAuthenticator{
+		URL:         "https://cp4d.example.com",
+		BearerToken: newCp4dTestToken(GetCurrentTime(), GetCurrentTime()+3600),
+	}
+
+	// The token can't be refreshed, so the bearer token isn't used until the authenticator is.
+	authenticator.StartAutoRefresh(context.Background())
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, authenticator.getTokenData())
+}
+
+// newHangingTokenServer returns a token server that doesn't respond until each request is abandoned.
+// "started" receives a value when a request is received, and "abandoned" when it is abandoned.
+func newHangingTokenServer() (server *httptest.Server, started chan struct{}, abandoned chan struct{}) {
+	started = make(chan struct{}, 10)
+	abandoned = make(chan struct{}, 10)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices that the client went away only once the request body is read.
+		_, _ = ioutil.ReadAll(r.Body)
+		started <- struct{}{}
+		<-r.Context().Done()
+		abandoned <- struct{}{}
+	}))
+	return
+}
+
+// newRefreshableIamTokenData returns a valid token whose refresh time was reached.
+func newRefreshableIamTokenData() *iamTokenData {
+	return &iamTokenData{
+		AccessToken: iamAuthTestAccessToken1,
+		RefreshTime: GetCurrentTime() - 1,
+		Expiration:  GetCurrentTime() + 3600,
+	}
+}
+
+func TestIamBackgroundRefreshTimeout(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server, started, abandoned := newHangingTokenServer()
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{BackgroundRefreshTimeout: 100 * time.Millisecond}).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 100*time.Millisecond, authenticator.BackgroundRefreshTimeout)
+	authenticator.setTokenData(newRefreshableIamTokenData())
+
+	// The cached token is used while it is refreshed in the background.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	// The refresh is abandoned after the timeout.
+	<-started
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The background refresh wasn't abandoned")
+	}
+	assert.Eventually(t, func() bool {
+		authenticator.tokenRequests.mutex.Lock()
+		defer authenticator.tokenRequests.mutex.Unlock()
+		return authenticator.tokenRequests.flight == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestIamClose(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server, started, abandoned := newHangingTokenServer()
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	authenticator.setTokenData(newRefreshableIamTokenData())
+
+	// Closing the authenticator cancels the refresh started in the background.
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	<-started
+	assert.Nil(t, authenticator.Close())
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The background refresh wasn't canceled")
+	}
+
+	// The cached token can still be used, but a new token can't be obtained.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, "The authenticator is closed", err.Error())
+
+	// Closing it again has no effect.
+	assert.Nil(t, authenticator.Close())
+}
+
+func TestIamCloseCancelsEnsureFreshToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	server, started, abandoned := newHangingTokenServer()
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// Closing the authenticator cancels the token request made by EnsureFreshToken().
+	result := make(chan error, 1)
+	go func() {
+		result <- authenticator.EnsureFreshToken(context.Background(), time.Minute)
+	}()
+	<-started
+	assert.Nil(t, authenticator.Close())
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The token request wasn't canceled")
+	}
+	select {
+	case err = <-result:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("EnsureFreshToken() didn't return")
+	}
+}
+
+func TestCloseStopsAutoRefresh(t *testing.T) {
+	var requests tokenRequestGroup
+	var refreshes int32
+	untilRefresh := func() (time.Duration, bool) {
+		return time.Hour, true
+	}
+	requestToken := func(context.Context) error {
+		atomic.AddInt32(&refreshes, 1)
+		return nil
+	}
+
+	// The goroutine waiting for the next refresh stops when the authenticator is closed.
+	stopped := make(chan struct{})
+	go func() {
+		autoRefreshToken(context.Background(), AUTHTYPE_IAM, untilRefresh, &requests, requestToken)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	requests.close()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The automatic refresh wasn't stopped")
+	}
+
+	// Once the authenticator is closed, the automatic refresh stops immediately.
+	untilRefresh = func() (time.Duration, bool) {
+		return 0, false
+	}
+	autoRefreshToken(context.Background(), AUTHTYPE_IAM, untilRefresh, &requests, requestToken)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&refreshes))
+}
+
+func TestIamAssumeClose(t *testing.T) {
+	authenticator, err := NewIamAssumeAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetTrustedProfileID("iam-Profile-1").
+		SetTokenManagementOptions(TokenManagementOptions{BackgroundRefreshTimeout: time.Second}).
+		Build()
+	assert.Nil(t, err)
+
+	// The authenticator of the access token that is exchanged is closed too.
+	source, ok := authenticator.getSourceAuthenticator().(*IamAuthenticator)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, source.BackgroundRefreshTimeout)
+	assert.Nil(t, authenticator.Close())
+	assert.NotNil(t, authenticator.tokenRequests.context().Err())
+	assert.NotNil(t, source.tokenRequests.context().Err())
+}
@@ -0,0 +1,144 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// TokenCache stores the IAM token server responses obtained by the IamAuthenticator,
+// ContainerAuthenticator and VpcInstanceAuthenticator, so that an access token can be shared by
+// authenticators with the same configuration (e.g. the same apikey) and, depending on the
+// implementation, across processes (e.g. successive invocations of a CLI tool, or of a
+// short-lived function). An implementation might store the tokens in memory (see
+// NewMemoryTokenCache()), in a file, or in a service such as Redis or memcached.
+//
+// Each key is derived from an authenticator's configuration, and contains no secrets. A token
+// obtained from the cache is used only if it doesn't need to be refreshed yet. An error returned
+// by the cache is logged, but doesn't prevent the authenticator from obtaining a token from
+// the token server. The methods must be safe for concurrent use.
+type TokenCache interface {
+	// Get returns the token stored under "key", or nil if there is none.
+	Get(key string) (*IamTokenServerResponse, error)
+
+	// Put stores "token" under "key", replacing any token already stored under "key".
+	Put(key string, token *IamTokenServerResponse) error
+
+	// Delete removes the token (if any) stored under "key".
+	Delete(key string) error
+}
+
+// NewMemoryTokenCache returns a TokenCache that stores tokens in memory, so that they are
+// shared by the authenticators (with the same configuration) within a process.
+func NewMemoryTokenCache() TokenCache {
+	return &memoryTokenCache{tokens: make(map[string]IamTokenServerResponse)}
+}
+
+// memoryTokenCache is a TokenCache that stores tokens in memory.
+type memoryTokenCache struct {
+	tokens map[string]IamTokenServerResponse
+	mutex  sync.Mutex
+}
+
+func (cache *memoryTokenCache) Get(key string) (*IamTokenServerResponse, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	token, ok := cache.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (cache *memoryTokenCache) Put(key string, token *IamTokenServerResponse) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.tokens[key] = *token
+	return nil
+}
+
+func (cache *memoryTokenCache) Delete(key string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.tokens, key)
+	return nil
+}
+
+// newTokenCacheKey returns the key under which the tokens obtained by an authenticator whose
+// configuration consists of "properties" are cached: a digest of the properties, so that secrets
+// such as an apikey don't appear in the key. An empty key is returned if "cache" is nil.
+func newTokenCacheKey(cache TokenCache, authType string, properties ...string) string {
+	if cache == nil {
+		return ""
+	}
+	digest := sha256.Sum256([]byte(strings.Join(properties, "\x00")))
+	return authType + ":" + hex.EncodeToString(digest[:])
+}
+
+// loadCachedIamToken returns the token data of the token cached under "key", or nil if no token
+// is cached, or if the cached token needs to be refreshed or its claims don't match "expectedIssuer"
+// and "expectedAudience". No token is used for a request made by a health check ("ctx").
+func loadCachedIamToken(ctx context.Context, cache TokenCache, key string, expectedIssuer string,
+	expectedAudience string) *iamTokenData {
+	if cache == nil || key == "" || isHealthCheck(ctx) {
+		return nil
+	}
+
+	tokenResponse, err := cache.Get(key)
+	if err != nil {
+		GetLogger().Warn("Unable to obtain a token from the token cache: %s", err.Error())
+		return nil
+	}
+	if tokenResponse == nil {
+		return nil
+	}
+	if validateTokenClaims(tokenResponse.AccessToken, expectedIssuer, expectedAudience) != nil {
+		return nil
+	}
+	tokenData, err := newIamTokenData(tokenResponse)
+	if err != nil || !tokenData.isTokenValid() || GetCurrentTime() > tokenData.RefreshTime {
+		return nil
+	}
+
+	GetLogger().Debug("Using the access token obtained from the token cache")
+	return tokenData
+}
+
+// storeCachedIamToken stores "tokenResponse" under "key" in "cache" (if not nil).
+func storeCachedIamToken(cache TokenCache, key string, tokenResponse *IamTokenServerResponse) {
+	if cache == nil || key == "" {
+		return
+	}
+	if err := cache.Put(key, tokenResponse); err != nil {
+		GetLogger().Warn("Unable to store a token in the token cache: %s", err.Error())
+	}
+}
+
+// deleteCachedIamToken removes the token (if any) stored under "key" in "cache" (if not nil).
+func deleteCachedIamToken(cache TokenCache, key string) {
+	if cache == nil || key == "" {
+		return
+	}
+	if err := cache.Delete(key); err != nil {
+		GetLogger().Warn("Unable to remove a token from the token cache: %s", err.Error())
+	}
+}
@@ -0,0 +1,197 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingTokenCache is a TokenCache whose methods always fail.
+type failingTokenCache struct{}
+
+func (failingTokenCache) Get(key string) (*IamTokenServerResponse, error) {
+	return nil, errors.New("cache unavailable")
+}
+
+func (failingTokenCache) Put(key string, token *IamTokenServerResponse) error {
+	return errors.New("cache unavailable")
+}
+
+func (failingTokenCache) Delete(key string) error {
+	return errors.New("cache unavailable")
+}
+
+func newTokenCacheTestServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+}
+
+func TestMemoryTokenCache(t *testing.T) {
+	cache := NewMemoryTokenCache()
+
+	token, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+
+	stored := &IamTokenServerResponse{AccessToken: "token"}
+	assert.Nil(t, cache.Put("key", stored))
+	stored.AccessToken = "modified"
+	token, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+
+	assert.Nil(t, cache.Delete("key"))
+	token, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Nil(t, token)
+}
+
+func TestIamTokenCacheShared(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	cache := NewMemoryTokenCache()
+	newAuthenticator := func(apikey string) *IamAuthenticator {
+		authenticator, err := NewIamAuthenticatorBuilder().
+			SetApiKey(apikey).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+			Build()
+		assert.Nil(t, err)
+		return authenticator
+	}
+
+	// The second authenticator uses the token obtained by the first.
+	token, err := newAuthenticator(iamAuthMockApiKey).GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	authenticator := newAuthenticator(iamAuthMockApiKey)
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// An authenticator with a different apikey obtains its own token.
+	_, err = newAuthenticator("other-apikey").GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// The cache key doesn't contain the apikey.
+	assert.NotContains(t, authenticator.tokenCacheKey(), iamAuthMockApiKey)
+
+	// Invalidating the token removes it from the cache.
+	authenticator.InvalidateToken()
+	cached, err := cache.Get(authenticator.tokenCacheKey())
+	assert.Nil(t, err)
+	assert.Nil(t, cached)
+	_, err = newAuthenticator(iamAuthMockApiKey).GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+}
+
+func TestIamTokenCacheExpiredToken(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	cache := NewMemoryTokenCache()
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+		Build()
+	assert.Nil(t, err)
+
+	// A cached token that needs to be refreshed isn't used.
+	assert.Nil(t, cache.Put(authenticator.tokenCacheKey(), &IamTokenServerResponse{
+		AccessToken: "expired",
+		ExpiresIn:   3600,
+		Expiration:  GetCurrentTime() + 60,
+	}))
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	cached, err := cache.Get(authenticator.tokenCacheKey())
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, cached.AccessToken)
+}
+
+func TestIamTokenCacheFailure(t *testing.T) {
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	original := GetLogger()
+	defer SetLogger(original)
+	stdout, stderr, logger := stringLogger(LevelWarn)
+	SetLogger(logger)
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{TokenCache: failingTokenCache{}}).
+		Build()
+	assert.Nil(t, err)
+
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	assert.Contains(t, stdout.String()+stderr.String(), "cache unavailable")
+}
+
+func TestContainerTokenCacheShared(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := newTokenCacheTestServer(&requests)
+	defer server.Close()
+
+	cache := NewMemoryTokenCache()
+	for i := 0; i < 2; i++ {
+		authenticator, err := NewContainerAuthenticatorBuilder().
+			SetIAMProfileName(containerAuthMockIAMProfileName).
+			SetCRTokenFilename(containerAuthMockCRTokenFile).
+			SetURL(server.URL).
+			SetTokenManagementOptions(TokenManagementOptions{TokenCache: cache}).
+			Build()
+		assert.Nil(t, err)
+
+		token, err := authenticator.GetToken()
+		assert.Nil(t, err)
+		assert.Equal(t, iamAuthTestAccessToken1, token)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -0,0 +1,190 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TokenManagementOptions holds the options that control how an authenticator obtains, validates,
+// caches and refreshes its access tokens. It is embedded in each authenticator that obtains access
+// tokens from a token server (the IAM, IAM Assume, IAM mTLS, Container, VPC Instance and
+// Cloud Pak for Data authenticators), and can be set via their builders' SetTokenManagementOptions() method.
+type TokenManagementOptions struct {
+
+	// [Optional] The values that the "iss" and "aud" claims of each access token
+	// obtained from the token server must match. If specified, a token whose claims
+	// do not match is rejected (rather than cached), in order to detect a misconfigured
+	// token server URL (e.g. a staging IAM server) immediately.
+	ExpectedIssuer   string
+	ExpectedAudience string
+
+	// [Optional] Limits the time spent waiting for a new access token when the cached token
+	// could still be used instead.
+	TokenAcquisitionPolicy *TokenAcquisitionPolicy
+
+	// [Optional] The cache in which the IAM access tokens obtained from the token server are
+	// shared with other authenticators (with the same configuration), possibly in other processes.
+	// Not supported by the CloudPakForDataAuthenticator.
+	TokenCache TokenCache
+
+	// [Optional] Validates the signature and expiration of each access token obtained from the
+	// token server (see NewIamTokenValidator()), so that a malformed token is rejected immediately.
+	TokenValidator *TokenValidator
+
+	// [Optional] The maximum time allowed for a refresh of the access token that is started in the
+	// background (when the cached token's refresh time is reached), after which the refresh is abandoned.
+	// Default value: 1 minute (DefaultBackgroundRefreshTimeout)
+	BackgroundRefreshTimeout time.Duration
+}
+
+// validateToken verifies that the claims of a new access token match ExpectedIssuer and
+// ExpectedAudience, and validates it with the TokenValidator (if any). "clockSkew" is the skew
+// between the token server's clock and the local clock.
+func (options *TokenManagementOptions) validateToken(ctx context.Context, accessToken string, clockSkew time.Duration) error {
+	if err := validateTokenClaims(accessToken, options.ExpectedIssuer, options.ExpectedAudience); err != nil {
+		return err
+	}
+	return options.TokenValidator.validate(ctx, accessToken, clockSkew)
+}
+
+// fetchIamToken returns the IAM access token cached under "cacheKey" in the TokenCache (if it can still
+// be used), or else a new access token obtained by "requestToken" and checked by validateToken().
+// Once the authenticator uses the new token, it should invoke "store" to store the token in the
+// TokenCache ("store" does nothing for a token obtained from the TokenCache).
+func (options *TokenManagementOptions) fetchIamToken(ctx context.Context, cacheKey string,
+	requestToken func(context.Context) (*IamTokenServerResponse, error)) (tokenData *iamTokenData, store func(), err error) {
+	// Use the token (if any) obtained by an authenticator with the same configuration.
+	if tokenData := loadCachedIamToken(ctx, options.TokenCache, cacheKey,
+		options.ExpectedIssuer, options.ExpectedAudience); tokenData != nil {
+		return tokenData, func() {}, nil
+	}
+
+	tokenResponse, err := requestToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := options.validateToken(ctx, tokenResponse.AccessToken, tokenResponse.clockSkew); err != nil {
+		return nil, nil, err
+	}
+	if tokenData, err = newIamTokenData(tokenResponse); err != nil {
+		return nil, nil, err
+	}
+	return tokenData, func() { storeCachedIamToken(options.TokenCache, cacheKey, tokenResponse) }, nil
+}
+
+// managedToken is the access token cached by an authenticator (an *iamTokenData or a *cp4dTokenData).
+// Its methods may be invoked on a nil pointer (i.e. when no token is cached).
+type managedToken interface {
+	isTokenValid() bool
+	needsRefresh() bool
+
+	// token returns the access token ("" if none), and its expiration and refresh times
+	// (in seconds since the epoch).
+	token() (accessToken string, expiration int64, refreshTime int64)
+}
+
+// tokenManager implements the token management that is common to the authenticators that embed
+// TokenManagementOptions: obtaining a new access token when the cached token is missing or expired,
+// refreshing it in the background when its refresh time is reached, and reporting each attempt to
+// obtain a new token. The authenticators differ only by how a new token is obtained and cached.
+type tokenManager struct {
+	*TokenManagementOptions
+
+	// The authenticator's type, its coalesced token requests and its OnTokenRefresh() functions.
+	authType string
+	requests *tokenRequestGroup
+	handlers *tokenRefreshHandlers
+
+	// Returns the cached access token.
+	cachedToken func() managedToken
+
+	// Obtains a new access token and caches it.
+	fetchToken func(context.Context) error
+
+	// [optional] Returns false if the cached token can't be refreshed in the background.
+	canRefresh func() bool
+}
+
+// getToken returns the cached access token, first obtaining a new access token if the cached
+// token is missing or expired (see GetTokenWithContext()).
+func (manager *tokenManager) getToken(ctx context.Context) (string, error) {
+	if cached := manager.cachedToken(); !cached.isTokenValid() {
+		GetLogger().Debug("Performing synchronous token fetch...")
+		// synchronously request the token (unless the acquisition policy allows the cached token
+		// to be used after a limited wait)
+		_, expiration, _ := cached.token()
+		err := requestTokenWithinPolicy(ctx, manager.TokenAcquisitionPolicy, expiration,
+			manager.synchronizedRequestToken)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// Authenticate with the cached token (refreshing it in the background, if necessary).
+		manager.handlers.recordCacheHit(manager.authType)
+		if (manager.canRefresh == nil || manager.canRefresh()) && cached.needsRefresh() {
+			GetLogger().Debug("Performing background asynchronous token fetch...")
+			// If refresh needed, kick off a go routine in the background to get a new token
+			go manager.requests.refreshInBackground(manager.authType, manager.BackgroundRefreshTimeout,
+				manager.requestToken)
+		} else {
+			GetLogger().Debug("Using cached access token...")
+		}
+	}
+
+	// return an error if the access token is not valid or was not fetched
+	accessToken, _, _ := manager.cachedToken().token()
+	if accessToken == "" {
+		return "", fmt.Errorf("Error while trying to get access token")
+	}
+	return accessToken, nil
+}
+
+// synchronizedRequestToken obtains a new access token, unless the cached token is valid
+// (e.g. because another goroutine obtained a new token in the meantime).
+func (manager *tokenManager) synchronizedRequestToken(ctx context.Context) error {
+	isValid := func() bool {
+		return manager.cachedToken().isTokenValid()
+	}
+	return synchronizedTokenRequest(ctx, manager.requests, isValid, manager.requestToken)
+}
+
+// ensureFresh makes sure that the cached access token remains valid for at least "minTTL"
+// (see EnsureFreshToken()).
+func (manager *tokenManager) ensureFresh(ctx context.Context, minTTL time.Duration) error {
+	remainingTTL := func() (time.Duration, bool) {
+		accessToken, expiration, _ := manager.cachedToken().token()
+		if accessToken == "" {
+			return 0, false
+		}
+		return remainingTokenTTL(expiration), true
+	}
+	return ensureFreshToken(ctx, minTTL, remainingTTL, manager.requests, manager.requestToken)
+}
+
+// requestToken obtains a new access token and caches it, and reports the outcome (and duration)
+// to the functions registered via OnTokenRefresh() and the recorder set via SetTokenMetricsRecorder().
+func (manager *tokenManager) requestToken(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() {
+		accessToken, expiration, refreshTime := manager.cachedToken().token()
+		info := newTokenInfo(manager.authType, accessToken, expiration, refreshTime, err)
+		manager.handlers.notify(info, time.Since(start))
+	}()
+
+	return manager.fetchToken(ctx)
+}
@@ -0,0 +1,70 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"time"
+)
+
+// TokenMetricsRecorder records the metrics of the access tokens obtained and used by an authenticator
+// (e.g. to alert when an authenticator starts failing to refresh its access token).
+// The github.com/IBM/go-sdk-core/v5/coreprometheus package provides a Prometheus implementation.
+// The methods are invoked concurrently by the authenticator's goroutines, so they must not block.
+type TokenMetricsRecorder interface {
+	// RecordTokenRefresh records an attempt (whether synchronous or in the background) to obtain
+	// a new access token, which took "duration" and failed with "err" (or succeeded, if nil).
+	RecordTokenRefresh(authType string, duration time.Duration, err error)
+
+	// RecordTokenCacheHit records that the cached access token was used to authenticate a request.
+	RecordTokenCacheHit(authType string)
+}
+
+// TokenMetricsObserver is implemented by authenticators that cache an access token
+// (the IAM, IAM Assume, Container, VPC Instance and Cloud Pak for Data authenticators).
+type TokenMetricsObserver interface {
+	// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics
+	// (nil to stop recording them).
+	SetTokenMetricsRecorder(recorder TokenMetricsRecorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *IamAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *IamAssumeAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *ContainerAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *VpcInstanceAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *IamMtlsAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
+
+// SetTokenMetricsRecorder sets the recorder of the authenticator's token metrics.
+func (authenticator *CloudPakForDataAuthenticator) SetTokenMetricsRecorder(recorder TokenMetricsRecorder) {
+	authenticator.tokenRefreshHandlers.setRecorder(recorder)
+}
@@ -0,0 +1,174 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The authenticators that record token metrics.
+var (
+	_ TokenMetricsObserver = &IamAuthenticator{}
+	_ TokenMetricsObserver = &IamAssumeAuthenticator{}
+	_ TokenMetricsObserver = &ContainerAuthenticator{}
+	_ TokenMetricsObserver = &VpcInstanceAuthenticator{}
+	_ TokenMetricsObserver = &CloudPakForDataAuthenticator{}
+)
+
+// testTokenMetricsRecorder records the token metrics in memory.
+type testTokenMetricsRecorder struct {
+	mutex     sync.Mutex
+	refreshes []error
+	durations []time.Duration
+	cacheHits int
+	authTypes map[string]bool
+}
+
+func (recorder *testTokenMetricsRecorder) RecordTokenRefresh(authType string, duration time.Duration, err error) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.refreshes = append(recorder.refreshes, err)
+	recorder.durations = append(recorder.durations, duration)
+	recorder.authTypes[authType] = true
+}
+
+func (recorder *testTokenMetricsRecorder) RecordTokenCacheHit(authType string) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.cacheHits++
+	recorder.authTypes[authType] = true
+}
+
+func (recorder *testTokenMetricsRecorder) counts() (refreshes int, failures int, cacheHits int) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for _, err := range recorder.refreshes {
+		if err != nil {
+			failures++
+		}
+	}
+	return len(recorder.refreshes), failures, recorder.cacheHits
+}
+
+func TestIamTokenMetricsRecorder(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `Sorry you are not authorized!`)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	recorder := &testTokenMetricsRecorder{authTypes: make(map[string]bool)}
+	authenticator.SetTokenMetricsRecorder(recorder)
+
+	// The first request obtains a token, and the following requests use the cached token.
+	for i := 0; i < 3; i++ {
+		_, err = authenticator.GetToken()
+		assert.Nil(t, err)
+	}
+	refreshes, failures, cacheHits := recorder.counts()
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 0, failures)
+	assert.Equal(t, 2, cacheHits)
+	assert.True(t, recorder.durations[0] >= 10*time.Millisecond)
+	assert.Equal(t, map[string]bool{AUTHTYPE_IAM: true}, recorder.authTypes)
+
+	// A background refresh is recorded, as is a failed refresh.
+	authenticator.getTokenData().RefreshTime = GetCurrentTime() - 720
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		refreshes, _, _ := recorder.counts()
+		return refreshes == 2
+	}, time.Second, 10*time.Millisecond)
+
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	refreshes, failures, cacheHits = recorder.counts()
+	assert.Equal(t, 3, refreshes)
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, 3, cacheHits)
+
+	// Once the recorder is removed, nothing is recorded.
+	authenticator.SetTokenMetricsRecorder(nil)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	refreshes, _, _ = recorder.counts()
+	assert.Equal(t, 3, refreshes)
+}
+
+// panickingTokenMetricsRecorder panics when it records a metric.
+type panickingTokenMetricsRecorder struct{}
+
+func (panickingTokenMetricsRecorder) RecordTokenRefresh(string, time.Duration, error) {
+	panic(errors.New("refresh"))
+}
+
+func (panickingTokenMetricsRecorder) RecordTokenCacheHit(string) {
+	panic(errors.New("cache hit"))
+}
+
+func TestTokenMetricsRecorderPanic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+	authenticator.SetTokenMetricsRecorder(panickingTokenMetricsRecorder{})
+
+	// A panic in the recorder doesn't affect the authenticator.
+	for i := 0; i < 2; i++ {
+		token, err := authenticator.GetToken()
+		assert.Nil(t, err)
+		assert.Equal(t, iamAuthTestAccessToken1, token)
+	}
+}
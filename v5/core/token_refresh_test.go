@@ -0,0 +1,132 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The authenticators that report token refreshes.
+var (
+	_ TokenRefreshObserver = &IamAuthenticator{}
+	_ TokenRefreshObserver = &ContainerAuthenticator{}
+	_ TokenRefreshObserver = &VpcInstanceAuthenticator{}
+	_ TokenRefreshObserver = &CloudPakForDataAuthenticator{}
+)
+
+func TestIamOnTokenRefresh(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+				iamAuthTestAccessToken1, GetCurrentTime()+3600)
+		case 2:
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+				iamAuthTestAccessToken2, GetCurrentTime()+3600)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `Sorry you are not authorized!`)
+		}
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	refreshes := make(chan TokenInfo, 10)
+	authenticator.OnTokenRefresh(func(info TokenInfo) {
+		refreshes <- info
+	})
+	authenticator.OnTokenRefresh(nil)
+
+	// A synchronous refresh is reported.
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	info := <-refreshes
+	assert.Equal(t, AUTHTYPE_IAM, info.AuthType)
+	assert.Equal(t, iamAuthTestAccessToken1, info.AccessToken)
+	assert.Equal(t, authenticator.getTokenData().Expiration, info.Expiration.Unix())
+	assert.Equal(t, authenticator.getTokenData().RefreshTime, info.RefreshTime.Unix())
+	assert.Nil(t, info.Err)
+
+	// A background refresh is reported.
+	authenticator.getTokenData().RefreshTime = GetCurrentTime() - 720
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, iamAuthTestAccessToken1, token)
+	select {
+	case info = <-refreshes:
+		assert.Equal(t, iamAuthTestAccessToken2, info.AccessToken)
+		assert.Nil(t, info.Err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "The background refresh was not reported")
+	}
+
+	// A failed refresh is reported.
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	info = <-refreshes
+	assert.Equal(t, AUTHTYPE_IAM, info.AuthType)
+	assert.Empty(t, info.AccessToken)
+	assert.True(t, info.Expiration.IsZero())
+	assert.NotNil(t, info.Err)
+	assert.Len(t, refreshes, 0)
+}
+
+func TestCp4dOnTokenRefresh(t *testing.T) {
+	GetLogger().SetLogLevel(cp4dAuthTestLogLevel)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{ "_messageCode_":"200", "message":"success", "token":"%s"}`, cp4dUsernamePwd1)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewCloudPakForDataAuthenticator(server.URL, "mookie", "betts", false, nil)
+	assert.Nil(t, err)
+
+	var refreshes []TokenInfo
+	authenticator.OnTokenRefresh(func(info TokenInfo) {
+		refreshes = append(refreshes, info)
+	})
+
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Len(t, refreshes, 1)
+	assert.Equal(t, AUTHTYPE_CP4D, refreshes[0].AuthType)
+	assert.Equal(t, cp4dUsernamePwd1, refreshes[0].AccessToken)
+	assert.Equal(t, authenticator.getTokenData().Expiration, refreshes[0].Expiration.Unix())
+	assert.Nil(t, refreshes[0].Err)
+}
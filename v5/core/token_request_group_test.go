@@ -0,0 +1,171 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIamSingleFlightTokenRequest(t *testing.T) {
+	GetLogger().SetLogLevel(iamAuthTestLogLevel)
+
+	var requests int32
+	var fail int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		if atomic.LoadInt32(&fail) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `Sorry you are not authorized!`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "%s", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			iamAuthTestAccessToken1, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey(iamAuthMockApiKey).
+		SetURL(server.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// getTokens invokes GetToken() concurrently from many goroutines, and returns the errors.
+	getTokens := func() []error {
+		var wg sync.WaitGroup
+		errs := make([]error, 50)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = authenticator.GetToken()
+			}(i)
+		}
+		wg.Wait()
+		return errs
+	}
+
+	// A single token request is made on behalf of all of the goroutines.
+	for _, err := range getTokens() {
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The failure of the token request is shared by all of the goroutines.
+	atomic.StoreInt32(&fail, 1)
+	authenticator.InvalidateToken()
+	for _, err := range getTokens() {
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestCp4dSingleFlightTokenRequest(t *testing.T) {
+	GetLogger().SetLogLevel(cp4dAuthTestLogLevel)
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{ "_messageCode_":"200", "message":"success", "token":"%s"}`, cp4dUsernamePwd1)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewCloudPakForDataAuthenticator(server.URL, "mookie", "betts", false, nil)
+	assert.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := authenticator.GetToken()
+			assert.Nil(t, err)
+			assert.Equal(t, cp4dUsernamePwd1, token)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestTokenRequestGroupAbandon(t *testing.T) {
+	group := &tokenRequestGroup{}
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	requestToken := func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}
+
+	// The request isn't abandoned while another goroutine is waiting for it.
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	results := make(chan error, 2)
+	go func() {
+		shared, err := group.do(ctx1, requestToken)
+		assert.False(t, shared)
+		results <- err
+	}()
+	<-started
+	go func() {
+		shared, err := group.do(ctx2, func(context.Context) error {
+			assert.Fail(t, "A second token request was made")
+			return nil
+		})
+		assert.True(t, shared)
+		results <- err
+	}()
+	assert.Eventually(t, func() bool {
+		group.mutex.Lock()
+		defer group.mutex.Unlock()
+		return group.flight != nil && group.flight.waiters == 2
+	}, time.Second, time.Millisecond)
+
+	cancel1()
+	assert.Equal(t, context.Canceled, <-results)
+	select {
+	case <-canceled:
+		assert.Fail(t, "The token request was abandoned while a goroutine was waiting for it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once the last goroutine stops waiting, the request is abandoned.
+	cancel2()
+	assert.Equal(t, context.Canceled, <-results)
+	<-canceled
+
+	// The next goroutine starts a new request.
+	shared, err := group.do(context.Background(), func(context.Context) error {
+		return nil
+	})
+	assert.False(t, shared)
+	assert.Nil(t, err)
+}
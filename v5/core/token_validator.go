@@ -0,0 +1,261 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The path of the IAM token server's JSON Web Key Set (the public keys with which access tokens are signed).
+	iamAuthOperationPathGetKeys = "/identity/keys"
+
+	// The default time for which the keys obtained from the JWKS endpoint are used.
+	defaultJWKSCacheTTL = time.Hour
+
+	// The minimum time between two fetches of the keys, when a token is signed with an unknown key.
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// The hash functions of the supported signing algorithms.
+var jwtSigningHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// TokenValidator validates the signature and expiration of the access tokens obtained by an
+// authenticator, using the public keys published by the token server's JSON Web Key Set (JWKS)
+// endpoint. When configured in an authenticator (e.g. the TokenValidator field of IamAuthenticator),
+// a malformed, truncated, tampered or expired token (e.g. one mangled by a proxy) is rejected with
+// a descriptive error when it is obtained, rather than failing later with a 401 response from the service.
+type TokenValidator struct {
+	// [Required] The URL of the JWKS endpoint (e.g. "https://iam.cloud.ibm.com/identity/keys").
+	JWKSURL string
+
+	// [Optional] The time for which the keys obtained from the JWKS endpoint are used.
+	// The default is one hour. The keys are fetched again sooner if a token is signed with an unknown key.
+	CacheTTL time.Duration
+
+	// [Optional] The http.Client object used to fetch the keys.
+	// If not specified by the user, a suitable default Client will be constructed.
+	Client *http.Client
+
+	// The cached keys (by key id), and the time at which they were fetched.
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+
+	// Mutex to make the cached keys thread safe, and to ensure that only one goroutine
+	// at a time fetches the keys.
+	keysMutex sync.Mutex
+}
+
+// NewIamTokenValidator returns a TokenValidator that validates access tokens using the keys of the
+// IAM token server with URL "iamURL" (the default IAM token server, if "").
+func NewIamTokenValidator(iamURL string) *TokenValidator {
+	if iamURL == "" {
+		iamURL = defaultIamTokenServerEndpoint
+	}
+	return &TokenValidator{
+		JWKSURL: strings.TrimSuffix(iamURL, "/") + iamAuthOperationPathGetKeys,
+	}
+}
+
+// Validate returns an error if "accessToken" is not a well-formed JWT that was signed with one
+// of the keys of the JWKS endpoint, or if it has expired.
+func (validator *TokenValidator) Validate(accessToken string) error {
+	return validator.validate(context.Background(), accessToken, 0)
+}
+
+// jwtHeader is the part of a JWT's "header" segment that we're interested in.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// validate is like Validate(), but fetches the keys (if necessary) within "ctx", and checks the
+// token's expiration time against the clock of a token server that differs from the local clock
+// by "clockSkew". A nil validator accepts every token.
+func (validator *TokenValidator) validate(ctx context.Context, accessToken string, clockSkew time.Duration) error {
+	if validator == nil {
+		return nil
+	}
+
+	segments := strings.Split(accessToken, ".")
+	if len(segments) != 3 {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID,
+			fmt.Sprintf("the token contains %d segments rather than 3 (it may have been truncated)", len(segments)))
+	}
+
+	header := &jwtHeader{}
+	headerBytes, err := decodeSegment(segments[0])
+	if err == nil {
+		err = json.Unmarshal(headerBytes, header)
+	}
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, "error decoding header segment: "+err.Error())
+	}
+	hash, ok := jwtSigningHashes[header.Algorithm]
+	if !ok {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, fmt.Sprintf("unsupported signing algorithm '%s'", header.Algorithm))
+	}
+
+	claims, err := parseJWT(accessToken)
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, err.Error())
+	}
+	if claims.ExpiresAt == 0 {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, "the token has no expiration time")
+	}
+	if toLocalTime(claims.ExpiresAt, clockSkew) <= GetCurrentTime() {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID,
+			"the token expired at "+time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+
+	signature, err := decodeSegment(segments[2])
+	if err != nil {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, "error decoding signature segment: "+err.Error())
+	}
+
+	key, err := validator.getKey(ctx, header.KeyID)
+	if err != nil {
+		return err
+	}
+
+	hasher := hash.New()
+	_, _ = hasher.Write([]byte(segments[0] + "." + segments[1]))
+	if err = rsa.VerifyPKCS1v15(key, hash, hasher.Sum(nil), signature); err != nil {
+		return fmt.Errorf(ERRORMSG_TOKEN_INVALID, "the signature does not match the token (it may have been altered)")
+	}
+	return nil
+}
+
+// getKey returns the key with id "keyID", fetching the keys first if they weren't fetched yet,
+// if they are stale, or if "keyID" is unknown (and the keys weren't fetched very recently).
+func (validator *TokenValidator) getKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	validator.keysMutex.Lock()
+	defer validator.keysMutex.Unlock()
+
+	cacheTTL := validator.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultJWKSCacheTTL
+	}
+	age := GetClock().Now().Sub(validator.fetchedAt)
+	key, found := validator.keys[keyID]
+
+	if validator.keys == nil || age >= cacheTTL || (!found && age >= jwksMinRefreshInterval) {
+		keys, err := validator.fetchKeys(ctx)
+		if err != nil {
+			// Continue to use the cached keys (if any) while the JWKS endpoint can't be reached.
+			if !found {
+				return nil, err
+			}
+			GetLogger().Warn("Using the cached token signing keys: %s", err.Error())
+		} else {
+			validator.keys = keys
+			validator.fetchedAt = GetClock().Now()
+			key, found = keys[keyID]
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf(ERRORMSG_TOKEN_INVALID, fmt.Sprintf("the token was signed with an unknown key '%s'", keyID))
+	}
+	return key, nil
+}
+
+// jsonWebKeySet is the response of a JWKS endpoint.
+type jsonWebKeySet struct {
+	Keys []struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+	} `json:"keys"`
+}
+
+// fetchKeys obtains the RSA keys (by key id) from the JWKS endpoint. Keys of other types are ignored.
+func (validator *TokenValidator) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	if validator.JWKSURL == "" {
+		return nil, fmt.Errorf(ERRORMSG_PROP_MISSING, "JWKSURL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, validator.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, err.Error())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(Accept, APPLICATION_JSON)
+
+	client := validator.Client
+	if client == nil {
+		client = DefaultHTTPClient()
+	}
+
+	GetLogger().Debug("Fetching the token signing keys from %s", validator.JWKSURL)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, err.Error())
+	}
+	defer resp.Body.Close() // #nosec G307
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, err.Error())
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL,
+			fmt.Sprintf(ERRORMSG_UNEXPECTED_STATUS_CODE, resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+
+	keySet := &jsonWebKeySet{}
+	if err = json.Unmarshal(body, keySet); err != nil {
+		return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, err.Error())
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.KeyType != "RSA" {
+			continue
+		}
+		n, err := decodeSegment(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, "invalid modulus of key '"+jwk.KeyID+"'")
+		}
+		e, err := decodeSegment(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf(ERRORMSG_JWKS_ERROR, validator.JWKSURL, "invalid exponent of key '"+jwk.KeyID+"'")
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		keys[jwk.KeyID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: exponent,
+		}
+	}
+	return keys, nil
+}
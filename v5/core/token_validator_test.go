@@ -0,0 +1,194 @@
+// +build all fast auth
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jwksTestServer serves the public keys of "keys" (by key id) as a JSON Web Key Set.
+type jwksTestServer struct {
+	*httptest.Server
+	keys    map[string]*rsa.PrivateKey
+	fetches int32
+}
+
+func newJWKSTestServer(t *testing.T, keyIDs ...string) *jwksTestServer {
+	server := &jwksTestServer{keys: make(map[string]*rsa.PrivateKey)}
+	for _, keyID := range keyIDs {
+		server.addKey(t, keyID)
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&server.fetches, 1)
+		assert.Equal(t, iamAuthOperationPathGetKeys, r.URL.Path)
+		jwks := make([]string, 0, len(server.keys))
+		for keyID, key := range server.keys {
+			jwks = append(jwks, fmt.Sprintf(`{"kty":"RSA","kid":"%s","alg":"RS256","n":"%s","e":"%s"}`, keyID,
+				base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())))
+		}
+		w.Header().Set("Content-Type", APPLICATION_JSON)
+		fmt.Fprintf(w, `{"keys":[%s,{"kty":"EC","kid":"ignored"}]}`, strings.Join(jwks, ","))
+	}))
+	return server
+}
+
+func (server *jwksTestServer) addKey(t *testing.T, keyID string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	server.keys[keyID] = key
+}
+
+// sign returns a JWT with "claims" signed with the key with id "keyID".
+func (server *jwksTestServer) sign(t *testing.T, keyID string, claims string) string {
+	header := fmt.Sprintf(`{"alg":"RS256","typ":"JWT","kid":"%s"}`, keyID)
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+	hasher := crypto.SHA256.New()
+	_, _ = hasher.Write([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, server.keys[keyID], crypto.SHA256, hasher.Sum(nil))
+	assert.Nil(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validTestClaims() string {
+	return fmt.Sprintf(`{"iss":"https://iam.cloud.ibm.com/identity","iat":%d,"exp":%d}`,
+		GetCurrentTime(), GetCurrentTime()+3600)
+}
+
+func TestTokenValidator(t *testing.T) {
+	server := newJWKSTestServer(t, "key-1")
+	defer server.Close()
+
+	validator := NewIamTokenValidator(server.URL)
+	assert.Equal(t, server.URL+iamAuthOperationPathGetKeys, validator.JWKSURL)
+	assert.Equal(t, "https://iam.cloud.ibm.com/identity/keys", NewIamTokenValidator("").JWKSURL)
+
+	token := server.sign(t, "key-1", validTestClaims())
+	assert.Nil(t, validator.Validate(token))
+	assert.Nil(t, validator.Validate(token))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+
+	// Truncated token.
+	err := validator.Validate(token[:strings.LastIndex(token, ".")])
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_INVALID,
+		"the token contains 2 segments rather than 3 (it may have been truncated)"), err.Error())
+
+	// Altered claims.
+	segments := strings.Split(token, ".")
+	segments[1] = base64.RawURLEncoding.EncodeToString([]byte(validTestClaims()[1:]))
+	err = validator.Validate(strings.Join(segments, "."))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "error unmarshalling token")
+	segments[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(validTestClaims(), "iam", "evil", 1)))
+	err = validator.Validate(strings.Join(segments, "."))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the signature does not match the token")
+
+	// Expired token.
+	err = validator.Validate(server.sign(t, "key-1", fmt.Sprintf(`{"exp":%d}`, GetCurrentTime()-60)))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the token expired at")
+	err = validator.Validate(server.sign(t, "key-1", `{"iss":"nobody"}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "the token has no expiration time")
+
+	// Unsigned token.
+	err = validator.Validate(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + segments[1] + ".")
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_INVALID, "unsupported signing algorithm 'none'"), err.Error())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+
+	// A nil validator accepts every token.
+	var nilValidator *TokenValidator
+	assert.Nil(t, nilValidator.validate(context.Background(), "not a token", 0))
+}
+
+func TestTokenValidatorKeyRotation(t *testing.T) {
+	server := newJWKSTestServer(t, "key-1")
+	defer server.Close()
+
+	validator := NewIamTokenValidator(server.URL)
+	assert.Nil(t, validator.Validate(server.sign(t, "key-1", validTestClaims())))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+
+	// A token signed with a new key causes the keys to be fetched again, but not more
+	// often than the minimum refresh interval.
+	server.addKey(t, "key-2")
+	token := server.sign(t, "key-2", validTestClaims())
+	err := validator.Validate(token)
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_INVALID, "the token was signed with an unknown key 'key-2'"), err.Error())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.fetches))
+
+	validator.fetchedAt = validator.fetchedAt.Add(-jwksMinRefreshInterval)
+	assert.Nil(t, validator.Validate(token))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.fetches))
+
+	// The cached keys are used (when the endpoint can't be reached) after they become stale.
+	validator.fetchedAt = validator.fetchedAt.Add(-defaultJWKSCacheTTL)
+	server.Close()
+	assert.Nil(t, validator.Validate(token))
+	err = NewIamTokenValidator(server.URL).Validate(token)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Unable to obtain the token signing keys from")
+}
+
+func TestIamAuthenticatorTokenValidator(t *testing.T) {
+	jwksServer := newJWKSTestServer(t, "key-1")
+	defer jwksServer.Close()
+
+	accessToken := jwksServer.sign(t, "key-1", validTestClaims())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token":"%s","refresh_token":"jy4gl91BQ","token_type":"Bearer","expires_in":3600,"expiration":%d}`,
+			accessToken, GetCurrentTime()+3600)
+	}))
+	defer server.Close()
+
+	authenticator, err := NewIamAuthenticatorBuilder().
+		SetApiKey("bogus-apikey").
+		SetURL(server.URL).
+		SetTokenManagementOptions(TokenManagementOptions{TokenValidator: NewIamTokenValidator(jwksServer.URL)}).
+		Build()
+	assert.Nil(t, err)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, accessToken, token)
+
+	// A token mangled (e.g. truncated by a proxy) is rejected rather than cached.
+	accessToken = accessToken[:len(accessToken)-10]
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	assert.Equal(t, fmt.Sprintf(ERRORMSG_TOKEN_INVALID, "the signature does not match the token (it may have been altered)"), err.Error())
+	assert.Nil(t, authenticator.getTokenData())
+}
@@ -0,0 +1,161 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+)
+
+// TransportErrorClass identifies the kind of failure that occurred while communicating
+// with a server (as opposed to a failure reported by the server via a status code).
+type TransportErrorClass string
+
+const (
+	// The request was canceled, or its context's deadline was exceeded. Not retryable.
+	TransportErrorCanceled TransportErrorClass = "canceled"
+
+	// The maximum number of redirects was exceeded. Not retryable.
+	TransportErrorTooManyRedirects TransportErrorClass = "too_many_redirects"
+
+	// The request URL has an unsupported protocol scheme. Not retryable.
+	TransportErrorUnsupportedScheme TransportErrorClass = "unsupported_scheme"
+
+	// The server's certificate could not be verified. Not retryable.
+	TransportErrorCertificate TransportErrorClass = "certificate"
+
+	// The server's host name does not exist. Not retryable.
+	TransportErrorDNSNotFound TransportErrorClass = "dns_not_found"
+
+	// The server's host name could not be resolved due to a temporary failure
+	// (e.g. the DNS server timed out). Retryable.
+	TransportErrorDNSTemporary TransportErrorClass = "dns_temporary"
+
+	// The connection was refused by the server. Retryable.
+	TransportErrorConnectionRefused TransportErrorClass = "connection_refused"
+
+	// The connection was reset or aborted (e.g. the server closed an idle connection). Retryable.
+	TransportErrorConnectionReset TransportErrorClass = "connection_reset"
+
+	// The connection was closed before the response was received. Retryable.
+	TransportErrorEOF TransportErrorClass = "eof"
+
+	// The TLS handshake did not complete in time. Retryable.
+	TransportErrorTLSHandshakeTimeout TransportErrorClass = "tls_handshake_timeout"
+
+	// Some other operation (e.g. connecting to the server or awaiting the response headers)
+	// did not complete in time (e.g. the http.Client's Timeout was exceeded). Retryable.
+	TransportErrorTimeout TransportErrorClass = "timeout"
+
+	// Any other failure. Retryable.
+	TransportErrorOther TransportErrorClass = "other"
+)
+
+var (
+	// A regular expression to match the error returned by net/http when the TLS handshake
+	// times out. This error isn't exported so we resort to matching on the error string.
+	tlsHandshakeTimeoutErrorRe = regexp.MustCompile(`TLS handshake timeout`)
+
+	// A regular expression to match the error returned by net/http when the http.Client's
+	// Timeout is exceeded, which (unlike the expiration of the request context's deadline)
+	// shouldn't prevent the request from being retried.
+	clientTimeoutErrorRe = regexp.MustCompile(`Client\.Timeout exceeded`)
+
+	// A regular expression to match connection reset errors that aren't reported
+	// as a syscall.Errno (e.g. on Windows).
+	connectionResetErrorRe = regexp.MustCompile(`connection reset by peer|forcibly closed by the remote host`)
+)
+
+// IsRetryable returns true iff a request that failed with an error of this class is likely
+// to succeed if retried.
+func (class TransportErrorClass) IsRetryable() bool {
+	switch class {
+	case "", TransportErrorCanceled, TransportErrorTooManyRedirects, TransportErrorUnsupportedScheme,
+		TransportErrorCertificate, TransportErrorDNSNotFound:
+		return false
+	default:
+		return true
+	}
+}
+
+// ClassifyTransportError returns the class of "err", an error returned by an http.Client
+// (or a RoundTripper) while invoking a request, or "" if "err" is nil.
+// The SDK uses this classification to decide whether to retry a request (see IBMCloudSDKRetryPolicy),
+// so applications that implement their own retry loops can use it to make the same decisions.
+func ClassifyTransportError(err error) TransportErrorClass {
+	if err == nil {
+		return ""
+	}
+	message := err.Error()
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && clientTimeoutErrorRe.MatchString(message):
+		return TransportErrorTimeout
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return TransportErrorCanceled
+	case redirectsErrorRe.MatchString(message):
+		return TransportErrorTooManyRedirects
+	case schemeErrorRe.MatchString(message):
+		return TransportErrorUnsupportedScheme
+	case isCertificateError(err):
+		return TransportErrorCertificate
+	case tlsHandshakeTimeoutErrorRe.MatchString(message):
+		return TransportErrorTLSHandshakeTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound && !dnsErr.IsTemporary && !dnsErr.IsTimeout {
+			return TransportErrorDNSNotFound
+		}
+		return TransportErrorDNSTemporary
+	}
+
+	if class := classifyErrno(err); class != "" {
+		return class
+	}
+
+	switch {
+	case connectionResetErrorRe.MatchString(message):
+		return TransportErrorConnectionReset
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return TransportErrorEOF
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TransportErrorTimeout
+	}
+
+	return TransportErrorOther
+}
+
+// IsRetryableTransportError returns true iff "err" (an error returned by an http.Client
+// while invoking a request) is likely recoverable by retrying the request.
+func IsRetryableTransportError(err error) bool {
+	return ClassifyTransportError(err).IsRetryable()
+}
+
+// isCertificateError returns true iff "err" was caused by a failure to verify the server's certificate.
+func isCertificateError(err error) bool {
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
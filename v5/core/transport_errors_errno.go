@@ -0,0 +1,34 @@
+// +build !plan9
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"syscall"
+)
+
+// classifyErrno returns the class of a transport error caused by one of the system's
+// connection-related error numbers, or "" if "err" wasn't caused by one of them.
+func classifyErrno(err error) TransportErrorClass {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return TransportErrorConnectionRefused
+	case errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE):
+		return TransportErrorConnectionReset
+	}
+	return ""
+}
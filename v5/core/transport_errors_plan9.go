@@ -0,0 +1,23 @@
+// +build plan9
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// classifyErrno returns "" because Plan 9 reports errors as strings rather than error numbers,
+// so transport errors are classified by their messages instead.
+func classifyErrno(err error) TransportErrorClass {
+	return ""
+}
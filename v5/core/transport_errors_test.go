@@ -0,0 +1,220 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTransportError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://localhost", Err: err}
+}
+
+func TestClassifyTransportError(t *testing.T) {
+	testCases := []struct {
+		err       error
+		class     TransportErrorClass
+		retryable bool
+	}{
+		{nil, "", false},
+		{newTransportError(context.Canceled), TransportErrorCanceled, false},
+		{newTransportError(context.DeadlineExceeded), TransportErrorCanceled, false},
+		{newTransportError(fmt.Errorf("%w (Client.Timeout exceeded while awaiting headers)", context.DeadlineExceeded)), TransportErrorTimeout, true},
+		{newTransportError(fmt.Errorf("stopped after 10 redirects")), TransportErrorTooManyRedirects, false},
+		{newTransportError(fmt.Errorf("unsupported protocol scheme \"badscheme\"")), TransportErrorUnsupportedScheme, false},
+		{newTransportError(x509.UnknownAuthorityError{}), TransportErrorCertificate, false},
+		{newTransportError(x509.HostnameError{Certificate: &x509.Certificate{}, Host: "localhost"}), TransportErrorCertificate, false},
+		{newTransportError(x509.CertificateInvalidError{Reason: x509.Expired}), TransportErrorCertificate, false},
+		{newTransportError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "x", IsNotFound: true}}), TransportErrorDNSNotFound, false},
+		{newTransportError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "server misbehaving", Name: "x", IsTemporary: true}}), TransportErrorDNSTemporary, true},
+		{newTransportError(&net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", Name: "x", IsTimeout: true}}), TransportErrorDNSTemporary, true},
+		{newTransportError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), TransportErrorConnectionRefused, true},
+		{newTransportError(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), TransportErrorConnectionReset, true},
+		{newTransportError(&net.OpError{Op: "write", Err: os.NewSyscallError("write", syscall.EPIPE)}), TransportErrorConnectionReset, true},
+		{newTransportError(fmt.Errorf("wsarecv: An existing connection was forcibly closed by the remote host.")), TransportErrorConnectionReset, true},
+		{newTransportError(io.EOF), TransportErrorEOF, true},
+		{newTransportError(io.ErrUnexpectedEOF), TransportErrorEOF, true},
+		{newTransportError(fmt.Errorf("net/http: TLS handshake timeout")), TransportErrorTLSHandshakeTimeout, true},
+		{newTransportError(&net.OpError{Op: "dial", Err: timeoutError{}}), TransportErrorTimeout, true},
+		{newTransportError(fmt.Errorf("something went wrong")), TransportErrorOther, true},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.class, ClassifyTransportError(tc.err), "%v", tc.err)
+		assert.Equal(t, tc.retryable, IsRetryableTransportError(tc.err), "%v", tc.err)
+		assert.Equal(t, tc.retryable, IsRetryable(tc.err), "%v", tc.err)
+
+		// The SDK's retry policy agrees with the classification.
+		if tc.err != nil {
+			retry, _ := IBMCloudSDKRetryPolicy(context.Background(), nil, tc.err)
+			assert.Equal(t, tc.retryable, retry, "%v", tc.err)
+		}
+	}
+
+	// Errors that weren't returned by an http.Client are retryable only if they're recognized.
+	assert.True(t, IsRetryable(io.EOF))
+	assert.False(t, IsRetryable(fmt.Errorf("something went wrong")))
+}
+
+// timeoutError is a net.Error that reports a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// getTransportError returns the error returned by an http.Client for a request sent to "url".
+func getTransportError(t *testing.T, client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	assert.NotNil(t, err)
+	return err
+}
+
+func TestClassifyTransportErrorEOF(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		assert.Nil(t, err)
+		conn.Close()
+	}))
+	defer server.Close()
+
+	err := getTransportError(t, &http.Client{}, server.URL)
+	assert.Equal(t, TransportErrorEOF, ClassifyTransportError(err))
+}
+
+func TestClassifyTransportErrorConnectionReset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		assert.Nil(t, err)
+		// Closing the connection with a zero linger time resets it.
+		assert.Nil(t, conn.(*net.TCPConn).SetLinger(0))
+		conn.Close()
+	}))
+	defer server.Close()
+
+	err := getTransportError(t, &http.Client{}, server.URL)
+	class := ClassifyTransportError(err)
+	// Depending on timing, the client observes either the reset or the closed connection.
+	assert.Contains(t, []TransportErrorClass{TransportErrorConnectionReset, TransportErrorEOF}, class, "%v", err)
+	assert.True(t, class.IsRetryable())
+}
+
+func TestClassifyTransportErrorConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	err = getTransportError(t, &http.Client{}, "http://"+address)
+	assert.Equal(t, TransportErrorConnectionRefused, ClassifyTransportError(err))
+}
+
+func TestClassifyTransportErrorTLSHandshakeTimeout(t *testing.T) {
+	// A server that accepts connections but never completes a TLS handshake.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	client := &http.Client{Transport: &http.Transport{TLSHandshakeTimeout: 50 * time.Millisecond}}
+	err = getTransportError(t, client, "https://"+listener.Addr().String())
+	assert.Equal(t, TransportErrorTLSHandshakeTimeout, ClassifyTransportError(err))
+}
+
+func TestClassifyTransportErrorClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	err := getTransportError(t, &http.Client{Timeout: 50 * time.Millisecond}, server.URL)
+	assert.Equal(t, TransportErrorTimeout, ClassifyTransportError(err))
+	assert.True(t, IsRetryable(err))
+
+	// The expiration of the request context's deadline isn't retryable.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.Nil(t, err)
+	_, err = http.DefaultClient.Do(req)
+	assert.Equal(t, TransportErrorCanceled, ClassifyTransportError(err))
+	assert.False(t, IsRetryable(err))
+}
+
+func TestRetryTransportErrorEOF(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Close the connection in response to the first request.
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			assert.Nil(t, err)
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: &NoAuthAuthenticator{},
+	})
+	assert.Nil(t, err)
+	service.EnableRetries(2, 10*time.Millisecond)
+
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "", nil)
+	assert.Nil(t, err)
+	req, _ := builder.Build()
+
+	resp, err := service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
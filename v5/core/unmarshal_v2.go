@@ -63,6 +63,10 @@ const (
 // Where <primitive-type> could be any of the following:
 //   - string, bool, []byte, int64, float32, float64, strfmt.Date, strfmt.DateTime,
 //     strfmt.UUID, interface{} (any), or map[string]interface{} (any object).
+//   - Duration or Interval (an ISO 8601 duration or time interval string).
+//
+// In addition, 'result' may be a *time.Duration or **time.Duration, in which case the property
+// may contain either an ISO 8601 duration string (e.g. "PT1H30M") or a number of nanoseconds.
 //
 // Example:
 // type MyStruct struct {
@@ -83,7 +87,11 @@ func UnmarshalPrimitive(rawInput map[string]json.RawMessage, propertyName string
 
 	rawMsg, foundIt := rawInput[propertyName]
 	if foundIt && rawMsg != nil {
-		err = json.Unmarshal(rawMsg, result)
+		var handled bool
+		handled, err = unmarshalTimeDuration(rawMsg, result)
+		if !handled {
+			err = json.Unmarshal(rawMsg, result)
+		}
 		if err != nil {
 			err = fmt.Errorf(errorUnmarshalPrimitive, propertyName, err.Error())
 		}
@@ -167,6 +175,8 @@ type ModelUnmarshaller func(rawInput map[string]json.RawMessage, result interfac
 //                    |                          | contains an instance of map[string][]Foo
 // -------------------+--------------------------+------------------------------------------------------------------
 func UnmarshalModel(rawInput interface{}, propertyName string, result interface{}, unmarshaller ModelUnmarshaller) (err error) {
+	// A malformed response (or a bug in the generated unmarshaller) shouldn't crash the caller.
+	defer recoverPanic(PanicSourceModelUnmarshaller, &err)
 
 	// Make sure some input is provided. Otherwise return an error.
 	if IsNil(rawInput) {
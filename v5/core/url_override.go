@@ -0,0 +1,81 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// serviceURLKey is the context key used to associate a service URL override with a request.
+type serviceURLKey struct{}
+
+// parseServiceURLOverride parses a service URL override, which must be an absolute
+// http or https URL without a path, query or fragment (e.g. "https://node-3.example.com:8443").
+func parseServiceURLOverride(serviceURL string) (*url.URL, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return nil, fmt.Errorf(ERRORMSG_URL_OVERRIDE_INVALID, serviceURL, err.Error())
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(ERRORMSG_URL_OVERRIDE_INVALID, serviceURL, "an absolute http or https URL is required")
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return nil, fmt.Errorf(ERRORMSG_URL_OVERRIDE_INVALID, serviceURL, "only a scheme, host and port may be specified")
+	}
+	return u, nil
+}
+
+// applyServiceURLOverride substitutes the scheme and host of "req" with those of the
+// service URL override associated with "req" (if any), after verifying that the
+// override's host is permitted by "allowedHosts".
+func applyServiceURLOverride(req *http.Request, allowedHosts []string) error {
+	override, _ := req.Context().Value(serviceURLKey{}).(*url.URL)
+	if override == nil {
+		return nil
+	}
+
+	if !isHostAllowed(override.Hostname(), allowedHosts) {
+		return fmt.Errorf(ERRORMSG_URL_OVERRIDE_NOT_ALLOWED, override.Hostname())
+	}
+
+	// Preserve an explicitly-specified Host (e.g. via the "Host" header).
+	if req.Host == "" || req.Host == req.URL.Host {
+		req.Host = override.Host
+	}
+	req.URL.Scheme = override.Scheme
+	req.URL.Host = override.Host
+	return nil
+}
+
+// isHostAllowed returns true iff "host" matches an entry within "allowedHosts".
+// An entry is either a hostname (e.g. "node-1.example.com") or a wildcard that
+// matches any subdomain (e.g. "*.example.com"). Hostnames are compared without regard to case.
+func isHostAllowed(host string, allowedHosts []string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) && len(host) > len(allowed)-1 {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceURLOverride(t *testing.T) {
+	var received *http.Request
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           "https://api.example.com/v1",
+		Authenticator: &BearerTokenAuthenticator{BearerToken: "token"},
+	})
+	assert.Nil(t, err)
+	service.SetHTTPClient(&http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			received = req
+			return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+		}),
+	})
+
+	newRequest := func(serviceURL string) *http.Request {
+		builder := NewRequestBuilder(GET).WithServiceURL(serviceURL)
+		_, err := builder.ResolveRequestURL(service.GetServiceURL(), "/resources/{id}", map[string]string{"id": "r1"})
+		assert.Nil(t, err)
+		builder.AddQuery("limit", "10")
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// By default, no hosts are allowed.
+	_, err = service.Request(newRequest("https://node-3.example.com:8443"), nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "node-3.example.com")
+	assert.Nil(t, received)
+
+	// The scheme and host are replaced, while the path, query and authentication are retained.
+	service.SetAllowedHosts("*.Example.com")
+	assert.Equal(t, []string{"*.Example.com"}, service.GetAllowedHosts())
+	_, err = service.Request(newRequest("http://node-3.example.com:8443/"), nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, received)
+	assert.Equal(t, "http://node-3.example.com:8443/v1/resources/r1?limit=10", received.URL.String())
+	assert.Equal(t, "node-3.example.com:8443", received.Host)
+	assert.Equal(t, "Bearer token", received.Header.Get("Authorization"))
+
+	// Hosts not matching the allowlist are rejected.
+	received = nil
+	_, err = service.Request(newRequest("https://example.com.evil.com"), nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, received)
+
+	// The allowed hosts are retained by a clone.
+	assert.Equal(t, service.GetAllowedHosts(), service.Clone().GetAllowedHosts())
+}
+
+func TestServiceURLOverrideInvalid(t *testing.T) {
+	for _, serviceURL := range []string{"node-3.example.com", "ftp://node-3.example.com", "https://node-3.example.com/v2", "https://node-3.example.com?x=1", ":bad"} {
+		builder := NewRequestBuilder(GET).WithServiceURL(serviceURL)
+		_, err := builder.ResolveRequestURL("https://api.example.com", "/resources", nil)
+		assert.Nil(t, err)
+		_, err = builder.Build()
+		assert.NotNil(t, err, serviceURL)
+	}
+}
+
+func TestIsHostAllowed(t *testing.T) {
+	allowed := []string{"node-1.example.com", "*.nodes.example.com"}
+	assert.True(t, isHostAllowed("node-1.example.com", allowed))
+	assert.True(t, isHostAllowed("NODE-1.example.com", allowed))
+	assert.True(t, isHostAllowed("a.nodes.example.com", allowed))
+	assert.True(t, isHostAllowed("a.b.nodes.example.com", allowed))
+	assert.False(t, isHostAllowed("nodes.example.com", allowed))
+	assert.False(t, isHostAllowed("node-2.example.com", allowed))
+	assert.False(t, isHostAllowed("evilnodes.example.com", allowed))
+	assert.False(t, isHostAllowed("node-1.example.com", nil))
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"reflect"
@@ -25,7 +26,6 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/go-openapi/strfmt"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -183,9 +183,9 @@ func PrettyPrint(result interface{}, resultName string) {
 	}
 }
 
-// GetCurrentTime returns the current Unix time.
+// GetCurrentTime returns the current Unix time, as reported by the current Clock (see SetClock()).
 func GetCurrentTime() int64 {
-	return time.Now().Unix()
+	return GetClock().Now().Unix()
 }
 
 // Pre-compiled regular expression used to remove the surrounding
@@ -266,6 +266,21 @@ func SliceContains(slice []string, contains string) bool {
 	return false
 }
 
+// getHeaderValue returns the first value of header "name", which must already be in
+// canonical form. Unlike http.Header.Get(), it doesn't canonicalize "name" on each call.
+func getHeaderValue(header http.Header, name string) string {
+	if values := header[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// setHeaderValue sets header "name", which must already be in canonical form, to "value".
+// Unlike http.Header.Set(), it doesn't canonicalize "name" on each call.
+func setHeaderValue(header http.Header, name string, value string) {
+	header[name] = []string{value}
+}
+
 // GetQueryParam() returns a pointer to the value of query parameter `param` from urlStr,
 // or nil if not found.
 func GetQueryParam(urlStr *string, param string) (*string, error) {
@@ -293,7 +308,7 @@ func GetQueryParam(urlStr *string, param string) (*string, error) {
 // Pre-compiled regular expressions used by RedactSecrets().
 var reAuthHeader = regexp.MustCompile(`(?m)^(Authorization|X-Auth\S*): .*`)
 var rePassword1 = regexp.MustCompile(`(?i)(password|token|apikey|api_key|passcode)=[^&]*(&|$)`)
-var rePassword2 = regexp.MustCompile(`(?i)"([^"]*(password|token|apikey|api_key)[^"_]*)":\s*"[^\,]*"`)
+var rePassword2 = regexp.MustCompile(`(?i)"([^"]*(password|token|apikey|api_key|passcode)[^"_]*)":\s*"[^\,]*"`)
 
 // RedactSecrets() returns the input string with secrets redacted.
 func RedactSecrets(input string) string {
@@ -16,6 +16,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -59,11 +60,21 @@ type VpcInstanceAuthenticator struct {
 	Client     *http.Client
 	clientInit sync.Once
 
+	// [optional] The options that control how access tokens are obtained, validated, cached and
+	// refreshed (see TokenManagementOptions).
+	TokenManagementOptions
+
 	// The cached IAM access token and its expiration time.
 	tokenData *iamTokenData
 
 	// Mutex to synchronize access to the tokenData field.
 	tokenDataMutex sync.Mutex
+
+	// The functions registered via OnTokenRefresh().
+	tokenRefreshHandlers tokenRefreshHandlers
+
+	// Coalesces the concurrent requests for a new access token.
+	tokenRequests tokenRequestGroup
 }
 
 const (
@@ -111,6 +122,12 @@ func (builder *VpcInstanceAuthenticatorBuilder) SetClient(client *http.Client) *
 	return builder
 }
 
+// SetTokenManagementOptions sets the TokenManagementOptions field in the builder.
+func (builder *VpcInstanceAuthenticatorBuilder) SetTokenManagementOptions(options TokenManagementOptions) *VpcInstanceAuthenticatorBuilder {
+	builder.VpcInstanceAuthenticator.TokenManagementOptions = options
+	return builder
+}
+
 // Build() returns a validated instance of the VpcInstanceAuthenticator with the config that was set in the builder.
 func (builder *VpcInstanceAuthenticatorBuilder) Build() (*VpcInstanceAuthenticator, error) {
 
@@ -173,12 +190,12 @@ func (*VpcInstanceAuthenticator) AuthenticationType() string {
 // 		Authorization: Bearer <access-token>
 //
 func (authenticator *VpcInstanceAuthenticator) Authenticate(request *http.Request) error {
-	token, err := authenticator.GetToken()
+	token, err := authenticator.GetTokenWithContext(request.Context())
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("Authorization", "Bearer "+token)
+	setHeaderValue(request.Header, headerNameAuthorization, "Bearer "+token)
 	return nil
 }
 
@@ -198,6 +215,20 @@ func (authenticator *VpcInstanceAuthenticator) setTokenData(tokenData *iamTokenD
 	authenticator.tokenData = tokenData
 }
 
+// InvalidateToken discards the cached access token (if any), so that a new
+// access token is fetched the next time that the authenticator is used.
+func (authenticator *VpcInstanceAuthenticator) InvalidateToken() {
+	authenticator.setTokenData(nil)
+	deleteCachedIamToken(authenticator.TokenCache, authenticator.tokenCacheKey())
+}
+
+// OnTokenRefresh registers a function that is invoked with the outcome of each attempt to obtain
+// a new access token, whether synchronously or in the background. The function is invoked by the
+// goroutine that obtained the token, so it should return promptly.
+func (authenticator *VpcInstanceAuthenticator) OnTokenRefresh(handler func(TokenInfo)) {
+	authenticator.tokenRefreshHandlers.add(handler)
+}
+
 // Validate the authenticator's configuration.
 //
 // Ensures that one of IAMProfileName or IAMProfileID are specified, and the ClientId and ClientSecret pair are
@@ -216,69 +247,69 @@ func (authenticator *VpcInstanceAuthenticator) Validate() error {
 // Whenever a new IAM access token is needed (when a token doesn't yet exist or the existing token has expired),
 // a new IAM access token is fetched from the token server.
 func (authenticator *VpcInstanceAuthenticator) GetToken() (string, error) {
-	if authenticator.getTokenData() == nil || !authenticator.getTokenData().isTokenValid() {
-		GetLogger().Debug("Performing synchronous token fetch...")
-		// synchronously request the token
-		err := authenticator.synchronizedRequestToken()
-		if err != nil {
-			return "", err
-		}
-	} else if authenticator.getTokenData().needsRefresh() {
-		GetLogger().Debug("Performing background asynchronous token fetch...")
-		// If refresh needed, kick off a go routine in the background to get a new token
-		//nolint: errcheck
-		go authenticator.invokeRequestTokenData()
-	} else {
-		GetLogger().Debug("Using cached access token...")
-	}
-
-	// return an error if the access token is not valid or was not fetched
-	if authenticator.getTokenData() == nil || authenticator.getTokenData().AccessToken == "" {
-		return "", fmt.Errorf("Error while trying to get access token")
-	}
+	return authenticator.GetTokenWithContext(context.Background())
+}
 
-	return authenticator.getTokenData().AccessToken, nil
+// GetTokenWithContext is like GetToken(), but if "ctx" is done before a new access token is
+// obtained from the token server, then the token request is abandoned and ctx.Err() is returned.
+func (authenticator *VpcInstanceAuthenticator) GetTokenWithContext(ctx context.Context) (string, error) {
+	return authenticator.tokenManager().getToken(ctx)
 }
 
-// vpcRequestTokenMutex is used to synchronize access to requesting a new IAM access token.
-var vpcRequestTokenMutex sync.Mutex
-
-// synchronizedRequestToken will check if the authenticator currently has
-// a valid cached access token.
-// If yes, then nothing else needs to be done.
-// If no, then a blocking request is made to obtain a new IAM access token.
-func (authenticator *VpcInstanceAuthenticator) synchronizedRequestToken() error {
-	vpcRequestTokenMutex.Lock()
-	defer vpcRequestTokenMutex.Unlock()
-	// if cached token is still valid, then just continue to use it
-	if authenticator.getTokenData() != nil && authenticator.getTokenData().isTokenValid() {
-		return nil
-	}
+// EnsureFreshToken makes sure that the cached access token remains valid for at least "minTTL",
+// fetching a new access token if necessary. This can be used before a burst of work to
+// avoid refreshing the access token in the middle of the burst.
+// If "ctx" is done before the new token is obtained, then ctx.Err() is returned.
+func (authenticator *VpcInstanceAuthenticator) EnsureFreshToken(ctx context.Context, minTTL time.Duration) error {
+	return authenticator.tokenManager().ensureFresh(ctx, minTTL)
+}
 
-	return authenticator.invokeRequestTokenData()
+// invokeRequestTokenData obtains a new access token and caches it, reporting the outcome
+// to the functions registered via OnTokenRefresh().
+func (authenticator *VpcInstanceAuthenticator) invokeRequestTokenData(ctx context.Context) error {
+	return authenticator.tokenManager().requestToken(ctx)
 }
 
-// invokeRequestTokenData will invoke RequestToken() to obtain a new IAM access token,
-// then caches the resulting "tokenData" on the authenticator.
-// Returns nil if successful, or non-nil if an error occurred.
-func (authenticator *VpcInstanceAuthenticator) invokeRequestTokenData() error {
-	tokenResponse, err := authenticator.RequestToken()
-	if err != nil {
-		return err
+// tokenManager returns the tokenManager that obtains and refreshes the authenticator's access tokens.
+func (authenticator *VpcInstanceAuthenticator) tokenManager() *tokenManager {
+	return &tokenManager{
+		TokenManagementOptions: &authenticator.TokenManagementOptions,
+		authType:               AUTHTYPE_VPC,
+		requests:               &authenticator.tokenRequests,
+		handlers:               &authenticator.tokenRefreshHandlers,
+		cachedToken:            func() managedToken { return authenticator.getTokenData() },
+		fetchToken:             authenticator.fetchTokenData,
 	}
+}
 
-	if tokenData, err := newIamTokenData(tokenResponse); err != nil {
+// fetchTokenData requests a new token from the IAM token server (unless the TokenCache holds
+// a token that can still be used) and stores it in the authenticator's 'tokenData' field (cache).
+func (authenticator *VpcInstanceAuthenticator) fetchTokenData(ctx context.Context) error {
+	tokenData, store, err := authenticator.fetchIamToken(ctx, authenticator.tokenCacheKey(), authenticator.requestToken)
+	if err != nil {
 		return err
-	} else {
-		authenticator.setTokenData(tokenData)
 	}
 
+	authenticator.setTokenData(tokenData)
+	store()
 	return nil
 }
 
+// tokenCacheKey returns the key under which the authenticator's tokens are cached, or ""
+// if there is no TokenCache. The key is derived from the metadata service URL and the trusted profile.
+func (authenticator *VpcInstanceAuthenticator) tokenCacheKey() string {
+	return newTokenCacheKey(authenticator.TokenCache, AUTHTYPE_VPC, authenticator.url(),
+		authenticator.IAMProfileCRN, authenticator.IAMProfileID)
+}
+
 // RequestToken will use the VPC Instance Metadata Service to (1) retrieve a fresh instance identity token
 // and then (2) exchange that for an IAM access token.
 func (authenticator *VpcInstanceAuthenticator) RequestToken() (iamTokenResponse *IamTokenServerResponse, err error) {
+	return authenticator.requestToken(context.Background())
+}
+
+// requestToken is like RequestToken(), but the token request is abandoned if "ctx" is done.
+func (authenticator *VpcInstanceAuthenticator) requestToken(ctx context.Context) (iamTokenResponse *IamTokenServerResponse, err error) {
 
 	// Use the default VPC base endpoint if user didn't specifiy the URL property.
 	if authenticator.URL == "" {
@@ -286,13 +317,13 @@ func (authenticator *VpcInstanceAuthenticator) RequestToken() (iamTokenResponse
 	}
 
 	// Retrieve the instance identity token from the VPC Instance Metadata Service.
-	instanceIdentityToken, err := authenticator.retrieveInstanceIdentityToken()
+	instanceIdentityToken, err := authenticator.retrieveInstanceIdentityToken(ctx)
 	if err != nil {
 		return
 	}
 
 	// Next, exchange the instance identity token for an IAM access token.
-	iamTokenResponse, err = authenticator.retrieveIamAccessToken(instanceIdentityToken)
+	iamTokenResponse, err = authenticator.retrieveIamAccessToken(ctx, instanceIdentityToken)
 	if err != nil {
 		return
 	}
@@ -320,11 +351,11 @@ type vpcTokenResponse struct {
 // retrieveIamAccessToken will use the VPC "create_iam_token" operation to exchange the
 // compute resource's instance identity token for an IAM access token that can be used
 // to authenticate outbound REST requests targeting IAM-secured services.
-func (authenticator *VpcInstanceAuthenticator) retrieveIamAccessToken(
+func (authenticator *VpcInstanceAuthenticator) retrieveIamAccessToken(ctx context.Context,
 	instanceIdentityToken string) (iamTokenResponse *IamTokenServerResponse, err error) {
 
 	// Set up the request for the VPC "create_iam_token" operation.
-	builder := NewRequestBuilder(POST)
+	builder := NewRequestBuilder(POST).WithContext(ctx)
 	_, err = builder.ResolveRequestURL(authenticator.url(), vpcauthOperationPathCreateIamToken, nil)
 	if err != nil {
 		err = NewAuthenticationError(&DetailedResponse{}, err)
@@ -373,6 +404,7 @@ func (authenticator *VpcInstanceAuthenticator) retrieveIamAccessToken(
 	if err != nil {
 		return nil, NewAuthenticationError(&DetailedResponse{}, err)
 	}
+
 	GetLogger().Debug("Returned from VPC 'create_iam_token' operation, received status code %d", resp.StatusCode)
 
 	// If debug is enabled, then dump the response.
@@ -417,6 +449,7 @@ func (authenticator *VpcInstanceAuthenticator) retrieveIamAccessToken(
 		AccessToken: *tokenResponse.AccessToken,
 		ExpiresIn:   *tokenResponse.ExpiresIn,
 		Expiration:  time.Time(*tokenResponse.ExpiresAt).Unix(),
+		clockSkew:   measureClockSkew(resp.Header),
 	}
 
 	return
@@ -424,10 +457,10 @@ func (authenticator *VpcInstanceAuthenticator) retrieveIamAccessToken(
 
 // retrieveInstanceIdentityToken retrieves the local compute resource's instance identity token using
 // the "create_access_token" operation of the local VPC Instance Metadata Service API.
-func (authenticator *VpcInstanceAuthenticator) retrieveInstanceIdentityToken() (instanceIdentityToken string, err error) {
+func (authenticator *VpcInstanceAuthenticator) retrieveInstanceIdentityToken(ctx context.Context) (instanceIdentityToken string, err error) {
 
 	// Set up the request to invoke the "create_access_token" operation.
-	builder := NewRequestBuilder(PUT)
+	builder := NewRequestBuilder(PUT).WithContext(ctx)
 	_, err = builder.ResolveRequestURL(authenticator.url(), vpcauthOperationPathCreateAccessToken, nil)
 	if err != nil {
 		err = NewAuthenticationError(&DetailedResponse{}, err)
@@ -467,6 +500,7 @@ func (authenticator *VpcInstanceAuthenticator) retrieveInstanceIdentityToken() (
 		err = NewAuthenticationError(&DetailedResponse{}, err)
 		return
 	}
+
 	GetLogger().Debug("Returned from VPC 'create_access_token' operation, received status code %d", resp.StatusCode)
 
 	// If debug is enabled, then dump the response.
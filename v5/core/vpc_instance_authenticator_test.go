@@ -17,6 +17,7 @@ package core
 // limitations under the License.
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -405,7 +406,7 @@ func TestVpcAuthRetrieveVpcTokenSuccess(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	vpcToken, err := auth.retrieveInstanceIdentityToken()
+	vpcToken, err := auth.retrieveInstanceIdentityToken(context.Background())
 	assert.Nil(t, err)
 	assert.Equal(t, vpcauthTestInstanceIdentityToken, vpcToken)
 }
@@ -430,7 +431,7 @@ func TestVpcAuthRetrieveVpcTokenFail(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	vpcToken, err := auth.retrieveInstanceIdentityToken()
+	vpcToken, err := auth.retrieveInstanceIdentityToken(context.Background())
 	assert.Empty(t, vpcToken)
 	assert.NotNil(t, err)
 	t.Logf("Expected error: %s\n", err.Error())
@@ -453,7 +454,7 @@ func TestVpcAuthRetrieveVpcTokenTimeout(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, auth)
 
-	vpcToken, err := auth.retrieveInstanceIdentityToken()
+	vpcToken, err := auth.retrieveInstanceIdentityToken(context.Background())
 	assert.Empty(t, vpcToken)
 	assert.NotNil(t, err)
 	t.Logf("Expected error: %s\n", err.Error())
@@ -476,7 +477,7 @@ func TestVpcAuthRetrieveIamTokenSuccessProfileNone(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	iamTokenServerResponse, err := auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err := auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, err)
 	assert.NotNil(t, iamTokenServerResponse)
 	assert.Equal(t, vpcauthTestAccessToken1, iamTokenServerResponse.AccessToken)
@@ -495,7 +496,7 @@ func TestVpcAuthRetrieveIamTokenSuccessProfileCRN(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	iamTokenServerResponse, err := auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err := auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, err)
 	assert.NotNil(t, iamTokenServerResponse)
 	assert.Equal(t, vpcauthTestAccessToken1, iamTokenServerResponse.AccessToken)
@@ -514,12 +515,12 @@ func TestVpcAuthRetrieveIamTokenSuccessProfileID(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	iamTokenServerResponse, err := auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err := auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, err)
 	assert.NotNil(t, iamTokenServerResponse)
 	assert.Equal(t, vpcauthTestAccessToken1, iamTokenServerResponse.AccessToken)
 
-	iamTokenServerResponse, err = auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err = auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, err)
 	assert.NotNil(t, iamTokenServerResponse)
 	assert.Equal(t, vpcauthTestAccessToken2, iamTokenServerResponse.AccessToken)
@@ -537,7 +538,7 @@ func TestVpcAuthRetrieveIamTokenFail(t *testing.T) {
 	err := auth.Validate()
 	assert.Nil(t, err)
 
-	iamTokenServerResponse, err := auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err := auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, iamTokenServerResponse)
 	assert.NotNil(t, err)
 	t.Logf("Expected error: %s\n", err.Error())
@@ -561,7 +562,7 @@ func TestVpcAuthRetrieveIamTokenTimeout(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, auth)
 
-	iamTokenServerResponse, err := auth.retrieveIamAccessToken(vpcauthTestInstanceIdentityToken)
+	iamTokenServerResponse, err := auth.retrieveIamAccessToken(context.Background(), vpcauthTestInstanceIdentityToken)
 	assert.Nil(t, iamTokenServerResponse)
 	assert.NotNil(t, err)
 	t.Logf("Expected error: %s\n", err.Error())
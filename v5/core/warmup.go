@@ -0,0 +1,107 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// WarmUp prepares the service for its first requests, so that they don't incur the latency
+// of DNS resolution, TLS handshakes and obtaining an access token (e.g. in a serverless
+// function that was just started). It performs the following steps:
+//
+// 1. The service's authenticator is invoked, so that a token-based authenticator
+// obtains (and caches) an access token.
+//
+// 2. "n" (at least 1) HEAD requests are sent concurrently to the service URL, so that "n"
+// connections to the service endpoint are established and retained in the HTTP client's
+// pool of idle connections. The requests are not authenticated or retried, and the status
+// codes of their responses are ignored. Note that the number of connections retained is
+// limited by the HTTP client's transport (e.g. its MaxIdleConnsPerHost setting).
+//
+// An error is returned if the authenticator fails or a connection could not be established.
+func (service *BaseService) WarmUp(ctx context.Context, n int) error {
+	service.mutex.RLock()
+	serviceURL := service.Options.URL
+	authenticator := service.Options.Authenticator
+	client := service.Client
+	service.mutex.RUnlock()
+
+	if serviceURL == "" {
+		return fmt.Errorf(ERRORMSG_PROP_MISSING, "URL")
+	}
+	if IsNil(authenticator) {
+		return fmt.Errorf(ERRORMSG_NO_AUTHENTICATOR)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	// Obtain an access token by authenticating a request that is never sent.
+	authReq, err := http.NewRequestWithContext(ctx, http.MethodHead, serviceURL, nil)
+	if err != nil {
+		return err
+	}
+	if err = authenticator.Authenticate(authReq); err != nil {
+		return err
+	}
+
+	// Use the client's underlying (non-retryable) client, so that a failure isn't retried.
+	if retryableClient := getRetryableHTTPClient(client); retryableClient != nil {
+		client = retryableClient.HTTPClient
+	}
+
+	GetLogger().Debug("Warming up %d connection(s) to %s", n, serviceURL)
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = warmUpConnection(ctx, client, serviceURL)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmUpConnection sends a HEAD request to "url" and then drains and closes the response body,
+// so that the connection is returned to the client's pool of idle connections.
+func warmUpConnection(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return resp.Body.Close()
+}
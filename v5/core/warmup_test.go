@@ -0,0 +1,129 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// warmUpAuthenticator is an Authenticator that counts its invocations.
+type warmUpAuthenticator struct {
+	calls int32
+	err   error
+}
+
+func (a *warmUpAuthenticator) AuthenticationType() string { return "warmup" }
+func (a *warmUpAuthenticator) Validate() error            { return nil }
+func (a *warmUpAuthenticator) Authenticate(req *http.Request) error {
+	atomic.AddInt32(&a.calls, 1)
+	return a.err
+}
+
+func TestWarmUp(t *testing.T) {
+	const n = 2
+
+	// Each HEAD request is held until all of them have arrived, so that each one
+	// is sent on a separate connection.
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	var heads, gets int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			if atomic.AddInt32(&heads, 1) <= n {
+				arrived.Done()
+				arrived.Wait()
+			}
+			assert.Empty(t, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	var conns int32
+	server.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	authenticator := &warmUpAuthenticator{}
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           server.URL,
+		Authenticator: authenticator,
+	})
+	assert.Nil(t, err)
+	service.SetHTTPClient(server.Client())
+	service.EnableRetries(3, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	assert.Nil(t, service.WarmUp(ctx, n))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&authenticator.calls))
+	assert.Equal(t, int32(n), atomic.LoadInt32(&heads))
+	assert.Equal(t, int32(n), atomic.LoadInt32(&conns))
+
+	// Subsequent requests use the connections that were established by WarmUp().
+	builder := NewRequestBuilder(GET)
+	_, err = builder.ResolveRequestURL(server.URL, "/", nil)
+	assert.Nil(t, err)
+	req, err := builder.Build()
+	assert.Nil(t, err)
+	_, err = service.Request(req, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets))
+	assert.Equal(t, int32(n), atomic.LoadInt32(&conns))
+}
+
+func TestWarmUpErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serverURL := server.URL
+	server.Close()
+
+	// An authentication failure is returned.
+	authenticator := &warmUpAuthenticator{err: errors.New("no token for you")}
+	service, err := NewBaseService(&ServiceOptions{
+		URL:           serverURL,
+		Authenticator: authenticator,
+	})
+	assert.Nil(t, err)
+	err = service.WarmUp(context.Background(), 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, "no token for you", err.Error())
+
+	// A connection failure is returned.
+	authenticator.err = nil
+	assert.NotNil(t, service.WarmUp(context.Background(), 0))
+
+	// A service URL is required.
+	service.Options.URL = ""
+	err = service.WarmUp(context.Background(), 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "URL")
+}
@@ -0,0 +1,207 @@
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WarningKind identifies the condition reported by a Warning.
+type WarningKind string
+
+// The kinds of warnings reported by a service.
+const (
+	// An operation response indicated that the operation is deprecated (or will be sunset).
+	WarningDeprecatedOperation WarningKind = "deprecated_operation"
+
+	// A request was sent by a client that doesn't verify the server's SSL certificate.
+	WarningTLSVerificationDisabled WarningKind = "tls_verification_disabled"
+
+	// The retry budget of the service is nearly exhausted.
+	WarningRetryBudgetLow WarningKind = "retry_budget_low"
+
+	// The local clock differs significantly from the clock of a server.
+	WarningClockSkew WarningKind = "clock_skew"
+
+	// The IAM token server and the service are in different IAM environments (see ValidateIamEndpoint()).
+	WarningIamEndpointMismatch WarningKind = "iam_endpoint_mismatch"
+)
+
+// Warning describes a non-fatal condition detected by a service.
+type Warning struct {
+	Kind    WarningKind
+	Message string
+
+	// The time at which the condition was detected.
+	Time time.Time
+
+	// The request during which the condition was detected, if any.
+	Request *http.Request
+}
+
+// String returns a description of the warning.
+func (warning Warning) String() string {
+	return fmt.Sprintf("%s: %s", warning.Kind, warning.Message)
+}
+
+// WarningHandler is a function that is invoked (synchronously) for each warning.
+type WarningHandler func(warning Warning)
+
+// warningNotifier delivers warnings to a handler and to subscribed channels.
+// A nil warningNotifier discards warnings.
+type warningNotifier struct {
+	mutex       sync.Mutex
+	handler     WarningHandler
+	subscribers map[chan Warning]bool
+
+	// The last client checked by checkClient().
+	checkedClient *http.Client
+
+	// The clock skew last reported by checkClock() for each host.
+	clockSkews map[string]time.Duration
+}
+
+// SetWarningHandler sets the function that is invoked for each warning reported by the service
+// (e.g. the use of a deprecated operation, or a request sent without TLS verification),
+// which otherwise are logged only at debug level. A nil value removes any previously-set handler.
+// The handler is shared by the service's clones.
+func (service *BaseService) SetWarningHandler(handler WarningHandler) {
+	notifier := service.getWarningNotifier()
+	notifier.mutex.Lock()
+	notifier.handler = handler
+	notifier.mutex.Unlock()
+
+	// Report the conditions detected when the service was configured to the new handler.
+	if handler != nil {
+		service.checkIamEndpoint()
+	}
+}
+
+// Warnings subscribes to the warnings reported by the service (and its clones).
+// It returns a channel with capacity "buffer" on which the warnings are delivered,
+// and a function that cancels the subscription and closes the channel.
+// Warnings are never allowed to block a request, so a warning is dropped (for this
+// subscriber) if the channel is full.
+func (service *BaseService) Warnings(buffer int) (<-chan Warning, func()) {
+	notifier := service.getWarningNotifier()
+	notifier.mutex.Lock()
+	ch := make(chan Warning, buffer)
+	if notifier.subscribers == nil {
+		notifier.subscribers = make(map[chan Warning]bool)
+	}
+	notifier.subscribers[ch] = true
+	notifier.mutex.Unlock()
+
+	// Report the conditions detected when the service was configured to the new subscriber.
+	service.checkIamEndpoint()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			notifier.mutex.Lock()
+			defer notifier.mutex.Unlock()
+
+			delete(notifier.subscribers, ch)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// getWarningNotifier returns the service's warningNotifier, creating it if necessary.
+func (service *BaseService) getWarningNotifier() *warningNotifier {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if service.warnings == nil {
+		service.warnings = &warningNotifier{}
+	}
+	return service.warnings
+}
+
+// emit reports a warning of the specified kind.
+func (notifier *warningNotifier) emit(kind WarningKind, req *http.Request, format string, args ...interface{}) {
+	if notifier == nil {
+		return
+	}
+
+	warning := Warning{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Time:    GetClock().Now(),
+		Request: req,
+	}
+	GetLogger().Debug("Warning: %s", warning.String())
+
+	notifier.mutex.Lock()
+	handler := notifier.handler
+	for ch := range notifier.subscribers {
+		select {
+		case ch <- warning:
+		default:
+		}
+	}
+	notifier.mutex.Unlock()
+
+	if handler != nil {
+		callSafely(PanicSourceWarningHandler, func() { handler(warning) })
+	}
+}
+
+// checkClient reports a warning the first time that a request is sent by "client"
+// if the client doesn't verify the server's SSL certificate.
+func (notifier *warningNotifier) checkClient(req *http.Request, client *http.Client) {
+	if notifier == nil {
+		return
+	}
+
+	notifier.mutex.Lock()
+	checked := notifier.checkedClient == client
+	notifier.checkedClient = client
+	notifier.mutex.Unlock()
+
+	if !checked && isSSLDisabled(client) {
+		notifier.emit(WarningTLSVerificationDisabled, req,
+			"Requests to '%s' are sent without verifying the server's SSL certificate", req.URL.Host)
+	}
+}
+
+// checkClock reports a warning if the "Date" header of "resp" shows that the clock of the server
+// differs from the local clock, unless a similar skew was already reported for the server's host.
+// Responses served from a cache (which have an Age header) are ignored, since their "Date" header
+// is that of the original response. Unlike the skew of a token server's clock, the skew of a
+// service's clock doesn't affect how access tokens are managed.
+func (notifier *warningNotifier) checkClock(req *http.Request, resp *http.Response) {
+	if notifier == nil || resp.Header.Get(headerNameAge) != "" {
+		return
+	}
+	skew := measureClockSkew(resp.Header)
+
+	notifier.mutex.Lock()
+	previous := notifier.clockSkews[req.URL.Host]
+	if notifier.clockSkews == nil {
+		notifier.clockSkews = make(map[string]time.Duration)
+	}
+	notifier.clockSkews[req.URL.Host] = skew
+	notifier.mutex.Unlock()
+
+	threshold := GetClockSkewThreshold()
+	if difference := skew - previous; skew != 0 && (difference >= threshold || difference <= -threshold) {
+		notifier.emit(WarningClockSkew, req, "The clock of '%s' differs from the local clock by %s", req.URL.Host, skew.String())
+	}
+}
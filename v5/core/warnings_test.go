@@ -0,0 +1,102 @@
+// +build all fast basesvc
+
+package core
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarnings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/old" {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Sunset", "Sat, 01 Jul 2023 00:00:00 GMT")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service, err := NewBaseService(&ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}})
+	assert.Nil(t, err)
+	service.SetDeprecationHandler(func(req *http.Request, info *DeprecationInfo) {})
+
+	var handled []WarningKind
+	service.SetWarningHandler(func(warning Warning) {
+		handled = append(handled, warning.Kind)
+	})
+	warnings, cancel := service.Warnings(1)
+
+	newRequest := func(path string) *http.Request {
+		builder := NewRequestBuilder(GET)
+		_, err := builder.ResolveRequestURL(server.URL, path, nil)
+		assert.Nil(t, err)
+		req, err := builder.Build()
+		assert.Nil(t, err)
+		return req
+	}
+
+	// A request sent without TLS verification is reported once per client.
+	service.DisableSSLVerification()
+	_, err = service.Request(newRequest("/v1/new"), nil)
+	assert.Nil(t, err)
+	_, err = service.Request(newRequest("/v1/new"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []WarningKind{WarningTLSVerificationDisabled}, handled)
+	warning := <-warnings
+	assert.Equal(t, WarningTLSVerificationDisabled, warning.Kind)
+	assert.Contains(t, warning.String(), "without verifying")
+	assert.NotNil(t, warning.Request)
+
+	// The use of a deprecated operation is reported by clones too.
+	clone := service.Clone()
+	_, err = clone.Request(newRequest("/v1/old"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []WarningKind{WarningTLSVerificationDisabled, WarningDeprecatedOperation}, handled)
+	warning = <-warnings
+	assert.Equal(t, WarningDeprecatedOperation, warning.Kind)
+	assert.Contains(t, warning.Message, "GET /v1/old")
+
+	// A full channel doesn't block the request, and a cancelled subscription closes the channel.
+	_, err = service.Request(newRequest("/v1/old"), nil)
+	assert.Nil(t, err)
+	_, err = service.Request(newRequest("/v1/old"), nil)
+	assert.Nil(t, err)
+	assert.Len(t, handled, 4)
+	cancel()
+	cancel()
+	warning, ok := <-warnings
+	assert.True(t, ok)
+	assert.Equal(t, WarningDeprecatedOperation, warning.Kind)
+	_, ok = <-warnings
+	assert.False(t, ok)
+
+	// A service that isn't constructed by NewBaseService() reports warnings too.
+	service.SetWarningHandler(nil)
+	literal := &BaseService{Options: &ServiceOptions{URL: server.URL, Authenticator: &NoAuthAuthenticator{}}, Client: service.GetHTTPClient()}
+	handled = nil
+	literal.SetWarningHandler(func(warning Warning) {
+		handled = append(handled, warning.Kind)
+	})
+	_, err = literal.Request(newRequest("/v1/new"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []WarningKind{WarningTLSVerificationDisabled}, handled)
+}
@@ -0,0 +1,52 @@
+// Package coreoauth2 adapts the Go core library's authenticators to golang.org/x/oauth2, so that an
+// authenticator can be used with third-party clients that accept an oauth2.TokenSource (e.g. gRPC
+// per-RPC credentials, or an http.Client returned by oauth2.NewClient()):
+//
+//	httpClient := oauth2.NewClient(ctx, coreoauth2.NewTokenSource(authenticator))
+package coreoauth2
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"github.com/IBM/go-sdk-core/v5/core"
+	"golang.org/x/oauth2"
+)
+
+// NewTokenSource returns an oauth2.TokenSource that supplies the bearer tokens obtained by
+// "authenticator" (see core.GetBearerToken() for the supported authenticators).
+//
+// The authenticator remains responsible for caching and refreshing its access token, so the
+// TokenSource need not be wrapped with oauth2.ReuseTokenSource().
+func NewTokenSource(authenticator core.Authenticator) oauth2.TokenSource {
+	return &authenticatorTokenSource{authenticator: authenticator}
+}
+
+// authenticatorTokenSource is an oauth2.TokenSource that obtains tokens from an authenticator.
+type authenticatorTokenSource struct {
+	authenticator core.Authenticator
+}
+
+// Token returns the authenticator's current access token.
+func (source *authenticatorTokenSource) Token() (*oauth2.Token, error) {
+	bearerToken, err := core.GetBearerToken(source.authenticator)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: bearerToken.AccessToken,
+		TokenType:   "Bearer",
+		Expiry:      bearerToken.Expiry,
+	}, nil
+}
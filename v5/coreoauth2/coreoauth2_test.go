@@ -0,0 +1,79 @@
+// +build all fast auth
+
+package coreoauth2
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestNewTokenSource(t *testing.T) {
+	expiration := core.GetCurrentTime() + 3600
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"access_token": "my-access-token", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			expiration)
+	}))
+	defer tokenServer.Close()
+
+	authenticator, err := core.NewIamAuthenticatorBuilder().
+		SetApiKey("my-apikey").
+		SetURL(tokenServer.URL).
+		Build()
+	assert.Nil(t, err)
+
+	// The token (and its expiration time) are obtained from the authenticator, which caches the token.
+	source := NewTokenSource(authenticator)
+	token, err := source.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "my-access-token", token.AccessToken)
+	assert.Equal(t, "Bearer", token.TokenType)
+	assert.Equal(t, time.Unix(expiration, 0), token.Expiry)
+	assert.True(t, token.Valid())
+	_, err = source.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, tokenRequests)
+
+	// The token source can be used by an oauth2 client.
+	var authHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	resp, err := oauth2.NewClient(context.Background(), source).Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "Bearer my-access-token", authHeader)
+
+	// An authenticator that doesn't use bearer tokens isn't supported.
+	basicAuthenticator, err := core.NewBasicAuthenticator("user", "password")
+	assert.Nil(t, err)
+	token, err = NewTokenSource(basicAuthenticator).Token()
+	assert.Nil(t, token)
+	assert.NotNil(t, err)
+}
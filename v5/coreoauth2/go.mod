@@ -0,0 +1,11 @@
+module github.com/IBM/go-sdk-core/v5/coreoauth2
+
+go 1.14
+
+require (
+	github.com/IBM/go-sdk-core/v5 v5.9.1
+	github.com/stretchr/testify v1.7.0
+	golang.org/x/oauth2 v0.0.0-20210819190943-2bc19b11175f
+)
+
+replace github.com/IBM/go-sdk-core/v5 => ../
@@ -0,0 +1,114 @@
+// Package coreprometheus provides a core.TokenMetricsRecorder that exposes the metrics of the
+// Go core library's authenticators as Prometheus metrics, e.g. to alert when an authenticator
+// starts failing to refresh its IAM access token:
+//
+//	recorder := coreprometheus.NewTokenMetricsRecorder("myapp")
+//	prometheus.MustRegister(recorder)
+//	authenticator.SetTokenMetricsRecorder(recorder)
+//
+// The same recorder can be used by any number of authenticators; each metric is labeled
+// with the type of the authenticator (e.g. "iam").
+package coreprometheus
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"strings"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The label that holds the type of the authenticator (in lower case) within each metric.
+const labelAuthType = "auth_type"
+
+// TokenMetricsRecorder is a core.TokenMetricsRecorder and a prometheus.Collector that exposes
+// the following metrics (prefixed with the recorder's namespace, if any):
+//
+//	token_refreshes_total               the attempts to obtain a new access token
+//	token_refresh_failures_total        the attempts that failed
+//	token_refresh_duration_seconds      a histogram of the duration of the attempts
+//	token_cache_hits_total              the requests authenticated with a cached access token
+type TokenMetricsRecorder struct {
+	refreshes       *prometheus.CounterVec
+	refreshFailures *prometheus.CounterVec
+	refreshDuration *prometheus.HistogramVec
+	cacheHits       *prometheus.CounterVec
+}
+
+// Make sure that the recorder implements the interfaces.
+var _ core.TokenMetricsRecorder = (*TokenMetricsRecorder)(nil)
+var _ prometheus.Collector = (*TokenMetricsRecorder)(nil)
+
+// NewTokenMetricsRecorder returns a recorder whose metrics have the specified namespace (e.g. the
+// name of the application), which may be empty. The recorder must be registered with a
+// prometheus.Registerer for its metrics to be exposed.
+func NewTokenMetricsRecorder(namespace string) *TokenMetricsRecorder {
+	return &TokenMetricsRecorder{
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refreshes_total",
+			Help:      "The number of attempts to obtain a new access token.",
+		}, []string{labelAuthType}),
+		refreshFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refresh_failures_total",
+			Help:      "The number of failed attempts to obtain a new access token.",
+		}, []string{labelAuthType}),
+		refreshDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "token_refresh_duration_seconds",
+			Help:      "The duration of the attempts to obtain a new access token.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{labelAuthType}),
+		cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_cache_hits_total",
+			Help:      "The number of requests authenticated with a cached access token.",
+		}, []string{labelAuthType}),
+	}
+}
+
+// RecordTokenRefresh records an attempt to obtain a new access token.
+func (recorder *TokenMetricsRecorder) RecordTokenRefresh(authType string, duration time.Duration, err error) {
+	authType = strings.ToLower(authType)
+	recorder.refreshes.WithLabelValues(authType).Inc()
+	recorder.refreshDuration.WithLabelValues(authType).Observe(duration.Seconds())
+	if err != nil {
+		recorder.refreshFailures.WithLabelValues(authType).Inc()
+	}
+}
+
+// RecordTokenCacheHit records that a request was authenticated with a cached access token.
+func (recorder *TokenMetricsRecorder) RecordTokenCacheHit(authType string) {
+	recorder.cacheHits.WithLabelValues(strings.ToLower(authType)).Inc()
+}
+
+// Describe sends the descriptors of the recorder's metrics to "ch".
+func (recorder *TokenMetricsRecorder) Describe(ch chan<- *prometheus.Desc) {
+	recorder.refreshes.Describe(ch)
+	recorder.refreshFailures.Describe(ch)
+	recorder.refreshDuration.Describe(ch)
+	recorder.cacheHits.Describe(ch)
+}
+
+// Collect sends the recorder's metrics to "ch".
+func (recorder *TokenMetricsRecorder) Collect(ch chan<- prometheus.Metric) {
+	recorder.refreshes.Collect(ch)
+	recorder.refreshFailures.Collect(ch)
+	recorder.refreshDuration.Collect(ch)
+	recorder.cacheHits.Collect(ch)
+}
@@ -0,0 +1,84 @@
+// +build all fast auth
+
+package coreprometheus
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenMetricsRecorder(t *testing.T) {
+	recorder := NewTokenMetricsRecorder("myapp")
+	registry := prometheus.NewRegistry()
+	assert.Nil(t, registry.Register(recorder))
+
+	recorder.RecordTokenRefresh(core.AUTHTYPE_IAM, 200*time.Millisecond, nil)
+	recorder.RecordTokenRefresh(core.AUTHTYPE_IAM, 2*time.Second, errors.New("token server unavailable"))
+	recorder.RecordTokenRefresh(core.AUTHTYPE_CONTAINER, 100*time.Millisecond, nil)
+	recorder.RecordTokenCacheHit(core.AUTHTYPE_IAM)
+	recorder.RecordTokenCacheHit(core.AUTHTYPE_IAM)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(recorder.refreshes.WithLabelValues("iam")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(recorder.refreshes.WithLabelValues("container")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(recorder.refreshFailures.WithLabelValues("iam")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(recorder.cacheHits.WithLabelValues("iam")))
+
+	expected := `
+# HELP myapp_token_refresh_duration_seconds The duration of the attempts to obtain a new access token.
+# TYPE myapp_token_refresh_duration_seconds histogram
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.005"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.01"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.025"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.05"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.1"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.25"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="0.5"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="1"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="2.5"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="5"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="10"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="container",le="+Inf"} 1
+myapp_token_refresh_duration_seconds_sum{auth_type="container"} 0.1
+myapp_token_refresh_duration_seconds_count{auth_type="container"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.005"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.01"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.025"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.05"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.1"} 0
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.25"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="0.5"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="1"} 1
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="2.5"} 2
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="5"} 2
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="10"} 2
+myapp_token_refresh_duration_seconds_bucket{auth_type="iam",le="+Inf"} 2
+myapp_token_refresh_duration_seconds_sum{auth_type="iam"} 2.2
+myapp_token_refresh_duration_seconds_count{auth_type="iam"} 2
+`
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"myapp_token_refresh_duration_seconds"))
+	count, err := testutil.GatherAndCount(registry)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, count)
+}
@@ -0,0 +1,11 @@
+module github.com/IBM/go-sdk-core/v5/coreprometheus
+
+go 1.14
+
+require (
+	github.com/IBM/go-sdk-core/v5 v5.9.1
+	github.com/prometheus/client_golang v1.11.1
+	github.com/stretchr/testify v1.7.0
+)
+
+replace github.com/IBM/go-sdk-core/v5 => ../
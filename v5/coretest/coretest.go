@@ -0,0 +1,200 @@
+// Package coretest provides helpers for testing code that uses the Go core library,
+// such as simulating the expiry of access tokens, failures to refresh them, and clock skew,
+// without real sleeps or access to the authenticators' internal state.
+//
+// To simulate the expiry of an access token, install a FakeClock with UseFakeClock() and
+// advance it beyond the token's lifetime. To simulate clock skew between the client and the
+// token server, use UseClockSkew(). To simulate failures to obtain or refresh a token,
+// use FailTokenRequests().
+package coretest
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+)
+
+// FakeClock is a core.Clock whose time is controlled by the test.
+type FakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFakeClock returns a FakeClock whose current time is "now".
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock's current time forward by "d".
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Set sets the clock's current time.
+func (c *FakeClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = now
+}
+
+// UseFakeClock installs a FakeClock, initially set to the current time, as the core library's
+// clock. Since servers report the actual time, clock skew detection (see core.SetClockSkewThreshold())
+// is disabled while the FakeClock is in use. The returned function restores the default clock.
+func UseFakeClock() (*FakeClock, func()) {
+	clock := NewFakeClock(time.Now())
+	threshold := core.GetClockSkewThreshold()
+	core.SetClockSkewThreshold(0)
+	core.SetClock(clock)
+	return clock, func() {
+		core.SetClock(nil)
+		core.SetClockSkewThreshold(threshold)
+	}
+}
+
+// skewedClock is a core.Clock that is offset from the system clock.
+type skewedClock struct {
+	skew time.Duration
+}
+
+func (c skewedClock) Now() time.Time {
+	return time.Now().Add(c.skew)
+}
+
+// UseClockSkew installs a clock that runs ahead of (for a positive "skew") or behind (for a
+// negative "skew") the system clock as the core library's clock, simulating a client whose clock
+// differs from the token server's. Unless clock skew detection is disabled (see
+// core.SetClockSkewThreshold()), the skew is detected and compensated for each access token
+// obtained from a token server whose response contains a "Date" header (see core.GetClockSkew()).
+// The returned function restores the default clock.
+func UseClockSkew(skew time.Duration) func() {
+	core.SetClock(skewedClock{skew: skew})
+	return func() { core.SetClock(nil) }
+}
+
+// TokenRequestFailures injects failures into the requests sent by a token-managing authenticator
+// to its token server. It's created by FailTokenRequests().
+type TokenRequestFailures struct {
+	mutex      sync.Mutex
+	remaining  int
+	failed     int
+	statusCode int
+	base       http.RoundTripper
+	client     **http.Client
+	original   *http.Client
+}
+
+// FailTokenRequests causes the next "n" token requests sent by "authenticator" (or all of them,
+// if "n" is negative) to fail with a response containing "statusCode", simulating a token server
+// that is unable to issue or refresh tokens. The authenticator must be an IamAuthenticator,
+// CloudPakForDataAuthenticator, ContainerAuthenticator or VpcInstanceAuthenticator.
+// Call Restore() on the result to restore the authenticator's original http.Client.
+func FailTokenRequests(authenticator core.Authenticator, n int, statusCode int) (*TokenRequestFailures, error) {
+	var client **http.Client
+	switch a := authenticator.(type) {
+	case *core.IamAuthenticator:
+		client = &a.Client
+	case *core.CloudPakForDataAuthenticator:
+		client = &a.Client
+	case *core.ContainerAuthenticator:
+		client = &a.Client
+	case *core.VpcInstanceAuthenticator:
+		client = &a.Client
+	default:
+		return nil, fmt.Errorf("authenticator type %T doesn't request tokens", authenticator)
+	}
+
+	failures := &TokenRequestFailures{
+		remaining:  n,
+		statusCode: statusCode,
+		base:       http.DefaultTransport,
+		client:     client,
+		original:   *client,
+	}
+
+	// Use a copy of the authenticator's client (which may be shared) with a failing transport.
+	injected := &http.Client{Timeout: 30 * time.Second}
+	if *client != nil {
+		*injected = **client
+		if (*client).Transport != nil {
+			failures.base = (*client).Transport
+		}
+	}
+	injected.Transport = failures
+	*client = injected
+	return failures, nil
+}
+
+// RoundTrip fails the request if more failures remain, or else sends it.
+func (f *TokenRequestFailures) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mutex.Lock()
+	fail := f.remaining != 0
+	if fail {
+		f.remaining--
+		f.failed++
+	}
+	f.mutex.Unlock()
+
+	if !fail {
+		return f.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close() // #nosec G104
+	}
+	body := fmt.Sprintf(`{"errorCode": "BXNIM0000E", "errorMessage": "Injected token request failure (%d)"}`, f.statusCode)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.statusCode, http.StatusText(f.statusCode)),
+		StatusCode:    f.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{core.CONTENT_TYPE: {core.APPLICATION_JSON}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Failed returns the number of token requests that were failed.
+func (f *TokenRequestFailures) Failed() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.failed
+}
+
+// Restore restores the authenticator's original http.Client, so that no further requests fail.
+func (f *TokenRequestFailures) Restore() {
+	*f.client = f.original
+}
@@ -0,0 +1,160 @@
+// +build all fast auth
+
+package coretest
+
+// (C) Copyright IBM Corp. 2021.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/go-sdk-core/v5/core"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTokenServer returns an IAM token server that issues one-hour tokens, along with the
+// number of tokens issued. If "serverTime" is nil, the token expiration is based on the
+// core library's clock.
+func newTokenServer(serverTime func() time.Time) (*httptest.Server, *int) {
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		now := core.GetCurrentTime()
+		if serverTime != nil {
+			now = serverTime().Unix()
+		}
+		w.Header().Set(core.CONTENT_TYPE, core.APPLICATION_JSON)
+		fmt.Fprintf(w, `{"access_token": "token-%d", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600, "expiration": %d}`,
+			issued, now+3600)
+	}))
+	return server, &issued
+}
+
+func TestFakeClockTokenExpiry(t *testing.T) {
+	clock, restore := UseFakeClock()
+	defer restore()
+	server, issued := newTokenServer(nil)
+	defer server.Close()
+
+	authenticator, err := core.NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// The token is cached until it expires.
+	clock.Advance(30 * time.Minute)
+	token, _ = authenticator.GetToken()
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, *issued)
+
+	clock.Advance(31 * time.Minute)
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+
+	clock.Set(time.Now())
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+}
+
+func TestFailTokenRequests(t *testing.T) {
+	clock, restore := UseFakeClock()
+	defer restore()
+	server, issued := newTokenServer(nil)
+	defer server.Close()
+
+	authenticator, err := core.NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+
+	// The token expires, and the next refresh fails.
+	failures, err := FailTokenRequests(authenticator, 1, http.StatusServiceUnavailable)
+	assert.Nil(t, err)
+	clock.Advance(2 * time.Hour)
+	_, err = authenticator.GetToken()
+	assert.NotNil(t, err)
+	var authErr *core.AuthenticationError
+	assert.ErrorAs(t, err, &authErr)
+	assert.Equal(t, http.StatusServiceUnavailable, authErr.Response.StatusCode)
+	assert.Equal(t, 1, failures.Failed())
+
+	// The following refresh succeeds.
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+	assert.Equal(t, 2, *issued)
+
+	// All requests fail until the client is restored.
+	failures, err = FailTokenRequests(authenticator, -1, http.StatusUnauthorized)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		clock.Advance(2 * time.Hour)
+		_, err = authenticator.GetToken()
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 3, failures.Failed())
+	failures.Restore()
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+
+	// Only token-managing authenticators are supported.
+	_, err = FailTokenRequests(&core.NoAuthAuthenticator{}, 1, http.StatusServiceUnavailable)
+	assert.NotNil(t, err)
+}
+
+func TestClockSkew(t *testing.T) {
+	server, issued := newTokenServer(time.Now)
+	defer server.Close()
+
+	authenticator, err := core.NewIamAuthenticator("apikey", server.URL, "", "", false, nil)
+	assert.Nil(t, err)
+
+	// A client whose clock runs two hours fast detects the skew from the token server's "Date"
+	// header, and so doesn't consider the new token to be expired already.
+	restore := UseClockSkew(2 * time.Hour)
+	defer restore()
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(-2*time.Hour), float64(core.GetClockSkew(authenticator)), float64(2*time.Second))
+	token, err := authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, *issued)
+
+	// Without skew detection, the client considers each new token to be expired already.
+	threshold := core.GetClockSkewThreshold()
+	defer core.SetClockSkewThreshold(threshold)
+	core.SetClockSkewThreshold(0)
+	authenticator.InvalidateToken()
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	_, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, *issued)
+	assert.Equal(t, time.Duration(0), core.GetClockSkew(authenticator))
+
+	// Without the skew, the token is reused.
+	restore()
+	token, err = authenticator.GetToken()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-3", token)
+	assert.Equal(t, 3, *issued)
+}
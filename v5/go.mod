@@ -11,6 +11,7 @@ require (
 	github.com/onsi/ginkgo v1.14.2
 	github.com/onsi/gomega v1.10.5
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/sys v0.0.0-20210603081109-ebe580a85c40
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
 	gopkg.in/go-playground/validator.v9 v9.31.0
 )